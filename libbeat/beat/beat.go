@@ -44,7 +44,9 @@ import (
 
 	"github.com/elastic/beats/libbeat/cfgfile"
 	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/keystore"
 	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/monitoring"
 	"github.com/elastic/beats/libbeat/paths"
 	"github.com/elastic/beats/libbeat/processors"
 	"github.com/elastic/beats/libbeat/publisher"
@@ -54,6 +56,7 @@ import (
 	// Register default processors.
 	_ "github.com/elastic/beats/libbeat/processors/actions"
 	_ "github.com/elastic/beats/libbeat/processors/add_cloud_metadata"
+	_ "github.com/elastic/beats/libbeat/processors/script"
 )
 
 // Beater is the interface that must be implemented by every Beat. A Beater
@@ -94,11 +97,14 @@ type Beat struct {
 
 // BeatConfig struct contains the basic configuration of every beat
 type BeatConfig struct {
-	Shipper    publisher.ShipperConfig   `config:",inline"`
-	Output     map[string]*common.Config `config:"output"`
-	Logging    logp.Logging              `config:"logging"`
-	Processors processors.PluginConfig   `config:"processors"`
-	Path       paths.Path                `config:"path"`
+	Shipper    publisher.ShipperConfig     `config:",inline"`
+	Output     map[string]*common.Config   `config:"output"`
+	Logging    logp.Logging                `config:"logging"`
+	Processors processors.PluginConfig     `config:"processors"`
+	Path       paths.Path                  `config:"path"`
+	Prometheus monitoring.PrometheusConfig `config:"prometheus"`
+	Reload     cfgfile.ReloadConfig        `config:"reload"`
+	Keystore   keystore.Config             `config:"keystore"`
 }
 
 var (
@@ -107,6 +113,10 @@ var (
 
 var debugf = logp.MakeDebug("beat")
 
+// outputTestTimeout is the time the outputs are given to connect to their
+// hosts with -configtest.output.
+const outputTestTimeout = 10 * time.Second
+
 // GracefulExit is an error that signals to exit with a code of 0.
 var GracefulExit = errors.New("graceful exit")
 
@@ -155,6 +165,18 @@ func (b *Beat) launch(bt Creator) error {
 		return err
 	}
 
+	if args := flag.Args(); len(args) > 0 {
+		switch args[0] {
+		case "keystore":
+			return b.keystoreCommand(args[1:])
+		case "setup":
+			return b.setupCommand(args[1:])
+		}
+		if cmd, ok := commands[args[0]]; ok {
+			return cmd(b, args[1:])
+		}
+	}
+
 	svc.BeforeRun()
 	defer svc.Cleanup()
 
@@ -163,18 +185,24 @@ func (b *Beat) launch(bt Creator) error {
 	}
 
 	// load the beats config section
-	var sub *common.Config
-	configName := strings.ToLower(b.Name)
-	if b.RawConfig.HasField(configName) {
-		sub, err = b.RawConfig.Child(configName, -1)
-		if err != nil {
-			return err
-		}
-	} else {
-		sub = common.NewConfig()
+	sub, err := b.beatConfig(b.RawConfig)
+	if err != nil {
+		return err
 	}
 
 	logp.Info("Setup Beat: %s; Version: %s", b.Name, b.Version)
+	// the metrics endpoint is not started when testing the config, not to
+	// conflict with the running Beat
+	prometheusConfig := b.Config.Prometheus
+	if cfgfile.IsTestConfig() {
+		prometheusConfig.Enabled = false
+	}
+	prometheus, err := monitoring.StartPrometheus(b.Name, prometheusConfig)
+	if err != nil {
+		return fmt.Errorf("error starting Prometheus exporter: %v", err)
+	}
+	defer prometheus.Stop()
+
 	processors, err := processors.New(b.Config.Processors)
 	if err != nil {
 		return fmt.Errorf("error initializing processors: %v", err)
@@ -198,12 +226,24 @@ func (b *Beat) launch(bt Creator) error {
 
 	// If -configtest was specified, exit now prior to run.
 	if cfgfile.IsTestConfig() {
+		if cfgfile.IsTestOutput() {
+			if err := publisher.TestOutputs(outputTestTimeout); err != nil {
+				return fmt.Errorf("error testing outputs: %v", err)
+			}
+		}
 		fmt.Println("Config OK")
 		return GracefulExit
 	}
 
 	svc.HandleSignals(beater.Stop)
 
+	if b.Config.Reload.Enabled {
+		reloader := b.startReload(beater, publisher)
+		if reloader != nil {
+			defer reloader.Stop()
+		}
+	}
+
 	logp.Info("%s start running.", b.Name)
 	defer logp.Info("%s stopped.", b.Name)
 	defer logp.LogTotalExpvars(&b.Config.Logging)
@@ -211,6 +251,16 @@ func (b *Beat) launch(bt Creator) error {
 	return beater.Run(b)
 }
 
+// beatConfig returns the beat specific config section of cfg, named after
+// the beat.
+func (b *Beat) beatConfig(cfg *common.Config) (*common.Config, error) {
+	configName := strings.ToLower(b.Name)
+	if !cfg.HasField(configName) {
+		return common.NewConfig(), nil
+	}
+	return cfg.Child(configName, -1)
+}
+
 // handleFlags parses the command line flags. It handles the '-version' flag
 // and invokes the HandleFlags callback if implemented by the Beat.
 func (b *Beat) handleFlags() error {
@@ -245,6 +295,15 @@ func (b *Beat) configure() error {
 		return fmt.Errorf("error loading config file: %v", err)
 	}
 
+	// secrets of the keystore are resolved when unpacking the config
+	store, err := b.openKeystore(cfg)
+	if err != nil {
+		return err
+	}
+	if store != nil {
+		common.AddConfigResolver(store.Resolve)
+	}
+
 	b.RawConfig = cfg
 	err = cfg.Unpack(&b.Config)
 	if err != nil {
@@ -0,0 +1,48 @@
+package beat
+
+import (
+	"fmt"
+
+	"github.com/elastic/beats/libbeat/cfgfile"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/paths"
+)
+
+// Command is a Beat specific command, run instead of the Beat when its name
+// is the first command line argument. It is passed the arguments following
+// the name, and returns GracefulExit on success.
+type Command func(b *Beat, args []string) error
+
+var commands = map[string]Command{}
+
+// AddCommand registers the command run by name. Commands are registered from
+// init functions, and cannot override the keystore and setup commands.
+func AddCommand(name string, cmd Command) {
+	commands[name] = cmd
+}
+
+// LoadConfig loads the configuration file of the Beat for running a command,
+// setting the paths and resolving the secrets of the keystore.
+func (b *Beat) LoadConfig() (*common.Config, error) {
+	cfg, err := cfgfile.Load("")
+	if err != nil {
+		return nil, fmt.Errorf("error loading config file: %v", err)
+	}
+	config := struct {
+		Path paths.Path `config:"path"`
+	}{}
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("error unpacking paths config: %v", err)
+	}
+	if err := paths.InitPaths(&config.Path); err != nil {
+		return nil, fmt.Errorf("error setting default paths: %v", err)
+	}
+	store, err := b.openKeystore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if store != nil {
+		common.AddConfigResolver(store.Resolve)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,243 @@
+package beat
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/elastic/beats/libbeat/cfgfile"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/keystore"
+	"github.com/elastic/beats/libbeat/paths"
+)
+
+const keystoreUsage = `usage: %[1]s keystore <command>
+
+Commands:
+  create [--force]              create an empty keystore
+  add KEY [--stdin] [--force]   store a secret, referenced in the config as ${KEY}
+  remove KEY...                 remove secrets
+  list                          list the keys of the stored secrets
+
+The keystore is encrypted with the password set in %[2]s.`
+
+// openKeystore opens the keystore resolving the ${key} references of the
+// config. Nil is returned if no keystore has been created.
+func (b *Beat) openKeystore(cfg *common.Config) (*keystore.Keystore, error) {
+	path, err := b.keystorePath(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := keystore.Open(path, keystorePassword())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening keystore: %v", err)
+	}
+	return store, nil
+}
+
+// keystorePath returns the path of the keystore file configured in cfg,
+// relative paths being resolved in the data path.
+func (b *Beat) keystorePath(cfg *common.Config) (string, error) {
+	config := struct {
+		Path     paths.Path      `config:"path"`
+		Keystore keystore.Config `config:"keystore"`
+	}{}
+	if err := cfg.Unpack(&config); err != nil {
+		return "", fmt.Errorf("error unpacking keystore config: %v", err)
+	}
+	if err := paths.InitPaths(&config.Path); err != nil {
+		return "", fmt.Errorf("error setting default paths: %v", err)
+	}
+
+	path := config.Keystore.Path
+	if path == "" {
+		path = strings.ToLower(b.Name) + ".keystore"
+	}
+	return paths.Resolve(paths.Data, path), nil
+}
+
+func keystorePassword() []byte {
+	return []byte(os.Getenv(keystore.PasswordEnv))
+}
+
+// keystoreCommand runs the 'keystore' command, managing the secrets of the
+// keystore instead of running the Beat.
+func (b *Beat) keystoreCommand(args []string) error {
+	flags := flag.NewFlagSet("keystore", flag.ContinueOnError)
+	force := flags.Bool("force", false, "Overwrite the existing keystore or key")
+	stdin := flags.Bool("stdin", false, "Read the secret from stdin")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, keystoreUsage+"\n", b.Name, keystore.PasswordEnv)
+	}
+
+	// flags may be given after the keys
+	var params []string
+	for {
+		if err := flags.Parse(args); err == flag.ErrHelp {
+			return GracefulExit
+		} else if err != nil {
+			return err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		params = append(params, args[0])
+		args = args[1:]
+	}
+	if len(params) == 0 {
+		flags.Usage()
+		return errors.New("missing keystore command")
+	}
+
+	cfg, err := cfgfile.Load("")
+	if err != nil {
+		return fmt.Errorf("error loading config file: %v", err)
+	}
+	path, err := b.keystorePath(cfg)
+	if err != nil {
+		return err
+	}
+
+	command, params := params[0], params[1:]
+	switch command {
+	case "create":
+		err = createKeystore(path, *force)
+	case "add":
+		if len(params) != 1 {
+			return errors.New("usage: keystore add KEY [--stdin] [--force]")
+		}
+		err = addKeystoreKey(path, params[0], *stdin, *force)
+	case "remove":
+		if len(params) == 0 {
+			return errors.New("usage: keystore remove KEY...")
+		}
+		err = removeKeystoreKeys(path, params)
+	case "list":
+		err = listKeystoreKeys(path)
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown keystore command '%s'", command)
+	}
+	if err != nil {
+		return err
+	}
+	return GracefulExit
+}
+
+func createKeystore(path string, force bool) error {
+	if _, err := os.Stat(path); err == nil && !force {
+		return fmt.Errorf("keystore %v already exists, use --force to overwrite it", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := keystore.New(path, keystorePassword()).Save(); err != nil {
+		return fmt.Errorf("error creating keystore: %v", err)
+	}
+	fmt.Printf("Created keystore %v\n", path)
+	return nil
+}
+
+func addKeystoreKey(path, key string, stdin, force bool) error {
+	store, err := keystore.Open(path, keystorePassword())
+	if os.IsNotExist(err) {
+		if err := createKeystore(path, false); err != nil {
+			return err
+		}
+		store, err = keystore.Open(path, keystorePassword())
+	}
+	if err != nil {
+		return err
+	}
+	if _, exists := store.Get(key); exists && !force {
+		return fmt.Errorf("key %v already exists, use --force to overwrite it", key)
+	}
+
+	value, err := readSecret(key, stdin)
+	if err != nil {
+		return err
+	}
+	if err := store.Set(key, value); err != nil {
+		return err
+	}
+	if err := store.Save(); err != nil {
+		return fmt.Errorf("error saving keystore: %v", err)
+	}
+	fmt.Printf("Added %v to the keystore\n", key)
+	return nil
+}
+
+// readSecret prompts for the secret without echoing it, or reads it from
+// stdin if stdin is not a terminal.
+func readSecret(key string, stdin bool) ([]byte, error) {
+	var value []byte
+	var err error
+	if restore, ok := disableEcho(int(os.Stdin.Fd())); ok && !stdin {
+		fmt.Printf("Enter value for %v: ", key)
+		value, err = bufio.NewReader(os.Stdin).ReadBytes('\n')
+		restore()
+		fmt.Println()
+	} else {
+		if ok {
+			restore()
+		}
+		value, err = ioutil.ReadAll(os.Stdin)
+	}
+	if err != nil && len(value) == 0 {
+		return nil, fmt.Errorf("error reading the value of %v: %v", key, err)
+	}
+
+	value = []byte(strings.TrimRight(string(value), "\r\n"))
+	if len(value) == 0 {
+		return nil, fmt.Errorf("empty value for %v", key)
+	}
+	return value, nil
+}
+
+// openExistingKeystore opens the keystore managed by the keystore commands,
+// reporting keystores not created yet.
+func openExistingKeystore(path string) (*keystore.Keystore, error) {
+	store, err := keystore.Open(path, keystorePassword())
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("keystore %v does not exist, create it with 'keystore create'", path)
+	}
+	return store, err
+}
+
+func removeKeystoreKeys(path string, keys []string) error {
+	store, err := openExistingKeystore(path)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if !store.Remove(key) {
+			return fmt.Errorf("key %v is not in the keystore", key)
+		}
+	}
+	if err := store.Save(); err != nil {
+		return fmt.Errorf("error saving keystore: %v", err)
+	}
+	fmt.Printf("Removed %v from the keystore\n", strings.Join(keys, ", "))
+	return nil
+}
+
+func listKeystoreKeys(path string) error {
+	store, err := openExistingKeystore(path)
+	if err != nil {
+		return err
+	}
+	for _, key := range store.Keys() {
+		fmt.Println(key)
+	}
+	return nil
+}
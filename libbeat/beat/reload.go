@@ -0,0 +1,50 @@
+package beat
+
+import (
+	"fmt"
+
+	"github.com/elastic/beats/libbeat/cfgfile"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/publisher"
+)
+
+// Reloader is an interface that can optionally be implemented by a Beater
+// supporting config reloads. If implemented and reload is enabled, the Reload
+// method is invoked with the beat specific config section each time the
+// config files are reloaded, while the Run-loop is running. On error the
+// Beater must keep running with its previous config.
+type Reloader interface {
+	Reload(cfg *common.Config) error
+}
+
+// startReload starts reloading the config files on SIGHUP and on changes.
+// Nil is returned if the Beater does not support reloading.
+func (b *Beat) startReload(beater Beater, pub *publisher.BeatPublisher) *cfgfile.Reloader {
+	r, ok := beater.(Reloader)
+	if !ok {
+		logp.Warn("%s does not support config reload, reload settings are ignored", b.Name)
+		return nil
+	}
+
+	reloader := cfgfile.NewReloader(b.Config.Reload, func(cfg *common.Config) error {
+		var config BeatConfig
+		if err := cfg.Unpack(&config); err != nil {
+			return fmt.Errorf("error unpacking config data: %v", err)
+		}
+		sub, err := b.beatConfig(cfg)
+		if err != nil {
+			return err
+		}
+
+		if err := r.Reload(sub); err != nil {
+			return err
+		}
+		if err := pub.ReloadOutputs(config.Output); err != nil {
+			return fmt.Errorf("error reloading outputs: %v", err)
+		}
+		return nil
+	})
+	reloader.Start()
+	return reloader
+}
@@ -0,0 +1,169 @@
+package beat
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/kibana"
+	"github.com/elastic/beats/libbeat/paths"
+)
+
+const setupUsage = `usage: %[1]s setup [--dashboards DIR] [--force]
+
+Imports the index pattern, searches, visualizations and dashboards of
+%[1]s into the Kibana instance configured in setup.kibana. Existing
+objects are kept unless --force is given.
+
+Options:`
+
+// setupConfig holds the settings of the setup command.
+type setupConfig struct {
+	Path  paths.Path `config:"path"`
+	Setup struct {
+		Kibana     kibana.Config `config:"kibana"`
+		Dashboards struct {
+			// directory holding the index-pattern, search, visualization
+			// and dashboard directories, relative paths being resolved in
+			// the home path
+			Directory string `config:"directory"`
+
+			// name of the index pattern generated from the template, if
+			// the dashboards do not hold one
+			Index string `config:"index"`
+		} `config:"dashboards"`
+	} `config:"setup"`
+
+	// credentials and template of the Elasticsearch output, used by
+	// default
+	Output struct {
+		Elasticsearch struct {
+			Username string `config:"username"`
+			Password string `config:"password"`
+			Template struct {
+				Path string `config:"path"`
+			} `config:"template"`
+		} `config:"elasticsearch"`
+	} `config:"output"`
+}
+
+// setupCommand runs the 'setup' command, importing the Kibana dashboards
+// instead of running the Beat.
+func (b *Beat) setupCommand(args []string) error {
+	flags := flag.NewFlagSet("setup", flag.ContinueOnError)
+	dir := flags.String("dashboards", "", "Directory of the dashboards, overriding setup.dashboards.directory")
+	force := flags.Bool("force", false, "Overwrite the existing dashboards")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, setupUsage+"\n", b.Name)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return GracefulExit
+	} else if err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return fmt.Errorf("unexpected setup argument '%s'", flags.Arg(0))
+	}
+
+	cfg, err := b.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	config, err := b.setupConfig(cfg)
+	if err != nil {
+		return err
+	}
+	if *dir != "" {
+		config.Setup.Dashboards.Directory = *dir
+	}
+
+	objects, err := b.loadDashboards(config)
+	if err != nil {
+		return err
+	}
+	client, err := kibana.NewClient(config.Setup.Kibana)
+	if err != nil {
+		return fmt.Errorf("error connecting to Kibana: %v", err)
+	}
+	failed, err := client.ImportDashboards(objects, *force)
+	if err != nil {
+		return fmt.Errorf("error importing dashboards: %v", err)
+	}
+
+	var errs []string
+	skipped := 0
+	for _, obj := range failed {
+		if obj.Status == 409 {
+			skipped++
+			continue
+		}
+		errs = append(errs, fmt.Sprintf("%s %s: %s", obj.Type, obj.ID, obj.Message))
+	}
+	fmt.Printf("Imported %d objects into Kibana\n", len(objects)-len(failed))
+	if skipped > 0 {
+		fmt.Printf("Kept %d existing objects, use --force to overwrite them\n", skipped)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("error importing dashboards: %s", strings.Join(errs, "; "))
+	}
+	return GracefulExit
+}
+
+// setupConfig reads the settings of the setup command from cfg, the
+// credentials of the Elasticsearch output serving as the default credentials
+// of Kibana.
+func (b *Beat) setupConfig(cfg *common.Config) (*setupConfig, error) {
+	config := &setupConfig{}
+	config.Setup.Kibana = kibana.DefaultConfig()
+	if err := cfg.Unpack(config); err != nil {
+		return nil, fmt.Errorf("error unpacking setup config: %v", err)
+	}
+	if err := paths.InitPaths(&config.Path); err != nil {
+		return nil, fmt.Errorf("error setting default paths: %v", err)
+	}
+
+	if config.Setup.Kibana.Username == "" && config.Setup.Kibana.Password == "" {
+		config.Setup.Kibana.Username = config.Output.Elasticsearch.Username
+		config.Setup.Kibana.Password = config.Output.Elasticsearch.Password
+	}
+	if config.Setup.Dashboards.Directory == "" {
+		config.Setup.Dashboards.Directory = "kibana"
+	}
+	if config.Setup.Dashboards.Index == "" {
+		config.Setup.Dashboards.Index = strings.ToLower(b.Name) + "-*"
+	}
+	return config, nil
+}
+
+// loadDashboards reads the dashboards to import, generating the index pattern
+// from the template of the Beat if the dashboards do not hold one.
+func (b *Beat) loadDashboards(config *setupConfig) ([]kibana.SavedObject, error) {
+	dir := paths.Resolve(paths.Home, config.Setup.Dashboards.Directory)
+	objects, err := kibana.LoadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if kibana.HasIndexPattern(objects) {
+		return objects, nil
+	}
+
+	path := config.Output.Elasticsearch.Template.Path
+	if path == "" {
+		path = strings.ToLower(b.Name) + ".template.json"
+	}
+	template, err := ioutil.ReadFile(paths.Resolve(paths.Config, path))
+	if err != nil {
+		return nil, fmt.Errorf("error reading the template of the index pattern: %v", err)
+	}
+	pattern, err := kibana.IndexPattern(config.Setup.Dashboards.Index, template)
+	if err != nil {
+		return nil, err
+	}
+	return append([]kibana.SavedObject{pattern}, objects...), nil
+}
@@ -0,0 +1,48 @@
+//go:build !integration
+// +build !integration
+
+package beat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func TestSetupConfigDefaults(t *testing.T) {
+	b := newBeat("Packetbeat", "5.3.0")
+	cfg, err := common.NewConfigFrom(map[string]interface{}{
+		"output.elasticsearch.username": "elastic",
+		"output.elasticsearch.password": "changeme",
+	})
+	assert.NoError(t, err)
+
+	config, err := b.setupConfig(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost:5601", config.Setup.Kibana.Host)
+	assert.Equal(t, "elastic", config.Setup.Kibana.Username)
+	assert.Equal(t, "changeme", config.Setup.Kibana.Password)
+	assert.Equal(t, "kibana", config.Setup.Dashboards.Directory)
+	assert.Equal(t, "packetbeat-*", config.Setup.Dashboards.Index)
+}
+
+func TestSetupConfig(t *testing.T) {
+	b := newBeat("packetbeat", "5.3.0")
+	cfg, err := common.NewConfigFrom(map[string]interface{}{
+		"setup.kibana.host":             "kibana:5601",
+		"setup.kibana.username":         "kibana",
+		"setup.dashboards.directory":    "/etc/fixbeat/kibana",
+		"setup.dashboards.index":        "fix-*",
+		"output.elasticsearch.username": "elastic",
+	})
+	assert.NoError(t, err)
+
+	config, err := b.setupConfig(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, "kibana:5601", config.Setup.Kibana.Host)
+	assert.Equal(t, "kibana", config.Setup.Kibana.Username)
+	assert.Equal(t, "/etc/fixbeat/kibana", config.Setup.Dashboards.Directory)
+	assert.Equal(t, "fix-*", config.Setup.Dashboards.Index)
+}
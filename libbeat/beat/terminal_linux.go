@@ -0,0 +1,30 @@
+package beat
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// disableEcho turns off the echo of the terminal fd, returning the function
+// restoring it. False is returned if fd is not a terminal.
+func disableEcho(fd int) (func(), bool) {
+	var old syscall.Termios
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd),
+		syscall.TCGETS, uintptr(unsafe.Pointer(&old))); e != 0 {
+		return nil, false
+	}
+
+	noEcho := old
+	noEcho.Lflag &^= syscall.ECHO
+	noEcho.Lflag |= syscall.ICANON | syscall.ISIG
+	noEcho.Iflag |= syscall.ICRNL
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd),
+		syscall.TCSETS, uintptr(unsafe.Pointer(&noEcho))); e != 0 {
+		return nil, false
+	}
+
+	return func() {
+		syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd),
+			syscall.TCSETS, uintptr(unsafe.Pointer(&old)))
+	}, true
+}
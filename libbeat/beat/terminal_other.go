@@ -0,0 +1,9 @@
+// +build !linux
+
+package beat
+
+// disableEcho is only supported on Linux, secrets typed in are echoed on
+// other systems.
+func disableEcho(fd int) (func(), bool) {
+	return nil, false
+}
@@ -17,6 +17,7 @@ var (
 	configfiles = flagArgList("c", "beat.yml", "Configuration file, relative to path.config")
 	overwrites  = common.NewFlagConfig(nil, nil, "E", "Configuration overwrite")
 	testConfig  = flag.Bool("configtest", false, "Test configuration and exit.")
+	testOutput  = flag.Bool("configtest.output", false, "Test configuration and the connection to the outputs, and exit.")
 
 	// Additional default settings, that must be available for variable expansion
 	defaults = mustNewConfigFrom(map[string]interface{}{
@@ -98,26 +99,11 @@ func Load(path string) (*common.Config, error) {
 	var config *common.Config
 	var err error
 
-	cfgpath := ""
-	if *configPath != "" {
-		cfgpath = *configPath
-	} else if *homePath != "" {
-		cfgpath = *homePath
-	}
-
 	if path == "" {
-		list := []string{}
-		for _, cfg := range configfiles.list {
-			if !filepath.IsAbs(cfg) {
-				list = append(list, filepath.Join(cfgpath, cfg))
-			} else {
-				list = append(list, cfg)
-			}
-		}
-		config, err = common.LoadFiles(list...)
+		config, err = common.LoadFiles(configFiles()...)
 	} else {
 		if !filepath.IsAbs(path) {
-			path = filepath.Join(cfgpath, path)
+			path = filepath.Join(configDir(), path)
 		}
 		config, err = common.LoadFile(path)
 	}
@@ -132,7 +118,36 @@ func Load(path string) (*common.Config, error) {
 	)
 }
 
+// configDir returns the directory relative config file paths are resolved in.
+func configDir() string {
+	if *configPath != "" {
+		return *configPath
+	}
+	return *homePath
+}
+
+// configFiles returns the paths of the config files set by the '-c' command
+// line flags.
+func configFiles() []string {
+	cfgpath := configDir()
+	list := []string{}
+	for _, cfg := range configfiles.list {
+		if !filepath.IsAbs(cfg) {
+			list = append(list, filepath.Join(cfgpath, cfg))
+		} else {
+			list = append(list, cfg)
+		}
+	}
+	return list
+}
+
 // IsTestConfig returns whether or not this is configuration used for testing
 func IsTestConfig() bool {
-	return *testConfig
+	return *testConfig || *testOutput
+}
+
+// IsTestOutput returns whether the connection to the outputs is tested with
+// the configuration.
+func IsTestOutput() bool {
+	return *testOutput
 }
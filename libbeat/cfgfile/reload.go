@@ -0,0 +1,168 @@
+package cfgfile
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"expvar"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// ReloadConfig enables reloading the config files while the Beat is running,
+// on SIGHUP and, if Period is set, when the files change.
+type ReloadConfig struct {
+	Enabled bool          `config:"enabled"`
+	Period  time.Duration `config:"period" validate:"min=0"`
+}
+
+var (
+	configReloads      = expvar.NewInt("libbeat.config.reloads")
+	configReloadErrors = expvar.NewInt("libbeat.config.reload_errors")
+)
+
+// Reloader loads the config files again when triggered, passing the new
+// config to the reload callback. Configs failing to load are logged, the Beat
+// keeps running with the previous config.
+type Reloader struct {
+	period time.Duration
+	reload func(*common.Config) error
+
+	// overwritten by tests
+	load    func() (*common.Config, error)
+	files   []string
+	signals chan os.Signal
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewReloader creates a reloader of the config files set by the '-c' command
+// line flags.
+func NewReloader(config ReloadConfig, reload func(*common.Config) error) *Reloader {
+	return &Reloader{
+		period: config.Period,
+		reload: reload,
+		load:   func() (*common.Config, error) { return Load("") },
+		files:  configFiles(),
+		done:   make(chan struct{}),
+	}
+}
+
+// Start waits for SIGHUP and watches the config files in the background.
+func (r *Reloader) Start() {
+	if r.signals == nil {
+		r.signals = make(chan os.Signal, 1)
+		signal.Notify(r.signals, syscall.SIGHUP)
+	}
+
+	var tick <-chan time.Time
+	if r.period > 0 {
+		ticker := time.NewTicker(r.period)
+		tick = ticker.C
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			<-r.done
+			ticker.Stop()
+		}()
+		logp.Info("Config reload enabled, on SIGHUP and changes of %v checked every %v",
+			r.files, r.period)
+	} else {
+		logp.Info("Config reload enabled on SIGHUP")
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.run(tick)
+	}()
+}
+
+// Stop stops waiting for reloads. A reload in progress is completed first.
+func (r *Reloader) Stop() {
+	close(r.done)
+	signal.Stop(r.signals)
+	r.wg.Wait()
+}
+
+func (r *Reloader) run(tick <-chan time.Time) {
+	files := fileChanges{loaded: r.hashFiles()}
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-r.signals:
+			logp.Info("Received SIGHUP, reloading config")
+			files.reloaded(r.hashFiles())
+		case <-tick:
+			if !files.changed(r.hashFiles()) {
+				continue
+			}
+			logp.Info("Config files changed, reloading config")
+		}
+		r.reloadConfig()
+	}
+}
+
+// fileChanges detects the changes of the config files from the hashes of
+// their contents checked every period. Files are reloaded once unchanged for
+// a period, not to load files still being written, like files truncated and
+// then written by editors.
+type fileChanges struct {
+	// hash of the files loaded, and of the changed files last checked
+	loaded, pending []byte
+}
+
+// changed returns true if the files hashed to current are to be reloaded.
+func (c *fileChanges) changed(current []byte) bool {
+	if current == nil || bytes.Equal(current, c.loaded) {
+		c.pending = nil
+		return false
+	}
+	if !bytes.Equal(current, c.pending) {
+		c.pending = current
+		return false
+	}
+	c.reloaded(current)
+	return true
+}
+
+func (c *fileChanges) reloaded(current []byte) {
+	c.loaded, c.pending = current, nil
+}
+
+func (r *Reloader) reloadConfig() {
+	cfg, err := r.load()
+	if err == nil {
+		err = r.reload(cfg)
+	}
+	if err != nil {
+		configReloadErrors.Add(1)
+		logp.Err("Failed to reload config, keeping the previous config: %v", err)
+		return
+	}
+	configReloads.Add(1)
+	logp.Info("Config reloaded")
+}
+
+// hashFiles returns the hash of the contents of the config files, or nil if
+// a file can not be read, like while it is being replaced.
+func (r *Reloader) hashFiles() []byte {
+	h := sha256.New()
+	for _, path := range r.files {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			logp.Debug("cfgfile", "Failed to read config file %v: %v", path, err)
+			return nil
+		}
+		h.Write(content)
+	}
+	return h.Sum(nil)
+}
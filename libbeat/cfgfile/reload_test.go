@@ -0,0 +1,110 @@
+// +build !integration
+
+package cfgfile
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func newTestReloader(t *testing.T, period time.Duration) (*Reloader, string, chan *common.Config) {
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "beat.yml")
+	if err := ioutil.WriteFile(path, []byte("name: first\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := make(chan *common.Config, 10)
+	r := NewReloader(ReloadConfig{Enabled: true, Period: period}, func(cfg *common.Config) error {
+		reloaded <- cfg
+		return nil
+	})
+	r.load = func() (*common.Config, error) { return common.LoadFile(path) }
+	r.files = []string{path}
+	r.signals = make(chan os.Signal, 1)
+	return r, path, reloaded
+}
+
+func expectReload(t *testing.T, reloaded chan *common.Config) string {
+	select {
+	case cfg := <-reloaded:
+		name, err := cfg.String("name", -1)
+		assert.NoError(t, err)
+		return name
+	case <-time.After(5 * time.Second):
+		t.Fatal("config not reloaded")
+		return ""
+	}
+}
+
+func TestReloadOnSignal(t *testing.T) {
+	r, path, reloaded := newTestReloader(t, 0)
+	defer os.RemoveAll(filepath.Dir(path))
+	r.Start()
+	defer r.Stop()
+
+	r.signals <- syscall.SIGHUP
+	assert.Equal(t, "first", expectReload(t, reloaded))
+}
+
+func TestReloadOnChange(t *testing.T) {
+	r, path, reloaded := newTestReloader(t, 10*time.Millisecond)
+	defer os.RemoveAll(filepath.Dir(path))
+	r.Start()
+	defer r.Stop()
+
+	// unchanged files are not reloaded
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, reloaded, 0)
+
+	if err := ioutil.WriteFile(path, []byte("name: second\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "second", expectReload(t, reloaded))
+}
+
+func TestReloadOnceUnchanged(t *testing.T) {
+	files := fileChanges{loaded: []byte("first")}
+	assert.False(t, files.changed([]byte("first")))
+
+	// truncated, then written
+	assert.False(t, files.changed([]byte("truncated")))
+	assert.False(t, files.changed([]byte("half")))
+	assert.False(t, files.changed([]byte("second")))
+	assert.True(t, files.changed([]byte("second")))
+	assert.False(t, files.changed([]byte("second")))
+
+	// files not readable are not reloaded
+	assert.False(t, files.changed(nil))
+	assert.False(t, files.changed(nil))
+}
+
+func TestReloadError(t *testing.T) {
+	r, path, reloaded := newTestReloader(t, 0)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	failures := configReloadErrors.Value()
+	r.reload = func(cfg *common.Config) error {
+		reloaded <- cfg
+		return errors.New("invalid config")
+	}
+	r.Start()
+
+	r.signals <- syscall.SIGHUP
+	expectReload(t, reloaded)
+	// the error is counted once the reload is complete
+	r.Stop()
+	assert.Equal(t, failures+1, configReloadErrors.Value())
+}
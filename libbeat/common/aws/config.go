@@ -0,0 +1,35 @@
+// Package aws signs HTTP requests to AWS services with Signature Version 4,
+// using the credentials of the default AWS credentials chain.
+package aws
+
+import "errors"
+
+// Config configures the region, service and credentials requests are signed
+// for. Credentials not set are looked up in the environment, the shared
+// credentials file, and the ECS or EC2 instance metadata, in this order.
+type Config struct {
+	Region  string `config:"region"`
+	Service string `config:"service"`
+
+	AccessKeyID     string `config:"access_key_id"`
+	SecretAccessKey string `config:"secret_access_key"`
+	SessionToken    string `config:"session_token"`
+
+	// Profile and CredentialsFile select the shared credentials
+	Profile         string `config:"profile"`
+	CredentialsFile string `config:"shared_credentials_file"`
+}
+
+// DefaultService is the service name of Amazon OpenSearch Service (formerly
+// Amazon Elasticsearch Service) domains.
+const DefaultService = "es"
+
+func (c *Config) Validate() error {
+	if c.Region == "" {
+		return errors.New("aws.region is required to sign requests")
+	}
+	if (c.AccessKeyID == "") != (c.SecretAccessKey == "") {
+		return errors.New("aws.access_key_id and aws.secret_access_key must be set together")
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+package aws
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// Credentials are AWS access keys. Temporary credentials have a session token
+// and expire.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expires         time.Time // zero if the credentials don't expire
+}
+
+// expiryWindow is the time before the expiration at which temporary
+// credentials are refreshed.
+const expiryWindow = 5 * time.Minute
+
+// provider retrieves credentials from one source of the chain. found is
+// false if the source has no credentials.
+type provider interface {
+	name() string
+	retrieve() (creds Credentials, found bool, err error)
+}
+
+// errNoCredentials is returned when no source of the chain has credentials.
+var errNoCredentials = errors.New("no AWS credentials found in the config, " +
+	"the environment, the shared credentials file or the instance metadata")
+
+// chain retrieves credentials from the first provider having credentials,
+// and caches them until they expire.
+type chain struct {
+	providers []provider
+
+	mutex    sync.Mutex
+	provider provider
+	creds    *Credentials
+}
+
+func newChain(config *Config, client *http.Client) *chain {
+	c := &chain{}
+	if config.AccessKeyID != "" {
+		c.providers = append(c.providers, &staticProvider{Credentials{
+			AccessKeyID:     config.AccessKeyID,
+			SecretAccessKey: config.SecretAccessKey,
+			SessionToken:    config.SessionToken,
+		}})
+	}
+	c.providers = append(c.providers,
+		envProvider{},
+		&fileProvider{path: config.CredentialsFile, profile: config.Profile},
+		&ecsProvider{client: client},
+		&ec2Provider{client: client},
+	)
+	return c
+}
+
+// get returns the cached credentials, or retrieves them if expired.
+func (c *chain) get(now time.Time) (Credentials, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.creds != nil && (c.creds.Expires.IsZero() || now.Add(expiryWindow).Before(c.creds.Expires)) {
+		return *c.creds, nil
+	}
+
+	// refresh from the provider found before
+	if c.provider != nil {
+		creds, found, err := c.provider.retrieve()
+		if err != nil {
+			return Credentials{}, fmt.Errorf("failed to refresh AWS credentials from %s: %v",
+				c.provider.name(), err)
+		}
+		if found {
+			c.creds = &creds
+			return creds, nil
+		}
+	}
+
+	for _, p := range c.providers {
+		creds, found, err := p.retrieve()
+		if err != nil {
+			logp.Debug("aws", "No AWS credentials from %s: %v", p.name(), err)
+			continue
+		}
+		if found {
+			logp.Info("Using AWS credentials from %s", p.name())
+			c.provider = p
+			c.creds = &creds
+			return creds, nil
+		}
+	}
+	return Credentials{}, errNoCredentials
+}
+
+type staticProvider struct {
+	creds Credentials
+}
+
+func (p *staticProvider) name() string { return "the config" }
+
+func (p *staticProvider) retrieve() (Credentials, bool, error) {
+	return p.creds, true, nil
+}
+
+type envProvider struct{}
+
+func (envProvider) name() string { return "the environment" }
+
+func (envProvider) retrieve() (Credentials, bool, error) {
+	creds := Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" {
+		creds.AccessKeyID = os.Getenv("AWS_ACCESS_KEY")
+	}
+	if creds.SecretAccessKey == "" {
+		creds.SecretAccessKey = os.Getenv("AWS_SECRET_KEY")
+	}
+	return creds, creds.AccessKeyID != "" && creds.SecretAccessKey != "", nil
+}
+
+// fileProvider reads the credentials of a profile from the shared
+// credentials file, by default ~/.aws/credentials.
+type fileProvider struct {
+	path    string
+	profile string
+}
+
+func (p *fileProvider) name() string { return "the shared credentials file" }
+
+func (p *fileProvider) retrieve() (Credentials, bool, error) {
+	path := p.path
+	if path == "" {
+		path = os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	}
+	if path == "" {
+		home := os.Getenv("HOME")
+		if home == "" {
+			home = os.Getenv("USERPROFILE")
+		}
+		if home == "" {
+			return Credentials{}, false, nil
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := p.profile
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) && p.path == "" {
+		return Credentials{}, false, nil
+	}
+	if err != nil {
+		return Credentials{}, false, err
+	}
+	defer f.Close()
+
+	var creds Credentials
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if section != profile {
+			continue
+		}
+
+		i := strings.IndexByte(line, '=')
+		if i < 0 {
+			continue
+		}
+		value := strings.TrimSpace(line[i+1:])
+		switch strings.TrimSpace(line[:i]) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = value
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = value
+		case "aws_session_token":
+			creds.SessionToken = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Credentials{}, false, err
+	}
+	return creds, creds.AccessKeyID != "" && creds.SecretAccessKey != "", nil
+}
+
+// metadataCredentials are the temporary credentials returned by the ECS and
+// EC2 metadata services.
+type metadataCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string
+	Token           string
+	Expiration      time.Time
+}
+
+func (m *metadataCredentials) credentials() (Credentials, bool, error) {
+	if m.AccessKeyID == "" || m.SecretAccessKey == "" {
+		return Credentials{}, false, errors.New("incomplete credentials")
+	}
+	return Credentials{
+		AccessKeyID:     m.AccessKeyID,
+		SecretAccessKey: m.SecretAccessKey,
+		SessionToken:    m.Token,
+		Expires:         m.Expiration,
+	}, true, nil
+}
+
+// ecsProvider retrieves the credentials of the task role of ECS tasks.
+type ecsProvider struct {
+	client *http.Client
+	// endpoint of the relative URIs, overwritten by tests
+	endpoint string
+}
+
+func (p *ecsProvider) name() string { return "the ECS task role" }
+
+func (p *ecsProvider) retrieve() (Credentials, bool, error) {
+	url := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		endpoint := p.endpoint
+		if endpoint == "" {
+			endpoint = "http://169.254.170.2"
+		}
+		url = endpoint + uri
+	}
+	if url == "" {
+		return Credentials{}, false, nil
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return Credentials{}, false, err
+	}
+	if token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	var m metadataCredentials
+	if err := getJSON(p.client, req, &m); err != nil {
+		return Credentials{}, false, err
+	}
+	return m.credentials()
+}
+
+// ec2Provider retrieves the credentials of the instance profile of EC2
+// instances from the instance metadata service, with IMDSv2 session tokens.
+type ec2Provider struct {
+	client *http.Client
+	// endpoint of the metadata service, overwritten by tests
+	endpoint string
+}
+
+func (p *ec2Provider) name() string { return "the EC2 instance profile" }
+
+func (p *ec2Provider) retrieve() (Credentials, bool, error) {
+	endpoint := p.endpoint
+	if endpoint == "" {
+		endpoint = "http://169.254.169.254"
+	}
+	// fail fast on hosts outside of EC2
+	client := *p.client
+	client.Timeout = 2 * time.Second
+
+	req, err := http.NewRequest("PUT", endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return Credentials{}, false, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+	token, err := get(&client, req)
+	if err != nil {
+		return Credentials{}, false, err
+	}
+
+	path := endpoint + "/latest/meta-data/iam/security-credentials/"
+	req, err = http.NewRequest("GET", path, nil)
+	if err != nil {
+		return Credentials{}, false, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", string(token))
+	role, err := get(&client, req)
+	if err != nil {
+		return Credentials{}, false, err
+	}
+
+	name := strings.TrimSpace(strings.SplitN(string(role), "\n", 2)[0])
+	if name == "" {
+		return Credentials{}, false, nil
+	}
+	req, err = http.NewRequest("GET", path+name, nil)
+	if err != nil {
+		return Credentials{}, false, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", string(token))
+
+	var m metadataCredentials
+	if err := getJSON(&client, req, &m); err != nil {
+		return Credentials{}, false, err
+	}
+	return m.credentials()
+}
+
+func get(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s: %s", req.Method, req.URL, resp.Status)
+	}
+	return body, nil
+}
+
+func getJSON(client *http.Client, req *http.Request, v interface{}) error {
+	body, err := get(client, req)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
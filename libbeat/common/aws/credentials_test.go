@@ -0,0 +1,178 @@
+// +build !integration
+
+package aws
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const metadataResponse = `{
+  "Code": "Success",
+  "AccessKeyId": "ASIAEXAMPLE",
+  "SecretAccessKey": "SECRET",
+  "Token": "TOKEN",
+  "Expiration": "2017-03-01T12:00:00Z"
+}`
+
+func TestFileProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "credentials")
+	err = ioutil.WriteFile(path, []byte(`
+# comment
+[default]
+aws_access_key_id = AKIDDEFAULT
+aws_secret_access_key = SECRETDEFAULT
+
+[fix]
+aws_access_key_id=AKIDFIX
+aws_secret_access_key=SECRETFIX
+aws_session_token=TOKENFIX
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Unsetenv("AWS_PROFILE")
+	creds, found, err := (&fileProvider{path: path}).retrieve()
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, Credentials{AccessKeyID: "AKIDDEFAULT", SecretAccessKey: "SECRETDEFAULT"}, creds)
+
+	creds, found, err = (&fileProvider{path: path, profile: "fix"}).retrieve()
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, Credentials{AccessKeyID: "AKIDFIX", SecretAccessKey: "SECRETFIX", SessionToken: "TOKENFIX"}, creds)
+
+	_, found, err = (&fileProvider{path: path, profile: "missing"}).retrieve()
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	_, _, err = (&fileProvider{path: filepath.Join(dir, "missing")}).retrieve()
+	assert.Error(t, err)
+}
+
+func TestEnvProvider(t *testing.T) {
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+
+	os.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+	os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+	_, found, _ := envProvider{}.retrieve()
+	assert.False(t, found)
+
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "SECRETENV")
+	creds, found, err := envProvider{}.retrieve()
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "AKIDENV", creds.AccessKeyID)
+	assert.Equal(t, "SECRETENV", creds.SecretAccessKey)
+}
+
+func TestECSProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/credentials/task" || r.Header.Get("Authorization") != "AUTH" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(metadataResponse))
+	}))
+	defer server.Close()
+
+	defer os.Unsetenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI")
+	defer os.Unsetenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	os.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "/v2/credentials/task")
+	os.Setenv("AWS_CONTAINER_AUTHORIZATION_TOKEN", "AUTH")
+
+	creds, found, err := (&ecsProvider{client: server.Client(), endpoint: server.URL}).retrieve()
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, Credentials{
+		AccessKeyID:     "ASIAEXAMPLE",
+		SecretAccessKey: "SECRET",
+		SessionToken:    "TOKEN",
+		Expires:         time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC),
+	}, creds)
+
+	os.Unsetenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI")
+	_, found, err = (&ecsProvider{client: server.Client(), endpoint: server.URL}).retrieve()
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestEC2Provider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			if r.Method != "PUT" {
+				http.Error(w, "method", http.StatusMethodNotAllowed)
+				return
+			}
+			w.Write([]byte("IMDSTOKEN"))
+			return
+		}
+		if r.Header.Get("X-aws-ec2-metadata-token") != "IMDSTOKEN" {
+			http.Error(w, "token", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/latest/meta-data/iam/security-credentials/":
+			w.Write([]byte("fixbeat-role\n"))
+		case "/latest/meta-data/iam/security-credentials/fixbeat-role":
+			w.Write([]byte(metadataResponse))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	creds, found, err := (&ec2Provider{client: server.Client(), endpoint: server.URL}).retrieve()
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "ASIAEXAMPLE", creds.AccessKeyID)
+	assert.Equal(t, "TOKEN", creds.SessionToken)
+}
+
+type countingProvider struct {
+	creds Credentials
+	calls int
+}
+
+func (p *countingProvider) name() string { return "test" }
+
+func (p *countingProvider) retrieve() (Credentials, bool, error) {
+	p.calls++
+	return p.creds, true, nil
+}
+
+func TestChainRefresh(t *testing.T) {
+	now := time.Date(2017, 3, 1, 11, 0, 0, 0, time.UTC)
+	p := &countingProvider{creds: Credentials{
+		AccessKeyID:     "ASIAEXAMPLE",
+		SecretAccessKey: "SECRET",
+		Expires:         now.Add(time.Hour),
+	}}
+	c := &chain{providers: []provider{p}}
+
+	_, err := c.get(now)
+	assert.NoError(t, err)
+	_, err = c.get(now.Add(50 * time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, p.calls)
+
+	// refreshed within the expiry window
+	_, err = c.get(now.Add(56 * time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, p.calls)
+}
@@ -0,0 +1,190 @@
+package aws
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	signingAlgorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat    = "20060102T150405Z"
+)
+
+// Signer signs HTTP requests with AWS Signature Version 4. It is safe for use
+// by multiple goroutines.
+type Signer struct {
+	region  string
+	service string
+	creds   *chain
+
+	now func() time.Time
+}
+
+// NewSigner creates a signer for the region and service of the config. The
+// credentials are retrieved on the first request signed.
+func NewSigner(config *Config) *Signer {
+	service := config.Service
+	if service == "" {
+		service = DefaultService
+	}
+	return &Signer{
+		region:  config.Region,
+		service: service,
+		creds:   newChain(config, &http.Client{}),
+		now:     time.Now,
+	}
+}
+
+// Sign adds the authorization headers to the request, signing its method,
+// URL, the host and content type headers, and the body. The body of the
+// request is not read, but must be given.
+func (s *Signer) Sign(req *http.Request, body []byte) error {
+	now := s.now().UTC()
+	creds, err := s.creds.get(now)
+	if err != nil {
+		return err
+	}
+
+	amzDate := now.Format(amzDateFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	} else {
+		req.Header.Del("X-Amz-Security-Token")
+	}
+
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// the default port is not sent, as by the AWS SDKs
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	if h, port, err := net.SplitHostPort(host); err == nil &&
+		(port == "443" && req.URL.Scheme == "https" || port == "80" && req.URL.Scheme == "http") {
+		host = h
+		if strings.Contains(h, ":") {
+			host = "[" + h + "]"
+		}
+		req.Host = host
+	}
+	headers := map[string]string{"host": host}
+	for _, name := range []string{"Content-Type", "X-Amz-Content-Sha256", "X-Amz-Date", "X-Amz-Security-Token"} {
+		if v := req.Header.Get(name); v != "" {
+			headers[strings.ToLower(name)] = strings.TrimSpace(v)
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders string
+	for _, name := range names {
+		canonicalHeaders += name + ":" + headers[name] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	date := amzDate[:8]
+	scope := strings.Join([]string{date, s.region, s.service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		signingAlgorithm,
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s.service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signingAlgorithm, creds.AccessKeyID, scope, signedHeaders, signature))
+	return nil
+}
+
+// canonicalURI returns the URI encoded path. Services other than S3 require
+// the segments of the path, already escaped in the request, to be encoded
+// again.
+func canonicalURI(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+	return escape(path, false)
+}
+
+// canonicalQuery returns the URI encoded query parameters, sorted by name
+// and value.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return escape(keys[i], true) < escape(keys[j], true) })
+
+	var params []string
+	for _, key := range keys {
+		values := make([]string, len(query[key]))
+		for i, value := range query[key] {
+			values[i] = escape(value, true)
+		}
+		sort.Strings(values)
+		for _, value := range values {
+			params = append(params, escape(key, true)+"="+value)
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// escape URI encodes all characters but the unreserved characters of RFC
+// 3986, and the slashes of paths.
+func escape(s string, encodeSlash bool) string {
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,100 @@
+// +build !integration
+
+package aws
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testSigner(token string) *Signer {
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	return &Signer{
+		region:  "us-east-1",
+		service: "es",
+		creds: &chain{providers: []provider{&staticProvider{Credentials{
+			AccessKeyID:     "AKIDEXAMPLE",
+			SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+			SessionToken:    token,
+		}}}},
+		now: func() time.Time { return now },
+	}
+}
+
+// The signatures are the ones computed by the AWS SDK for Go for the same
+// requests.
+func TestSign(t *testing.T) {
+	for _, test := range []struct {
+		method, url, body, token string
+		host, signedHeaders      string
+		signature                string
+	}{
+		{
+			method:        "GET",
+			url:           "https://example.amazonaws.com/",
+			host:          "example.amazonaws.com",
+			signedHeaders: "content-type;host;x-amz-content-sha256;x-amz-date",
+			signature:     "1cdc0a9d111bbfa046a39a62301c9187c3363ac028713b9644f0257e2fb7c482",
+		},
+		{
+			method:        "POST",
+			url:           "https://search-fix.us-east-1.es.amazonaws.com:443/_bulk",
+			body:          "{\"index\":{}}\n{\"a\":1}\n",
+			host:          "search-fix.us-east-1.es.amazonaws.com",
+			signedHeaders: "content-type;host;x-amz-content-sha256;x-amz-date",
+			signature:     "1384deaec9846aec274022f45e1f218f559407795026e0fb17d2d97c5a6d8320",
+		},
+		{
+			method:        "POST",
+			url:           "https://search-fix.us-east-1.es.amazonaws.com/packetbeat-2017.03.01/fix/_bulk?pipeline=fix&a-b=1&a=2&a=1&x=a%20b~c*",
+			body:          "{}\n",
+			token:         "SESSION",
+			host:          "search-fix.us-east-1.es.amazonaws.com",
+			signedHeaders: "content-type;host;x-amz-content-sha256;x-amz-date;x-amz-security-token",
+			signature:     "8d19e45246db021b4d3360900dd501130f915e3ee8323839a1b4edb552d62c9a",
+		},
+		{
+			method:        "GET",
+			url:           "https://example.amazonaws.com/ind%C3%A9x/_doc/a:b",
+			host:          "example.amazonaws.com",
+			signedHeaders: "content-type;host;x-amz-content-sha256;x-amz-date",
+			signature:     "c9bae85f572e317245571131e7c8fc7b9563565d6f620a123c375286e6f6fe20",
+		},
+	} {
+		req, err := http.NewRequest(test.method, test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+
+		if err := testSigner(test.token).Sign(req, []byte(test.body)); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, test.host, req.Host, test.url)
+		assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+		assert.Equal(t, test.token, req.Header.Get("X-Amz-Security-Token"))
+		assert.Equal(t, sha256Hex([]byte(test.body)), req.Header.Get("X-Amz-Content-Sha256"))
+		assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/es/aws4_request, "+
+			"SignedHeaders="+test.signedHeaders+", Signature="+test.signature,
+			req.Header.Get("Authorization"), test.url)
+	}
+}
+
+func TestSignNoCredentials(t *testing.T) {
+	s := testSigner("")
+	s.creds = &chain{}
+
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	assert.Equal(t, errNoCredentials, s.Sign(req, nil))
+	assert.Empty(t, req.Header.Get("Authorization"))
+}
+
+func TestConfigValidate(t *testing.T) {
+	assert.Error(t, (&Config{}).Validate())
+	assert.Error(t, (&Config{Region: "us-east-1", AccessKeyID: "AKID"}).Validate())
+	assert.NoError(t, (&Config{Region: "us-east-1"}).Validate())
+	assert.NoError(t, (&Config{Region: "us-east-1", AccessKeyID: "AKID", SecretAccessKey: "SECRET"}).Validate())
+}
@@ -1,10 +1,14 @@
 package common
 
-import "time"
+import (
+	"math/rand"
+	"time"
+)
 
 // A Backoff waits on errors with exponential backoff (limited by maximum
 // backoff). Resetting Backoff will reset the next sleep timer to the initial
-// backoff duration.
+// backoff duration. Each wait is randomized between half and the full backoff
+// duration, so clients failing at the same time do not retry in lockstep.
 type Backoff struct {
 	duration time.Duration
 	done     <-chan struct{}
@@ -38,7 +42,7 @@ func (b *Backoff) Wait() bool {
 	select {
 	case <-b.done:
 		return false
-	case <-time.After(backoff):
+	case <-time.After(jitter(backoff)):
 		b.last = time.Now()
 		return true
 	}
@@ -64,3 +68,12 @@ func (b *Backoff) TryWaitOnError(failTS time.Time, err error) bool {
 
 	return b.Wait()
 }
+
+// jitter returns a random duration between d/2 and d.
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
@@ -0,0 +1,30 @@
+// +build !integration
+
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoffJitter(t *testing.T) {
+	d := 100 * time.Millisecond
+	for i := 0; i < 100; i++ {
+		w := jitter(d)
+		assert.True(t, w >= d/2 && w <= d, "wait %v out of bounds", w)
+	}
+}
+
+func TestBackoffMax(t *testing.T) {
+	done := make(chan struct{})
+	b := NewBackoff(done, 1*time.Millisecond, 4*time.Millisecond)
+	for i := 0; i < 5; i++ {
+		assert.True(t, b.Wait())
+	}
+	assert.Equal(t, 4*time.Millisecond, b.duration)
+
+	close(done)
+	assert.False(t, b.Wait())
+}
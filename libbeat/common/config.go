@@ -2,6 +2,8 @@ package common
 
 import (
 	"flag"
+	"fmt"
+	"os"
 
 	"github.com/elastic/go-ucfg"
 	"github.com/elastic/go-ucfg/cfgutil"
@@ -19,10 +21,28 @@ type flagOverwrite struct {
 
 var configOpts = []ucfg.Option{
 	ucfg.PathSep("."),
-	ucfg.ResolveEnv,
+	ucfg.Resolve(resolveEnv),
 	ucfg.VarExp,
 }
 
+// AddConfigResolver adds a lookup of the ${name} references not found in the
+// config, like the keystore. The environment is looked up first, the resolvers
+// added later being looked up last.
+func AddConfigResolver(resolver func(name string) (string, error)) {
+	configOpts = append([]ucfg.Option{ucfg.Resolve(resolver)}, configOpts...)
+}
+
+// resolveEnv expands the ${VAR} references not found in the config from the
+// environment. Unlike ucfg.ResolveEnv, variables set to an empty value are
+// expanded, and undefined variables are reported by name.
+func resolveEnv(name string) (string, error) {
+	value, exists := os.LookupEnv(name)
+	if !exists {
+		return "", fmt.Errorf("environment variable %v is not set", name)
+	}
+	return value, nil
+}
+
 func NewConfig() *Config {
 	return fromConfig(ucfg.New())
 }
@@ -0,0 +1,109 @@
+// +build !integration
+
+package common
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/elastic/go-ucfg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigEnvExpansion(t *testing.T) {
+	os.Setenv("TEST_CONFIG_PASSWORD", "s3cr3t,with:specials")
+	os.Setenv("TEST_CONFIG_EMPTY", "")
+	defer os.Unsetenv("TEST_CONFIG_PASSWORD")
+	defer os.Unsetenv("TEST_CONFIG_EMPTY")
+
+	cfg, err := NewConfigWithYAML([]byte(`
+password: ${TEST_CONFIG_PASSWORD}
+username: ${TEST_CONFIG_USERNAME:beats}
+url: "https://${TEST_CONFIG_HOST:localhost}:9200"
+port: ${TEST_CONFIG_PORT:9200}
+empty: ${TEST_CONFIG_EMPTY}
+fallback: ${TEST_CONFIG_EMPTY:default}
+`), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var config struct {
+		Password string `config:"password"`
+		Username string `config:"username"`
+		URL      string `config:"url"`
+		Port     int    `config:"port"`
+		Empty    string `config:"empty"`
+		Fallback string `config:"fallback"`
+	}
+	if err := cfg.Unpack(&config); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "s3cr3t,with:specials", config.Password)
+	assert.Equal(t, "beats", config.Username)
+	assert.Equal(t, "https://localhost:9200", config.URL)
+	assert.Equal(t, 9200, config.Port)
+	assert.Equal(t, "", config.Empty)
+	assert.Equal(t, "default", config.Fallback)
+}
+
+func TestConfigEnvExpansionMissing(t *testing.T) {
+	cfg, err := NewConfigWithYAML([]byte("password: ${TEST_CONFIG_MISSING}"), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var config struct {
+		Password string `config:"password"`
+	}
+	err = cfg.Unpack(&config)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "environment variable TEST_CONFIG_MISSING is not set")
+	}
+}
+
+func TestAddConfigResolver(t *testing.T) {
+	defer func(opts []ucfg.Option) { configOpts = opts }(configOpts)
+
+	os.Setenv("TEST_CONFIG_USERNAME", "beats")
+	defer os.Unsetenv("TEST_CONFIG_USERNAME")
+	secrets := map[string]string{
+		"TEST_CONFIG_USERNAME": "ignored",
+		"es.password":          "s3cr3t",
+	}
+	AddConfigResolver(func(name string) (string, error) {
+		value, exists := secrets[name]
+		if !exists {
+			return "", fmt.Errorf("%v is not set in the environment or the keystore", name)
+		}
+		return value, nil
+	})
+
+	cfg, err := NewConfigWithYAML([]byte(`
+username: ${TEST_CONFIG_USERNAME}
+password: ${es.password}
+`), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var config struct {
+		Username string `config:"username"`
+		Password string `config:"password"`
+	}
+	if err := cfg.Unpack(&config); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "beats", config.Username)
+	assert.Equal(t, "s3cr3t", config.Password)
+
+	cfg, err = NewConfigWithYAML([]byte("password: ${TEST_CONFIG_MISSING}"), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cfg.Unpack(&config)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "TEST_CONFIG_MISSING is not set in the environment or the keystore")
+	}
+}
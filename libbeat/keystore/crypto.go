@@ -0,0 +1,97 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha512"
+	"errors"
+	"hash"
+	"io"
+)
+
+const (
+	saltLength  = 64
+	nonceLength = 12
+	keyLength   = 32 // AES-256
+	iterations  = 10000
+)
+
+var errDecrypt = errors.New("keystore can not be decrypted, " +
+	"check the password set in " + PasswordEnv)
+
+// encrypt encrypts data with AES-256-GCM, the key being derived from the
+// password and a random salt. The salt and nonce are prepended to the
+// encrypted data.
+func encrypt(password, data []byte) ([]byte, error) {
+	header := make([]byte, saltLength+nonceLength)
+	if _, err := io.ReadFull(rand.Reader, header); err != nil {
+		return nil, err
+	}
+	salt, nonce := header[:saltLength], header[saltLength:]
+
+	aead, err := newAEAD(password, salt)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(header, nonce, data, nil), nil
+}
+
+// decrypt decrypts data encrypted by encrypt, checking it has not been
+// modified.
+func decrypt(password, data []byte) ([]byte, error) {
+	if len(data) < saltLength+nonceLength {
+		return nil, errors.New("keystore is truncated")
+	}
+	salt := data[:saltLength]
+	nonce := data[saltLength : saltLength+nonceLength]
+
+	aead, err := newAEAD(password, salt)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, nonce, data[saltLength+nonceLength:], nil)
+	if err != nil {
+		return nil, errDecrypt
+	}
+	return plain, nil
+}
+
+func newAEAD(password, salt []byte) (cipher.AEAD, error) {
+	key := pbkdf2(password, salt, iterations, keyLength, sha512.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2 derives a key of keyLen bytes from the password, as defined by
+// RFC 2898 with HMAC of h as pseudorandom function.
+func pbkdf2(password, salt []byte, iter, keyLen int, h func() hash.Hash) []byte {
+	prf := hmac.New(h, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	key := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		key = prf.Sum(key)
+		t := key[len(key)-hashLen:]
+		copy(u, t)
+
+		for n := 2; n <= iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range u {
+				t[i] ^= u[i]
+			}
+		}
+	}
+	return key[:keyLen]
+}
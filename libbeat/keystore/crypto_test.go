@@ -0,0 +1,62 @@
+// +build !integration
+
+package keystore
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPBKDF2(t *testing.T) {
+	// test vectors of RFC 6070
+	tests := []struct {
+		password, salt string
+		iter, keyLen   int
+		key            string
+	}{
+		{"password", "salt", 1, 20, "0c60c80f961f0e71f3a9b524af6012062fe037a6"},
+		{"password", "salt", 4096, 20, "4b007901b765489abead49d926f721d065a429c1"},
+		{"passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, 25,
+			"3d2eec4fe41c849b80c8d83662c0e44a8b291a964cf2f07038"},
+	}
+
+	for _, test := range tests {
+		key := pbkdf2([]byte(test.password), []byte(test.salt), test.iter, test.keyLen, sha1.New)
+		assert.Equal(t, test.key, hex.EncodeToString(key))
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	password := []byte("changeme")
+	encrypted, err := encrypt(password, []byte("s3cr3t"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	plain, err := decrypt(password, encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t", string(plain))
+
+	// the salt and nonce are random
+	again, err := encrypt(password, []byte("s3cr3t"))
+	assert.NoError(t, err)
+	assert.NotEqual(t, encrypted, again)
+}
+
+func TestDecryptTampered(t *testing.T) {
+	password := []byte("changeme")
+	encrypted, err := encrypt(password, []byte("s3cr3t"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	encrypted[len(encrypted)-1] ^= 1
+	_, err = decrypt(password, encrypted)
+	assert.Equal(t, errDecrypt, err)
+
+	_, err = decrypt(password, encrypted[:saltLength])
+	assert.Error(t, err)
+}
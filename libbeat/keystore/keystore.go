@@ -0,0 +1,173 @@
+// Package keystore stores secrets, like output passwords and TLS key
+// passphrases, in an encrypted file. Entries are referenced in the config as
+// ${key}, for the secrets not to appear in plain text in the config files.
+package keystore
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+)
+
+// Config selects the keystore file. The default is <beatname>.keystore in
+// the data path.
+type Config struct {
+	Path string `config:"path"`
+}
+
+// PasswordEnv is the environment variable holding the password the keystore
+// is encrypted with. Without password the keystore is still encrypted, but
+// can be decrypted by anyone able to read it.
+const PasswordEnv = "KEYSTORE_PASSWORD"
+
+// version is the header of the keystore file format, followed by the base64
+// encoded salt, nonce and encrypted entries.
+var version = []byte("v1\n")
+
+var validKey = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Keystore holds the secrets of a keystore file. Changes are written to the
+// file by Save.
+type Keystore struct {
+	path     string
+	password []byte
+	entries  map[string][]byte
+}
+
+// New creates an empty keystore to be saved to path.
+func New(path string, password []byte) *Keystore {
+	return &Keystore{
+		path:     path,
+		password: password,
+		entries:  map[string][]byte{},
+	}
+}
+
+// Open loads the keystore file at path. If the file does not exist, the
+// error satisfies os.IsNotExist.
+func Open(path string, password []byte) (*Keystore, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("keystore %v must only be accessible by its owner (chmod 600 %v)",
+			path, path)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(content, version) {
+		return nil, fmt.Errorf("keystore %v has an unsupported format", path)
+	}
+	encrypted, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(content[len(version):])))
+	if err != nil {
+		return nil, fmt.Errorf("keystore %v is corrupted: %v", path, err)
+	}
+	plain, err := decrypt(password, encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	k := New(path, password)
+	if err := json.Unmarshal(plain, &k.entries); err != nil {
+		return nil, fmt.Errorf("keystore %v is corrupted: %v", path, err)
+	}
+	return k, nil
+}
+
+// Path returns the path of the keystore file.
+func (k *Keystore) Path() string {
+	return k.path
+}
+
+// Get returns the secret stored as key.
+func (k *Keystore) Get(key string) ([]byte, bool) {
+	value, exists := k.entries[key]
+	return value, exists
+}
+
+// Set stores a secret as key, replacing the secret already stored.
+func (k *Keystore) Set(key string, value []byte) error {
+	if !validKey.MatchString(key) {
+		return fmt.Errorf("invalid key %q, keys may contain letters, digits, '_', '.' and '-' only",
+			key)
+	}
+	k.entries[key] = value
+	return nil
+}
+
+// Remove removes a secret, returning false if key is not stored.
+func (k *Keystore) Remove(key string) bool {
+	_, exists := k.entries[key]
+	delete(k.entries, key)
+	return exists
+}
+
+// Keys returns the sorted keys of the stored secrets.
+func (k *Keystore) Keys() []string {
+	keys := make([]string, 0, len(k.entries))
+	for key := range k.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Save encrypts the secrets and replaces the keystore file, readable only by
+// its owner.
+func (k *Keystore) Save() error {
+	plain, err := json.Marshal(k.entries)
+	if err != nil {
+		return err
+	}
+	encrypted, err := encrypt(k.password, plain)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(version)
+	buf.WriteString(base64.StdEncoding.EncodeToString(encrypted))
+	buf.WriteByte('\n')
+
+	// write to a temporary file first, not to lose the keystore on failure
+	tmp, err := ioutil.TempFile(filepath.Dir(k.path), filepath.Base(k.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), k.path)
+}
+
+// Resolve returns the secret stored as name, for the ${name} references of
+// the config not found in the config or the environment.
+func (k *Keystore) Resolve(name string) (string, error) {
+	value, exists := k.entries[name]
+	if !exists {
+		return "", fmt.Errorf("%v is not set in the environment or the keystore", name)
+	}
+	return string(value), nil
+}
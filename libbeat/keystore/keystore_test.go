@@ -0,0 +1,108 @@
+// +build !integration
+
+package keystore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tempKeystore(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "test.keystore"), func() { os.RemoveAll(dir) }
+}
+
+func TestSaveOpen(t *testing.T) {
+	path, cleanup := tempKeystore(t)
+	defer cleanup()
+
+	store := New(path, []byte("changeme"))
+	assert.NoError(t, store.Set("es.password", []byte("s3cr3t")))
+	assert.NoError(t, store.Set("tls.passphrase", []byte("p4ss, phrase")))
+	assert.NoError(t, store.Save())
+
+	content, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(content), "s3cr3t")
+
+	store, err = Open(path, []byte("changeme"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"es.password", "tls.passphrase"}, store.Keys())
+	value, exists := store.Get("tls.passphrase")
+	assert.True(t, exists)
+	assert.Equal(t, "p4ss, phrase", string(value))
+
+	assert.True(t, store.Remove("es.password"))
+	assert.False(t, store.Remove("es.password"))
+	assert.NoError(t, store.Save())
+
+	store, err = Open(path, []byte("changeme"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tls.passphrase"}, store.Keys())
+}
+
+func TestOpenMissing(t *testing.T) {
+	path, cleanup := tempKeystore(t)
+	defer cleanup()
+
+	_, err := Open(path, nil)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestOpenWrongPassword(t *testing.T) {
+	path, cleanup := tempKeystore(t)
+	defer cleanup()
+
+	assert.NoError(t, New(path, []byte("changeme")).Save())
+
+	_, err := Open(path, []byte("wrong"))
+	assert.Equal(t, errDecrypt, err)
+}
+
+func TestOpenPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions are not checked on windows")
+	}
+
+	path, cleanup := tempKeystore(t)
+	defer cleanup()
+
+	assert.NoError(t, New(path, nil).Save())
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	assert.NoError(t, os.Chmod(path, 0644))
+	_, err = Open(path, nil)
+	assert.Error(t, err)
+}
+
+func TestSetInvalidKey(t *testing.T) {
+	store := New("test.keystore", nil)
+	for _, key := range []string{"", "es password", "${es.password}", "es/password"} {
+		assert.Error(t, store.Set(key, []byte("s3cr3t")), key)
+	}
+	assert.Empty(t, store.Keys())
+}
+
+func TestResolve(t *testing.T) {
+	store := New("test.keystore", nil)
+	assert.NoError(t, store.Set("es.password", []byte("s3cr3t")))
+
+	value, err := store.Resolve("es.password")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t", value)
+
+	_, err = store.Resolve("es.username")
+	assert.Error(t, err)
+}
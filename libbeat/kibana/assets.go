@@ -0,0 +1,142 @@
+package kibana
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// assetTypes lists the directories of the saved objects, in the order the
+// objects are imported, for their references to resolve.
+var assetTypes = []string{"index-pattern", "search", "visualization", "dashboard"}
+
+// LoadDir reads the saved objects stored as JSON files in the index-pattern,
+// search, visualization and dashboard directories of dir, as exported by
+// export_dashboards.py. The ID of an object is its file name.
+func LoadDir(dir string) ([]SavedObject, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("dashboards directory: %v", err)
+	}
+
+	var objects []SavedObject
+	for _, kind := range assetTypes {
+		files, err := filepath.Glob(filepath.Join(dir, kind, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+
+		for _, file := range files {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			var attributes map[string]interface{}
+			if err := json.Unmarshal(data, &attributes); err != nil {
+				return nil, fmt.Errorf("invalid saved object %v: %v", file, err)
+			}
+			objects = append(objects, SavedObject{
+				Type:       kind,
+				ID:         strings.TrimSuffix(filepath.Base(file), ".json"),
+				Attributes: attributes,
+			})
+		}
+	}
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("no dashboards found in %v", dir)
+	}
+	return objects, nil
+}
+
+// HasIndexPattern returns true if objects hold an index pattern.
+func HasIndexPattern(objects []SavedObject) bool {
+	for _, obj := range objects {
+		if obj.Type == "index-pattern" {
+			return true
+		}
+	}
+	return false
+}
+
+// IndexPattern creates the index pattern of the indices matching index from
+// the mappings of the Elasticsearch template of the Beat, for the fields of
+// the index pattern to match the template.
+func IndexPattern(index string, template []byte) (SavedObject, error) {
+	var tmpl struct {
+		Mappings map[string]struct {
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"mappings"`
+	}
+	if err := json.Unmarshal(template, &tmpl); err != nil {
+		return SavedObject{}, fmt.Errorf("invalid template: %v", err)
+	}
+
+	var fields []map[string]interface{}
+	for _, mapping := range tmpl.Mappings {
+		fields = appendFields(fields, "", mapping.Properties)
+	}
+	if len(fields) == 0 {
+		return SavedObject{}, fmt.Errorf("template has no fields")
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i]["name"].(string) < fields[j]["name"].(string)
+	})
+
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return SavedObject{}, err
+	}
+	return SavedObject{
+		Type: "index-pattern",
+		ID:   index,
+		Attributes: map[string]interface{}{
+			"title":         index,
+			"timeFieldName": "@timestamp",
+			"fields":        string(encoded),
+		},
+	}, nil
+}
+
+// appendFields appends the Kibana fields of the properties of a template
+// mapping, properties of objects being flattened to dotted names.
+func appendFields(fields []map[string]interface{}, prefix string, properties map[string]interface{}) []map[string]interface{} {
+	for name, value := range properties {
+		property, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		path := prefix + name
+		if sub, ok := property["properties"].(map[string]interface{}); ok {
+			fields = appendFields(fields, path+".", sub)
+			continue
+		}
+
+		esType, _ := property["type"].(string)
+		fields = append(fields, map[string]interface{}{
+			"name":         path,
+			"type":         kibanaType(esType),
+			"count":        0,
+			"scripted":     false,
+			"indexed":      true,
+			"analyzed":     esType == "text",
+			"doc_values":   esType != "text",
+			"searchable":   true,
+			"aggregatable": esType != "text",
+		})
+	}
+	return fields
+}
+
+func kibanaType(esType string) string {
+	switch esType {
+	case "long", "integer", "short", "byte", "double", "float", "half_float", "scaled_float":
+		return "number"
+	case "date", "boolean", "geo_point", "ip":
+		return esType
+	}
+	return "string"
+}
@@ -0,0 +1,90 @@
+// +build !integration
+
+package kibana
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeAsset(t *testing.T, dir, kind, name, content string) {
+	if err := os.MkdirAll(filepath.Join(dir, kind), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, kind, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kibana")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeAsset(t, dir, "dashboard", "FIX.json", `{"title": "FIX"}`)
+	writeAsset(t, dir, "visualization", "FIX-Latency.json", `{"title": "Latency"}`)
+	writeAsset(t, dir, "search", "FIX-Messages.json", `{"title": "Messages"}`)
+	writeAsset(t, dir, "visualization", "README.md", `not a saved object`)
+
+	objects, err := LoadDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []SavedObject{
+		{Type: "search", ID: "FIX-Messages", Attributes: map[string]interface{}{"title": "Messages"}},
+		{Type: "visualization", ID: "FIX-Latency", Attributes: map[string]interface{}{"title": "Latency"}},
+		{Type: "dashboard", ID: "FIX", Attributes: map[string]interface{}{"title": "FIX"}},
+	}, objects)
+	assert.False(t, HasIndexPattern(objects))
+
+	writeAsset(t, dir, "dashboard", "Broken.json", `{`)
+	_, err = LoadDir(dir)
+	assert.Error(t, err)
+
+	_, err = LoadDir(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestIndexPattern(t *testing.T) {
+	template := []byte(`{
+		"template": "packetbeat-*",
+		"mappings": {"_default_": {"properties": {
+			"@timestamp": {"type": "date"},
+			"fix": {"properties": {
+				"latency_us": {"type": "long"},
+				"raw": {"type": "text"},
+				"msg_type": {"type": "keyword", "ignore_above": 1024}
+			}},
+			"client_geoip": {"properties": {"location": {"type": "geo_point"}}}
+		}}}
+	}`)
+
+	pattern, err := IndexPattern("packetbeat-*", template)
+	assert.NoError(t, err)
+	assert.Equal(t, "index-pattern", pattern.Type)
+	assert.Equal(t, "packetbeat-*", pattern.ID)
+	assert.Equal(t, "@timestamp", pattern.Attributes["timeFieldName"])
+
+	var fields []map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(pattern.Attributes["fields"].(string)), &fields))
+	types := map[string]interface{}{}
+	for _, field := range fields {
+		types[field["name"].(string)] = field["type"]
+	}
+	assert.Equal(t, map[string]interface{}{
+		"@timestamp":            "date",
+		"client_geoip.location": "geo_point",
+		"fix.latency_us":        "number",
+		"fix.msg_type":          "string",
+		"fix.raw":               "string",
+	}, types)
+	assert.Equal(t, false, fields[4]["aggregatable"])
+
+	_, err = IndexPattern("packetbeat-*", []byte(`{}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,190 @@
+package kibana
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/libbeat/outputs"
+)
+
+// Config configures the connection to Kibana.
+type Config struct {
+	Host     string             `config:"host"`
+	Protocol string             `config:"protocol"`
+	Path     string             `config:"path"`
+	Username string             `config:"username"`
+	Password string             `config:"password"`
+	TLS      *outputs.TLSConfig `config:"ssl"`
+	Timeout  time.Duration      `config:"timeout" validate:"min=0"`
+}
+
+var (
+	defaultConfig = Config{
+		Host:    "localhost:5601",
+		Timeout: 90 * time.Second,
+	}
+)
+
+// DefaultConfig returns the default settings of the connection to Kibana.
+func DefaultConfig() Config {
+	return defaultConfig
+}
+
+// Client imports saved objects through the Kibana API.
+type Client struct {
+	url      string
+	username string
+	password string
+	http     *http.Client
+}
+
+// SavedObject is a dashboard, visualization, search or index pattern.
+type SavedObject struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// ImportError reports a saved object Kibana failed to import.
+type ImportError struct {
+	Type    string
+	ID      string
+	Status  int
+	Message string
+}
+
+// NewClient creates the client of the Kibana instance configured.
+func NewClient(config Config) (*Client, error) {
+	base, err := kibanaURL(config)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if config.TLS != nil {
+		tlsConfig, err := outputs.LoadTLSConfig(config.TLS)
+		if err != nil {
+			return nil, err
+		}
+		if tlsConfig != nil {
+			u, _ := url.Parse(base)
+			transport.TLSClientConfig = tlsConfig.BuildModuleConfig(u.Host)
+		}
+	}
+
+	return &Client{
+		url:      base,
+		username: config.Username,
+		password: config.Password,
+		http:     &http.Client{Transport: transport, Timeout: config.Timeout},
+	}, nil
+}
+
+// kibanaURL returns the base URL of Kibana from the host, protocol and path
+// configured. The scheme and path can also be given in the host.
+func kibanaURL(config Config) (string, error) {
+	host := config.Host
+	if !strings.Contains(host, "://") {
+		protocol := config.Protocol
+		if protocol == "" {
+			protocol = "http"
+			if config.TLS != nil && config.TLS.IsEnabled() {
+				protocol = "https"
+			}
+		}
+		host = protocol + "://" + host
+	}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return "", fmt.Errorf("invalid Kibana host %v: %v", config.Host, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("invalid Kibana protocol %v", u.Scheme)
+	}
+	if config.Path != "" {
+		u.Path = "/" + strings.Trim(config.Path, "/")
+	}
+	return strings.TrimRight(u.String(), "/"), nil
+}
+
+// ImportDashboards imports the saved objects, overwriting the existing objects
+// if overwrite is set. The objects Kibana rejected, for example because they
+// exist already, are returned.
+func (c *Client) ImportDashboards(objects []SavedObject, overwrite bool) ([]ImportError, error) {
+	body, err := json.Marshal(map[string]interface{}{"objects": objects})
+	if err != nil {
+		return nil, err
+	}
+
+	path := "/api/kibana/dashboards/import"
+	if overwrite {
+		path += "?force=true"
+	}
+	resp, err := c.request("POST", path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Objects []struct {
+			Type  string `json:"type"`
+			ID    string `json:"id"`
+			Error *struct {
+				StatusCode int    `json:"statusCode"`
+				Message    string `json:"message"`
+			} `json:"error"`
+		} `json:"objects"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return nil, fmt.Errorf("invalid response of Kibana: %v", err)
+	}
+
+	var failed []ImportError
+	for _, obj := range result.Objects {
+		if obj.Error == nil {
+			continue
+		}
+		failed = append(failed, ImportError{
+			Type:    obj.Type,
+			ID:      obj.ID,
+			Status:  obj.Error.StatusCode,
+			Message: obj.Error.Message,
+		})
+	}
+	return failed, nil
+}
+
+func (c *Client) request(method, path string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, c.url+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// required by Kibana for requests changing saved objects
+	req.Header.Set("kbn-xsrf", "beats")
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Kibana: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("Kibana returned %v: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	return data, nil
+}
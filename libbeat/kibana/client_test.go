@@ -0,0 +1,76 @@
+// +build !integration
+
+package kibana
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKibanaURL(t *testing.T) {
+	tests := []struct {
+		config Config
+		url    string
+	}{
+		{Config{Host: "localhost:5601"}, "http://localhost:5601"},
+		{Config{Host: "kibana:5601", Protocol: "https", Path: "/kibana/"}, "https://kibana:5601/kibana"},
+		{Config{Host: "https://kibana.example.com/"}, "https://kibana.example.com"},
+	}
+	for _, test := range tests {
+		url, err := kibanaURL(test.config)
+		assert.NoError(t, err)
+		assert.Equal(t, test.url, url)
+	}
+
+	_, err := kibanaURL(Config{Host: "ftp://kibana"})
+	assert.Error(t, err)
+}
+
+func TestImportDashboards(t *testing.T) {
+	var request struct {
+		Objects []SavedObject `json:"objects"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/kibana/dashboards/import", r.URL.Path)
+		assert.Equal(t, "true", r.URL.Query().Get("force"))
+		assert.Equal(t, "beats", r.Header.Get("kbn-xsrf"))
+		user, pass, _ := r.BasicAuth()
+		assert.Equal(t, "elastic", user)
+		assert.Equal(t, "changeme", pass)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+
+		w.Write([]byte(`{"objects":[
+			{"type":"visualization","id":"FIX-Latency","attributes":{}},
+			{"type":"dashboard","id":"FIX","error":{"statusCode":409,"message":"version conflict"}}
+		]}`))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(Config{Host: server.URL, Username: "elastic", Password: "changeme"})
+	assert.NoError(t, err)
+
+	objects := []SavedObject{
+		{Type: "visualization", ID: "FIX-Latency", Attributes: map[string]interface{}{"title": "Latency"}},
+		{Type: "dashboard", ID: "FIX", Attributes: map[string]interface{}{"title": "FIX"}},
+	}
+	failed, err := client.ImportDashboards(objects, true)
+	assert.NoError(t, err)
+	assert.Equal(t, objects, request.Objects)
+	assert.Equal(t, []ImportError{{Type: "dashboard", ID: "FIX", Status: 409, Message: "version conflict"}}, failed)
+}
+
+func TestImportDashboardsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"Unauthorized"}`, http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(Config{Host: server.URL})
+	assert.NoError(t, err)
+	_, err = client.ImportDashboards(nil, false)
+	assert.Contains(t, err.Error(), "401")
+}
@@ -192,6 +192,14 @@ func snapshotExpvars(varsMap map[string]int64) {
 	})
 }
 
+// SnapshotExpvars returns the current values of all integer expvars, by their
+// flattened name.
+func SnapshotExpvars() map[string]int64 {
+	vals := map[string]int64{}
+	snapshotExpvars(vals)
+	return vals
+}
+
 // buildMetricsOutput makes the delta between vals and prevVals and builds
 // a printable string with the non-zero deltas.
 func buildMetricsOutput(prevVals map[string]int64, vals map[string]int64) string {
@@ -0,0 +1,93 @@
+package monitoring
+
+import (
+	"bytes"
+	"expvar"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds in seconds of the buckets of latency
+// histograms, from 1ms to 1min.
+var LatencyBuckets = []float64{
+	0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60,
+}
+
+// Histogram is an expvar counting observed values in buckets by upper bound.
+// The expvar is a JSON object of the number of values observed, their sum,
+// and of the non-cumulative count per bucket.
+type Histogram struct {
+	buckets []float64
+
+	mutex  sync.Mutex
+	counts []uint64 // one per bucket, the last one for values above all bounds
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram creates and publishes a histogram expvar. The buckets are the
+// upper bounds, inclusive, of the values counted per bucket.
+func NewHistogram(name string, buckets []float64) *Histogram {
+	h := &Histogram{
+		buckets: append([]float64(nil), buckets...),
+		counts:  make([]uint64, len(buckets)+1),
+	}
+	sort.Float64s(h.buckets)
+	expvar.Publish(name, h)
+	return h
+}
+
+// Observe adds a value to the histogram.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.counts[i]++
+	h.count++
+	h.sum += v
+}
+
+// ObserveDuration adds a duration to the histogram, in seconds.
+func (h *Histogram) ObserveDuration(d time.Duration) {
+	h.Observe(d.Seconds())
+}
+
+// snapshot returns the cumulative count of values per bucket, the
+// number of values and their sum.
+func (h *Histogram) snapshot() (cumulative []uint64, count uint64, sum float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	cumulative = make([]uint64, len(h.buckets))
+	var n uint64
+	for i := range h.buckets {
+		n += h.counts[i]
+		cumulative[i] = n
+	}
+	return cumulative, h.count, h.sum
+}
+
+// String returns the histogram expvar as JSON.
+func (h *Histogram) String() string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `{"count": %d, "sum": %s, "buckets": {`, h.count, formatFloat(h.sum))
+	for i, bound := range h.buckets {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, `"%s": %d`, formatFloat(bound), h.counts[i])
+	}
+	fmt.Fprintf(&b, `, "+Inf": %d}}`, h.counts[len(h.buckets)])
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,220 @@
+package monitoring
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// metricInfo describes how an expvar is exported to Prometheus.
+type metricInfo struct {
+	gauge  bool
+	labels []string
+}
+
+var (
+	metricsMutex sync.Mutex
+	metrics      = map[string]*metricInfo{}
+)
+
+// defaultLabels are the label names of the keys of expvar Maps not
+// registered with SetLabels.
+var defaultLabels = []string{"key"}
+
+func info(name string) *metricInfo {
+	if m, found := metrics[name]; found {
+		return m
+	}
+	m := &metricInfo{labels: defaultLabels}
+	metrics[name] = m
+	return m
+}
+
+// SetGauge registers an integer or Map expvar as a gauge. Expvars are
+// exported as counters by default.
+func SetGauge(name string) {
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+	info(name).gauge = true
+}
+
+// SetLabels registers the label names of the keys of an expvar Map, one per
+// level of nested Maps. Keys of nested Maps beyond the labels given are
+// appended to the metric name.
+func SetLabels(name string, labels ...string) {
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+	info(name).labels = labels
+}
+
+type sample struct {
+	labels string
+	value  string
+}
+
+// family holds the samples of one metric, written together as required by
+// the exposition format.
+type family struct {
+	name    string
+	typ     string
+	samples []sample
+}
+
+type collector struct {
+	namespace string
+	names     []string
+	families  map[string]*family
+}
+
+// WritePrometheus writes all integer, float, Map and Histogram expvars, and
+// runtime metrics of the Go process, in the Prometheus text exposition
+// format. Metric names are the expvar names prefixed by the namespace, with
+// the characters not allowed replaced by underscores. Counters get the
+// _total suffix.
+func WritePrometheus(w io.Writer, namespace string) error {
+	c := &collector{namespace: namespace, families: map[string]*family{}}
+
+	metricsMutex.Lock()
+	expvar.Do(func(kv expvar.KeyValue) {
+		m := metrics[kv.Key]
+		if m == nil {
+			m = &metricInfo{labels: defaultLabels}
+		}
+		c.collect(kv.Key, m, nil, m.labels, kv.Value)
+	})
+	metricsMutex.Unlock()
+	c.collectRuntime()
+
+	out := bufio.NewWriter(w)
+	for _, name := range c.names {
+		f := c.families[name]
+		fmt.Fprintf(out, "# TYPE %s %s\n", f.name, f.typ)
+		for _, s := range f.samples {
+			fmt.Fprintf(out, "%s%s %s\n", f.name, s.labels, s.value)
+		}
+	}
+	return out.Flush()
+}
+
+func (c *collector) collect(
+	name string,
+	m *metricInfo,
+	labels []string,
+	labelNames []string,
+	v expvar.Var,
+) {
+	switch v := v.(type) {
+	case *expvar.Int:
+		c.add(name, m, labels, v.String())
+	case *expvar.Float:
+		c.add(name, m, labels, v.String())
+	case *Histogram:
+		c.addHistogram(name, labels, v)
+	case *expvar.Map:
+		v.Do(func(kv expvar.KeyValue) {
+			if len(labelNames) > 0 {
+				l := append(labels[:len(labels):len(labels)], labelNames[0], kv.Key)
+				c.collect(name, m, l, labelNames[1:], kv.Value)
+			} else {
+				c.collect(name+"."+kv.Key, m, labels, nil, kv.Value)
+			}
+		})
+	}
+}
+
+func (c *collector) family(name, typ string) *family {
+	if f, found := c.families[name]; found {
+		return f
+	}
+	f := &family{name: name, typ: typ}
+	c.families[name] = f
+	c.names = append(c.names, name)
+	return f
+}
+
+func (c *collector) add(name string, m *metricInfo, labels []string, value string) {
+	var f *family
+	if m.gauge {
+		f = c.family(c.metricName(name), "gauge")
+	} else {
+		f = c.family(c.metricName(name)+"_total", "counter")
+	}
+	f.samples = append(f.samples, sample{formatLabels(labels), value})
+}
+
+func (c *collector) addHistogram(name string, labels []string, h *Histogram) {
+	f := c.family(c.metricName(name), "histogram")
+	cumulative, count, sum := h.snapshot()
+	for i, bound := range h.buckets {
+		l := append(labels[:len(labels):len(labels)], "le", formatFloat(bound))
+		f.samples = append(f.samples, sample{
+			"_bucket" + formatLabels(l), fmt.Sprint(cumulative[i]),
+		})
+	}
+	l := append(labels[:len(labels):len(labels)], "le", "+Inf")
+	f.samples = append(f.samples,
+		sample{"_bucket" + formatLabels(l), fmt.Sprint(count)},
+		sample{"_sum" + formatLabels(labels), formatFloat(sum)},
+		sample{"_count" + formatLabels(labels), fmt.Sprint(count)},
+	)
+}
+
+func (c *collector) collectRuntime() {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	gauges := []struct {
+		name  string
+		value uint64
+	}{
+		{"go_goroutines", uint64(runtime.NumGoroutine())},
+		{"go_memstats_alloc_bytes", stats.Alloc},
+		{"go_memstats_sys_bytes", stats.Sys},
+		{"go_memstats_heap_objects", stats.HeapObjects},
+	}
+	for _, g := range gauges {
+		f := c.family(g.name, "gauge")
+		f.samples = append(f.samples, sample{"", fmt.Sprint(g.value)})
+	}
+	f := c.family("go_gc_runs_total", "counter")
+	f.samples = append(f.samples, sample{"", fmt.Sprint(stats.NumGC)})
+}
+
+func (c *collector) metricName(name string) string {
+	if c.namespace != "" {
+		name = c.namespace + "_" + name
+	}
+	return sanitizeName(name)
+}
+
+// sanitizeName replaces the characters not allowed in metric and label names
+// by underscores.
+func sanitizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == ':':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels formats pairs of label names and values.
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`,
+			sanitizeName(labels[i]), labelValueReplacer.Replace(labels[i+1])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,115 @@
+// +build !integration
+
+package monitoring
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram("test.histogram", []float64{1, 0.1, 10})
+	for _, v := range []float64{0.05, 0.1, 0.5, 2, 20} {
+		h.Observe(v)
+	}
+
+	cumulative, count, sum := h.snapshot()
+	assert.Equal(t, []uint64{2, 3, 4}, cumulative)
+	assert.Equal(t, uint64(5), count)
+	assert.InDelta(t, 22.65, sum, 1e-9)
+
+	var v map[string]interface{}
+	if err := json.Unmarshal([]byte(h.String()), &v); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, float64(5), v["count"])
+	assert.Equal(t, map[string]interface{}{
+		"0.1": float64(2), "1": float64(1), "10": float64(1), "+Inf": float64(1),
+	}, v["buckets"])
+}
+
+func TestWritePrometheus(t *testing.T) {
+	expvar.NewInt("test.prom.events").Add(3)
+	expvar.NewInt("test.prom.queue").Set(7)
+	SetGauge("test.prom.queue")
+
+	sessions := expvar.NewMap("test.prom.sessions")
+	SetLabels("test.prom.sessions", "session", "msg_type")
+	for _, key := range []string{"A->B", `C"D`} {
+		m := new(expvar.Map).Init()
+		m.Add("D", 2)
+		m.Add("8", 1)
+		sessions.Set(key, m)
+	}
+
+	fetches := expvar.NewMap("test.prom.fetches")
+	for _, key := range []string{"a", "b"} {
+		m := new(expvar.Map).Init()
+		m.Add("events", 1)
+		m.Add("failures", 0)
+		fetches.Set(key, m)
+	}
+
+	NewHistogram("test.prom.latency_seconds", []float64{0.1, 1}).Observe(0.5)
+
+	var buf bytes.Buffer
+	if err := WritePrometheus(&buf, "mybeat"); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, expected := range []string{
+		"# TYPE mybeat_test_prom_events_total counter\nmybeat_test_prom_events_total 3\n",
+		"# TYPE mybeat_test_prom_queue gauge\nmybeat_test_prom_queue 7\n",
+		"# TYPE mybeat_test_prom_sessions_total counter\n" +
+			`mybeat_test_prom_sessions_total{session="A->B",msg_type="8"} 1` + "\n" +
+			`mybeat_test_prom_sessions_total{session="A->B",msg_type="D"} 2` + "\n" +
+			`mybeat_test_prom_sessions_total{session="C\"D",msg_type="8"} 1` + "\n" +
+			`mybeat_test_prom_sessions_total{session="C\"D",msg_type="D"} 2` + "\n",
+		"# TYPE mybeat_test_prom_fetches_events_total counter\n" +
+			`mybeat_test_prom_fetches_events_total{key="a"} 1` + "\n" +
+			`mybeat_test_prom_fetches_events_total{key="b"} 1` + "\n",
+		"# TYPE mybeat_test_prom_latency_seconds histogram\n" +
+			`mybeat_test_prom_latency_seconds_bucket{le="0.1"} 0` + "\n" +
+			`mybeat_test_prom_latency_seconds_bucket{le="1"} 1` + "\n" +
+			`mybeat_test_prom_latency_seconds_bucket{le="+Inf"} 1` + "\n" +
+			"mybeat_test_prom_latency_seconds_sum 0.5\n" +
+			"mybeat_test_prom_latency_seconds_count 1\n",
+		"# TYPE go_goroutines gauge\n",
+	} {
+		assert.Contains(t, out, expected)
+	}
+	assert.Equal(t, 1, strings.Count(out, "# TYPE mybeat_test_prom_fetches_failures_total counter"))
+}
+
+func TestStartPrometheus(t *testing.T) {
+	server, err := StartPrometheus("mybeat", PrometheusConfig{Enabled: false})
+	assert.NoError(t, err)
+	assert.Nil(t, server)
+	server.Stop()
+
+	server, err = StartPrometheus("mybeat", PrometheusConfig{
+		Enabled: true,
+		Host:    "127.0.0.1:0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	resp, err := http.Get("http://" + server.Addr().String() + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Contains(t, string(body), "# TYPE go_goroutines gauge")
+}
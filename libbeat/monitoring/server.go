@@ -0,0 +1,68 @@
+// Package monitoring exports the internal metrics of the Beats, published as
+// expvars, to Prometheus.
+package monitoring
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// DefaultHost is the listen address of the Prometheus exporter if not
+// configured.
+const DefaultHost = "localhost:9479"
+
+// PrometheusConfig configures the HTTP endpoint serving the metrics in the
+// Prometheus exposition format.
+type PrometheusConfig struct {
+	Enabled bool   `config:"enabled"`
+	Host    string `config:"host"`
+}
+
+// Server serves the metrics on /metrics.
+type Server struct {
+	listener net.Listener
+}
+
+// StartPrometheus starts the Prometheus exporter if enabled. The metric names
+// are prefixed by the namespace, the name of the Beat. A nil server is
+// returned if the exporter is disabled.
+func StartPrometheus(namespace string, config PrometheusConfig) (*Server, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+
+	host := config.Host
+	if host == "" {
+		host = DefaultHost
+	}
+	listener, err := net.Listen("tcp", host)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if err := WritePrometheus(w, namespace); err != nil {
+			logp.Err("Failed to write Prometheus metrics: %v", err)
+		}
+	})
+	go http.Serve(listener, mux)
+
+	logp.Info("Serving Prometheus metrics on http://%s/metrics", listener.Addr())
+	return &Server{listener: listener}, nil
+}
+
+// Addr returns the listen address of the server.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Stop stops the server.
+func (s *Server) Stop() {
+	if s != nil {
+		s.listener.Close()
+	}
+}
@@ -1,11 +1,34 @@
 package console
 
+import "fmt"
+
 type config struct {
 	Pretty bool `config:"pretty"`
+
+	// json or fix, printing the message field of events as pipe-delimited
+	// FIX
+	Format string `config:"format"`
+
+	// event field holding the FIX message printed by the fix format
+	Field string `config:"field"`
+
+	// colorize the tag numbers of FIX messages
+	Color bool `config:"color"`
 }
 
 var (
 	defaultConfig = config{
 		Pretty: false,
+		Format: "json",
+		Field:  "fix.raw",
 	}
 )
+
+func (c *config) Validate() error {
+	switch c.Format {
+	case "json", "fix":
+	default:
+		return fmt.Errorf("invalid console format: %v, must be one of json or fix", c.Format)
+	}
+	return nil
+}
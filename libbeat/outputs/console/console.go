@@ -39,7 +39,9 @@ func New(_ string, config *common.Config, _ int) (outputs.Outputer, error) {
 }
 
 func newConsole(pretty bool) *console {
-	return &console{config: config{pretty}, out: os.Stdout}
+	c := &console{config: defaultConfig, out: os.Stdout}
+	c.config.Pretty = pretty
+	return c
 }
 
 // Implement Outputer
@@ -52,13 +54,20 @@ func (c *console) PublishEvent(
 	opts outputs.Options,
 	data outputs.Data,
 ) error {
-	var jsonEvent []byte
+	var serialized []byte
 	var err error
+	var ok bool
 
-	if c.config.Pretty {
-		jsonEvent, err = json.MarshalIndent(data.Event, "", "  ")
-	} else {
-		jsonEvent, err = json.Marshal(data.Event)
+	if c.config.Format == "fix" {
+		serialized, ok = formatFIX(data.Event, c.config.Field, c.config.Color)
+	}
+	if !ok {
+		// events not holding a FIX message are printed as JSON
+		if c.config.Pretty {
+			serialized, err = json.MarshalIndent(data.Event, "", "  ")
+		} else {
+			serialized, err = json.Marshal(data.Event)
+		}
 	}
 	if err != nil {
 		logp.Err("Fail to convert the event to JSON (%v): %#v", err, data.Event)
@@ -66,7 +75,7 @@ func (c *console) PublishEvent(
 		return err
 	}
 
-	if err = c.writeBuffer(jsonEvent); err != nil {
+	if err = c.writeBuffer(serialized); err != nil {
 		goto fail
 	}
 	if err = c.writeBuffer([]byte{'\n'}); err != nil {
@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/elastic/beats/libbeat/common"
 	"github.com/elastic/beats/libbeat/outputs"
@@ -94,3 +95,47 @@ func TestConsoleMultipleEventsIndented(t *testing.T) {
 		"{\n  \"event\": \"event3\"\n}\n"
 	assert.Equal(t, expected, lines)
 }
+
+func runFIX(color bool, events ...common.MapStr) (string, error) {
+	return withStdout(func() {
+		c := newConsole(false)
+		c.config.Format = "fix"
+		c.config.Color = color
+		for _, event := range events {
+			c.PublishEvent(nil, outputs.Options{}, outputs.Data{Event: event})
+		}
+	})
+}
+
+func fixEvent(raw string) common.MapStr {
+	return common.MapStr{
+		"@timestamp": common.Time(time.Date(2016, 10, 14, 9, 0, 0, 123456000, time.UTC)),
+		"src":        &common.Endpoint{IP: "10.0.0.1", Port: 40000},
+		"dst":        &common.Endpoint{IP: "10.0.0.2", Port: 9878},
+		"fix":        common.MapStr{"raw": raw},
+	}
+}
+
+func TestConsoleFIX(t *testing.T) {
+	lines, err := runFIX(false, fixEvent("8=FIX.4.2\x0135=0\x01"))
+	assert.Nil(t, err)
+	expected := "2016-10-14T09:00:00.123456Z 10.0.0.1:40000 -> 10.0.0.2:9878 8=FIX.4.2|35=0|\n"
+	assert.Equal(t, expected, lines)
+}
+
+func TestConsoleFIXColor(t *testing.T) {
+	event := fixEvent("8=FIX.4.2|35=0|")
+	delete(event, "@timestamp")
+	delete(event, "src")
+
+	lines, err := runFIX(true, event)
+	assert.Nil(t, err)
+	expected := "\x1b[36m8\x1b[0m=FIX.4.2|\x1b[36m35\x1b[0m=0|\n"
+	assert.Equal(t, expected, lines)
+}
+
+func TestConsoleFIXWithoutMessage(t *testing.T) {
+	lines, err := runFIX(false, event("event", "myevent"))
+	assert.Nil(t, err)
+	assert.Equal(t, "{\"event\":\"myevent\"}\n", lines)
+}
@@ -0,0 +1,76 @@
+package console
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+const (
+	colorTag   = "\x1b[36m"
+	colorReset = "\x1b[0m"
+)
+
+// formatFIX formats the FIX message stored in field of the event as a single
+// line, prefixed with the event timestamp and the connection endpoints. SOH
+// delimiters are translated to '|'. False is returned if the event holds no
+// FIX message.
+func formatFIX(event common.MapStr, field string, color bool) ([]byte, bool) {
+	v, err := event.GetValue(field)
+	if err != nil {
+		return nil, false
+	}
+	msg, ok := v.(string)
+	if !ok || msg == "" {
+		return nil, false
+	}
+	msg = strings.Replace(msg, "\x01", "|", -1)
+
+	var buf bytes.Buffer
+	if ts, ok := event["@timestamp"].(common.Time); ok {
+		buf.WriteString(time.Time(ts).UTC().Format("2006-01-02T15:04:05.000000Z"))
+		buf.WriteByte(' ')
+	}
+	src, srcOK := endpoint(event["src"])
+	dst, dstOK := endpoint(event["dst"])
+	if srcOK && dstOK {
+		fmt.Fprintf(&buf, "%s -> %s ", src, dst)
+	}
+
+	if !color {
+		buf.WriteString(msg)
+		return buf.Bytes(), true
+	}
+
+	for i, field := range strings.Split(msg, "|") {
+		if i > 0 {
+			buf.WriteByte('|')
+		}
+		eq := strings.IndexByte(field, '=')
+		if eq < 0 {
+			buf.WriteString(field)
+			continue
+		}
+		buf.WriteString(colorTag)
+		buf.WriteString(field[:eq])
+		buf.WriteString(colorReset)
+		buf.WriteString(field[eq:])
+	}
+	return buf.Bytes(), true
+}
+
+func endpoint(v interface{}) (string, bool) {
+	switch e := v.(type) {
+	case *common.Endpoint:
+		if e == nil {
+			return "", false
+		}
+		return fmt.Sprintf("%s:%d", e.IP, e.Port), true
+	case common.Endpoint:
+		return fmt.Sprintf("%s:%d", e.IP, e.Port), true
+	}
+	return "", false
+}
@@ -2,6 +2,10 @@ package elasticsearch
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
 
 	"github.com/elastic/beats/libbeat/logp"
 )
@@ -32,11 +36,152 @@ type Hits struct {
 	Hits  []json.RawMessage `json:"hits"`
 }
 
+// UnmarshalJSON reads the total number of hits as a number, or from the
+// object returned by Elasticsearch 7.0 and later.
+func (h *Hits) UnmarshalJSON(b []byte) error {
+	var hits struct {
+		Total json.RawMessage   `json:"total"`
+		Hits  []json.RawMessage `json:"hits"`
+	}
+	if err := json.Unmarshal(b, &hits); err != nil {
+		return err
+	}
+	h.Hits = hits.Hits
+	h.Total = 0
+	if len(hits.Total) == 0 {
+		return nil
+	}
+	if hits.Total[0] != '{' {
+		return json.Unmarshal(hits.Total, &h.Total)
+	}
+	var total struct {
+		Value int `json:"value"`
+	}
+	if err := json.Unmarshal(hits.Total, &total); err != nil {
+		return err
+	}
+	h.Total = total.Value
+	return nil
+}
+
 type CountResults struct {
 	Count  int             `json:"count"`
 	Shards json.RawMessage `json:"_shards"`
 }
 
+// MgetResults holds the documents returned by Mget, in the order requested.
+// Documents not found have Found unset.
+type MgetResults struct {
+	Docs []QueryResult `json:"docs"`
+}
+
+// SearchRequest is a search of a multi search request. Index and Type default
+// to the index and type of the multi search.
+type SearchRequest struct {
+	Index string
+	Type  string
+	Body  interface{}
+}
+
+// MsearchResults holds the results of the searches of a multi search, in the
+// order of the searches.
+type MsearchResults struct {
+	Took      int              `json:"took"`
+	Responses []SearchResponse `json:"responses"`
+}
+
+// SearchResponse is the result of a search of a multi search. Failed searches
+// have Error set, holding the error object reported by Elasticsearch.
+type SearchResponse struct {
+	SearchResults
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error"`
+}
+
+type DeleteByQueryResults struct {
+	Took     int               `json:"took"`
+	TimedOut bool              `json:"timed_out"`
+	Total    int               `json:"total"`
+	Deleted  int               `json:"deleted"`
+	Failures []json.RawMessage `json:"failures"`
+}
+
+// Error is returned for requests answered with a non-2xx HTTP status code. It
+// holds the error type and reason reported by Elasticsearch, if any.
+type Error struct {
+	StatusCode int
+	Status     string
+	Type       string
+	Reason     string
+}
+
+// maxErrorBodySize limits the size of error responses read.
+const maxErrorBodySize = 64 * 1024
+
+func (e *Error) Error() string {
+	switch {
+	case e.Type != "" && e.Reason != "":
+		return fmt.Sprintf("%v: %v (%v)", e.Status, e.Reason, e.Type)
+	case e.Reason != "":
+		return fmt.Sprintf("%v: %v", e.Status, e.Reason)
+	case e.Type != "":
+		return fmt.Sprintf("%v: %v", e.Status, e.Type)
+	}
+	return e.Status
+}
+
+// Retryable reports whether the request might succeed if sent again. Only
+// server errors (5xx), request timeouts and throttled requests are retryable.
+func (e *Error) Retryable() bool {
+	switch e.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return e.StatusCode >= 500
+}
+
+// isRejected returns true if the events of a request answered with status
+// are rejected by Elasticsearch, and would be rejected again if sent again.
+// Other errors, like authentication and authorization failures, are not
+// caused by the events.
+func isRejected(status int) bool {
+	return status == http.StatusBadRequest || status == http.StatusRequestEntityTooLarge
+}
+
+// readError creates an Error from a failed response, parsing the error
+// object of Elasticsearch 2.x and later or the error string of 1.x.
+func readError(resp *http.Response) *Error {
+	e := &Error{StatusCode: resp.StatusCode, Status: resp.Status}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err != nil || len(body) == 0 {
+		return e
+	}
+
+	var msg struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(body, &msg); err != nil || len(msg.Error) == 0 {
+		return e
+	}
+
+	var details struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(msg.Error, &details); err == nil {
+		e.Type = details.Type
+		e.Reason = details.Reason
+		return e
+	}
+
+	var reason string
+	if err := json.Unmarshal(msg.Error, &reason); err == nil {
+		e.Reason = reason
+	}
+	return e
+}
+
 func (r QueryResult) String() string {
 	out, err := json.Marshal(r)
 	if err != nil {
@@ -93,6 +238,45 @@ func readCountResult(obj []byte) (*CountResults, error) {
 	return &result, err
 }
 
+func readMgetResult(obj []byte) (*MgetResults, error) {
+	if obj == nil {
+		return nil, nil
+	}
+
+	var result MgetResults
+	err := json.Unmarshal(obj, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, err
+}
+
+func readMsearchResult(obj []byte) (*MsearchResults, error) {
+	if obj == nil {
+		return nil, nil
+	}
+
+	var result MsearchResults
+	err := json.Unmarshal(obj, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, err
+}
+
+func readDeleteByQueryResult(obj []byte) (*DeleteByQueryResults, error) {
+	if obj == nil {
+		return nil, nil
+	}
+
+	var result DeleteByQueryResults
+	err := json.Unmarshal(obj, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, err
+}
+
 // Index adds or updates a typed JSON document in a specified index, making it
 // searchable. In case id is empty, a new id is created over a HTTP POST request.
 // Otherwise, a HTTP PUT request is issued.
@@ -141,6 +325,28 @@ func (es *Connection) Delete(index string, docType string, id string, params map
 	return withQueryResult(es.apiCall("DELETE", index, docType, id, "", params, nil))
 }
 
+// DeleteIndex deletes an index, including all its documents.
+// Implements: https://www.elastic.co/guide/en/elasticsearch/reference/current/indices-delete-index.html
+func (es *Connection) DeleteIndex(index string) (int, *QueryResult, error) {
+	return withQueryResult(es.apiCall("DELETE", index, "", "", "", nil, nil))
+}
+
+// DeleteByQuery deletes all documents matching the query passed in the body.
+// Requires Elasticsearch 5.0 or newer.
+// Implements: https://www.elastic.co/guide/en/elasticsearch/reference/current/docs-delete-by-query.html
+func (es *Connection) DeleteByQuery(
+	index, docType string,
+	params map[string]string,
+	query interface{},
+) (int, *DeleteByQueryResults, error) {
+	status, resp, err := es.apiCall("POST", index, docType, "_delete_by_query", "", params, query)
+	if err != nil {
+		return status, nil, err
+	}
+	result, err := readDeleteByQueryResult(resp)
+	return status, result, err
+}
+
 // CreatePipeline create a new ingest pipeline with name id.
 // Implements: https://www.elastic.co/guide/en/elasticsearch/reference/current/put-pipeline-api.html
 func (es *Connection) CreatePipeline(
@@ -171,6 +377,89 @@ func (es *Connection) SearchURI(index string, docType string, params map[string]
 	return status, result, err
 }
 
+// Search executes a search request with the query DSL passed in the body.
+// Aggregation results are made available by name in the results Aggs.
+// Implements: https://www.elastic.co/guide/en/elasticsearch/reference/current/search-request-body.html
+func (es *Connection) Search(
+	index, docType string,
+	params map[string]string,
+	body interface{},
+) (int, *SearchResults, error) {
+	status, resp, err := es.apiCall("POST", index, docType, "_search", "", params, body)
+	if err != nil {
+		return status, nil, err
+	}
+	result, err := readSearchResult(resp)
+	return status, result, err
+}
+
+// Mget fetches the documents with the given ids in a single request. The
+// documents are returned in the order of ids, with Found unset for missing
+// documents.
+// Implements: https://www.elastic.co/guide/en/elasticsearch/reference/current/docs-multi-get.html
+func (es *Connection) Mget(
+	index, docType string,
+	params map[string]string,
+	ids []string,
+) (int, *MgetResults, error) {
+	if len(ids) == 0 {
+		return 0, &MgetResults{}, nil
+	}
+	body := map[string]interface{}{"ids": ids}
+	status, resp, err := es.apiCall("POST", index, docType, "_mget", "", params, body)
+	if err != nil {
+		return status, nil, err
+	}
+	result, err := readMgetResult(resp)
+	return status, result, err
+}
+
+// Msearch executes the searches in a single request. The results are returned
+// in the order of the searches, a failed search not failing the others.
+// Implements: https://www.elastic.co/guide/en/elasticsearch/reference/current/search-multi-search.html
+func (es *Connection) Msearch(
+	index, docType string,
+	params map[string]string,
+	searches []SearchRequest,
+) (int, *MsearchResults, error) {
+	if len(searches) == 0 {
+		return 0, &MsearchResults{}, nil
+	}
+	path, err := makePath(index, docType, "_msearch")
+	if err != nil {
+		return 0, nil, err
+	}
+
+	enc := es.encoder
+	enc.Reset()
+	for _, search := range searches {
+		header := map[string]interface{}{}
+		if search.Index != "" {
+			header["index"] = search.Index
+		}
+		if search.Type != "" {
+			header["type"] = search.Type
+		}
+		body := search.Body
+		if body == nil {
+			body = map[string]interface{}{}
+		}
+		if err := enc.Add(header, body); err != nil {
+			logp.Warn("Failed to json encode search (%v): %#v", err, body)
+			return 0, nil, ErrJSONEncodeFailed
+		}
+	}
+
+	url := makeURL(es.URL, path, "", params)
+	debugf("POST %s %v", url, searches)
+	status, resp, err := es.execRequest("POST", url, enc.Reader())
+	if err != nil {
+		return status, nil, err
+	}
+	result, err := readMsearchResult(resp)
+	return status, result, err
+}
+
 func (es *Connection) CountSearchURI(
 	index string, docType string,
 	params map[string]string,
@@ -183,6 +472,47 @@ func (es *Connection) CountSearchURI(
 	return status, result, err
 }
 
+// Count returns the number of documents matching the query, a query DSL clause
+// like {"term": {"fix.MsgType": "8"}}. All documents are counted if query is
+// nil.
+// Implements: https://www.elastic.co/guide/en/elasticsearch/reference/current/search-count.html
+func (es *Connection) Count(index, docType string, query interface{}) (int, error) {
+	var body interface{}
+	if query != nil {
+		body = map[string]interface{}{"query": query}
+	}
+	_, resp, err := es.apiCall("POST", index, docType, "_count", "", nil, body)
+	if err != nil {
+		return 0, err
+	}
+	result, err := readCountResult(resp)
+	if err != nil {
+		return 0, err
+	}
+	if result == nil {
+		return 0, fmt.Errorf("empty count response")
+	}
+	return result.Count, nil
+}
+
+// Exists checks if the document with the given type and id exists, using a
+// HEAD request not fetching the document. It returns false without error if
+// Elasticsearch answers with HTTP status 404.
+// Implements: https://www.elastic.co/guide/en/elasticsearch/reference/current/docs-get.html
+func (es *Connection) Exists(index, docType, id string) (bool, error) {
+	if docType == "" || id == "" {
+		return false, fmt.Errorf("document type and id required")
+	}
+	status, _, err := es.apiCall("HEAD", index, docType, id, "", nil, nil)
+	switch {
+	case status == http.StatusNotFound:
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	return true, nil
+}
+
 func (es *Connection) apiCall(
 	method, index, docType, id, pipeline string,
 	params map[string]string,
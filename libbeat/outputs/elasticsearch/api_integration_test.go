@@ -49,6 +49,27 @@ func TestIndex(t *testing.T) {
 		t.Errorf("Wrong number of search results: %d", result.Hits.Total)
 	}
 
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"match": map[string]interface{}{"user": "test"},
+		},
+		"aggs": map[string]interface{}{
+			"users": map[string]interface{}{
+				"terms": map[string]interface{}{"field": "user"},
+			},
+		},
+	}
+	_, result, err = client.Search(index, "test", nil, query)
+	if err != nil {
+		t.Errorf("Search() returns an error: %s", err)
+	}
+	if result.Hits.Total != 1 {
+		t.Errorf("Wrong number of search results: %d", result.Hits.Total)
+	}
+	if _, ok := result.Aggs["users"]; !ok {
+		t.Errorf("Missing aggregation in search results: %v", result.Aggs)
+	}
+
 	_, resp, err = client.Delete(index, "test", "1", nil)
 	if err != nil {
 		t.Errorf("Delete() returns error: %s", err)
@@ -118,3 +139,60 @@ func TestIngest(t *testing.T) {
 
 	assert.Equal(t, "test", doc.Field)
 }
+
+func TestDeleteByQuery(t *testing.T) {
+	type obj map[string]interface{}
+
+	if testing.Verbose() {
+		logp.LogInit(logp.LOG_DEBUG, "", false, true, []string{"elasticsearch"})
+	}
+
+	index := fmt.Sprintf("beats-test-delete-%d", os.Getpid())
+
+	client := GetTestingElasticsearch()
+	if strings.HasPrefix(client.Connection.version, "2.") {
+		t.Skip("Skipping tests as delete by query not available in 2.x releases")
+	}
+
+	params := map[string]string{"refresh": "true"}
+	for i, user := range []string{"test", "test", "other"} {
+		_, _, err := client.Index(index, "test", fmt.Sprint(i), params, obj{"user": user})
+		if err != nil {
+			t.Fatalf("Index() returns error: %s", err)
+		}
+	}
+
+	query := obj{"query": obj{"term": obj{"user": "test"}}}
+	_, result, err := client.DeleteByQuery(index, "test", params, query)
+	if err != nil {
+		t.Fatalf("DeleteByQuery() returns error: %s", err)
+	}
+	assert.Equal(t, 2, result.Deleted)
+
+	_, count, err := client.CountSearchURI(index, "test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, count.Count)
+
+	others, err := client.Count(index, "test", obj{"term": obj{"user": "other"}})
+	if err != nil {
+		t.Fatalf("Count() returns error: %s", err)
+	}
+	assert.Equal(t, 1, others)
+
+	exists, err := client.Exists(index, "test", "2")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = client.Exists(index, "test", "0")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	_, resp, err := client.DeleteIndex(index)
+	if err != nil {
+		t.Fatalf("DeleteIndex() returns error: %s", err)
+	}
+	if !resp.Acknowledged {
+		t.Errorf("DeleteIndex() fails: %s", resp)
+	}
+}
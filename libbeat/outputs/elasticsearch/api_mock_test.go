@@ -3,7 +3,9 @@
 package elasticsearch
 
 import (
+	"compress/gzip"
 	"fmt"
+	"io"
 	"os"
 	"time"
 
@@ -14,6 +16,7 @@ import (
 	"testing"
 
 	"github.com/elastic/beats/libbeat/logp"
+	"github.com/stretchr/testify/assert"
 )
 
 func ElasticsearchMock(code int, body []byte) *httptest.Server {
@@ -130,3 +133,313 @@ func TestOneHost503Resp(t *testing.T) {
 		t.Errorf("Should return <503 Service Unavailable> instead of %v", err)
 	}
 }
+
+func TestOneHost400Resp(t *testing.T) {
+
+	if testing.Verbose() {
+		logp.LogInit(logp.LOG_DEBUG, "", false, true, []string{"elasticsearch"})
+	}
+
+	index := fmt.Sprintf("packetbeat-unittest-%d", os.Getpid())
+	body := map[string]interface{}{
+		"user": "test",
+	}
+
+	tests := []struct {
+		resp   string
+		typ    string
+		reason string
+	}{
+		{
+			`{"error":{"root_cause":[],"type":"mapper_parsing_exception","reason":"failed to parse [user]"},"status":400}`,
+			"mapper_parsing_exception",
+			"failed to parse [user]",
+		},
+		{
+			`{"error":"MapperParsingException[failed to parse [user]]","status":400}`,
+			"",
+			"MapperParsingException[failed to parse [user]]",
+		},
+		{
+			`Bad request`,
+			"",
+			"",
+		},
+	}
+
+	for _, test := range tests {
+		server := ElasticsearchMock(http.StatusBadRequest, []byte(test.resp))
+		client := newTestClient(server.URL)
+
+		_, _, err := client.Index(index, "test", "1", nil, body)
+		server.Close()
+
+		esErr, ok := err.(*Error)
+		if !ok {
+			t.Errorf("Index() should return an Elasticsearch error instead of %v", err)
+			continue
+		}
+		assert.Equal(t, http.StatusBadRequest, esErr.StatusCode)
+		assert.Equal(t, test.typ, esErr.Type)
+		assert.Equal(t, test.reason, esErr.Reason)
+		assert.False(t, esErr.Retryable())
+		assert.Contains(t, err.Error(), "400 Bad Request")
+	}
+}
+
+func TestSearchWithBody(t *testing.T) {
+
+	if testing.Verbose() {
+		logp.LogInit(logp.LOG_DEBUG, "", false, true, []string{"elasticsearch"})
+	}
+
+	var method, path string
+	var query map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Write([]byte(`{"version":{"number":"5.0.0"}}`))
+			return
+		}
+
+		method, path = r.Method, r.URL.Path
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			body, _ = gzip.NewReader(r.Body)
+		}
+		json.NewDecoder(body).Decode(&query)
+		w.Write([]byte(`{"took":1,"hits":{"total":2,"hits":[]},
+			"aggregations":{"sessions":{"buckets":[{"key":"CLIENT","doc_count":2}]}}}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+
+	body := map[string]interface{}{
+		"query": map[string]interface{}{
+			"term": map[string]interface{}{"fix.MsgType": "8"},
+		},
+		"aggs": map[string]interface{}{
+			"sessions": map[string]interface{}{
+				"terms": map[string]interface{}{"field": "fix.SenderCompID"},
+			},
+		},
+	}
+	_, result, err := client.Search("packetbeat-*", "fix", nil, body)
+	if err != nil {
+		t.Fatalf("Search() returns error: %s", err)
+	}
+
+	if method != "POST" || path != "/packetbeat-*/fix/_search" {
+		t.Errorf("Unexpected request: %s %s", method, path)
+	}
+	if _, ok := query["aggs"]; !ok {
+		t.Errorf("Query body not sent: %v", query)
+	}
+	if result.Hits.Total != 2 {
+		t.Errorf("Wrong number of search results: %d", result.Hits.Total)
+	}
+	if _, ok := result.Aggs["sessions"]; !ok {
+		t.Errorf("Aggregation missing in results: %v", result.Aggs)
+	}
+}
+
+func TestCount(t *testing.T) {
+
+	if testing.Verbose() {
+		logp.LogInit(logp.LOG_DEBUG, "", false, true, []string{"elasticsearch"})
+	}
+
+	var method, path string
+	var query map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Write([]byte(`{"version":{"number":"5.0.0"}}`))
+			return
+		}
+
+		method, path = r.Method, r.URL.Path
+		query = nil
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			body, _ = gzip.NewReader(r.Body)
+		}
+		json.NewDecoder(body).Decode(&query)
+		w.Write([]byte(`{"count":42,"_shards":{"total":5,"successful":5,"failed":0}}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+
+	count, err := client.Count("packetbeat-*", "fix", map[string]interface{}{
+		"term": map[string]interface{}{"fix.MsgType": "8"},
+	})
+	if err != nil {
+		t.Fatalf("Count() returns error: %s", err)
+	}
+	assert.Equal(t, 42, count)
+	assert.Equal(t, "POST", method)
+	assert.Equal(t, "/packetbeat-*/fix/_count", path)
+	assert.Contains(t, query, "query")
+
+	count, err = client.Count("packetbeat-*", "", nil)
+	if err != nil {
+		t.Fatalf("Count() returns error: %s", err)
+	}
+	assert.Equal(t, 42, count)
+	assert.Equal(t, "/packetbeat-*/_count", path)
+	assert.Nil(t, query)
+}
+
+func TestExists(t *testing.T) {
+
+	if testing.Verbose() {
+		logp.LogInit(logp.LOG_DEBUG, "", false, true, []string{"elasticsearch"})
+	}
+
+	var method string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Write([]byte(`{"version":{"number":"5.0.0"}}`))
+			return
+		}
+
+		method = r.Method
+		switch r.URL.Path {
+		case "/packetbeat-2017.01.01/fix/found":
+			w.WriteHeader(200)
+		case "/packetbeat-2017.01.01/fix/missing":
+			w.WriteHeader(404)
+		default:
+			w.WriteHeader(500)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+
+	exists, err := client.Exists("packetbeat-2017.01.01", "fix", "found")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, "HEAD", method)
+
+	exists, err = client.Exists("packetbeat-2017.01.01", "fix", "missing")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = client.Exists("packetbeat-2017.01.01", "fix", "broken")
+	assert.Error(t, err)
+
+	_, err = client.Exists("packetbeat-2017.01.01", "", "found")
+	assert.Error(t, err)
+}
+
+func TestMget(t *testing.T) {
+
+	if testing.Verbose() {
+		logp.LogInit(logp.LOG_DEBUG, "", false, true, []string{"elasticsearch"})
+	}
+
+	var method, path string
+	var request struct {
+		IDs []string `json:"ids"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Write([]byte(`{"version":{"number":"5.0.0"}}`))
+			return
+		}
+
+		method, path = r.Method, r.URL.Path
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			body, _ = gzip.NewReader(r.Body)
+		}
+		json.NewDecoder(body).Decode(&request)
+		w.Write([]byte(`{"docs":[
+			{"_index":"packetbeat-2017.01.01","_type":"fix","_id":"order-1","found":true,"_source":{"fix":{"Symbol":"VOD.L"}}},
+			{"_index":"packetbeat-2017.01.01","_type":"fix","_id":"order-2","found":false}]}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+
+	_, result, err := client.Mget("packetbeat-2017.01.01", "fix", nil, []string{"order-1", "order-2"})
+	if err != nil {
+		t.Fatalf("Mget() returns error: %s", err)
+	}
+	assert.Equal(t, "POST", method)
+	assert.Equal(t, "/packetbeat-2017.01.01/fix/_mget", path)
+	assert.Equal(t, []string{"order-1", "order-2"}, request.IDs)
+	if assert.Len(t, result.Docs, 2) {
+		assert.True(t, result.Docs[0].Found)
+		assert.JSONEq(t, `{"fix":{"Symbol":"VOD.L"}}`, string(result.Docs[0].Source))
+		assert.Equal(t, "order-2", result.Docs[1].ID)
+		assert.False(t, result.Docs[1].Found)
+	}
+
+	_, result, err = client.Mget("packetbeat-2017.01.01", "fix", nil, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, result.Docs)
+}
+
+func TestMsearch(t *testing.T) {
+
+	if testing.Verbose() {
+		logp.LogInit(logp.LOG_DEBUG, "", false, true, []string{"elasticsearch"})
+	}
+
+	var path string
+	var lines []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Write([]byte(`{"version":{"number":"5.0.0"}}`))
+			return
+		}
+
+		path = r.URL.Path
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			body, _ = gzip.NewReader(r.Body)
+		}
+		dec := json.NewDecoder(body)
+		for {
+			var line map[string]interface{}
+			if err := dec.Decode(&line); err != nil {
+				break
+			}
+			lines = append(lines, line)
+		}
+		w.Write([]byte(`{"took":3,"responses":[
+			{"took":1,"hits":{"total":1,"hits":[{"_id":"order-1"}]},"status":200},
+			{"error":{"type":"index_not_found_exception","reason":"no such index"},"status":404}]}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"term": map[string]interface{}{"fix.ClOrdID": "order-1"},
+		},
+	}
+	_, result, err := client.Msearch("packetbeat-*", "", nil, []SearchRequest{
+		{Type: "fix", Body: query},
+		{Index: "missing"},
+	})
+	if err != nil {
+		t.Fatalf("Msearch() returns error: %s", err)
+	}
+	assert.Equal(t, "/packetbeat-*/_msearch", path)
+	assert.Equal(t, []map[string]interface{}{
+		{"type": "fix"}, query,
+		{"index": "missing"}, {},
+	}, lines)
+
+	if assert.Len(t, result.Responses, 2) {
+		assert.Equal(t, 1, result.Responses[0].Hits.Total)
+		assert.Len(t, result.Responses[0].Hits.Hits, 1)
+		assert.Nil(t, result.Responses[0].Error)
+		assert.Equal(t, 404, result.Responses[1].Status)
+		assert.Contains(t, string(result.Responses[1].Error), "index_not_found_exception")
+	}
+}
@@ -153,6 +153,22 @@ func TestReadSearchResult(t *testing.T) {
 	assert.Equal(t, resultsObject.Aggs, results.Aggs)
 }
 
+func TestReadSearchResult_totalObject(t *testing.T) {
+	json := []byte(`{
+		"took": 3,
+		"hits": {
+			"total": {"value": 42, "relation": "eq"},
+			"hits": [{"_id": "1", "_source": {}}]
+		}
+	}`)
+
+	results, err := readSearchResult(json)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 42, results.Hits.Total)
+	assert.Len(t, results.Hits.Hits, 1)
+}
+
 func TestReadSearchResult_empty(t *testing.T) {
 	results, err := readSearchResult(nil)
 	assert.Nil(t, results)
@@ -169,6 +185,31 @@ func TestReadSearchResult_invalid(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestReadDeleteByQueryResult(t *testing.T) {
+	json := []byte(`{
+		"took" : 147,
+		"timed_out": false,
+		"total": 120,
+		"deleted": 119,
+		"failures" : [{"id": "1"}]
+	}`)
+
+	results, err := readDeleteByQueryResult(json)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 147, results.Took)
+	assert.False(t, results.TimedOut)
+	assert.Equal(t, 120, results.Total)
+	assert.Equal(t, 119, results.Deleted)
+	assert.Len(t, results.Failures, 1)
+}
+
+func TestReadDeleteByQueryResult_empty(t *testing.T) {
+	results, err := readDeleteByQueryResult(nil)
+	assert.Nil(t, results)
+	assert.Nil(t, err)
+}
+
 func newTestClient(url string) *Client {
 	return newTestClientAuth(url, "", "")
 }
@@ -2,6 +2,7 @@ package elasticsearch
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"expvar"
@@ -10,10 +11,14 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/common/aws"
 	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/monitoring"
 	"github.com/elastic/beats/libbeat/outputs"
 	"github.com/elastic/beats/libbeat/outputs/mode"
 	"github.com/elastic/beats/libbeat/outputs/outil"
@@ -26,6 +31,7 @@ type Client struct {
 
 	index    outil.Selector
 	pipeline *outil.Selector
+	docMeta  DocMeta
 	params   map[string]string
 
 	// buffered bulk requests
@@ -34,21 +40,58 @@ type Client struct {
 	// buffered json response reader
 	json jsonReader
 
+	// events rejected by Elasticsearch, kept if deadLetter is set
+	deadLetter  *DeadLetterQueue
+	deadLetters []common.MapStr
+
 	// additional configs
+	apiKey           string
+	bearerToken      string
 	compressionLevel int
 	proxyURL         *url.URL
+	proxyLocal       bool
+	noProxy          []string
+	connectTimeout   time.Duration
+	keepAlive        time.Duration
+	idleConnTimeout  time.Duration
+	maxIdleConns     int
 }
 
 type ClientSettings struct {
 	URL                string
 	Proxy              *url.URL
+	ProxyLocal         bool     // resolve names locally with a SOCKS5 proxy
+	NoProxy            []string // hosts connected to without proxy
 	TLS                *transport.TLSConfig
 	Username, Password string
+	APIKey             string // id:api_key, or base64 encoded
+	BearerToken        string
+	Signer             *aws.Signer      // signs requests with AWS SigV4 if set
+	DeadLetter         *DeadLetterQueue // stores events rejected if set
 	Parameters         map[string]string
 	Index              outil.Selector
 	Pipeline           *outil.Selector
+	DocMeta            DocMeta
 	Timeout            time.Duration
 	CompressionLevel   int
+
+	// HTTP connection settings. The Timeout applies if ConnectTimeout is 0.
+	// TCP keep-alives are disabled if KeepAlive is 0, idle connections are
+	// kept open until reused if IdleConnTimeout is 0.
+	ConnectTimeout  time.Duration
+	KeepAlive       time.Duration
+	IdleConnTimeout time.Duration
+	MaxIdleConns    int
+}
+
+// DocMeta selects the per document metadata of the indexing operations. Nil
+// selectors and empty selected values are not set.
+type DocMeta struct {
+	ID          *outil.Selector
+	Routing     *outil.Selector
+	Parent      *outil.Selector
+	Version     *outil.Selector
+	VersionType string // only set together with a version
 }
 
 type connectCallback func(client *Client) error
@@ -58,6 +101,12 @@ type Connection struct {
 	Username string
 	Password string
 
+	// Authorization header value for API key or bearer token authentication
+	authorization string
+
+	// signer of the requests to Amazon OpenSearch Service domains
+	signer *aws.Signer
+
 	http              *http.Client
 	onConnectCallback func() error
 
@@ -75,8 +124,20 @@ var (
 	statWriteBytes  = expvar.NewInt("libbeat.es.publish.write_bytes")
 	statReadErrors  = expvar.NewInt("libbeat.es.publish.read_errors")
 	statWriteErrors = expvar.NewInt("libbeat.es.publish.write_errors")
+
+	// duration of the bulk requests
+	publishLatency = monitoring.NewHistogram("libbeat.es.publish.latency_seconds",
+		monitoring.LatencyBuckets)
+
+	// 1 per host connected to, 0 for hosts failed or closed
+	connections = expvar.NewMap("libbeat.es.connections")
 )
 
+func init() {
+	monitoring.SetGauge("libbeat.es.connections")
+	monitoring.SetLabels("libbeat.es.connections", "host")
+}
+
 var (
 	nameItems  = []byte("items")
 	nameStatus = []byte("status")
@@ -94,10 +155,6 @@ func NewClient(
 	s ClientSettings,
 	onConnectCallback connectCallback,
 ) (*Client, error) {
-	proxy := http.ProxyFromEnvironment
-	if s.Proxy != nil {
-		proxy = http.ProxyURL(s.Proxy)
-	}
 
 	pipeline := s.Pipeline
 	if pipeline != nil && pipeline.IsEmpty() {
@@ -119,11 +176,24 @@ func NewClient(
 
 	logp.Info("Elasticsearch url: %s", s.URL)
 
-	// TODO: add socks5 proxy support
 	var dialer, tlsDialer transport.Dialer
 
-	dialer = transport.NetDialer(s.Timeout)
-	tlsDialer, err = transport.TLSDialer(dialer, s.TLS, s.Timeout)
+	connectTimeout := s.ConnectTimeout
+	if connectTimeout <= 0 {
+		connectTimeout = s.Timeout
+	}
+
+	// HTTP proxies are selected by the transport, SOCKS5 proxies by the dialer
+	proxy := proxyFunc(s.Proxy, s.NoProxy)
+	dialer = transport.KeepAliveDialer(connectTimeout, s.KeepAlive)
+	if isSocksProxy(s.Proxy) {
+		proxy = nil
+		dialer, err = socksDialer(s.Proxy, s.ProxyLocal, s.NoProxy, dialer)
+		if err != nil {
+			return nil, err
+		}
+	}
+	tlsDialer, err = transport.TLSDialer(dialer, s.TLS, connectTimeout)
 	if err != nil {
 		return nil, err
 	}
@@ -156,14 +226,18 @@ func NewClient(
 
 	client := &Client{
 		Connection: Connection{
-			URL:      s.URL,
-			Username: s.Username,
-			Password: s.Password,
+			URL:           s.URL,
+			Username:      s.Username,
+			Password:      s.Password,
+			authorization: authorizationHeader(s.APIKey, s.BearerToken),
+			signer:        s.Signer,
 			http: &http.Client{
 				Transport: &http.Transport{
-					Dial:    dialer.Dial,
-					DialTLS: tlsDialer.Dial,
-					Proxy:   proxy,
+					Dial:                dialer.Dial,
+					DialTLS:             tlsDialer.Dial,
+					Proxy:               proxy,
+					IdleConnTimeout:     s.IdleConnTimeout,
+					MaxIdleConnsPerHost: s.MaxIdleConns,
 				},
 				Timeout: s.Timeout,
 			},
@@ -172,12 +246,23 @@ func NewClient(
 		tlsConfig: s.TLS,
 		index:     s.Index,
 		pipeline:  pipeline,
+		docMeta:   s.DocMeta,
 		params:    params,
 
 		bulkRequ: bulkRequ,
 
+		deadLetter: s.DeadLetter,
+
+		apiKey:           s.APIKey,
+		bearerToken:      s.BearerToken,
 		compressionLevel: compression,
 		proxyURL:         s.Proxy,
+		proxyLocal:       s.ProxyLocal,
+		noProxy:          s.NoProxy,
+		connectTimeout:   s.ConnectTimeout,
+		keepAlive:        s.KeepAlive,
+		idleConnTimeout:  s.IdleConnTimeout,
+		maxIdleConns:     s.MaxIdleConns,
 	}
 
 	client.Connection.onConnectCallback = func() error {
@@ -201,13 +286,24 @@ func (client *Client) Clone() *Client {
 			URL:              client.URL,
 			Index:            client.index,
 			Pipeline:         client.pipeline,
+			DocMeta:          client.docMeta,
 			Proxy:            client.proxyURL,
+			ProxyLocal:       client.proxyLocal,
+			NoProxy:          client.noProxy,
 			TLS:              client.tlsConfig,
 			Username:         client.Username,
 			Password:         client.Password,
+			APIKey:           client.apiKey,
+			BearerToken:      client.bearerToken,
+			Signer:           client.signer,
+			DeadLetter:       client.deadLetter,
 			Parameters:       nil, // XXX: do not pass params?
 			Timeout:          client.http.Timeout,
 			CompressionLevel: client.compressionLevel,
+			ConnectTimeout:   client.connectTimeout,
+			KeepAlive:        client.keepAlive,
+			IdleConnTimeout:  client.idleConnTimeout,
+			MaxIdleConns:     client.maxIdleConns,
 		},
 		nil, // XXX: do not pass connection callback?
 	)
@@ -232,7 +328,7 @@ func (client *Client) PublishEvents(
 
 	// encode events into bulk request buffer, dropping failed elements from
 	// events slice
-	data = bulkEncodePublishRequest(body, client.index, client.pipeline, data)
+	data = bulkEncodePublishRequest(body, client.index, client.pipeline, &client.docMeta, data)
 	if len(data) == 0 {
 		return nil, nil
 	}
@@ -240,7 +336,36 @@ func (client *Client) PublishEvents(
 	requ := client.bulkRequ
 	requ.Reset(body)
 	status, result, sendErr := client.sendBulkRequest(requ)
+	publishLatency.ObserveDuration(time.Since(begin))
+	if status == http.StatusTooManyRequests {
+		// Elasticsearch is throttling requests: keep the connection and back
+		// off instead of handling the node as dead
+		logp.Warn("Bulk request throttled by Elasticsearch: %s", sendErr)
+		eventsNotAcked.Add(int64(len(data)))
+		return data, mode.ErrTempBulkFailure
+	}
 	if sendErr != nil {
+		if status == http.StatusRequestEntityTooLarge && len(data) > 1 {
+			// the bulk request is too large => retry with half the events
+			debugf("Bulk request too large, splitting %v events", len(data))
+			return client.publishSplit(data)
+		}
+		if isRejected(status) {
+			// the events are rejected by Elasticsearch => don't retry
+			logp.Err("Dropping %v events rejected by Elasticsearch: %s", len(data), sendErr)
+			eventsNotAcked.Add(int64(len(data)))
+			if client.deadLetter != nil && status == http.StatusBadRequest {
+				reason := errorReason(sendErr)
+				for _, datum := range data {
+					client.addDeadLetter(datum, status, reason)
+				}
+				client.publishDeadLetters()
+			}
+			return nil, nil
+		}
+
+		// connection, authentication and authorization failures are retried
+		// after backing off
 		logp.Err("Failed to perform any bulk index operations: %s", sendErr)
 		return data, sendErr
 	}
@@ -255,7 +380,8 @@ func (client *Client) PublishEvents(
 		failedEvents = data
 	} else {
 		client.json.init(result.raw)
-		failedEvents = bulkCollectPublishFails(&client.json, data)
+		failedEvents = bulkCollectPublishFails(&client.json, data, client.onRejected)
+		client.publishDeadLetters()
 	}
 
 	ackedEvents.Add(int64(len(data) - len(failedEvents)))
@@ -270,24 +396,32 @@ func (client *Client) PublishEvents(
 	return nil, nil
 }
 
+// publishSplit publishes the events with two bulk requests of half the
+// events each. The events of the second half are not sent if publishing the
+// first half fails.
+func (client *Client) publishSplit(data []outputs.Data) ([]outputs.Data, error) {
+	half := len(data) / 2
+	first, second := data[:half:half], data[half:]
+
+	failed, err := client.PublishEvents(first)
+	if err != nil {
+		return append(failed, second...), err
+	}
+	return client.PublishEvents(second)
+}
+
 // fillBulkRequest encodes all bulk requests and returns slice of events
 // successfully added to bulk request.
 func bulkEncodePublishRequest(
 	body bulkWriter,
 	index outil.Selector,
 	pipeline *outil.Selector,
+	docMeta *DocMeta,
 	data []outputs.Data,
 ) []outputs.Data {
-	var mkMeta func(outil.Selector, *outil.Selector, outputs.Data) interface{}
-
-	mkMeta = eventBulkMeta
-	if pipeline != nil {
-		mkMeta = eventIngestBulkMeta
-	}
-
 	okEvents := data[:0]
 	for _, datum := range data {
-		meta := mkMeta(index, pipeline, datum)
+		meta := eventBulkMeta(index, pipeline, docMeta, datum)
 		if err := body.Add(meta, datum.Event); err != nil {
 			logp.Err("Failed to encode event: %s", err)
 			continue
@@ -299,54 +433,92 @@ func bulkEncodePublishRequest(
 
 func eventBulkMeta(
 	index outil.Selector,
-	_ *outil.Selector,
+	pipelineSel *outil.Selector,
+	docMeta *DocMeta,
 	data outputs.Data,
 ) interface{} {
 	type bulkMetaIndex struct {
-		Index   string `json:"_index"`
-		DocType string `json:"_type"`
+		Index       string `json:"_index"`
+		DocType     string `json:"_type"`
+		ID          string `json:"_id,omitempty"`
+		Pipeline    string `json:"pipeline,omitempty"`
+		Routing     string `json:"_routing,omitempty"`
+		Parent      string `json:"_parent,omitempty"`
+		Version     *int64 `json:"_version,omitempty"`
+		VersionType string `json:"_version_type,omitempty"`
 	}
 	type bulkMeta struct {
 		Index bulkMetaIndex `json:"index"`
 	}
 
 	event := data.Event
-	meta := bulkMeta{
-		Index: bulkMetaIndex{
-			Index:   getIndex(event, index),
-			DocType: event["type"].(string),
-		},
+	meta := bulkMetaIndex{
+		Index:   getIndex(event, index),
+		DocType: event["type"].(string),
+	}
+	if pipelineSel != nil {
+		meta.Pipeline, _ = pipelineSel.Select(event)
+	}
+	if docMeta != nil {
+		meta.ID = selectMeta(docMeta.ID, event)
+		meta.Routing = selectMeta(docMeta.Routing, event)
+		meta.Parent = selectMeta(docMeta.Parent, event)
+		if version, ok := docMeta.version(event); ok {
+			meta.Version = &version
+			meta.VersionType = docMeta.VersionType
+		}
 	}
-	return meta
+	return bulkMeta{Index: meta}
 }
 
-func eventIngestBulkMeta(
-	index outil.Selector,
-	pipelineSel *outil.Selector,
-	data outputs.Data,
-) interface{} {
-	type bulkMetaIndex struct {
-		Index    string `json:"_index"`
-		DocType  string `json:"_type"`
-		Pipeline string `json:"pipeline"`
+// params returns the query parameters of indexing event, adding the
+// document metadata to params.
+func (m *DocMeta) params(event common.MapStr, params map[string]string) map[string]string {
+	extra := map[string]string{}
+	if routing := selectMeta(m.Routing, event); routing != "" {
+		extra["routing"] = routing
 	}
-	type bulkMeta struct {
-		Index bulkMetaIndex `json:"index"`
+	if parent := selectMeta(m.Parent, event); parent != "" {
+		extra["parent"] = parent
+	}
+	if version, ok := m.version(event); ok {
+		extra["version"] = strconv.FormatInt(version, 10)
+		if m.VersionType != "" {
+			extra["version_type"] = m.VersionType
+		}
+	}
+	if len(extra) == 0 {
+		return params
 	}
 
-	event := data.Event
-	pipeline, _ := pipelineSel.Select(event)
-	if pipeline == "" {
-		return eventBulkMeta(index, nil, data)
+	for k, v := range params {
+		extra[k] = v
 	}
+	return extra
+}
 
-	return bulkMeta{
-		Index: bulkMetaIndex{
-			Index:    getIndex(event, index),
-			Pipeline: pipeline,
-			DocType:  event["type"].(string),
-		},
+// version returns the document version selected for event, if the selected
+// value is a valid version number.
+func (m *DocMeta) version(event common.MapStr) (int64, bool) {
+	str := selectMeta(m.Version, event)
+	if str == "" {
+		return 0, false
+	}
+
+	version, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || version < 0 {
+		debugf("Ignore invalid document version: %v", str)
+		return 0, false
 	}
+	return version, true
+}
+
+func selectMeta(sel *outil.Selector, event common.MapStr) string {
+	if sel == nil {
+		return ""
+	}
+	value, _ := sel.Select(event)
+	return value
 }
 
 // getIndex returns the full index name
@@ -378,10 +550,11 @@ func getIndex(event common.MapStr, index outil.Selector) string {
 // bulkCollectPublishFails checks per item errors returning all events
 // to be tried again due to error code returned for that items. If indexing an
 // event failed due to some error in the event itself (e.g. does not respect mapping),
-// the event will be dropped.
+// the event will be dropped, after passing it to onRejected if not nil.
 func bulkCollectPublishFails(
 	reader *jsonReader,
 	data []outputs.Data,
+	onRejected func(datum outputs.Data, status int, msg []byte),
 ) []outputs.Data {
 	if err := reader.expectDict(); err != nil {
 		logp.Err("Failed to parse bulk respose: expected JSON object")
@@ -430,6 +603,9 @@ func bulkCollectPublishFails(
 		if status < 500 && status != 429 {
 			// hard failure, don't collect
 			logp.Warn("Can not index event (status=%v): %s", status, msg)
+			if onRejected != nil {
+				onRejected(data[i], status, msg)
+			}
 			continue
 		}
 
@@ -440,6 +616,14 @@ func bulkCollectPublishFails(
 	return failed
 }
 
+// onRejected queues the dead letters of events rejected with a mapping or
+// parsing error, if the dead letter queue is enabled.
+func (client *Client) onRejected(datum outputs.Data, status int, msg []byte) {
+	if client.deadLetter != nil && status == http.StatusBadRequest {
+		client.addDeadLetter(datum, status, itemErrorReason(msg))
+	}
+}
+
 func itemStatus(reader *jsonReader) (int, []byte, error) {
 	// skip outer dictionary
 	if err := reader.expectDict(); err != nil {
@@ -540,12 +724,15 @@ func (client *Client) PublishEvent(data outputs.Data) error {
 		debugf("select pipeline: %v", pipeline)
 	}
 
+	params := client.docMeta.params(event, client.params)
+	id := selectMeta(client.docMeta.ID, event)
+
 	var status int
 	var err error
 	if pipeline == "" {
-		status, _, err = client.Index(index, typ, "", client.params, event)
+		status, _, err = client.Index(index, typ, id, params, event)
 	} else {
-		status, _, err = client.Ingest(index, typ, pipeline, "", client.params, event)
+		status, _, err = client.Ingest(index, typ, pipeline, id, params, event)
 	}
 
 	// check indexing error
@@ -559,11 +746,17 @@ func (client *Client) PublishEvent(data outputs.Data) error {
 	switch {
 	case status == 0: // event was not send yet
 		return nil
-	case status >= 500 || status == 429: // server error, retry
-		return err
-	case status >= 300 && status < 500:
+	case status == http.StatusTooManyRequests: // throttled, back off and retry
+		return mode.ErrTempBulkFailure
+	case isRejected(status):
 		// won't be able to index event in Elasticsearch => don't retry
+		if client.deadLetter != nil && status == http.StatusBadRequest {
+			client.addDeadLetter(data, status, errorReason(err))
+			client.publishDeadLetters()
+		}
 		return nil
+	case status >= 300: // server error, retry
+		return err
 	}
 
 	return nil
@@ -609,6 +802,8 @@ func (client *Client) CheckTemplate(templateName string) bool {
 }
 
 func (conn *Connection) Connect(timeout time.Duration) error {
+	connections.Set(conn.URL, connectionState(0))
+
 	var err error
 	conn.version, err = conn.Ping(timeout)
 	if err != nil {
@@ -619,9 +814,16 @@ func (conn *Connection) Connect(timeout time.Duration) error {
 	if err != nil {
 		return fmt.Errorf("Connection marked as failed because the onConnect callback failed: %v", err)
 	}
+	connections.Set(conn.URL, connectionState(1))
 	return nil
 }
 
+func connectionState(v int64) *expvar.Int {
+	state := new(expvar.Int)
+	state.Set(v)
+	return state
+}
+
 // Ping sends a GET request to the Elasticsearch
 func (conn *Connection) Ping(timeout time.Duration) (string, error) {
 	debugf("ES Ping(url=%v, timeout=%v)", conn.URL, timeout)
@@ -654,6 +856,7 @@ func (conn *Connection) Ping(timeout time.Duration) (string, error) {
 }
 
 func (conn *Connection) Close() error {
+	connections.Set(conn.URL, connectionState(0))
 	return nil
 }
 
@@ -683,7 +886,7 @@ func (conn *Connection) execRequest(
 ) (int, []byte, error) {
 	req, err := http.NewRequest(method, url, body)
 	if err != nil {
-		logp.Warn("Failed to create request", err)
+		logp.Warn("Failed to create request: %v", err)
 		return 0, nil, err
 	}
 	if body != nil {
@@ -692,11 +895,36 @@ func (conn *Connection) execRequest(
 	return conn.execHTTPRequest(req)
 }
 
+// authorizationHeader returns the Authorization header value authenticating
+// with an API key or bearer token, or "" if neither is set. API keys given as
+// id and key separated by a colon are base64 encoded, as required by
+// Elasticsearch.
+func authorizationHeader(apiKey, bearerToken string) string {
+	switch {
+	case apiKey != "":
+		if strings.Contains(apiKey, ":") {
+			apiKey = base64.StdEncoding.EncodeToString([]byte(apiKey))
+		}
+		return "ApiKey " + apiKey
+	case bearerToken != "":
+		return "Bearer " + bearerToken
+	}
+	return ""
+}
+
 func (conn *Connection) execHTTPRequest(req *http.Request) (int, []byte, error) {
 	req.Header.Add("Accept", "application/json")
-	if conn.Username != "" || conn.Password != "" {
+	if conn.authorization != "" {
+		req.Header.Set("Authorization", conn.authorization)
+	} else if conn.Username != "" || conn.Password != "" {
 		req.SetBasicAuth(conn.Username, conn.Password)
 	}
+	if conn.signer != nil {
+		if err := conn.signRequest(req); err != nil {
+			logp.Warn("Failed to sign request: %v", err)
+			return 0, nil, err
+		}
+	}
 
 	resp, err := conn.http.Do(req)
 	if err != nil {
@@ -706,7 +934,7 @@ func (conn *Connection) execHTTPRequest(req *http.Request) (int, []byte, error)
 
 	status := resp.StatusCode
 	if status >= 300 {
-		return status, nil, fmt.Errorf("%v", resp.Status)
+		return status, nil, readError(resp)
 	}
 
 	obj, err := ioutil.ReadAll(resp.Body)
@@ -716,6 +944,23 @@ func (conn *Connection) execHTTPRequest(req *http.Request) (int, []byte, error)
 	return status, obj, nil
 }
 
+// signRequest signs the request with AWS SigV4. The body is read to be
+// hashed, and replaced by a reader of the bytes read.
+func (conn *Connection) signRequest(req *http.Request) error {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+	}
+	return conn.signer.Sign(req, body)
+}
+
 func closing(c io.Closer) {
 	err := c.Close()
 	if err != nil {
@@ -3,15 +3,26 @@
 package elasticsearch
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/common/aws"
 	"github.com/elastic/beats/libbeat/common/fmtstr"
 	"github.com/elastic/beats/libbeat/logp"
 	"github.com/elastic/beats/libbeat/outputs"
+	"github.com/elastic/beats/libbeat/outputs/mode"
 	"github.com/elastic/beats/libbeat/outputs/outil"
 	"github.com/stretchr/testify/assert"
 )
@@ -79,7 +90,7 @@ func TestCollectPublishFailsNone(t *testing.T) {
 	}
 
 	reader := newJSONReader(response)
-	res := bulkCollectPublishFails(reader, events)
+	res := bulkCollectPublishFails(reader, events, nil)
 	assert.Equal(t, 0, len(res))
 }
 
@@ -97,7 +108,7 @@ func TestCollectPublishFailMiddle(t *testing.T) {
 	events := []outputs.Data{event, eventFail, event}
 
 	reader := newJSONReader(response)
-	res := bulkCollectPublishFails(reader, events)
+	res := bulkCollectPublishFails(reader, events, nil)
 	assert.Equal(t, 1, len(res))
 	if len(res) == 1 {
 		assert.Equal(t, eventFail, res[0])
@@ -117,7 +128,7 @@ func TestCollectPublishFailAll(t *testing.T) {
 	events := []outputs.Data{event, event, event}
 
 	reader := newJSONReader(response)
-	res := bulkCollectPublishFails(reader, events)
+	res := bulkCollectPublishFails(reader, events, nil)
 	assert.Equal(t, 3, len(res))
 	assert.Equal(t, events, res)
 }
@@ -160,7 +171,7 @@ func TestCollectPipelinePublishFail(t *testing.T) {
 	events := []outputs.Data{event}
 
 	reader := newJSONReader(response)
-	res := bulkCollectPublishFails(reader, events)
+	res := bulkCollectPublishFails(reader, events, nil)
 	assert.Equal(t, 1, len(res))
 	assert.Equal(t, events, res)
 }
@@ -205,6 +216,51 @@ func TestGetIndexOverwrite(t *testing.T) {
 	assert.Equal(t, index, "dynamicindex-"+extension)
 }
 
+func TestEventIngestBulkMetaSelectsPipeline(t *testing.T) {
+	cfg, err := common.NewConfigFrom(map[string]interface{}{
+		"pipeline": "fix",
+		"pipelines": []map[string]interface{}{
+			{
+				"pipeline": "geoip",
+				"when.equals": map[string]interface{}{
+					"transport": "udp",
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline, err := outil.BuildSelectorFromConfig(cfg, outil.Settings{
+		Key:              "pipeline",
+		MultiKey:         "pipelines",
+		EnableSingleOnly: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := outil.MakeSelector(outil.ConstSelectorExpr("test"))
+
+	type ingestMeta struct {
+		Index struct {
+			Pipeline string `json:"pipeline"`
+		} `json:"index"`
+	}
+	selected := func(event common.MapStr) string {
+		event["@timestamp"] = common.Time(time.Now())
+		event["type"] = "fix"
+		meta := eventBulkMeta(index, &pipeline, nil, outputs.Data{Event: event})
+
+		var decoded ingestMeta
+		raw, _ := json.Marshal(meta)
+		json.Unmarshal(raw, &decoded)
+		return decoded.Index.Pipeline
+	}
+
+	assert.Equal(t, "fix", selected(common.MapStr{}))
+	assert.Equal(t, "geoip", selected(common.MapStr{"transport": "udp"}))
+}
+
 func BenchmarkCollectPublishFailsNone(b *testing.B) {
 	response := []byte(`
     { "items": [
@@ -220,7 +276,7 @@ func BenchmarkCollectPublishFailsNone(b *testing.B) {
 	reader := newJSONReader(nil)
 	for i := 0; i < b.N; i++ {
 		reader.init(response)
-		res := bulkCollectPublishFails(reader, events)
+		res := bulkCollectPublishFails(reader, events, nil)
 		if len(res) != 0 {
 			b.Fail()
 		}
@@ -243,7 +299,7 @@ func BenchmarkCollectPublishFailMiddle(b *testing.B) {
 	reader := newJSONReader(nil)
 	for i := 0; i < b.N; i++ {
 		reader.init(response)
-		res := bulkCollectPublishFails(reader, events)
+		res := bulkCollectPublishFails(reader, events, nil)
 		if len(res) != 1 {
 			b.Fail()
 		}
@@ -265,9 +321,313 @@ func BenchmarkCollectPublishFailAll(b *testing.B) {
 	reader := newJSONReader(nil)
 	for i := 0; i < b.N; i++ {
 		reader.init(response)
-		res := bulkCollectPublishFails(reader, events)
+		res := bulkCollectPublishFails(reader, events, nil)
 		if len(res) != 3 {
 			b.Fail()
 		}
 	}
 }
+
+func TestClientConnectionSettings(t *testing.T) {
+	client, err := NewClient(ClientSettings{
+		URL:             "http://localhost:9200",
+		Timeout:         90 * time.Second,
+		IdleConnTimeout: 30 * time.Second,
+		MaxIdleConns:    4,
+		KeepAlive:       20 * time.Second,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport := client.http.Transport.(*http.Transport)
+	assert.Equal(t, 90*time.Second, client.http.Timeout)
+	assert.Equal(t, 30*time.Second, transport.IdleConnTimeout)
+	assert.Equal(t, 4, transport.MaxIdleConnsPerHost)
+
+	clone := client.Clone()
+	assert.Equal(t, 30*time.Second, clone.http.Transport.(*http.Transport).IdleConnTimeout)
+	assert.Equal(t, 20*time.Second, clone.keepAlive)
+}
+
+func TestClientAuthorization(t *testing.T) {
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("Authorization")
+		w.Write([]byte(`{"version":{"number":"5.0.0"}}`))
+	}))
+	defer server.Close()
+
+	for _, test := range []struct {
+		settings ClientSettings
+		expected string
+	}{
+		{ClientSettings{}, ""},
+		{ClientSettings{Username: "elastic", Password: "changeme"}, "Basic ZWxhc3RpYzpjaGFuZ2VtZQ=="},
+		{ClientSettings{APIKey: "VuaCfGcBCdbkQm-e5aOx:ui2lp2axTNmsyakw9tvNnw"},
+			"ApiKey VnVhQ2ZHY0JDZGJrUW0tZTVhT3g6dWkybHAyYXhUTm1zeWFrdzl0dk5udw=="},
+		{ClientSettings{APIKey: "VnVhQ2ZHY0JDZGJrUW0tZTVhT3g6dWkybHAyYXhUTm1zeWFrdzl0dk5udw=="},
+			"ApiKey VnVhQ2ZHY0JDZGJrUW0tZTVhT3g6dWkybHAyYXhUTm1zeWFrdzl0dk5udw=="},
+		{ClientSettings{BearerToken: "dGhpcyBpcyBub3QgYSByZWFsIHRva2Vu"},
+			"Bearer dGhpcyBpcyBub3QgYSByZWFsIHRva2Vu"},
+	} {
+		test.settings.URL = server.URL
+		client, err := NewClient(test.settings, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		header = ""
+		_, err = client.Ping(time.Second)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, header)
+
+		// clones authenticate the same way
+		header = ""
+		_, err = client.Clone().Ping(time.Second)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, header)
+	}
+}
+
+func TestConfigSingleAuthMethod(t *testing.T) {
+	for _, settings := range []map[string]interface{}{
+		{"username": "elastic", "api_key": "id:key"},
+		{"api_key": "id:key", "bearer_token": "token"},
+		{"password": "changeme", "bearer_token": "token"},
+		{"api_key": "id:key", "aws.region": "us-east-1"},
+	} {
+		cfg, err := common.NewConfigFrom(settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config := defaultConfig
+		assert.Error(t, cfg.Unpack(&config), "%v", settings)
+	}
+}
+
+func TestClientSignRequests(t *testing.T) {
+	var authorization []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		hash := sha256.Sum256(body)
+		if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(hash[:]) {
+			http.Error(w, "payload hash mismatch", http.StatusForbidden)
+			return
+		}
+		authorization = append(authorization, r.Header.Get("Authorization"))
+		if r.URL.Path == "/_bulk" {
+			w.Write([]byte(`{"items":[{"index":{"status":201}}]}`))
+			return
+		}
+		w.Write([]byte(`{"version":{"number":"5.0.0"}}`))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(ClientSettings{
+		URL:              server.URL,
+		Index:            outil.MakeSelector(outil.ConstSelectorExpr("test")),
+		CompressionLevel: 3,
+		Signer: aws.NewSigner(&aws.Config{
+			Region:          "us-east-1",
+			AccessKeyID:     "AKIDEXAMPLE",
+			SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		}),
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Ping(time.Second)
+	assert.NoError(t, err)
+
+	data := []outputs.Data{{Event: common.MapStr{
+		"@timestamp": common.Time(time.Now()),
+		"type":       "test",
+	}}}
+	failed, err := client.PublishEvents(data)
+	assert.NoError(t, err)
+	assert.Empty(t, failed)
+
+	if assert.Len(t, authorization, 2) {
+		for _, auth := range authorization {
+			assert.True(t, strings.HasPrefix(auth,
+				"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/"), auth)
+		}
+	}
+}
+
+func TestPublishEventsThrottled(t *testing.T) {
+	server := ElasticsearchMock(http.StatusTooManyRequests, nil)
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	data := []outputs.Data{
+		{Event: common.MapStr{
+			"@timestamp": common.Time(time.Now()),
+			"type":       "test",
+			"field":      1,
+		}},
+	}
+
+	failed, err := client.PublishEvents(data)
+	assert.Equal(t, mode.ErrTempBulkFailure, err)
+	assert.Equal(t, data, failed)
+
+	err = client.PublishEvent(data[0])
+	assert.Equal(t, mode.ErrTempBulkFailure, err)
+}
+
+func TestPublishEventsRejected(t *testing.T) {
+	resp := `{"error":{"type":"illegal_argument_exception","reason":"bad bulk"},"status":400}`
+	server := ElasticsearchMock(http.StatusBadRequest, []byte(resp))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	data := []outputs.Data{
+		{Event: common.MapStr{
+			"@timestamp": common.Time(time.Now()),
+			"type":       "test",
+			"field":      1,
+		}},
+	}
+
+	// non-retryable client errors drop the events
+	failed, err := client.PublishEvents(data)
+	assert.NoError(t, err)
+	assert.Empty(t, failed)
+
+	err = client.PublishEvent(data[0])
+	assert.NoError(t, err)
+}
+
+func TestPublishEventsUnauthorized(t *testing.T) {
+	resp := `{"error":{"type":"security_exception","reason":"missing authentication token"},"status":401}`
+	server := ElasticsearchMock(http.StatusUnauthorized, []byte(resp))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	data := []outputs.Data{
+		{Event: common.MapStr{
+			"@timestamp": common.Time(time.Now()),
+			"type":       "test",
+			"field":      1,
+		}},
+	}
+
+	// authentication failures are connection failures, the events are kept
+	failed, err := client.PublishEvents(data)
+	assert.Error(t, err)
+	assert.Equal(t, data, failed)
+
+	err = client.PublishEvent(data[0])
+	assert.Error(t, err)
+}
+
+func TestPublishEventsSplitTooLarge(t *testing.T) {
+	var sizes []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Write([]byte(`{"version":{"number":"5.0.0"}}`))
+			return
+		}
+
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			var err error
+			if body, err = gzip.NewReader(r.Body); err != nil {
+				t.Fatal(err)
+			}
+		}
+		raw, _ := ioutil.ReadAll(body)
+
+		// accept at most 2 events (4 lines) per bulk request
+		lines := bytes.Count(raw, []byte("\n"))
+		sizes = append(sizes, lines/2)
+		if lines > 4 {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		items := strings.Repeat(`{"index":{"status":201}},`, lines/2)
+		fmt.Fprintf(w, `{"items":[%s]}`, strings.TrimSuffix(items, ","))
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	var data []outputs.Data
+	for i := 0; i < 5; i++ {
+		data = append(data, outputs.Data{Event: common.MapStr{
+			"@timestamp": common.Time(time.Now()),
+			"type":       "test",
+			"field":      i,
+		}})
+	}
+
+	failed, err := client.PublishEvents(data)
+	assert.NoError(t, err)
+	assert.Empty(t, failed)
+	assert.Equal(t, []int{5, 2, 3, 1, 2}, sizes)
+}
+
+func TestEventBulkMetaDocMeta(t *testing.T) {
+	cfg, err := common.NewConfigFrom(map[string]interface{}{
+		"document_id": "%{[fix.document_id]}",
+		"routing":     "%{[fix.session_key]}",
+		"version":     "%{[fix.MsgSeqNum]}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := buildMetaSelector(cfg, "document_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	routing, err := buildMetaSelector(cfg, "routing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := buildMetaSelector(cfg, "version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent, err := buildMetaSelector(cfg, "parent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, parent)
+
+	docMeta := &DocMeta{ID: id, Routing: routing, Version: version, VersionType: "external"}
+	index := outil.MakeSelector(outil.ConstSelectorExpr("test"))
+	encode := func(fix common.MapStr) string {
+		event := common.MapStr{
+			"@timestamp": common.Time(time.Now()),
+			"type":       "fix",
+			"fix":        fix,
+		}
+		raw, _ := json.Marshal(eventBulkMeta(index, nil, docMeta, outputs.Data{Event: event}))
+		return string(raw)
+	}
+
+	assert.Equal(t,
+		`{"index":{"_index":"test","_type":"fix","_routing":"CLIENT-BROKER","_version":12,"_version_type":"external"}}`,
+		encode(common.MapStr{"session_key": "CLIENT-BROKER", "MsgSeqNum": 12}))
+	assert.Equal(t,
+		`{"index":{"_index":"test","_type":"fix","_routing":"CLIENT-BROKER"}}`,
+		encode(common.MapStr{"session_key": "CLIENT-BROKER", "MsgSeqNum": "x"}))
+	assert.Equal(t,
+		`{"index":{"_index":"test","_type":"fix"}}`,
+		encode(common.MapStr{}))
+	assert.Equal(t,
+		`{"index":{"_index":"test","_type":"fix","_id":"4f1c0e","_routing":"CLIENT-BROKER"}}`,
+		encode(common.MapStr{"session_key": "CLIENT-BROKER", "document_id": "4f1c0e"}))
+
+	params := docMeta.params(common.MapStr{
+		"fix": common.MapStr{"session_key": "CLIENT-BROKER", "MsgSeqNum": 12},
+	}, map[string]string{"refresh": "true"})
+	assert.Equal(t, map[string]string{
+		"refresh":      "true",
+		"routing":      "CLIENT-BROKER",
+		"version":      "12",
+		"version_type": "external",
+	}, params)
+}
@@ -1,9 +1,13 @@
 package elasticsearch
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
+	"github.com/elastic/beats/libbeat/common/aws"
 	"github.com/elastic/beats/libbeat/outputs"
+	"github.com/elastic/beats/libbeat/outputs/mode/modeutil"
 )
 
 type elasticsearchConfig struct {
@@ -12,14 +16,39 @@ type elasticsearchConfig struct {
 	Params           map[string]string  `config:"parameters"`
 	Username         string             `config:"username"`
 	Password         string             `config:"password"`
+	APIKey           string             `config:"api_key"`
+	BearerToken      string             `config:"bearer_token"`
+	AWS              *aws.Config        `config:"aws"`
 	ProxyURL         string             `config:"proxy_url"`
+	ProxyLocal       bool               `config:"proxy_use_local_resolver"`
+	NoProxy          []string           `config:"no_proxy"`
 	LoadBalance      bool               `config:"loadbalance"`
+	Strategy         string             `config:"loadbalance_strategy"`
+	Worker           int                `config:"worker" validate:"min=1"`
 	CompressionLevel int                `config:"compression_level" validate:"min=0, max=9"`
 	TLS              *outputs.TLSConfig `config:"ssl"`
 	MaxRetries       int                `config:"max_retries"`
 	Timeout          time.Duration      `config:"timeout"`
+	ConnectTimeout   time.Duration      `config:"connect_timeout"`
+	KeepAlive        time.Duration      `config:"keep_alive"`
+	IdleConnTimeout  time.Duration      `config:"idle_connection_timeout"`
+	MaxIdleConns     int                `config:"max_idle_connections" validate:"min=1"`
 	SaveTopology     bool               `config:"save_topology"`
 	Template         Template           `config:"template"`
+	Spool            *spoolConfig       `config:"spool"`
+	DeadLetter       *deadLetterConfig  `config:"dead_letter"`
+	Sniffing         *sniffConfig       `config:"sniffing"`
+	VersionType      string             `config:"version_type"`
+
+	ResurrectInterval    time.Duration `config:"resurrect_interval"     validate:"nonzero"`
+	MaxResurrectInterval time.Duration `config:"max_resurrect_interval" validate:"nonzero"`
+}
+
+// spoolConfig enables storing events on disk if they can not be published
+// after max_retries, to publish them again once Elasticsearch is reachable.
+type spoolConfig struct {
+	Path      string `config:"path"`
+	MaxSizeMB int    `config:"max_size_mb" validate:"min=0"`
 }
 
 type Template struct {
@@ -43,6 +72,9 @@ const (
 	defaultBulkSize = 50
 )
 
+// versionTypes are the version types supported by the index operation.
+var versionTypes = []string{"internal", "external", "external_gt", "external_gte"}
+
 var (
 	defaultConfig = elasticsearchConfig{
 		Protocol:         "",
@@ -52,23 +84,64 @@ var (
 		Username:         "",
 		Password:         "",
 		Timeout:          90 * time.Second,
+		KeepAlive:        30 * time.Second,
+		IdleConnTimeout:  60 * time.Second,
+		MaxIdleConns:     2,
 		MaxRetries:       3,
 		CompressionLevel: 0,
 		TLS:              nil,
 		LoadBalance:      true,
+		Worker:           1,
 		Template: Template{
 			Enabled:  true,
 			Versions: TemplateVersions{Es2x: TemplateVersion{Enabled: true}},
 		},
+		ResurrectInterval:    1 * time.Second,
+		MaxResurrectInterval: 60 * time.Second,
 	}
 )
 
 func (c *elasticsearchConfig) Validate() error {
+	auth := 0
+	for _, set := range []bool{
+		c.Username != "" || c.Password != "", c.APIKey != "", c.BearerToken != "", c.AWS != nil,
+	} {
+		if set {
+			auth++
+		}
+	}
+	if auth > 1 {
+		return errors.New("only one of username and password, api_key, bearer_token or aws can be configured")
+	}
+
 	if c.ProxyURL != "" {
 		if _, err := parseProxyURL(c.ProxyURL); err != nil {
 			return err
 		}
 	}
+	if err := validateNoProxy(c.NoProxy); err != nil {
+		return err
+	}
+
+	if err := modeutil.ValidateStrategy(c.Strategy); err != nil {
+		return err
+	}
+
+	if c.VersionType != "" {
+		valid := false
+		for _, t := range versionTypes {
+			valid = valid || c.VersionType == t
+		}
+		if !valid {
+			return fmt.Errorf("unknown version_type '%v', expected one of %v",
+				c.VersionType, versionTypes)
+		}
+	}
+
+	if c.MaxResurrectInterval < c.ResurrectInterval {
+		return fmt.Errorf("max_resurrect_interval (%v) must not be less than resurrect_interval (%v)",
+			c.MaxResurrectInterval, c.ResurrectInterval)
+	}
 
 	return nil
 }
@@ -0,0 +1,274 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/common/fmtstr"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/outputs"
+)
+
+// deadLetterConfig enables keeping the events rejected by Elasticsearch with
+// a mapping or parsing error, in a file or in a dedicated index.
+type deadLetterConfig struct {
+	Path      string                    `config:"path"`
+	Index     *fmtstr.EventFormatString `config:"index"`
+	MaxSizeMB int                       `config:"max_size_mb" validate:"min=0"`
+}
+
+// deadLetterType is the document type of the events indexed into the dead
+// letter index.
+const deadLetterType = "dead_letter"
+
+var (
+	deadLetterEvents  = expvar.NewInt("libbeat.es.dead_letter.events")
+	deadLetterDropped = expvar.NewInt("libbeat.es.dead_letter.dropped")
+)
+
+func (c *deadLetterConfig) Validate() error {
+	if c.Path != "" && c.Index != nil {
+		return errors.New("only one of dead_letter.path or dead_letter.index can be configured")
+	}
+	return nil
+}
+
+// DeadLetterQueue stores the events rejected by Elasticsearch, with the error
+// reason, instead of dropping them. It is shared by all clients of the
+// output.
+type DeadLetterQueue struct {
+	// index the events are sent to, if not written to the file
+	index *fmtstr.EventFormatString
+	file  *deadLetterFile
+}
+
+// deadLetterFile stores the dead letters as JSON lines. Dead letters not
+// fitting into maxSize are dropped.
+type deadLetterFile struct {
+	mutex   sync.Mutex
+	path    string
+	maxSize int64
+	file    *os.File
+	size    int64
+}
+
+func newDeadLetterFileQueue(path string, maxSize int64) (*DeadLetterQueue, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &DeadLetterQueue{file: &deadLetterFile{
+		path:    path,
+		maxSize: maxSize,
+		file:    file,
+		size:    info.Size(),
+	}}, nil
+}
+
+func newDeadLetterIndexQueue(index *fmtstr.EventFormatString) *DeadLetterQueue {
+	return &DeadLetterQueue{index: index}
+}
+
+// Close closes the dead letter file, if any.
+func (q *DeadLetterQueue) Close() error {
+	if q == nil || q.file == nil {
+		return nil
+	}
+	return q.file.file.Close()
+}
+
+// newDeadLetter creates the dead letter of an event rejected from index. The
+// event is kept JSON encoded, as indexing its fields would fail again.
+func newDeadLetter(event common.MapStr, index string, status int, reason common.MapStr) common.MapStr {
+	encoded, _ := json.Marshal(event)
+	meta := common.MapStr{
+		"index":  index,
+		"status": status,
+	}
+	if len(reason) > 0 {
+		meta["error"] = reason
+	}
+	return common.MapStr{
+		"@timestamp":   common.Time(time.Now()),
+		"type":         deadLetterType,
+		deadLetterType: meta,
+		"event":        string(encoded),
+	}
+}
+
+// itemErrorReason returns the type, reason and cause of the error of a bulk
+// item response, as reported by Elasticsearch 2.x and later, or the error
+// string of 1.x.
+func itemErrorReason(msg []byte) common.MapStr {
+	if len(msg) == 0 {
+		return nil
+	}
+
+	type cause struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	}
+	var details struct {
+		cause
+		CausedBy *cause `json:"caused_by"`
+	}
+	if err := json.Unmarshal(msg, &details); err == nil {
+		reason := common.MapStr{"type": details.Type, "reason": details.Reason}
+		if details.CausedBy != nil {
+			reason["caused_by"] = common.MapStr{
+				"type":   details.CausedBy.Type,
+				"reason": details.CausedBy.Reason,
+			}
+		}
+		return reason
+	}
+
+	var str string
+	if err := json.Unmarshal(msg, &str); err != nil {
+		str = string(msg)
+	}
+	return common.MapStr{"reason": str}
+}
+
+// errorReason returns the type and reason of the error of a rejected
+// request.
+func errorReason(err error) common.MapStr {
+	e, ok := err.(*Error)
+	if !ok {
+		if err == nil {
+			return nil
+		}
+		return common.MapStr{"reason": err.Error()}
+	}
+	reason := common.MapStr{"reason": e.Reason}
+	if e.Type != "" {
+		reason["type"] = e.Type
+	}
+	return reason
+}
+
+// addDeadLetter queues the dead letter of an event rejected by Elasticsearch,
+// to be published by publishDeadLetters.
+func (client *Client) addDeadLetter(datum outputs.Data, status int, reason common.MapStr) {
+	index := getIndex(datum.Event, client.index)
+	client.deadLetters = append(client.deadLetters,
+		newDeadLetter(datum.Event, index, status, reason))
+}
+
+// publishDeadLetters writes the queued dead letters to the file or sends
+// them to the dead letter index. Dead letters failing to be published are
+// dropped, not to block the publishing of events.
+func (client *Client) publishDeadLetters() {
+	docs := client.deadLetters
+	if len(docs) == 0 {
+		return
+	}
+	client.deadLetters = client.deadLetters[:0]
+
+	var written int
+	var err error
+	if file := client.deadLetter.file; file != nil {
+		written, err = file.write(docs)
+	} else {
+		written, err = client.indexDeadLetters(docs)
+	}
+	deadLetterEvents.Add(int64(written))
+	if dropped := len(docs) - written; dropped > 0 {
+		deadLetterDropped.Add(int64(dropped))
+		if err != nil {
+			logp.Err("Failed to store %v dead letters: %v", dropped, err)
+		}
+	}
+}
+
+// indexDeadLetters sends the dead letters to the dead letter index with a
+// bulk request. The number of dead letters indexed is returned.
+func (client *Client) indexDeadLetters(docs []common.MapStr) (int, error) {
+	body := client.encoder
+	body.Reset()
+
+	data := make([]outputs.Data, 0, len(docs))
+	for _, doc := range docs {
+		index, err := client.deadLetter.index.Run(doc)
+		if err != nil {
+			logp.Err("Failed to select dead letter index: %v", err)
+			continue
+		}
+		meta := common.MapStr{
+			"index": common.MapStr{"_index": index, "_type": deadLetterType},
+		}
+		if err := body.Add(meta, doc); err != nil {
+			logp.Err("Failed to encode dead letter: %v", err)
+			continue
+		}
+		data = append(data, outputs.Data{Event: doc})
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	requ := client.bulkRequ
+	requ.Reset(body)
+	status, result, err := client.sendBulkRequest(requ)
+	if err != nil {
+		return 0, err
+	}
+	if status != 200 {
+		return 0, fmt.Errorf("unexpected bulk response status %v", status)
+	}
+
+	count := len(data)
+	rejected := 0
+	client.json.init(result.raw)
+	failed := bulkCollectPublishFails(&client.json, data, func(outputs.Data, int, []byte) {
+		rejected++
+	})
+	return count - len(failed) - rejected, nil
+}
+
+// write appends the dead letters to the file, up to its maximum size. The
+// number of dead letters written is returned.
+func (f *deadLetterFile) write(docs []common.MapStr) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var buf bytes.Buffer
+	written := 0
+	for _, doc := range docs {
+		line, err := json.Marshal(doc)
+		if err != nil {
+			continue
+		}
+		if f.maxSize > 0 && f.size+int64(buf.Len()+len(line)+1) > f.maxSize {
+			logp.Warn("Dead letter file %v is full, dropping %v events rejected by Elasticsearch",
+				f.path, len(docs)-written)
+			break
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+		written++
+	}
+	if buf.Len() == 0 {
+		return 0, nil
+	}
+
+	n, err := f.file.Write(buf.Bytes())
+	f.size += int64(n)
+	if err != nil {
+		return 0, err
+	}
+	return written, nil
+}
@@ -0,0 +1,234 @@
+// +build !integration
+
+package elasticsearch
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/common/fmtstr"
+	"github.com/elastic/beats/libbeat/outputs"
+	"github.com/elastic/beats/libbeat/outputs/outil"
+)
+
+const rejectedBulkResponse = `{"items":[
+  {"index":{"status":201}},
+  {"index":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse [fix.Price]",
+    "caused_by":{"type":"number_format_exception","reason":"For input string: \"abc\""}}}},
+  {"index":{"status":409,"error":{"type":"version_conflict_engine_exception","reason":"conflict"}}}
+]}`
+
+func deadLetterTestData() []outputs.Data {
+	var data []outputs.Data
+	for _, price := range []interface{}{1.5, "abc", 2.5} {
+		data = append(data, outputs.Data{Event: common.MapStr{
+			"@timestamp": common.Time(time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)),
+			"type":       "fix",
+			"fix":        common.MapStr{"Price": price},
+		}})
+	}
+	return data
+}
+
+func newDeadLetterTestClient(t *testing.T, url string, q *DeadLetterQueue) *Client {
+	client, err := NewClient(ClientSettings{
+		URL:        url,
+		Index:      outil.MakeSelector(outil.ConstSelectorExpr("fixbeat")),
+		Timeout:    time.Second,
+		DeadLetter: q,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestDeadLetterFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(rejectedBulkResponse))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "deadletter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dead_letter.json")
+	q, err := newDeadLetterFileQueue(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newDeadLetterTestClient(t, server.URL, q)
+
+	failed, err := client.PublishEvents(deadLetterTestData())
+	assert.NoError(t, err)
+	assert.Empty(t, failed)
+	assert.NoError(t, q.Close())
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if !assert.Len(t, lines, 1) {
+		return
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &doc); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "dead_letter", doc["type"])
+	assert.Equal(t, map[string]interface{}{
+		"index":  "fixbeat",
+		"status": float64(400),
+		"error": map[string]interface{}{
+			"type":   "mapper_parsing_exception",
+			"reason": "failed to parse [fix.Price]",
+			"caused_by": map[string]interface{}{
+				"type":   "number_format_exception",
+				"reason": `For input string: "abc"`,
+			},
+		},
+	}, doc["dead_letter"])
+	assert.Equal(t, `{"@timestamp":"2017-03-01T12:00:00.000Z","fix":{"Price":"abc"},"type":"fix"}`,
+		doc["event"])
+}
+
+func TestDeadLetterFileRejectedBulk(t *testing.T) {
+	resp := `{"error":{"type":"illegal_argument_exception","reason":"bad bulk"},"status":400}`
+	server := ElasticsearchMock(http.StatusBadRequest, []byte(resp))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "deadletter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dead_letter.json")
+	q, err := newDeadLetterFileQueue(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newDeadLetterTestClient(t, server.URL, q)
+
+	failed, err := client.PublishEvents(deadLetterTestData())
+	assert.NoError(t, err)
+	assert.Empty(t, failed)
+	assert.NoError(t, q.Close())
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if !assert.Len(t, lines, 3) {
+		return
+	}
+
+	// all the events of the bulk request carry the error of the request
+	for _, line := range lines {
+		var doc map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &doc); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, map[string]interface{}{
+			"index":  "fixbeat",
+			"status": float64(400),
+			"error": map[string]interface{}{
+				"type":   "illegal_argument_exception",
+				"reason": "bad bulk",
+			},
+		}, doc["dead_letter"])
+	}
+}
+
+func TestDeadLetterFileMaxSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := newDeadLetterFileQueue(filepath.Join(dir, "dead_letter.json"), 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	var docs []common.MapStr
+	for _, datum := range deadLetterTestData() {
+		docs = append(docs, newDeadLetter(datum.Event, "fixbeat", 400, nil))
+	}
+	written, err := q.file.write(docs)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, written)
+	assert.True(t, q.file.size <= 300)
+}
+
+func TestDeadLetterIndex(t *testing.T) {
+	var deadLetters []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"_index":"fixbeat-dead-letter-`) {
+			w.Write([]byte(rejectedBulkResponse))
+			return
+		}
+
+		scanner := bufio.NewScanner(strings.NewReader(string(body)))
+		for scanner.Scan() {
+			deadLetters = append(deadLetters, scanner.Text())
+		}
+		w.Write([]byte(`{"items":[{"index":{"status":201}}]}`))
+	}))
+	defer server.Close()
+
+	index, err := fmtstr.CompileEvent("fixbeat-dead-letter-%{+yyyy.MM}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newDeadLetterTestClient(t, server.URL, newDeadLetterIndexQueue(index))
+
+	failed, err := client.PublishEvents(deadLetterTestData())
+	assert.NoError(t, err)
+	assert.Empty(t, failed)
+
+	if assert.Len(t, deadLetters, 2) {
+		assert.Contains(t, deadLetters[0], `"_type":"dead_letter"`)
+		assert.Contains(t, deadLetters[1], `"reason":"failed to parse [fix.Price]"`)
+	}
+}
+
+func TestItemErrorReason(t *testing.T) {
+	assert.Nil(t, itemErrorReason(nil))
+	assert.Equal(t, common.MapStr{"type": "mapper_parsing_exception", "reason": "failed"},
+		itemErrorReason([]byte(`{"type":"mapper_parsing_exception","reason":"failed"}`)))
+	assert.Equal(t, common.MapStr{"reason": "MapperParsingException[failed]"},
+		itemErrorReason([]byte(`"MapperParsingException[failed]"`)))
+}
+
+func TestDeadLetterConfig(t *testing.T) {
+	cfg, err := common.NewConfigFrom(map[string]interface{}{
+		"dead_letter.path":  "dead_letter.json",
+		"dead_letter.index": "dead-letter",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := defaultConfig
+	assert.Error(t, cfg.Unpack(&config))
+}
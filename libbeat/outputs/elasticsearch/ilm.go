@@ -0,0 +1,215 @@
+package elasticsearch
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// ilmConfig enables index lifecycle management. Events are indexed to the
+// rollover alias, its write index being rolled over once it is hot_days old
+// or reaches max_size, and indices are deleted delete_days after rollover.
+type ilmConfig struct {
+	Enabled       bool   `config:"enabled"`
+	RolloverAlias string `config:"rollover_alias"`
+	Pattern       string `config:"pattern"`
+	PolicyName    string `config:"policy_name"`
+	HotDays       int    `config:"hot_days" validate:"min=1"`
+	MaxSize       string `config:"max_size"`
+	DeleteDays    int    `config:"delete_days" validate:"min=0"`
+	Overwrite     bool   `config:"overwrite"`
+}
+
+var defaultILMConfig = ilmConfig{
+	Enabled:    false,
+	Pattern:    "{now/d}-000001",
+	HotDays:    1,
+	MaxSize:    "50gb",
+	DeleteDays: 30,
+}
+
+// ILM is supported by Elasticsearch 6.6 and later.
+const ilmMinMajor, ilmMinMinor = 6, 6
+
+// readILMConfig reads the ILM settings of the output config, the alias and
+// policy being named after the Beat by default.
+func readILMConfig(beatName string, cfg *common.Config) (ilmConfig, error) {
+	config := struct {
+		ILM ilmConfig `config:"ilm"`
+	}{defaultILMConfig}
+	if err := cfg.Unpack(&config); err != nil {
+		return config.ILM, err
+	}
+
+	ilm := config.ILM
+	if ilm.RolloverAlias == "" {
+		ilm.RolloverAlias = beatName
+	}
+	if ilm.PolicyName == "" {
+		ilm.PolicyName = beatName
+	}
+	return ilm, nil
+}
+
+// policy returns the body of the ILM policy.
+func (c *ilmConfig) policy() map[string]interface{} {
+	rollover := map[string]interface{}{
+		"max_age": fmt.Sprintf("%dd", c.HotDays),
+	}
+	if c.MaxSize != "" {
+		rollover["max_size"] = c.MaxSize
+	}
+
+	phases := map[string]interface{}{
+		"hot": map[string]interface{}{
+			"actions": map[string]interface{}{"rollover": rollover},
+		},
+	}
+	if c.DeleteDays > 0 {
+		phases["delete"] = map[string]interface{}{
+			"min_age": fmt.Sprintf("%dd", c.DeleteDays),
+			"actions": map[string]interface{}{"delete": map[string]interface{}{}},
+		}
+	}
+	return map[string]interface{}{
+		"policy": map[string]interface{}{"phases": phases},
+	}
+}
+
+// settings returns the index settings applying the policy to the indices of
+// the rollover alias.
+func (c *ilmConfig) settings() map[string]interface{} {
+	return map[string]interface{}{
+		"index.lifecycle.name":           c.PolicyName,
+		"index.lifecycle.rollover_alias": c.RolloverAlias,
+	}
+}
+
+// template returns a copy of the index template matching the indices of the
+// rollover alias and applying the policy to them.
+func (c *ilmConfig) template(template map[string]interface{}) map[string]interface{} {
+	copied := map[string]interface{}{}
+	for k, v := range template {
+		copied[k] = v
+	}
+
+	settings := map[string]interface{}{}
+	if s, ok := template["settings"].(map[string]interface{}); ok {
+		for k, v := range s {
+			settings[k] = v
+		}
+	}
+	for k, v := range c.settings() {
+		settings[k] = v
+	}
+	copied["settings"] = settings
+
+	delete(copied, "template")
+	copied["index_patterns"] = []string{c.RolloverAlias + "-*"}
+	return copied
+}
+
+// loadILMPolicy installs the ILM policy, unless it already exists and
+// overwriting is disabled.
+func (out *elasticsearchOutput) loadILMPolicy(client *Client) error {
+	if !versionAtLeast(client.Connection.version, ilmMinMajor, ilmMinMinor) {
+		return fmt.Errorf("index lifecycle management requires Elasticsearch %d.%d or later, connected to %s",
+			ilmMinMajor, ilmMinMinor, client.Connection.version)
+	}
+
+	config := out.ilm
+	if client.CheckILMPolicy(config.PolicyName) && !config.Overwrite {
+		logp.Info("ILM policy already exists and will not be overwritten.")
+		return nil
+	}
+	return client.LoadILMPolicy(config.PolicyName, config.policy())
+}
+
+// setupRolloverAlias creates the first index of the rollover alias, unless
+// the alias exists.
+func (out *elasticsearchOutput) setupRolloverAlias(client *Client) error {
+	config := out.ilm
+	if client.CheckAlias(config.RolloverAlias) {
+		return nil
+	}
+	return client.CreateRolloverAlias(config.RolloverAlias, config.Pattern, config.settings())
+}
+
+// CheckILMPolicy checks if the ILM policy exists.
+func (client *Client) CheckILMPolicy(name string) bool {
+	status, _, _ := client.request("GET", "/_ilm/policy/"+name, "", nil, nil)
+	return status == 200
+}
+
+// LoadILMPolicy installs the ILM policy, replacing the existing policy.
+func (client *Client) LoadILMPolicy(name string, policy map[string]interface{}) error {
+	if err := client.LoadJSON("/_ilm/policy/"+name, policy); err != nil {
+		return fmt.Errorf("couldn't load ILM policy: %v", err)
+	}
+	logp.Info("Elasticsearch ILM policy with name '%s' loaded", name)
+	return nil
+}
+
+// CheckAlias checks if the alias exists.
+func (client *Client) CheckAlias(alias string) bool {
+	status, _, _ := client.request("HEAD", "/_alias/"+alias, "", nil, nil)
+	return status == 200
+}
+
+// CreateRolloverAlias creates the first index of the rollover alias, named
+// after the alias and pattern, as write index of the alias. Date math in the
+// pattern is resolved by Elasticsearch.
+func (client *Client) CreateRolloverAlias(
+	alias, pattern string,
+	settings map[string]interface{},
+) error {
+	index := url.PathEscape("<" + alias + "-" + pattern + ">")
+	body := map[string]interface{}{
+		"settings": settings,
+		"aliases": map[string]interface{}{
+			alias: map[string]interface{}{"is_write_index": true},
+		},
+	}
+
+	_, _, err := client.request("PUT", "/"+index, "", nil, body)
+	if e, ok := err.(*Error); ok && e.Type == "resource_already_exists_exception" {
+		// another Beat created the alias with an index of the same name
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't create rollover alias %s: %v", alias, err)
+	}
+	logp.Info("Elasticsearch rollover alias '%s' created", alias)
+	return nil
+}
+
+// versionAtLeast checks the Elasticsearch version number is at least
+// major.minor.
+func versionAtLeast(version string, major, minor int) bool {
+	v, err := parseVersion(version)
+	if err != nil {
+		return false
+	}
+	return v[0] > major || (v[0] == major && v[1] >= minor)
+}
+
+func parseVersion(version string) ([2]int, error) {
+	var v [2]int
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return v, errors.New("invalid version " + version)
+	}
+	for i := range v {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return v, err
+		}
+		v[i] = n
+	}
+	return v, nil
+}
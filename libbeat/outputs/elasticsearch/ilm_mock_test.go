@@ -0,0 +1,171 @@
+// +build !integration
+
+package elasticsearch
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// ilmMock answers the requests setting up ILM, recording them.
+type ilmMock struct {
+	version string
+	exists  map[string]bool
+
+	// error bodies returned by path to PUT requests
+	putErrors map[string]string
+
+	mutex    sync.Mutex
+	requests []string
+}
+
+func (m *ilmMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/" {
+		w.Write([]byte(`{"version":{"number":"` + m.version + `"}}`))
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.requests = append(m.requests, r.Method+" "+r.URL.EscapedPath())
+	if (r.Method == "GET" || r.Method == "HEAD") && !m.exists[r.URL.Path] {
+		w.WriteHeader(404)
+	}
+	if body, ok := m.putErrors[r.URL.Path]; ok && r.Method == "PUT" {
+		w.WriteHeader(400)
+		w.Write([]byte(body))
+	}
+}
+
+func newILMOutput(t *testing.T, url string, ilm map[string]interface{}) *elasticsearchOutput {
+	dir, err := ioutil.TempDir("", "ilm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "template.json")
+	err = ioutil.WriteFile(path, []byte(`{"template": "test-*", "settings": {}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := common.NewConfigFrom(map[string]interface{}{
+		"hosts": []string{url},
+		"ilm":   ilm,
+		"template": map[string]interface{}{
+			"path":                path,
+			"versions.2x.enabled": false,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := New("test", cfg, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.(*elasticsearchOutput)
+}
+
+func connectILMClient(t *testing.T, out *elasticsearchOutput, url string) error {
+	client, err := out.newClient(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	return client.Connect(time.Second)
+}
+
+func TestILMSetupOnConnect(t *testing.T) {
+	mock := &ilmMock{version: "6.8.0"}
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	out := newILMOutput(t, server.URL, map[string]interface{}{"enabled": true})
+	defer out.Close()
+	index, err := out.index.Select(common.MapStr{})
+	assert.NoError(t, err)
+	assert.Equal(t, "test", index)
+
+	mock.mutex.Lock()
+	mock.requests = nil
+	mock.mutex.Unlock()
+	assert.NoError(t, connectILMClient(t, out, server.URL))
+
+	mock.mutex.Lock()
+	defer mock.mutex.Unlock()
+	assert.Equal(t, []string{
+		"GET /_ilm/policy/test",
+		"PUT /_ilm/policy/test",
+		"HEAD /_template/test",
+		"PUT /_template/test",
+		"HEAD /_alias/test",
+		"PUT /%3Ctest-%7Bnow%2Fd%7D-000001%3E",
+	}, mock.requests)
+}
+
+func TestILMSetupKeepsExisting(t *testing.T) {
+	mock := &ilmMock{version: "7.4.0", exists: map[string]bool{
+		"/_ilm/policy/test": true,
+		"/_template/test":   true,
+		"/_alias/test":      true,
+	}}
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	out := newILMOutput(t, server.URL, map[string]interface{}{"enabled": true})
+	defer out.Close()
+
+	mock.mutex.Lock()
+	mock.requests = nil
+	mock.mutex.Unlock()
+	assert.NoError(t, connectILMClient(t, out, server.URL))
+
+	mock.mutex.Lock()
+	defer mock.mutex.Unlock()
+	assert.Equal(t, []string{
+		"GET /_ilm/policy/test",
+		"HEAD /_template/test",
+		"HEAD /_alias/test",
+	}, mock.requests)
+}
+
+func TestILMAliasCreatedConcurrently(t *testing.T) {
+	mock := &ilmMock{version: "7.4.0", putErrors: map[string]string{
+		"/<test-{now/d}-000001>": `{"error": {"type": "resource_already_exists_exception",
+			"reason": "index [test-2016.10.14-000001] already exists"}, "status": 400}`,
+	}}
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	out := newILMOutput(t, server.URL, map[string]interface{}{"enabled": true})
+	defer out.Close()
+	assert.NoError(t, connectILMClient(t, out, server.URL))
+
+	// other errors still fail the setup
+	mock.putErrors["/<test-{now/d}-000001>"] = `{"error": {"type": "illegal_argument_exception"}, "status": 400}`
+	assert.Error(t, connectILMClient(t, out, server.URL))
+}
+
+func TestILMRequiresVersion(t *testing.T) {
+	server := httptest.NewServer(&ilmMock{version: "6.5.0"})
+	defer server.Close()
+
+	out := newILMOutput(t, server.URL, map[string]interface{}{"enabled": true})
+	defer out.Close()
+
+	err := connectILMClient(t, out, server.URL)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "requires Elasticsearch 6.6")
+	}
+}
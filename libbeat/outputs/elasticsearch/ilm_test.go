@@ -0,0 +1,103 @@
+// +build !integration
+
+package elasticsearch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func TestReadILMConfigDefaults(t *testing.T) {
+	cfg, err := common.NewConfigFrom(map[string]interface{}{
+		"ilm.enabled": true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ilm, err := readILMConfig("fixbeat", cfg)
+	assert.NoError(t, err)
+	assert.True(t, ilm.Enabled)
+	assert.Equal(t, "fixbeat", ilm.RolloverAlias)
+	assert.Equal(t, "fixbeat", ilm.PolicyName)
+	assert.Equal(t, "{now/d}-000001", ilm.Pattern)
+}
+
+func TestReadILMConfigInvalid(t *testing.T) {
+	cfg, err := common.NewConfigFrom(map[string]interface{}{
+		"ilm.hot_days": 0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = readILMConfig("fixbeat", cfg)
+	assert.Error(t, err)
+}
+
+func TestILMPolicy(t *testing.T) {
+	ilm := defaultILMConfig
+	ilm.HotDays = 2
+	ilm.DeleteDays = 7
+
+	assert.Equal(t, map[string]interface{}{
+		"policy": map[string]interface{}{
+			"phases": map[string]interface{}{
+				"hot": map[string]interface{}{
+					"actions": map[string]interface{}{
+						"rollover": map[string]interface{}{"max_age": "2d", "max_size": "50gb"},
+					},
+				},
+				"delete": map[string]interface{}{
+					"min_age": "7d",
+					"actions": map[string]interface{}{"delete": map[string]interface{}{}},
+				},
+			},
+		},
+	}, ilm.policy())
+
+	// indices are kept forever without delete_days
+	ilm.DeleteDays = 0
+	ilm.MaxSize = ""
+	phases := ilm.policy()["policy"].(map[string]interface{})["phases"].(map[string]interface{})
+	assert.NotContains(t, phases, "delete")
+	assert.Equal(t, map[string]interface{}{"max_age": "2d"},
+		phases["hot"].(map[string]interface{})["actions"].(map[string]interface{})["rollover"])
+}
+
+func TestILMTemplate(t *testing.T) {
+	ilm := defaultILMConfig
+	ilm.RolloverAlias = "fix"
+	ilm.PolicyName = "fix-retention"
+
+	template := map[string]interface{}{
+		"template": "packetbeat-*",
+		"settings": map[string]interface{}{"index.refresh_interval": "5s"},
+		"mappings": map[string]interface{}{},
+	}
+	copied := ilm.template(template)
+
+	assert.Equal(t, []string{"fix-*"}, copied["index_patterns"])
+	assert.NotContains(t, copied, "template")
+	assert.Equal(t, map[string]interface{}{
+		"index.refresh_interval":         "5s",
+		"index.lifecycle.name":           "fix-retention",
+		"index.lifecycle.rollover_alias": "fix",
+	}, copied["settings"])
+
+	// the template read from disk is left unchanged
+	assert.Equal(t, "packetbeat-*", template["template"])
+	assert.Len(t, template["settings"], 1)
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	assert.True(t, versionAtLeast("6.6.0", 6, 6))
+	assert.True(t, versionAtLeast("6.8.2", 6, 6))
+	assert.True(t, versionAtLeast("7.0.0-beta1", 6, 6))
+	assert.False(t, versionAtLeast("6.5.4", 6, 6))
+	assert.False(t, versionAtLeast("5.6.0", 6, 6))
+	assert.False(t, versionAtLeast("", 6, 6))
+}
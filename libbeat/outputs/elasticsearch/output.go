@@ -11,11 +11,13 @@ import (
 	"time"
 
 	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/common/aws"
 	"github.com/elastic/beats/libbeat/common/op"
 	"github.com/elastic/beats/libbeat/logp"
 	"github.com/elastic/beats/libbeat/outputs"
 	"github.com/elastic/beats/libbeat/outputs/mode"
 	"github.com/elastic/beats/libbeat/outputs/mode/modeutil"
+	"github.com/elastic/beats/libbeat/outputs/mode/spool"
 	"github.com/elastic/beats/libbeat/outputs/outil"
 	"github.com/elastic/beats/libbeat/outputs/transport"
 	"github.com/elastic/beats/libbeat/paths"
@@ -25,13 +27,24 @@ type elasticsearchOutput struct {
 	index    outil.Selector
 	beatName string
 	pipeline *outil.Selector
+	docMeta  DocMeta
+
+	// events rejected by Elasticsearch, nil if dropped
+	deadLetter *DeadLetterQueue
 
 	mode mode.ConnectionMode
 	topology
 
+	// creates the clients of the hosts, for TestConnection
+	hosts     []string
+	newClient func(host string) (mode.ProtocolClient, error)
+
 	template      map[string]interface{}
 	template2x    map[string]interface{}
 	templateMutex sync.Mutex
+
+	// index lifecycle management set up on connect, nil if disabled
+	ilm *ilmConfig
 }
 
 func init() {
@@ -59,13 +72,25 @@ func New(beatName string, cfg *common.Config, topologyExpire int) (outputs.Outpu
 		cfg.SetInt("bulk_max_size", -1, defaultBulkSize)
 	}
 
+	ilm, err := readILMConfig(beatName, cfg)
+	if err != nil {
+		return nil, err
+	}
 	if !cfg.HasField("index") {
 		pattern := fmt.Sprintf("%v-%%{+yyyy.MM.dd}", beatName)
+		if ilm.Enabled {
+			// the write index of the alias is rolled over by Elasticsearch
+			pattern = ilm.RolloverAlias
+		}
 		cfg.SetString("index", -1, pattern)
 	}
 
 	output := &elasticsearchOutput{beatName: beatName}
-	err := output.init(cfg, topologyExpire)
+	if ilm.Enabled {
+		logp.Info("Index lifecycle management enabled, indexing to rollover alias %s", ilm.RolloverAlias)
+		output.ilm = &ilm
+	}
+	err = output.init(cfg, topologyExpire)
 	if err != nil {
 		return nil, err
 	}
@@ -116,7 +141,46 @@ func (out *elasticsearchOutput) init(
 		out.pipeline = &pipeline
 	}
 
-	clients, err := modeutil.MakeClients(cfg, makeClientFactory(tlsConfig, &config, out))
+	out.docMeta.VersionType = config.VersionType
+	if out.docMeta.ID, err = buildMetaSelector(cfg, "document_id"); err != nil {
+		return err
+	}
+	if out.docMeta.Routing, err = buildMetaSelector(cfg, "routing"); err != nil {
+		return err
+	}
+	if out.docMeta.Parent, err = buildMetaSelector(cfg, "parent"); err != nil {
+		return err
+	}
+	if out.docMeta.Version, err = buildMetaSelector(cfg, "version"); err != nil {
+		return err
+	}
+
+	if config.DeadLetter != nil {
+		if config.DeadLetter.Index != nil {
+			logp.Info("Events rejected by Elasticsearch are indexed into the dead letter index")
+			out.deadLetter = newDeadLetterIndexQueue(config.DeadLetter.Index)
+		} else {
+			path := config.DeadLetter.Path
+			if path == "" {
+				path = "elasticsearch.dead_letter.json"
+			}
+			path = paths.Resolve(paths.Data, path)
+
+			logp.Info("Events rejected by Elasticsearch are written to %v", path)
+			out.deadLetter, err = newDeadLetterFileQueue(path,
+				int64(config.DeadLetter.MaxSizeMB)*1024*1024)
+			if err != nil {
+				return fmt.Errorf("failed to open dead letter file %v: %v", path, err)
+			}
+		}
+	}
+
+	out.newClient = makeClientFactory(tlsConfig, &config, out)
+	clients, err := modeutil.MakeClients(cfg, out.newClient)
+	if err != nil {
+		return err
+	}
+	out.hosts, err = modeutil.ReadHostList(cfg)
 	if err != nil {
 		return err
 	}
@@ -127,27 +191,88 @@ func (out *elasticsearchOutput) init(
 		maxAttempts = 0
 	}
 
-	var waitRetry = time.Duration(1) * time.Second
-	var maxWaitRetry = time.Duration(60) * time.Second
+	// Workers of failed connections keep pinging their node in the
+	// background, doubling the wait time between attempts from
+	// resurrect_interval up to max_resurrect_interval.
+	waitRetry := config.ResurrectInterval
+	maxWaitRetry := config.MaxResurrectInterval
 
 	out.clients = clients
-	loadBalance := config.LoadBalance
-	m, err := modeutil.NewConnectionMode(clients, modeutil.Settings{
-		Failover:     !loadBalance,
+	settings := modeutil.Settings{
+		Failover:     !config.LoadBalance,
+		Strategy:     config.Strategy,
+		Workers:      config.Worker,
 		MaxAttempts:  maxAttempts,
 		Timeout:      config.Timeout,
 		WaitRetry:    waitRetry,
 		MaxWaitRetry: maxWaitRetry,
-	})
+	}
+	if config.Sniffing != nil {
+		// each worker publishes to all nodes sniffed
+		if config.Sniffing.Interval == 0 {
+			config.Sniffing.Interval = defaultSniffInterval
+		}
+		logp.Info("Sniffing the Elasticsearch nodes every %v", config.Sniffing.Interval)
+		clients, err = out.makeNodePools(config.Worker, *config.Sniffing)
+		if err != nil {
+			return err
+		}
+		settings.Failover = false
+		settings.Strategy = ""
+	}
+	m, err := modeutil.NewConnectionMode(clients, settings)
 	if err != nil {
 		return err
 	}
 
+	if config.Spool != nil {
+		path := config.Spool.Path
+		if path == "" {
+			path = "elasticsearch.spool"
+		}
+		path = paths.Resolve(paths.Data, path)
+		bulkSize, _ := cfg.Int("bulk_max_size", -1)
+
+		logp.Info("Events failing to be published are spooled to %v", path)
+		m, err = spool.New(m, path, int64(config.Spool.MaxSizeMB)*1024*1024,
+			int(bulkSize), maxWaitRetry)
+		if err != nil {
+			return err
+		}
+	}
+
 	out.mode = m
 
 	return nil
 }
 
+// makeNodePools creates the node pools of the workers, sniffing the nodes of
+// the cluster from the configured hosts.
+func (out *elasticsearchOutput) makeNodePools(
+	workers int,
+	config sniffConfig,
+) ([]mode.ProtocolClient, error) {
+	var seeds []string
+	seen := map[string]bool{}
+	for _, host := range out.hosts {
+		// hosts are listed once per worker
+		if !seen[host] {
+			seen[host] = true
+			seeds = append(seeds, host)
+		}
+	}
+
+	pools := make([]mode.ProtocolClient, workers)
+	for i := range pools {
+		pool, err := newNodePool(seeds, out.newClient, config)
+		if err != nil {
+			return nil, err
+		}
+		pools[i] = pool
+	}
+	return pools, nil
+}
+
 // readTemplates reads the ES mapping template from the disk, if configured.
 func (out *elasticsearchOutput) readTemplate(config *Template) error {
 	if config.Enabled {
@@ -204,6 +329,33 @@ func readTemplate(filename string) (map[string]interface{}, error) {
 	return template, nil
 }
 
+// dateNanosMinMajor and dateNanosMinMinor are the first version of
+// Elasticsearch storing dates to the nanosecond.
+const dateNanosMinMajor, dateNanosMinMinor = 7, 0
+
+// withoutDateNanos returns a copy of the template mapping the date_nanos
+// fields as date, for Elasticsearch versions storing dates to the millisecond.
+func withoutDateNanos(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for k, value := range v {
+			if k == "type" && value == "date_nanos" {
+				value = "date"
+			}
+			copied[k] = withoutDateNanos(value)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, value := range v {
+			copied[i] = withoutDateNanos(value)
+		}
+		return copied
+	}
+	return v
+}
+
 // loadTemplate checks if the index mapping template should be loaded
 // In case the template is not already loaded or overwriting is enabled, the
 // template is written to index
@@ -226,6 +378,12 @@ func (out *elasticsearchOutput) loadTemplate(config Template, client *Client) er
 			logp.Info("Detected Elasticsearch 2.x. Automatically selecting the 2.x version of the template")
 			template = out.template2x
 		}
+		if !versionAtLeast(client.Connection.version, dateNanosMinMajor, dateNanosMinMinor) {
+			template = withoutDateNanos(template).(map[string]interface{})
+		}
+		if out.ilm != nil {
+			template = out.ilm.template(template)
+		}
 
 		err := client.LoadTemplate(config.Name, template)
 		if err != nil {
@@ -238,11 +396,40 @@ func (out *elasticsearchOutput) loadTemplate(config Template, client *Client) er
 	return nil
 }
 
+// setupIndices prepares the indices events are published to on connect. With
+// ILM enabled, the policy is installed before the template referencing it,
+// and the rollover alias is created once the template applies to its indices.
+func (out *elasticsearchOutput) setupIndices(config Template, client *Client) error {
+	if out.ilm != nil {
+		if err := out.loadILMPolicy(client); err != nil {
+			return fmt.Errorf("Could not load ILM policy: %v", err)
+		}
+	}
+	if out.template != nil {
+		if err := out.loadTemplate(config, client); err != nil {
+			return err
+		}
+	}
+	if out.ilm != nil {
+		if err := out.setupRolloverAlias(client); err != nil {
+			return fmt.Errorf("Could not set up rollover alias: %v", err)
+		}
+	}
+	return nil
+}
+
 func makeClientFactory(
 	tls *transport.TLSConfig,
 	config *elasticsearchConfig,
 	out *elasticsearchOutput,
 ) func(string) (mode.ProtocolClient, error) {
+	// the signer is shared by all clients, caching the credentials
+	var signer *aws.Signer
+	if config.AWS != nil {
+		signer = aws.NewSigner(config.AWS)
+		logp.Info("Signing requests with AWS SigV4 for region %s", config.AWS.Region)
+	}
+
 	return func(host string) (mode.ProtocolClient, error) {
 		esURL, err := getURL(config.Protocol, config.Path, host)
 		if err != nil {
@@ -267,9 +454,9 @@ func makeClientFactory(
 
 		// define a callback to be called on connection
 		var onConnected connectCallback
-		if out.template != nil {
+		if out.template != nil || out.ilm != nil {
 			onConnected = func(client *Client) error {
-				return out.loadTemplate(config.Template, client)
+				return out.setupIndices(config.Template, client)
 			}
 		}
 
@@ -277,19 +464,137 @@ func makeClientFactory(
 			URL:              esURL,
 			Index:            out.index,
 			Pipeline:         out.pipeline,
+			DocMeta:          out.docMeta,
 			Proxy:            proxyURL,
+			ProxyLocal:       config.ProxyLocal,
+			NoProxy:          config.NoProxy,
 			TLS:              tls,
 			Username:         config.Username,
 			Password:         config.Password,
+			APIKey:           config.APIKey,
+			BearerToken:      config.BearerToken,
+			Signer:           signer,
+			DeadLetter:       out.deadLetter,
 			Parameters:       params,
 			Timeout:          config.Timeout,
 			CompressionLevel: config.CompressionLevel,
+			ConnectTimeout:   config.ConnectTimeout,
+			KeepAlive:        config.KeepAlive,
+			IdleConnTimeout:  config.IdleConnTimeout,
+			MaxIdleConns:     config.MaxIdleConns,
 		}, onConnected)
 	}
 }
 
+// NewQueryClient connects to the first host responding among the hosts of
+// the Elasticsearch output configured by cfg, for searching the events
+// indexed. The settings of the output used for publishing are ignored.
+func NewQueryClient(cfg *common.Config) (*Client, error) {
+	config := defaultConfig
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, err
+	}
+	tlsConfig, err := outputs.LoadTLSConfig(config.TLS)
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := modeutil.ReadHostList(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		return nil, mode.ErrNoHostsConfigured
+	}
+
+	var proxyURL *url.URL
+	if config.ProxyURL != "" {
+		if proxyURL, err = parseProxyURL(config.ProxyURL); err != nil {
+			return nil, err
+		}
+	}
+	var signer *aws.Signer
+	if config.AWS != nil {
+		signer = aws.NewSigner(config.AWS)
+	}
+
+	for _, host := range hosts {
+		var esURL string
+		esURL, err = getURL(config.Protocol, config.Path, host)
+		if err != nil {
+			return nil, err
+		}
+		var client *Client
+		client, err = NewClient(ClientSettings{
+			URL:            esURL,
+			Proxy:          proxyURL,
+			ProxyLocal:     config.ProxyLocal,
+			NoProxy:        config.NoProxy,
+			TLS:            tlsConfig,
+			Username:       config.Username,
+			Password:       config.Password,
+			APIKey:         config.APIKey,
+			BearerToken:    config.BearerToken,
+			Signer:         signer,
+			Timeout:        config.Timeout,
+			ConnectTimeout: config.ConnectTimeout,
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err = client.Connect(config.Timeout); err == nil {
+			return client, nil
+		}
+		logp.Warn("Failed to connect to Elasticsearch host %s: %v", host, err)
+	}
+	return nil, err
+}
+
+// buildMetaSelector builds the document metadata selector configured by key,
+// returning nil if key is not set.
+func buildMetaSelector(cfg *common.Config, key string) (*outil.Selector, error) {
+	sel, err := outil.BuildSelectorFromConfig(cfg, outil.Settings{
+		Key:              key,
+		EnableSingleOnly: true,
+	})
+	if err != nil || sel.IsEmpty() {
+		return nil, err
+	}
+	return &sel, nil
+}
+
+// TestConnection pings each Elasticsearch host, checking it is reachable with
+// the configured TLS settings and credentials.
+func (out *elasticsearchOutput) TestConnection(timeout time.Duration) error {
+	tested := map[string]bool{}
+	for _, host := range out.hosts {
+		// hosts are listed once per worker
+		if tested[host] {
+			continue
+		}
+		tested[host] = true
+
+		// new clients, the clients of the workers not being safe to share
+		c, err := out.newClient(host)
+		if err != nil {
+			return err
+		}
+		client := c.(*Client)
+		version, err := client.Ping(timeout)
+		client.Close()
+		if err != nil {
+			return fmt.Errorf("%v: %v", client.URL, err)
+		}
+		logp.Info("Elasticsearch %v is reachable, version %v", client.URL, version)
+	}
+	return nil
+}
+
 func (out *elasticsearchOutput) Close() error {
-	return out.mode.Close()
+	err := out.mode.Close()
+	if dlErr := out.deadLetter.Close(); err == nil {
+		err = dlErr
+	}
+	return err
 }
 
 func (out *elasticsearchOutput) PublishEvent(
@@ -310,7 +615,7 @@ func (out *elasticsearchOutput) BulkPublish(
 
 func parseProxyURL(raw string) (*url.URL, error) {
 	url, err := url.Parse(raw)
-	if err == nil && strings.HasPrefix(url.Scheme, "http") {
+	if err == nil && (strings.HasPrefix(url.Scheme, "http") || url.Scheme == "socks5") {
 		return url, err
 	}
 
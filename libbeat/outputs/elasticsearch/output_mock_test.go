@@ -0,0 +1,91 @@
+//go:build !integration
+// +build !integration
+
+package elasticsearch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/outputs"
+)
+
+func TestTestConnection(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "beats" || pass != "s3cr3t" {
+			w.WriteHeader(401)
+			return
+		}
+		w.Write([]byte(`{"version":{"number":"5.0.0"}}`))
+	}))
+	defer server.Close()
+
+	newOutput := func(password string) outputs.Outputer {
+		cfg, err := common.NewConfigFrom(map[string]interface{}{
+			"hosts":    []string{server.URL},
+			"worker":   2,
+			"username": "beats",
+			"password": password,
+			"template": map[string]interface{}{"enabled": false},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := New("test", cfg, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	out := newOutput("s3cr3t")
+	defer out.Close()
+	tested, err := outputs.TestOutput(out, time.Second)
+	assert.True(t, tested)
+	assert.NoError(t, err)
+
+	out = newOutput("wrong")
+	defer out.Close()
+	_, err = outputs.TestOutput(out, time.Second)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "401")
+	}
+}
+
+func TestWithoutDateNanos(t *testing.T) {
+	template := map[string]interface{}{
+		"template": "test-*",
+		"mappings": map[string]interface{}{
+			"_default_": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"@timestamp": map[string]interface{}{"type": "date"},
+					"sent":       map[string]interface{}{"type": "date_nanos"},
+					"type":       map[string]interface{}{"type": "keyword"},
+				},
+				"dynamic_templates": []interface{}{
+					map[string]interface{}{"times": map[string]interface{}{
+						"mapping": map[string]interface{}{"type": "date_nanos"},
+					}},
+				},
+			},
+		},
+	}
+
+	mapping := withoutDateNanos(template).(map[string]interface{})["mappings"].(map[string]interface{})["_default_"].(map[string]interface{})
+	properties := mapping["properties"].(map[string]interface{})
+	assert.Equal(t, "date", properties["sent"].(map[string]interface{})["type"])
+	assert.Equal(t, "date", properties["@timestamp"].(map[string]interface{})["type"])
+	// the field named type is kept
+	assert.Equal(t, "keyword", properties["type"].(map[string]interface{})["type"])
+	dynamic := mapping["dynamic_templates"].([]interface{})[0].(map[string]interface{})["times"].(map[string]interface{})
+	assert.Equal(t, "date", dynamic["mapping"].(map[string]interface{})["type"])
+
+	// the template read is not changed
+	sent := template["mappings"].(map[string]interface{})["_default_"].(map[string]interface{})["properties"].(map[string]interface{})["sent"]
+	assert.Equal(t, "date_nanos", sent.(map[string]interface{})["type"])
+}
@@ -0,0 +1,99 @@
+package elasticsearch
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/elastic/beats/libbeat/outputs/transport"
+)
+
+// noProxy lists the hosts connected to directly, bypassing the proxy. Entries
+// are host names, matching the host and its subdomains, IP addresses, CIDR
+// ranges, or "*" matching all hosts.
+type noProxy []string
+
+func validateNoProxy(entries []string) error {
+	for _, entry := range entries {
+		if strings.Contains(entry, "/") {
+			if _, _, err := net.ParseCIDR(entry); err != nil {
+				return fmt.Errorf("invalid no_proxy entry %v: %v", entry, err)
+			}
+		}
+	}
+	return nil
+}
+
+// match checks if the host, optionally with port, is excluded from using the
+// proxy.
+func (n noProxy) match(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	ip := net.ParseIP(host)
+
+	for _, entry := range n {
+		entry = strings.ToLower(entry)
+		switch {
+		case entry == "*":
+			return true
+		case strings.Contains(entry, "/"):
+			_, ipNet, err := net.ParseCIDR(entry)
+			if err == nil && ip != nil && ipNet.Contains(ip) {
+				return true
+			}
+		default:
+			entry = strings.TrimPrefix(entry, ".")
+			if host == entry || strings.HasSuffix(host, "."+entry) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// proxyFunc returns the proxy selection of the HTTP transport. If proxyURL
+// is nil, the proxy is selected by the environment variables HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY.
+func proxyFunc(proxyURL *url.URL, exclude noProxy) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		if exclude.match(req.URL.Host) {
+			return nil, nil
+		}
+		if proxyURL == nil {
+			return http.ProxyFromEnvironment(req)
+		}
+		return proxyURL, nil
+	}
+}
+
+// socksDialer connects through the SOCKS5 proxy, except for the hosts
+// excluded.
+func socksDialer(
+	proxyURL *url.URL,
+	localResolve bool,
+	exclude noProxy,
+	forward transport.Dialer,
+) (transport.Dialer, error) {
+	dialer, err := transport.ProxyDialer(&transport.ProxyConfig{
+		URL:          proxyURL.String(),
+		LocalResolve: localResolve,
+	}, forward)
+	if err != nil {
+		return nil, err
+	}
+
+	return transport.DialerFunc(func(network, address string) (net.Conn, error) {
+		if exclude.match(address) {
+			return forward.Dial(network, address)
+		}
+		return dialer.Dial(network, address)
+	}), nil
+}
+
+func isSocksProxy(proxyURL *url.URL) bool {
+	return proxyURL != nil && proxyURL.Scheme == "socks5"
+}
@@ -0,0 +1,413 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/outputs"
+	"github.com/elastic/beats/libbeat/outputs/mode"
+)
+
+// sniffConfig enables discovering the nodes of the cluster from the nodes info
+// API of the configured hosts, publishing to all nodes found.
+type sniffConfig struct {
+	// period between sniffs, defaultSniffInterval if not set
+	Interval time.Duration `config:"interval" validate:"min=0"`
+
+	// regular expressions matched against the node names and HTTP addresses,
+	// nodes matching an exclude pattern or, if set, no include pattern are
+	// not published to
+	Include []string `config:"include"`
+	Exclude []string `config:"exclude"`
+}
+
+const defaultSniffInterval = 5 * time.Minute
+
+var errNoNodes = errors.New("no Elasticsearch node connected")
+
+func (c *sniffConfig) Validate() error {
+	_, err := compilePatterns(c.Include)
+	if err == nil {
+		_, err = compilePatterns(c.Exclude)
+	}
+	return err
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sniffing pattern %v: %v", pattern, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// nodePool publishes to the nodes of the cluster, sniffed every interval from
+// the nodes connected to, starting with the configured hosts. Batches are sent
+// to the nodes in turn, failing over to the next node on errors. If no node is
+// left, the configured hosts are connected to again.
+type nodePool struct {
+	newClient func(host string) (mode.ProtocolClient, error)
+	seeds     []string
+	interval  time.Duration
+	include   []*regexp.Regexp
+	exclude   []*regexp.Regexp
+
+	// scheme of the configured hosts, added to the hosts of the nodes
+	scheme string
+
+	timeout   time.Duration
+	nextSniff time.Time
+
+	hosts     []string
+	nodes     []mode.ProtocolClient
+	connected []bool
+	last      int
+}
+
+func newNodePool(
+	seeds []string,
+	newClient func(host string) (mode.ProtocolClient, error),
+	config sniffConfig,
+) (*nodePool, error) {
+	if len(seeds) == 0 {
+		return nil, mode.ErrNoHostsConfigured
+	}
+	include, err := compilePatterns(config.Include)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compilePatterns(config.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	p := &nodePool{
+		newClient: newClient,
+		seeds:     seeds,
+		interval:  config.Interval,
+		include:   include,
+		exclude:   exclude,
+	}
+	if i := strings.Index(seeds[0], "://"); i > 0 {
+		p.scheme = seeds[0][:i+3]
+	}
+	return p, nil
+}
+
+// Connect connects the nodes not connected and sniffs the nodes of the
+// cluster if due. If no node can be connected, the configured hosts are
+// connected instead.
+func (p *nodePool) Connect(to time.Duration) error {
+	p.timeout = to
+	if len(p.nodes) == 0 {
+		p.setHosts(p.seeds)
+	}
+
+	err := p.connectNodes()
+	if p.active() == 0 && !equalHosts(p.hosts, p.seeds) {
+		logp.Info("No Elasticsearch node reachable, connecting to the configured hosts")
+		p.setHosts(p.seeds)
+		err = p.connectNodes()
+	}
+	if p.active() == 0 {
+		return err
+	}
+
+	p.sniffIfDue()
+	return nil
+}
+
+func (p *nodePool) Close() error {
+	var err error
+	for i, node := range p.nodes {
+		if !p.connected[i] {
+			continue
+		}
+		if cerr := node.Close(); cerr != nil {
+			err = cerr
+		}
+		p.connected[i] = false
+	}
+	return err
+}
+
+func (p *nodePool) PublishEvents(data []outputs.Data) ([]outputs.Data, error) {
+	p.sniffIfDue()
+	err := p.send(func(node mode.ProtocolClient) error {
+		var err error
+		data, err = node.PublishEvents(data)
+		return err
+	})
+	return data, err
+}
+
+func (p *nodePool) PublishEvent(data outputs.Data) error {
+	p.sniffIfDue()
+	return p.send(func(node mode.ProtocolClient) error {
+		return node.PublishEvent(data)
+	})
+}
+
+// send publishes with the next connected node, failing over to the following
+// nodes until no connected node is left. Temporary failures are returned
+// without failing over.
+func (p *nodePool) send(publish func(mode.ProtocolClient) error) error {
+	for {
+		i := p.next()
+		if i < 0 {
+			return errNoNodes
+		}
+
+		err := publish(p.nodes[i])
+		if err == nil || err == mode.ErrTempBulkFailure {
+			// keep throttled nodes connected, the caller backs off before
+			// retrying
+			return err
+		}
+
+		logp.Info("Error publishing events to %v (failing over to next node): %s", p.hosts[i], err)
+		p.nodes[i].Close()
+		p.connected[i] = false
+		if p.active() == 0 {
+			return err
+		}
+	}
+}
+
+// next returns the index of the next connected node, or -1 if no node is
+// connected.
+func (p *nodePool) next() int {
+	for i := 1; i <= len(p.nodes); i++ {
+		next := (p.last + i) % len(p.nodes)
+		if p.connected[next] {
+			p.last = next
+			return next
+		}
+	}
+	return -1
+}
+
+func (p *nodePool) active() int {
+	n := 0
+	for _, connected := range p.connected {
+		if connected {
+			n++
+		}
+	}
+	return n
+}
+
+func (p *nodePool) connectNodes() error {
+	var err error
+	for i, node := range p.nodes {
+		if p.connected[i] {
+			continue
+		}
+		if cerr := node.Connect(p.timeout); cerr != nil {
+			logp.Err("Failed to connect to Elasticsearch node %v: %v", p.hosts[i], cerr)
+			err = cerr
+			continue
+		}
+		p.connected[i] = true
+	}
+	return err
+}
+
+// sniffIfDue updates the nodes from the nodes info API of the first connected
+// node answering, once per interval. The nodes are kept if no node answers or
+// no node matches the filters.
+func (p *nodePool) sniffIfDue() {
+	now := time.Now()
+	if now.Before(p.nextSniff) {
+		return
+	}
+	p.nextSniff = now.Add(p.interval)
+
+	var hosts []string
+	err := errNoNodes
+	for i, node := range p.nodes {
+		client, ok := node.(*Client)
+		if !ok || !p.connected[i] {
+			continue
+		}
+		if hosts, err = p.sniff(client); err == nil {
+			break
+		}
+		logp.Warn("Failed to sniff the Elasticsearch nodes from %v: %v", p.hosts[i], err)
+	}
+	if err != nil {
+		return
+	}
+	if len(hosts) == 0 {
+		logp.Warn("No sniffed Elasticsearch node matches the sniffing filters, keeping nodes %v", p.hosts)
+		return
+	}
+
+	p.setHosts(hosts)
+	p.connectNodes()
+}
+
+// sniff returns the hosts of the nodes matching the filters, excluding the
+// dedicated master nodes and the nodes without HTTP.
+func (p *nodePool) sniff(client *Client) ([]string, error) {
+	req, err := http.NewRequest("GET", makeURL(client.URL, "/_nodes/http", "", nil), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// limit the sniffing request only, keeping the timeout of the client
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	_, body, err := client.execHTTPRequest(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	var info struct {
+		Nodes map[string]struct {
+			Name  string   `json:"name"`
+			Roles []string `json:"roles"`
+			HTTP  *struct {
+				PublishAddress string `json:"publish_address"`
+			} `json:"http"`
+		} `json:"nodes"`
+	}
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("invalid nodes info: %v", err)
+	}
+
+	var hosts []string
+	for _, node := range info.Nodes {
+		if node.HTTP == nil || isDedicatedMaster(node.Roles) {
+			continue
+		}
+		host, err := nodeHost(node.HTTP.PublishAddress)
+		if err != nil {
+			debugf("Skipping node %v: %v", node.Name, err)
+			continue
+		}
+		if !p.matches(node.Name, host) {
+			continue
+		}
+		hosts = append(hosts, p.scheme+host)
+	}
+	return hosts, nil
+}
+
+func (p *nodePool) matches(name, host string) bool {
+	matchAny := func(patterns []*regexp.Regexp) bool {
+		for _, re := range patterns {
+			if re.MatchString(name) || re.MatchString(host) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(p.include) > 0 && !matchAny(p.include) {
+		return false
+	}
+	return !matchAny(p.exclude)
+}
+
+// setHosts replaces the nodes by the nodes of hosts, keeping the clients of
+// the hosts already known and closing the clients of the hosts removed.
+func (p *nodePool) setHosts(hosts []string) {
+	hosts = append([]string(nil), hosts...)
+	sort.Strings(hosts)
+	if len(p.nodes) > 0 && equalHosts(hosts, p.hosts) {
+		return
+	}
+
+	known := map[string]int{}
+	for i, host := range p.hosts {
+		known[host] = i
+	}
+
+	var nodes []mode.ProtocolClient
+	var connected []bool
+	var added []string
+	for _, host := range hosts {
+		if i, ok := known[host]; ok {
+			nodes = append(nodes, p.nodes[i])
+			connected = append(connected, p.connected[i])
+			added = append(added, host)
+			delete(known, host)
+			continue
+		}
+
+		node, err := p.newClient(host)
+		if err != nil {
+			logp.Err("Skipping Elasticsearch node %v: %v", host, err)
+			continue
+		}
+		nodes = append(nodes, node)
+		connected = append(connected, false)
+		added = append(added, host)
+	}
+	for _, i := range known {
+		if p.connected[i] {
+			p.nodes[i].Close()
+		}
+	}
+
+	logp.Info("Publishing to the Elasticsearch nodes %v", added)
+	p.hosts, p.nodes, p.connected = added, nodes, connected
+	if p.last >= len(p.nodes) {
+		p.last = 0
+	}
+}
+
+func isDedicatedMaster(roles []string) bool {
+	return len(roles) == 1 && roles[0] == "master"
+}
+
+// nodeHost returns the host and port of the HTTP publish address of a node,
+// given as ip:port or hostname/ip:port. The hostname is preferred, for the
+// certificates of the nodes to be verified.
+func nodeHost(address string) (string, error) {
+	if i := strings.Index(address, "/"); i >= 0 {
+		hostname := address[:i]
+		_, port, err := net.SplitHostPort(address[i+1:])
+		if err != nil {
+			return "", err
+		}
+		if hostname == "" {
+			return address[i+1:], nil
+		}
+		return net.JoinHostPort(hostname, port), nil
+	}
+
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return "", err
+	}
+	return address, nil
+}
+
+func equalHosts(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,285 @@
+// +build !integration
+
+package elasticsearch
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/outputs"
+	"github.com/elastic/beats/libbeat/outputs/mode"
+	"github.com/elastic/beats/libbeat/outputs/outil"
+)
+
+func TestNodeHost(t *testing.T) {
+	tests := []struct {
+		address, host string
+	}{
+		{"10.0.0.1:9200", "10.0.0.1:9200"},
+		{"es1.example.com/10.0.0.1:9200", "es1.example.com:9200"},
+		{"/10.0.0.1:9200", "10.0.0.1:9200"},
+		{"[::1]:9200", "[::1]:9200"},
+	}
+	for _, test := range tests {
+		host, err := nodeHost(test.address)
+		assert.NoError(t, err, test.address)
+		assert.Equal(t, test.host, host)
+	}
+
+	for _, address := range []string{"", "10.0.0.1", "inet[/10.0.0.1:9200]"} {
+		_, err := nodeHost(address)
+		assert.Error(t, err, address)
+	}
+}
+
+func TestSniffConfigValidate(t *testing.T) {
+	assert.NoError(t, (&sniffConfig{Include: []string{"^hot-"}}).Validate())
+	assert.Error(t, (&sniffConfig{Exclude: []string{"("}}).Validate())
+}
+
+// clusterMock serves the ping and the nodes info of a cluster, listing the
+// nodes set.
+type clusterMock struct {
+	sync.Mutex
+	servers []*httptest.Server
+	nodes   string
+}
+
+func newClusterMock(n int) *clusterMock {
+	c := &clusterMock{}
+	for i := 0; i < n; i++ {
+		c.servers = append(c.servers, httptest.NewServer(http.HandlerFunc(c.serve)))
+	}
+	return c
+}
+
+func (c *clusterMock) serve(w http.ResponseWriter, r *http.Request) {
+	c.Lock()
+	defer c.Unlock()
+	switch r.URL.Path {
+	case "/":
+		w.Write([]byte(`{"version":{"number":"5.0.0"}}`))
+	case "/_nodes/http":
+		w.Write([]byte(c.nodes))
+	default:
+		w.WriteHeader(404)
+	}
+}
+
+func (c *clusterMock) address(i int) string {
+	return strings.TrimPrefix(c.servers[i].URL, "http://")
+}
+
+// setNodes lists the nodes i as data nodes, named node-i, and a dedicated
+// master node.
+func (c *clusterMock) setNodes(nodes ...int) {
+	var entries []string
+	for _, i := range nodes {
+		entries = append(entries, fmt.Sprintf(
+			`"id%d":{"name":"node-%d","roles":["data","ingest"],"http":{"publish_address":"%s"}}`,
+			i, i, c.address(i)))
+	}
+	entries = append(entries,
+		`"master":{"name":"master","roles":["master"],"http":{"publish_address":"10.0.0.1:9200"}}`)
+
+	c.Lock()
+	c.nodes = `{"nodes":{` + strings.Join(entries, ",") + `}}`
+	c.Unlock()
+}
+
+func (c *clusterMock) Close() {
+	for _, server := range c.servers {
+		server.Close()
+	}
+}
+
+func newTestPool(t *testing.T, seed string, config sniffConfig) *nodePool {
+	newClient := func(host string) (mode.ProtocolClient, error) {
+		return NewClient(ClientSettings{
+			URL:     host,
+			Index:   outil.MakeSelector(),
+			Timeout: time.Second,
+		}, nil)
+	}
+	if config.Interval == 0 {
+		config.Interval = time.Hour
+	}
+	pool, err := newNodePool([]string{seed}, newClient, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+func TestNodePoolSniff(t *testing.T) {
+	cluster := newClusterMock(3)
+	defer cluster.Close()
+	cluster.setNodes(0, 1, 2)
+
+	pool := newTestPool(t, cluster.servers[0].URL, sniffConfig{})
+	defer pool.Close()
+
+	if err := pool.Connect(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	urls := []string{cluster.servers[0].URL, cluster.servers[1].URL, cluster.servers[2].URL}
+	sort.Strings(urls)
+	assert.Equal(t, urls, pool.hosts)
+	assert.Equal(t, 3, pool.active())
+
+	// not sniffed before the interval
+	cluster.setNodes(1)
+	pool.sniffIfDue()
+	assert.Len(t, pool.hosts, 3)
+
+	pool.nextSniff = time.Time{}
+	pool.sniffIfDue()
+	assert.Equal(t, []string{cluster.servers[1].URL}, pool.hosts)
+	assert.Equal(t, 1, pool.active())
+}
+
+func TestNodePoolFilters(t *testing.T) {
+	cluster := newClusterMock(3)
+	defer cluster.Close()
+	cluster.setNodes(0, 1, 2)
+
+	pool := newTestPool(t, cluster.servers[0].URL, sniffConfig{
+		Include: []string{"^node-[01]$"},
+		Exclude: []string{cluster.address(0)},
+	})
+	defer pool.Close()
+
+	if err := pool.Connect(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{cluster.servers[1].URL}, pool.hosts)
+
+	// no node matching, the nodes are kept
+	pool.include, _ = compilePatterns([]string{"^cold-"})
+	pool.nextSniff = time.Time{}
+	pool.sniffIfDue()
+	assert.Equal(t, []string{cluster.servers[1].URL}, pool.hosts)
+}
+
+func TestNodePoolFallbackToSeeds(t *testing.T) {
+	cluster := newClusterMock(2)
+	defer cluster.Close()
+	cluster.setNodes(1)
+
+	pool := newTestPool(t, cluster.servers[0].URL, sniffConfig{})
+	defer pool.Close()
+
+	if err := pool.Connect(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{cluster.servers[1].URL}, pool.hosts)
+
+	// the sniffed node is gone, the seed is connected again
+	cluster.servers[1].Close()
+	pool.Close()
+	if err := pool.Connect(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{cluster.servers[0].URL}, pool.hosts)
+}
+
+func TestNodePoolSendFailover(t *testing.T) {
+	failing := &mockNode{err: fmt.Errorf("connection reset")}
+	working := &mockNode{}
+	pool := &nodePool{
+		hosts:     []string{"a", "b"},
+		nodes:     []mode.ProtocolClient{failing, working},
+		connected: []bool{true, true},
+		last:      1,
+		nextSniff: time.Now().Add(time.Hour),
+	}
+
+	err := pool.PublishEvent(testData())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, failing.published)
+	assert.Equal(t, 1, working.published)
+	assert.Equal(t, []bool{false, true}, pool.connected)
+
+	err = pool.PublishEvent(testData())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, working.published)
+
+	working.err = fmt.Errorf("timeout")
+	err = pool.PublishEvent(testData())
+	assert.Error(t, err)
+	assert.Equal(t, 0, pool.active())
+}
+
+func TestNodePoolSendThrottled(t *testing.T) {
+	throttled := &mockNode{err: mode.ErrTempBulkFailure}
+	other := &mockNode{}
+	pool := &nodePool{
+		hosts:     []string{"a", "b"},
+		nodes:     []mode.ProtocolClient{throttled, other},
+		connected: []bool{true, true},
+		last:      1,
+		nextSniff: time.Now().Add(time.Hour),
+	}
+
+	// the error is returned without failing over, keeping the node
+	err := pool.PublishEvent(testData())
+	assert.Equal(t, mode.ErrTempBulkFailure, err)
+	assert.Equal(t, 1, throttled.published)
+	assert.Equal(t, 0, other.published)
+	assert.Equal(t, []bool{true, true}, pool.connected)
+}
+
+func TestNodePoolSniffKeepsClientTimeout(t *testing.T) {
+	cluster := newClusterMock(1)
+	defer cluster.Close()
+	cluster.setNodes(0)
+
+	pool := newTestPool(t, cluster.servers[0].URL, sniffConfig{})
+	defer pool.Close()
+
+	if err := pool.Connect(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	client := pool.nodes[0].(*Client)
+	client.http.Timeout = time.Minute
+
+	hosts, err := pool.sniff(client)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{cluster.servers[0].URL}, hosts)
+	assert.Equal(t, time.Minute, client.http.Timeout)
+}
+
+// mockNode counts the events published, failing with err if set.
+type mockNode struct {
+	err       error
+	published int
+}
+
+func (m *mockNode) Connect(time.Duration) error { return nil }
+func (m *mockNode) Close() error                { return nil }
+
+func (m *mockNode) PublishEvents(data []outputs.Data) ([]outputs.Data, error) {
+	m.published++
+	if m.err != nil {
+		return data, m.err
+	}
+	return nil, nil
+}
+
+func (m *mockNode) PublishEvent(data outputs.Data) error {
+	m.published++
+	return m.err
+}
+
+func testData() outputs.Data {
+	return outputs.Data{Event: common.MapStr{"type": "fix"}}
+}
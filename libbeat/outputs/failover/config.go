@@ -0,0 +1,28 @@
+package failover
+
+import (
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+type config struct {
+	// single output used while it is reachable
+	Primary map[string]*common.Config `config:"primary" validate:"required"`
+
+	// single output used while the primary is down
+	Secondary map[string]*common.Config `config:"secondary" validate:"required"`
+
+	// time spent on the secondary before the primary is checked again
+	FailbackInterval time.Duration `config:"failback_interval" validate:"min=0"`
+
+	// timeout of the connection test run before failing back
+	Timeout time.Duration `config:"timeout" validate:"min=0"`
+}
+
+var (
+	defaultConfig = config{
+		FailbackInterval: 30 * time.Second,
+		Timeout:          5 * time.Second,
+	}
+)
@@ -0,0 +1,236 @@
+package failover
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/common/op"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/monitoring"
+	"github.com/elastic/beats/libbeat/outputs"
+)
+
+func init() {
+	outputs.RegisterOutputPlugin("failover", New)
+}
+
+var debugf = logp.MakeDebug("failover")
+
+var (
+	failovers       = expvar.NewInt("libbeat.failover.failovers")
+	failbacks       = expvar.NewInt("libbeat.failover.failbacks")
+	secondaryActive = expvar.NewInt("libbeat.failover.secondary_active")
+)
+
+func init() {
+	monitoring.SetGauge("libbeat.failover.secondary_active")
+}
+
+var errNoTopology = errors.New("primary output does not support topology")
+
+// failover publishes the events to the primary output, switching to the
+// secondary output once the primary failed publishing a batch after all its
+// retries. The primary is used again once it is reachable, checked every
+// failback interval.
+type failover struct {
+	primary, secondary         outputs.BulkOutputer
+	primaryName, secondaryName string
+
+	failbackInterval time.Duration
+	timeout          time.Duration
+
+	mutex     sync.Mutex
+	onPrimary bool
+	failedAt  time.Time
+	probing   bool
+}
+
+// New creates the failover output from the configurations of its primary and
+// secondary outputs.
+func New(beatName string, cfg *common.Config, topologyExpire int) (outputs.Outputer, error) {
+	config := defaultConfig
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, err
+	}
+
+	primaryName, primary, err := newOutput("primary", beatName, config.Primary, topologyExpire)
+	if err != nil {
+		return nil, err
+	}
+	secondaryName, secondary, err := newOutput("secondary", beatName, config.Secondary, topologyExpire)
+	if err != nil {
+		primary.Close()
+		return nil, err
+	}
+
+	logp.Info("Failover output using %s as primary and %s as secondary", primaryName, secondaryName)
+	secondaryActive.Set(0)
+	return &failover{
+		primary:          outputs.CastBulkOutputer(primary),
+		secondary:        outputs.CastBulkOutputer(secondary),
+		primaryName:      primaryName,
+		secondaryName:    secondaryName,
+		failbackInterval: config.FailbackInterval,
+		timeout:          config.Timeout,
+		onPrimary:        true,
+	}, nil
+}
+
+// newOutput creates the single output enabled in configs.
+func newOutput(
+	role, beatName string,
+	configs map[string]*common.Config,
+	topologyExpire int,
+) (string, outputs.Outputer, error) {
+	var name string
+	var config *common.Config
+	for outName, outConfig := range configs {
+		if !outConfig.Enabled() {
+			continue
+		}
+		if config != nil {
+			return "", nil, fmt.Errorf("failover %s must configure a single output, got %s and %s",
+				role, name, outName)
+		}
+		name, config = outName, outConfig
+	}
+	if config == nil {
+		return "", nil, fmt.Errorf("failover %s output missing", role)
+	}
+
+	builder := outputs.FindOutputPlugin(name)
+	if builder == nil || name == "failover" {
+		return "", nil, fmt.Errorf("failover %s: unknown output type %s", role, name)
+	}
+	out, err := builder(beatName, config, topologyExpire)
+	if err != nil {
+		return "", nil, fmt.Errorf("failover %s: failed to initialize %s output: %v", role, name, err)
+	}
+	return name, out, nil
+}
+
+func (f *failover) Close() error {
+	err := f.primary.Close()
+	if err2 := f.secondary.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+func (f *failover) PublishEvent(sig op.Signaler, opts outputs.Options, data outputs.Data) error {
+	return f.BulkPublish(sig, opts, []outputs.Data{data})
+}
+
+// BulkPublish publishes the batch to the active output. Batches are published
+// to the primary as not guaranteed, for the primary to give up after its
+// retries, the batch being published to the secondary instead.
+func (f *failover) BulkPublish(sig op.Signaler, opts outputs.Options, data []outputs.Data) error {
+	if !f.usePrimary() {
+		return f.secondary.BulkPublish(sig, opts, data)
+	}
+
+	batch := make([]outputs.Data, len(data))
+	copy(batch, data)
+	fallback := op.SignalCallback(func(resp op.SignalResponse) {
+		if resp != op.SignalFailed {
+			resp.Apply(sig)
+			return
+		}
+		f.primaryFailed()
+		if err := f.secondary.BulkPublish(sig, opts, batch); err != nil {
+			logp.Err("Failover to %s failed: %v", f.secondaryName, err)
+		}
+	})
+	return f.primary.BulkPublish(fallback, outputs.Options{Guaranteed: false}, data)
+}
+
+// usePrimary returns true while the primary is active. Once the failback
+// interval has elapsed, the primary is checked in the background, the
+// secondary being used in the meantime.
+func (f *failover) usePrimary() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.onPrimary {
+		return true
+	}
+	if !f.probing && time.Since(f.failedAt) >= f.failbackInterval {
+		f.probing = true
+		go f.probe()
+	}
+	return false
+}
+
+func (f *failover) primaryFailed() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.failedAt = time.Now()
+	if !f.onPrimary {
+		return
+	}
+	logp.Warn("Primary output %s failed, failing over to %s", f.primaryName, f.secondaryName)
+	f.onPrimary = false
+	failovers.Add(1)
+	secondaryActive.Set(1)
+}
+
+// probe fails back to the primary if it is reachable. Outputs not supporting
+// connection tests are used again blindly, failing over again if they are
+// still down.
+func (f *failover) probe() {
+	tested, err := outputs.TestOutput(f.primary, f.timeout)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.probing = false
+	if tested && err != nil {
+		debugf("Primary output %s still down: %v", f.primaryName, err)
+		f.failedAt = time.Now()
+		return
+	}
+	logp.Info("Failing back to primary output %s", f.primaryName)
+	f.onPrimary = true
+	failbacks.Add(1)
+	secondaryActive.Set(0)
+}
+
+// TestConnection checks both outputs are reachable, the secondary being
+// useless for disaster recovery if it is not.
+func (f *failover) TestConnection(timeout time.Duration) error {
+	if _, err := outputs.TestOutput(f.primary, timeout); err != nil {
+		return fmt.Errorf("primary %s: %v", f.primaryName, err)
+	}
+	if _, err := outputs.TestOutput(f.secondary, timeout); err != nil {
+		return fmt.Errorf("secondary %s: %v", f.secondaryName, err)
+	}
+	return nil
+}
+
+// PublishIPs stores the topology through the primary output.
+func (f *failover) PublishIPs(name string, localAddrs []string) error {
+	topo, ok := f.primaryOutputer().(outputs.TopologyOutputer)
+	if !ok {
+		return errNoTopology
+	}
+	return topo.PublishIPs(name, localAddrs)
+}
+
+func (f *failover) GetNameByIP(ip string) string {
+	topo, ok := f.primaryOutputer().(outputs.TopologyOutputer)
+	if !ok {
+		return ""
+	}
+	return topo.GetNameByIP(ip)
+}
+
+// primaryOutputer returns the primary output as created by its plugin,
+// CastBulkOutputer having wrapped it if it does not support batches.
+func (f *failover) primaryOutputer() outputs.Outputer {
+	return outputs.UnwrapBulkOutputer(f.primary)
+}
@@ -0,0 +1,222 @@
+// +build !integration
+
+package failover
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/common/op"
+	"github.com/elastic/beats/libbeat/outputs"
+)
+
+// mockOutput records the batches published, failing them while down.
+type mockOutput struct {
+	mutex   sync.Mutex
+	down    bool
+	testErr error
+	batches [][]outputs.Data
+	opts    []outputs.Options
+	closed  bool
+}
+
+func (m *mockOutput) PublishEvent(sig op.Signaler, opts outputs.Options, data outputs.Data) error {
+	return m.BulkPublish(sig, opts, []outputs.Data{data})
+}
+
+func (m *mockOutput) BulkPublish(sig op.Signaler, opts outputs.Options, data []outputs.Data) error {
+	m.mutex.Lock()
+	down := m.down
+	if !down {
+		m.batches = append(m.batches, data)
+	}
+	m.opts = append(m.opts, opts)
+	m.mutex.Unlock()
+
+	if down {
+		op.SigFailed(sig, errors.New("down"))
+	} else {
+		op.SigCompleted(sig)
+	}
+	return nil
+}
+
+func (m *mockOutput) TestConnection(timeout time.Duration) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.testErr
+}
+
+func (m *mockOutput) Close() error {
+	m.closed = true
+	return nil
+}
+
+func (m *mockOutput) published() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.batches)
+}
+
+func (m *mockOutput) setDown(down bool, testErr error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.down, m.testErr = down, testErr
+}
+
+func newTestFailover(primary, secondary *mockOutput, interval time.Duration) *failover {
+	return &failover{
+		primary:          primary,
+		secondary:        secondary,
+		primaryName:      "primary",
+		secondaryName:    "secondary",
+		failbackInterval: interval,
+		timeout:          time.Second,
+		onPrimary:        true,
+	}
+}
+
+func publish(t *testing.T, f *failover, opts outputs.Options) op.SignalResponse {
+	sig := op.NewSignalChannel()
+	data := []outputs.Data{{Event: common.MapStr{"type": "test"}}}
+	assert.NoError(t, f.BulkPublish(sig, opts, data))
+	return sig.Wait()
+}
+
+func waitOnPrimary(t *testing.T, f *failover) {
+	for i := 0; i < 100; i++ {
+		f.mutex.Lock()
+		onPrimary := f.onPrimary
+		f.mutex.Unlock()
+		if onPrimary {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("failover did not fail back to the primary")
+}
+
+func TestFailoverUsesPrimary(t *testing.T) {
+	primary, secondary := &mockOutput{}, &mockOutput{}
+	f := newTestFailover(primary, secondary, time.Hour)
+
+	assert.Equal(t, op.SignalCompleted, publish(t, f, outputs.Options{Guaranteed: true}))
+	assert.Equal(t, 1, primary.published())
+	assert.Equal(t, 0, secondary.published())
+
+	// the primary must give up for the batch to fail over
+	assert.False(t, primary.opts[0].Guaranteed)
+}
+
+func TestFailoverPublishesFailedBatchToSecondary(t *testing.T) {
+	primary, secondary := &mockOutput{down: true}, &mockOutput{}
+	f := newTestFailover(primary, secondary, time.Hour)
+
+	failed := failovers.Value()
+	assert.Equal(t, op.SignalCompleted, publish(t, f, outputs.Options{Guaranteed: true}))
+	assert.Equal(t, 1, secondary.published())
+	assert.True(t, secondary.opts[0].Guaranteed)
+	assert.Equal(t, failed+1, failovers.Value())
+	assert.Equal(t, int64(1), secondaryActive.Value())
+
+	// the secondary stays active until the failback interval elapsed
+	primary.setDown(false, nil)
+	assert.Equal(t, op.SignalCompleted, publish(t, f, outputs.Options{}))
+	assert.Equal(t, 2, secondary.published())
+	assert.Equal(t, 0, primary.published())
+}
+
+func TestFailoverSecondaryFailure(t *testing.T) {
+	primary, secondary := &mockOutput{down: true}, &mockOutput{down: true}
+	f := newTestFailover(primary, secondary, time.Hour)
+
+	assert.Equal(t, op.SignalFailed, publish(t, f, outputs.Options{}))
+}
+
+func TestFailoverFailsBack(t *testing.T) {
+	primary, secondary := &mockOutput{down: true, testErr: errors.New("down")}, &mockOutput{}
+	f := newTestFailover(primary, secondary, 0)
+
+	publish(t, f, outputs.Options{})
+	assert.False(t, f.onPrimary)
+
+	// the primary is still unreachable, keeping the secondary active
+	publish(t, f, outputs.Options{})
+	time.Sleep(20 * time.Millisecond)
+	f.mutex.Lock()
+	assert.False(t, f.onPrimary)
+	f.mutex.Unlock()
+
+	failedBack := failbacks.Value()
+	primary.setDown(false, nil)
+	publish(t, f, outputs.Options{})
+	waitOnPrimary(t, f)
+	assert.Equal(t, failedBack+1, failbacks.Value())
+	assert.Equal(t, int64(0), secondaryActive.Value())
+
+	publish(t, f, outputs.Options{})
+	assert.Equal(t, 1, primary.published())
+	assert.Equal(t, 3, secondary.published())
+}
+
+func TestFailoverTestConnection(t *testing.T) {
+	primary, secondary := &mockOutput{}, &mockOutput{}
+	f := newTestFailover(primary, secondary, time.Hour)
+	assert.NoError(t, f.TestConnection(time.Second))
+
+	secondary.setDown(true, errors.New("unreachable"))
+	assert.Error(t, f.TestConnection(time.Second))
+}
+
+func TestFailoverTopologyNotSupported(t *testing.T) {
+	f := newTestFailover(&mockOutput{}, &mockOutput{}, time.Hour)
+	assert.Equal(t, errNoTopology, f.PublishIPs("beat", nil))
+	assert.Equal(t, "", f.GetNameByIP("10.0.0.1"))
+}
+
+func TestFailoverConfig(t *testing.T) {
+	outputs.RegisterOutputPlugin("failover_mock", func(string, *common.Config, int) (outputs.Outputer, error) {
+		return &mockOutput{}, nil
+	})
+
+	newFailover := func(settings map[string]interface{}) (outputs.Outputer, error) {
+		cfg, err := common.NewConfigFrom(settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return New("test", cfg, 0)
+	}
+
+	out, err := newFailover(map[string]interface{}{
+		"primary.failover_mock":   map[string]interface{}{},
+		"secondary.failover_mock": map[string]interface{}{},
+		"failback_interval":       "10s",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Second, out.(*failover).failbackInterval)
+	assert.NoError(t, out.Close())
+
+	_, err = newFailover(map[string]interface{}{
+		"primary.failover_mock": map[string]interface{}{},
+	})
+	assert.Error(t, err)
+
+	_, err = newFailover(map[string]interface{}{
+		"primary.failover_mock":   map[string]interface{}{},
+		"secondary.unknown":       map[string]interface{}{},
+		"secondary.failover_mock": map[string]interface{}{"enabled": false},
+	})
+	assert.Error(t, err)
+
+	_, err = newFailover(map[string]interface{}{
+		"primary.failover_mock":   map[string]interface{}{},
+		"secondary.failover_mock": map[string]interface{}{},
+		"secondary.other_mock":    map[string]interface{}{},
+	})
+	assert.Error(t, err)
+}
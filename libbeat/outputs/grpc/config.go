@@ -0,0 +1,15 @@
+package grpc
+
+type config struct {
+	Host          string   `config:"host" validate:"required"`
+	QueueSize     int      `config:"client_queue_size" validate:"min=1"`
+	SessionFields []string `config:"session_fields"`
+}
+
+var (
+	defaultConfig = config{
+		Host:          "localhost:50051",
+		QueueSize:     1000,
+		SessionFields: []string{"fix.session_name", "fix.session_key"},
+	}
+)
@@ -0,0 +1,514 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/common/op"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/outputs"
+)
+
+// grpcOut serves the Events gRPC service of events.proto, streaming the
+// events published to the clients subscribed. gRPC runs on HTTP/2 without
+// TLS. Events are dropped for the clients not keeping up, once
+// client_queue_size events are queued for them.
+type grpcOut struct {
+	queueSize     int
+	sessionFields []string
+	listener      net.Listener
+	server        *http2.Server
+	done          chan struct{}
+
+	mutex   sync.Mutex
+	clients map[*client]struct{}
+	conns   map[*trackedConn]struct{}
+	closed  bool
+	wg      sync.WaitGroup
+	streams sync.WaitGroup
+
+	// signaled when a connection has written the frames ending its streams
+	settledCh chan struct{}
+}
+
+// trackedConn is a connection served. Once streams have been ended by the
+// shutdown, it is settled when it has no open stream and the frames ending
+// the streams have been written.
+type trackedConn struct {
+	net.Conn
+	settledCh chan<- struct{}
+
+	mutex   sync.Mutex
+	idle    bool
+	ending  bool
+	settled bool
+}
+
+// client is a call of Subscribe.
+type client struct {
+	filters  []fieldFilter
+	fields   []string
+	sessions map[string]bool
+	out      chan []byte
+}
+
+// gRPC status codes, see
+// https://github.com/grpc/grpc/blob/master/doc/statuscodes.md.
+const (
+	codeInvalidArgument = 3
+	codeUnimplemented   = 12
+	codeUnavailable     = 14
+)
+
+const (
+	subscribePath = "/beats.events.Events/Subscribe"
+	closeTimeout  = time.Second
+)
+
+var debugf = logp.MakeDebug("grpc")
+
+// Metrics that can retrieved through the expvar web interface.
+var (
+	statClients   = expvar.NewInt("libbeat.grpc.clients")
+	statPublished = expvar.NewInt("libbeat.grpc.published_events")
+	statDropped   = expvar.NewInt("libbeat.grpc.dropped_events")
+)
+
+func init() {
+	outputs.RegisterOutputPlugin("grpc", New)
+}
+
+// New starts the gRPC server streaming the events.
+func New(_ string, cfg *common.Config, _ int) (outputs.Outputer, error) {
+	config := defaultConfig
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", config.Host)
+	if err != nil {
+		return nil, err
+	}
+	logp.Info("gRPC output serving on %v", listener.Addr())
+
+	out := &grpcOut{
+		queueSize:     config.QueueSize,
+		sessionFields: config.SessionFields,
+		listener:      listener,
+		server:        &http2.Server{},
+		done:          make(chan struct{}),
+		clients:       map[*client]struct{}{},
+		conns:         map[*trackedConn]struct{}{},
+		settledCh:     make(chan struct{}, 1),
+	}
+	out.wg.Add(1)
+	go out.accept()
+	return out, nil
+}
+
+func (out *grpcOut) accept() {
+	defer out.wg.Done()
+	for {
+		conn, err := out.listener.Accept()
+		if err != nil {
+			out.mutex.Lock()
+			closed := out.closed
+			out.mutex.Unlock()
+			if closed {
+				return
+			}
+			logp.Err("gRPC output failed to accept connection: %v", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		out.mutex.Lock()
+		if out.closed {
+			out.mutex.Unlock()
+			conn.Close()
+			return
+		}
+		tracked := &trackedConn{Conn: conn, settledCh: out.settledCh}
+		out.conns[tracked] = struct{}{}
+		out.mutex.Unlock()
+
+		out.wg.Add(1)
+		go func() {
+			defer out.wg.Done()
+
+			// the streams of the connection end once it is closed, a stream
+			// reset by the client ending on the next write
+			connDone := make(chan struct{})
+			defer close(connDone)
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				out.serve(w, r, tracked, connDone)
+			})
+
+			// gRPC clients talk HTTP/2 with prior knowledge
+			out.server.ServeConn(tracked, &http2.ServeConnOpts{
+				Handler:    handler,
+				BaseConfig: &http.Server{ConnState: connState},
+			})
+
+			out.mutex.Lock()
+			delete(out.conns, tracked)
+			out.mutex.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// connState follows the streams of a connection, which is idle once it has
+// no open stream.
+func connState(conn net.Conn, state http.ConnState) {
+	c, ok := conn.(*trackedConn)
+	if !ok {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.idle = state == http.StateIdle
+	c.settled = false
+}
+
+// Write writes to the connection. The connection is settled by the first
+// write once idle, the buffered frames ending the stream being flushed after
+// the stream has been closed.
+func (c *trackedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.idle && !c.settled {
+		c.settled = true
+		select {
+		case c.settledCh <- struct{}{}:
+		default:
+		}
+	}
+	return n, err
+}
+
+// endStream notes a stream is ended by the shutdown, its trailers to be
+// written before the connection is closed.
+func (c *trackedConn) endStream() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.ending = true
+}
+
+func (c *trackedConn) isSettled() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return !c.ending || c.settled
+}
+
+func (out *grpcOut) serve(
+	w http.ResponseWriter,
+	r *http.Request,
+	conn *trackedConn,
+	connDone <-chan struct{},
+) {
+	if r.Method != "POST" || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC requests only", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	if r.URL.Path != subscribePath {
+		writeStatus(w, codeUnimplemented, "unknown method "+r.URL.Path)
+		return
+	}
+
+	msg, err := readMessage(r.Body, maxRequest)
+	var req subscribeRequest
+	if err == nil {
+		err = req.unmarshal(msg)
+	}
+	if err != nil {
+		writeStatus(w, codeInvalidArgument, err.Error())
+		return
+	}
+
+	c := &client{
+		filters: req.filters,
+		fields:  req.fields,
+		out:     make(chan []byte, out.queueSize),
+	}
+	if len(req.sessions) > 0 {
+		c.sessions = map[string]bool{}
+		for _, s := range req.sessions {
+			c.sessions[s] = true
+		}
+	}
+	if !out.add(c) {
+		conn.endStream()
+		writeStatus(w, codeUnavailable, "shutting down")
+		return
+	}
+	defer out.remove(c)
+	debugf("client %v subscribed", r.RemoteAddr)
+
+	// the client is unsubscribed as soon as it cancels the call. The http2
+	// server does not cancel the context of the requests reset by the
+	// client, signaling their end by CloseNotify instead.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	if notifier, ok := w.(http.CloseNotifier); ok {
+		closed := notifier.CloseNotify()
+		go func() {
+			select {
+			case <-closed:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case <-connDone:
+			debugf("client %v disconnected", r.RemoteAddr)
+			return
+		case <-ctx.Done():
+			debugf("client %v cancelled", r.RemoteAddr)
+			return
+		case <-out.done:
+			conn.endStream()
+			writeStatus(w, codeUnavailable, "shutting down")
+			return
+		case frame := <-c.out:
+			if _, err := w.Write(frame); err != nil {
+				debugf("client %v cancelled: %v", r.RemoteAddr, err)
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// writeStatus sets the status of the call, sent in the trailers.
+func writeStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set("Grpc-Message", message)
+	}
+}
+
+func (out *grpcOut) add(c *client) bool {
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+	if out.closed {
+		return false
+	}
+	out.clients[c] = struct{}{}
+	out.streams.Add(1)
+	statClients.Add(1)
+	return true
+}
+
+func (out *grpcOut) remove(c *client) {
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+	if _, ok := out.clients[c]; ok {
+		delete(out.clients, c)
+		out.streams.Done()
+		statClients.Add(-1)
+	}
+}
+
+// matches checks the event matches the sessions and the filters of the
+// client.
+func (c *client) matches(event common.MapStr, sessionFields []string) bool {
+	if c.sessions != nil {
+		found := false
+		for _, field := range sessionFields {
+			if v, err := event.GetValue(field); err == nil && c.sessions[fmt.Sprint(v)] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	for _, f := range c.filters {
+		v, err := event.GetValue(f.field)
+		if err != nil {
+			return false
+		}
+		s := fmt.Sprint(v)
+		matched := false
+		for _, value := range f.values {
+			if s == value {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// project returns the fields of the event the client subscribed to.
+func (c *client) project(event common.MapStr) common.MapStr {
+	if len(c.fields) == 0 {
+		return event
+	}
+	projected := common.MapStr{}
+	for _, key := range append([]string{"@timestamp", "type"}, c.fields...) {
+		// fields missing in the event are left out
+		event.CopyFieldsTo(projected, key)
+	}
+	return projected
+}
+
+// publish queues the event for the clients it matches.
+func (out *grpcOut) publish(data outputs.Data) {
+	event := data.Event
+	msg := eventMsg{}
+	if typ, ok := event["type"].(string); ok {
+		msg.typ = typ
+	}
+	if ts, ok := event["@timestamp"].(common.Time); ok {
+		msg.timestampUnixNano = time.Time(ts).UnixNano()
+	}
+
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+
+	// the event is encoded once for the clients streaming all fields
+	var all []byte
+	for c := range out.clients {
+		if !c.matches(event, out.sessionFields) {
+			continue
+		}
+
+		frame := all
+		if frame == nil || len(c.fields) > 0 {
+			encoded, err := json.Marshal(c.project(event))
+			if err != nil {
+				logp.Err("Failed to convert the event to JSON (%v): %#v", err, event)
+				continue
+			}
+			msg.json = encoded
+			frame = frameMessage(msg.marshal())
+			if len(c.fields) == 0 {
+				all = frame
+			}
+		}
+
+		select {
+		case c.out <- frame:
+		default:
+			statDropped.Add(1)
+		}
+	}
+	statPublished.Add(1)
+}
+
+// Implement Outputer
+func (out *grpcOut) Close() error {
+	out.mutex.Lock()
+	if out.closed {
+		out.mutex.Unlock()
+		return nil
+	}
+	out.closed = true
+	close(out.done)
+	err := out.listener.Close()
+	out.mutex.Unlock()
+
+	// the streams end with the UNAVAILABLE status before the connections are
+	// closed, unless blocked by clients not reading. The trailers are sent
+	// once the handlers returned, the connections being closed once they
+	// have been written.
+	deadline := time.After(closeTimeout)
+	ended := make(chan struct{})
+	go func() {
+		out.streams.Wait()
+		close(ended)
+	}()
+	select {
+	case <-ended:
+		out.waitSettled(deadline)
+	case <-deadline:
+	}
+
+	out.mutex.Lock()
+	for conn := range out.conns {
+		conn.Close()
+	}
+	out.mutex.Unlock()
+
+	out.wg.Wait()
+	return err
+}
+
+// waitSettled waits until all connections are settled, or until deadline.
+func (out *grpcOut) waitSettled(deadline <-chan time.Time) {
+	for !out.settled() {
+		select {
+		case <-out.settledCh:
+		case <-deadline:
+			debugf("closing connections with streams still ending")
+			return
+		}
+	}
+}
+
+func (out *grpcOut) settled() bool {
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+	for conn := range out.conns {
+		if !conn.isSettled() {
+			return false
+		}
+	}
+	return true
+}
+
+func (out *grpcOut) PublishEvent(
+	sig op.Signaler,
+	opts outputs.Options,
+	data outputs.Data,
+) error {
+	out.publish(data)
+	op.SigCompleted(sig)
+	return nil
+}
+
+func (out *grpcOut) BulkPublish(
+	sig op.Signaler,
+	opts outputs.Options,
+	data []outputs.Data,
+) error {
+	for _, d := range data {
+		out.publish(d)
+	}
+	op.SigCompleted(sig)
+	return nil
+}
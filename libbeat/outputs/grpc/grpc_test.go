@@ -0,0 +1,210 @@
+//go:build !integration
+// +build !integration
+
+package grpc
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/outputs"
+)
+
+func newTestOutput(t *testing.T) *grpcOut {
+	cfg, err := common.NewConfigFrom(map[string]interface{}{
+		"host": "127.0.0.1:0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := New("testbeat", cfg, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.(*grpcOut)
+}
+
+func (r *subscribeRequest) marshal() []byte {
+	var b []byte
+	for _, f := range r.filters {
+		var filter []byte
+		filter = appendBytes(filter, 1, []byte(f.field))
+		for _, v := range f.values {
+			filter = appendBytes(filter, 2, []byte(v))
+		}
+		b = appendBytes(b, 1, filter)
+	}
+	for _, f := range r.fields {
+		b = appendBytes(b, 2, []byte(f))
+	}
+	for _, s := range r.sessions {
+		b = appendBytes(b, 3, []byte(s))
+	}
+	return b
+}
+
+func (e *eventMsg) unmarshal(b []byte) error {
+	return readFields(b, func(field, wireType int, value []byte) error {
+		switch field {
+		case 1:
+			e.json = value
+		case 2:
+			e.typ = string(value)
+		case 3:
+			v, _, err := readVarint(value)
+			e.timestampUnixNano = int64(v)
+			return err
+		}
+		return nil
+	})
+}
+
+// subscribe calls Subscribe over HTTP/2 without TLS.
+func subscribe(t *testing.T, out *grpcOut, path string, req subscribeRequest) *http.Response {
+	transport := &http2.Transport{
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}
+	httpReq, err := http.NewRequest("POST", "https://"+out.listener.Addr().String()+path,
+		bytes.NewReader(frameMessage(req.marshal())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpReq.Header.Set("Content-Type", "application/grpc")
+	resp, err := transport.RoundTrip(httpReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// waitClients waits for the calls of Subscribe to reach the output.
+func waitClients(t *testing.T, out *grpcOut, n int) {
+	for i := 0; i < 500; i++ {
+		out.mutex.Lock()
+		clients := len(out.clients)
+		out.mutex.Unlock()
+		if clients == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("clients not subscribed")
+}
+
+func readEvent(t *testing.T, r io.Reader) (eventMsg, common.MapStr) {
+	msg, err := readMessage(r, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e eventMsg
+	assert.NoError(t, e.unmarshal(msg))
+	var event common.MapStr
+	assert.NoError(t, json.Unmarshal(e.json, &event))
+	return e, event
+}
+
+func event(session, msgType, id string) outputs.Data {
+	return outputs.Data{Event: common.MapStr{
+		"@timestamp": common.Time(time.Unix(1476435600, 5)),
+		"type":       "fix",
+		"id":         id,
+		"fix":        common.MapStr{"session_name": session, "MsgType": msgType},
+	}}
+}
+
+func TestSubscribe(t *testing.T) {
+	out := newTestOutput(t)
+	defer out.Close()
+
+	all := subscribe(t, out, subscribePath, subscribeRequest{})
+	defer all.Body.Close()
+	lse := subscribe(t, out, subscribePath, subscribeRequest{
+		sessions: []string{"lse"},
+		filters:  []fieldFilter{{field: "fix.MsgType", values: []string{"8", "9"}}},
+		fields:   []string{"fix.MsgType"},
+	})
+	defer lse.Body.Close()
+	assert.Equal(t, "application/grpc", lse.Header.Get("Content-Type"))
+	waitClients(t, out, 2)
+
+	assert.NoError(t, out.BulkPublish(nil, outputs.Options{}, []outputs.Data{
+		event("lse", "D", "1"),
+		event("ice", "8", "2"),
+		event("lse", "8", "3"),
+	}))
+
+	for _, id := range []string{"1", "2", "3"} {
+		_, e := readEvent(t, all.Body)
+		assert.Equal(t, id, e["id"])
+	}
+
+	msg, e := readEvent(t, lse.Body)
+	assert.Equal(t, "fix", msg.typ)
+	assert.Equal(t, int64(1476435600000000005), msg.timestampUnixNano)
+	assert.Equal(t, common.MapStr{"MsgType": "8"}, common.MapStr(e["fix"].(map[string]interface{})))
+	_, hasID := e["id"]
+	assert.False(t, hasID)
+	assert.Equal(t, "fix", e["type"])
+}
+
+func TestSubscribeEndsOnClose(t *testing.T) {
+	out := newTestOutput(t)
+
+	resp := subscribe(t, out, subscribePath, subscribeRequest{})
+	defer resp.Body.Close()
+	waitClients(t, out, 1)
+
+	out.Close()
+	io.Copy(io.Discard, resp.Body)
+	assert.Equal(t, "14", resp.Trailer.Get("Grpc-Status"))
+}
+
+func TestUnsubscribeOnCancel(t *testing.T) {
+	out := newTestOutput(t)
+	defer out.Close()
+
+	resp := subscribe(t, out, subscribePath, subscribeRequest{})
+	waitClients(t, out, 1)
+
+	// the client is removed without waiting for an event to write
+	resp.Body.Close()
+	waitClients(t, out, 0)
+}
+
+func TestUnknownMethod(t *testing.T) {
+	out := newTestOutput(t)
+	defer out.Close()
+
+	resp := subscribe(t, out, "/beats.events.Events/Publish", subscribeRequest{})
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	assert.Equal(t, "12", resp.Trailer.Get("Grpc-Status"))
+}
+
+func TestProtoRoundTrip(t *testing.T) {
+	req := subscribeRequest{
+		filters: []fieldFilter{
+			{field: "fix.MsgType", values: []string{"D", "8"}},
+			{field: "fix.Symbol", values: []string{"VOD.L"}},
+		},
+		fields:   []string{"fix.MsgType", "fix.Symbol"},
+		sessions: []string{"lse"},
+	}
+	var decoded subscribeRequest
+	assert.NoError(t, decoded.unmarshal(req.marshal()))
+	assert.Equal(t, req, decoded)
+
+	assert.Error(t, decoded.unmarshal([]byte{0x0a, 0x10, 'x'}))
+}
@@ -0,0 +1,188 @@
+package grpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The messages of events.proto are encoded and decoded by hand, the Protocol
+// Buffers wire format of the few fields being short to write. See
+// https://developers.google.com/protocol-buffers/docs/encoding.
+
+const (
+	wireVarint  = 0
+	wire64      = 1
+	wireBytes   = 2
+	wire32      = 5
+	maxRequest  = 64 * 1024
+	frameHeader = 5
+)
+
+var errTruncated = errors.New("truncated protobuf message")
+
+// subscribeRequest is the SubscribeRequest message.
+type subscribeRequest struct {
+	filters  []fieldFilter
+	fields   []string
+	sessions []string
+}
+
+// fieldFilter is the FieldFilter message.
+type fieldFilter struct {
+	field  string
+	values []string
+}
+
+// eventMsg is the Event message.
+type eventMsg struct {
+	json              []byte
+	typ               string
+	timestampUnixNano int64
+}
+
+func (e *eventMsg) marshal() []byte {
+	b := make([]byte, 0, len(e.json)+len(e.typ)+24)
+	b = appendBytes(b, 1, e.json)
+	if e.typ != "" {
+		b = appendBytes(b, 2, []byte(e.typ))
+	}
+	if e.timestampUnixNano != 0 {
+		b = appendVarint(b, 3<<3|wireVarint)
+		b = appendVarint(b, uint64(e.timestampUnixNano))
+	}
+	return b
+}
+
+func (r *subscribeRequest) unmarshal(b []byte) error {
+	return readFields(b, func(field, wireType int, value []byte) error {
+		if wireType != wireBytes {
+			return nil
+		}
+		switch field {
+		case 1:
+			var f fieldFilter
+			if err := f.unmarshal(value); err != nil {
+				return err
+			}
+			r.filters = append(r.filters, f)
+		case 2:
+			r.fields = append(r.fields, string(value))
+		case 3:
+			r.sessions = append(r.sessions, string(value))
+		}
+		return nil
+	})
+}
+
+func (f *fieldFilter) unmarshal(b []byte) error {
+	return readFields(b, func(field, wireType int, value []byte) error {
+		if wireType != wireBytes {
+			return nil
+		}
+		switch field {
+		case 1:
+			f.field = string(value)
+		case 2:
+			f.values = append(f.values, string(value))
+		}
+		return nil
+	})
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = appendVarint(b, uint64(field)<<3|wireBytes)
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func readVarint(b []byte) (uint64, int, error) {
+	v, n := binary.Uvarint(b)
+	if n <= 0 {
+		return 0, 0, errTruncated
+	}
+	return v, n, nil
+}
+
+// readFields calls fn for each field of the message b, the value of varint
+// and fixed-size fields being passed undecoded.
+func readFields(b []byte, fn func(field, wireType int, value []byte) error) error {
+	for len(b) > 0 {
+		key, n, err := readVarint(b)
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+		field, wireType := int(key>>3), int(key&7)
+
+		var size int
+		switch wireType {
+		case wireVarint:
+			_, size, err = readVarint(b)
+			if err != nil {
+				return err
+			}
+		case wire64:
+			size = 8
+		case wire32:
+			size = 4
+		case wireBytes:
+			l, n, err := readVarint(b)
+			if err != nil {
+				return err
+			}
+			b = b[n:]
+			if l > uint64(len(b)) {
+				return errTruncated
+			}
+			size = int(l)
+		default:
+			return fmt.Errorf("protobuf wire type %v not supported", wireType)
+		}
+		if size > len(b) {
+			return errTruncated
+		}
+
+		if err := fn(field, wireType, b[:size]); err != nil {
+			return err
+		}
+		b = b[size:]
+	}
+	return nil
+}
+
+// readMessage reads a length-prefixed gRPC message of at most max bytes.
+func readMessage(r io.Reader, max int) ([]byte, error) {
+	var header [frameHeader]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if header[0] != 0 {
+		return nil, errors.New("compressed messages not supported")
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > uint32(max) {
+		return nil, fmt.Errorf("message of %v bytes exceeds %v bytes", size, max)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// frameMessage returns the message prefixed by the gRPC length header.
+func frameMessage(msg []byte) []byte {
+	b := make([]byte, frameHeader, frameHeader+len(msg))
+	binary.BigEndian.PutUint32(b[1:], uint32(len(msg)))
+	return append(b, msg...)
+}
@@ -5,6 +5,7 @@ package logstash
 
 import (
 	"expvar"
+	"fmt"
 	"time"
 
 	"github.com/elastic/go-lumber/log"
@@ -62,6 +63,11 @@ func new(beatName string, cfg *common.Config, _ int) (outputs.Outputer, error) {
 type logstash struct {
 	mode  mode.ConnectionMode
 	index string
+
+	// connection settings, for TestConnection
+	hosts     []string
+	port      int
+	transport *transport.Config
 }
 
 func (lj *logstash) init(cfg *common.Config) error {
@@ -96,6 +102,13 @@ func (lj *logstash) init(cfg *common.Config) error {
 	lj.mode = m
 	lj.index = config.Index
 
+	lj.hosts, err = modeutil.ReadHostList(cfg)
+	if err != nil {
+		return err
+	}
+	lj.port = config.Port
+	lj.transport = transp
+
 	return nil
 }
 
@@ -168,6 +181,32 @@ func makeAsyncClientFactory(
 	}
 }
 
+// TestConnection connects to each Logstash host, checking it is reachable
+// with the configured TLS and proxy settings.
+func (lj *logstash) TestConnection(timeout time.Duration) error {
+	tcfg := *lj.transport
+	tcfg.Timeout = timeout
+	tested := map[string]bool{}
+	for _, host := range lj.hosts {
+		// hosts are listed once per worker
+		if tested[host] {
+			continue
+		}
+		tested[host] = true
+
+		client, err := transport.NewClient(&tcfg, "tcp", host, lj.port)
+		if err != nil {
+			return fmt.Errorf("%v: %v", host, err)
+		}
+		if err := client.Connect(); err != nil {
+			return fmt.Errorf("%v: %v", host, err)
+		}
+		client.Close()
+		logp.Info("Logstash %v is reachable", host)
+	}
+	return nil
+}
+
 func (lj *logstash) Close() error {
 	return lj.mode.Close()
 }
@@ -105,6 +105,38 @@ func TestLogstashTCP(t *testing.T) {
 	testConnectionType(t, server, testOutputerFactory(t, "", config))
 }
 
+func TestLogstashTestConnection(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	output := newTestLumberjackOutput(t, "", map[string]interface{}{
+		"hosts": []string{addr},
+	})
+	defer output.Close()
+	tested, err := outputs.TestOutput(output, time.Second)
+	assert.True(t, tested)
+	assert.NoError(t, err)
+
+	// the host is not reachable any more
+	listener.Close()
+	_, err = outputs.TestOutput(output, time.Second)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), addr)
+	}
+}
+
 func TestLogstashTLS(t *testing.T) {
 	certName := "ca_test"
 	ip := net.IP{127, 0, 0, 1}
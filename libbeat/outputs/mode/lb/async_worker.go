@@ -86,6 +86,7 @@ func (w *asyncWorker) connect() bool {
 		}
 
 		logp.Err("Connect failed with: %v", err)
+		mode.ConnectFailed()
 
 		cont := w.backoff.Wait()
 		if !cont {
@@ -199,6 +200,7 @@ func (w *asyncWorker) handleResults(msg eventsMessage) func([]outputs.Data, erro
 }
 
 func (w *asyncWorker) onFail(msg eventsMessage, err error) {
+	mode.Retried(1)
 	if !w.ctx.tryPushFailed(msg) {
 		// break possible deadlock by spawning go-routine returning failed messages
 		// into retries queue
@@ -92,7 +92,17 @@ func New(
 func (m *LB) Close() error {
 	m.ctx.Close()
 	m.wg.Wait()
-	return nil
+
+	// signal events still waiting to be retried as failed, so wrapping modes
+	// can spool them
+	for {
+		select {
+		case msg := <-m.ctx.retries:
+			dropping(msg)
+		default:
+			return nil
+		}
+	}
 }
 
 func (m *LB) start(makeWorkers WorkerFactory) error {
@@ -85,6 +85,7 @@ func (w *syncWorker) connect() bool {
 		}
 
 		logp.Err("Connect failed with: %v", err)
+		mode.ConnectFailed()
 
 		cont := w.backoff.Wait()
 		if !cont {
@@ -153,6 +154,15 @@ func (w *syncWorker) onMessage(msg eventsMessage) error {
 					return err
 				}
 
+				// back off before retrying, e.g. if the server is
+				// throttling requests
+				mode.Retried(1)
+				if !w.backoff.Wait() {
+					msg.data = events
+					dropping(msg)
+					return err
+				}
+
 				// reset total count for temporary failure loop
 				total = len(events)
 			}
@@ -165,5 +175,6 @@ func (w *syncWorker) onMessage(msg eventsMessage) error {
 
 func (w *syncWorker) onFail(msg eventsMessage, err error) {
 	logp.Info("Error publishing events (retrying): %s", err)
+	mode.Retried(1)
 	w.ctx.pushFailed(msg)
 }
@@ -14,7 +14,9 @@ import (
 
 // Metrics that can retrieved through the expvar web interface.
 var (
-	messagesDropped = expvar.NewInt("libbeat.outputs.messages_dropped")
+	messagesDropped    = expvar.NewInt("libbeat.outputs.messages_dropped")
+	publishRetries     = expvar.NewInt("libbeat.outputs.publish_retries")
+	connectionFailures = expvar.NewInt("libbeat.outputs.connection_failures")
 )
 
 // ErrNoHostsConfigured indicates missing host or hosts configuration
@@ -86,3 +88,13 @@ var (
 func Dropped(i int) {
 	messagesDropped.Add(int64(i))
 }
+
+// Retried counts failed publish attempts to be retried.
+func Retried(i int) {
+	publishRetries.Add(int64(i))
+}
+
+// ConnectFailed counts failed attempts to connect to an output.
+func ConnectFailed() {
+	connectionFailures.Add(1)
+}
@@ -0,0 +1,297 @@
+package modeutil
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/outputs"
+	"github.com/elastic/beats/libbeat/outputs/mode"
+)
+
+// Strategies selecting the client events are published with.
+const (
+	// StrategyRoundRobin rotates through the connected clients.
+	StrategyRoundRobin = "round_robin"
+
+	// StrategyRandom selects a random connected client.
+	StrategyRandom = "random"
+
+	// StrategySticky keeps using one client until it fails.
+	StrategySticky = "sticky"
+
+	// StrategyLatency selects a random client, weighted by the inverse of
+	// its recent publish latency.
+	StrategyLatency = "latency"
+)
+
+// balancedClient connects to all clients, publishing each batch of events
+// with one client selected by strategy. If a client fails, the events are
+// published with the next client selected. Failed clients are reconnected
+// after a backoff, doubling from waitRetry up to maxWaitRetry while they keep
+// failing, and all clients once no client is left.
+type balancedClient struct {
+	conns     []mode.ProtocolClient
+	connected []bool
+	strategy  string
+
+	// connect timeout, and the backoff and time of the next reconnect of
+	// failed clients
+	timeout      time.Duration
+	waitRetry    time.Duration
+	maxWaitRetry time.Duration
+	backoff      []time.Duration
+	retry        []time.Time
+
+	// index of the last selected client
+	last int
+
+	// moving average of the publish latency per client
+	latency []time.Duration
+}
+
+// ValidateStrategy checks a strategy name is known. The empty strategy is
+// valid, selecting the default pull based load balancing.
+func ValidateStrategy(strategy string) error {
+	switch strategy {
+	case "", StrategyRoundRobin, StrategyRandom, StrategySticky, StrategyLatency:
+		return nil
+	}
+	return fmt.Errorf("invalid load balancing strategy: %v, must be one of %v, %v, %v or %v",
+		strategy, StrategyRoundRobin, StrategyRandom, StrategySticky, StrategyLatency)
+}
+
+func NewBalancedClient(
+	clients []mode.ProtocolClient,
+	strategy string,
+	waitRetry, maxWaitRetry time.Duration,
+) []mode.ProtocolClient {
+	if len(clients) <= 1 {
+		return clients
+	}
+	return []mode.ProtocolClient{&balancedClient{
+		conns:        clients,
+		connected:    make([]bool, len(clients)),
+		strategy:     strategy,
+		waitRetry:    waitRetry,
+		maxWaitRetry: maxWaitRetry,
+		backoff:      make([]time.Duration, len(clients)),
+		retry:        make([]time.Time, len(clients)),
+		last:         rand.Intn(len(clients)),
+		latency:      make([]time.Duration, len(clients)),
+	}}
+}
+
+// Connect connects all clients not yet connected. An error is returned if no
+// client could be connected.
+func (b *balancedClient) Connect(to time.Duration) error {
+	b.timeout = to
+	now := time.Now()
+	var err error
+	for i, conn := range b.conns {
+		if b.connected[i] {
+			continue
+		}
+
+		if cerr := conn.Connect(to); cerr != nil {
+			err = cerr
+			b.failed(i, now)
+			continue
+		}
+		b.connected[i] = true
+	}
+
+	if b.active() == 0 {
+		return err
+	}
+	return nil
+}
+
+func (b *balancedClient) Close() error {
+	var err error
+	for i, conn := range b.conns {
+		if !b.connected[i] {
+			continue
+		}
+		if cerr := conn.Close(); cerr != nil {
+			err = cerr
+		}
+		b.connected[i] = false
+	}
+	return err
+}
+
+func (b *balancedClient) PublishEvents(data []outputs.Data) ([]outputs.Data, error) {
+	err := b.send(func(conn mode.ProtocolClient) error {
+		var err error
+		data, err = conn.PublishEvents(data)
+		return err
+	})
+	return data, err
+}
+
+func (b *balancedClient) PublishEvent(data outputs.Data) error {
+	return b.send(func(conn mode.ProtocolClient) error {
+		return conn.PublishEvent(data)
+	})
+}
+
+// send publishes with the selected client, failing over to the next client
+// selected until no connected client is left. Temporary failures are
+// returned without failing over.
+func (b *balancedClient) send(publish func(mode.ProtocolClient) error) error {
+	b.reconnect(time.Now())
+	for {
+		i := b.selectClient()
+		if i < 0 {
+			return errNoActiveConnection
+		}
+
+		start := time.Now()
+		err := publish(b.conns[i])
+		b.observe(i, time.Since(start))
+		if err == nil {
+			b.backoff[i] = 0
+			return nil
+		}
+		if err == mode.ErrTempBulkFailure {
+			// the client is connected but throttled or failed some events:
+			// keep it, the caller backs off before retrying
+			return err
+		}
+
+		logp.Info("Error publishing events (failing over to next host): %s", err)
+		b.conns[i].Close()
+		b.connected[i] = false
+		b.failed(i, time.Now())
+		if b.active() == 0 {
+			return err
+		}
+	}
+}
+
+// reconnect connects the failed clients whose backoff has passed, while the
+// other clients are publishing.
+func (b *balancedClient) reconnect(now time.Time) {
+	for i, conn := range b.conns {
+		if b.connected[i] || now.Before(b.retry[i]) {
+			continue
+		}
+		if err := conn.Connect(b.timeout); err != nil {
+			logp.Info("Error reconnecting to failed host: %s", err)
+			b.failed(i, now)
+			continue
+		}
+		b.connected[i] = true
+	}
+}
+
+// failed schedules the reconnect of client i, doubling its backoff until it
+// publishes again.
+func (b *balancedClient) failed(i int, now time.Time) {
+	backoff := 2 * b.backoff[i]
+	if backoff < b.waitRetry {
+		backoff = b.waitRetry
+	}
+	if backoff > b.maxWaitRetry {
+		backoff = b.maxWaitRetry
+	}
+	b.backoff[i] = backoff
+	b.retry[i] = now.Add(backoff)
+}
+
+// selectClient returns the index of the client to publish with, or -1 if no
+// client is connected.
+func (b *balancedClient) selectClient() int {
+	n := b.active()
+	if n == 0 {
+		return -1
+	}
+
+	switch b.strategy {
+	case StrategySticky:
+		if b.connected[b.last] {
+			return b.last
+		}
+	case StrategyRandom:
+		return b.nth(rand.Intn(n))
+	case StrategyLatency:
+		return b.selectByLatency()
+	}
+
+	// round robin, also selecting the next client once the sticky one failed
+	for i := 1; i <= len(b.conns); i++ {
+		next := (b.last + i) % len(b.conns)
+		if b.connected[next] {
+			b.last = next
+			return next
+		}
+	}
+	return -1
+}
+
+// selectByLatency prefers clients without measured latency, so all clients
+// are measured.
+func (b *balancedClient) selectByLatency() int {
+	var total float64
+	for i, latency := range b.latency {
+		if !b.connected[i] {
+			continue
+		}
+		if latency <= 0 {
+			return i
+		}
+		total += 1 / float64(latency)
+	}
+
+	r := rand.Float64() * total
+	selected := -1
+	for i, latency := range b.latency {
+		if !b.connected[i] {
+			continue
+		}
+		selected = i
+		r -= 1 / float64(latency)
+		if r <= 0 {
+			break
+		}
+	}
+	return selected
+}
+
+// observe updates the moving average of the publish latency of client i.
+func (b *balancedClient) observe(i int, latency time.Duration) {
+	if latency <= 0 {
+		latency = 1
+	}
+	if b.latency[i] == 0 {
+		b.latency[i] = latency
+		return
+	}
+	b.latency[i] = (7*b.latency[i] + latency) / 8
+}
+
+func (b *balancedClient) active() int {
+	n := 0
+	for _, connected := range b.connected {
+		if connected {
+			n++
+		}
+	}
+	return n
+}
+
+// nth returns the index of the n-th connected client.
+func (b *balancedClient) nth(n int) int {
+	for i, connected := range b.connected {
+		if !connected {
+			continue
+		}
+		if n == 0 {
+			return i
+		}
+		n--
+	}
+	return -1
+}
@@ -0,0 +1,150 @@
+// +build !integration
+
+package modeutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/outputs"
+	"github.com/elastic/beats/libbeat/outputs/mode"
+)
+
+// countingClient counts the batches published, failing if fail is set and
+// failing temporarily if throttled is set.
+type countingClient struct {
+	published int
+	fail      bool
+	throttled bool
+	delay     time.Duration
+	closed    int
+}
+
+func (c *countingClient) Connect(timeout time.Duration) error { return nil }
+func (c *countingClient) Close() error                        { c.closed++; return nil }
+func (c *countingClient) PublishEvents(data []outputs.Data) ([]outputs.Data, error) {
+	return data, c.PublishEvent(outputs.Data{})
+}
+func (c *countingClient) PublishEvent(data outputs.Data) error {
+	time.Sleep(c.delay)
+	if c.fail {
+		return errors.New("fail")
+	}
+	if c.throttled {
+		return mode.ErrTempBulkFailure
+	}
+	c.published++
+	return nil
+}
+
+func makeBalancedClient(strategy string, conns ...*countingClient) mode.ProtocolClient {
+	clients := make([]mode.ProtocolClient, len(conns))
+	for i, c := range conns {
+		clients[i] = c
+	}
+	return NewBalancedClient(clients, strategy, time.Minute, time.Minute)[0]
+}
+
+func publishN(t *testing.T, client mode.ProtocolClient, n int) {
+	assert.NoError(t, client.Connect(0))
+	for i := 0; i < n; i++ {
+		assert.NoError(t, client.PublishEvent(outputs.Data{}))
+	}
+}
+
+func TestBalancedClientRoundRobin(t *testing.T) {
+	a, b, c := &countingClient{}, &countingClient{}, &countingClient{}
+	publishN(t, makeBalancedClient(StrategyRoundRobin, a, b, c), 9)
+
+	assert.Equal(t, []int{3, 3, 3}, []int{a.published, b.published, c.published})
+}
+
+func TestBalancedClientStickyUntilFailure(t *testing.T) {
+	a, b := &countingClient{}, &countingClient{}
+	client := makeBalancedClient(StrategySticky, a, b)
+	publishN(t, client, 4)
+	assert.Equal(t, 4, a.published+b.published)
+	assert.True(t, a.published == 0 || b.published == 0)
+
+	// fail over to the other client, keeping it
+	sticky, other := a, b
+	if b.published > 0 {
+		sticky, other = b, a
+	}
+	sticky.fail = true
+	publishN(t, client, 3)
+	assert.Equal(t, 3, other.published)
+}
+
+func TestBalancedClientFailsIfAllFail(t *testing.T) {
+	a, b := &countingClient{fail: true}, &countingClient{fail: true}
+	client := makeBalancedClient(StrategyRandom, a, b)
+
+	assert.NoError(t, client.Connect(0))
+	assert.Error(t, client.PublishEvent(outputs.Data{}))
+	assert.Equal(t, errNoActiveConnection, client.PublishEvent(outputs.Data{}))
+
+	// reconnects all clients
+	a.fail = false
+	publishN(t, client, 1)
+	assert.Equal(t, 1, a.published)
+}
+
+func TestBalancedClientReconnectsFailedClient(t *testing.T) {
+	a, b := &countingClient{}, &countingClient{}
+	client := NewBalancedClient([]mode.ProtocolClient{a, b}, StrategyRoundRobin,
+		10*time.Millisecond, 10*time.Millisecond)[0]
+	publishN(t, client, 2)
+	assert.Equal(t, []int{1, 1}, []int{a.published, b.published})
+
+	// the healthy client publishes alone until the backoff of the failed one
+	a.fail = true
+	publishN(t, client, 4)
+	assert.Equal(t, []int{1, 5}, []int{a.published, b.published})
+
+	a.fail = false
+	time.Sleep(20 * time.Millisecond)
+	publishN(t, client, 4)
+	assert.Equal(t, []int{3, 7}, []int{a.published, b.published})
+}
+
+func TestBalancedClientKeepsThrottledClient(t *testing.T) {
+	a, b := &countingClient{}, &countingClient{}
+	client := makeBalancedClient(StrategySticky, a, b)
+	publishN(t, client, 1)
+
+	// Elasticsearch answering 429: the error is returned without failing
+	// over, and the client stays connected
+	throttled, other := a, b
+	if b.published > 0 {
+		throttled, other = b, a
+	}
+	throttled.throttled = true
+	_, err := client.PublishEvents([]outputs.Data{{}})
+	assert.Equal(t, mode.ErrTempBulkFailure, err)
+	assert.Equal(t, 0, throttled.closed)
+	assert.Equal(t, 0, other.published)
+
+	throttled.throttled = false
+	publishN(t, client, 2)
+	assert.Equal(t, 3, throttled.published)
+	assert.Equal(t, 0, other.published)
+}
+
+func TestBalancedClientLatency(t *testing.T) {
+	fast, slow := &countingClient{}, &countingClient{delay: 5 * time.Millisecond}
+	publishN(t, makeBalancedClient(StrategyLatency, fast, slow), 40)
+
+	assert.True(t, slow.published >= 1, "slow client never measured")
+	assert.True(t, fast.published > slow.published,
+		"fast=%v slow=%v", fast.published, slow.published)
+}
+
+func TestValidateStrategy(t *testing.T) {
+	assert.NoError(t, ValidateStrategy(""))
+	assert.NoError(t, ValidateStrategy(StrategyLatency))
+	assert.Error(t, ValidateStrategy("least_conn"))
+}
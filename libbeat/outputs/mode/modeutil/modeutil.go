@@ -14,7 +14,17 @@ type ClientFactory func(host string) (mode.ProtocolClient, error)
 type AsyncClientFactory func(string) (mode.AsyncProtocolClient, error)
 
 type Settings struct {
-	Failover     bool
+	Failover bool
+
+	// Strategy selects the client to publish with, overriding Failover. If
+	// empty, events are load balanced between all clients by the lb mode.
+	Strategy string
+
+	// Workers is the number of clients created per host by MakeClients. With
+	// Failover or Strategy set, one worker per client of each host is run,
+	// publishing to all hosts.
+	Workers int
+
 	MaxAttempts  int
 	WaitRetry    time.Duration
 	Timeout      time.Duration
@@ -25,8 +35,16 @@ func NewConnectionMode(
 	clients []mode.ProtocolClient,
 	s Settings,
 ) (mode.ConnectionMode, error) {
-	if s.Failover {
-		clients = NewFailoverClient(clients)
+	if s.Strategy != "" || s.Failover {
+		var workers []mode.ProtocolClient
+		for _, group := range groupWorkers(clients, s.Workers) {
+			if s.Strategy != "" {
+				workers = append(workers, NewBalancedClient(group, s.Strategy, s.WaitRetry, s.MaxWaitRetry)...)
+			} else {
+				workers = append(workers, NewFailoverClient(group)...)
+			}
+		}
+		clients = workers
 	}
 
 	maxSend := s.MaxAttempts
@@ -50,6 +68,20 @@ func NewAsyncConnectionMode(
 	return lb.NewAsync(clients, s.MaxAttempts, s.WaitRetry, s.Timeout, s.MaxWaitRetry)
 }
 
+// groupWorkers splits the clients created by MakeClients into one group per
+// worker, each holding one client of every host.
+func groupWorkers(clients []mode.ProtocolClient, workers int) [][]mode.ProtocolClient {
+	if workers <= 1 || len(clients)%workers != 0 {
+		return [][]mode.ProtocolClient{clients}
+	}
+
+	groups := make([][]mode.ProtocolClient, workers)
+	for i, client := range clients {
+		groups[i%workers] = append(groups[i%workers], client)
+	}
+	return groups
+}
+
 // MakeClients will create a list from of ProtocolClient instances from
 // outputer configuration host list and client factory function.
 func MakeClients(
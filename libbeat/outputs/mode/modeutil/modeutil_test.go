@@ -8,6 +8,8 @@ import (
 	"github.com/elastic/beats/libbeat/common"
 	"github.com/elastic/beats/libbeat/outputs"
 	"github.com/elastic/beats/libbeat/outputs/mode"
+	"github.com/elastic/beats/libbeat/outputs/mode/lb"
+	"github.com/elastic/beats/libbeat/outputs/mode/single"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -99,6 +101,43 @@ func TestMakeTwoClientFail(t *testing.T) {
 	assert.Equal(t, testError, err)
 }
 
+func TestGroupWorkers(t *testing.T) {
+	config := map[string]interface{}{
+		"hosts":  []string{"client1", "client2"},
+		"worker": 3,
+	}
+
+	var hosts []string
+	clients, err := makeTestClients(config, func(host string) (mode.ProtocolClient, error) {
+		hosts = append(hosts, host)
+		return dummyMockClientFactory(host)
+	})
+	assert.Nil(t, err)
+
+	groups := groupWorkers(clients, 3)
+	assert.Equal(t, 3, len(groups))
+	for _, group := range groups {
+		assert.Equal(t, 2, len(group))
+	}
+	assert.Equal(t, []string{"client1", "client1", "client1", "client2", "client2", "client2"}, hosts)
+
+	assert.Equal(t, 1, len(groupWorkers(clients, 1)))
+}
+
+func TestNewConnectionModeWorkers(t *testing.T) {
+	clients := []mode.ProtocolClient{dummyClient{}, dummyClient{}, dummyClient{}, dummyClient{}}
+
+	m, err := NewConnectionMode(clients, Settings{Strategy: StrategyRoundRobin, Workers: 2})
+	assert.Nil(t, err)
+	assert.IsType(t, &lb.LB{}, m)
+	m.Close()
+
+	m, err = NewConnectionMode(clients, Settings{Failover: true, Workers: 1})
+	assert.Nil(t, err)
+	assert.IsType(t, &single.Mode{}, m)
+	m.Close()
+}
+
 func dummyMockClientFactory(host string) (mode.ProtocolClient, error) {
 	return dummyClient{}, nil
 }
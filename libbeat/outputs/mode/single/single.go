@@ -81,7 +81,7 @@ func (s *Mode) PublishEvents(
 	opts outputs.Options,
 	data []outputs.Data,
 ) error {
-	return s.publish(signaler, opts, func() (bool, bool) {
+	return s.publish(signaler, opts, func() (bool, bool, error) {
 		for len(data) > 0 {
 			var err error
 
@@ -91,11 +91,11 @@ func (s *Mode) PublishEvents(
 				logp.Info("Error publishing events (retrying): %s", err)
 
 				madeProgress := len(data) < total
-				return false, madeProgress
+				return false, madeProgress, err
 			}
 		}
 
-		return true, false
+		return true, false, nil
 	})
 }
 
@@ -105,12 +105,12 @@ func (s *Mode) PublishEvent(
 	opts outputs.Options,
 	data outputs.Data,
 ) error {
-	return s.publish(signaler, opts, func() (bool, bool) {
+	return s.publish(signaler, opts, func() (bool, bool, error) {
 		if err := s.conn.PublishEvent(data); err != nil {
 			logp.Info("Error publishing event (retrying): %s", err)
-			return false, false
+			return false, false, err
 		}
-		return true, false
+		return true, false, nil
 	})
 }
 
@@ -122,10 +122,12 @@ func (s *Mode) PublishEvent(
 // processing events. If ok is false but resetFail is set, send was partially
 // successful. If send was partially successful, the fail counter is reset thus up
 // to maxAttempts send attempts without any progress might be executed.
+// On temporary failures, like the server throttling requests, the connection
+// is kept and the backoff keeps increasing even if partial progress was made.
 func (s *Mode) publish(
 	signaler op.Signaler,
 	opts outputs.Options,
-	send func() (ok bool, resetFail bool),
+	send func() (ok bool, resetFail bool, err error),
 ) error {
 	fails := 0
 	var err error
@@ -138,12 +140,16 @@ func (s *Mode) publish(
 
 		if err := s.connect(); err != nil {
 			logp.Err("Connecting error publishing events (retrying): %s", err)
+			mode.ConnectFailed()
 			goto sendFail
 		}
 
-		ok, resetFail = send()
+		ok, resetFail, err = send()
 		if !ok {
-			s.closeClient()
+			mode.Retried(1)
+			if err != mode.ErrTempBulkFailure {
+				s.closeClient()
+			}
 			goto sendFail
 		}
 
@@ -158,7 +164,9 @@ func (s *Mode) publish(
 		fails++
 		if resetFail {
 			debugf("reset fails")
-			s.backoff.Reset()
+			if err != mode.ErrTempBulkFailure {
+				s.backoff.Reset()
+			}
 			fails = 0
 		}
 		s.backoff.Wait()
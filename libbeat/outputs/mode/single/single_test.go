@@ -10,6 +10,7 @@ import (
 	"github.com/elastic/beats/libbeat/common"
 	"github.com/elastic/beats/libbeat/logp"
 	"github.com/elastic/beats/libbeat/outputs"
+	"github.com/elastic/beats/libbeat/outputs/mode"
 	"github.com/elastic/beats/libbeat/outputs/mode/modetest"
 )
 
@@ -190,3 +191,37 @@ func TestSingleSendFlakyGuaranteed(t *testing.T) {
 func TestSingleSendMultiFlakyGuaranteed(t *testing.T) {
 	testSingleSendFlakyGuaranteed(t, modetest.MultiEvent(10, testEvent))
 }
+
+func testSingleSendTemporaryFailure(t *testing.T, events []modetest.EventInfo) {
+	var collected [][]outputs.Data
+	err := mode.ErrTempBulkFailure
+	connects := 0
+	mode, _ := New(
+		modetest.NewMockClient(&modetest.MockClient{
+			Connected: false,
+			CBConnect: func(time.Duration) error {
+				connects++
+				return nil
+			},
+			CBPublish: modetest.PublishCollectAfterFailStartWith(2, err, &collected),
+		}),
+		3,
+		1*time.Millisecond,
+		1*time.Millisecond,
+		10*time.Millisecond,
+	)
+	modetest.TestMode(t, mode, testNoOpts, events, modetest.Signals(true), &collected)
+
+	// temporary failures are retried without reconnecting
+	if connects != 1 {
+		t.Errorf("expected 1 connect, got %v", connects)
+	}
+}
+
+func TestSingleSendTemporaryFailure(t *testing.T) {
+	testSingleSendTemporaryFailure(t, modetest.SingleEvent(testEvent))
+}
+
+func TestSingleSendMultiTemporaryFailure(t *testing.T) {
+	testSingleSendTemporaryFailure(t, modetest.MultiEvent(10, testEvent))
+}
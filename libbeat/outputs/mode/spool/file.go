@@ -0,0 +1,163 @@
+package spool
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/outputs"
+)
+
+// spoolFile stores events as JSON lines. Events are read from the offset of
+// the first event not yet published, which is kept in a separate offset file
+// to continue after a restart.
+type spoolFile struct {
+	path    string
+	maxSize int64
+
+	file   *os.File
+	size   int64
+	offset int64
+}
+
+func openSpoolFile(path string, maxSize int64) (*spoolFile, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	f := &spoolFile{
+		path:    path,
+		maxSize: maxSize,
+		file:    file,
+		size:    info.Size(),
+	}
+	f.offset = f.readOffset()
+	return f, nil
+}
+
+// readOffset returns the stored read offset. If the offset file is missing or
+// invalid, all events in the spool file are read again.
+func (f *spoolFile) readOffset() int64 {
+	content, err := ioutil.ReadFile(f.path + ".offset")
+	if err != nil {
+		return 0
+	}
+
+	offset, err := strconv.ParseInt(string(bytes.TrimSpace(content)), 10, 64)
+	if err != nil || offset < 0 || offset > f.size {
+		return 0
+	}
+	return offset
+}
+
+func (f *spoolFile) empty() bool {
+	return f.offset >= f.size
+}
+
+// append writes events to the end of the file. Events not fitting into
+// maxSize are not written. The number of events written is returned.
+func (f *spoolFile) append(data []outputs.Data) (int, error) {
+	var buf bytes.Buffer
+	written := 0
+	for _, d := range data {
+		line, err := json.Marshal(d.Event)
+		if err != nil {
+			// event can not be encoded, skip it same as the outputs do
+			continue
+		}
+		if f.maxSize > 0 && f.size+int64(buf.Len()+len(line)+1) > f.maxSize {
+			break
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+		written++
+	}
+
+	n, err := f.file.Write(buf.Bytes())
+	f.size += int64(n)
+	if err != nil {
+		return 0, err
+	}
+	return written, nil
+}
+
+// read returns up to max events starting at the read offset, and the offset
+// following the last event returned.
+func (f *spoolFile) read(max int) ([]outputs.Data, int64, error) {
+	reader := bufio.NewReader(io.NewSectionReader(f.file, f.offset, f.size-f.offset))
+
+	offset := f.offset
+	var data []outputs.Data
+	for len(data) < max {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// skip the incomplete line of a failed write
+			offset += int64(len(line))
+			break
+		}
+		if err != nil {
+			return nil, f.offset, err
+		}
+		offset += int64(len(line))
+
+		event, err := decodeEvent(line)
+		if err != nil {
+			debugf("skip invalid spooled event: %v", err)
+			continue
+		}
+		data = append(data, outputs.Data{Event: event})
+	}
+	return data, offset, nil
+}
+
+func decodeEvent(line []byte) (common.MapStr, error) {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+
+	var event common.MapStr
+	if err := dec.Decode(&event); err != nil {
+		return nil, err
+	}
+
+	// outputs expect the timestamp to be a common.Time
+	if ts, ok := event["@timestamp"].(string); ok {
+		t, err := common.ParseTime(ts)
+		if err != nil {
+			return nil, err
+		}
+		event["@timestamp"] = t
+	}
+	return event, nil
+}
+
+// commit stores the offset of the next event to read. The file is truncated
+// once all events have been read.
+func (f *spoolFile) commit(offset int64) error {
+	f.offset = offset
+	if f.empty() {
+		if err := f.file.Truncate(0); err != nil {
+			return err
+		}
+		f.size = 0
+		f.offset = 0
+	}
+
+	return ioutil.WriteFile(f.path+".offset",
+		[]byte(strconv.FormatInt(f.offset, 10)), 0600)
+}
+
+func (f *spoolFile) close() error {
+	return f.file.Close()
+}
@@ -0,0 +1,269 @@
+// Package spool provides a connection mode wrapper storing events on disk if
+// they can not be published, to publish them again once the output recovers.
+package spool
+
+import (
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common/op"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/outputs"
+	"github.com/elastic/beats/libbeat/outputs/mode"
+)
+
+// Mode wraps a ConnectionMode. Events failing to be published after the
+// configured number of send attempts are written to the spool file instead of
+// being dropped. While the spool file holds events, new events are appended
+// to it as well, so events are published in order.
+type Mode struct {
+	mode mode.ConnectionMode
+
+	// maximum number of events published from the spool file at once
+	bulkSize int
+
+	// time to wait after failing to publish spooled events
+	waitRetry time.Duration
+
+	mutex sync.Mutex
+	file  *spoolFile
+
+	notify chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// Metrics that can retrieved through the expvar web interface.
+var (
+	eventsSpooled  = expvar.NewInt("libbeat.outputs.spool.events_spooled")
+	eventsReplayed = expvar.NewInt("libbeat.outputs.spool.events_replayed")
+)
+
+var debugf = logp.MakeDebug("spool")
+
+// New creates the spool file at path if missing, and starts publishing the
+// events already stored in it. If maxSize is > 0, events exceeding maxSize
+// bytes of spool file are dropped.
+func New(
+	m mode.ConnectionMode,
+	path string,
+	maxSize int64,
+	bulkSize int,
+	waitRetry time.Duration,
+) (*Mode, error) {
+	file, err := openSpoolFile(path, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	if bulkSize <= 0 {
+		bulkSize = 1
+	}
+
+	s := &Mode{
+		mode:      m,
+		bulkSize:  bulkSize,
+		waitRetry: waitRetry,
+		file:      file,
+		notify:    make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	if !file.empty() {
+		logp.Info("Publishing %v bytes of spooled events from %v", file.size-file.offset, path)
+		s.signal()
+	}
+
+	s.wg.Add(1)
+	go s.run()
+	return s, nil
+}
+
+// Close stops publishing spooled events and closes the wrapped mode. Events
+// not yet published remain in the spool file.
+func (s *Mode) Close() error {
+	close(s.done)
+	err := s.mode.Close()
+	s.wg.Wait()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if cerr := s.file.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// PublishEvents publishes the events using the wrapped mode, or adds them to
+// the spool file if it holds events not yet published.
+func (s *Mode) PublishEvents(
+	signaler op.Signaler,
+	opts outputs.Options,
+	data []outputs.Data,
+) error {
+	if opts.Guaranteed {
+		// retried by the wrapped mode until published
+		return s.mode.PublishEvents(signaler, opts, data)
+	}
+
+	if s.spoolIfPending(signaler, data) {
+		return nil
+	}
+
+	// the wrapped mode may reuse the slice for events still to be published
+	events := append([]outputs.Data(nil), data...)
+	return s.mode.PublishEvents(s.spoolOnFail(signaler, data), opts, events)
+}
+
+// PublishEvent publishes one event using the wrapped mode, or adds it to the
+// spool file if it holds events not yet published.
+func (s *Mode) PublishEvent(
+	signaler op.Signaler,
+	opts outputs.Options,
+	data outputs.Data,
+) error {
+	if opts.Guaranteed {
+		return s.mode.PublishEvent(signaler, opts, data)
+	}
+
+	batch := []outputs.Data{data}
+	if s.spoolIfPending(signaler, batch) {
+		return nil
+	}
+	return s.mode.PublishEvent(s.spoolOnFail(signaler, batch), opts, data)
+}
+
+func (s *Mode) spoolIfPending(signaler op.Signaler, data []outputs.Data) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file.empty() {
+		return false
+	}
+	s.spool(signaler, data)
+	return true
+}
+
+// spoolOnFail returns a signaler adding the events to the spool file if the
+// wrapped mode failed to publish them.
+func (s *Mode) spoolOnFail(signaler op.Signaler, data []outputs.Data) op.Signaler {
+	return op.SignalCallback(func(res op.SignalResponse) {
+		if res != op.SignalFailed {
+			res.Apply(signaler)
+			return
+		}
+
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.spool(signaler, data)
+	})
+}
+
+// spool appends the events to the spool file. Events being stored are
+// reported as completed. Must be called with the mutex held.
+func (s *Mode) spool(signaler op.Signaler, data []outputs.Data) {
+	n, err := s.file.append(data)
+	if err != nil {
+		logp.Err("Failed to spool events: %v", err)
+	}
+	eventsSpooled.Add(int64(n))
+
+	if n < len(data) {
+		debugf("spool file full, dropping %v events", len(data)-n)
+		mode.Dropped(len(data) - n)
+		op.SigFailed(signaler, err)
+		return
+	}
+
+	op.SigCompleted(signaler)
+	s.signal()
+}
+
+func (s *Mode) signal() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// run publishes the spooled events in order, until the spool file is empty
+// or the mode is closed.
+func (s *Mode) run() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.notify:
+		}
+
+		for s.replay() {
+		}
+	}
+}
+
+// replay publishes the next batch of spooled events. It returns false if no
+// events are left to publish or the mode is closed.
+func (s *Mode) replay() bool {
+	s.mutex.Lock()
+	data, next, err := s.file.read(s.bulkSize)
+	s.mutex.Unlock()
+	if err != nil {
+		logp.Err("Failed to read spooled events: %v", err)
+		return s.wait()
+	}
+	if len(data) == 0 {
+		// drop invalid events left at the end of the spool file
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if next > s.file.offset {
+			s.commit(next)
+		}
+		return false
+	}
+
+	if !s.publish(data) {
+		debugf("failed to publish spooled events, retry in %v", s.waitRetry)
+		return s.wait()
+	}
+	eventsReplayed.Add(int64(len(data)))
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.commit(next)
+	return true
+}
+
+// commit marks the events up to offset as published. Must be called with the
+// mutex held.
+func (s *Mode) commit(offset int64) {
+	if err := s.file.commit(offset); err != nil {
+		logp.Err("Failed to store spool file offset: %v", err)
+	}
+}
+
+func (s *Mode) publish(data []outputs.Data) bool {
+	res := make(chan op.SignalResponse, 1)
+	sig := op.SignalCallback(func(r op.SignalResponse) { res <- r })
+
+	if err := s.mode.PublishEvents(sig, outputs.Options{}, data); err != nil {
+		return false
+	}
+
+	select {
+	case r := <-res:
+		return r == op.SignalCompleted
+	case <-s.done:
+		return false
+	}
+}
+
+// wait waits for waitRetry, returning false if the mode is closed.
+func (s *Mode) wait() bool {
+	select {
+	case <-time.After(s.waitRetry):
+		return true
+	case <-s.done:
+		return false
+	}
+}
@@ -0,0 +1,181 @@
+// +build !integration
+
+package spool
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/common/op"
+	"github.com/elastic/beats/libbeat/outputs"
+)
+
+// testMode publishes events synchronously, failing while down is set.
+type testMode struct {
+	mutex     sync.Mutex
+	down      bool
+	published []int
+}
+
+func (m *testMode) Close() error { return nil }
+
+func (m *testMode) PublishEvents(sig op.Signaler, _ outputs.Options, data []outputs.Data) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.down {
+		op.SigFailed(sig, nil)
+		return nil
+	}
+	for _, d := range data {
+		m.published = append(m.published, eventNumber(d.Event))
+	}
+	op.SigCompleted(sig)
+	return nil
+}
+
+func (m *testMode) PublishEvent(sig op.Signaler, opts outputs.Options, data outputs.Data) error {
+	return m.PublishEvents(sig, opts, []outputs.Data{data})
+}
+
+func (m *testMode) setDown(down bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.down = down
+}
+
+func (m *testMode) count() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.published)
+}
+
+// eventNumber returns the number of an event, being a json.Number once read
+// from the spool file.
+func eventNumber(event common.MapStr) int {
+	switch n := event["n"].(type) {
+	case int:
+		return n
+	case json.Number:
+		i, _ := n.Int64()
+		return int(i)
+	}
+	return -1
+}
+
+func makeEvents(from, to int) []outputs.Data {
+	var data []outputs.Data
+	for i := from; i < to; i++ {
+		data = append(data, outputs.Data{Event: common.MapStr{
+			"@timestamp": common.Time(time.Now()),
+			"type":       "test",
+			"n":          i,
+		}})
+	}
+	return data
+}
+
+func tempSpoolPath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "spool.log"), func() { os.RemoveAll(dir) }
+}
+
+func waitPublished(t *testing.T, m *testMode, n int) {
+	for i := 0; i < 200 && m.count() < n; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if m.count() < n {
+		t.Fatalf("published %v events, expected %v", m.count(), n)
+	}
+}
+
+func TestSpoolReplaysInOrder(t *testing.T) {
+	path, cleanup := tempSpoolPath(t)
+	defer cleanup()
+
+	inner := &testMode{down: true}
+	s, err := New(inner, path, 0, 2, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var failed int
+	sig := op.SignalCallback(func(r op.SignalResponse) {
+		if r != op.SignalCompleted {
+			failed++
+		}
+	})
+
+	s.PublishEvents(sig, outputs.Options{}, makeEvents(0, 3))
+	inner.setDown(false)
+	// published after the spooled events, in order
+	s.PublishEvents(sig, outputs.Options{}, makeEvents(3, 5))
+
+	waitPublished(t, inner, 5)
+	assert.Equal(t, 0, failed)
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, inner.published)
+
+	s.mutex.Lock()
+	assert.True(t, s.file.empty())
+	assert.Equal(t, int64(0), s.file.size)
+	s.mutex.Unlock()
+}
+
+func TestSpoolReplaysAfterRestart(t *testing.T) {
+	path, cleanup := tempSpoolPath(t)
+	defer cleanup()
+
+	f, err := openSpoolFile(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.append(makeEvents(0, 4))
+	data, next, err := f.read(1)
+	assert.NoError(t, err)
+	assert.Len(t, data, 1)
+	assert.NoError(t, f.commit(next))
+	f.close()
+
+	inner := &testMode{}
+	s, err := New(inner, path, 0, 10, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	waitPublished(t, inner, 3)
+	assert.Equal(t, []int{1, 2, 3}, inner.published)
+}
+
+func TestSpoolFileMaxSize(t *testing.T) {
+	path, cleanup := tempSpoolPath(t)
+	defer cleanup()
+
+	f, err := openSpoolFile(path, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.close()
+
+	n, err := f.append(makeEvents(0, 10))
+	assert.NoError(t, err)
+	assert.True(t, n > 0 && n < 10, "%v events written", n)
+	assert.True(t, f.size <= 100)
+
+	data, _, err := f.read(10)
+	assert.NoError(t, err)
+	assert.Len(t, data, n)
+	assert.IsType(t, common.Time{}, data[0].Event["@timestamp"])
+}
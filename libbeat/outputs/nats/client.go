@@ -0,0 +1,513 @@
+package nats
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/outputs"
+	"github.com/elastic/beats/libbeat/outputs/outil"
+	"github.com/elastic/beats/libbeat/outputs/transport"
+)
+
+// client publishes events speaking the NATS text protocol. Each batch of PUBs
+// is followed by a PING, the server answering PONG once it processed the
+// messages before. With JetStream each message is published with a reply
+// subject of the client inbox, the stream storing the message answering with
+// an acknowledgement.
+type client struct {
+	*transport.Client
+	tls        *transport.TLSConfig
+	serverName string
+	options    connectOptions
+	subject    outil.Selector
+	msgID      *outil.Selector
+	timeout    time.Duration
+	jetStream  bool
+	ackTimeout time.Duration
+
+	conn    net.Conn
+	reader  *bufio.Reader
+	info    serverInfo
+	headers bool
+	inbox   string
+}
+
+// serverInfo holds the settings of the server sent in INFO on connect.
+type serverInfo struct {
+	ServerID     string `json:"server_id"`
+	Version      string `json:"version"`
+	AuthRequired bool   `json:"auth_required"`
+	TLSRequired  bool   `json:"tls_required"`
+	Headers      bool   `json:"headers"`
+	MaxPayload   int    `json:"max_payload"`
+}
+
+// connectOptions are sent in CONNECT after INFO.
+type connectOptions struct {
+	Verbose      bool   `json:"verbose"`
+	Pedantic     bool   `json:"pedantic"`
+	User         string `json:"user,omitempty"`
+	Pass         string `json:"pass,omitempty"`
+	Token        string `json:"auth_token,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Lang         string `json:"lang"`
+	Version      string `json:"version"`
+	Protocol     int    `json:"protocol"`
+	Headers      bool   `json:"headers"`
+	NoResponders bool   `json:"no_responders"`
+}
+
+// pubAck is the JetStream reply to a published message.
+type pubAck struct {
+	Stream    string          `json:"stream"`
+	Seq       uint64          `json:"seq"`
+	Duplicate bool            `json:"duplicate"`
+	Error     *jetStreamError `json:"error"`
+}
+
+type jetStreamError struct {
+	Code        int    `json:"code"`
+	Description string `json:"description"`
+}
+
+// serverMsg is a message delivered to a subscription of the client.
+type serverMsg struct {
+	subject string
+	header  []byte
+	payload []byte
+}
+
+const (
+	ackPending = iota
+	ackStored
+	ackFailed
+)
+
+var (
+	errNoResponders = errors.New("no JetStream stream for subject")
+	crlf            = []byte("\r\n")
+)
+
+func newClient(
+	tc *transport.Client,
+	tls *transport.TLSConfig,
+	serverName string,
+	config *natsConfig,
+	subject outil.Selector,
+	msgID *outil.Selector,
+) *client {
+	return &client{
+		Client:     tc,
+		tls:        tls,
+		serverName: serverName,
+		options: connectOptions{
+			User:     config.Username,
+			Pass:     config.Password,
+			Token:    config.Token,
+			Name:     config.Name,
+			Lang:     "go",
+			Version:  "beats",
+			Protocol: 1,
+		},
+		subject:    subject,
+		msgID:      msgID,
+		timeout:    config.Timeout,
+		jetStream:  config.JetStream.Enabled,
+		ackTimeout: config.JetStream.AckTimeout,
+	}
+}
+
+func (c *client) Connect(to time.Duration) error {
+	debugf("connect")
+	err := c.Client.Connect()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			c.Client.Close()
+		}
+	}()
+
+	if to > 0 {
+		if err = c.Client.SetDeadline(time.Now().Add(to)); err != nil {
+			return err
+		}
+	}
+	if err = c.handshake(); err != nil {
+		return err
+	}
+	err = c.conn.SetDeadline(time.Time{})
+	return err
+}
+
+// handshake reads the INFO of the server, upgrading the connection to TLS
+// if configured, and authenticates with CONNECT.
+func (c *client) handshake() error {
+	c.conn = c.Client
+	c.reader = bufio.NewReader(c.conn)
+
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("nats: unexpected greeting %q", line)
+	}
+	c.info = serverInfo{}
+	if err := json.Unmarshal([]byte(line[len("INFO "):]), &c.info); err != nil {
+		return fmt.Errorf("nats: invalid INFO: %v", err)
+	}
+	debugf("connected to nats server %v version %v", c.info.ServerID, c.info.Version)
+
+	// NATS negotiates TLS after INFO, so the connection is upgraded here
+	// instead of being dialed with TLS by the transport.
+	switch {
+	case c.info.TLSRequired && c.tls == nil:
+		return errors.New("nats server requires TLS, configure output.nats.ssl")
+	case !c.info.TLSRequired && c.tls != nil:
+		return errors.New("nats server does not support TLS")
+	case c.tls != nil:
+		conn := tls.Client(c.Client, c.tls.BuildModuleConfig(c.serverName))
+		if err := conn.Handshake(); err != nil {
+			return err
+		}
+		c.conn = conn
+		c.reader = bufio.NewReader(conn)
+	}
+
+	options := c.options
+	c.headers = c.msgID != nil && c.info.Headers
+	if c.msgID != nil && !c.info.Headers {
+		logp.Warn("nats server %v does not support headers, publishing without message IDs",
+			c.info.ServerID)
+	}
+	options.Headers = c.headers
+	options.NoResponders = c.headers
+	connect, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("CONNECT ")
+	buf.Write(connect)
+	buf.Write(crlf)
+	if c.jetStream {
+		c.inbox = newInbox()
+		fmt.Fprintf(&buf, "SUB %v.* 1\r\n", c.inbox)
+	}
+	buf.WriteString("PING\r\n")
+	if _, err := c.conn.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	// the server answers an authorization failure with -ERR before the PONG
+	for {
+		pong, _, err := c.next()
+		if err != nil || pong {
+			return err
+		}
+	}
+}
+
+func (c *client) Close() error {
+	debugf("close connection")
+	return c.Client.Close()
+}
+
+func (c *client) PublishEvent(data outputs.Data) error {
+	_, err := c.PublishEvents([]outputs.Data{data})
+	return err
+}
+
+func (c *client) PublishEvents(data []outputs.Data) ([]outputs.Data, error) {
+	var buf bytes.Buffer
+	sent := make([]outputs.Data, 0, len(data))
+	for _, d := range data {
+		subject, err := c.subject.Select(d.Event)
+		if err == nil && !validSubject(subject) {
+			err = fmt.Errorf("invalid subject %q", subject)
+		}
+		if err != nil {
+			logp.Err("Failed to set nats subject: %v", err)
+			continue
+		}
+
+		payload, err := json.Marshal(d.Event)
+		if err != nil {
+			logp.Err("Failed to convert the event to JSON (%v): %#v", err, d.Event)
+			continue
+		}
+		if c.info.MaxPayload > 0 && len(payload) > c.info.MaxPayload {
+			logp.Err("Dropping event of %v bytes exceeding the nats max_payload of %v bytes",
+				len(payload), c.info.MaxPayload)
+			continue
+		}
+
+		var reply, msgID string
+		if c.jetStream {
+			reply = c.inbox + "." + strconv.Itoa(len(sent))
+		}
+		if c.headers {
+			msgID, _ = c.msgID.Select(d.Event)
+			if strings.ContainsAny(msgID, "\r\n") {
+				logp.Err("Ignoring nats message ID %q containing a line break", msgID)
+				msgID = ""
+			}
+		}
+		writePub(&buf, subject, reply, msgID, payload)
+		sent = append(sent, d)
+	}
+	if len(sent) == 0 {
+		return nil, nil
+	}
+	buf.WriteString("PING\r\n")
+
+	if c.timeout > 0 {
+		if err := c.conn.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+			return sent, err
+		}
+	}
+	if _, err := c.conn.Write(buf.Bytes()); err != nil {
+		return sent, err
+	}
+
+	if c.jetStream {
+		return c.waitAcks(sent)
+	}
+	if c.timeout > 0 {
+		if err := c.conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+			return sent, err
+		}
+	}
+	for {
+		pong, _, err := c.next()
+		if err != nil {
+			return sent, err
+		}
+		if pong {
+			return nil, nil
+		}
+	}
+}
+
+// waitAcks waits for the PONG and the acknowledgement of each message sent,
+// returning the messages JetStream failed to store or did not acknowledge
+// in time.
+func (c *client) waitAcks(sent []outputs.Data) ([]outputs.Data, error) {
+	if err := c.conn.SetReadDeadline(time.Now().Add(c.ackTimeout)); err != nil {
+		return sent, err
+	}
+
+	acks := make([]uint8, len(sent))
+	pending := len(sent)
+	pong := false
+	var err error
+	for err == nil && (!pong || pending > 0) {
+		var isPong bool
+		var msg *serverMsg
+		isPong, msg, err = c.next()
+		if err != nil || isPong {
+			pong = pong || isPong
+			continue
+		}
+
+		i, ok := c.ackIndex(msg.subject)
+		if !ok || i >= len(acks) || acks[i] != ackPending {
+			continue
+		}
+		pending--
+		if ackErr := parseAck(msg); ackErr != nil {
+			logp.Err("JetStream failed to store event: %v", ackErr)
+			acks[i] = ackFailed
+		} else {
+			acks[i] = ackStored
+		}
+	}
+
+	failed := sent[:0]
+	for i, ack := range acks {
+		if ack != ackStored {
+			failed = append(failed, sent[i])
+		}
+	}
+	if err == nil && len(failed) > 0 {
+		err = fmt.Errorf("JetStream failed to store %v of %v events", len(failed), len(sent))
+	}
+	if err != nil {
+		return failed, err
+	}
+	return nil, nil
+}
+
+// ackIndex returns the index in the batch of the message acknowledged to the
+// inbox subject.
+func (c *client) ackIndex(subject string) (int, bool) {
+	prefix := c.inbox + "."
+	if !strings.HasPrefix(subject, prefix) {
+		return 0, false
+	}
+	i, err := strconv.Atoi(subject[len(prefix):])
+	return i, err == nil
+}
+
+// parseAck returns the error of a JetStream acknowledgement.
+func parseAck(msg *serverMsg) error {
+	// a 503 status header tells no stream is bound to the subject
+	if bytes.HasPrefix(msg.header, []byte("NATS/1.0 503")) {
+		return errNoResponders
+	}
+
+	var ack pubAck
+	if err := json.Unmarshal(msg.payload, &ack); err != nil {
+		return fmt.Errorf("invalid acknowledgement: %v", err)
+	}
+	if ack.Error != nil {
+		return fmt.Errorf("%v (%v)", ack.Error.Description, ack.Error.Code)
+	}
+	if ack.Stream == "" {
+		return errors.New("acknowledgement without stream")
+	}
+	return nil
+}
+
+// next reads from the server up to the next PONG or message, answering the
+// PINGs of the server. A -ERR is returned as error.
+func (c *client) next() (bool, *serverMsg, error) {
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return false, nil, err
+		}
+
+		op := line
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			op = line[:i]
+		}
+		switch strings.ToUpper(op) {
+		case "PONG":
+			return true, nil, nil
+		case "PING":
+			if _, err := c.conn.Write([]byte("PONG\r\n")); err != nil {
+				return false, nil, err
+			}
+		case "+OK", "INFO":
+		case "-ERR":
+			reason := strings.Trim(strings.TrimSpace(line[len(op):]), "'")
+			return false, nil, fmt.Errorf("nats: %v", reason)
+		case "MSG", "HMSG":
+			msg, err := c.readMsg(line)
+			return false, msg, err
+		default:
+			return false, nil, fmt.Errorf("nats: unexpected %q", line)
+		}
+	}
+}
+
+// readMsg reads the payload of a MSG or HMSG, the line being
+// `MSG <subject> <sid> [reply-to] <#bytes>` or
+// `HMSG <subject> <sid> [reply-to] <#header bytes> <#total bytes>`.
+func (c *client) readMsg(line string) (*serverMsg, error) {
+	args := strings.Fields(line)
+	withHeader := strings.ToUpper(args[0]) == "HMSG"
+	minArgs := 4
+	if withHeader {
+		minArgs = 5
+	}
+	if len(args) < minArgs || len(args) > minArgs+1 {
+		return nil, fmt.Errorf("nats: invalid %q", line)
+	}
+
+	total, err := strconv.Atoi(args[len(args)-1])
+	if err != nil || total < 0 {
+		return nil, fmt.Errorf("nats: invalid %q", line)
+	}
+	headerLen := 0
+	if withHeader {
+		headerLen, err = strconv.Atoi(args[len(args)-2])
+		if err != nil || headerLen < 0 || headerLen > total {
+			return nil, fmt.Errorf("nats: invalid %q", line)
+		}
+	}
+
+	buf := make([]byte, total+len(crlf))
+	if _, err := io.ReadFull(c.reader, buf); err != nil {
+		return nil, err
+	}
+	return &serverMsg{
+		subject: args[1],
+		header:  buf[:headerLen],
+		payload: buf[headerLen:total],
+	}, nil
+}
+
+func (c *client) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// writePub appends a PUB, or a HPUB setting the Nats-Msg-Id header JetStream
+// deduplicates messages by, to buf.
+func writePub(buf *bytes.Buffer, subject, reply, msgID string, payload []byte) {
+	if msgID == "" {
+		buf.WriteString("PUB ")
+	} else {
+		buf.WriteString("HPUB ")
+	}
+	buf.WriteString(subject)
+	if reply != "" {
+		buf.WriteByte(' ')
+		buf.WriteString(reply)
+	}
+
+	var header string
+	if msgID != "" {
+		header = "NATS/1.0\r\nNats-Msg-Id: " + msgID + "\r\n\r\n"
+		fmt.Fprintf(buf, " %v", len(header))
+	}
+	fmt.Fprintf(buf, " %v\r\n", len(header)+len(payload))
+	buf.WriteString(header)
+	buf.Write(payload)
+	buf.Write(crlf)
+}
+
+// validSubject checks the subject is a valid subject to publish to, made of
+// non-empty tokens separated by dots without whitespace or wildcards.
+func validSubject(subject string) bool {
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n") {
+		return false
+	}
+	for _, token := range strings.Split(subject, ".") {
+		if token == "" || token == "*" || token == ">" {
+			return false
+		}
+	}
+	return true
+}
+
+// newInbox returns a unique subject prefix receiving the JetStream
+// acknowledgements of a connection.
+func newInbox() string {
+	id := make([]byte, 11)
+	if _, err := rand.Read(id); err != nil {
+		// fall back on the time, unique enough for the connections of a beat
+		return "_INBOX." + strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return "_INBOX." + hex.EncodeToString(id)
+}
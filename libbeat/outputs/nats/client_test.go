@@ -0,0 +1,299 @@
+//go:build !integration
+// +build !integration
+
+package nats
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/outputs"
+)
+
+// pub is a message published to the mock server.
+type pub struct {
+	subject string
+	reply   string
+	header  string
+	payload string
+}
+
+// mockServer speaks enough of the NATS protocol to accept one client,
+// answering the messages published with JetStream acknowledgements if ack is
+// set.
+type mockServer struct {
+	listener net.Listener
+	info     string
+	ack      func(p pub) string
+	connect  chan map[string]interface{}
+	pubs     chan pub
+}
+
+func newMockServer(t *testing.T, info string, ack func(p pub) string) *mockServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &mockServer{
+		listener: l,
+		info:     info,
+		ack:      ack,
+		connect:  make(chan map[string]interface{}, 1),
+		pubs:     make(chan pub, 100),
+	}
+	go s.serve()
+	return s
+}
+
+func (s *mockServer) Close() {
+	s.listener.Close()
+}
+
+func (s *mockServer) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(conn, "INFO %v\r\n", s.info)
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		args := strings.Fields(line)
+		switch args[0] {
+		case "CONNECT":
+			var options map[string]interface{}
+			json.Unmarshal([]byte(line[len("CONNECT "):]), &options)
+			s.connect <- options
+			if options["pass"] == "wrong" {
+				conn.Write([]byte("-ERR 'Authorization Violation'\r\n"))
+				return
+			}
+		case "SUB":
+		case "PING":
+			conn.Write([]byte("PONG\r\n"))
+		case "PUB", "HPUB":
+			p := pub{subject: args[1]}
+			if len(args) == 4 || (args[0] == "HPUB" && len(args) == 5) {
+				p.reply = args[2]
+			}
+			total, _ := strconv.Atoi(args[len(args)-1])
+			headerLen := 0
+			if args[0] == "HPUB" {
+				headerLen, _ = strconv.Atoi(args[len(args)-2])
+			}
+			buf := make([]byte, total+2)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return
+			}
+			p.header = string(buf[:headerLen])
+			p.payload = string(buf[headerLen:total])
+			s.pubs <- p
+
+			if s.ack != nil && p.reply != "" {
+				ack := s.ack(p)
+				fmt.Fprintf(conn, "MSG %v 1 %v\r\n%v\r\n", p.reply, len(ack), ack)
+			}
+		}
+	}
+}
+
+func newTestClient(t *testing.T, s *mockServer, settings map[string]interface{}) *client {
+	settings["hosts"] = []string{s.listener.Addr().String()}
+	cfg, err := common.NewConfigFrom(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &natsOut{beatName: "testbeat"}
+	if err := out.init(cfg); err != nil {
+		t.Fatal(err)
+	}
+	c, err := out.newConn(s.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func testEvents(n int) []outputs.Data {
+	var data []outputs.Data
+	for i := 0; i < n; i++ {
+		data = append(data, outputs.Data{Event: common.MapStr{
+			"id":  fmt.Sprintf("id%v", i),
+			"fix": common.MapStr{"session_name": "lse", "msg_type": "8"},
+		}})
+	}
+	return data
+}
+
+func TestPublish(t *testing.T) {
+	s := newMockServer(t, `{"server_id":"test","max_payload":1048576}`, nil)
+	defer s.Close()
+
+	c := newTestClient(t, s, map[string]interface{}{
+		"subject": "fix.%{[fix.session_name]}.%{[fix.msg_type]}",
+	})
+	if err := c.Connect(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	options := <-s.connect
+	assert.Equal(t, false, options["verbose"])
+	assert.Equal(t, false, options["headers"])
+
+	rest, err := c.PublishEvents(testEvents(2))
+	assert.NoError(t, err)
+	assert.Empty(t, rest)
+	for i := 0; i < 2; i++ {
+		p := <-s.pubs
+		assert.Equal(t, "fix.lse.8", p.subject)
+		assert.Empty(t, p.reply)
+		var event common.MapStr
+		assert.NoError(t, json.Unmarshal([]byte(p.payload), &event))
+		assert.Equal(t, fmt.Sprintf("id%v", i), event["id"])
+	}
+}
+
+func TestPublishDropsInvalidSubject(t *testing.T) {
+	s := newMockServer(t, `{"server_id":"test"}`, nil)
+	defer s.Close()
+
+	c := newTestClient(t, s, map[string]interface{}{"subject": "fix.%{[fix.session_name]}"})
+	if err := c.Connect(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	data := testEvents(2)
+	data[0].Event["fix"].(common.MapStr)["session_name"] = "lse uat"
+	rest, err := c.PublishEvents(data)
+	assert.NoError(t, err)
+	assert.Empty(t, rest)
+	assert.Equal(t, "fix.lse", (<-s.pubs).subject)
+	assert.Len(t, s.pubs, 0)
+}
+
+func TestConnectAuthorizationViolation(t *testing.T) {
+	s := newMockServer(t, `{"server_id":"test","auth_required":true}`, nil)
+	defer s.Close()
+
+	c := newTestClient(t, s, map[string]interface{}{
+		"username": "fixbeat",
+		"password": "wrong",
+	})
+	err := c.Connect(time.Second)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Authorization Violation")
+	}
+}
+
+func TestConnectRequiresTLS(t *testing.T) {
+	s := newMockServer(t, `{"server_id":"test","tls_required":true}`, nil)
+	defer s.Close()
+
+	c := newTestClient(t, s, map[string]interface{}{})
+	assert.Error(t, c.Connect(time.Second))
+}
+
+func TestPublishJetStream(t *testing.T) {
+	failed := false
+	s := newMockServer(t, `{"server_id":"test","headers":true}`, func(p pub) string {
+		// the stream fails to store id1 once
+		if strings.Contains(p.payload, `"id1"`) && !failed {
+			failed = true
+			return `{"error":{"code":503,"description":"insufficient resources"}}`
+		}
+		return `{"stream":"FIX","seq":1}`
+	})
+	defer s.Close()
+
+	c := newTestClient(t, s, map[string]interface{}{
+		"subject":   "fix",
+		"msg_id":    "%{[id]}",
+		"jetstream": map[string]interface{}{"enabled": true},
+	})
+	if err := c.Connect(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	options := <-s.connect
+	assert.Equal(t, true, options["headers"])
+
+	data := testEvents(3)
+	rest, err := c.PublishEvents(data)
+	assert.Error(t, err)
+	if assert.Len(t, rest, 1) {
+		assert.Equal(t, "id1", rest[0].Event["id"])
+	}
+	for i := 0; i < 3; i++ {
+		p := <-s.pubs
+		assert.True(t, strings.HasPrefix(p.reply, c.inbox+"."))
+		assert.Equal(t, fmt.Sprintf("NATS/1.0\r\nNats-Msg-Id: id%v\r\n\r\n", i), p.header)
+	}
+
+	// the failed event stored on retry
+	rest, err = c.PublishEvents(rest)
+	assert.NoError(t, err)
+	assert.Empty(t, rest)
+}
+
+func TestPublishJetStreamAckTimeout(t *testing.T) {
+	s := newMockServer(t, `{"server_id":"test"}`, nil)
+	defer s.Close()
+
+	c := newTestClient(t, s, map[string]interface{}{
+		"jetstream": map[string]interface{}{"enabled": true, "ack_timeout": "50ms"},
+	})
+	if err := c.Connect(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	data := testEvents(2)
+	rest, err := c.PublishEvents(data)
+	assert.Error(t, err)
+	assert.Len(t, rest, 2)
+}
+
+func TestValidSubject(t *testing.T) {
+	for subject, valid := range map[string]bool{
+		"fixbeat":       true,
+		"fix.lse.8":     true,
+		"":              false,
+		"fix..8":        false,
+		"fix.":          false,
+		"fix.*":         false,
+		"fix.>":         false,
+		"fix.lse uat.8": false,
+	} {
+		assert.Equal(t, valid, validSubject(subject), subject)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	config := defaultConfig
+	assert.NoError(t, config.Validate())
+
+	config.Token = "secret"
+	config.Username = "fixbeat"
+	assert.Error(t, config.Validate())
+
+	config = defaultConfig
+	config.Password = "secret"
+	assert.Error(t, config.Validate())
+}
@@ -0,0 +1,57 @@
+package nats
+
+import (
+	"errors"
+	"time"
+
+	"github.com/elastic/beats/libbeat/outputs"
+	"github.com/elastic/beats/libbeat/outputs/transport"
+)
+
+type natsConfig struct {
+	Port        int                   `config:"port"`
+	LoadBalance bool                  `config:"loadbalance"`
+	Timeout     time.Duration         `config:"timeout"`
+	MaxRetries  int                   `config:"max_retries"`
+	TLS         *outputs.TLSConfig    `config:"ssl"`
+	Proxy       transport.ProxyConfig `config:",inline"`
+
+	Username string `config:"username"`
+	Password string `config:"password"`
+	Token    string `config:"token"`
+	Name     string `config:"name"`
+
+	JetStream jetStreamConfig `config:"jetstream"`
+}
+
+type jetStreamConfig struct {
+	Enabled    bool          `config:"enabled"`
+	AckTimeout time.Duration `config:"ack_timeout"`
+}
+
+var (
+	defaultConfig = natsConfig{
+		Port:        4222,
+		LoadBalance: true,
+		Timeout:     5 * time.Second,
+		MaxRetries:  3,
+		TLS:         nil,
+		JetStream: jetStreamConfig{
+			Enabled:    false,
+			AckTimeout: 5 * time.Second,
+		},
+	}
+)
+
+func (c *natsConfig) Validate() error {
+	if c.Token != "" && c.Username != "" {
+		return errors.New("Cannot use both `output.nats.token` and `output.nats.username` configuration options")
+	}
+	if c.Password != "" && c.Username == "" {
+		return errors.New("`output.nats.password` requires `output.nats.username`")
+	}
+	if c.JetStream.Enabled && c.JetStream.AckTimeout <= 0 {
+		return errors.New("`output.nats.jetstream.ack_timeout` must be positive")
+	}
+	return nil
+}
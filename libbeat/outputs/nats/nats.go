@@ -0,0 +1,193 @@
+package nats
+
+import (
+	"expvar"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/common/op"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/outputs"
+	"github.com/elastic/beats/libbeat/outputs/mode"
+	"github.com/elastic/beats/libbeat/outputs/mode/modeutil"
+	"github.com/elastic/beats/libbeat/outputs/outil"
+	"github.com/elastic/beats/libbeat/outputs/transport"
+)
+
+type natsOut struct {
+	mode     mode.ConnectionMode
+	beatName string
+
+	hosts   []string
+	newConn func(host string) (*client, error)
+}
+
+var debugf = logp.MakeDebug("nats")
+
+// Metrics that can retrieved through the expvar web interface.
+var (
+	statReadBytes   = expvar.NewInt("libbeat.nats.publish.read_bytes")
+	statWriteBytes  = expvar.NewInt("libbeat.nats.publish.write_bytes")
+	statReadErrors  = expvar.NewInt("libbeat.nats.publish.read_errors")
+	statWriteErrors = expvar.NewInt("libbeat.nats.publish.write_errors")
+)
+
+const (
+	defaultWaitRetry    = 1 * time.Second
+	defaultMaxWaitRetry = 60 * time.Second
+)
+
+func init() {
+	outputs.RegisterOutputPlugin("nats", new)
+}
+
+func new(beatName string, cfg *common.Config, _ int) (outputs.Outputer, error) {
+	n := &natsOut{beatName: beatName}
+	if err := n.init(cfg); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func (n *natsOut) init(cfg *common.Config) error {
+	config := defaultConfig
+	if err := cfg.Unpack(&config); err != nil {
+		return err
+	}
+
+	sendRetries := config.MaxRetries
+	maxAttempts := config.MaxRetries + 1
+	if sendRetries < 0 {
+		maxAttempts = 0
+	}
+
+	if !cfg.HasField("subject") {
+		cfg.SetString("subject", -1, n.beatName)
+	}
+	subject, err := outil.BuildSelectorFromConfig(cfg, outil.Settings{
+		Key:              "subject",
+		MultiKey:         "subjects",
+		EnableSingleOnly: true,
+		FailEmpty:        true,
+	})
+	if err != nil {
+		return err
+	}
+
+	var msgID *outil.Selector
+	if config.JetStream.Enabled {
+		sel, err := outil.BuildSelectorFromConfig(cfg, outil.Settings{
+			Key:              "msg_id",
+			EnableSingleOnly: true,
+		})
+		if err != nil {
+			return err
+		}
+		if !sel.IsEmpty() {
+			msgID = &sel
+		}
+	}
+
+	tls, err := outputs.LoadTLSConfig(config.TLS)
+	if err != nil {
+		return err
+	}
+
+	// the connection is upgraded to TLS by the client after INFO
+	transp := &transport.Config{
+		Timeout: config.Timeout,
+		Proxy:   &config.Proxy,
+		Stats: &transport.IOStats{
+			Read:        statReadBytes,
+			Write:       statWriteBytes,
+			ReadErrors:  statReadErrors,
+			WriteErrors: statWriteErrors,
+		},
+	}
+
+	n.newConn = func(host string) (*client, error) {
+		t, err := transport.NewClient(transp, "tcp", host, config.Port)
+		if err != nil {
+			return nil, err
+		}
+		serverName := host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			serverName = h
+		}
+		return newClient(t, tls, serverName, &config, subject, msgID), nil
+	}
+
+	n.hosts, err = modeutil.ReadHostList(cfg)
+	if err != nil {
+		return err
+	}
+
+	// configure publisher clients
+	clients, err := modeutil.MakeClients(cfg, func(host string) (mode.ProtocolClient, error) {
+		return n.newConn(host)
+	})
+	if err != nil {
+		return err
+	}
+
+	logp.Info("Max Retries set to: %v", sendRetries)
+	m, err := modeutil.NewConnectionMode(clients, modeutil.Settings{
+		Failover:     !config.LoadBalance,
+		MaxAttempts:  maxAttempts,
+		Timeout:      config.Timeout,
+		WaitRetry:    defaultWaitRetry,
+		MaxWaitRetry: defaultMaxWaitRetry,
+	})
+	if err != nil {
+		return err
+	}
+
+	n.mode = m
+	return nil
+}
+
+// TestConnection connects to each NATS server, checking it is reachable and
+// accepts the configured TLS settings and credentials.
+func (n *natsOut) TestConnection(timeout time.Duration) error {
+	tested := map[string]bool{}
+	for _, host := range n.hosts {
+		// hosts are listed once per worker
+		if tested[host] {
+			continue
+		}
+		tested[host] = true
+
+		c, err := n.newConn(host)
+		if err != nil {
+			return fmt.Errorf("%v: %v", host, err)
+		}
+		if err := c.Connect(timeout); err != nil {
+			return fmt.Errorf("%v: %v", host, err)
+		}
+		c.Close()
+		logp.Info("NATS server %v is reachable", host)
+	}
+	return nil
+}
+
+func (n *natsOut) Close() error {
+	return n.mode.Close()
+}
+
+func (n *natsOut) PublishEvent(
+	signaler op.Signaler,
+	opts outputs.Options,
+	data outputs.Data,
+) error {
+	return n.mode.PublishEvent(signaler, opts, data)
+}
+
+func (n *natsOut) BulkPublish(
+	signaler op.Signaler,
+	opts outputs.Options,
+	data []outputs.Data,
+) error {
+	return n.mode.PublishEvents(signaler, opts, data)
+}
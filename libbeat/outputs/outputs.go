@@ -1,6 +1,8 @@
 package outputs
 
 import (
+	"time"
+
 	"github.com/elastic/beats/libbeat/common"
 	"github.com/elastic/beats/libbeat/common/op"
 	"github.com/elastic/beats/libbeat/logp"
@@ -51,6 +53,12 @@ type BulkOutputer interface {
 	BulkPublish(sig op.Signaler, opts Options, data []Data) error
 }
 
+// Tester is implemented by the outputs able to check their hosts are
+// reachable with the configured settings, for -configtest.output.
+type Tester interface {
+	TestConnection(timeout time.Duration) error
+}
+
 // Create and initialize the output plugin
 type OutputBuilder func(beatName string, config *common.Config, topologyExpire int) (Outputer, error)
 
@@ -118,6 +126,25 @@ func CastBulkOutputer(out Outputer) BulkOutputer {
 	return &bulkOutputAdapter{out}
 }
 
+// UnwrapBulkOutputer returns the output wrapped by CastBulkOutputer, or out
+// itself if it has not been wrapped.
+func UnwrapBulkOutputer(out Outputer) Outputer {
+	if adapter, ok := out.(*bulkOutputAdapter); ok {
+		return adapter.Outputer
+	}
+	return out
+}
+
+// TestOutput checks the hosts of out are reachable. False is returned if out
+// does not implement the Tester interface.
+func TestOutput(out Outputer, timeout time.Duration) (bool, error) {
+	tester, ok := UnwrapBulkOutputer(out).(Tester)
+	if !ok {
+		return false, nil
+	}
+	return true, tester.TestConnection(timeout)
+}
+
 func (b *bulkOutputAdapter) BulkPublish(
 	signal op.Signaler,
 	opts Options,
@@ -0,0 +1,20 @@
+package route
+
+import (
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/processors"
+)
+
+type config struct {
+	// routes checked in order, events being published to the output of the
+	// first route matching
+	Routes []routeConfig `config:"routes" validate:"required"`
+}
+
+type routeConfig struct {
+	// events routed, all events if unset
+	When *processors.ConditionConfig `config:"when"`
+
+	// single output of the route
+	Output map[string]*common.Config `config:"output" validate:"required"`
+}
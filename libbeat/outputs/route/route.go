@@ -0,0 +1,176 @@
+package route
+
+import (
+	"expvar"
+	"fmt"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/common/op"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/outputs"
+	"github.com/elastic/beats/libbeat/processors"
+)
+
+func init() {
+	outputs.RegisterOutputPlugin("route", New)
+}
+
+var debugf = logp.MakeDebug("route")
+
+var (
+	routedEvents   = expvar.NewInt("libbeat.route.events")
+	unroutedEvents = expvar.NewInt("libbeat.route.unrouted")
+)
+
+// router publishes each event to the output of the first route matching it,
+// for several output instances, even of the same type, to receive separate
+// sets of events. Events matching no route are dropped.
+type router struct {
+	routes []route
+}
+
+type route struct {
+	name string
+	cond *processors.Condition
+	out  outputs.BulkOutputer
+}
+
+// New creates the route output from the conditions and outputs of its
+// routes.
+func New(beatName string, cfg *common.Config, topologyExpire int) (outputs.Outputer, error) {
+	var config config
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, err
+	}
+
+	r := &router{}
+	for i, rc := range config.Routes {
+		rt, err := newRoute(i, beatName, rc, topologyExpire)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.routes = append(r.routes, rt)
+	}
+	logp.Info("Route output publishing to %d outputs", len(r.routes))
+	return r, nil
+}
+
+// newRoute creates the condition and the single output enabled in the config
+// of route i.
+func newRoute(i int, beatName string, config routeConfig, topologyExpire int) (route, error) {
+	cond, err := processors.NewCondition(config.When)
+	if err != nil {
+		return route{}, fmt.Errorf("route %d: invalid condition: %v", i, err)
+	}
+
+	var name string
+	var outConfig *common.Config
+	for outName, c := range config.Output {
+		if !c.Enabled() {
+			continue
+		}
+		if outConfig != nil {
+			return route{}, fmt.Errorf("route %d must configure a single output, got %s and %s",
+				i, name, outName)
+		}
+		name, outConfig = outName, c
+	}
+	if outConfig == nil {
+		return route{}, fmt.Errorf("route %d output missing", i)
+	}
+
+	builder := outputs.FindOutputPlugin(name)
+	if builder == nil || name == "route" {
+		return route{}, fmt.Errorf("route %d: unknown output type %s", i, name)
+	}
+	out, err := builder(beatName, outConfig, topologyExpire)
+	if err != nil {
+		return route{}, fmt.Errorf("route %d: failed to initialize %s output: %v", i, name, err)
+	}
+	return route{
+		name: fmt.Sprintf("%d (%s)", i, name),
+		cond: cond,
+		out:  outputs.CastBulkOutputer(out),
+	}, nil
+}
+
+func (r *router) Close() error {
+	var err error
+	for _, rt := range r.routes {
+		if cerr := rt.out.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (r *router) PublishEvent(sig op.Signaler, opts outputs.Options, data outputs.Data) error {
+	return r.BulkPublish(sig, opts, []outputs.Data{data})
+}
+
+// BulkPublish splits the batch by route, publishing the events of each route
+// to its output. The batch is signaled once all outputs are done, failed if
+// any output failed.
+func (r *router) BulkPublish(sig op.Signaler, opts outputs.Options, data []outputs.Data) error {
+	batches := r.split(data)
+	count := 0
+	for _, batch := range batches {
+		if len(batch) > 0 {
+			count++
+		}
+	}
+	if count == 0 {
+		op.SigCompleted(sig)
+		return nil
+	}
+
+	sig = op.SplitSignaler(sig, count)
+	for i, batch := range batches {
+		if len(batch) == 0 {
+			continue
+		}
+		debugf("route %s: publish %v events", r.routes[i].name, len(batch))
+		if err := r.routes[i].out.BulkPublish(sig, opts, batch); err != nil {
+			logp.Info("Error publishing events to route %s: %v", r.routes[i].name, err)
+		}
+	}
+	return nil
+}
+
+// split returns the events of data per route, dropping the events matching
+// no route.
+func (r *router) split(data []outputs.Data) [][]outputs.Data {
+	batches := make([][]outputs.Data, len(r.routes))
+	for _, d := range data {
+		i := r.match(d.Event)
+		if i < 0 {
+			unroutedEvents.Add(1)
+			continue
+		}
+		routedEvents.Add(1)
+		batches[i] = append(batches[i], d)
+	}
+	return batches
+}
+
+// match returns the index of the first route matching event, or -1.
+func (r *router) match(event common.MapStr) int {
+	for i := range r.routes {
+		if cond := r.routes[i].cond; cond == nil || cond.Check(event) {
+			return i
+		}
+	}
+	return -1
+}
+
+// TestConnection checks the outputs of all routes are reachable.
+func (r *router) TestConnection(timeout time.Duration) error {
+	for _, rt := range r.routes {
+		if _, err := outputs.TestOutput(rt.out, timeout); err != nil {
+			return fmt.Errorf("route %s: %v", rt.name, err)
+		}
+	}
+	return nil
+}
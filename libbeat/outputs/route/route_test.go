@@ -0,0 +1,180 @@
+//go:build !integration
+// +build !integration
+
+package route
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/common/op"
+	"github.com/elastic/beats/libbeat/outputs"
+	"github.com/elastic/beats/libbeat/processors"
+
+	_ "github.com/elastic/beats/libbeat/outputs/console"
+	_ "github.com/elastic/beats/libbeat/outputs/fileout"
+)
+
+// mockOutput records the events published, failing them while down.
+type mockOutput struct {
+	down    bool
+	testErr error
+	events  []common.MapStr
+	closed  bool
+}
+
+func (m *mockOutput) PublishEvent(sig op.Signaler, opts outputs.Options, data outputs.Data) error {
+	return m.BulkPublish(sig, opts, []outputs.Data{data})
+}
+
+func (m *mockOutput) BulkPublish(sig op.Signaler, opts outputs.Options, data []outputs.Data) error {
+	if m.down {
+		op.SigFailed(sig, errors.New("down"))
+		return nil
+	}
+	for _, d := range data {
+		m.events = append(m.events, d.Event)
+	}
+	op.SigCompleted(sig)
+	return nil
+}
+
+func (m *mockOutput) TestConnection(timeout time.Duration) error {
+	return m.testErr
+}
+
+func (m *mockOutput) Close() error {
+	m.closed = true
+	return nil
+}
+
+func tenantCondition(t *testing.T, tenant string) *processors.Condition {
+	cfg, err := common.NewConfigFrom(map[string]interface{}{
+		"equals": map[string]interface{}{"fix.tenant": tenant},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config processors.ConditionConfig
+	if err := cfg.Unpack(&config); err != nil {
+		t.Fatal(err)
+	}
+	cond, err := processors.NewCondition(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cond
+}
+
+func newTestRouter(t *testing.T, equities, fx, other *mockOutput) *router {
+	r := &router{routes: []route{
+		{name: "equities", cond: tenantCondition(t, "equities"), out: equities},
+		{name: "fx", cond: tenantCondition(t, "fx"), out: fx},
+	}}
+	if other != nil {
+		r.routes = append(r.routes, route{name: "other", out: other})
+	}
+	return r
+}
+
+func tenantEvent(tenant string) outputs.Data {
+	return outputs.Data{Event: common.MapStr{"type": "fix", "fix": common.MapStr{"tenant": tenant}}}
+}
+
+func publish(t *testing.T, r *router, data ...outputs.Data) op.SignalResponse {
+	sig := op.NewSignalChannel()
+	assert.NoError(t, r.BulkPublish(sig, outputs.Options{}, data))
+	return sig.Wait()
+}
+
+func TestRouterSplitsBatch(t *testing.T) {
+	equities, fx, other := &mockOutput{}, &mockOutput{}, &mockOutput{}
+	r := newTestRouter(t, equities, fx, other)
+
+	assert.Equal(t, op.SignalCompleted, publish(t, r,
+		tenantEvent("equities"), tenantEvent("fx"), tenantEvent("rates"), tenantEvent("equities")))
+	assert.Len(t, equities.events, 2)
+	assert.Len(t, fx.events, 1)
+	// the route without condition receives the other events
+	assert.Len(t, other.events, 1)
+}
+
+func TestRouterDropsUnrouted(t *testing.T) {
+	equities, fx := &mockOutput{}, &mockOutput{}
+	r := newTestRouter(t, equities, fx, nil)
+
+	unrouted := unroutedEvents.Value()
+	assert.Equal(t, op.SignalCompleted, publish(t, r, tenantEvent("rates"), tenantEvent("fx")))
+	assert.Len(t, fx.events, 1)
+	assert.Equal(t, unrouted+1, unroutedEvents.Value())
+
+	assert.Equal(t, op.SignalCompleted, publish(t, r, tenantEvent("rates")))
+	assert.Empty(t, equities.events)
+}
+
+func TestRouterFailure(t *testing.T) {
+	equities, fx := &mockOutput{}, &mockOutput{down: true}
+	r := newTestRouter(t, equities, fx, nil)
+
+	// the batch fails if any output fails
+	assert.Equal(t, op.SignalFailed, publish(t, r, tenantEvent("equities"), tenantEvent("fx")))
+	assert.Len(t, equities.events, 1)
+}
+
+func TestRouterTestConnection(t *testing.T) {
+	equities, fx := &mockOutput{}, &mockOutput{}
+	r := newTestRouter(t, equities, fx, nil)
+	assert.NoError(t, r.TestConnection(time.Second))
+
+	fx.testErr = errors.New("unreachable")
+	assert.Error(t, r.TestConnection(time.Second))
+
+	assert.NoError(t, r.Close())
+	assert.True(t, equities.closed)
+	assert.True(t, fx.closed)
+}
+
+func TestNewRouteConfig(t *testing.T) {
+	for _, test := range []struct {
+		config map[string]interface{}
+		ok     bool
+	}{
+		{map[string]interface{}{"routes": []interface{}{
+			map[string]interface{}{
+				"when":   map[string]interface{}{"equals": map[string]interface{}{"fix.tenant": "fx"}},
+				"output": map[string]interface{}{"console": map[string]interface{}{}},
+			},
+			map[string]interface{}{
+				"output": map[string]interface{}{"console": map[string]interface{}{"pretty": true}},
+			},
+		}}, true},
+		{map[string]interface{}{}, false},
+		{map[string]interface{}{"routes": []interface{}{
+			map[string]interface{}{"output": map[string]interface{}{
+				"console": map[string]interface{}{},
+				"file":    map[string]interface{}{"path": "/tmp"},
+			}},
+		}}, false},
+		{map[string]interface{}{"routes": []interface{}{
+			map[string]interface{}{"output": map[string]interface{}{"route": map[string]interface{}{}}},
+		}}, false},
+	} {
+		cfg, err := common.NewConfigFrom(test.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := New("test", cfg, 0)
+		if !test.ok {
+			assert.Error(t, err, "%v", test.config)
+			continue
+		}
+		if assert.NoError(t, err) {
+			assert.Len(t, out.(*router).routes, 2)
+			out.Close()
+		}
+	}
+}
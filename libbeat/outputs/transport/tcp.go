@@ -9,6 +9,19 @@ import (
 )
 
 func NetDialer(timeout time.Duration) Dialer {
+	return netDialer(&net.Dialer{Timeout: timeout})
+}
+
+// KeepAliveDialer is a NetDialer enabling TCP keep-alives with the given
+// period. Keep-alives are disabled if keepAlive is 0.
+func KeepAliveDialer(timeout, keepAlive time.Duration) Dialer {
+	if keepAlive == 0 {
+		keepAlive = -1
+	}
+	return netDialer(&net.Dialer{Timeout: timeout, KeepAlive: keepAlive})
+}
+
+func netDialer(dialer *net.Dialer) Dialer {
 	return DialerFunc(func(network, address string) (net.Conn, error) {
 		switch network {
 		case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6":
@@ -28,7 +41,6 @@ func NetDialer(timeout time.Duration) Dialer {
 		}
 
 		// dial via host IP by randomized iteration of known IPs
-		dialer := &net.Dialer{Timeout: timeout}
 		return dialWith(dialer, network, host, addresses, port)
 	})
 }
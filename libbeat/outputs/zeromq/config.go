@@ -0,0 +1,44 @@
+package zeromq
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+type config struct {
+	Bind         string        `config:"bind" validate:"required"`
+	SendHWM      int           `config:"send_hwm" validate:"min=1"`
+	WriteTimeout time.Duration `config:"write_timeout"`
+}
+
+var (
+	defaultConfig = config{
+		Bind:         "tcp://127.0.0.1:5556",
+		SendHWM:      1000,
+		WriteTimeout: 5 * time.Second,
+	}
+)
+
+func (c *config) Validate() error {
+	_, err := listenAddress(c.Bind)
+	return err
+}
+
+// listenAddress returns the address to listen on of a ZeroMQ tcp endpoint,
+// like tcp://*:5556 or tcp://127.0.0.1:5556.
+func listenAddress(endpoint string) (string, error) {
+	const scheme = "tcp://"
+	if !strings.HasPrefix(endpoint, scheme) {
+		return "", fmt.Errorf("zeromq endpoint %v not supported, only tcp:// endpoints are", endpoint)
+	}
+	addr := endpoint[len(scheme):]
+	if strings.HasPrefix(addr, "*:") {
+		addr = addr[1:]
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return "", fmt.Errorf("invalid zeromq endpoint %v: %v", endpoint, err)
+	}
+	return addr, nil
+}
@@ -0,0 +1,394 @@
+package zeromq
+
+import (
+	"bufio"
+	"encoding/json"
+	"expvar"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/common/op"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/outputs"
+	"github.com/elastic/beats/libbeat/outputs/outil"
+)
+
+// zeromqOut is a ZeroMQ PUB socket bound to the configured endpoint. The
+// events are sent to the subscribers connected with SUB sockets as messages
+// of two frames, the topic and the event as JSON. Like a PUB socket, events
+// are dropped for the subscribers not keeping up, once send_hwm messages are
+// queued for them, and no subscriber receives the events published before it
+// connected.
+type zeromqOut struct {
+	topic        outil.Selector
+	hwm          int
+	writeTimeout time.Duration
+	listener     net.Listener
+
+	mutex  sync.Mutex
+	peers  map[*peer]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// peer is a subscriber connected to the output.
+type peer struct {
+	conn  net.Conn
+	out   chan []byte
+	done  chan struct{}
+	close sync.Once
+
+	// set by the output once the handshake completed
+	ready bool
+
+	mutex sync.Mutex
+	subs  map[string]int
+}
+
+var debugf = logp.MakeDebug("zeromq")
+
+// Metrics that can retrieved through the expvar web interface.
+var (
+	statSubscribers = expvar.NewInt("libbeat.zeromq.subscribers")
+	statPublished   = expvar.NewInt("libbeat.zeromq.published_events")
+	statDropped     = expvar.NewInt("libbeat.zeromq.dropped_events")
+)
+
+func init() {
+	outputs.RegisterOutputPlugin("zeromq", New)
+}
+
+// New binds a ZeroMQ PUB socket publishing the events.
+func New(beatName string, cfg *common.Config, _ int) (outputs.Outputer, error) {
+	config := defaultConfig
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, err
+	}
+
+	if !cfg.HasField("topic") {
+		cfg.SetString("topic", -1, beatName)
+	}
+	topic, err := outil.BuildSelectorFromConfig(cfg, outil.Settings{
+		Key:              "topic",
+		MultiKey:         "topics",
+		EnableSingleOnly: true,
+		FailEmpty:        true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	addr, err := listenAddress(config.Bind)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	logp.Info("ZeroMQ output publishing on %v", listener.Addr())
+
+	out := &zeromqOut{
+		topic:        topic,
+		hwm:          config.SendHWM,
+		writeTimeout: config.WriteTimeout,
+		listener:     listener,
+		peers:        map[*peer]struct{}{},
+	}
+	out.wg.Add(1)
+	go out.accept()
+	return out, nil
+}
+
+func (out *zeromqOut) accept() {
+	defer out.wg.Done()
+	for {
+		conn, err := out.listener.Accept()
+		if err != nil {
+			out.mutex.Lock()
+			closed := out.closed
+			out.mutex.Unlock()
+			if closed {
+				return
+			}
+			logp.Err("ZeroMQ output failed to accept subscriber: %v", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		p := &peer{
+			conn: conn,
+			out:  make(chan []byte, out.hwm),
+			done: make(chan struct{}),
+			subs: map[string]int{},
+		}
+
+		// the peer is closed on Close while in the handshake too, without
+		// subscriptions nothing being sent to it
+		out.mutex.Lock()
+		if out.closed {
+			out.mutex.Unlock()
+			conn.Close()
+			return
+		}
+		out.peers[p] = struct{}{}
+		out.mutex.Unlock()
+
+		out.wg.Add(1)
+		go out.serve(p)
+	}
+}
+
+// serve runs the handshake with a subscriber, then reads its subscriptions
+// while the messages queued for it are written.
+func (out *zeromqOut) serve(p *peer) {
+	defer out.wg.Done()
+	defer out.remove(p)
+
+	r := bufio.NewReader(p.conn)
+	if err := out.handshake(p, r); err != nil {
+		logp.Warn("ZeroMQ subscriber %v rejected: %v", p.conn.RemoteAddr(), err)
+		return
+	}
+
+	out.mutex.Lock()
+	p.ready = true
+	out.mutex.Unlock()
+	statSubscribers.Add(1)
+	debugf("subscriber %v connected", p.conn.RemoteAddr())
+
+	out.wg.Add(1)
+	go out.write(p)
+
+	if err := p.readSubscriptions(r); err != nil {
+		debugf("subscriber %v disconnected: %v", p.conn.RemoteAddr(), err)
+	}
+}
+
+func (out *zeromqOut) handshake(p *peer, r *bufio.Reader) error {
+	if out.writeTimeout > 0 {
+		p.conn.SetDeadline(time.Now().Add(out.writeTimeout))
+	}
+	if _, err := p.conn.Write(greeting()); err != nil {
+		return err
+	}
+	if err := readGreeting(r); err != nil {
+		return err
+	}
+	if _, err := p.conn.Write(readyCommand("PUB")); err != nil {
+		return err
+	}
+
+	flags, body, err := readFrame(r, maxPeerFrame)
+	if err != nil {
+		return err
+	}
+	name, data, err := parseCommand(body)
+	if err != nil || flags&flagCommand == 0 || name != "READY" {
+		return errProtocol
+	}
+	props, err := parseMetadata(data)
+	if err != nil {
+		return err
+	}
+	switch socketType := props["socket-type"]; socketType {
+	case "SUB", "XSUB":
+	default:
+		reason := "invalid socket type " + socketType
+		p.conn.Write(appendCommand(nil, "ERROR", append([]byte{byte(len(reason))}, reason...)))
+		return errProtocol
+	}
+	return p.conn.SetDeadline(time.Time{})
+}
+
+// readSubscriptions updates the subscriptions of the peer until the
+// connection is closed.
+func (p *peer) readSubscriptions(r *bufio.Reader) error {
+	for {
+		flags, body, err := readFrame(r, maxPeerFrame)
+		if err != nil {
+			return err
+		}
+
+		if flags&flagCommand == 0 {
+			// ZMTP 3.0 subscriptions are messages starting with 1 to
+			// subscribe, 0 to cancel
+			if len(body) == 0 {
+				continue
+			}
+			switch body[0] {
+			case 1:
+				p.subscribe(string(body[1:]), true)
+			case 0:
+				p.subscribe(string(body[1:]), false)
+			}
+			continue
+		}
+
+		name, data, err := parseCommand(body)
+		if err != nil {
+			return err
+		}
+		switch name {
+		case "SUBSCRIBE":
+			p.subscribe(string(data), true)
+		case "CANCEL":
+			p.subscribe(string(data), false)
+		case "PING":
+			// the reply carries the context after the TTL of the PING
+			if len(data) < 2 {
+				return errProtocol
+			}
+			p.send(appendCommand(nil, "PONG", data[2:]))
+		case "ERROR":
+			return errProtocol
+		}
+	}
+}
+
+func (p *peer) subscribe(prefix string, add bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if add {
+		p.subs[prefix]++
+		return
+	}
+	if p.subs[prefix] <= 1 {
+		delete(p.subs, prefix)
+	} else {
+		p.subs[prefix]--
+	}
+}
+
+// subscribed checks a subscription of the peer is a prefix of the topic.
+func (p *peer) subscribed(topic string) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for prefix := range p.subs {
+		if strings.HasPrefix(topic, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// send queues the wire for the peer, dropping it if send_hwm messages are
+// queued already.
+func (p *peer) send(wire []byte) bool {
+	select {
+	case p.out <- wire:
+		return true
+	default:
+		return false
+	}
+}
+
+func (out *zeromqOut) write(p *peer) {
+	defer out.wg.Done()
+	for {
+		select {
+		case <-p.done:
+			return
+		case wire := <-p.out:
+			if out.writeTimeout > 0 {
+				p.conn.SetWriteDeadline(time.Now().Add(out.writeTimeout))
+			}
+			if _, err := p.conn.Write(wire); err != nil {
+				debugf("failed to write to subscriber %v: %v", p.conn.RemoteAddr(), err)
+				out.remove(p)
+				return
+			}
+		}
+	}
+}
+
+func (out *zeromqOut) remove(p *peer) {
+	p.close.Do(func() {
+		close(p.done)
+		p.conn.Close()
+
+		out.mutex.Lock()
+		delete(out.peers, p)
+		if p.ready {
+			statSubscribers.Add(-1)
+		}
+		out.mutex.Unlock()
+	})
+}
+
+// publish sends the event to the subscribers of its topic.
+func (out *zeromqOut) publish(data outputs.Data) {
+	topic, err := out.topic.Select(data.Event)
+	if err != nil {
+		logp.Err("Failed to set zeromq topic: %v", err)
+		return
+	}
+
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+
+	// the event is encoded once, for the first subscriber of its topic
+	var wire []byte
+	for p := range out.peers {
+		if !p.subscribed(topic) {
+			continue
+		}
+		if wire == nil {
+			payload, err := json.Marshal(data.Event)
+			if err != nil {
+				logp.Err("Failed to convert the event to JSON (%v): %#v", err, data.Event)
+				return
+			}
+			wire = encodeMessage(topic, payload)
+		}
+		if !p.send(wire) {
+			statDropped.Add(1)
+		}
+	}
+	statPublished.Add(1)
+}
+
+// Implement Outputer
+func (out *zeromqOut) Close() error {
+	out.mutex.Lock()
+	out.closed = true
+	peers := make([]*peer, 0, len(out.peers))
+	for p := range out.peers {
+		peers = append(peers, p)
+	}
+	out.mutex.Unlock()
+
+	err := out.listener.Close()
+	for _, p := range peers {
+		out.remove(p)
+	}
+	out.wg.Wait()
+	return err
+}
+
+func (out *zeromqOut) PublishEvent(
+	sig op.Signaler,
+	opts outputs.Options,
+	data outputs.Data,
+) error {
+	out.publish(data)
+	op.SigCompleted(sig)
+	return nil
+}
+
+func (out *zeromqOut) BulkPublish(
+	sig op.Signaler,
+	opts outputs.Options,
+	data []outputs.Data,
+) error {
+	for _, d := range data {
+		out.publish(d)
+	}
+	op.SigCompleted(sig)
+	return nil
+}
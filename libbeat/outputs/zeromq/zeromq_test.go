@@ -0,0 +1,209 @@
+//go:build !integration
+// +build !integration
+
+package zeromq
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/outputs"
+)
+
+// subscriber is a SUB socket speaking ZMTP 3.
+type subscriber struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newTestOutput(t *testing.T) *zeromqOut {
+	cfg, err := common.NewConfigFrom(map[string]interface{}{
+		"bind":  "tcp://127.0.0.1:0",
+		"topic": "fix.%{[fix.session_name]}.%{[fix.MsgType]}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := New("testbeat", cfg, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.(*zeromqOut)
+}
+
+func connect(t *testing.T, out *zeromqOut, socketType string) *subscriber {
+	conn, err := net.Dial("tcp", out.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	s := &subscriber{conn: conn, r: bufio.NewReader(conn)}
+
+	if _, err := conn.Write(greeting()); err != nil {
+		t.Fatal(err)
+	}
+	if err := readGreeting(s.r); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write(readyCommand(socketType)); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func (s *subscriber) readCommand(t *testing.T) (string, []byte) {
+	flags, body, err := readFrame(s.r, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotZero(t, flags&flagCommand)
+	name, data, err := parseCommand(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return name, data
+}
+
+func (s *subscriber) readMessage(t *testing.T) (string, common.MapStr) {
+	flags, topic, err := readFrame(s.r, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotZero(t, flags&flagMore)
+	flags, payload, err := readFrame(s.r, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Zero(t, flags&flagMore)
+
+	var event common.MapStr
+	assert.NoError(t, json.Unmarshal(payload, &event))
+	return string(topic), event
+}
+
+// waitSubscribed waits for the subscriptions sent to reach the output.
+func waitSubscribed(t *testing.T, out *zeromqOut, n int) {
+	for i := 0; i < 500; i++ {
+		subs := 0
+		out.mutex.Lock()
+		for p := range out.peers {
+			p.mutex.Lock()
+			subs += len(p.subs)
+			p.mutex.Unlock()
+		}
+		out.mutex.Unlock()
+		if subs == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("subscriptions of the subscribers not received")
+}
+
+func event(session, msgType, id string) outputs.Data {
+	return outputs.Data{Event: common.MapStr{
+		"id":  id,
+		"fix": common.MapStr{"session_name": session, "MsgType": msgType},
+	}}
+}
+
+func TestPublishToSubscribers(t *testing.T) {
+	out := newTestOutput(t)
+	defer out.Close()
+
+	s := connect(t, out, "SUB")
+	defer s.conn.Close()
+	name, data := s.readCommand(t)
+	assert.Equal(t, "READY", name)
+	props, err := parseMetadata(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "PUB", props["socket-type"])
+
+	// a ZMTP 3.0 subscription to the lse session, a ZMTP 3.1 one to the
+	// execution reports of all sessions
+	s.conn.Write(appendFrame(nil, 0, []byte("\x01fix.lse.")))
+	s.conn.Write(appendCommand(nil, "SUBSCRIBE", []byte("fix.ice.8")))
+	waitSubscribed(t, out, 2)
+
+	assert.NoError(t, out.BulkPublish(nil, outputs.Options{}, []outputs.Data{
+		event("lse", "D", "1"),
+		event("ice", "D", "2"),
+		event("ice", "8", "3"),
+		event("lse", "8", "4"),
+	}))
+
+	for _, id := range []string{"1", "3", "4"} {
+		_, e := s.readMessage(t)
+		assert.Equal(t, id, e["id"])
+	}
+
+	s.conn.Write(appendFrame(nil, 0, []byte("\x00fix.lse.")))
+	waitSubscribed(t, out, 1)
+	out.PublishEvent(nil, outputs.Options{}, event("lse", "8", "5"))
+	out.PublishEvent(nil, outputs.Options{}, event("ice", "8", "6"))
+	topic, e := s.readMessage(t)
+	assert.Equal(t, "fix.ice.8", topic)
+	assert.Equal(t, "6", e["id"])
+}
+
+func TestPing(t *testing.T) {
+	out := newTestOutput(t)
+	defer out.Close()
+
+	s := connect(t, out, "SUB")
+	defer s.conn.Close()
+	s.readCommand(t)
+
+	s.conn.Write(appendCommand(nil, "PING", []byte("\x00\x0actx")))
+	name, data := s.readCommand(t)
+	assert.Equal(t, "PONG", name)
+	assert.Equal(t, "ctx", string(data))
+}
+
+func TestRejectSocketType(t *testing.T) {
+	out := newTestOutput(t)
+	defer out.Close()
+
+	s := connect(t, out, "REQ")
+	defer s.conn.Close()
+	s.readCommand(t)
+	name, _ := s.readCommand(t)
+	assert.Equal(t, "ERROR", name)
+}
+
+func TestListenAddress(t *testing.T) {
+	for endpoint, addr := range map[string]string{
+		"tcp://*:5556":         ":5556",
+		"tcp://127.0.0.1:5556": "127.0.0.1:5556",
+		"tcp://[::1]:5556":     "[::1]:5556",
+		"ipc:///tmp/fixbeat":   "",
+		"tcp://127.0.0.1":      "",
+		"tcp://[::1]":          "",
+	} {
+		actual, err := listenAddress(endpoint)
+		assert.Equal(t, addr, actual, endpoint)
+		assert.Equal(t, addr == "", err != nil, endpoint)
+	}
+}
+
+func TestLongFrame(t *testing.T) {
+	body := make([]byte, 300)
+	wire := appendFrame(nil, flagMore, body)
+	assert.Equal(t, byte(flagMore|flagLong), wire[0])
+	assert.Len(t, wire, 1+8+300)
+
+	flags, read, err := readFrame(bufio.NewReader(bytes.NewReader(wire)), 1024)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(flagMore|flagLong), flags)
+	assert.Equal(t, body, read)
+
+	_, _, err = readFrame(bufio.NewReader(bytes.NewReader(wire)), 100)
+	assert.Error(t, err)
+}
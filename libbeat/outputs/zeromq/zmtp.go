@@ -0,0 +1,164 @@
+package zeromq
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The output speaks ZMTP 3 with the NULL security mechanism, the protocol of
+// ZeroMQ 4 sockets, see https://rfc.zeromq.org/spec/23/.
+
+const (
+	flagMore    = 0x01
+	flagLong    = 0x02
+	flagCommand = 0x04
+
+	greetingLen = 64
+
+	// subscriptions and commands of the subscribers are small
+	maxPeerFrame = 64 * 1024
+)
+
+var errProtocol = errors.New("zeromq: protocol error")
+
+// greeting returns the greeting of the output, ZMTP 3.0 with the NULL
+// mechanism.
+func greeting() []byte {
+	g := make([]byte, greetingLen)
+	g[0] = 0xff
+	g[9] = 0x7f
+	g[10] = 3
+	g[11] = 0
+	copy(g[12:32], "NULL")
+	return g
+}
+
+// readGreeting reads the greeting of a peer, checking it uses ZMTP 3 or newer
+// with the NULL mechanism.
+func readGreeting(r io.Reader) error {
+	g := make([]byte, greetingLen)
+	if _, err := io.ReadFull(r, g); err != nil {
+		return err
+	}
+	if g[0] != 0xff || g[9]&0x01 == 0 {
+		return fmt.Errorf("zeromq: invalid greeting signature")
+	}
+	if g[10] < 3 {
+		return fmt.Errorf("zeromq: ZMTP version %v.%v not supported", g[10], g[11])
+	}
+	mechanism := string(bytes.TrimRight(g[12:32], "\x00"))
+	if mechanism != "NULL" {
+		return fmt.Errorf("zeromq: security mechanism %v not supported", mechanism)
+	}
+	return nil
+}
+
+// appendFrame appends a frame with flags and body to the wire.
+func appendFrame(wire []byte, flags byte, body []byte) []byte {
+	if len(body) > 255 {
+		var size [8]byte
+		binary.BigEndian.PutUint64(size[:], uint64(len(body)))
+		wire = append(wire, flags|flagLong)
+		wire = append(wire, size[:]...)
+	} else {
+		wire = append(wire, flags, byte(len(body)))
+	}
+	return append(wire, body...)
+}
+
+// appendCommand appends a command frame to the wire.
+func appendCommand(wire []byte, name string, data []byte) []byte {
+	body := make([]byte, 0, 1+len(name)+len(data))
+	body = append(body, byte(len(name)))
+	body = append(body, name...)
+	body = append(body, data...)
+	return appendFrame(wire, flagCommand, body)
+}
+
+// readyCommand returns the READY command announcing the socket type.
+func readyCommand(socketType string) []byte {
+	var data []byte
+	data = append(data, byte(len("Socket-Type")))
+	data = append(data, "Socket-Type"...)
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(socketType)))
+	data = append(data, size[:]...)
+	data = append(data, socketType...)
+	return appendCommand(nil, "READY", data)
+}
+
+// readFrame reads the next frame of a peer, of at most maxSize bytes.
+func readFrame(r *bufio.Reader, maxSize int) (byte, []byte, error) {
+	flags, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var size uint64
+	if flags&flagLong != 0 {
+		var b [8]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(b[:])
+	} else {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		size = uint64(b)
+	}
+	if size > uint64(maxSize) {
+		return 0, nil, fmt.Errorf("zeromq: frame of %v bytes exceeds %v bytes", size, maxSize)
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return flags, body, nil
+}
+
+// parseCommand splits a command frame into its name and data.
+func parseCommand(body []byte) (string, []byte, error) {
+	if len(body) < 1 || len(body) < 1+int(body[0]) {
+		return "", nil, errProtocol
+	}
+	n := int(body[0])
+	return string(body[1 : 1+n]), body[1+n:], nil
+}
+
+// parseMetadata parses the properties of a READY command.
+func parseMetadata(data []byte) (map[string]string, error) {
+	props := map[string]string{}
+	for len(data) > 0 {
+		n := int(data[0])
+		if len(data) < 1+n+4 {
+			return nil, errProtocol
+		}
+		name := string(data[1 : 1+n])
+		data = data[1+n:]
+		size := binary.BigEndian.Uint32(data[:4])
+		data = data[4:]
+		if uint64(len(data)) < uint64(size) {
+			return nil, errProtocol
+		}
+		// property names are case-insensitive
+		props[strings.ToLower(name)] = string(data[:size])
+		data = data[size:]
+	}
+	return props, nil
+}
+
+// encodeMessage returns the wire encoding of a message of two frames, the
+// topic subscribers filter on and the event.
+func encodeMessage(topic string, payload []byte) []byte {
+	wire := make([]byte, 0, len(topic)+len(payload)+18)
+	wire = appendFrame(wire, flagMore, []byte(topic))
+	return appendFrame(wire, 0, payload)
+}
@@ -0,0 +1,93 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/processors"
+)
+
+type addFields struct {
+	// dotted keys of the fields to add, sorted
+	keys   []string
+	values map[string]interface{}
+}
+
+func init() {
+	processors.RegisterPlugin("add_fields",
+		configChecked(newAddFields,
+			requireFields("fields"),
+			allowedFields("fields", "target", "when")))
+}
+
+func newAddFields(c common.Config) (processors.Processor, error) {
+	config := struct {
+		Fields map[string]interface{} `config:"fields" validate:"required"`
+		Target *string                `config:"target"`
+	}{}
+	err := c.Unpack(&config)
+	if err != nil {
+		return nil, fmt.Errorf("fail to unpack the add_fields configuration: %s", err)
+	}
+
+	/* fields are added under fields unless another target is set, "" adding
+	   them to the root of the event */
+	target := "fields"
+	if config.Target != nil {
+		target = *config.Target
+	}
+
+	f := addFields{values: map[string]interface{}{}}
+	flattenFields(f.values, target, config.Fields)
+	for key := range f.values {
+		for _, readOnly := range processors.MandatoryExportedFields {
+			if key == readOnly {
+				return nil, fmt.Errorf("add_fields can not set the %v field", key)
+			}
+		}
+		f.keys = append(f.keys, key)
+	}
+	sort.Strings(f.keys)
+	return f, nil
+}
+
+// flattenFields adds the leaf values of fields to flat, keyed by their dotted
+// path under prefix.
+func flattenFields(flat map[string]interface{}, prefix string, fields map[string]interface{}) {
+	for name, value := range fields {
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flattenFields(flat, key, v)
+		case common.MapStr:
+			flattenFields(flat, key, v)
+		default:
+			flat[key] = value
+		}
+	}
+}
+
+func (f addFields) Run(event common.MapStr) (common.MapStr, error) {
+	var errs []string
+
+	for _, key := range f.keys {
+		if _, err := event.Put(key, f.values[key]); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return event, errors.New(strings.Join(errs, ", "))
+	}
+	return event, nil
+}
+
+func (f addFields) String() string {
+	return "add_fields=" + strings.Join(f.keys, ", ")
+}
@@ -0,0 +1,113 @@
+package actions
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/processors"
+	"github.com/pkg/errors"
+)
+
+type renameFields struct {
+	fields        []fromTo
+	ignoreMissing bool
+	failOnError   bool
+}
+
+type fromTo struct {
+	From string `config:"from" validate:"required"`
+	To   string `config:"to" validate:"required"`
+}
+
+func init() {
+	processors.RegisterPlugin("rename",
+		configChecked(newRenameFields,
+			requireFields("fields"),
+			allowedFields("fields", "ignore_missing", "fail_on_error", "when")))
+}
+
+func newRenameFields(c common.Config) (processors.Processor, error) {
+	config := struct {
+		Fields        []fromTo `config:"fields"`
+		IgnoreMissing bool     `config:"ignore_missing"`
+		FailOnError   bool     `config:"fail_on_error"`
+	}{
+		FailOnError: true,
+	}
+	err := c.Unpack(&config)
+	if err != nil {
+		return nil, fmt.Errorf("fail to unpack the rename configuration: %s", err)
+	}
+
+	/* read only fields can be neither renamed nor overwritten */
+	for _, field := range config.Fields {
+		for _, readOnly := range processors.MandatoryExportedFields {
+			if field.From == readOnly || field.To == readOnly {
+				return nil, fmt.Errorf("rename can not rename the %v field", readOnly)
+			}
+		}
+	}
+
+	f := renameFields{
+		fields:        config.Fields,
+		ignoreMissing: config.IgnoreMissing,
+		failOnError:   config.FailOnError,
+	}
+	return f, nil
+}
+
+// Run renames the fields in order. If renaming a field fails and
+// fail_on_error is set, the event is returned unchanged.
+func (f renameFields) Run(event common.MapStr) (common.MapStr, error) {
+	var backup common.MapStr
+	if f.failOnError {
+		backup = event.Clone()
+	}
+
+	var errs []string
+	for _, field := range f.fields {
+		err := f.rename(event, field.From, field.To)
+		if err == nil {
+			continue
+		}
+		if f.failOnError {
+			return backup, fmt.Errorf("failed to rename %v to %v: %v", field.From, field.To, err)
+		}
+		errs = append(errs, err.Error())
+	}
+
+	if len(errs) > 0 {
+		return event, errors.New(strings.Join(errs, ", "))
+	}
+	return event, nil
+}
+
+func (f renameFields) rename(event common.MapStr, from, to string) error {
+	value, err := event.GetValue(from)
+	if err != nil {
+		if f.ignoreMissing && errors.Cause(err) == common.ErrKeyNotFound {
+			return nil
+		}
+		return err
+	}
+
+	// the target is not overwritten, for renaming to be reversible
+	if exists, _ := event.HasKey(to); exists {
+		return fmt.Errorf("target field %v already exists", to)
+	}
+
+	if err := event.Delete(from); err != nil {
+		return err
+	}
+	_, err = event.Put(to, value)
+	return err
+}
+
+func (f renameFields) String() string {
+	var names []string
+	for _, field := range f.fields {
+		names = append(names, field.From+"->"+field.To)
+	}
+	return "rename=" + strings.Join(names, ", ")
+}
@@ -621,3 +621,179 @@ func TestDropMissingFields(t *testing.T) {
 
 	assert.Equal(t, expectedEvent, processedEvent)
 }
+
+func TestAddFields(t *testing.T) {
+
+	yml := []map[string]interface{}{
+		{
+			"add_fields": map[string]interface{}{
+				"when": map[string]interface{}{
+					"equals": map[string]string{
+						"fix.SenderCompID": "BROKER-A",
+					},
+				},
+				"fields": map[string]interface{}{
+					"venue": "LSE",
+					"desk":  map[string]interface{}{"name": "equities"},
+				},
+			},
+		},
+		{
+			"add_fields": map[string]interface{}{
+				"target": "",
+				"fields": map[string]interface{}{
+					"fix.environment": "prod",
+				},
+			},
+		},
+	}
+
+	processors := GetProcessors(t, yml)
+
+	event := common.MapStr{
+		"@timestamp": "2016-01-24T18:35:19.308Z",
+		"fix": common.MapStr{
+			"SenderCompID": "BROKER-A",
+		},
+		"type": "fix",
+	}
+
+	processedEvent := processors.Run(event)
+
+	expectedEvent := common.MapStr{
+		"@timestamp": "2016-01-24T18:35:19.308Z",
+		"fields": common.MapStr{
+			"venue": "LSE",
+			"desk":  common.MapStr{"name": "equities"},
+		},
+		"fix": common.MapStr{
+			"SenderCompID": "BROKER-A",
+			"environment":  "prod",
+		},
+		"type": "fix",
+	}
+
+	assert.Equal(t, expectedEvent, processedEvent)
+
+	event = common.MapStr{
+		"@timestamp": "2016-01-24T18:35:19.308Z",
+		"fix": common.MapStr{
+			"SenderCompID": "BROKER-B",
+		},
+		"type": "fix",
+	}
+
+	processedEvent = processors.Run(event)
+
+	expectedEvent = common.MapStr{
+		"@timestamp": "2016-01-24T18:35:19.308Z",
+		"fix": common.MapStr{
+			"SenderCompID": "BROKER-B",
+			"environment":  "prod",
+		},
+		"type": "fix",
+	}
+
+	assert.Equal(t, expectedEvent, processedEvent)
+}
+
+func TestAddFieldsReadOnly(t *testing.T) {
+
+	config, err := common.NewConfigFrom(map[string]interface{}{
+		"target": "",
+		"fields": map[string]interface{}{"type": "other"},
+	})
+	assert.Nil(t, err)
+
+	_, err = processors.New(processors.PluginConfig{
+		{"add_fields": *config},
+	})
+	assert.NotNil(t, err)
+}
+
+func TestRename(t *testing.T) {
+
+	yml := []map[string]interface{}{
+		{
+			"rename": map[string]interface{}{
+				"when": map[string]interface{}{
+					"equals": map[string]string{
+						"fix.TargetCompID": "VENUE-X",
+					},
+				},
+				"fields": []map[string]string{
+					{"from": "fix.9000", "to": "fix.VenueOrderType"},
+					{"from": "fix.9001", "to": "fix.VenueAccount"},
+				},
+				"ignore_missing": true,
+			},
+		},
+	}
+
+	processors := GetProcessors(t, yml)
+
+	event := common.MapStr{
+		"@timestamp": "2016-01-24T18:35:19.308Z",
+		"fix": common.MapStr{
+			"TargetCompID": "VENUE-X",
+			"9000":         "ICEBERG",
+		},
+		"type": "fix",
+	}
+
+	processedEvent := processors.Run(event)
+
+	expectedEvent := common.MapStr{
+		"@timestamp": "2016-01-24T18:35:19.308Z",
+		"fix": common.MapStr{
+			"TargetCompID":   "VENUE-X",
+			"VenueOrderType": "ICEBERG",
+		},
+		"type": "fix",
+	}
+
+	assert.Equal(t, expectedEvent, processedEvent)
+
+	event = common.MapStr{
+		"@timestamp": "2016-01-24T18:35:19.308Z",
+		"fix": common.MapStr{
+			"TargetCompID": "VENUE-Y",
+			"9000":         "ICEBERG",
+		},
+		"type": "fix",
+	}
+
+	processedEvent = processors.Run(event)
+
+	assert.Equal(t, event, processedEvent)
+}
+
+func TestRenameFailOnError(t *testing.T) {
+
+	yml := []map[string]interface{}{
+		{
+			"rename": map[string]interface{}{
+				"fields": []map[string]string{
+					{"from": "fix.9000", "to": "fix.VenueOrderType"},
+					{"from": "fix.9001", "to": "fix.VenueOrderType"},
+				},
+			},
+		},
+	}
+
+	processors := GetProcessors(t, yml)
+
+	event := common.MapStr{
+		"@timestamp": "2016-01-24T18:35:19.308Z",
+		"fix": common.MapStr{
+			"9000": "ICEBERG",
+			"9001": "ACCOUNT",
+		},
+		"type": "fix",
+	}
+
+	// the second rename fails as the target exists, restoring the event
+	processedEvent := processors.Run(event)
+
+	assert.Equal(t, event, processedEvent)
+}
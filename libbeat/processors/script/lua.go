@@ -0,0 +1,225 @@
+package script
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/yuin/gopher-lua"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/processors"
+)
+
+const eventTypeName = "beat.event"
+
+// luaEvent is the event given to the process function of the script.
+type luaEvent struct {
+	fields  common.MapStr
+	dropped bool
+}
+
+func (e *luaEvent) reset(fields common.MapStr) {
+	e.fields = fields
+	e.dropped = false
+}
+
+var eventMethods = map[string]func(*lua.LState, *luaEvent) int{
+	"get": func(L *lua.LState, e *luaEvent) int {
+		value, err := e.fields.GetValue(L.CheckString(2))
+		if err != nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		L.Push(toLua(L, value))
+		return 1
+	},
+	"put": func(L *lua.LState, e *luaEvent) int {
+		key := L.CheckString(2)
+		value := L.CheckAny(3)
+		if value == lua.LNil {
+			deleteField(L, e, key)
+			return 0
+		}
+		checkWritable(L, key)
+		if _, err := e.fields.Put(key, fromLua(value)); err != nil {
+			L.RaiseError("failed to put %v: %v", key, err)
+		}
+		return 0
+	},
+	"delete": func(L *lua.LState, e *luaEvent) int {
+		deleteField(L, e, L.CheckString(2))
+		return 0
+	},
+	"rename": func(L *lua.LState, e *luaEvent) int {
+		from, to := L.CheckString(2), L.CheckString(3)
+		checkWritable(L, from)
+		checkWritable(L, to)
+		value, err := e.fields.GetValue(from)
+		if err != nil {
+			L.Push(lua.LFalse)
+			return 1
+		}
+		if _, err := e.fields.GetValue(to); err == nil {
+			L.RaiseError("target field %v already exists", to)
+		}
+		if _, err := e.fields.Put(to, value); err != nil {
+			L.RaiseError("failed to rename %v to %v: %v", from, to, err)
+		}
+		e.fields.Delete(from)
+		L.Push(lua.LTrue)
+		return 1
+	},
+	"tag": func(L *lua.LState, e *luaEvent) int {
+		addTag(e.fields, L.CheckString(2))
+		return 0
+	},
+	"drop": func(L *lua.LState, e *luaEvent) int {
+		e.dropped = true
+		return 0
+	},
+}
+
+// newEventHandle returns the userdata passed to the process function, giving
+// access to the event through the methods of eventMethods.
+func newEventHandle(L *lua.LState, e *luaEvent) *lua.LUserData {
+	mt := L.NewTypeMetatable(eventTypeName)
+	methods := map[string]lua.LGFunction{}
+	for name, method := range eventMethods {
+		method := method
+		methods[name] = func(L *lua.LState) int {
+			ud := L.CheckUserData(1)
+			event, ok := ud.Value.(*luaEvent)
+			if !ok {
+				L.ArgError(1, "event expected")
+			}
+			return method(L, event)
+		}
+	}
+	L.SetField(mt, "__index", L.SetFuncs(L.NewTable(), methods))
+
+	ud := L.NewUserData()
+	ud.Value = e
+	L.SetMetatable(ud, mt)
+	return ud
+}
+
+func deleteField(L *lua.LState, e *luaEvent, key string) {
+	checkWritable(L, key)
+	e.fields.Delete(key)
+}
+
+// checkWritable raises an error if key is one of the fields the processors
+// must not modify.
+func checkWritable(L *lua.LState, key string) {
+	for _, field := range processors.MandatoryExportedFields {
+		if key == field {
+			L.RaiseError("the %v field can not be modified", key)
+		}
+	}
+}
+
+// toLua converts the Go values of events into Lua values. Values of unknown
+// types are converted to strings.
+func toLua(L *lua.LState, value interface{}) lua.LValue {
+	switch v := value.(type) {
+	case nil:
+		return lua.LNil
+	case bool:
+		return lua.LBool(v)
+	case string:
+		return lua.LString(v)
+	case int:
+		return lua.LNumber(v)
+	case int8:
+		return lua.LNumber(v)
+	case int16:
+		return lua.LNumber(v)
+	case int32:
+		return lua.LNumber(v)
+	case int64:
+		return lua.LNumber(v)
+	case uint:
+		return lua.LNumber(v)
+	case uint8:
+		return lua.LNumber(v)
+	case uint16:
+		return lua.LNumber(v)
+	case uint32:
+		return lua.LNumber(v)
+	case uint64:
+		return lua.LNumber(v)
+	case float32:
+		return lua.LNumber(v)
+	case float64:
+		return lua.LNumber(v)
+	case common.MapStr:
+		return toLua(L, map[string]interface{}(v))
+	case map[string]interface{}:
+		t := L.CreateTable(0, len(v))
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			t.RawSetString(key, toLua(L, v[key]))
+		}
+		return t
+	case []interface{}:
+		t := L.CreateTable(len(v), 0)
+		for _, elem := range v {
+			t.Append(toLua(L, elem))
+		}
+		return t
+	case []string:
+		t := L.CreateTable(len(v), 0)
+		for _, elem := range v {
+			t.Append(lua.LString(elem))
+		}
+		return t
+	case fmt.Stringer:
+		return lua.LString(v.String())
+	default:
+		return lua.LString(fmt.Sprint(v))
+	}
+}
+
+// fromLua converts Lua values into the Go values of events. Integral numbers
+// are converted to int64, sequences to []interface{} and other tables to
+// common.MapStr.
+func fromLua(value lua.LValue) interface{} {
+	switch v := value.(type) {
+	case lua.LBool:
+		return bool(v)
+	case lua.LString:
+		return string(v)
+	case lua.LNumber:
+		f := float64(v)
+		if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			return int64(f)
+		}
+		return f
+	case *lua.LTable:
+		if n := v.MaxN(); n > 0 && n == countKeys(v) {
+			list := make([]interface{}, 0, n)
+			for i := 1; i <= n; i++ {
+				list = append(list, fromLua(v.RawGetInt(i)))
+			}
+			return list
+		}
+		m := common.MapStr{}
+		v.ForEach(func(key, value lua.LValue) {
+			m[key.String()] = fromLua(value)
+		})
+		return m
+	default:
+		return nil
+	}
+}
+
+func countKeys(t *lua.LTable) int {
+	n := 0
+	t.ForEach(func(lua.LValue, lua.LValue) { n++ })
+	return n
+}
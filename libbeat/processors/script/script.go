@@ -0,0 +1,217 @@
+package script
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/paths"
+	"github.com/elastic/beats/libbeat/processors"
+)
+
+type config struct {
+	Lang       string                 `config:"lang"`
+	Source     string                 `config:"source"`
+	File       string                 `config:"file"`
+	Params     map[string]interface{} `config:"params"`
+	TagOnError string                 `config:"tag_on_error"`
+	Timeout    time.Duration          `config:"timeout" validate:"min=0"`
+}
+
+var defaultConfig = config{
+	Lang:       "lua",
+	TagOnError: "_script_error",
+	Timeout:    time.Second,
+}
+
+func (c *config) Validate() error {
+	if c.Lang != "lua" {
+		return fmt.Errorf("unsupported script lang '%v', only lua is supported", c.Lang)
+	}
+	if (c.Source == "") == (c.File == "") {
+		return errors.New("exactly one of source or file must be set")
+	}
+	return nil
+}
+
+// script runs the process function of a Lua script on each event. The Lua
+// state is not safe for concurrent use, events are processed one at a time.
+type script struct {
+	name       string
+	tagOnError string
+	timeout    time.Duration // of the process function, 0 for no limit
+
+	mutex   sync.Mutex
+	state   *lua.LState
+	process lua.LValue
+	event   *luaEvent
+	handle  *lua.LUserData
+}
+
+func init() {
+	processors.RegisterPlugin("script", newScript)
+}
+
+func newScript(c common.Config) (processors.Processor, error) {
+	config := defaultConfig
+	err := c.Unpack(&config)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to unpack the script configuration")
+	}
+
+	name, source := "inline", config.Source
+	if config.File != "" {
+		name = paths.Resolve(paths.Config, config.File)
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read the script file")
+		}
+		source = string(data)
+	}
+
+	s, err := loadScript(name, source, config.Params)
+	if err != nil {
+		return nil, err
+	}
+	s.tagOnError = config.TagOnError
+	s.timeout = config.Timeout
+	logp.Info("script: loaded Lua script %v", name)
+	return s, nil
+}
+
+// loadScript compiles and runs the script, which must define the
+// process(event) function, and calls its register(params) function if
+// defined.
+func loadScript(name, source string, params map[string]interface{}) (*script, error) {
+	chunk, err := parse.Parse(strings.NewReader(source), name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid Lua script %v", name)
+	}
+	proto, err := lua.Compile(chunk, name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid Lua script %v", name)
+	}
+
+	L := newState()
+	L.Push(L.NewFunctionFromProto(proto))
+	if err := L.PCall(0, lua.MultRet, nil); err != nil {
+		L.Close()
+		return nil, errors.Wrapf(err, "failed to run Lua script %v", name)
+	}
+
+	process := L.GetGlobal("process")
+	if process.Type() != lua.LTFunction {
+		L.Close()
+		return nil, fmt.Errorf("Lua script %v does not define the process(event) function", name)
+	}
+	if register := L.GetGlobal("register"); register.Type() == lua.LTFunction {
+		err := L.CallByParam(lua.P{Fn: register, Protect: true}, toLua(L, params))
+		if err != nil {
+			L.Close()
+			return nil, errors.Wrapf(err, "register function of Lua script %v failed", name)
+		}
+	}
+
+	s := &script{
+		name:    name,
+		state:   L,
+		process: process,
+		event:   &luaEvent{},
+	}
+	s.handle = newEventHandle(L, s.event)
+	return s, nil
+}
+
+// newState creates a Lua state with the base, table, string and math
+// libraries only, not giving scripts access to files or processes.
+func newState() *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring", "module", "require"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+	return L
+}
+
+// Run calls the process function of the script with the event. If the script
+// fails or runs for longer than the timeout, the event is returned as it was
+// before the script ran, tagged with tag_on_error.
+func (s *script) Run(event common.MapStr) (common.MapStr, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ctx := context.Background()
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+		s.state.SetContext(ctx)
+		defer s.state.RemoveContext()
+	}
+
+	backup := event.Clone()
+	s.event.reset(event)
+	err := s.state.CallByParam(lua.P{Fn: s.process, Protect: true}, s.handle)
+	s.state.SetTop(0)
+	if err != nil {
+		if s.tagOnError != "" {
+			addTag(backup, s.tagOnError)
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			return backup, fmt.Errorf("Lua script %v timed out after %v", s.name, s.timeout)
+		}
+		return backup, errors.Wrapf(err, "Lua script %v failed", s.name)
+	}
+
+	if s.event.dropped {
+		return nil, nil
+	}
+	return s.event.fields, nil
+}
+
+func (s *script) String() string {
+	return "script=" + s.name
+}
+
+// addTag appends tag to the tags of the event, if not yet tagged.
+func addTag(event common.MapStr, tag string) {
+	switch tags := event["tags"].(type) {
+	case nil:
+		event["tags"] = []string{tag}
+	case []string:
+		for _, t := range tags {
+			if t == tag {
+				return
+			}
+		}
+		event["tags"] = append(tags, tag)
+	case []interface{}:
+		for _, t := range tags {
+			if t == tag {
+				return
+			}
+		}
+		event["tags"] = append(tags, tag)
+	}
+}
@@ -0,0 +1,238 @@
+// +build !integration
+
+package script
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/processors"
+)
+
+const venueScript = `
+local venue
+local types = {}
+
+function register(params)
+  venue = params.venue
+  for code, name in pairs(params.order_types or {}) do
+    types[code] = name
+  end
+end
+
+function process(event)
+  if event:get("fix.MsgType") == "0" then
+    event:drop()
+    return
+  end
+  if event:get("fix.TargetCompID") ~= venue then
+    return
+  end
+  local code = event:get("fix.9000")
+  if code ~= nil then
+    event:put("fix.OrdType", types[code] or code)
+    event:delete("fix.9000")
+    event:tag("normalized")
+  end
+  event:put("fix.venue", {name = venue, legs = {1, 2}})
+end
+`
+
+func newTestScript(t *testing.T, config map[string]interface{}) processors.Processor {
+	c, err := common.NewConfigFrom(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := newScript(*c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestScriptNormalizesCustomTag(t *testing.T) {
+	p := newTestScript(t, map[string]interface{}{
+		"source": venueScript,
+		"params": map[string]interface{}{
+			"venue":       "VENUE-X",
+			"order_types": map[string]interface{}{"I": "ICEBERG"},
+		},
+	})
+
+	event := common.MapStr{
+		"@timestamp": "2016-01-24T18:35:19.308Z",
+		"type":       "fix",
+		"fix": common.MapStr{
+			"MsgType":      "D",
+			"TargetCompID": "VENUE-X",
+			"9000":         "I",
+		},
+	}
+	event, err := p.Run(event)
+	assert.NoError(t, err)
+	assert.Equal(t, common.MapStr{
+		"@timestamp": "2016-01-24T18:35:19.308Z",
+		"type":       "fix",
+		"tags":       []string{"normalized"},
+		"fix": common.MapStr{
+			"MsgType":      "D",
+			"TargetCompID": "VENUE-X",
+			"OrdType":      "ICEBERG",
+			"venue": common.MapStr{
+				"name": "VENUE-X",
+				"legs": []interface{}{int64(1), int64(2)},
+			},
+		},
+	}, event)
+
+	other := common.MapStr{
+		"type": "fix",
+		"fix":  common.MapStr{"MsgType": "D", "TargetCompID": "VENUE-Y", "9000": "I"},
+	}
+	event, err = p.Run(other.Clone())
+	assert.NoError(t, err)
+	assert.Equal(t, other, event)
+}
+
+func TestScriptDrop(t *testing.T) {
+	p := newTestScript(t, map[string]interface{}{
+		"source": venueScript,
+		"params": map[string]interface{}{"venue": "VENUE-X"},
+	})
+
+	event, err := p.Run(common.MapStr{"type": "fix", "fix": common.MapStr{"MsgType": "0"}})
+	assert.NoError(t, err)
+	assert.Nil(t, event)
+
+	// the event handle is reused, the next event is not dropped
+	event, err = p.Run(common.MapStr{"type": "fix", "fix": common.MapStr{"MsgType": "A"}})
+	assert.NoError(t, err)
+	assert.NotNil(t, event)
+}
+
+func TestScriptError(t *testing.T) {
+	p := newTestScript(t, map[string]interface{}{
+		"source": `
+function process(event)
+  event:put("fix.seen", true)
+  error("boom")
+end`,
+	})
+
+	event, err := p.Run(common.MapStr{"type": "fix", "fix": common.MapStr{"MsgType": "A"}})
+	assert.Error(t, err)
+	assert.Equal(t, common.MapStr{
+		"type": "fix",
+		"fix":  common.MapStr{"MsgType": "A"},
+		"tags": []string{"_script_error"},
+	}, event)
+}
+
+func TestScriptTimeout(t *testing.T) {
+	p := newTestScript(t, map[string]interface{}{
+		"source": `
+function process(event)
+  if event:get("fix.MsgType") == "A" then
+    while true do end
+  end
+  event:tag("processed")
+end`,
+		"timeout": "50ms",
+	})
+
+	event, err := p.Run(common.MapStr{"type": "fix", "fix": common.MapStr{"MsgType": "A"}})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "timed out")
+	}
+	assert.Equal(t, []string{"_script_error"}, event["tags"])
+
+	// the next events are processed
+	event, err = p.Run(common.MapStr{"type": "fix", "fix": common.MapStr{"MsgType": "0"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"processed"}, event["tags"])
+}
+
+func TestScriptMandatoryFields(t *testing.T) {
+	p := newTestScript(t, map[string]interface{}{
+		"source":       `function process(event) event:delete("type") end`,
+		"tag_on_error": "",
+	})
+
+	event, err := p.Run(common.MapStr{"type": "fix"})
+	assert.Error(t, err)
+	assert.Equal(t, common.MapStr{"type": "fix"}, event)
+}
+
+func TestScriptRename(t *testing.T) {
+	p := newTestScript(t, map[string]interface{}{
+		"source": `
+function process(event)
+  if not event:rename("fix.9001", "fix.Account") then
+    event:put("fix.Account", "none")
+  end
+  event:put("fix.Qty", event:get("fix.Qty") * 2)
+  event:put("fix.Px", event:get("fix.Px") / 4)
+end`,
+	})
+
+	event, err := p.Run(common.MapStr{"fix": common.MapStr{"9001": "ACC1", "Qty": 100, "Px": 1.0}})
+	assert.NoError(t, err)
+	assert.Equal(t, common.MapStr{"fix": common.MapStr{"Account": "ACC1", "Qty": int64(200), "Px": 0.25}}, event)
+
+	event, err = p.Run(common.MapStr{"fix": common.MapStr{"Qty": 1, "Px": 2}})
+	assert.NoError(t, err)
+	assert.Equal(t, common.MapStr{"fix": common.MapStr{"Account": "none", "Qty": int64(2), "Px": 0.5}}, event)
+}
+
+func TestScriptFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "script")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "venue.lua")
+	err = ioutil.WriteFile(path, []byte(`function process(event) event:tag("lua") end`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := newTestScript(t, map[string]interface{}{"file": path})
+	event, err := p.Run(common.MapStr{"tags": []string{"fix"}})
+	assert.NoError(t, err)
+	assert.Equal(t, common.MapStr{"tags": []string{"fix", "lua"}}, event)
+	assert.Equal(t, "script="+path, p.String())
+}
+
+func TestScriptInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config map[string]interface{}
+	}{
+		{"no source", map[string]interface{}{}},
+		{"source and file", map[string]interface{}{"source": "function process(e) end", "file": "x.lua"}},
+		{"unsupported lang", map[string]interface{}{"lang": "js", "source": "function process(e) end"}},
+		{"syntax error", map[string]interface{}{"source": "function process(e"}},
+		{"no process function", map[string]interface{}{"source": "x = 1"}},
+		{"failing register", map[string]interface{}{"source": `
+function register(params) error("bad params") end
+function process(event) end`}},
+		{"sandboxed", map[string]interface{}{"source": `
+os.exit(1)
+function process(event) end`}},
+	}
+
+	for _, test := range tests {
+		c, err := common.NewConfigFrom(test.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = newScript(*c)
+		assert.Error(t, err, test.name)
+	}
+}
@@ -56,7 +56,7 @@ func makeAsyncOutput(
 	hwm, bulkHWM int,
 	worker *outputWorker,
 ) worker {
-	config := worker.config
+	config := worker.output.config
 
 	flushInterval := config.FlushInterval
 	maxBulkSize := config.BulkMaxSize
@@ -132,6 +132,12 @@ func (b *bulkWorker) publish() {
 
 func (b *bulkWorker) shutdown() {
 	b.flushTicker.Stop()
+
+	// forward the events queued or batched before the stop signal
+	drainQueue(b.queue, func(m message) { b.onEvent(&m.context, m.datum) })
+	drainQueue(b.bulkQueue, func(m message) { b.onEvents(&m.context, m.data) })
+	b.flush()
+
 	stopQueue(b.queue)
 	stopQueue(b.bulkQueue)
 	b.ws.wg.Done()
@@ -114,3 +114,26 @@ func TestBulkWorkerSendBatchGreaterThanMaxBatchSize(t *testing.T) {
 	assert.Len(t, outMsgs[0].data, 1)
 	assert.Equal(t, m.data[maxBatchSize], outMsgs[0].data[0])
 }
+
+// Stop the bulkWorker before the flush timeout and verify that the batched
+// events are still sent.
+func TestBulkWorkerFlushOnStop(t *testing.T) {
+	ws := newWorkerSignal()
+	mh := &testMessageHandler{
+		response: CompletedResponse,
+		msgs:     make(chan message, queueSize),
+	}
+	bw := newBulkWorker(ws, queueSize, 0, mh, time.Duration(time.Hour), maxBatchSize)
+
+	s := newTestSignaler()
+	m := testMessage(s, testEvent())
+	bw.send(m)
+	ws.stop()
+
+	msgs, err := mh.waitForMessages(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, s.wait())
+	assert.Equal(t, m.datum, msgs[0].data[0])
+}
@@ -157,8 +157,8 @@ func newTestPublisher(bulkSize int, response OutputResponse) *testPublisher {
 		response: response,
 	}
 
-	ow := &outputWorker{}
-	ow.config.BulkMaxSize = bulkSize
+	ow := &outputWorker{output: &workerOutput{}}
+	ow.output.config.BulkMaxSize = bulkSize
 	ow.handler = mh
 	ow.messageWorker.init(&pub.wsOutput, DefaultQueueSize, DefaultBulkQueueSize, mh)
 
@@ -2,24 +2,46 @@ package publisher
 
 import (
 	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/elastic/beats/libbeat/common"
 	"github.com/elastic/beats/libbeat/common/op"
 	"github.com/elastic/beats/libbeat/logp"
 	"github.com/elastic/beats/libbeat/outputs"
+	"github.com/elastic/beats/libbeat/processors"
 )
 
 type outputWorker struct {
 	messageWorker
+	name string // name of the output plugin
+
+	// held while the output is taken for publishing or replaced on config
+	// reload, not while publishing
+	mutex  sync.Mutex
+	output *workerOutput
+}
+
+// workerOutput is the output of a worker and its settings, replaced as a
+// whole on config reload.
+type workerOutput struct {
 	out         outputs.BulkOutputer
 	config      outputConfig
 	maxBulkSize int
+
+	// events not matching filter are not published to the output
+	filter *processors.Condition
+
+	// publishes in progress, waited for before closing the output
+	publishing sync.WaitGroup
 }
 
 type outputConfig struct {
 	BulkMaxSize   int           `config:"bulk_max_size"`
 	FlushInterval time.Duration `config:"flush_interval"`
+
+	Filter *processors.ConditionConfig `config:"filter"`
 }
 
 var (
@@ -39,45 +61,112 @@ func newOutputWorker(
 	ws *workerSignal,
 	hwm int,
 	bulkHWM int,
-) *outputWorker {
-	config := defaultConfig
-	err := cfg.Unpack(&config)
+) (*outputWorker, error) {
+	config, filter, err := readOutputConfig(cfg)
 	if err != nil {
-		logp.Err("Failed to read output worker config: %v", err)
-		return nil
+		return nil, err
 	}
 
-	o := &outputWorker{
+	o := &outputWorker{output: newWorkerOutput(out, config, filter)}
+	o.messageWorker.init(ws, hwm, bulkHWM, o)
+	return o, nil
+}
+
+func newWorkerOutput(
+	out outputs.Outputer,
+	config outputConfig,
+	filter *processors.Condition,
+) *workerOutput {
+	return &workerOutput{
 		out:         outputs.CastBulkOutputer(out),
 		config:      config,
 		maxBulkSize: config.BulkMaxSize,
+		filter:      filter,
 	}
-	o.messageWorker.init(ws, hwm, bulkHWM, o)
-	return o
+}
+
+// readOutputConfig reads the settings of the output worker shared by all
+// outputs, and the filter of the events published to the output.
+func readOutputConfig(cfg *common.Config) (outputConfig, *processors.Condition, error) {
+	config := defaultConfig
+	if err := cfg.Unpack(&config); err != nil {
+		return config, nil, err
+	}
+	if config.Filter == nil {
+		return config, nil, nil
+	}
+	filter, err := processors.NewCondition(config.Filter)
+	if err != nil {
+		return config, nil, fmt.Errorf("invalid output filter: %v", err)
+	}
+	return config, filter, nil
+}
+
+// setOutput replaces the output events are published to, returning the
+// previous output. Events being published are sent to the previous output,
+// the publishing not being waited for.
+func (o *outputWorker) setOutput(cfg *common.Config, out outputs.Outputer) (*workerOutput, error) {
+	config, filter, err := readOutputConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	output := newWorkerOutput(out, config, filter)
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	old := o.output
+	o.output = output
+	return old, nil
+}
+
+// currentOutput returns the output events are published to.
+func (o *outputWorker) currentOutput() *workerOutput {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.output
 }
 
 func (o *outputWorker) onStop() {
-	err := o.out.Close()
+	err := o.currentOutput().out.Close()
 	if err != nil {
 		logp.Info("Failed to close outputer: %s", err)
 	}
 }
 
 func (o *outputWorker) onMessage(m message) {
+	o.mutex.Lock()
+	output := o.output
+	output.publishing.Add(1)
+	o.mutex.Unlock()
+	defer output.publishing.Done()
+
 	if m.datum.Event != nil {
-		o.onEvent(&m.context, m.datum)
+		output.onEvent(&m.context, m.datum)
 	} else {
-		o.onBulk(&m.context, m.data)
+		output.onBulk(&m.context, m.data)
 	}
 }
 
-func (o *outputWorker) onEvent(ctx *Context, data outputs.Data) {
+// close closes the output once the publishes in progress are done.
+func (o *workerOutput) close() error {
+	o.publishing.Wait()
+	return o.out.Close()
+}
+
+func (o *workerOutput) onEvent(ctx *Context, data outputs.Data) {
+	if o.filter != nil && !o.filter.Check(data.Event) {
+		debug("output worker: event filtered out")
+		op.SigCompleted(ctx.Signal)
+		return
+	}
+
 	debug("output worker: publish single event")
 	opts := outputs.Options{Guaranteed: ctx.Guaranteed}
 	o.out.PublishEvent(ctx.Signal, opts, data)
 }
 
-func (o *outputWorker) onBulk(ctx *Context, data []outputs.Data) {
+func (o *workerOutput) onBulk(ctx *Context, data []outputs.Data) {
+	data = o.filterBulk(data)
 	if len(data) == 0 {
 		debug("output worker: no events to publish")
 		op.SigCompleted(ctx.Signal)
@@ -102,7 +191,26 @@ func (o *outputWorker) onBulk(ctx *Context, data []outputs.Data) {
 	}
 }
 
-func (o *outputWorker) sendBulk(
+// filterBulk returns the events of data matching the filter of the output.
+// The events are copied, data being shared with the other outputs.
+func (o *workerOutput) filterBulk(data []outputs.Data) []outputs.Data {
+	if o.filter == nil {
+		return data
+	}
+
+	var filtered []outputs.Data
+	for _, d := range data {
+		if o.filter.Check(d.Event) {
+			filtered = append(filtered, d)
+		}
+	}
+	if len(filtered) < len(data) {
+		debug("output worker: %v events filtered out", len(data)-len(filtered))
+	}
+	return filtered
+}
+
+func (o *workerOutput) sendBulk(
 	ctx *Context,
 	data []outputs.Data,
 ) {
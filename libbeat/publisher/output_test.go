@@ -37,11 +37,12 @@ func (t *testOutputer) PublishEvent(
 // Test OutputWorker by calling onStop() and onMessage() with various inputs.
 func TestOutputWorker(t *testing.T) {
 	outputer := &testOutputer{data: make(chan outputs.Data, 10)}
-	ow := newOutputWorker(
+	ow, err := newOutputWorker(
 		common.NewConfig(),
 		outputer,
 		newWorkerSignal(),
 		1, 0)
+	assert.NoError(t, err)
 
 	ow.onStop() // Noop
 
@@ -65,3 +66,51 @@ func TestOutputWorker(t *testing.T) {
 		}
 	}
 }
+
+func TestOutputWorkerFilter(t *testing.T) {
+	cfg, err := common.NewConfigFrom(map[string]interface{}{
+		"filter.equals.type": "fix",
+	})
+	assert.NoError(t, err)
+
+	outputer := &testOutputer{data: make(chan outputs.Data, 10)}
+	ow, err := newOutputWorker(cfg, outputer, newWorkerSignal(), 1, 0)
+	assert.NoError(t, err)
+
+	fixEvent := testEvent()
+	fixEvent.Event["type"] = "fix"
+
+	// filtered out events are acknowledged without being published
+	sig := newTestSignaler()
+	ow.onMessage(testMessage(sig, testEvent()))
+	assert.True(t, sig.wait())
+	assert.Len(t, outputer.data, 0)
+
+	sig = newTestSignaler()
+	ow.onMessage(testMessage(sig, fixEvent))
+	assert.True(t, sig.wait())
+	assert.Equal(t, fixEvent, <-outputer.data)
+
+	bulk := []outputs.Data{testEvent(), fixEvent, testEvent()}
+	sig = newTestSignaler()
+	ow.onMessage(testBulkMessage(sig, bulk))
+	assert.True(t, sig.wait())
+	assert.Equal(t, fixEvent, <-outputer.data)
+	assert.Len(t, outputer.data, 0)
+	assert.Equal(t, "test", bulk[0].Event["type"])
+
+	sig = newTestSignaler()
+	ow.onMessage(testBulkMessage(sig, []outputs.Data{testEvent()}))
+	assert.True(t, sig.wait())
+	assert.Len(t, outputer.data, 0)
+}
+
+func TestOutputWorkerInvalidFilter(t *testing.T) {
+	cfg, err := common.NewConfigFrom(map[string]interface{}{
+		"filter.unknown.type": "fix",
+	})
+	assert.NoError(t, err)
+
+	_, err = newOutputWorker(cfg, &testOutputer{}, newWorkerSignal(), 1, 0)
+	assert.Error(t, err)
+}
@@ -3,6 +3,7 @@ package publisher
 import (
 	"errors"
 	"flag"
+	"fmt"
 	"os"
 	"sync/atomic"
 	"time"
@@ -17,10 +18,15 @@ import (
 	// load supported output plugins
 	_ "github.com/elastic/beats/libbeat/outputs/console"
 	_ "github.com/elastic/beats/libbeat/outputs/elasticsearch"
+	_ "github.com/elastic/beats/libbeat/outputs/failover"
 	_ "github.com/elastic/beats/libbeat/outputs/fileout"
+	_ "github.com/elastic/beats/libbeat/outputs/grpc"
 	_ "github.com/elastic/beats/libbeat/outputs/kafka"
 	_ "github.com/elastic/beats/libbeat/outputs/logstash"
+	_ "github.com/elastic/beats/libbeat/outputs/nats"
 	_ "github.com/elastic/beats/libbeat/outputs/redis"
+	_ "github.com/elastic/beats/libbeat/outputs/route"
+	_ "github.com/elastic/beats/libbeat/outputs/zeromq"
 )
 
 // command line flags
@@ -65,6 +71,11 @@ type BeatPublisher struct {
 
 	globalEventMetadata common.EventMetadata // Fields and tags to add to each event.
 
+	// settings the outputs are created with, to create them again on reload
+	beatName       string
+	topologyExpire int
+	outputConfigs  map[string]*common.Config
+
 	RefreshTopologyTimer <-chan time.Time
 
 	// On shutdown the publisher is finished first and the outputers next,
@@ -150,6 +161,23 @@ func (publisher *BeatPublisher) Connect() Client {
 	return newClient(publisher)
 }
 
+// TestOutputs checks the hosts of the outputs are reachable, for
+// -configtest.output. Outputs not supporting the test are skipped.
+func (publisher *BeatPublisher) TestOutputs(timeout time.Duration) error {
+	for _, worker := range publisher.Output {
+		tested, err := outputs.TestOutput(worker.currentOutput().out, timeout)
+		if err != nil {
+			return fmt.Errorf("%s output: %v", worker.name, err)
+		}
+		if !tested {
+			logp.Warn("Testing the connection of the %s output is not supported", worker.name)
+			continue
+		}
+		logp.Info("%s output is reachable", worker.name)
+	}
+	return nil
+}
+
 func (publisher *BeatPublisher) UpdateTopologyPeriodically() {
 	for range publisher.RefreshTopologyTimer {
 		_ = publisher.PublishTopology() // ignore errors
@@ -233,13 +261,18 @@ func (publisher *BeatPublisher) init(
 
 			debug("Create output worker")
 
-			outputers = append(outputers,
-				newOutputWorker(
-					config,
-					output,
-					&publisher.wsOutput,
-					*shipper.QueueSize,
-					*shipper.BulkQueueSize))
+			worker, err := newOutputWorker(
+				config,
+				output,
+				&publisher.wsOutput,
+				*shipper.QueueSize,
+				*shipper.BulkQueueSize)
+			if err != nil {
+				logp.Err("Failed to read %s output config: %v", plugin.Name, err)
+				return err
+			}
+			worker.name = plugin.Name
+			outputers = append(outputers, worker)
 
 			if ok, _ := config.Bool("save_topology", 0); !ok {
 				continue
@@ -265,6 +298,9 @@ func (publisher *BeatPublisher) init(
 		publisher.Output = outputers
 		publisher.TopologyOutput = topoOutput
 	}
+	publisher.beatName = beatName
+	publisher.topologyExpire = shipper.TopologyExpire
+	publisher.outputConfigs = configs
 
 	if !publisher.disabled {
 		if len(publisher.Output) == 0 {
@@ -323,6 +359,8 @@ func (publisher *BeatPublisher) init(
 	return nil
 }
 
+// Stop publishes the events still queued and closes the outputs. All clients
+// must be disconnected first.
 func (publisher *BeatPublisher) Stop() {
 	if atomic.LoadUint32(&publisher.numClients) > 0 {
 		panic("All clients must disconnect before shutting down publisher pipeline")
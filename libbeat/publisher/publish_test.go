@@ -3,10 +3,12 @@
 package publisher
 
 import (
+	"errors"
 	"runtime"
 	"testing"
 	"time"
 
+	"github.com/elastic/beats/libbeat/common"
 	"github.com/elastic/beats/libbeat/outputs"
 	"github.com/stretchr/testify/assert"
 )
@@ -78,3 +80,37 @@ func TestPublisherTypeUpdateTopologyPeriodically(t *testing.T) {
 		t.Skipf("Golang's net.InterfaceAddrs is a stub on %s", runtime.GOOS)
 	}
 }
+
+// testerOutputer is an output supporting -configtest.output.
+type testerOutputer struct {
+	testOutputer
+	err error
+}
+
+func (t *testerOutputer) TestConnection(timeout time.Duration) error {
+	return t.err
+}
+
+func TestTestOutputs(t *testing.T) {
+	newWorker := func(name string, out outputs.Outputer) *outputWorker {
+		worker, err := newOutputWorker(common.NewConfig(), out, newWorkerSignal(), 1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		worker.name = name
+		return worker
+	}
+
+	publisher := &BeatPublisher{Output: []*outputWorker{
+		newWorker("reachable", &testerOutputer{}),
+		newWorker("untested", &testOutputer{}),
+	}}
+	assert.NoError(t, publisher.TestOutputs(time.Second))
+
+	publisher.Output = append(publisher.Output,
+		newWorker("unreachable", &testerOutputer{err: errors.New("connection refused")}))
+	err := publisher.TestOutputs(time.Second)
+	if assert.Error(t, err) {
+		assert.Equal(t, "unreachable output: connection refused", err.Error())
+	}
+}
@@ -0,0 +1,117 @@
+package publisher
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/outputs"
+)
+
+// ReloadOutputs creates the outputs again from the reloaded output configs
+// and replaces the outputs events are published to, without dropping events
+// queued for publishing. The previous outputs are closed once done with the
+// events they were sent. Outputs can only be changed, not added or removed,
+// and outputs storing the topology can not be reloaded.
+func (publisher *BeatPublisher) ReloadOutputs(configs map[string]*common.Config) error {
+	if publisher.disabled {
+		return nil
+	}
+
+	changed, err := outputConfigsChanged(publisher.outputConfigs, configs)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		debug("Output config unchanged")
+		return nil
+	}
+	if publisher.TopologyOutput != nil {
+		return errors.New("outputs storing the topology can not be reloaded")
+	}
+
+	plugins, err := outputs.InitOutputs(publisher.beatName, configs, publisher.topologyExpire)
+	if err != nil {
+		return err
+	}
+
+	workers := map[string]*outputWorker{}
+	for _, worker := range publisher.Output {
+		workers[worker.name] = worker
+	}
+	err = checkReloadedOutputs(workers, plugins)
+	if err != nil {
+		closeOutputs(plugins)
+		return err
+	}
+
+	for _, plugin := range plugins {
+		old, err := workers[plugin.Name].setOutput(plugin.Config, plugin.Output)
+		if err != nil {
+			closeOutputs(plugins)
+			return err
+		}
+		// the previous output might be retrying events, not to block the
+		// reload it is closed in the background
+		go func(name string, old *workerOutput) {
+			if err := old.close(); err != nil {
+				logp.Err("Failed to close the previous %s output: %v", name, err)
+			}
+		}(plugin.Name, old)
+		logp.Info("Reloaded %s output", plugin.Name)
+	}
+
+	publisher.outputConfigs = configs
+	return nil
+}
+
+// checkReloadedOutputs checks the reloaded outputs match the running output
+// workers.
+func checkReloadedOutputs(workers map[string]*outputWorker, plugins []outputs.OutputPlugin) error {
+	if len(plugins) != len(workers) {
+		return errors.New("outputs can not be added or removed without a restart")
+	}
+	for _, plugin := range plugins {
+		if _, exists := workers[plugin.Name]; !exists {
+			return fmt.Errorf("output %s can not be added without a restart", plugin.Name)
+		}
+		if ok, _ := plugin.Config.Bool("save_topology", 0); ok {
+			return errors.New("outputs storing the topology can not be reloaded")
+		}
+	}
+	return nil
+}
+
+func closeOutputs(plugins []outputs.OutputPlugin) {
+	for _, plugin := range plugins {
+		if err := plugin.Output.Close(); err != nil {
+			logp.Err("Failed to close %s output: %v", plugin.Name, err)
+		}
+	}
+}
+
+func outputConfigsChanged(old, configs map[string]*common.Config) (bool, error) {
+	if len(old) != len(configs) {
+		return true, nil
+	}
+	for name, cfg := range configs {
+		oldCfg, exists := old[name]
+		if !exists {
+			return true, nil
+		}
+
+		var before, after map[string]interface{}
+		if err := oldCfg.Unpack(&before); err != nil {
+			return false, err
+		}
+		if err := cfg.Unpack(&after); err != nil {
+			return false, err
+		}
+		if !reflect.DeepEqual(before, after) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,149 @@
+// +build !integration
+
+package publisher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/outputs"
+	"github.com/stretchr/testify/assert"
+)
+
+// reloadOutputer records the config it is created with and whether it is
+// closed.
+type reloadOutputer struct {
+	testOutputer
+	setting string
+	closed  chan struct{}
+}
+
+func (r *reloadOutputer) Close() error {
+	close(r.closed)
+	return nil
+}
+
+func (r *reloadOutputer) isClosed() bool {
+	select {
+	case <-r.closed:
+		return true
+	case <-time.After(100 * time.Millisecond):
+		return false
+	}
+}
+
+var reloadOutputers []*reloadOutputer
+
+func init() {
+	outputs.RegisterOutputPlugin("reload_test", func(_ string, cfg *common.Config, _ int) (outputs.Outputer, error) {
+		setting, _ := cfg.String("setting", -1)
+		out := &reloadOutputer{
+			testOutputer: testOutputer{data: make(chan outputs.Data, 10)},
+			setting:      setting,
+			closed:       make(chan struct{}),
+		}
+		reloadOutputers = append(reloadOutputers, out)
+		return out, nil
+	})
+}
+
+func newReloadTestPublisher(t *testing.T, setting string) *BeatPublisher {
+	reloadOutputers = nil
+	configs := reloadTestConfigs(t, setting)
+	plugins, err := outputs.InitOutputs("test", configs, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	worker, err := newOutputWorker(plugins[0].Config, plugins[0].Output, newWorkerSignal(), 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worker.name = plugins[0].Name
+	return &BeatPublisher{
+		Output:        []*outputWorker{worker},
+		beatName:      "test",
+		outputConfigs: configs,
+	}
+}
+
+func reloadTestConfigs(t *testing.T, setting string) map[string]*common.Config {
+	cfg, err := common.NewConfigFrom(map[string]interface{}{
+		"setting":       setting,
+		"bulk_max_size": 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]*common.Config{"reload_test": cfg}
+}
+
+func TestReloadOutputsUnchanged(t *testing.T) {
+	publisher := newReloadTestPublisher(t, "a")
+
+	err := publisher.ReloadOutputs(reloadTestConfigs(t, "a"))
+	assert.NoError(t, err)
+	assert.Len(t, reloadOutputers, 1)
+	assert.False(t, reloadOutputers[0].isClosed())
+}
+
+func TestReloadOutputsChanged(t *testing.T) {
+	publisher := newReloadTestPublisher(t, "a")
+
+	err := publisher.ReloadOutputs(reloadTestConfigs(t, "b"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.Len(t, reloadOutputers, 2) {
+		return
+	}
+	old, reloaded := reloadOutputers[0], reloadOutputers[1]
+	assert.True(t, old.isClosed())
+	assert.False(t, reloaded.isClosed())
+	assert.Equal(t, "b", reloaded.setting)
+
+	// events are published to the reloaded output
+	worker := publisher.Output[0]
+	sig := newTestSignaler()
+	worker.onMessage(testMessage(sig, testEvent()))
+	assert.True(t, sig.wait())
+	assert.Len(t, reloaded.data, 1)
+	assert.Len(t, old.data, 0)
+}
+
+func TestReloadOutputsAdded(t *testing.T) {
+	publisher := newReloadTestPublisher(t, "a")
+
+	configs := reloadTestConfigs(t, "a")
+	configs["console"] = common.NewConfig()
+
+	err := publisher.ReloadOutputs(configs)
+	assert.Error(t, err)
+	assert.False(t, reloadOutputers[0].isClosed())
+	assert.Equal(t, publisher.Output[0].output.out, outputs.CastBulkOutputer(reloadOutputers[0]))
+}
+
+func TestReloadOutputsWhilePublishing(t *testing.T) {
+	publisher := newReloadTestPublisher(t, "a")
+	worker := publisher.Output[0]
+
+	// the output blocks publishing, like outputs retrying events
+	old := reloadOutputers[0]
+	old.data = make(chan outputs.Data)
+	sig := newTestSignaler()
+	go worker.onMessage(testMessage(sig, testEvent()))
+	time.Sleep(10 * time.Millisecond)
+
+	err := publisher.ReloadOutputs(reloadTestConfigs(t, "b"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "b", outputs.UnwrapBulkOutputer(worker.currentOutput().out).(*reloadOutputer).setting)
+	assert.False(t, old.isClosed())
+
+	// closed once the event is published
+	<-old.data
+	assert.True(t, sig.wait())
+	assert.True(t, old.isClosed())
+}
@@ -72,6 +72,10 @@ func (p *messageWorker) run() {
 }
 
 func (p *messageWorker) shutdown() {
+	// handle messages queued before the stop signal
+	drainQueue(p.queue, p.onEvent)
+	drainQueue(p.bulkQueue, p.onEvent)
+
 	p.handler.onStop()
 	stopQueue(p.queue)
 	stopQueue(p.bulkQueue)
@@ -102,6 +106,19 @@ func (ws *workerSignal) Init() {
 	ws.done = make(chan struct{})
 }
 
+// drainQueue passes the messages already queued to handle, without waiting
+// for new messages.
+func drainQueue(qu chan message, handle func(m message)) {
+	for {
+		select {
+		case m := <-qu:
+			handle(m)
+		default:
+			return
+		}
+	}
+}
+
 func stopQueue(qu chan message) {
 	close(qu)
 	for msg := range qu { // clear queue and send fail signal
@@ -47,3 +47,25 @@ func TestMessageWorkerSend(t *testing.T) {
 	ws.stop()
 	assert.True(t, atomic.LoadUint32(&mh.stopped) == 1)
 }
+
+// Test that messages queued before the stop signal are handled.
+func TestMessageWorkerDrainOnStop(t *testing.T) {
+	client := &client{canceler: op.NewCanceler()}
+
+	ws := newWorkerSignal()
+	mh := &testMessageHandler{msgs: make(chan message, 10), response: true}
+	mw := newMessageWorker(ws, 10, 0, mh)
+
+	var signals []*testSignaler
+	for i := 0; i < 5; i++ {
+		s := newTestSignaler()
+		signals = append(signals, s)
+		mw.send(message{client: client, context: Context{Signal: s}})
+	}
+	ws.stop()
+
+	for _, s := range signals {
+		assert.True(t, s.wait())
+	}
+	assert.True(t, atomic.LoadUint32(&mh.stopped) == 1)
+}
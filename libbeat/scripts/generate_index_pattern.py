@@ -58,7 +58,7 @@ def field_to_json(desc, path, output):
             field["type"] = "string"
             if desc["type"] == "text":
                 field["aggregatable"] = False
-        elif desc["type"] == "date":
+        elif desc["type"] in ["date", "date_nanos"]:
             field["type"] = "date"
     else:
         field["type"] = "string"
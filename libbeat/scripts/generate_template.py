@@ -205,9 +205,9 @@ def fill_field_properties(args, field, defaults, path):
                 "ignore_above": 1024
             }
 
-    elif field["type"] in ["geo_point", "date", "long", "integer",
-                           "double", "float", "half_float", "scaled_float",
-                           "boolean"]:
+    elif field["type"] in ["geo_point", "date", "date_nanos", "long",
+                           "integer", "double", "float", "half_float",
+                           "scaled_float", "boolean"]:
         # Convert all integer fields to long
         if field["type"] == "integer":
             field["type"] = "long"
@@ -216,6 +216,10 @@ def fill_field_properties(args, field, defaults, path):
             # ES 2.x doesn't support half or scaled floats, so convert to float
             field["type"] = "float"
 
+        if args.es2x and field["type"] == "date_nanos":
+            # ES 2.x stores dates to the millisecond
+            field["type"] = "date"
+
         properties[field["name"]] = {
             "type": field.get("type")
         }
@@ -254,6 +258,22 @@ def fill_field_properties(args, field, defaults, path):
                         "path_match": name + ".*"
                     }
                 })
+        elif field.get("dict-type") in ["long", "float", "double"]:
+            # add a dynamic template to map all members of the dict to the
+            # same numeric type, as whole numbers would be mapped as long
+            if len(path) > 0:
+                name = path + "." + field["name"]
+            else:
+                name = field["name"]
+
+            dynamic_templates.append({
+                name: {
+                    "mapping": {
+                        "type": field["dict-type"],
+                    },
+                    "path_match": name + ".*"
+                }
+            })
 
     elif field.get("type") == "group":
         if len(path) > 0:
@@ -47,7 +47,7 @@ var cpuOut *os.File
 func init() {
 	memprofile = flag.String("memprofile", "", "Write memory profile to this file")
 	cpuprofile = flag.String("cpuprofile", "", "Write cpu profile to file")
-	httpprof = flag.String("httpprof", "", "Start pprof http server")
+	httpprof = flag.String("httpprof", "", "Start pprof http server, also serving /stats and /debug/vars")
 }
 
 // ProfileEnabled checks whether the beat should write a cpu or memory profile.
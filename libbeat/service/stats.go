@@ -0,0 +1,23 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+func init() {
+	http.HandleFunc("/stats", statsHandler)
+}
+
+// statsHandler serves the integer expvars, as logged by the metrics logging,
+// as a flat JSON object. The full expvars are available from /debug/vars.
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(logp.SnapshotExpvars()); err != nil {
+		logp.Err("Failed to encode stats: %v", err)
+	}
+}
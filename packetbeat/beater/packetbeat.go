@@ -3,14 +3,19 @@ package beater
 import (
 	"flag"
 	"fmt"
+	"reflect"
 	"sync"
 	"time"
 
 	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/cfgfile"
 	"github.com/elastic/beats/libbeat/common"
 	"github.com/elastic/beats/libbeat/common/droppriv"
 	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/paths"
+	"github.com/elastic/beats/libbeat/publisher"
 	"github.com/elastic/beats/libbeat/service"
+	"github.com/tsg/gopacket"
 	"github.com/tsg/gopacket/layers"
 
 	"github.com/elastic/beats/packetbeat/config"
@@ -30,12 +35,46 @@ type packetbeat struct {
 	config      config.Config
 	cmdLineArgs flags
 	pub         *publish.PacketbeatPublisher
-	sniff       *sniffer.SnifferSetup
+
+	// one sniffer per capture device
+	sniffers []*sniffer.SnifferSetup
 
 	services []interface {
 		Start()
 		Stop()
 	}
+
+	// processors shared by the decoders of all sniffers, created with the
+	// first worker
+	processors *processors
+
+	// serializes the packets of several sniffers and the config reloads, as
+	// the processors are not safe for concurrent use
+	mutex sync.Mutex
+
+	// hold the lock for each packet, also with a single sniffer
+	locked bool
+}
+
+type processors struct {
+	flows *flows.Flows
+	icmp4 icmp.ICMPv4Processor
+	icmp6 icmp.ICMPv6Processor
+	tcp   *tcp.TCP
+	udp   *udp.UDP
+}
+
+// lockedWorker passes the packets captured by one of several sniffers to its
+// decoder, holding the lock shared by the sniffers.
+type lockedWorker struct {
+	mutex  *sync.Mutex
+	worker sniffer.Worker
+}
+
+func (w *lockedWorker) OnPacket(data []byte, ci *gopacket.CaptureInfo) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.worker.OnPacket(data, ci)
 }
 
 type flags struct {
@@ -58,19 +97,11 @@ func init() {
 		dumpfile:     flag.String("dump", "", "Write all captured packets to this libpcap file"),
 		waitShutdown: flag.Int("waitstop", 0, "Additional seconds to wait before shutting down"),
 	}
+	publish.RegisterECSMapper("capture_drops", dropsECSFields)
 }
 
 func New(b *beat.Beat, rawConfig *common.Config) (beat.Beater, error) {
-	config := config.Config{
-		Interfaces: config.InterfacesConfig{
-			File:       *cmdLineArgs.file,
-			Loop:       *cmdLineArgs.loop,
-			TopSpeed:   *cmdLineArgs.topSpeed,
-			OneAtATime: *cmdLineArgs.oneAtAtime,
-			Dumpfile:   *cmdLineArgs.dumpfile,
-		},
-	}
-	err := rawConfig.Unpack(&config)
+	config, err := unpackConfig(rawConfig)
 	if err != nil {
 		logp.Err("fails to read the beat config: %v, %v", err, config)
 		return nil, err
@@ -79,6 +110,7 @@ func New(b *beat.Beat, rawConfig *common.Config) (beat.Beater, error) {
 	pb := &packetbeat{
 		config:      config,
 		cmdLineArgs: cmdLineArgs,
+		locked:      b.Config.Reload.Enabled,
 	}
 	err = pb.init(b)
 	if err != nil {
@@ -88,6 +120,29 @@ func New(b *beat.Beat, rawConfig *common.Config) (beat.Beater, error) {
 	return pb, nil
 }
 
+// unpackConfig reads the packetbeat config, the interfaces settings being
+// overwritten by the command line flags.
+func unpackConfig(rawConfig *common.Config) (config.Config, error) {
+	config := config.Config{
+		Interfaces: config.InterfacesConfig{
+			File:       *cmdLineArgs.file,
+			Loop:       *cmdLineArgs.loop,
+			TopSpeed:   *cmdLineArgs.topSpeed,
+			OneAtATime: *cmdLineArgs.oneAtAtime,
+			Dumpfile:   *cmdLineArgs.dumpfile,
+			DropMonitor: config.DropMonitorConfig{
+				Period: config.DefaultDropMonitorPeriod,
+			},
+			Recorder: config.DefaultRecorderConfig,
+		},
+		Queue: config.QueueConfig{
+			Spill: config.SpillConfig{MaxSizeMB: config.DefaultSpillMaxSizeMB},
+		},
+	}
+	err := rawConfig.Unpack(&config)
+	return config, err
+}
+
 // init packetbeat components
 func (pb *packetbeat) init(b *beat.Beat) error {
 
@@ -101,8 +156,18 @@ func (pb *packetbeat) init(b *beat.Beat) error {
 	// This is required as init Beat is called before the beat publisher is initialised
 	b.Config.Shipper.InitShipperConfig()
 
-	pb.pub, err = publish.NewPublisher(b.Publisher, *b.Config.Shipper.QueueSize, *b.Config.Shipper.BulkQueueSize, pb.config.IgnoreOutgoing)
+	var geoIP *publish.GeoIP
+	if cfg.GeoIP.Enabled() {
+		geoIP, err = newGeoIP(cfg.GeoIP)
+		if err != nil {
+			return fmt.Errorf("Loading GeoIP databases failed: %v", err)
+		}
+	}
+
+	queue := newQueueSettings(cfg.Queue, *b.Config.Shipper.QueueSize)
+	pb.pub, err = publish.NewPublisher(b.Publisher, queue, *b.Config.Shipper.BulkQueueSize, pb.config.IgnoreOutgoing, cfg.ECS.Enabled, geoIP)
 	if err != nil {
+		geoIP.Close()
 		return fmt.Errorf("Initializing publisher failed: %v", err)
 	}
 
@@ -121,6 +186,39 @@ func (pb *packetbeat) init(b *beat.Beat) error {
 	return nil
 }
 
+// newGeoIP opens the GeoIP databases, relative paths being resolved in the
+// config path.
+func newGeoIP(cfg config.GeoIPConfig) (*publish.GeoIP, error) {
+	resolve := func(path string) string {
+		if path == "" {
+			return ""
+		}
+		return paths.Resolve(paths.Config, path)
+	}
+	return publish.NewGeoIP(resolve(cfg.Database), resolve(cfg.ASNDatabase))
+}
+
+// newQueueSettings returns the settings of the transaction queue, sized by
+// the shipper queue_size unless set. The spill file defaults to
+// transactions.spill in the data path, relative paths being resolved in the
+// data path.
+func newQueueSettings(cfg config.QueueConfig, queueSize int) publish.QueueSettings {
+	settings := publish.QueueSettings{
+		Size:          cfg.Size,
+		Overflow:      cfg.Overflow,
+		SpillPath:     cfg.Spill.Path,
+		SpillMaxBytes: int64(cfg.Spill.MaxSizeMB) * 1024 * 1024,
+	}
+	if settings.Size == 0 {
+		settings.Size = queueSize
+	}
+	if settings.SpillPath == "" {
+		settings.SpillPath = "transactions.spill"
+	}
+	settings.SpillPath = paths.Resolve(paths.Data, settings.SpillPath)
+	return settings
+}
+
 func (pb *packetbeat) Run(b *beat.Beat) error {
 	defer func() {
 		if service.ProfileEnabled() {
@@ -128,9 +226,6 @@ func (pb *packetbeat) Run(b *beat.Beat) error {
 			time.Sleep(time.Duration(float64(protos.DefaultTransactionExpiration) * 1.2))
 			logp.Debug("main", "Streams and transactions should all be expired now.")
 		}
-
-		// TODO:
-		// pb.TransPub.Stop()
 	}()
 
 	pb.pub.Start()
@@ -146,19 +241,23 @@ func (pb *packetbeat) Run(b *beat.Beat) error {
 	}
 
 	var wg sync.WaitGroup
-	errC := make(chan error, 1)
-
-	// Run the sniffer in background
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		err := pb.sniff.Run()
-		if err != nil {
-			errC <- fmt.Errorf("Sniffer main loop failed: %v", err)
-		}
-	}()
+	errC := make(chan error, len(pb.sniffers))
+
+	// Run the sniffers in background. If a sniffer fails, the others are
+	// stopped.
+	for _, sniff := range pb.sniffers {
+		wg.Add(1)
+		go func(sniff *sniffer.SnifferSetup) {
+			defer wg.Done()
+			err := sniff.Run()
+			if err != nil {
+				errC <- fmt.Errorf("Sniffer main loop failed: %v", err)
+				pb.stopSniffers()
+			}
+		}(sniff)
+	}
 
-	logp.Debug("main", "Waiting for the sniffer to finish")
+	logp.Debug("main", "Waiting for the sniffers to finish")
 	wg.Wait()
 	select {
 	default:
@@ -166,6 +265,12 @@ func (pb *packetbeat) Run(b *beat.Beat) error {
 		return err
 	}
 
+	// publish the messages buffered for open connections
+	logp.Debug("main", "Flushing open connections")
+	if pb.processors != nil {
+		pb.processors.tcp.Flush()
+	}
+
 	// kill services
 	for _, service := range pb.services {
 		service.Stop()
@@ -176,72 +281,253 @@ func (pb *packetbeat) Run(b *beat.Beat) error {
 		time.Sleep(time.Duration(*waitShutdown) * time.Second)
 	}
 
+	// publish the queued events, then wait for the outputs to complete the
+	// pending requests
+	logp.Info("Packetbeat publishing pending events")
+	pb.pub.Stop()
+	if p, ok := b.Publisher.(*publisher.BeatPublisher); ok {
+		p.Stop()
+	}
+
 	return nil
 }
 
-// Called by the Beat stop function
+// Called by the Beat stop function. Stops the sniffers, for Run to publish
+// the pending events before returning.
 func (pb *packetbeat) Stop() {
 	logp.Info("Packetbeat send stop signal")
-	pb.sniff.Stop()
-	pb.pub.Stop()
+	pb.stopSniffers()
+}
+
+// Reload applies the reloaded protocol settings while capturing. The
+// protocol plugins supporting it are reconfigured, the ports mapped to the
+// protocols again and the BPF filters of the devices updated, for the new
+// connections to be analyzed with the reloaded settings. Other settings
+// require a restart.
+func (pb *packetbeat) Reload(rawConfig *common.Config) error {
+	config, err := unpackConfig(rawConfig)
+	if err != nil {
+		return fmt.Errorf("fails to read the beat config: %v", err)
+	}
+	if !reflect.DeepEqual(config.Interfaces, pb.config.Interfaces) {
+		logp.Warn("Changing the interfaces requires a restart")
+	}
+
+	pb.mutex.Lock()
+	defer pb.mutex.Unlock()
+
+	err = protos.Protos.Reload(pb.pub, config.Protocols)
+	if err != nil {
+		return err
+	}
+
+	if p := pb.processors; p != nil {
+		if err := p.tcp.UpdatePorts(); err != nil {
+			return err
+		}
+		if err := p.udp.UpdatePorts(); err != nil {
+			return err
+		}
+	}
+
+	devices := pb.config.Interfaces.DeviceConfigs()
+	for i, sniff := range pb.sniffers {
+		if len(devices[i].File) > 0 {
+			continue
+		}
+		err := sniff.SetFilter(pb.bpfFilter(&devices[i]))
+		if err != nil {
+			return fmt.Errorf("device %s: %v", devices[i].Device, err)
+		}
+	}
+	return nil
+}
+
+func (pb *packetbeat) stopSniffers() {
+	for _, sniff := range pb.sniffers {
+		sniff.Stop()
+	}
 }
 
+// setupSniffer creates a sniffer per capture device. The devices are
+// captured from at the same time, their packets being analyzed by the same
+// processors.
 func (pb *packetbeat) setupSniffer() error {
 	config := &pb.config
 
-	withVlans := config.Interfaces.WithVlans
-	withICMP := config.Protocols["icmp"].Enabled()
+	devices := config.Interfaces.DeviceConfigs()
+	if len(devices) > 1 && config.Interfaces.Dumpfile != "" {
+		return fmt.Errorf("dumpfile is not supported when capturing from several devices")
+	}
+	if cfgfile.IsTestConfig() {
+		return pb.testSniffer(devices)
+	}
 
-	filter := config.Interfaces.BpfFilter
-	if filter == "" && !config.Flows.IsEnabled() {
-		filter = protos.Protos.BpfFilter(withVlans, withICMP)
+	for i := range devices {
+		interfaces := &devices[i]
+		filter := pb.bpfFilter(interfaces)
+		interfaces.Recorder.Path = paths.Resolve(paths.Data, interfaces.Recorder.Path)
+
+		factory := pb.createWorker
+		if len(devices) > 1 || pb.locked {
+			factory = pb.createLockedWorker
+		}
+
+		sniff := &sniffer.SnifferSetup{}
+		if err := sniff.Init(false, filter, factory, interfaces); err != nil {
+			for _, s := range pb.sniffers {
+				s.Close()
+			}
+			pb.sniffers = nil
+			return fmt.Errorf("device %s: %v", interfaces.Device, err)
+		}
+		pb.sniffers = append(pb.sniffers, sniff)
+
+		if interfaces.DropMonitor.IsEnabled() && len(interfaces.File) == 0 {
+			monitor := sniffer.NewDropMonitor(sniff, interfaces.DropMonitor.Period, pb.publishDrops)
+			pb.services = append(pb.services, monitor)
+		}
 	}
+	return nil
+}
 
-	pb.sniff = &sniffer.SnifferSetup{}
-	return pb.sniff.Init(false, filter, pb.createWorker, &config.Interfaces)
+// publishDrops publishes a warning event for the packets dropped by a
+// capture device, the analysis of the traffic being incomplete.
+func (pb *packetbeat) publishDrops(drops sniffer.Drops) {
+	rate := drops.Rate()
+	logp.Warn("Device %s dropped %d packets in the last %v (%.2f%%), %d dropped by the interface",
+		drops.Device, drops.Delta.Dropped, drops.Period, 100*rate, drops.Delta.IfDropped)
+
+	pb.pub.PublishTransaction(common.MapStr{
+		"@timestamp": common.Time(time.Now()),
+		"type":       "capture_drops",
+		"level":      "warning",
+		"capture": common.MapStr{
+			"device":     drops.Device,
+			"period":     drops.Period.Seconds(),
+			"received":   drops.Delta.Received,
+			"dropped":    drops.Delta.Dropped,
+			"if_dropped": drops.Delta.IfDropped,
+			"drop_rate":  rate,
+			"total": common.MapStr{
+				"received":   drops.Total.Received,
+				"dropped":    drops.Total.Dropped,
+				"if_dropped": drops.Total.IfDropped,
+			},
+		},
+	})
 }
 
+// dropsECSFields maps the capture_drops events to ECS metric events, which
+// are not the traffic of a protocol.
+func dropsECSFields(event, fields common.MapStr) {
+	fields.Put("event.kind", "metric")
+	fields.Put("event.action", "capture_drops")
+	fields.Delete("network")
+}
+
+// testSniffer checks the capture settings and BPF filters of the devices and
+// creates the processors, without opening the devices.
+func (pb *packetbeat) testSniffer(devices []config.InterfacesConfig) error {
+	for i := range devices {
+		interfaces := &devices[i]
+		if err := sniffer.TestConfig(pb.bpfFilter(interfaces), interfaces); err != nil {
+			return fmt.Errorf("device %s: %v", interfaces.Device, err)
+		}
+	}
+
+	p, err := pb.createProcessors()
+	if err != nil {
+		return err
+	}
+	pb.processors = p
+	return nil
+}
+
+// bpfFilter returns the BPF filter of a capture device, capturing the ports
+// of the protocols unless the device has a custom filter.
+func (pb *packetbeat) bpfFilter(interfaces *config.InterfacesConfig) string {
+	config := &pb.config
+	if interfaces.BpfFilter != "" || config.Flows.IsEnabled() {
+		return interfaces.BpfFilter
+	}
+
+	withICMP := config.Protocols["icmp"].Enabled()
+	filter := protos.Protos.BpfFilter(config.Interfaces.WithVlans, config.Interfaces.WithMPLS, withICMP)
+	if filter != "" && config.Interfaces.WithTunnels {
+		// prepended, as vlan and mpls move the offsets for the rest of the
+		// filter
+		filter = decoder.TunnelsBpfFilter + " or " + filter
+	}
+	return filter
+}
+
+func (pb *packetbeat) createLockedWorker(dl layers.LinkType) (sniffer.Worker, error) {
+	worker, err := pb.createWorker(dl)
+	if err != nil {
+		return nil, err
+	}
+	return &lockedWorker{mutex: &pb.mutex, worker: worker}, nil
+}
+
+// createWorker creates the decoder for the link type of a sniffer, passing
+// the packets to the shared processors.
 func (pb *packetbeat) createWorker(dl layers.LinkType) (sniffer.Worker, error) {
-	var f *flows.Flows
+	if pb.processors == nil {
+		p, err := pb.createProcessors()
+		if err != nil {
+			return nil, err
+		}
+		pb.processors = p
+	}
+
+	p := pb.processors
+	worker, err := decoder.New(p.flows, dl, p.icmp4, p.icmp6, p.tcp, p.udp)
+	if err != nil {
+		return nil, err
+	}
+	return worker, nil
+}
+
+func (pb *packetbeat) createProcessors() (*processors, error) {
 	var err error
+	p := &processors{}
 	config := &pb.config
 
 	if config.Flows.IsEnabled() {
-		f, err = flows.NewFlows(pb.pub, config.Flows)
+		p.flows, err = flows.NewFlows(pb.pub, config.Flows)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	var icmp4 icmp.ICMPv4Processor
-	var icmp6 icmp.ICMPv6Processor
 	if cfg := config.Protocols["icmp"]; cfg.Enabled() {
-		icmp, err := icmp.New(false, pb.pub, cfg)
+		results, err := publish.WithEventMetadata(pb.pub, cfg)
 		if err != nil {
 			return nil, err
 		}
 
-		icmp4 = icmp
-		icmp6 = icmp
-	}
+		icmp, err := icmp.New(false, results, cfg)
+		if err != nil {
+			return nil, err
+		}
 
-	tcp, err := tcp.NewTCP(&protos.Protos)
-	if err != nil {
-		return nil, err
+		p.icmp4 = icmp
+		p.icmp6 = icmp
 	}
 
-	udp, err := udp.NewUDP(&protos.Protos)
+	p.tcp, err = tcp.NewTCP(&protos.Protos)
 	if err != nil {
 		return nil, err
 	}
 
-	worker, err := decoder.New(f, dl, icmp4, icmp6, tcp, udp)
+	p.udp, err = udp.NewUDP(&protos.Protos)
 	if err != nil {
 		return nil, err
 	}
 
-	if f != nil {
-		pb.services = append(pb.services, f)
+	if p.flows != nil {
+		pb.services = append(pb.services, p.flows)
 	}
-	return worker, nil
+	return p, nil
 }
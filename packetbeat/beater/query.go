@@ -0,0 +1,110 @@
+package beater
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/libbeat/beat"
+	"github.com/elastic/beats/libbeat/outputs/elasticsearch"
+
+	"github.com/elastic/beats/packetbeat/query"
+)
+
+const queryUsage = `usage: %[1]s query <query> [options] [argument]
+
+Runs a canned search of the FIX events indexed in the Elasticsearch instance
+configured in output.elasticsearch, and prints the events found, for hosts
+without access to Kibana.
+
+Queries:
+  orders [options] CLORDID      messages, order and reject events of an order
+                                and of the orders replacing or replaced by it,
+                                following OrigClOrdID
+  timeline [options] SESSION    messages and events of a session, by session
+                                name or key, like SENDER->TARGET
+  rejects [options]             reject events and orders rejected, of the
+                                last hour by default
+
+Options:`
+
+func init() {
+	beat.AddCommand("query", queryCommand)
+}
+
+// queryCommand runs the 'query' command, printing the events found by a
+// canned search instead of running the Beat.
+func queryCommand(b *beat.Beat, args []string) error {
+	flags := flag.NewFlagSet("query", flag.ContinueOnError)
+	format := flags.String("format", query.FormatTable, "Format of the events printed, table or json")
+	index := flags.String("index", strings.ToLower(b.Name)+"-*", "Indices searched")
+	size := flags.Int("size", 100, "Maximum number of events printed")
+	since := flags.Duration("since", 0, "Search the events of the last duration only")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, queryUsage+"\n", b.Name)
+		flags.PrintDefaults()
+	}
+	if len(args) == 0 {
+		flags.Usage()
+		return fmt.Errorf("missing query")
+	}
+	name := args[0]
+	if err := flags.Parse(args[1:]); err == flag.ErrHelp {
+		return beat.GracefulExit
+	} else if err != nil {
+		return err
+	}
+	if *format != query.FormatTable && *format != query.FormatJSON {
+		return fmt.Errorf("unknown query format '%s', expected table or json", *format)
+	}
+
+	var search *query.Search
+	switch name {
+	case "orders", "timeline":
+		if flags.NArg() != 1 {
+			flags.Usage()
+			return fmt.Errorf("the %s query takes one argument", name)
+		}
+		if name == "orders" {
+			search = query.Orders(flags.Arg(0), *size)
+		} else {
+			search = query.Timeline(flags.Arg(0), *since, *size)
+		}
+	case "rejects":
+		if flags.NArg() > 0 {
+			flags.Usage()
+			return fmt.Errorf("unexpected rejects argument '%s'", flags.Arg(0))
+		}
+		if *since == 0 {
+			*since = time.Hour
+		}
+		search = query.Rejects(*since, *size)
+	case "-h", "-help", "--help":
+		flags.Usage()
+		return beat.GracefulExit
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown query '%s'", name)
+	}
+
+	cfg, err := b.LoadConfig()
+	if err != nil {
+		return err
+	}
+	esConfig, err := cfg.Child("output.elasticsearch", -1)
+	if err != nil {
+		return fmt.Errorf("error reading the Elasticsearch output config: %v", err)
+	}
+	client, err := elasticsearch.NewQueryClient(esConfig)
+	if err != nil {
+		return fmt.Errorf("error connecting to Elasticsearch: %v", err)
+	}
+	defer client.Close()
+
+	if err := search.Run(client, *index, *format, os.Stdout); err != nil {
+		return err
+	}
+	return beat.GracefulExit
+}
@@ -0,0 +1,71 @@
+package beater
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/elastic/beats/libbeat/beat"
+
+	"github.com/elastic/beats/packetbeat/recorder"
+)
+
+func init() {
+	extract := flag.String("extract-pcap", "", "Write the recorded packets selected by the -extract flags to this pcap file, - for stdout, and exit")
+	dir := flag.String("extract-dir", "", "Directory of the packet recording, the recorder path")
+	device := flag.String("extract-device", "", "Device to extract the packets of, all devices by default")
+	session := flag.String("extract-session", "", "Endpoints of the session to extract, as ip[:port][,ip[:port]]")
+	from := flag.String("extract-from", "", "Start of the time range to extract, in RFC 3339 format")
+	to := flag.String("extract-to", "", "End of the time range to extract, in RFC 3339 format")
+
+	beat.AddFlagsCallback(func(_ *beat.Beat) error {
+		if *extract == "" {
+			return nil
+		}
+		if *dir == "" {
+			return fmt.Errorf("-extract-pcap requires -extract-dir")
+		}
+
+		filter := recorder.Filter{Device: *device}
+		var err error
+		if *session != "" {
+			filter.Endpoints, err = recorder.ParseEndpoints(*session)
+			if err != nil {
+				return fmt.Errorf("invalid -extract-session: %v", err)
+			}
+		}
+		if filter.From, err = parseExtractTime(*from); err != nil {
+			return fmt.Errorf("invalid -extract-from: %v", err)
+		}
+		if filter.To, err = parseExtractTime(*to); err != nil {
+			return fmt.Errorf("invalid -extract-to: %v", err)
+		}
+
+		var w io.Writer = os.Stdout
+		if *extract != "-" {
+			f, err := os.Create(*extract)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		n, err := recorder.Extract(*dir, filter, w)
+		if err != nil {
+			return fmt.Errorf("Extracting packets failed: %v", err)
+		}
+		if *extract != "-" {
+			fmt.Printf("Extracted %d packets to %s\n", n, *extract)
+		}
+		return beat.GracefulExit
+	})
+}
+
+func parseExtractTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/elastic/beats/libbeat/common"
@@ -14,6 +16,9 @@ type Config struct {
 	Protocols      map[string]*common.Config `config:"protocols"`
 	Procs          procs.ProcsConfig         `config:"procs"`
 	IgnoreOutgoing bool                      `config:"ignore_outgoing"`
+	GeoIP          GeoIPConfig               `config:"geoip"`
+	Queue          QueueConfig               `config:"queue"`
+	ECS            ECSConfig                 `config:"ecs"`
 	RunOptions     droppriv.RunOptions
 }
 
@@ -21,22 +26,148 @@ type InterfacesConfig struct {
 	Device       string
 	Type         string
 	File         string
-	WithVlans    bool
-	BpfFilter    string
+	WithVlans    bool   `config:"with_vlans"`
+	WithMPLS     bool   `config:"with_mpls"`
+	WithTunnels  bool   `config:"with_tunnels"`
+	BpfFilter    string `config:"bpf_filter"`
 	Snaplen      int
-	BufferSizeMb int
+	BufferSizeMb int `config:"buffer_size_mb"`
 	TopSpeed     bool
 	Dumpfile     string
 	OneAtATime   bool
 	Loop         int
+
+	// TimestampSource selects the clock timestamping the captured packets:
+	// kernel, hardware or user
+	TimestampSource string `config:"timestamp_source"`
+
+	// ClockOffset is added to the timestamps of the packets, to correct for
+	// the skew of the clock of the capture point
+	ClockOffset time.Duration `config:"clock_offset"`
+
+	// PTPClock is the PTP hardware clock of the network card, the offset of
+	// which to the system clock is measured to correct hardware timestamps
+	PTPClock string `config:"ptp_clock"`
+
+	// MulticastGroups lists the multicast groups to join on Device
+	MulticastGroups []string `config:"multicast_groups"`
+
+	// Devices lists the devices to capture from at the same time, instead
+	// of Device
+	Devices []DeviceConfig `config:"devices"`
+
+	// DropMonitor reports the packets dropped by the capture devices
+	DropMonitor DropMonitorConfig `config:"drop_monitor"`
+
+	// Recorder records the captured packets to a ring of pcap files
+	Recorder RecorderConfig `config:"recorder"`
 }
 
+// RecorderConfig configures the recording of the packets captured from each
+// device to at most Files pcap files of FileSizeMB, the oldest file being
+// removed when a new file is started.
+type RecorderConfig struct {
+	Enabled    bool   `config:"enabled"`
+	Path       string `config:"path"`
+	Files      int    `config:"files" validate:"min=1"`
+	FileSizeMB int    `config:"file_size_mb" validate:"min=1"`
+}
+
+// DefaultRecorderConfig records 10 files of 100 MB per device to the
+// recording directory of the data path.
+var DefaultRecorderConfig = RecorderConfig{
+	Path:       "recording",
+	Files:      10,
+	FileSizeMB: 100,
+}
+
+// DropMonitorConfig configures the polling of the drop counters of the
+// capture devices, a warning event being published for every period packets
+// were dropped in. Enabled unless disabled.
+type DropMonitorConfig struct {
+	Enabled *bool         `config:"enabled"`
+	Period  time.Duration `config:"period" validate:"positive"`
+}
+
+// DefaultDropMonitorPeriod is the default polling period of the drop
+// counters.
+const DefaultDropMonitorPeriod = 10 * time.Second
+
+func (c *DropMonitorConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+// DeviceConfig holds the settings of a capture device which can be set
+// independently when capturing from several devices.
+type DeviceConfig struct {
+	Device          string         `config:"device" validate:"required"`
+	BpfFilter       string         `config:"bpf_filter"`
+	MulticastGroups []string       `config:"multicast_groups"`
+	ClockOffset     *time.Duration `config:"clock_offset"`
+	PTPClock        string         `config:"ptp_clock"`
+}
+
+// Sources of the capture timestamps of packets.
+const (
+	// TimestampKernel timestamps packets with the system clock on arrival in
+	// the kernel, the default
+	TimestampKernel = "kernel"
+	// TimestampHardware uses the timestamps taken by the network card
+	TimestampHardware = "hardware"
+	// TimestampUser timestamps packets when read by Packetbeat
+	TimestampUser = "user"
+)
+
 type Flows struct {
 	Enabled *bool  `config:"enabled"`
 	Timeout string `config:"timeout"`
 	Period  string `config:"period"`
 }
 
+// GeoIPConfig configures the MaxMind databases the client and server
+// addresses are looked up in.
+type GeoIPConfig struct {
+	Database    string `config:"database"`
+	ASNDatabase string `config:"asn_database"`
+}
+
+func (c *GeoIPConfig) Enabled() bool {
+	return c.Database != "" || c.ASNDatabase != ""
+}
+
+// ECSConfig enables the Elastic Common Schema fields of the transactions.
+type ECSConfig struct {
+	Enabled bool `config:"enabled"`
+}
+
+// QueueConfig configures the queue of the transactions published by the
+// protocol analyzers, and the policy applied when it is full.
+type QueueConfig struct {
+	// number of transactions queued, defaults to the shipper queue_size
+	Size     int         `config:"size" validate:"min=0"`
+	Overflow string      `config:"overflow"`
+	Spill    SpillConfig `config:"spill"`
+}
+
+// SpillConfig configures the file the spill overflow policy writes
+// transactions to. A MaxSizeMB of 0 puts no limit on its size.
+type SpillConfig struct {
+	Path      string `config:"path"`
+	MaxSizeMB int    `config:"max_size_mb" validate:"min=0"`
+}
+
+// DefaultSpillMaxSizeMB is the default maximum size of the spill file.
+const DefaultSpillMaxSizeMB = 1024
+
+func (c *QueueConfig) Validate() error {
+	switch c.Overflow {
+	case "", "block", "drop_oldest", "drop_newest", "spill":
+		return nil
+	}
+	return fmt.Errorf("unknown queue overflow %q, must be one of block, drop_oldest, drop_newest or spill",
+		c.Overflow)
+}
+
 type ProtocolCommon struct {
 	Ports              []int         `config:"ports"`
 	SendRequest        bool          `config:"send_request"`
@@ -44,6 +175,54 @@ type ProtocolCommon struct {
 	TransactionTimeout time.Duration `config:"transaction_timeout"`
 }
 
+func (c *InterfacesConfig) Validate() error {
+	if c.WithVlans && c.WithMPLS {
+		return errors.New("with_vlans and with_mpls can not be combined, set bpf_filter instead")
+	}
+	switch c.TimestampSource {
+	case "", TimestampKernel, TimestampHardware, TimestampUser:
+	default:
+		return fmt.Errorf("unknown timestamp_source %q, must be one of kernel, hardware or user",
+			c.TimestampSource)
+	}
+	if c.TimestampSource != TimestampHardware {
+		for _, dev := range c.DeviceConfigs() {
+			if dev.PTPClock != "" {
+				return errors.New("ptp_clock requires timestamp_source hardware")
+			}
+		}
+	}
+	return nil
+}
+
+// DeviceConfigs returns the interfaces config of each device to capture
+// from. Devices not setting a BPF filter, clock offset or PTP clock use those
+// of the interfaces config. Reading from a file ignores the devices.
+func (c *InterfacesConfig) DeviceConfigs() []InterfacesConfig {
+	if len(c.Devices) == 0 || c.File != "" {
+		return []InterfacesConfig{*c}
+	}
+
+	configs := make([]InterfacesConfig, len(c.Devices))
+	for i, dev := range c.Devices {
+		config := *c
+		config.Devices = nil
+		config.Device = dev.Device
+		config.MulticastGroups = dev.MulticastGroups
+		if dev.BpfFilter != "" {
+			config.BpfFilter = dev.BpfFilter
+		}
+		if dev.ClockOffset != nil {
+			config.ClockOffset = *dev.ClockOffset
+		}
+		if dev.PTPClock != "" {
+			config.PTPClock = dev.PTPClock
+		}
+		configs[i] = config
+	}
+	return configs
+}
+
 func (f *Flows) IsEnabled() bool {
 	return f != nil && (f.Enabled == nil || *f.Enabled)
 }
@@ -0,0 +1,192 @@
+// +build !integration
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func TestInterfacesConfigUnpack(t *testing.T) {
+	cfg, err := common.NewConfigFrom(map[string]interface{}{
+		"device":         "eth0",
+		"type":           "af_packet",
+		"with_vlans":     true,
+		"bpf_filter":     "tcp port 9878",
+		"buffer_size_mb": 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var interfaces InterfacesConfig
+	if assert.NoError(t, cfg.Unpack(&interfaces)) {
+		assert.Equal(t, "eth0", interfaces.Device)
+		assert.Equal(t, "af_packet", interfaces.Type)
+		assert.True(t, interfaces.WithVlans)
+		assert.Equal(t, "tcp port 9878", interfaces.BpfFilter)
+		assert.Equal(t, 100, interfaces.BufferSizeMb)
+	}
+}
+
+func TestInterfacesConfigDevices(t *testing.T) {
+	cfg, err := common.NewConfigFrom(map[string]interface{}{
+		"type":       "af_packet",
+		"bpf_filter": "tcp port 9878",
+		"devices": []map[string]interface{}{
+			{"device": "eth0"},
+			{"device": "eth2", "bpf_filter": "udp", "multicast_groups": []string{"239.1.1.1"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var interfaces InterfacesConfig
+	if !assert.NoError(t, cfg.Unpack(&interfaces)) {
+		return
+	}
+
+	configs := interfaces.DeviceConfigs()
+	if assert.Len(t, configs, 2) {
+		assert.Equal(t, "eth0", configs[0].Device)
+		assert.Equal(t, "tcp port 9878", configs[0].BpfFilter)
+		assert.Equal(t, "af_packet", configs[0].Type)
+		assert.Empty(t, configs[0].MulticastGroups)
+
+		assert.Equal(t, "eth2", configs[1].Device)
+		assert.Equal(t, "udp", configs[1].BpfFilter)
+		assert.Equal(t, []string{"239.1.1.1"}, configs[1].MulticastGroups)
+		assert.Empty(t, configs[1].Devices)
+	}
+
+	// a file is read instead of the devices
+	interfaces.File = "trace.pcap"
+	assert.Len(t, interfaces.DeviceConfigs(), 1)
+}
+
+func TestInterfacesConfigSingleDevice(t *testing.T) {
+	interfaces := InterfacesConfig{Device: "eth0", BpfFilter: "tcp"}
+
+	configs := interfaces.DeviceConfigs()
+	if assert.Len(t, configs, 1) {
+		assert.Equal(t, interfaces, configs[0])
+	}
+}
+
+func TestInterfacesConfigVlansAndMPLS(t *testing.T) {
+	cfg, err := common.NewConfigFrom(map[string]interface{}{
+		"with_vlans": true,
+		"with_mpls":  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var interfaces InterfacesConfig
+	assert.Error(t, cfg.Unpack(&interfaces))
+}
+
+func TestDeviceConfigRequiresDevice(t *testing.T) {
+	cfg, err := common.NewConfigFrom(map[string]interface{}{
+		"devices": []map[string]interface{}{{"bpf_filter": "tcp"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var interfaces InterfacesConfig
+	assert.Error(t, cfg.Unpack(&interfaces))
+}
+
+func TestInterfacesConfigTimestampSource(t *testing.T) {
+	for source, valid := range map[string]bool{
+		"kernel":   true,
+		"hardware": true,
+		"user":     true,
+		"adapter":  false,
+	} {
+		cfg, err := common.NewConfigFrom(map[string]interface{}{
+			"timestamp_source": source,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var interfaces InterfacesConfig
+		err = cfg.Unpack(&interfaces)
+		if valid {
+			assert.NoError(t, err, source)
+			assert.Equal(t, source, interfaces.TimestampSource)
+		} else {
+			assert.Error(t, err, source)
+		}
+	}
+}
+
+func TestInterfacesConfigClockOffset(t *testing.T) {
+	cfg, err := common.NewConfigFrom(map[string]interface{}{
+		"timestamp_source": "hardware",
+		"clock_offset":     "-150us",
+		"devices": []map[string]interface{}{
+			{"device": "eth0"},
+			{"device": "eth2", "clock_offset": "0s", "ptp_clock": "/dev/ptp1"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var interfaces InterfacesConfig
+	if !assert.NoError(t, cfg.Unpack(&interfaces)) {
+		return
+	}
+
+	configs := interfaces.DeviceConfigs()
+	if assert.Len(t, configs, 2) {
+		assert.Equal(t, -150*time.Microsecond, configs[0].ClockOffset)
+		assert.Equal(t, "", configs[0].PTPClock)
+		assert.Equal(t, time.Duration(0), configs[1].ClockOffset)
+		assert.Equal(t, "/dev/ptp1", configs[1].PTPClock)
+	}
+
+	// PTP clocks correct hardware timestamps only
+	cfg, err = common.NewConfigFrom(map[string]interface{}{
+		"devices": []map[string]interface{}{
+			{"device": "eth2", "ptp_clock": "/dev/ptp1"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kernel InterfacesConfig
+	assert.Error(t, cfg.Unpack(&kernel))
+}
+
+func TestQueueConfigUnpack(t *testing.T) {
+	cfg, err := common.NewConfigFrom(map[string]interface{}{
+		"size":              10000,
+		"overflow":          "spill",
+		"spill.max_size_mb": 512,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queue := QueueConfig{Spill: SpillConfig{MaxSizeMB: DefaultSpillMaxSizeMB}}
+	if assert.NoError(t, cfg.Unpack(&queue)) {
+		assert.Equal(t, 10000, queue.Size)
+		assert.Equal(t, "spill", queue.Overflow)
+		assert.Equal(t, 512, queue.Spill.MaxSizeMB)
+	}
+
+	cfg, err = common.NewConfigFrom(map[string]interface{}{"overflow": "drop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Error(t, cfg.Unpack(&QueueConfig{}))
+}
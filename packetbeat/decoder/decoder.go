@@ -3,6 +3,7 @@ package decoder
 import (
 	"fmt"
 
+	"github.com/elastic/beats/libbeat/common"
 	"github.com/elastic/beats/libbeat/logp"
 	"github.com/elastic/beats/packetbeat/flows"
 	"github.com/elastic/beats/packetbeat/protos"
@@ -25,8 +26,12 @@ type Decoder struct {
 	lo        layers.Loopback
 	eth       layers.Ethernet
 	d1q       [2]layers.Dot1Q
+	mpls      mplsLayer
+	gre       greLayer
+	erspan    erspanLayer
+	vxlan     vxlanLayer
 	ip4       [2]layers.IPv4
-	ip6       [2]layers.IPv6
+	ip6       [2]ipv6Layer
 	icmp4     layers.ICMPv4
 	icmp6     layers.ICMPv6
 	tcp       layers.TCP
@@ -89,9 +94,11 @@ func New(
 		&d.eth,             // Ethernet
 		&d.lo,              // loopback on OS X
 		&d.stD1Q,           // VLAN
+		&d.mpls,            // MPLS
 		&d.stIP4, &d.stIP6, // IP
 		&d.icmp4, &d.icmp6, // ICMP
 		&d.tcp, &d.udp, // TCP/UDP
+		&d.gre, &d.erspan, &d.vxlan, // tunnels
 	}
 	d.AddLayers(defaultLayerTypes)
 
@@ -159,6 +166,9 @@ func (d *Decoder) OnPacket(data []byte, ci *gopacket.CaptureInfo) {
 		}
 
 		nextType := current.NextLayerType()
+		if currentType == layers.LayerTypeUDP && d.isVXLAN() {
+			nextType = layerTypeVXLAN
+		}
 		data = current.LayerPayload()
 
 		processed, err = d.process(&packet, currentType)
@@ -248,7 +258,20 @@ func (d *Decoder) process(
 		d.onICMPv6(packet)
 		return true, nil
 
+	case layers.LayerTypeGRE:
+		debugf("GRE packet")
+		if d.gre.carriesFrame() {
+			d.onEncapsulatedFrame(packet)
+		}
+
+	case layerTypeERSPAN, layerTypeVXLAN:
+		debugf("%v packet", layerType)
+		d.onEncapsulatedFrame(packet)
+
 	case layers.LayerTypeUDP:
+		if d.isVXLAN() {
+			return false, nil
+		}
 		debugf("UDP packet")
 		d.onUDP(packet)
 		return true, nil
@@ -262,6 +285,21 @@ func (d *Decoder) process(
 	return false, nil
 }
 
+// isVXLAN checks if the current UDP datagram is sent to the VXLAN port.
+func (d *Decoder) isVXLAN() bool {
+	return d.udp.DstPort == VXLANPort
+}
+
+// onEncapsulatedFrame forgets the outer headers of an Ethernet frame carried
+// by a tunnel. The frame is analyzed as if captured locally, as the tunnel
+// only transports the mirrored traffic.
+func (d *Decoder) onEncapsulatedFrame(packet *protos.Packet) {
+	packet.Tuple = common.IPPortTuple{}
+	if d.flowID != nil {
+		d.flowID.Reset(d.flowIDBufferBacking[:0])
+	}
+}
+
 func (d *Decoder) onICMPv4(packet *protos.Packet) {
 	if d.icmp4Proc != nil {
 		packet.Payload = d.icmp4.Payload
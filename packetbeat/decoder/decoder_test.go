@@ -3,6 +3,7 @@
 package decoder
 
 import (
+	"encoding/binary"
 	"strings"
 	"testing"
 
@@ -182,6 +183,105 @@ func TestDecodePacketData_ipv6Udp(t *testing.T) {
 	assert.NotEqual(t, -1, strings.Index(string(p.Data()), string(udp.pkt.Payload)))
 }
 
+func TestDecodePacketData_ipv6Extensions(t *testing.T) {
+	hopByHop := ipv6Extension{0, []byte{0x00, 0x00, 0x01, 0x04, 0x00, 0x00, 0x00, 0x00}}
+	routing := ipv6Extension{43, []byte{
+		0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // type 0, no segments left
+		0x20, 0x01, 0x06, 0xf8, 0x09, 0x00, 0x07, 0xc0,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02,
+	}}
+	destination := ipv6Extension{60, []byte{0x00, 0x00, 0x01, 0x04, 0x00, 0x00, 0x00, 0x00}}
+	atomicFragment := ipv6Extension{44, []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x2a}}
+	authentication := ipv6Extension{51, []byte{
+		0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, // SPI 256
+		0x00, 0x00, 0x00, 0x01, // sequence number
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // ICV
+	}}
+
+	tests := map[string][]ipv6Extension{
+		"hop-by-hop":              {hopByHop},
+		"destination":             {destination},
+		"atomic fragment":         {atomicFragment},
+		"authentication":          {authentication},
+		"hop-by-hop and routing":  {hopByHop, destination, routing, destination},
+		"all with authentication": {hopByHop, routing, atomicFragment, authentication, destination},
+	}
+	for name, extensions := range tests {
+		data := withIPv6Extensions(ipv6TcpHTTPGet, extensions...)
+
+		d, tcp, _ := newTestDecoder(t)
+		d.OnPacket(data, &gopacket.CaptureInfo{Length: len(data), CaptureLength: len(data)})
+
+		if assert.NotNil(t, tcp.pkt, "TCP packet not received: %s", name) {
+			assert.Equal(t, "2001:6f8:102d:0:2d0:9ff:fee3:e8de", tcp.pkt.Tuple.SrcIP.String(), name)
+			assert.Equal(t, uint16(59201), tcp.pkt.Tuple.SrcPort, name)
+			assert.Equal(t, "2001:6f8:900:7c0::2", tcp.pkt.Tuple.DstIP.String(), name)
+			assert.Equal(t, uint16(80), tcp.pkt.Tuple.DstPort, name)
+			assert.Equal(t, ipv6TcpHTTPGet[74:], tcp.pkt.Payload, name)
+		}
+	}
+}
+
+func TestDecodePacketData_ipv6ExtensionsUdp(t *testing.T) {
+	destination := ipv6Extension{60, []byte{0x00, 0x00, 0x01, 0x04, 0x00, 0x00, 0x00, 0x00}}
+	data := withIPv6Extensions(ipv6UdpDNS, destination)
+
+	d, _, udp := newTestDecoder(t)
+	d.OnPacket(data, &gopacket.CaptureInfo{Length: len(data), CaptureLength: len(data)})
+
+	if assert.NotNil(t, udp.pkt, "UDP packet not received") {
+		assert.Equal(t, uint16(2415), udp.pkt.Tuple.SrcPort)
+		assert.Equal(t, uint16(53), udp.pkt.Tuple.DstPort)
+	}
+}
+
+func TestDecodePacketData_ipv6NotDecoded(t *testing.T) {
+	fragment := ipv6Extension{44, []byte{0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x2a}}
+	truncated := ipv6Extension{60, []byte{0x00, 0x7f, 0x01, 0x04, 0x00, 0x00, 0x00, 0x00}}
+	esp := ipv6Extension{50, []byte{0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x01}}
+
+	tests := map[string][]byte{
+		"fragment":           withIPv6Extensions(ipv6TcpHTTPGet, fragment),
+		"truncated":          withIPv6Extensions(ipv6TcpHTTPGet, truncated),
+		"esp":                withIPv6Extensions(ipv6TcpHTTPGet, esp),
+		"truncated header":   ipv6TcpHTTPGet[:40],
+		"truncated hopbyhop": withIPv6Extensions(ipv6TcpHTTPGet[:54], ipv6Extension{0, []byte{0x00, 0x01}}),
+	}
+	for name, data := range tests {
+		d, tcp, _ := newTestDecoder(t)
+		d.OnPacket(data, &gopacket.CaptureInfo{Length: len(data), CaptureLength: len(data)})
+		assert.Nil(t, tcp.pkt, name)
+	}
+}
+
+type ipv6Extension struct {
+	protocol byte
+	header   []byte
+}
+
+// withIPv6Extensions inserts extension headers after the IPv6 header of an
+// Ethernet frame, chaining their next header fields.
+func withIPv6Extensions(frame []byte, extensions ...ipv6Extension) []byte {
+	data := append([]byte{}, frame[:54]...)
+	upper := data[20]
+	data[20] = extensions[0].protocol
+
+	length := 0
+	for i, ext := range extensions {
+		header := append([]byte{}, ext.header...)
+		if i+1 < len(extensions) {
+			header[0] = extensions[i+1].protocol
+		} else {
+			header[0] = upper
+		}
+		data = append(data, header...)
+		length += len(header)
+	}
+	length += int(binary.BigEndian.Uint16(data[18:20]))
+	binary.BigEndian.PutUint16(data[18:20], uint16(length))
+	return append(data, frame[54:]...)
+}
+
 // Creates a new TestDecoder that handles ethernet packets.
 func newTestDecoder(t *testing.T) (*Decoder, *TestTCPProcessor, *TestUDPProcessor) {
 	icmp4Layer := &TestIcmp4Processor{}
@@ -194,3 +294,136 @@ func newTestDecoder(t *testing.T) (*Decoder, *TestTCPProcessor, *TestUDPProcesso
 	}
 	return d, tcpLayer, udpLayer
 }
+
+// encapsulate inserts tags between the MAC addresses and the EtherType of an
+// Ethernet frame.
+func encapsulate(frame []byte, tags ...byte) []byte {
+	var data []byte
+	data = append(data, frame[:12]...)
+	data = append(data, tags...)
+	return append(data, frame[12:]...)
+}
+
+func TestDecodePacketData_vlan(t *testing.T) {
+	frame := encapsulate(ipv4TcpDNS, 0x81, 0x00, 0x00, 0x64)
+	assertTCPDecoded(t, frame)
+}
+
+func TestDecodePacketData_qinq(t *testing.T) {
+	// 802.1ad and pre-standard service tags
+	for _, tpid := range [][]byte{{0x88, 0xa8}, {0x91, 0x00}} {
+		frame := encapsulate(ipv4TcpDNS,
+			tpid[0], tpid[1], 0x00, 0x0a, // service tag 10
+			0x81, 0x00, 0x00, 0x64) // customer tag 100
+		assertTCPDecoded(t, frame)
+	}
+}
+
+func TestDecodePacketData_mpls(t *testing.T) {
+	var data []byte
+	data = append(data, ipv4TcpDNS[:12]...)
+	data = append(data, 0x88, 0x47)
+	data = append(data, 0x00, 0x01, 0x00, 0x40) // label 16
+	data = append(data, 0x00, 0x01, 0x11, 0x40) // label 17, bottom of stack
+	data = append(data, ipv4TcpDNS[14:]...)
+	assertTCPDecoded(t, data)
+}
+
+func TestDecodePacketData_mplsTruncated(t *testing.T) {
+	data := append(append([]byte{}, ipv4TcpDNS[:12]...), 0x88, 0x47, 0x00, 0x01)
+
+	d, tcp, _ := newTestDecoder(t)
+	d.OnPacket(data, &gopacket.CaptureInfo{Length: len(data), CaptureLength: len(data)})
+	assert.Nil(t, tcp.pkt)
+}
+
+func TestDecodePacketData_greTransparentBridging(t *testing.T) {
+	gre := []byte{0x00, 0x00, 0x65, 0x58}
+	assertTCPDecoded(t, tunnel(ipProtocolGRE, append(gre, ipv4TcpDNS...)))
+}
+
+func TestDecodePacketData_erspanTypeII(t *testing.T) {
+	gre := []byte{
+		0x10, 0x00, 0x88, 0xbe, // sequence number present
+		0x00, 0x00, 0x00, 0x01, // sequence number
+		0x10, 0x64, 0x00, 0x2a, // version 1, vlan 100, session 42
+		0x00, 0x00, 0x00, 0x00, // index
+	}
+	assertTCPDecoded(t, tunnel(ipProtocolGRE, append(gre, ipv4TcpDNS...)))
+}
+
+func TestDecodePacketData_erspanTypeIII(t *testing.T) {
+	gre := []byte{
+		0x10, 0x00, 0x22, 0xeb, // sequence number present
+		0x00, 0x00, 0x00, 0x01, // sequence number
+		0x20, 0x64, 0x00, 0x2a, // version 2, vlan 100, session 42
+		0x00, 0x00, 0x00, 0x00, // timestamp
+		0x00, 0x00, 0x00, 0x00, // sgt, flags, no platform specific header
+	}
+	assertTCPDecoded(t, tunnel(ipProtocolGRE, append(gre, ipv4TcpDNS...)))
+}
+
+func TestDecodePacketData_greIPv4(t *testing.T) {
+	gre := []byte{0x00, 0x00, 0x08, 0x00}
+	assertTCPDecoded(t, tunnel(ipProtocolGRE, append(gre, ipv4TcpDNS[14:]...)))
+}
+
+func TestDecodePacketData_vxlan(t *testing.T) {
+	payload := []byte{
+		0xc0, 0x00, 0x12, 0xb5, // ports 49152 -> 4789
+		0x00, 0x00, 0x00, 0x00, // length, checksum
+		0x08, 0x00, 0x00, 0x00, // VNI present
+		0x00, 0x01, 0x00, 0x00, // VNI 256
+	}
+	payload = append(payload, ipv4TcpDNS...)
+	binary.BigEndian.PutUint16(payload[4:], uint16(len(payload)))
+	assertTCPDecoded(t, tunnel(ipProtocolUDP, payload))
+}
+
+func TestDecodePacketData_vxlanInvalidFlags(t *testing.T) {
+	payload := []byte{
+		0xc0, 0x00, 0x12, 0xb5,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, // VNI not present
+		0x00, 0x01, 0x00, 0x00,
+	}
+	payload = append(payload, ipv4TcpDNS...)
+	binary.BigEndian.PutUint16(payload[4:], uint16(len(payload)))
+	data := tunnel(ipProtocolUDP, payload)
+
+	d, tcp, _ := newTestDecoder(t)
+	d.OnPacket(data, &gopacket.CaptureInfo{Length: len(data), CaptureLength: len(data)})
+	assert.Nil(t, tcp.pkt)
+}
+
+const (
+	ipProtocolUDP = 0x11
+	ipProtocolGRE = 0x2f
+)
+
+// tunnel wraps payload in an Ethernet frame and an IPv4 header from
+// 10.0.0.1 to 10.0.0.2.
+func tunnel(protocol byte, payload []byte) []byte {
+	data := append([]byte{}, ipv4TcpDNS[:14]...)
+	ip := []byte{
+		0x45, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, 0x00,
+		0x40, protocol, 0x00, 0x00,
+		0x0a, 0x00, 0x00, 0x01,
+		0x0a, 0x00, 0x00, 0x02,
+	}
+	binary.BigEndian.PutUint16(ip[2:], uint16(len(ip)+len(payload)))
+	data = append(data, ip...)
+	return append(data, payload...)
+}
+
+func assertTCPDecoded(t *testing.T, data []byte) {
+	d, tcp, _ := newTestDecoder(t)
+	d.OnPacket(data, &gopacket.CaptureInfo{Length: len(data), CaptureLength: len(data)})
+
+	if assert.NotNil(t, tcp.pkt, "TCP packet not received") {
+		assert.Equal(t, "172.16.16.164", tcp.pkt.Tuple.SrcIP.String())
+		assert.Equal(t, uint16(1108), tcp.pkt.Tuple.SrcPort)
+		assert.Equal(t, "172.16.16.139", tcp.pkt.Tuple.DstIP.String())
+		assert.Equal(t, uint16(53), tcp.pkt.Tuple.DstPort)
+	}
+}
@@ -0,0 +1,249 @@
+package decoder
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/tsg/gopacket"
+	"github.com/tsg/gopacket/layers"
+)
+
+// 802.1ad service tags of QinQ frames, and the tag type used before 802.1ad
+// was standardized.
+const (
+	ethernetTypeQinQ       layers.EthernetType = 0x88a8
+	ethernetTypeQinQLegacy layers.EthernetType = 0x9100
+)
+
+func init() {
+	// gopacket only knows 802.1Q tags. Service tags have the same format, so
+	// decode them as 802.1Q tags.
+	for _, typ := range []layers.EthernetType{ethernetTypeQinQ, ethernetTypeQinQLegacy} {
+		layers.EthernetTypeMetadata[typ] = layers.EnumMetadata{
+			DecodeWith: layers.EthernetTypeDot1Q,
+			Name:       "QinQ",
+			LayerType:  layers.LayerTypeDot1Q,
+		}
+	}
+}
+
+var errMPLSTruncated = errors.New("MPLS label stack entry truncated")
+
+// mplsLayer decodes a MPLS label stack entry. gopacket provides no
+// DecodingLayer for MPLS. As MPLS has no type information, the payload of
+// the bottom of the stack is decoded as IPv4 or IPv6 by its IP version.
+type mplsLayer struct {
+	layers.MPLS
+}
+
+func (m *mplsLayer) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 4 {
+		df.SetTruncated()
+		return errMPLSTruncated
+	}
+
+	entry := binary.BigEndian.Uint32(data[:4])
+	m.Label = entry >> 12
+	m.TrafficClass = uint8(entry>>9) & 0x7
+	m.StackBottom = entry&0x100 != 0
+	m.TTL = uint8(entry)
+	m.BaseLayer = layers.BaseLayer{Contents: data[:4], Payload: data[4:]}
+	return nil
+}
+
+func (m *mplsLayer) CanDecode() gopacket.LayerClass {
+	return layers.LayerTypeMPLS
+}
+
+func (m *mplsLayer) NextLayerType() gopacket.LayerType {
+	if !m.StackBottom {
+		return layers.LayerTypeMPLS
+	}
+	if len(m.Payload) == 0 {
+		return gopacket.LayerTypeZero
+	}
+
+	switch m.Payload[0] >> 4 {
+	case 4:
+		return layers.LayerTypeIPv4
+	case 6:
+		return layers.LayerTypeIPv6
+	}
+	return gopacket.LayerTypeZero
+}
+
+// GRE protocol types of mirrored Ethernet frames.
+const (
+	ethernetTypeTransparentBridging layers.EthernetType = 0x6558
+	ethernetTypeERSPAN              layers.EthernetType = 0x88be // type I and II
+	ethernetTypeERSPANTypeIII       layers.EthernetType = 0x22eb
+)
+
+const (
+	greChecksumPresent = 0x80
+	greRoutingPresent  = 0x40
+	greKeyPresent      = 0x20
+	greSeqPresent      = 0x10
+)
+
+// VXLANPort is the UDP port of VXLAN, as assigned by IANA.
+const VXLANPort = 4789
+
+// TunnelsBpfFilter matches the GRE, ERSPAN and VXLAN packets to decapsulate.
+var TunnelsBpfFilter = fmt.Sprintf("proto gre or udp dst port %d", VXLANPort)
+
+var (
+	layerTypeERSPAN = gopacket.RegisterLayerType(1100,
+		gopacket.LayerTypeMetadata{Name: "ERSPAN", Decoder: gopacket.DecodePayload})
+	layerTypeVXLAN = gopacket.RegisterLayerType(1101,
+		gopacket.LayerTypeMetadata{Name: "VXLAN", Decoder: gopacket.DecodePayload})
+)
+
+var (
+	errGRETruncated    = errors.New("GRE header truncated")
+	errERSPANTruncated = errors.New("ERSPAN header truncated")
+	errVXLANTruncated  = errors.New("VXLAN header truncated")
+	errVXLANInvalid    = errors.New("VXLAN header without VNI")
+)
+
+// greLayer decodes GRE headers, as the GRE DecodingLayer of gopacket
+// expects all optional fields to be present. Packets using the deprecated
+// routing fields, or GRE versions other than 0 like PPTP, are not decoded
+// any further.
+type greLayer struct {
+	layers.BaseLayer
+	protocol    layers.EthernetType
+	seqPresent  bool
+	unsupported bool
+}
+
+func (g *greLayer) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 4 {
+		df.SetTruncated()
+		return errGRETruncated
+	}
+
+	flags := data[0]
+	version := data[1] & 0x7
+	g.unsupported = version != 0 || flags&greRoutingPresent != 0
+	g.seqPresent = flags&greSeqPresent != 0
+	g.protocol = layers.EthernetType(binary.BigEndian.Uint16(data[2:4]))
+
+	length := 4
+	if flags&greChecksumPresent != 0 {
+		length += 4
+	}
+	if flags&greKeyPresent != 0 {
+		length += 4
+	}
+	if g.seqPresent {
+		length += 4
+	}
+	if len(data) < length {
+		df.SetTruncated()
+		return errGRETruncated
+	}
+
+	g.BaseLayer = layers.BaseLayer{Contents: data[:length], Payload: data[length:]}
+	return nil
+}
+
+func (g *greLayer) CanDecode() gopacket.LayerClass {
+	return layers.LayerTypeGRE
+}
+
+func (g *greLayer) NextLayerType() gopacket.LayerType {
+	if g.unsupported {
+		return gopacket.LayerTypeZero
+	}
+
+	switch g.protocol {
+	case ethernetTypeTransparentBridging:
+		return layers.LayerTypeEthernet
+	case ethernetTypeERSPAN:
+		// ERSPAN type I has no ERSPAN header, nor a GRE sequence number
+		if !g.seqPresent {
+			return layers.LayerTypeEthernet
+		}
+		return layerTypeERSPAN
+	case ethernetTypeERSPANTypeIII:
+		return layerTypeERSPAN
+	}
+	return g.protocol.LayerType()
+}
+
+// carriesFrame reports if the GRE payload is a mirrored or bridged Ethernet
+// frame.
+func (g *greLayer) carriesFrame() bool {
+	return g.NextLayerType() == layers.LayerTypeEthernet
+}
+
+// erspanLayer decodes the ERSPAN type II and type III headers of the
+// Ethernet frames mirrored by remote SPAN sessions.
+type erspanLayer struct {
+	layers.BaseLayer
+}
+
+func (e *erspanLayer) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 8 {
+		df.SetTruncated()
+		return errERSPANTruncated
+	}
+
+	var length int
+	switch version := data[0] >> 4; version {
+	case 1: // type II
+		length = 8
+	case 2: // type III, optionally followed by a platform specific subheader
+		length = 12
+		if len(data) >= length && data[11]&0x01 != 0 {
+			length += 8
+		}
+	default:
+		return fmt.Errorf("unsupported ERSPAN version %d", version)
+	}
+	if len(data) < length {
+		df.SetTruncated()
+		return errERSPANTruncated
+	}
+
+	e.BaseLayer = layers.BaseLayer{Contents: data[:length], Payload: data[length:]}
+	return nil
+}
+
+func (e *erspanLayer) CanDecode() gopacket.LayerClass {
+	return layerTypeERSPAN
+}
+
+func (e *erspanLayer) NextLayerType() gopacket.LayerType {
+	return layers.LayerTypeEthernet
+}
+
+// vxlanLayer decodes the VXLAN header of UDP datagrams sent to VXLANPort,
+// carrying Ethernet frames, e.g. as mirrored by cloud traffic mirroring
+// services.
+type vxlanLayer struct {
+	layers.BaseLayer
+}
+
+func (v *vxlanLayer) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 8 {
+		df.SetTruncated()
+		return errVXLANTruncated
+	}
+	if data[0]&0x08 == 0 {
+		return errVXLANInvalid
+	}
+
+	v.BaseLayer = layers.BaseLayer{Contents: data[:8], Payload: data[8:]}
+	return nil
+}
+
+func (v *vxlanLayer) CanDecode() gopacket.LayerClass {
+	return layerTypeVXLAN
+}
+
+func (v *vxlanLayer) NextLayerType() gopacket.LayerType {
+	return layers.LayerTypeEthernet
+}
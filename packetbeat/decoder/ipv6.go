@@ -0,0 +1,123 @@
+package decoder
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/tsg/gopacket"
+	"github.com/tsg/gopacket/layers"
+)
+
+// IPv6 extension headers not known to gopacket. They use the same format as
+// the routing and destination options headers.
+const (
+	ipProtocolMobility layers.IPProtocol = 135
+	ipProtocolHIP      layers.IPProtocol = 139
+	ipProtocolShim6    layers.IPProtocol = 140
+)
+
+var errIPv6Truncated = errors.New("IPv6 header truncated")
+
+// ipv6Layer decodes IPv6 headers with all extension headers, so that the
+// upper layer protocols are decoded like for IPv4. gopacket only handles the
+// hop-by-hop options as part of the IPv6 header.
+//
+// Fragmented packets are not decoded any further, like IPv4 fragments.
+// Packets protected by ESP are not decoded either.
+type ipv6Layer struct {
+	layers.IPv6
+
+	// protocol following the extension headers
+	upper      layers.IPProtocol
+	fragmented bool
+}
+
+func (ip6 *ipv6Layer) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 40 {
+		df.SetTruncated()
+		return errIPv6Truncated
+	}
+	if layers.IPProtocol(data[6]) == layers.IPProtocolIPv6HopByHop {
+		// gopacket does not check the length of the hop-by-hop options
+		if len(data) < 48 || len(data) < 40+extensionLength(data[40:]) {
+			df.SetTruncated()
+			return errIPv6Truncated
+		}
+	}
+
+	if err := ip6.IPv6.DecodeFromBytes(data, df); err != nil {
+		return err
+	}
+
+	next := ip6.NextHeader
+	if ip6.HopByHop != nil {
+		next = ip6.HopByHop.NextHeader
+	}
+
+	ip6.fragmented = false
+	payload := ip6.Payload
+	for isIPv6Extension(next) {
+		if len(payload) < 8 {
+			df.SetTruncated()
+			return errIPv6Truncated
+		}
+
+		length := 8
+		switch next {
+		case layers.IPProtocolIPv6Fragment:
+			offset := binary.BigEndian.Uint16(payload[2:4]) >> 3
+			moreFragments := payload[3]&0x1 != 0
+
+			// atomic fragments are handled as unfragmented packets
+			ip6.fragmented = offset != 0 || moreFragments
+		case layers.IPProtocolAH:
+			length = (int(payload[1]) + 2) * 4
+		default:
+			length = extensionLength(payload)
+		}
+		if len(payload) < length {
+			df.SetTruncated()
+			return errIPv6Truncated
+		}
+
+		next = layers.IPProtocol(payload[0])
+		payload = payload[length:]
+		if ip6.fragmented {
+			break
+		}
+	}
+
+	headerLength := len(ip6.Contents) + len(ip6.Payload) - len(payload)
+	ip6.Contents = data[:headerLength]
+	ip6.Payload = payload
+	ip6.upper = next
+	return nil
+}
+
+func (ip6 *ipv6Layer) NextLayerType() gopacket.LayerType {
+	if ip6.fragmented {
+		return gopacket.LayerTypeFragment
+	}
+	return ip6.upper.LayerType()
+}
+
+func isIPv6Extension(protocol layers.IPProtocol) bool {
+	switch protocol {
+	case layers.IPProtocolIPv6HopByHop,
+		layers.IPProtocolIPv6Routing,
+		layers.IPProtocolIPv6Fragment,
+		layers.IPProtocolIPv6Destination,
+		layers.IPProtocolAH,
+		ipProtocolMobility,
+		ipProtocolHIP,
+		ipProtocolShim6:
+		return true
+	}
+	return false
+}
+
+// extensionLength returns the length in bytes of an extension header, whose
+// length field counts units of 8 bytes, not including the first 8 bytes.
+func extensionLength(data []byte) int {
+	return (int(data[1]) + 1) * 8
+}
@@ -130,7 +130,15 @@ func (c *counterReg) newFloat(name string) (*Float, error) {
 // XXX:
 //  - error on index > int max
 //  - error if already in use
+// reg returns the index of the counter name. Counters registered more than
+// once by name, e.g. by the decoders of several sniffers, share the index.
 func (reg *counterTypeReg) reg(name string) (int, error) {
+	for i, n := range reg.names {
+		if n == name {
+			return i, nil
+		}
+	}
+
 	debugf("register flow counter: %v", name)
 
 	i := len(reg.names)
@@ -141,3 +141,20 @@ func TestFlowsCounting(t *testing.T) {
 	assert.Equal(t, nil, stat["float1"])
 	assert.Equal(t, 1.4142, stat["float2"])
 }
+
+func TestFlowsCounterRegisteredTwice(t *testing.T) {
+	module, err := NewFlows(nil, &config.Flows{})
+	assert.NoError(t, err)
+
+	packets1, err := module.NewUint("net_packets_total")
+	assert.NoError(t, err)
+	packets2, err := module.NewUint("net_packets_total")
+	assert.NoError(t, err)
+	bytes, err := module.NewUint("net_bytes_total")
+	assert.NoError(t, err)
+
+	assert.Equal(t, packets1.i, packets2.i)
+	assert.NotEqual(t, packets1.i, bytes.i)
+	assert.Equal(t, []string{"net_packets_total", "net_bytes_total"},
+		module.counterReg.uints.getNames())
+}
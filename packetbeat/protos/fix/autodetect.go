@@ -0,0 +1,164 @@
+package fix
+
+import (
+	"bytes"
+	"expvar"
+	"net"
+	"sync"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/packetbeat/protos"
+	"github.com/elastic/beats/packetbeat/protos/tcp"
+)
+
+type autodetectConfig struct {
+	Enabled bool `config:"enabled"`
+
+	// decode the messages of the connections detected, or only publish the
+	// autodetected_session event
+	Decode bool `config:"decode"`
+}
+
+var defaultAutodetectConfig = autodetectConfig{
+	Decode: true,
+}
+
+var autodetectedSessions = expvar.NewInt("fix.autodetected_sessions")
+
+// Only the first bytes of the first packets of a connection are inspected.
+// Connections not detected by then are remembered as not FIX until idle for
+// protos.DefaultTransactionExpiration.
+const (
+	autodetectPackets = 4
+	autodetectBytes   = 1024
+)
+
+// maxDetectedServers limits the number of acceptors remembered from the
+// connections detected.
+const maxDetectedServers = 10000
+
+// detectedServers holds the endpoints of the acceptors of the connections
+// detected, the receivers of their first message, so that the connections
+// to these acceptors captured reversed are recognized.
+type detectedServers struct {
+	mutex     sync.Mutex
+	endpoints map[common.Endpoint]bool
+}
+
+func (d *detectedServers) add(ip net.IP, port uint16) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.endpoints == nil {
+		d.endpoints = map[common.Endpoint]bool{}
+	}
+	if len(d.endpoints) < maxDetectedServers {
+		d.endpoints[common.Endpoint{IP: ip.String(), Port: port}] = true
+	}
+}
+
+func (d *detectedServers) contains(ip net.IP, port uint16) bool {
+	if d == nil {
+		return false
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.endpoints[common.Endpoint{IP: ip.String(), Port: port}]
+}
+
+// DetectsTCP implements protos.TCPDetector, FIX being detected on ports not
+// configured if autodetect is enabled.
+func (fix *fixPlugin) DetectsTCP() bool {
+	return fix.autodetect.Enabled
+}
+
+// DetectTCP claims the connections sending a BeginString (8) followed by a
+// BodyLength (9), at the start of the payload or after the SOH ending the
+// previous message. The receiver of the packet is remembered as an acceptor
+// unless the sender is one.
+func (fix *fixPlugin) DetectTCP(pkt *protos.Packet) (protos.ProtocolData, bool) {
+	if fix.undetected == nil {
+		fix.undetected = common.NewCache(
+			protos.DefaultTransactionExpiration,
+			protos.DefaultTransactionHashSize)
+		fix.undetected.StartJanitor(protos.DefaultTransactionExpiration)
+	}
+	// the packets of both directions are counted
+	key := pkt.Tuple.Hashable()
+	attempts, found := fix.undetected.Get(key).(int)
+	if !found {
+		if n, ok := fix.undetected.Get(pkt.Tuple.RevHashable()).(int); ok {
+			key, attempts, found = pkt.Tuple.RevHashable(), n, true
+		}
+	}
+	if attempts >= autodetectPackets {
+		return nil, false
+	}
+
+	payload := pkt.Payload
+	if len(payload) > autodetectBytes {
+		payload = payload[:autodetectBytes]
+	}
+	if !isFIXPayload(payload) {
+		fix.undetected.Put(key, attempts+1)
+		return nil, false
+	}
+	if found {
+		fix.undetected.Delete(key)
+	}
+	if !fix.isServerPort(pkt.Tuple.SrcIP, pkt.Tuple.SrcPort) {
+		fix.detectedServers.add(pkt.Tuple.DstIP, pkt.Tuple.DstPort)
+	}
+	return &fixConnectionData{autodetected: true}, true
+}
+
+func isFIXPayload(payload []byte) bool {
+	for offset := 0; ; {
+		i := bytes.Index(payload[offset:], beginStringFIX)
+		if i < 0 {
+			return false
+		}
+		i += offset
+		if i == 0 || payload[i-1] == soh {
+			// 8=FIX.4.4^9= and 8=FIXT.1.1^9=
+			rest := payload[i+len(beginStringFIX):]
+			if n := bytes.IndexByte(rest, soh); n >= 0 && n <= 8 &&
+				bytes.HasPrefix(rest[n+1:], bodyLengthPrefix) {
+				return true
+			}
+		}
+		offset = i + len(beginStringFIX)
+	}
+}
+
+// publishAutodetectedEvent publishes the first message of a connection
+// detected on a port not configured, sent in direction dir of tcptuple.
+func (fix *fixPlugin) publishAutodetectedEvent(
+	conn *fixConnectionData,
+	tcptuple *common.TCPTuple,
+	dir uint8,
+	msg *message,
+) {
+	autodetectedSessions.Add(1)
+	beginString, _ := msg.fields.get(tagBeginString)
+	sender, _ := msg.fields.get(tagSenderCompID)
+	target, _ := msg.fields.get(tagTargetCompID)
+
+	s := &conn.session
+	src := common.Endpoint{IP: tcptuple.SrcIP.String(), Port: tcptuple.SrcPort}
+	dst := common.Endpoint{IP: tcptuple.DstIP.String(), Port: tcptuple.DstPort}
+	if dir == tcp.TCPDirectionReverse {
+		src, dst = dst, src
+	}
+	fix.results.PublishTransaction(common.MapStr{
+		"@timestamp": common.Time(msg.ts),
+		"type":       "fix",
+		"src":        &src,
+		"dst":        &dst,
+		"fix": s.eventFields("autodetected_session", common.MapStr{
+			"version":        beginString,
+			"sender_comp_id": sender,
+			"target_comp_id": target,
+			"decoded":        fix.autodetect.Decode,
+		}),
+	})
+}
@@ -0,0 +1,174 @@
+// +build !integration
+
+package fix
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/packetbeat/protos"
+	"github.com/elastic/beats/packetbeat/protos/tcp"
+)
+
+var _ protos.TCPDetector = &fixPlugin{}
+
+func TestIsFIXPayload(t *testing.T) {
+	logon := fixMessage("8=FIX.4.4|35=A|49=CLIENT|56=VENUE|34=1|")
+	assert.True(t, isFIXPayload(logon))
+	assert.True(t, isFIXPayload(fixMessage("8=FIXT.1.1|35=A|49=CLIENT|56=VENUE|34=1|")))
+	// the end of the previous message is captured first
+	assert.True(t, isFIXPayload(append([]byte("10=123\x01"), logon...)))
+
+	assert.False(t, isFIXPayload([]byte("GET / HTTP/1.1\r\n\r\n")))
+	assert.False(t, isFIXPayload([]byte("58=8=FIX.4.4\x019=12\x01")))
+	assert.False(t, isFIXPayload([]byte("8=FIX.4.4\x0135=A\x01")))
+	assert.False(t, isFIXPayload([]byte("8=FIX")))
+}
+
+func parseDetected(fix *fixPlugin, msgs ...string) protos.ProtocolData {
+	tuple := common.TCPTuple{
+		SrcIP: net.ParseIP("10.1.2.3"), SrcPort: 34567,
+		DstIP: net.ParseIP("10.1.2.4"), DstPort: 9123,
+	}
+	var private protos.ProtocolData
+	for i, msg := range msgs {
+		pkt := &protos.Packet{Ts: time.Now(), Payload: fixMessage(msg),
+			Tuple: common.NewIPPortTuple(4, tuple.SrcIP, tuple.SrcPort, tuple.DstIP, tuple.DstPort)}
+		if i == 0 {
+			var ok bool
+			if private, ok = fix.DetectTCP(pkt); !ok {
+				return nil
+			}
+		}
+		private = fix.Parse(pkt, &tuple, tcp.TCPDirectionOriginal, private)
+	}
+	return private
+}
+
+func TestAutodetect(t *testing.T) {
+	fix, results := fixModForTests()
+	assert.False(t, fix.DetectsTCP())
+	fix.autodetect.Enabled = true
+	assert.True(t, fix.DetectsTCP())
+
+	_, ok := fix.DetectTCP(&protos.Packet{Payload: []byte("GET / HTTP/1.1\r\n")})
+	assert.False(t, ok)
+
+	parseDetected(fix,
+		"8=FIX.4.4|35=A|49=CLIENT|56=VENUE|34=1|98=0|108=30|",
+		"8=FIX.4.4|35=0|49=CLIENT|56=VENUE|34=2|")
+
+	assert.Equal(t, "A", expectEvent(t, results)["fix"].(common.MapStr)["MsgType"])
+	event := expectEvent(t, results)
+	fields := event["fix"].(common.MapStr)
+	assert.Equal(t, common.MapStr{
+		"version":        "FIX.4.4",
+		"sender_comp_id": "CLIENT",
+		"target_comp_id": "VENUE",
+		"decoded":        true,
+	}, fields["autodetected_session"])
+	assert.Equal(t, "CLIENT->VENUE", fields["session_key"])
+	assert.Equal(t, uint16(9123), event["dst"].(*common.Endpoint).Port)
+
+	// the messages after the first one are not reported again
+	for len(results.Channel) > 0 {
+		event := <-results.Channel
+		assert.NotContains(t, event["fix"], "autodetected_session")
+	}
+}
+
+func TestAutodetectWithoutDecoding(t *testing.T) {
+	fix, results := fixModForTests()
+	fix.autodetect = autodetectConfig{Enabled: true, Decode: false}
+
+	parseDetected(fix,
+		"8=FIX.4.4|35=A|49=CLIENT|56=VENUE|34=1|98=0|108=30|",
+		"8=FIX.4.4|35=D|49=CLIENT|56=VENUE|34=2|")
+
+	event := expectEvent(t, results)
+	detected := event["fix"].(common.MapStr)["autodetected_session"].(common.MapStr)
+	assert.Equal(t, false, detected["decoded"])
+	assert.Len(t, results.Channel, 0)
+}
+
+func TestAutodetectedServerPort(t *testing.T) {
+	fix, _ := fixModForTests()
+	fix.autodetect.Enabled = true
+
+	parseDetected(fix, "8=FIX.4.4|35=A|49=CLIENT|56=VENUE|34=1|98=0|108=30|")
+	assert.True(t, fix.isServerPort(net.ParseIP("10.1.2.4"), 9123))
+	assert.False(t, fix.isServerPort(net.ParseIP("10.1.2.3"), 34567))
+
+	// another connection to the acceptor, captured from its first reply
+	tuple := common.TCPTuple{
+		SrcIP: net.ParseIP("10.1.2.4"), SrcPort: 9123,
+		DstIP: net.ParseIP("10.1.2.5"), DstPort: 45678,
+	}
+	pkt := &protos.Packet{Ts: time.Now(), Payload: fixMessage("8=FIX.4.4|35=0|49=VENUE|56=OTHER|34=9|"),
+		Tuple: common.NewIPPortTuple(4, tuple.SrcIP, tuple.SrcPort, tuple.DstIP, tuple.DstPort)}
+	private, ok := fix.DetectTCP(pkt)
+	assert.True(t, ok)
+	private = fix.Parse(pkt, &tuple, tcp.TCPDirectionOriginal, private)
+	assert.True(t, private.(*fixConnectionData).reversed)
+	assert.False(t, fix.isServerPort(net.ParseIP("10.1.2.5"), 45678))
+}
+
+func TestAutodetectFirstPacketsOnly(t *testing.T) {
+	fix, _ := fixModForTests()
+	fix.autodetect.Enabled = true
+
+	tuple := common.NewIPPortTuple(4,
+		net.ParseIP("10.1.2.3"), 34567, net.ParseIP("10.1.2.4"), 9123)
+	reply := common.NewIPPortTuple(4,
+		net.ParseIP("10.1.2.4"), 9123, net.ParseIP("10.1.2.3"), 34567)
+	logon := fixMessage("8=FIX.4.4|35=A|49=CLIENT|56=VENUE|34=1|98=0|108=30|")
+
+	// messages beyond the first bytes are not inspected
+	large := append(bytes.Repeat([]byte("x"), autodetectBytes), logon...)
+	_, ok := fix.DetectTCP(&protos.Packet{Tuple: tuple, Payload: large})
+	assert.False(t, ok)
+
+	// packets of both directions are counted
+	for i := 1; i < autodetectPackets; i++ {
+		pkt := &protos.Packet{Tuple: tuple, Payload: []byte("GET / HTTP/1.1\r\n")}
+		if i%2 == 0 {
+			pkt.Tuple = reply
+		}
+		_, ok = fix.DetectTCP(pkt)
+		assert.False(t, ok)
+	}
+	_, ok = fix.DetectTCP(&protos.Packet{Tuple: tuple, Payload: logon})
+	assert.False(t, ok)
+
+	// other connections are still detected
+	other := common.NewIPPortTuple(4,
+		net.ParseIP("10.1.2.3"), 34568, net.ParseIP("10.1.2.4"), 9123)
+	_, ok = fix.DetectTCP(&protos.Packet{Tuple: other, Payload: logon})
+	assert.True(t, ok)
+}
+
+func TestAutodetectedEventEndpoints(t *testing.T) {
+	fix, results := fixModForTests()
+	fix.autodetect = autodetectConfig{Enabled: true, Decode: false}
+
+	// the capture started with a message of the acceptor
+	tuple := common.TCPTuple{
+		SrcIP: net.ParseIP("10.1.2.3"), SrcPort: 34567,
+		DstIP: net.ParseIP("10.1.2.4"), DstPort: 9123,
+	}
+	pkt := &protos.Packet{Ts: time.Now(), Payload: fixMessage("8=FIX.4.4|35=0|49=VENUE|56=CLIENT|34=9|"),
+		Tuple: common.NewIPPortTuple(4, tuple.DstIP, tuple.DstPort, tuple.SrcIP, tuple.SrcPort)}
+	private, ok := fix.DetectTCP(pkt)
+	assert.True(t, ok)
+	fix.Parse(pkt, &tuple, tcp.TCPDirectionReverse, private)
+
+	event := expectEvent(t, results)
+	assert.Contains(t, event["fix"], "autodetected_session")
+	assert.Equal(t, &common.Endpoint{IP: "10.1.2.4", Port: 9123}, event["src"])
+	assert.Equal(t, &common.Endpoint{IP: "10.1.2.3", Port: 34567}, event["dst"])
+}
@@ -0,0 +1,462 @@
+package fix
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// Market data message types.
+const (
+	msgTypeMarketDataSnapshot    = "W"
+	msgTypeMarketDataIncremental = "X"
+)
+
+const (
+	tagSecurityID       = 48
+	tagSecurityExchange = 207
+	tagNoMDEntries      = 268
+	tagMDEntryType      = 269
+	tagMDEntryPx        = 270
+	tagMDEntrySize      = 271
+	tagMDEntryID        = 278
+	tagMDUpdateAction   = 279
+	tagMDEntryRefID     = 280
+)
+
+// MDEntryType and MDUpdateAction values.
+const (
+	mdEntryTypeBid       = "0"
+	mdEntryTypeOffer     = "1"
+	mdEntryTypeTrade     = "2"
+	mdEntryTypeEmptyBook = "J"
+
+	mdUpdateActionNew    = "0"
+	mdUpdateActionChange = "1"
+	mdUpdateActionDelete = "2"
+)
+
+// maxBookSymbols limits the number of books reconstructed. Symbols beyond
+// the limit are not tracked.
+const maxBookSymbols = 10000
+
+type bookConfig struct {
+	Enabled  bool          `config:"enabled"`
+	Interval time.Duration `config:"interval" validate:"min=0"`
+}
+
+var defaultBookConfig = bookConfig{
+	Interval: time.Second,
+}
+
+// bookTracker reconstructs the book of each symbol, per session and
+// SecurityExchange, from the market data snapshots and incremental refreshes
+// of all sessions and feeds. The top of a book is published at most once per
+// interval, with the first update changing it in each period. Periods are
+// aligned to the interval by capture time. With an interval of 0 every
+// change is published.
+type bookTracker struct {
+	interval time.Duration
+
+	mutex sync.Mutex
+	books map[bookKey]*book
+	// books updated since their top was last published
+	dirty map[bookKey]*book
+}
+
+// bookKey identifies a book by the session key of its market data, empty for
+// UDP feeds, its symbol and SecurityExchange, if set.
+type bookKey struct {
+	sessionKey string
+	symbol     string
+	exchange   string
+}
+
+// book holds the price levels or orders per side of a symbol, keyed by
+// MDEntryID, or by price for books aggregated by price level.
+type book struct {
+	key     bookKey
+	entries [2]map[string]bookEntry
+	last    bookEntry
+	hasLast bool
+
+	// MD entries applied since the top was last published
+	updates   int
+	period    time.Time
+	published topOfBook
+
+	// origin of the last update
+	src, dst common.Endpoint
+}
+
+type bookEntry struct {
+	px, size float64
+}
+
+// topOfBook is the best bid and offer of a book, aggregating the size of
+// all entries at the best price, and the last trade.
+type topOfBook struct {
+	bid, ask, last          bookEntry
+	hasBid, hasAsk, hasLast bool
+	bidLevels, askLevels    int
+}
+
+// bookSnapshot is the top of a book to publish.
+type bookSnapshot struct {
+	ts       time.Time
+	symbol   string
+	exchange string
+	top      topOfBook
+	updates  int
+
+	src, dst   common.Endpoint
+	sessionKey string
+}
+
+// mdEntry is an entry of the NoMDEntries group of a market data message.
+type mdEntry struct {
+	action, entryType string
+	id, refID         string
+	symbol, exchange  string
+	px, size          float64
+	hasPx             bool
+}
+
+// sides of a book, indexing its entries
+const (
+	bookBid = iota
+	bookAsk
+)
+
+func newBookTracker(config bookConfig) *bookTracker {
+	if !config.Enabled {
+		return nil
+	}
+	return &bookTracker{
+		interval: config.Interval,
+		books:    map[bookKey]*book{},
+		dirty:    map[bookKey]*book{},
+	}
+}
+
+// onMessage applies the MD entries of a market data message to the books of
+// their symbols in the session of sessionKey, returning the tops of the books to publish. The tops of
+// books updated by earlier messages are published once their period ends,
+// whatever the symbol of msg. src, dst and sessionKey identify the origin
+// of msg.
+func (t *bookTracker) onMessage(
+	msg *message,
+	src, dst common.Endpoint,
+	sessionKey string,
+) []*bookSnapshot {
+	if t == nil {
+		return nil
+	}
+
+	msgType, _ := msg.fields.get(tagMsgType)
+	if msgType != msgTypeMarketDataSnapshot && msgType != msgTypeMarketDataIncremental {
+		return nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if msgType == msgTypeMarketDataSnapshot {
+		key, entries := mdEntries(msg.fields, tagMDEntryType)
+		key.sessionKey = sessionKey
+		if b := t.book(key); b != nil {
+			b.entries = [2]map[string]bookEntry{{}, {}}
+			for _, e := range entries {
+				b.apply(e)
+			}
+			t.touch(b, src, dst)
+		}
+	} else {
+		key, entries := mdEntries(msg.fields, tagMDUpdateAction)
+		key.sessionKey = sessionKey
+		for _, e := range entries {
+			if e.symbol != "" {
+				key.symbol, key.exchange = e.symbol, e.exchange
+			}
+			if b := t.book(key); b != nil {
+				b.apply(e)
+				t.touch(b, src, dst)
+			}
+		}
+	}
+	return t.publish(msg.ts)
+}
+
+// book returns the book of key, or nil if the symbol is unknown or not
+// tracked.
+func (t *bookTracker) book(key bookKey) *book {
+	if key.symbol == "" {
+		return nil
+	}
+	if b, ok := t.books[key]; ok {
+		return b
+	}
+	if len(t.books) >= maxBookSymbols {
+		if isDebug {
+			debugf("Not reconstructing the book of %s, tracking %d books already",
+				key.symbol, len(t.books))
+		}
+		return nil
+	}
+	b := &book{key: key, entries: [2]map[string]bookEntry{{}, {}}}
+	t.books[key] = b
+	return b
+}
+
+func (t *bookTracker) touch(b *book, src, dst common.Endpoint) {
+	b.updates++
+	b.src, b.dst = src, dst
+	t.dirty[b.key] = b
+}
+
+// publish returns the tops of the updated books whose period ended, unless
+// the top did not change since it was last published. Snapshots are sorted
+// by symbol, SecurityExchange and session key.
+func (t *bookTracker) publish(ts time.Time) []*bookSnapshot {
+	period := ts
+	if t.interval > 0 {
+		period = ts.Truncate(t.interval)
+	}
+
+	var snapshots []*bookSnapshot
+	for key, b := range t.dirty {
+		if t.interval > 0 && !b.period.IsZero() && !period.After(b.period) {
+			continue
+		}
+		delete(t.dirty, key)
+
+		top := b.top()
+		updates := b.updates
+		b.updates = 0
+		b.period = period
+		if top == b.published {
+			continue
+		}
+		b.published = top
+		snapshots = append(snapshots, &bookSnapshot{
+			ts:         ts,
+			symbol:     key.symbol,
+			exchange:   key.exchange,
+			top:        top,
+			updates:    updates,
+			src:        b.src,
+			dst:        b.dst,
+			sessionKey: key.sessionKey,
+		})
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		a, b := snapshots[i], snapshots[j]
+		if a.symbol != b.symbol {
+			return a.symbol < b.symbol
+		}
+		if a.exchange != b.exchange {
+			return a.exchange < b.exchange
+		}
+		return a.sessionKey < b.sessionKey
+	})
+	return snapshots
+}
+
+// apply adds, changes or deletes an MD entry. Entries of snapshots have no
+// MDUpdateAction and are added.
+func (b *book) apply(e mdEntry) {
+	switch e.entryType {
+	case mdEntryTypeEmptyBook:
+		b.entries = [2]map[string]bookEntry{{}, {}}
+		return
+	case mdEntryTypeTrade:
+		if e.action != mdUpdateActionDelete && e.hasPx {
+			b.last = bookEntry{px: e.px, size: e.size}
+			b.hasLast = true
+		}
+		return
+	}
+
+	key := e.id
+	if key == "" && e.hasPx {
+		key = strconv.FormatFloat(e.px, 'f', -1, 64)
+	}
+	if key == "" {
+		return
+	}
+
+	side := bookBid
+	switch e.entryType {
+	case mdEntryTypeBid:
+	case mdEntryTypeOffer:
+		side = bookAsk
+	case "":
+		// deletes by MDEntryID may omit the MDEntryType
+		if e.action == mdUpdateActionDelete && e.id != "" {
+			delete(b.entries[bookBid], key)
+			delete(b.entries[bookAsk], key)
+		}
+		return
+	default:
+		return
+	}
+
+	switch e.action {
+	case mdUpdateActionDelete:
+		delete(b.entries[side], key)
+	case "", mdUpdateActionNew, mdUpdateActionChange:
+		if !e.hasPx {
+			// changes of the size only keep the price of the entry
+			prev, ok := b.entries[side][key]
+			if !ok {
+				return
+			}
+			e.px = prev.px
+		}
+		if e.refID != "" {
+			delete(b.entries[side], e.refID)
+		}
+		b.entries[side][key] = bookEntry{px: e.px, size: e.size}
+	}
+}
+
+// top returns the best bid and offer of the book and its last trade.
+func (b *book) top() topOfBook {
+	top := topOfBook{last: b.last, hasLast: b.hasLast}
+	top.bid, top.hasBid, top.bidLevels = bestEntry(b.entries[bookBid], func(a, b float64) bool { return a > b })
+	top.ask, top.hasAsk, top.askLevels = bestEntry(b.entries[bookAsk], func(a, b float64) bool { return a < b })
+	return top
+}
+
+// bestEntry returns the best price of entries and the total size at this
+// price, with the number of distinct prices.
+func bestEntry(entries map[string]bookEntry, better func(a, b float64) bool) (bookEntry, bool, int) {
+	var best bookEntry
+	found := false
+	prices := map[float64]bool{}
+	for _, e := range entries {
+		prices[e.px] = true
+		switch {
+		case !found || better(e.px, best.px):
+			best = e
+			found = true
+		case e.px == best.px:
+			best.size += e.size
+		}
+	}
+	return best, found, len(prices)
+}
+
+// mdEntries returns the book key of a market data message, without session
+// key, and its MD entries, each starting with delimiter. Books are keyed by
+// Symbol, or by SecurityID if the message has no Symbol, and
+// SecurityExchange. The instrument of the entries of incremental refreshes
+// is set if present in the entry.
+func mdEntries(fields tagValues, delimiter int) (bookKey, []mdEntry) {
+	var key bookKey
+	var securityID string
+	var entries []mdEntry
+	var e *mdEntry
+	var entrySecurityID string
+	endEntry := func() {
+		if e != nil {
+			if e.symbol == "" {
+				e.symbol = entrySecurityID
+			}
+			entries = append(entries, *e)
+		}
+		e, entrySecurityID = nil, ""
+	}
+
+	inGroup := false
+	for _, f := range fields {
+		if f.tag == tagNoMDEntries {
+			inGroup = true
+			continue
+		}
+		if !inGroup {
+			switch f.tag {
+			case tagSymbol:
+				key.symbol = f.value
+			case tagSecurityID:
+				securityID = f.value
+			case tagSecurityExchange:
+				key.exchange = f.value
+			}
+			continue
+		}
+
+		if f.tag == delimiter {
+			endEntry()
+			e = &mdEntry{}
+		}
+		if e == nil {
+			continue
+		}
+		switch f.tag {
+		case tagMDUpdateAction:
+			e.action = f.value
+		case tagMDEntryType:
+			e.entryType = f.value
+		case tagMDEntryID:
+			e.id = f.value
+		case tagMDEntryRefID:
+			e.refID = f.value
+		case tagSymbol:
+			e.symbol = f.value
+		case tagSecurityID:
+			entrySecurityID = f.value
+		case tagSecurityExchange:
+			e.exchange = f.value
+		case tagMDEntryPx:
+			if px, err := strconv.ParseFloat(f.value, 64); err == nil {
+				e.px, e.hasPx = px, true
+			}
+		case tagMDEntrySize:
+			if size, err := strconv.ParseFloat(f.value, 64); err == nil {
+				e.size = size
+			}
+		}
+	}
+	endEntry()
+
+	if key.symbol == "" {
+		key.symbol = securityID
+	}
+	return key, entries
+}
+
+// fields returns the fields of a book event. The spread is only set if the
+// book has both a bid and an offer.
+func (s *bookSnapshot) fields(interval time.Duration) common.MapStr {
+	top := s.top
+	fields := common.MapStr{
+		"symbol":      s.symbol,
+		"interval_ms": int64(interval / time.Millisecond),
+		"updates":     s.updates,
+		"bid_levels":  top.bidLevels,
+		"ask_levels":  top.askLevels,
+	}
+	if s.exchange != "" {
+		fields["security_exchange"] = s.exchange
+	}
+	if top.hasBid {
+		fields["bid_px"] = top.bid.px
+		fields["bid_size"] = top.bid.size
+	}
+	if top.hasAsk {
+		fields["ask_px"] = top.ask.px
+		fields["ask_size"] = top.ask.size
+	}
+	if top.hasBid && top.hasAsk {
+		fields["spread"] = top.ask.px - top.bid.px
+	}
+	if top.hasLast {
+		fields["last_px"] = top.last.px
+		fields["last_size"] = top.last.size
+	}
+	return fields
+}
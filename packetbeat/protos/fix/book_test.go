@@ -0,0 +1,218 @@
+// +build !integration
+
+package fix
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/packetbeat/protos"
+	"github.com/elastic/beats/packetbeat/publish"
+)
+
+// expectNoBookEvent checks no book event is left to read.
+func expectNoBookEvent(t *testing.T, results *publish.ChanTransactions) {
+	for len(results.Channel) > 0 {
+		event := <-results.Channel
+		assert.Nil(t, event["fix"].(common.MapStr)["book"])
+	}
+}
+
+func parseMarketData(fix *fixPlugin, ts time.Time, msgs ...string) {
+	for _, msg := range msgs {
+		fix.ParseUDP(&protos.Packet{
+			Ts: ts,
+			Tuple: common.NewIPPortTuple(4,
+				net.ParseIP("10.0.0.1"), 40000,
+				net.ParseIP("239.1.1.1"), 9878),
+			Payload: fixMessage(msg),
+		})
+	}
+}
+
+func TestBookFromSnapshot(t *testing.T) {
+	fix, results := fixModForTests(func(c *fixConfig) { c.Book = bookConfig{Enabled: true} })
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+
+	parseMarketData(fix, ts, "8=FIX.4.4|35=W|34=1|55=VOD.L|268=5|"+
+		"269=0|270=199.5|271=1000|269=0|270=199.4|271=500|"+
+		"269=1|270=199.7|271=300|269=1|270=199.8|271=100|"+
+		"269=2|270=199.6|271=50|")
+
+	book := expectFixEvent(t, results, "book")
+	assert.Equal(t, "VOD.L", book["symbol"])
+	assert.Equal(t, 199.5, book["bid_px"])
+	assert.Equal(t, 1000.0, book["bid_size"])
+	assert.Equal(t, 199.7, book["ask_px"])
+	assert.Equal(t, 300.0, book["ask_size"])
+	assert.InDelta(t, 0.2, book["spread"], 1e-9)
+	assert.Equal(t, 199.6, book["last_px"])
+	assert.Equal(t, 50.0, book["last_size"])
+	assert.Equal(t, 2, book["bid_levels"])
+	assert.Equal(t, 2, book["ask_levels"])
+	expectNoBookEvent(t, results)
+}
+
+func TestBookIncrementalRefresh(t *testing.T) {
+	fix, results := fixModForTests(func(c *fixConfig) { c.Book = bookConfig{Enabled: true} })
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+
+	parseMarketData(fix, ts,
+		"8=FIX.4.4|35=W|34=1|55=VOD.L|268=2|269=0|270=199.5|271=1000|269=1|270=199.7|271=300|")
+	expectFixEvent(t, results, "book")
+
+	// the best bid is deleted, a new offer improves the ask
+	parseMarketData(fix, ts.Add(time.Second), "8=FIX.4.4|35=X|34=2|268=3|"+
+		"279=0|269=0|55=VOD.L|270=199.3|271=200|"+
+		"279=2|269=0|55=VOD.L|270=199.5|"+
+		"279=0|269=1|55=VOD.L|270=199.6|271=100|")
+
+	book := expectFixEvent(t, results, "book")
+	assert.Equal(t, 199.3, book["bid_px"])
+	assert.Equal(t, 200.0, book["bid_size"])
+	assert.Equal(t, 199.6, book["ask_px"])
+	assert.Equal(t, 100.0, book["ask_size"])
+	assert.Equal(t, 3, book["updates"])
+	assert.Nil(t, book["last_px"])
+
+	// the size of the price level changes
+	parseMarketData(fix, ts.Add(2*time.Second),
+		"8=FIX.4.4|35=X|34=3|268=1|279=1|269=1|55=VOD.L|270=199.6|271=400|")
+	book = expectFixEvent(t, results, "book")
+	assert.Equal(t, 400.0, book["ask_size"])
+	assert.Equal(t, 2, book["ask_levels"])
+}
+
+func TestBookByEntryID(t *testing.T) {
+	fix, results := fixModForTests(func(c *fixConfig) { c.Book = bookConfig{Enabled: true} })
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+
+	parseMarketData(fix, ts, "8=FIX.4.2|35=X|34=1|268=3|"+
+		"279=0|269=0|278=a|55=BARC.L|270=180|271=100|"+
+		"279=0|269=0|278=b|270=180|271=50|"+
+		"279=0|269=0|278=c|270=179|271=10|")
+
+	// orders at the best price are aggregated, entries inherit the Symbol
+	book := expectFixEvent(t, results, "book")
+	assert.Equal(t, "BARC.L", book["symbol"])
+	assert.Equal(t, 180.0, book["bid_px"])
+	assert.Equal(t, 150.0, book["bid_size"])
+	assert.Equal(t, 2, book["bid_levels"])
+
+	// deletes by MDEntryID need no MDEntryType nor price
+	parseMarketData(fix, ts, "8=FIX.4.2|35=X|34=2|268=2|"+
+		"279=2|278=a|55=BARC.L|279=2|278=b|55=BARC.L|")
+	book = expectFixEvent(t, results, "book")
+	assert.Equal(t, 179.0, book["bid_px"])
+	assert.Equal(t, 10.0, book["bid_size"])
+	assert.Nil(t, book["ask_px"])
+	assert.Nil(t, book["spread"])
+}
+
+func TestBookPublishedOncePerInterval(t *testing.T) {
+	fix, results := fixModForTests(func(c *fixConfig) { c.Book = bookConfig{Enabled: true, Interval: 10 * time.Second} })
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+
+	parseMarketData(fix, ts.Add(time.Second),
+		"8=FIX.4.4|35=W|34=1|55=VOD.L|268=1|269=0|270=199.5|271=1000|")
+	book := expectFixEvent(t, results, "book")
+	assert.Equal(t, 199.5, book["bid_px"])
+	assert.Equal(t, int64(10000), book["interval_ms"])
+
+	parseMarketData(fix, ts.Add(2*time.Second),
+		"8=FIX.4.4|35=X|34=2|268=1|279=1|269=0|55=VOD.L|270=199.5|271=800|")
+	parseMarketData(fix, ts.Add(3*time.Second),
+		"8=FIX.4.4|35=X|34=3|268=1|279=1|269=0|55=VOD.L|270=199.5|271=600|")
+	expectNoBookEvent(t, results)
+
+	// the next period is started by an update of another symbol
+	parseMarketData(fix, ts.Add(11*time.Second),
+		"8=FIX.4.4|35=W|34=4|55=BARC.L|268=1|269=1|270=180|271=10|")
+	events := []common.MapStr{expectFixEvent(t, results, "book"), expectFixEvent(t, results, "book")}
+	expectNoBookEvent(t, results)
+	assert.Equal(t, "BARC.L", events[0]["symbol"])
+	assert.Equal(t, "VOD.L", events[1]["symbol"])
+	assert.Equal(t, 600.0, events[1]["bid_size"])
+	assert.Equal(t, 2, events[1]["updates"])
+}
+
+func TestBookUnchangedTopNotPublished(t *testing.T) {
+	fix, results := fixModForTests(func(c *fixConfig) { c.Book = bookConfig{Enabled: true} })
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+
+	parseMarketData(fix, ts,
+		"8=FIX.4.4|35=W|34=1|55=VOD.L|268=2|269=0|270=199.5|271=1000|269=0|270=199.4|271=500|")
+	expectFixEvent(t, results, "book")
+
+	parseMarketData(fix, ts,
+		"8=FIX.4.4|35=X|34=2|268=1|279=1|269=0|55=VOD.L|270=199.4|271=700|")
+	expectNoBookEvent(t, results)
+}
+
+func TestBookFromSession(t *testing.T) {
+	fix, results := fixModForTests(func(c *fixConfig) { c.Book = bookConfig{Enabled: true} })
+
+	parseSession(fix, nil,
+		directedMessage{initiator, "8=FIX.4.4|35=W|34=2|49=CLIENT|56=VENUE|55=VOD.L|268=1|269=1|270=199.7|271=300|"},
+	)
+
+	var event common.MapStr
+	for len(results.Channel) > 0 {
+		event = <-results.Channel
+	}
+	assert.Equal(t, "CLIENT->VENUE", event["fix"].(common.MapStr)["session_key"])
+	book := event["fix"].(common.MapStr)["book"].(common.MapStr)
+	assert.Equal(t, 199.7, book["ask_px"])
+}
+
+func TestBookPerSessionAndExchange(t *testing.T) {
+	fix, results := fixModForTests(func(c *fixConfig) { c.Book = bookConfig{Enabled: true} })
+
+	parseSession(fix, nil,
+		directedMessage{acceptor, "8=FIX.4.4|35=W|34=2|49=VENUE|56=CLIENT|55=VOD|207=XLON|268=1|269=0|270=199.5|271=100|"},
+		directedMessage{acceptor, "8=FIX.4.4|35=W|34=3|49=VENUE|56=CLIENT|55=VOD|207=CHIX|268=1|269=0|270=199.4|271=200|"},
+	)
+	parseMarketData(fix, time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC),
+		"8=FIX.4.4|35=W|34=1|55=VOD|207=XLON|268=1|269=0|270=199.3|271=300|")
+
+	var books []common.MapStr
+	for len(results.Channel) > 0 {
+		event := <-results.Channel
+		if book, ok := event["fix"].(common.MapStr)["book"]; ok {
+			books = append(books, book.(common.MapStr))
+		}
+	}
+	if assert.Len(t, books, 3) {
+		assert.Equal(t, "XLON", books[0]["security_exchange"])
+		assert.Equal(t, 199.5, books[0]["bid_px"])
+		assert.Equal(t, "CHIX", books[1]["security_exchange"])
+		assert.Equal(t, 199.4, books[1]["bid_px"])
+		// the UDP feed keeps its own book of the same instrument
+		assert.Equal(t, 199.3, books[2]["bid_px"])
+		assert.Equal(t, 300.0, books[2]["bid_size"])
+	}
+
+	// an update of one session does not change the book of the other
+	parseSession(fix, nil,
+		directedMessage{acceptor, "8=FIX.4.4|35=X|34=2|49=VENUE|56=CLIENT|268=1|279=1|269=0|55=VOD|207=CHIX|270=199.4|271=50|"},
+	)
+	book := expectFixEvent(t, results, "book")
+	assert.Equal(t, "CHIX", book["security_exchange"])
+	assert.Equal(t, 50.0, book["bid_size"])
+}
+
+func TestBookDisabledByDefault(t *testing.T) {
+	fix, results := fixModForTests()
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+
+	parseMarketData(fix, ts,
+		"8=FIX.4.4|35=W|34=1|55=VOD.L|268=1|269=0|270=199.5|271=1000|")
+
+	event := expectEvent(t, results)
+	assert.Nil(t, event["fix"].(common.MapStr)["book"])
+	assert.Empty(t, results.Channel)
+}
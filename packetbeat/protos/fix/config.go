@@ -1,18 +1,154 @@
 package fix
 
 import (
-    "github.com/elastic/beats/packetbeat/config"
-    "github.com/elastic/beats/packetbeat/protos"
+	"fmt"
+	"time"
+
+	"github.com/elastic/beats/packetbeat/config"
+	"github.com/elastic/beats/packetbeat/protos/tlsdecrypt"
 )
 
 type fixConfig struct {
-    config.ProtocolCommon `config:",inline"`
+	config.ProtocolCommon    `config:",inline"`
+	Retransmissions          string `config:"retransmissions"`
+	RetransmissionSampleRate int    `config:"retransmission_sample_rate" validate:"min=1"`
+	Timestamp                string `config:"timestamp"`
+
+	// deterministic ID of the message events, hashing the session and
+	// MsgSeqNum or the raw message, for idempotent indexing
+	DocumentID string `config:"document_id"`
+
+	// time heartbeats may be late beyond the HeartBtInt before a warning
+	// event is published
+	HeartbeatTolerance time.Duration `config:"heartbeat_tolerance" validate:"min=0"`
+
+	// period of the message counts published per session, 0 to disable
+	StatsInterval time.Duration `config:"stats_interval" validate:"min=0"`
+
+	// values of tags to hash, truncate or drop before publishing
+	Mask []maskConfig `config:"mask"`
+
+	// MsgTypes to publish or drop, per session
+	Filter []filterConfig `config:"filter"`
+
+	// MsgTypes published one in rate messages, per session
+	Sampling []samplingConfig `config:"sampling"`
+
+	// messages published per second, per session and MsgType
+	RateLimit rateLimitConfig `config:"rate_limit"`
+
+	// annotated text of the messages, written on request for troubleshooting
+	Trace traceConfig `config:"trace"`
+
+	// websocket endpoint streaming the events published, for tailing them
+	// in a browser
+	Live liveConfig `config:"live"`
+
+	// names and types of the tags published, and whether tags not mapped
+	// are dropped
+	FieldsMapping     []mappingConfig `config:"fields_mapping"`
+	FieldsMappingOnly bool            `config:"fields_mapping_only"`
+
+	// renaming or dropping of field names breaking Elasticsearch mappings
+	FieldNames fieldNamesConfig `config:"field_names"`
+
+	Raw rawConfig `config:"raw"`
+
+	// QuickFIX data dictionaries extending the built-in dictionaries, per
+	// session or port
+	Dictionaries []dictionaryConfig `config:"dictionaries"`
+
+	// names of the sessions expected, other sessions being flagged as
+	// unknown
+	Sessions []knownSessionConfig `config:"sessions"`
+
+	// business units the sessions belong to, published for outputs to route
+	// events by
+	Tenants []tenantConfig `config:"tenants"`
+
+	// CompIDs and hosts of the firm, setting the direction of messages
+	OurSide ourSideConfig `config:"our_side"`
+
+	// detection of executions published by several sessions
+	Dedup dedupConfig `config:"dedup"`
+
+	// reconstruction of the top of book per symbol from market data
+	Book bookConfig `config:"book"`
+
+	// correlation of QuoteRequests, Quotes and the orders trading them
+	RFQ rfqConfig `config:"rfq"`
+
+	// SBE schemas decoding the binary streams of the ports
+	SBE []sbeConfig `config:"sbe"`
+
+	// FIXML carried by the ports or held by XmlData
+	FIXML fixmlConfig `config:"fixml"`
+
+	// keys decrypting FIX over TLS sessions
+	TLS tlsdecrypt.Config `config:"tls"`
+
+	// detection of FIX sessions on the ports not configured
+	Autodetect autodetectConfig `config:"autodetect"`
+
+	// memory buffered by the connections for the messages being reassembled
+	Reassembly reassemblyConfig `config:"reassembly"`
+
+	// detection of receivers advertising a zero window or acknowledging
+	// data late
+	SlowConsumer slowConsumerConfig `config:"slow_consumer"`
+}
+
+// rawConfig selects the encodings of the raw message added to each event.
+type rawConfig struct {
+	Text   bool `config:"text"`
+	Base64 bool `config:"base64"`
 }
 
 var (
-    defaultConfig = fixConfig{
-        ProtocolCommon: config.ProtocolCommon{
-            TransactionTimeout: protos.DefaultTransactionExpiration,
-        },
-    }
+	defaultConfig = fixConfig{
+		ProtocolCommon: config.ProtocolCommon{
+			// FIX connections idle for a full HeartBtInt between messages. Keep
+			// connection state long enough not to lose track of the session.
+			TransactionTimeout: 2 * time.Minute,
+		},
+		Retransmissions:          "publish",
+		RetransmissionSampleRate: 10,
+		Timestamp:                "capture",
+		HeartbeatTolerance:       5 * time.Second,
+		RateLimit:                defaultRateLimitConfig,
+		Trace:                    defaultTraceConfig,
+		Live:                     defaultLiveConfig,
+		FieldNames:               defaultFieldNamesConfig,
+		Dedup:                    defaultDedupConfig,
+		Book:                     defaultBookConfig,
+		RFQ:                      defaultRFQConfig,
+		FIXML:                    defaultFIXMLConfig,
+		Autodetect:               defaultAutodetectConfig,
+		Reassembly:               defaultReassemblyConfig,
+		SlowConsumer:             defaultSlowConsumerConfig,
+	}
 )
+
+func (c *fixConfig) Validate() error {
+	switch c.Retransmissions {
+	case "publish", "drop", "sample":
+	default:
+		return fmt.Errorf("invalid retransmissions config: %s, must be one of publish, drop or sample",
+			c.Retransmissions)
+	}
+
+	switch c.Timestamp {
+	case "capture", "sending_time":
+	default:
+		return fmt.Errorf("invalid timestamp config: %s, must be one of capture or sending_time",
+			c.Timestamp)
+	}
+
+	switch c.DocumentID {
+	case "", "session", "raw":
+	default:
+		return fmt.Errorf("invalid document_id config: %s, must be one of session or raw",
+			c.DocumentID)
+	}
+	return nil
+}
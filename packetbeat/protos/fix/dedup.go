@@ -0,0 +1,137 @@
+package fix
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+const tagExecID = 17
+
+// maxDedupExecutions limits the number of executions remembered for
+// deduplication. The oldest executions are forgotten first.
+const maxDedupExecutions = 100000
+
+type dedupConfig struct {
+	Enabled bool          `config:"enabled"`
+	Window  time.Duration `config:"window" validate:"min=0"`
+	Action  string        `config:"action"`
+}
+
+// deduplicator detects executions published by several sessions, like a
+// trading session and its drop copy, by MsgType, OrderID and ExecID. Messages
+// are duplicates if the execution has been seen on another session or feed
+// within the window. Capture times are used, so that replayed captures are
+// deduplicated the same way.
+type deduplicator struct {
+	window time.Duration
+	drop   bool
+
+	mutex sync.Mutex
+	seen  map[string]seenExecution
+	queue []queuedExecution
+}
+
+// seenExecution is the first message of an execution. origin names the
+// session or feed, published in duplicate_of.
+type seenExecution struct {
+	origin string
+	ts     time.Time
+}
+
+type queuedExecution struct {
+	key string
+	ts  time.Time
+}
+
+var defaultDedupConfig = dedupConfig{
+	Window: time.Minute,
+	Action: "tag",
+}
+
+func (c *dedupConfig) Validate() error {
+	switch c.Action {
+	case "tag", "drop":
+		return nil
+	}
+	return fmt.Errorf("invalid dedup action: %s, must be one of tag or drop", c.Action)
+}
+
+func newDeduplicator(config dedupConfig) *deduplicator {
+	if !config.Enabled {
+		return nil
+	}
+	return &deduplicator{
+		window: config.Window,
+		drop:   config.Action == "drop",
+		seen:   map[string]seenExecution{},
+	}
+}
+
+// check records the execution carried by msg, received from origin, and
+// returns the origin it has been seen first on, if msg is a duplicate.
+// Sessions are named by their session key, so that the messages resent after
+// reconnecting are not duplicates. Messages without ExecID are never
+// duplicates.
+func (d *deduplicator) check(origin string, msg *message) (string, bool) {
+	if d == nil {
+		return "", false
+	}
+
+	execID, ok := msg.fields.get(tagExecID)
+	if !ok {
+		return "", false
+	}
+	msgType, _ := msg.fields.get(tagMsgType)
+	orderID, _ := msg.fields.get(tagOrderID)
+	key := msgType + "|" + orderID + "|" + execID
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.expire(msg.ts)
+	if first, found := d.seen[key]; found {
+		if first.origin != origin {
+			return first.origin, true
+		}
+		// sent again on the same session, handled as retransmission
+		return "", false
+	}
+
+	if len(d.queue) >= maxDedupExecutions {
+		d.forget()
+	}
+	d.seen[key] = seenExecution{origin: origin, ts: msg.ts}
+	d.queue = append(d.queue, queuedExecution{key: key, ts: msg.ts})
+	return "", false
+}
+
+// expire forgets the executions seen before the window ending at ts.
+func (d *deduplicator) expire(ts time.Time) {
+	for len(d.queue) > 0 && ts.Sub(d.queue[0].ts) > d.window {
+		d.forget()
+	}
+}
+
+func (d *deduplicator) forget() {
+	delete(d.seen, d.queue[0].key)
+	d.queue = d.queue[1:]
+}
+
+// originName names a TCP connection in duplicate_of by its session key, or
+// by its endpoints if the CompIDs are not known.
+func originName(key sessionKey) string {
+	if key.valid() {
+		return key.String()
+	}
+	return endpointName(key.src) + "->" + endpointName(key.dst)
+}
+
+// endpointName formats an endpoint as ip:port, or [ip]:port for IPv6.
+func endpointName(e common.Endpoint) string {
+	return net.JoinHostPort(e.IP, strconv.Itoa(int(e.Port)))
+}
@@ -0,0 +1,124 @@
+// +build !integration
+
+package fix
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/packetbeat/protos"
+)
+
+func dedupTuple(srcPort uint16) *common.TCPTuple {
+	tuple := &common.TCPTuple{
+		SrcIP: net.ParseIP("10.0.0.1"), SrcPort: srcPort,
+		DstIP: net.ParseIP("10.0.0.2"), DstPort: 9878,
+	}
+	tuple.ComputeHashebles()
+	return tuple
+}
+
+func parseOn(fix *fixPlugin, tuple *common.TCPTuple, ts time.Time, msg string) {
+	pkt := &protos.Packet{Ts: ts, Payload: fixMessage(msg)}
+	fix.Parse(pkt, tuple, initiator, nil)
+}
+
+const (
+	execReport     = "8=FIX.4.4|35=8|34=5|49=BROKER|56=CLIENT|37=order-1|17=exec-1|150=F|"
+	dropCopyReport = "8=FIX.4.4|35=8|34=9|49=BROKER|56=DROPCOPY|37=order-1|17=exec-1|150=F|"
+)
+
+func TestDedupTagsExecutionOfOtherSession(t *testing.T) {
+	fix, results := fixModForTests(func(c *fixConfig) {
+		c.Dedup = dedupConfig{Enabled: true, Window: time.Minute, Action: "tag"}
+	})
+	ts := time.Now()
+
+	parseOn(fix, dedupTuple(40000), ts, execReport)
+	event := expectEvent(t, results)
+	assert.NotContains(t, event["fix"], "duplicate_of")
+
+	parseOn(fix, dedupTuple(40001), ts.Add(time.Second), dropCopyReport)
+	event = expectEvent(t, results)
+	assert.Equal(t, "BROKER->CLIENT", event["fix"].(common.MapStr)["duplicate_of"])
+}
+
+func TestDedupDropsExecutionOfOtherSession(t *testing.T) {
+	fix, results := fixModForTests(func(c *fixConfig) {
+		c.Dedup = dedupConfig{Enabled: true, Window: time.Minute, Action: "drop"}
+	})
+	ts := time.Now()
+
+	parseOn(fix, dedupTuple(40000), ts, execReport)
+	expectEvent(t, results)
+
+	parseOn(fix, dedupTuple(40001), ts, dropCopyReport)
+	assert.Empty(t, results.Channel)
+}
+
+func TestDedupIgnoresSameConnection(t *testing.T) {
+	fix, results := fixModForTests(func(c *fixConfig) {
+		c.Dedup = dedupConfig{Enabled: true, Window: time.Minute, Action: "drop"}
+	})
+	tuple := dedupTuple(40000)
+	ts := time.Now()
+
+	// resent on the same connection, e.g. as PossDup
+	parseOn(fix, tuple, ts, execReport)
+	parseOn(fix, tuple, ts, execReport)
+	expectEvent(t, results)
+	expectEvent(t, results)
+}
+
+func TestDedupIgnoresSameSessionReconnected(t *testing.T) {
+	fix, results := fixModForTests(func(c *fixConfig) {
+		c.Dedup = dedupConfig{Enabled: true, Window: time.Minute, Action: "drop"}
+	})
+	ts := time.Now()
+
+	// resent as PossDup after the session reconnected from another port
+	parseOn(fix, dedupTuple(40000), ts, execReport)
+	parseOn(fix, dedupTuple(40001), ts.Add(time.Second), execReport)
+	expectEvent(t, results)
+	event := expectEvent(t, results)
+	assert.NotContains(t, event["fix"], "duplicate_of")
+}
+
+func TestDedupWindowExpired(t *testing.T) {
+	fix, results := fixModForTests(func(c *fixConfig) {
+		c.Dedup = dedupConfig{Enabled: true, Window: time.Minute, Action: "tag"}
+	})
+	ts := time.Now()
+
+	parseOn(fix, dedupTuple(40000), ts, execReport)
+	expectEvent(t, results)
+
+	parseOn(fix, dedupTuple(40001), ts.Add(2*time.Minute), dropCopyReport)
+	event := expectEvent(t, results)
+	assert.NotContains(t, event["fix"], "duplicate_of")
+}
+
+func TestDedupDistinctExecutions(t *testing.T) {
+	fix, results := fixModForTests(func(c *fixConfig) {
+		c.Dedup = dedupConfig{Enabled: true, Window: time.Minute, Action: "tag"}
+	})
+	ts := time.Now()
+
+	parseOn(fix, dedupTuple(40000), ts, execReport)
+	parseOn(fix, dedupTuple(40001), ts,
+		"8=FIX.4.4|35=8|34=10|49=BROKER|56=DROPCOPY|37=order-1|17=exec-2|150=F|")
+	expectEvent(t, results)
+	event := expectEvent(t, results)
+	assert.NotContains(t, event["fix"], "duplicate_of")
+}
+
+func TestDedupConfigValidate(t *testing.T) {
+	assert.NoError(t, defaultDedupConfig.Validate())
+
+	config := dedupConfig{Action: "merge"}
+	assert.Error(t, config.Validate())
+}
@@ -0,0 +1,233 @@
+package fix
+
+import (
+	"strconv"
+	"time"
+)
+
+// dictionary holds tag definitions and enumerated values for a single FIX
+// application version.
+type dictionary struct {
+	version string
+	fields  map[int]typeBlock
+	enums   map[int]map[string]string
+
+	// repeating groups by MsgType and NumInGroup tag
+	groups map[string]map[int]*repeatingGroup
+}
+
+const (
+	tagBeginString      = 8
+	tagMsgType          = 35
+	tagApplVerID        = 1128
+	tagDefaultApplVerID = 1137
+)
+
+// utcTimestampLayout is the layout of UTCTimestamp fields. Optional
+// milliseconds (or microseconds and more, since FIX 4.4) are accepted when
+// parsing.
+const utcTimestampLayout = "20060102-15:04:05"
+
+var (
+	fix42Dictionary = newDictionary("FIX.4.2", nil,
+		fixFields,
+		map[int]map[string]string{
+			20:  fixExecTransTypes,
+			35:  fixMsgTypes,
+			39:  fixOrdStatuses,
+			40:  fixOrdTypes,
+			54:  fixSides,
+			59:  fixTimeInForces,
+			150: fixExecTypes,
+			298: fixQuoteCancelTypes,
+			301: fixQuoteResponseLevels,
+			303: fixQuoteRequestTypes,
+			373: fixSessionRejectReasons,
+			380: fixBusinessRejectReasons,
+		},
+		quoteGroups)
+
+	fix44Dictionary = newDictionary("FIX.4.4", fix42Dictionary,
+		fix44Fields,
+		map[int]map[string]string{
+			35:  mergeEnums(fixMsgTypes, fix44MsgTypes),
+			40:  mergeEnums(fixOrdTypes, fix44OrdTypes),
+			54:  mergeEnums(fixSides, fix44Sides),
+			59:  mergeEnums(fixTimeInForces, fix44TimeInForces),
+			150: fix44ExecTypes,
+			298: mergeEnums(fixQuoteCancelTypes, fix44QuoteCancelTypes),
+			373: mergeEnums(fixSessionRejectReasons, fix44SessionRejectReasons),
+			380: mergeEnums(fixBusinessRejectReasons, fix44BusinessRejectReasons),
+			537: fix44QuoteTypes,
+		},
+		nil)
+
+	fix50Dictionary = newDictionary("FIX.5.0", fix44Dictionary,
+		fix50Fields,
+		map[int]map[string]string{
+			35:  mergeEnums(fix44Dictionary.enums[35], fix50MsgTypes),
+			150: mergeEnums(fix44ExecTypes, fix50ExecTypes),
+			373: mergeEnums(fix44Dictionary.enums[373], fix50SessionRejectReasons),
+			380: mergeEnums(fix44Dictionary.enums[380], fix50BusinessRejectReasons),
+		},
+		nil)
+)
+
+// newDictionary creates a dictionary for version, copying all definitions
+// from base. Entries in fields replace single tag definitions, whereas
+// entries in enums replace the complete set of values of a tag, and entries
+// in groups all repeating groups of a message type.
+func newDictionary(
+	version string,
+	base *dictionary,
+	fields map[int]typeBlock,
+	enums map[int]map[string]string,
+	groups map[string]map[int]*repeatingGroup,
+) *dictionary {
+	d := &dictionary{
+		version: version,
+		fields:  map[int]typeBlock{},
+		enums:   map[int]map[string]string{},
+		groups:  map[string]map[int]*repeatingGroup{},
+	}
+
+	if base != nil {
+		for tag, field := range base.fields {
+			d.fields[tag] = field
+		}
+		for tag, values := range base.enums {
+			d.enums[tag] = values
+		}
+		for msgType, g := range base.groups {
+			d.groups[msgType] = g
+		}
+	}
+
+	for tag, field := range fields {
+		d.fields[tag] = field
+	}
+	for tag, values := range enums {
+		d.enums[tag] = values
+	}
+	for msgType, g := range groups {
+		d.groups[msgType] = g
+	}
+	return d
+}
+
+func mergeEnums(base, values map[string]string) map[string]string {
+	merged := make(map[string]string, len(base)+len(values))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range values {
+		merged[k] = v
+	}
+	return merged
+}
+
+// lookupDictionary returns the dictionary to decode a message with. For
+// FIXT.1.1 sessions the application version is selected by applVerID, which
+// is either the message ApplVerID (1128) or the DefaultApplVerID (1137)
+// negotiated at Logon.
+func lookupDictionary(beginString, applVerID string) *dictionary {
+	switch beginString {
+	case "FIX.4.0", "FIX.4.1", "FIX.4.2":
+		return fix42Dictionary
+	case "FIX.4.3", "FIX.4.4":
+		return fix44Dictionary
+	case "FIXT.1.1":
+		switch applVerID {
+		case "2", "3", "4":
+			return fix42Dictionary
+		case "5", "6":
+			return fix44Dictionary
+		}
+		return fix50Dictionary
+	}
+	return fix42Dictionary
+}
+
+// applVerIDs maps the ApplVerID (1128) values to the application versions
+// carried by FIXT.1.1 sessions.
+var applVerIDs = map[string]string{
+	"2": "FIX.4.0",
+	"3": "FIX.4.1",
+	"4": "FIX.4.2",
+	"5": "FIX.4.3",
+	"6": "FIX.4.4",
+	"7": "FIX.5.0",
+	"8": "FIX.5.0SP1",
+	"9": "FIX.5.0SP2",
+}
+
+// applVersion returns the application version of a message. For FIXT.1.1
+// sessions the version is selected by applVerID, as in lookupDictionary. The
+// second return value is false if the version is not known.
+func applVersion(beginString, applVerID string) (string, bool) {
+	if beginString != "FIXT.1.1" {
+		return beginString, beginString != ""
+	}
+	version, ok := applVerIDs[applVerID]
+	return version, ok
+}
+
+// field returns the definition of tag. The second return value is false if
+// the tag is unknown to the dictionary.
+func (d *dictionary) field(tag int) (typeBlock, bool) {
+	field, ok := d.fields[tag]
+	return field, ok
+}
+
+// enum returns the human readable name of value for tag. If tag has no
+// enumerated values or value is unknown, value is returned unchanged.
+func (d *dictionary) enum(tag int, value string) string {
+	if name, ok := d.enums[tag][value]; ok {
+		return name
+	}
+	return value
+}
+
+// decode returns the field name and typed value of a tag. Tags with
+// enumerated values are decoded to their human readable name, except for
+// MsgType which is kept as is. The third return value is false if the tag is
+// unknown to the dictionary or the value does not match the tag its type.
+func (d *dictionary) decode(tag int, value string) (string, interface{}, bool) {
+	field, ok := d.field(tag)
+	if !ok {
+		return "", nil, false
+	}
+
+	if tag != tagMsgType {
+		if _, hasEnum := d.enums[tag]; hasEnum {
+			return field.name, d.enum(tag, value), true
+		}
+	}
+
+	switch field.dtype {
+	case "int":
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			debugf("invalid int value for tag %v: %q", tag, value)
+			return "", nil, false
+		}
+		return field.name, v, true
+	case "float":
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			debugf("invalid float value for tag %v: %q", tag, value)
+			return "", nil, false
+		}
+		return field.name, v, true
+	case "time":
+		v, err := time.Parse(utcTimestampLayout, value)
+		if err != nil {
+			debugf("invalid UTCTimestamp value for tag %v: %q", tag, value)
+			return "", nil, false
+		}
+		// venues stamp messages to the nanosecond, common.Time being
+		// published to the millisecond
+		return field.name, preciseTime(v), true
+	}
+	return field.name, value, true
+}
@@ -0,0 +1,204 @@
+package fix
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+
+	"github.com/elastic/beats/libbeat/paths"
+)
+
+type dictionaryConfig struct {
+	Path         string `config:"path" validate:"required"`
+	SenderCompID string `config:"sender_comp_id"`
+	TargetCompID string `config:"target_comp_id"`
+	Ports        []int  `config:"ports"`
+}
+
+// customDictionaries selects the data dictionaries loaded from QuickFIX XML
+// files per session or port. Rules are checked in order and the first rule
+// matching a message applies.
+type customDictionaries struct {
+	rules []dictionaryRule
+}
+
+type dictionaryRule struct {
+	senderCompID, targetCompID string
+	ports                      map[uint16]bool
+
+	// built-in dictionaries extended by the definitions of the file
+	extended map[*dictionary]*dictionary
+}
+
+// xmlDictionary is the QuickFIX data dictionary format. Only the field
+// definitions and message types are used.
+type xmlDictionary struct {
+	Messages []xmlMessage `xml:"messages>message"`
+	Fields   []xmlField   `xml:"fields>field"`
+}
+
+type xmlMessage struct {
+	Name    string `xml:"name,attr"`
+	MsgType string `xml:"msgtype,attr"`
+}
+
+type xmlField struct {
+	Number int        `xml:"number,attr"`
+	Name   string     `xml:"name,attr"`
+	Type   string     `xml:"type,attr"`
+	Values []xmlValue `xml:"value"`
+}
+
+type xmlValue struct {
+	Enum        string `xml:"enum,attr"`
+	Description string `xml:"description,attr"`
+}
+
+// xmlFieldTypes maps the QuickFIX field types to the types decoded. Other
+// types are decoded as string.
+var xmlFieldTypes = map[string]string{
+	"INT":          "int",
+	"LENGTH":       "int",
+	"SEQNUM":       "int",
+	"NUMINGROUP":   "int",
+	"TAGNUM":       "int",
+	"DAYOFMONTH":   "int",
+	"FLOAT":        "float",
+	"PRICE":        "float",
+	"PRICEOFFSET":  "float",
+	"QTY":          "float",
+	"QUANTITY":     "float",
+	"AMT":          "float",
+	"PERCENTAGE":   "float",
+	"UTCTIMESTAMP": "time",
+	"TIME":         "time",
+}
+
+func loadDictionaries(configs []dictionaryConfig) (*customDictionaries, error) {
+	if len(configs) == 0 {
+		return nil, nil
+	}
+
+	d := &customDictionaries{}
+	for _, c := range configs {
+		path := paths.Resolve(paths.Config, c.Path)
+		xmlDict, err := readXMLDictionary(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load FIX dictionary %v: %v", path, err)
+		}
+
+		rule := dictionaryRule{
+			senderCompID: c.SenderCompID,
+			targetCompID: c.TargetCompID,
+			extended:     map[*dictionary]*dictionary{},
+		}
+		if len(c.Ports) > 0 {
+			rule.ports = map[uint16]bool{}
+			for _, port := range c.Ports {
+				rule.ports[uint16(port)] = true
+			}
+		}
+		for _, base := range []*dictionary{fix42Dictionary, fix44Dictionary, fix50Dictionary, fixmlDictionary} {
+			rule.extended[base] = xmlDict.extend(base)
+		}
+		d.rules = append(d.rules, rule)
+	}
+	return d, nil
+}
+
+func readXMLDictionary(path string) (*xmlDictionary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var d xmlDictionary
+	if err := xml.NewDecoder(f).Decode(&d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// extend returns a copy of base adding the tags and enumerated values of d
+// not defined by base. The built-in definitions are kept, so that standard
+// tags are published with the same names and types for all sessions.
+func (d *xmlDictionary) extend(base *dictionary) *dictionary {
+	fields := map[int]typeBlock{}
+	enums := map[int]map[string]string{}
+
+	for _, f := range d.Fields {
+		if f.Number <= 0 || f.Name == "" {
+			continue
+		}
+
+		baseField, known := base.fields[f.Number]
+		if !known {
+			dtype, ok := xmlFieldTypes[f.Type]
+			if !ok {
+				dtype = "string"
+			}
+			fields[f.Number] = typeBlock{name: f.Name, dtype: dtype}
+		} else if baseField.dtype != "string" && f.Number != tagMsgType {
+			// adding enums would change the type of the values published
+			continue
+		}
+
+		values := map[string]string{}
+		for _, v := range f.Values {
+			if _, exists := base.enums[f.Number][v.Enum]; !exists {
+				values[v.Enum] = v.Description
+			}
+		}
+		if len(values) > 0 {
+			enums[f.Number] = mergeEnums(base.enums[f.Number], values)
+		}
+	}
+
+	// message names are preferred to the descriptions of the MsgType values
+	msgTypes := map[string]string{}
+	for _, m := range d.Messages {
+		if _, exists := base.enums[tagMsgType][m.MsgType]; !exists && m.Name != "" {
+			msgTypes[m.MsgType] = m.Name
+		}
+	}
+	if len(msgTypes) > 0 {
+		values, ok := enums[tagMsgType]
+		if !ok {
+			values = base.enums[tagMsgType]
+		}
+		enums[tagMsgType] = mergeEnums(values, msgTypes)
+	}
+
+	return newDictionary(base.version, base, fields, enums, nil)
+}
+
+// lookup returns dict extended by the first rule matching the message its
+// CompIDs or the connection ports. If no rule matches, dict is returned.
+func (d *customDictionaries) lookup(dict *dictionary, ports [2]uint16, fields tagValues) *dictionary {
+	if d == nil {
+		return dict
+	}
+
+	sender, _ := fields.get(tagSenderCompID)
+	target, _ := fields.get(tagTargetCompID)
+	for i := range d.rules {
+		rule := &d.rules[i]
+		if rule.matches(sender, target, ports) {
+			if extended, ok := rule.extended[dict]; ok {
+				return extended
+			}
+			return dict
+		}
+	}
+	return dict
+}
+
+// matches checks the rule CompIDs against both directions of a session, and
+// the rule ports against both ports of the connection.
+func (r *dictionaryRule) matches(sender, target string, ports [2]uint16) bool {
+	if r.ports != nil && !r.ports[ports[0]] && !r.ports[ports[1]] {
+		return false
+	}
+	return matchSession(r.senderCompID, r.targetCompID, sender, target)
+}
@@ -0,0 +1,134 @@
+// +build !integration
+
+package fix
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+const venueDictionary = `<fix type="FIX" major="4" minor="4" servicepack="0">
+  <messages>
+    <message name="NewOrderSingle" msgtype="D" msgcat="app"/>
+    <message name="VenueOrderStatus" msgtype="U1" msgcat="app"/>
+  </messages>
+  <fields>
+    <field number="35" name="MsgType" type="STRING">
+      <value enum="D" description="ORDER_SINGLE"/>
+      <value enum="U1" description="VENUE_ORDER_STATUS"/>
+    </field>
+    <field number="40" name="OrdType" type="CHAR">
+      <value enum="1" description="MARKET"/>
+      <value enum="Z" description="VENUE_PEG"/>
+    </field>
+    <field number="44" name="Px" type="PRICE"/>
+    <field number="5001" name="VenueLiquidityFlag" type="CHAR">
+      <value enum="A" description="ADDED"/>
+      <value enum="R" description="REMOVED"/>
+    </field>
+    <field number="5002" name="VenueFee" type="AMT"/>
+  </fields>
+</fix>
+`
+
+func writeDictionary(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "fix-dictionary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "VENUE44.xml")
+	if err := ioutil.WriteFile(path, []byte(venueDictionary), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestXMLDictionaryExtend(t *testing.T) {
+	path, cleanup := writeDictionary(t)
+	defer cleanup()
+
+	xmlDict, err := readXMLDictionary(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dict := xmlDict.extend(fix44Dictionary)
+
+	// custom tags and values are added
+	name, value, ok := dict.decode(5001, "R")
+	assert.True(t, ok)
+	assert.Equal(t, "VenueLiquidityFlag", name)
+	assert.Equal(t, "REMOVED", value)
+	name, value, _ = dict.decode(5002, "0.25")
+	assert.Equal(t, "VenueFee", name)
+	assert.Equal(t, 0.25, value)
+	assert.Equal(t, "VENUE_PEG", dict.enum(40, "Z"))
+	assert.Equal(t, "VenueOrderStatus", dict.enum(tagMsgType, "U1"))
+
+	// built-in definitions are kept
+	assert.Equal(t, fix44Dictionary.enum(40, "1"), dict.enum(40, "1"))
+	assert.Equal(t, fix44Dictionary.enum(tagMsgType, "D"), dict.enum(tagMsgType, "D"))
+	name, _, _ = dict.decode(44, "1.5")
+	assert.Equal(t, "Price", name)
+
+	// the built-in dictionary is left unchanged
+	_, _, ok = fix44Dictionary.decode(5001, "R")
+	assert.False(t, ok)
+}
+
+func TestCustomDictionariesLookup(t *testing.T) {
+	path, cleanup := writeDictionary(t)
+	defer cleanup()
+
+	dicts, err := loadDictionaries([]dictionaryConfig{
+		{Path: path, SenderCompID: "BROKER", TargetCompID: "VENUE"},
+		{Path: path, Ports: []int{9878}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := splitFields(fixMessage("8=FIX.4.4|35=0|49=VENUE|56=BROKER|"))
+	extended := dicts.lookup(fix44Dictionary, [2]uint16{40000, 5001}, fields)
+	assert.Equal(t, dicts.rules[0].extended[fix44Dictionary], extended)
+
+	other := splitFields(fixMessage("8=FIX.4.4|35=0|49=CLIENT|56=BROKER|"))
+	extended = dicts.lookup(fix44Dictionary, [2]uint16{40000, 9878}, other)
+	assert.Equal(t, dicts.rules[1].extended[fix44Dictionary], extended)
+
+	assert.Equal(t, fix44Dictionary, dicts.lookup(fix44Dictionary, [2]uint16{40000, 5001}, other))
+
+	var none *customDictionaries
+	assert.Equal(t, fix42Dictionary, none.lookup(fix42Dictionary, [2]uint16{}, fields))
+}
+
+func TestLoadDictionariesFails(t *testing.T) {
+	_, err := loadDictionaries([]dictionaryConfig{{Path: "/nonexistent/FIX44.xml"}})
+	assert.Error(t, err)
+}
+
+func TestParseWithCustomDictionary(t *testing.T) {
+	path, cleanup := writeDictionary(t)
+	defer cleanup()
+
+	config := defaultConfig
+	config.Dictionaries = []dictionaryConfig{{Path: path}}
+
+	var fix fixPlugin
+	_, results := fixModForTests()
+	if err := fix.init(results, &config); err != nil {
+		t.Fatal(err)
+	}
+
+	parseMessages(&fix, "8=FIX.4.4|35=U1|34=2|5001=A|5002=1.5|")
+
+	event := expectEvent(t, results)["fix"].(common.MapStr)
+	assert.Equal(t, "VenueOrderStatus", event["msg_type"])
+	assert.Equal(t, "ADDED", event["VenueLiquidityFlag"])
+	assert.Equal(t, 1.5, event["VenueFee"])
+}
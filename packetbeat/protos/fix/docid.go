@@ -0,0 +1,33 @@
+package fix
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// documentID returns the ID of the document of a message, the same each time
+// the message is captured, for the outputs to index the message idempotently
+// when a pcap is processed again or a spool replayed. The session method
+// hashes the session key, direction, MsgSeqNum and SendingTime, which tell
+// the messages of a session apart across sequence resets. The raw method,
+// and the session method for messages without MsgSeqNum, hash the message
+// bytes. Retransmissions get their own ID, their SendingTime differing from
+// the original message.
+func documentID(method string, key sessionKey, dir uint8, msg *message) string {
+	h := sha256.New()
+	seqNum, hasSeqNum := msg.fields.get(tagMsgSeqNum)
+	if method == "session" && hasSeqNum {
+		sendingTime, _ := msg.fields.get(tagSendingTime)
+		for _, s := range []string{
+			key.String(), strconv.Itoa(int(dir)), seqNum, sendingTime,
+		} {
+			// separated by SOH, never found in the values
+			h.Write([]byte(s))
+			h.Write([]byte{soh})
+		}
+	} else {
+		h.Write(msg.raw)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
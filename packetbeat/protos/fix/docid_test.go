@@ -0,0 +1,75 @@
+// +build !integration
+
+package fix
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func TestDocumentID(t *testing.T) {
+	key := sessionKey{senderCompID: "CLIENT", targetCompID: "BROKER"}
+	msg := func(s string) *message {
+		raw := fixMessage(s)
+		return &message{raw: raw, fields: splitFields(raw)}
+	}
+	order := msg("8=FIX.4.4|35=D|34=2|49=CLIENT|56=BROKER|52=20161014-09:00:00.000|55=VOD.L|")
+
+	id := documentID("session", key, initiator, order)
+	assert.Len(t, id, 32)
+	assert.Equal(t, id, documentID("session", key, initiator, msg(
+		"8=FIX.4.4|35=D|34=2|49=CLIENT|56=BROKER|52=20161014-09:00:00.000|55=VOD.L|")))
+
+	for _, other := range []string{
+		documentID("session", key, acceptor, order),
+		documentID("session", sessionKey{senderCompID: "CLIENT", targetCompID: "OTHER"}, initiator, order),
+		documentID("session", key, initiator, msg(
+			"8=FIX.4.4|35=D|34=3|49=CLIENT|56=BROKER|52=20161014-09:00:00.000|55=VOD.L|")),
+		// the sequence reset the next day
+		documentID("session", key, initiator, msg(
+			"8=FIX.4.4|35=D|34=2|49=CLIENT|56=BROKER|52=20161015-09:00:00.000|55=VOD.L|")),
+		documentID("raw", key, initiator, order),
+	} {
+		assert.NotEqual(t, id, other)
+	}
+
+	// the raw method hashes the message only
+	raw := documentID("raw", key, initiator, order)
+	assert.Equal(t, raw, documentID("raw", sessionKey{}, acceptor, order))
+	noSeqNum := msg("8=FIX.4.4|35=D|49=CLIENT|56=BROKER|55=VOD.L|")
+	assert.Equal(t, documentID("raw", key, initiator, noSeqNum),
+		documentID("session", key, initiator, noSeqNum))
+}
+
+func TestParsePublishesDocumentID(t *testing.T) {
+	parse := func() []interface{} {
+		fix, results := fixModForTests()
+		fix.documentID = "session"
+		parseSession(fix, nil,
+			directedMessage{initiator, "8=FIX.4.2|35=A|34=1|49=CLIENT|56=BROKER|108=30|"},
+			directedMessage{acceptor, "8=FIX.4.2|35=A|34=1|49=BROKER|56=CLIENT|108=30|"},
+		)
+		var ids []interface{}
+		for len(results.Channel) > 0 {
+			if id, ok := (<-results.Channel)["fix"].(common.MapStr)["document_id"]; ok {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	}
+
+	ids := parse()
+	// both Logons, the session event has no ID
+	if assert.Len(t, ids, 2) {
+		assert.NotEqual(t, ids[0], ids[1])
+	}
+	// capturing the session again publishes the same IDs
+	assert.Equal(t, ids, parse())
+
+	config := defaultConfig
+	config.DocumentID = "sequence"
+	assert.Error(t, config.Validate())
+}
@@ -0,0 +1,63 @@
+package fix
+
+import (
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/packetbeat/publish"
+)
+
+func init() {
+	publish.RegisterECSMapper("fix", ecsFields)
+}
+
+// eventKinds lists the fix fields holding the events other than messages,
+// named in event.action.
+var eventKinds = []string{
+	"gap", "resync", "order", "rfq", "reject", "rate_limit",
+	"autodetected_session", "slow_consumer", "stats", "book",
+}
+
+// ecsFields maps the latencies and the direction of FIX events to ECS. The
+// action of message events is their MsgType, and the state change of session
+// events or the kind of the other events.
+func ecsFields(event, fields common.MapStr) {
+	fix, ok := event["fix"].(common.MapStr)
+	if !ok {
+		return
+	}
+
+	if direction, ok := fix["direction"].(string); ok {
+		fields.Put("network.direction", direction)
+	}
+	if msgType, ok := fix["msg_type"].(string); ok {
+		fields.Put("event.action", msgType)
+		putDuration(fields, fix["latency_us"])
+		return
+	}
+
+	if session, ok := fix["session"].(common.MapStr); ok {
+		if name, ok := session["event"].(string); ok {
+			fields.Put("event.action", name)
+		}
+		return
+	}
+	for _, kind := range eventKinds {
+		details, ok := fix[kind].(common.MapStr)
+		if !ok {
+			continue
+		}
+		fields.Put("event.action", kind)
+		if kind == "stats" || kind == "book" {
+			fields.Put("event.kind", "metric")
+		}
+		putDuration(fields, details["latency_us"])
+		return
+	}
+}
+
+func putDuration(fields common.MapStr, latency interface{}) {
+	if us, ok := latency.(int64); ok {
+		fields.Put("event.duration", us*int64(time.Microsecond))
+	}
+}
@@ -0,0 +1,55 @@
+// +build !integration
+
+package fix
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func ecsFieldsOf(fix common.MapStr) common.MapStr {
+	fields := common.MapStr{}
+	ecsFields(common.MapStr{"type": "fix", "fix": fix}, fields)
+	return fields
+}
+
+func TestECSFieldsMessage(t *testing.T) {
+	fields := ecsFieldsOf(common.MapStr{
+		"msg_type":   "ExecutionReport",
+		"direction":  "inbound",
+		"latency_us": int64(250),
+	})
+
+	assert.Equal(t, common.MapStr{
+		"event": common.MapStr{
+			"action":   "ExecutionReport",
+			"duration": int64(250 * time.Microsecond),
+		},
+		"network": common.MapStr{"direction": "inbound"},
+	}, fields)
+}
+
+func TestECSFieldsEvents(t *testing.T) {
+	fields := ecsFieldsOf(common.MapStr{
+		"session": common.MapStr{"event": "established"},
+	})
+	assert.Equal(t, common.MapStr{"event": common.MapStr{"action": "established"}}, fields)
+
+	fields = ecsFieldsOf(common.MapStr{
+		"reject": common.MapStr{"latency_us": int64(40)},
+	})
+	assert.Equal(t, common.MapStr{"event": common.MapStr{
+		"action":   "reject",
+		"duration": int64(40 * time.Microsecond),
+	}}, fields)
+
+	fields = ecsFieldsOf(common.MapStr{"stats": common.MapStr{}})
+	assert.Equal(t, common.MapStr{"event": common.MapStr{
+		"action": "stats",
+		"kind":   "metric",
+	}}, fields)
+}
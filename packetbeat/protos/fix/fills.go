@@ -0,0 +1,250 @@
+package fix
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+const (
+	tagAvgPx       = 6
+	tagCumQty      = 14
+	tagLastPx      = 31
+	tagLastQty     = 32
+	tagOrderID     = 37
+	tagOrderQty    = 38
+	tagOrdStatus   = 39
+	tagOrigClOrdID = 41
+	tagSide        = 54
+	tagSymbol      = 55
+	tagLeavesQty   = 151
+)
+
+// orderTimeout is the time after which orders not reported on are forgotten,
+// once maxPendingOrders is reached.
+const orderTimeout = time.Hour
+
+// fillTracker aggregates the ExecutionReports of an order by ClOrdID, to
+// summarize the fills once the order is complete.
+type fillTracker struct {
+	// open orders by ClOrdID, per direction the orders have been sent in
+	orders [2]map[string]*orderFills
+}
+
+type orderFills struct {
+	// capture time of the NewOrderSingle, or of the first ExecutionReport if
+	// the order has not been captured
+	start time.Time
+	// capture time of the last message of the order
+	lastSeen time.Time
+
+	clOrdID, orderID string
+	symbol, side     string
+	orderQty         float64
+
+	// last values reported
+	cumQty, leavesQty, avgPx float64
+
+	// sum of LastQty and LastQty * LastPx over all fills, for the VWAP
+	fillQty, fillNotional float64
+	fills                 int
+}
+
+// orderSummary is reported once an order is filled, canceled or rejected.
+type orderSummary struct {
+	ts     time.Time
+	order  *orderFills
+	status string
+}
+
+// onMessage updates the open orders and returns the summary of an order
+// completed by msg.
+func (f *fillTracker) onMessage(dir uint8, msg *message) *orderSummary {
+	msgType, _ := msg.fields.get(tagMsgType)
+	clOrdID, ok := msg.fields.get(tagClOrdID)
+	if !ok {
+		return nil
+	}
+
+	switch msgType {
+	case msgTypeNewOrderSingle:
+		f.open(dir, clOrdID, msg.ts).update(msg.fields)
+
+	case msgTypeExecutionReport:
+		order := f.lookup(1-dir, clOrdID, msg)
+		if order == nil {
+			return nil
+		}
+		order.lastSeen = msg.ts
+		order.update(msg.fields)
+		order.fill(msg.fields)
+
+		status, _ := msg.fields.get(tagOrdStatus)
+		if !isOrderComplete(status) {
+			return nil
+		}
+		delete(f.orders[1-dir], order.clOrdID)
+		return &orderSummary{ts: msg.ts, order: order, status: status}
+	}
+	return nil
+}
+
+// open starts following the order clOrdID, making room for it by forgetting
+// the orders expired, or else the order reported on least recently, if
+// maxPendingOrders are open.
+func (f *fillTracker) open(dir uint8, clOrdID string, ts time.Time) *orderFills {
+	if f.orders[dir] == nil {
+		f.orders[dir] = map[string]*orderFills{}
+	}
+	if _, ok := f.orders[dir][clOrdID]; !ok && len(f.orders[dir]) >= maxPendingOrders {
+		f.expire(dir, ts)
+	}
+
+	order := &orderFills{start: ts, lastSeen: ts, clOrdID: clOrdID}
+	f.orders[dir][clOrdID] = order
+	return order
+}
+
+// expire forgets the orders not reported on for orderTimeout at ts, or else
+// the order reported on least recently.
+func (f *fillTracker) expire(dir uint8, ts time.Time) {
+	orders := f.orders[dir]
+	expired := 0
+	var oldest *orderFills
+	for id, order := range orders {
+		if ts.Sub(order.lastSeen) >= orderTimeout {
+			delete(orders, id)
+			expired++
+			continue
+		}
+		if oldest == nil || order.lastSeen.Before(oldest.lastSeen) {
+			oldest = order
+		}
+	}
+	if expired > 0 {
+		expiredOrders.Add(int64(expired))
+		return
+	}
+
+	delete(orders, oldest.clOrdID)
+	evictedOrders.Add(1)
+	if isDebug {
+		debugf("too many open orders, forget the oldest ClOrdID=%v", oldest.clOrdID)
+	}
+}
+
+// lookup returns the open order reported on by an ExecutionReport. Orders
+// replaced by OrderCancelReplaceRequest are continued with the new ClOrdID.
+func (f *fillTracker) lookup(dir uint8, clOrdID string, msg *message) *orderFills {
+	orders := f.orders[dir]
+	if order, ok := orders[clOrdID]; ok {
+		return order
+	}
+
+	if orig, ok := msg.fields.get(tagOrigClOrdID); ok {
+		if order, ok := orders[orig]; ok {
+			delete(orders, orig)
+			order.clOrdID = clOrdID
+			orders[clOrdID] = order
+			return order
+		}
+	}
+
+	// orders not captured are followed from their acknowledgment or first
+	// fill only, not from the status reports of orders already done
+	switch status, _ := msg.fields.get(tagOrdStatus); status {
+	case "0", "1":
+		return f.open(dir, clOrdID, msg.ts)
+	}
+	return nil
+}
+
+func (o *orderFills) update(fields tagValues) {
+	if v, ok := fields.get(tagOrderID); ok {
+		o.orderID = v
+	}
+	if v, ok := fields.get(tagSymbol); ok {
+		o.symbol = v
+	}
+	if v, ok := fields.get(tagSide); ok {
+		o.side = v
+	}
+	if v, ok := getFloat(fields, tagOrderQty); ok {
+		o.orderQty = v
+	}
+}
+
+// fill updates the quantities of the order. ExecutionReports sent again with
+// PossDupFlag are skipped, not to count their fills twice.
+func (o *orderFills) fill(fields tagValues) {
+	if possDup, _ := fields.get(tagPossDupFlag); possDup == "Y" {
+		return
+	}
+	if v, ok := getFloat(fields, tagCumQty); ok {
+		o.cumQty = v
+	}
+	if v, ok := getFloat(fields, tagLeavesQty); ok {
+		o.leavesQty = v
+	}
+	if v, ok := getFloat(fields, tagAvgPx); ok {
+		o.avgPx = v
+	}
+
+	lastQty, _ := getFloat(fields, tagLastQty)
+	lastPx, _ := getFloat(fields, tagLastPx)
+	if lastQty > 0 {
+		o.fills++
+		o.fillQty += lastQty
+		o.fillNotional += lastQty * lastPx
+	}
+}
+
+// isOrderComplete checks the OrdStatus (39) for the order being filled,
+// done for day, canceled, rejected or expired.
+func isOrderComplete(status string) bool {
+	switch status {
+	case "2", "3", "4", "8", "C":
+		return true
+	}
+	return false
+}
+
+// fields returns the order summary, with Side and OrdStatus decoded by dict.
+func (s *orderSummary) fields(dict *dictionary) common.MapStr {
+	o := s.order
+	fields := common.MapStr{
+		"cl_ord_id":       o.clOrdID,
+		"status":          dict.enum(tagOrdStatus, s.status),
+		"filled_qty":      o.cumQty,
+		"leaves_qty":      o.leavesQty,
+		"avg_px":          o.avgPx,
+		"fills":           o.fills,
+		"time_to_fill_us": int64(s.ts.Sub(o.start) / time.Microsecond),
+	}
+	if o.orderID != "" {
+		fields["order_id"] = o.orderID
+	}
+	if o.symbol != "" {
+		fields["symbol"] = o.symbol
+	}
+	if o.side != "" {
+		fields["side"] = dict.enum(tagSide, o.side)
+	}
+	if o.orderQty > 0 {
+		fields["order_qty"] = o.orderQty
+	}
+	if o.fillQty > 0 {
+		fields["vwap"] = o.fillNotional / o.fillQty
+	}
+	return fields
+}
+
+func getFloat(fields tagValues, tag int) (float64, bool) {
+	v, ok := fields.get(tag)
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	return f, err == nil
+}
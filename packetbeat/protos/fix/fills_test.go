@@ -0,0 +1,122 @@
+// +build !integration
+
+package fix
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderFillSummary(t *testing.T) {
+	fix, results := fixModForTests()
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+
+	private := parseTimedMessages(fix, ts, []timedMessage{
+		{initiator, 0, "8=FIX.4.2|35=D|34=2|11=order-1|55=VOD.L|54=1|38=300|"},
+		{acceptor, time.Millisecond, "8=FIX.4.2|35=8|34=2|11=order-1|37=X1|39=0|14=0|151=300|"},
+		{acceptor, 2 * time.Millisecond, "8=FIX.4.2|35=8|34=3|11=order-1|37=X1|39=1|32=100|31=10|14=100|151=200|6=10|"},
+		{acceptor, 5 * time.Millisecond, "8=FIX.4.2|35=8|34=4|11=order-1|37=X1|39=2|32=200|31=11.5|14=300|151=0|6=11|"},
+	})
+
+	order := expectFixEvent(t, results, "order")
+	assert.Equal(t, "order-1", order["cl_ord_id"])
+	assert.Equal(t, "X1", order["order_id"])
+	assert.Equal(t, "VOD.L", order["symbol"])
+	assert.Equal(t, "Buy", order["side"])
+	assert.Equal(t, "Filled", order["status"])
+	assert.Equal(t, 300.0, order["order_qty"])
+	assert.Equal(t, 300.0, order["filled_qty"])
+	assert.Equal(t, 0.0, order["leaves_qty"])
+	assert.Equal(t, 11.0, order["avg_px"])
+	assert.Equal(t, 2, order["fills"])
+	assert.InDelta(t, 11.0, order["vwap"], 1e-9)
+	assert.Equal(t, int64(5000), order["time_to_fill_us"])
+	assert.Empty(t, private.(*fixConnectionData).fills.orders[initiator])
+}
+
+func TestOrderCanceledAfterReplace(t *testing.T) {
+	fix, results := fixModForTests()
+
+	parseSession(fix, nil, []directedMessage{
+		{initiator, "8=FIX.4.2|35=D|34=2|11=order-1|38=100|"},
+		{acceptor, "8=FIX.4.2|35=8|34=2|11=order-1|39=1|32=40|31=5|14=40|151=60|"},
+		{acceptor, "8=FIX.4.2|35=8|34=3|11=order-2|41=order-1|39=5|14=40|151=160|"},
+		{acceptor, "8=FIX.4.2|35=8|34=4|11=order-2|39=4|14=40|151=0|"},
+	}...)
+
+	order := expectFixEvent(t, results, "order")
+	assert.Equal(t, "order-2", order["cl_ord_id"])
+	assert.Equal(t, "Canceled", order["status"])
+	assert.Equal(t, 40.0, order["filled_qty"])
+	assert.Equal(t, 1, order["fills"])
+	assert.Equal(t, 5.0, order["vwap"])
+}
+
+func TestOrderFillsSkipPossDup(t *testing.T) {
+	fix, results := fixModForTests()
+
+	parseSession(fix, nil, []directedMessage{
+		{initiator, "8=FIX.4.2|35=D|34=2|11=order-1|38=100|"},
+		{acceptor, "8=FIX.4.2|35=8|34=2|11=order-1|39=1|32=40|31=5|14=40|151=60|"},
+		// resent after a reconnect
+		{acceptor, "8=FIX.4.2|35=8|34=2|43=Y|11=order-1|39=1|32=40|31=5|14=40|151=60|"},
+		{acceptor, "8=FIX.4.2|35=8|34=3|11=order-1|39=2|32=60|31=6|14=100|151=0|"},
+	}...)
+
+	order := expectFixEvent(t, results, "order")
+	assert.Equal(t, 2, order["fills"])
+	assert.InDelta(t, 5.6, order["vwap"], 1e-9)
+}
+
+func TestOrderNotOpenedByStatusReport(t *testing.T) {
+	var f fillTracker
+	for _, raw := range []string{
+		"8=FIX.4.2|35=8|34=2|11=order-1|39=2|32=100|31=5|14=100|151=0|",
+		"8=FIX.4.2|35=8|34=3|11=order-2|39=4|14=0|151=0|",
+		"8=FIX.4.2|35=8|34=4|11=order-3|39=0|14=0|151=100|",
+	} {
+		msg := &message{ts: time.Now(), fields: splitFields(fixMessage(raw))}
+		assert.Nil(t, f.onMessage(acceptor, msg))
+	}
+
+	// only the order acknowledged is followed
+	assert.Len(t, f.orders[initiator], 1)
+	assert.Contains(t, f.orders[initiator], "order-3")
+}
+
+func TestOpenOrdersLimit(t *testing.T) {
+	var f fillTracker
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < maxPendingOrders; i++ {
+		f.open(initiator, fmt.Sprintf("order-%d", i), ts.Add(time.Duration(i)*time.Millisecond))
+	}
+	evicted := evictedOrders.Value()
+
+	// the order reported on least recently makes room for the new order
+	f.orders[initiator]["order-0"].lastSeen = ts.Add(time.Hour - time.Second)
+	f.open(initiator, "new", ts.Add(time.Minute))
+	assert.Len(t, f.orders[initiator], maxPendingOrders)
+	assert.Contains(t, f.orders[initiator], "new")
+	assert.Contains(t, f.orders[initiator], "order-0")
+	assert.NotContains(t, f.orders[initiator], "order-1")
+	assert.Equal(t, evicted+1, evictedOrders.Value())
+}
+
+func TestOpenOrdersExpired(t *testing.T) {
+	var f fillTracker
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < maxPendingOrders; i++ {
+		f.open(initiator, fmt.Sprintf("order-%d", i), ts)
+	}
+	f.orders[initiator]["order-0"].lastSeen = ts.Add(orderTimeout)
+	expired := expiredOrders.Value()
+
+	// the orders not reported on for orderTimeout are forgotten
+	f.open(initiator, "new", ts.Add(orderTimeout+time.Second))
+	assert.Len(t, f.orders[initiator], 2)
+	assert.Contains(t, f.orders[initiator], "order-0")
+	assert.Equal(t, expired+maxPendingOrders-1, expiredOrders.Value())
+}
@@ -0,0 +1,99 @@
+package fix
+
+import "errors"
+
+type filterConfig struct {
+	SenderCompID string   `config:"sender_comp_id"`
+	TargetCompID string   `config:"target_comp_id"`
+	Include      []string `config:"include"`
+	Exclude      []string `config:"exclude"`
+}
+
+// msgFilter selects the messages published by MsgType. Rules are checked in
+// order and the first rule matching the session of a message applies.
+type msgFilter struct {
+	rules []filterRule
+}
+
+type filterRule struct {
+	senderCompID, targetCompID string
+	include, exclude           map[string]bool
+}
+
+func (c *filterConfig) Validate() error {
+	if len(c.Include) == 0 && len(c.Exclude) == 0 {
+		return errors.New("filter requires include or exclude")
+	}
+	if len(c.Include) > 0 && len(c.Exclude) > 0 {
+		return errors.New("filter include and exclude can not be combined")
+	}
+	return nil
+}
+
+func newMsgFilter(configs []filterConfig) *msgFilter {
+	if len(configs) == 0 {
+		return nil
+	}
+
+	f := &msgFilter{}
+	for _, c := range configs {
+		f.rules = append(f.rules, filterRule{
+			senderCompID: c.SenderCompID,
+			targetCompID: c.TargetCompID,
+			include:      stringSet(c.Include),
+			exclude:      stringSet(c.Exclude),
+		})
+	}
+	return f
+}
+
+// accept returns false if the message is not to be published. Messages of
+// sessions not matched by any rule are accepted.
+func (f *msgFilter) accept(fields tagValues) bool {
+	if f == nil {
+		return true
+	}
+
+	sender, _ := fields.get(tagSenderCompID)
+	target, _ := fields.get(tagTargetCompID)
+	msgType, _ := fields.get(tagMsgType)
+	for i := range f.rules {
+		rule := &f.rules[i]
+		if !rule.matches(sender, target) {
+			continue
+		}
+		if len(rule.include) > 0 {
+			return rule.include[msgType]
+		}
+		return !rule.exclude[msgType]
+	}
+	return true
+}
+
+// matches checks the rule CompIDs against both directions of a session. Empty
+// CompIDs match any value.
+func (r *filterRule) matches(sender, target string) bool {
+	return matchSession(r.senderCompID, r.targetCompID, sender, target)
+}
+
+// matchSession checks the CompIDs of a rule against the SenderCompID and
+// TargetCompID of a message, in either direction.
+func matchSession(ruleSender, ruleTarget, sender, target string) bool {
+	return (matchCompID(ruleSender, sender) && matchCompID(ruleTarget, target)) ||
+		(matchCompID(ruleSender, target) && matchCompID(ruleTarget, sender))
+}
+
+func matchCompID(pattern, id string) bool {
+	return pattern == "" || pattern == id
+}
+
+func stringSet(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
@@ -0,0 +1,56 @@
+// +build !integration
+
+package fix
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func TestMsgFilterAccept(t *testing.T) {
+	f := newMsgFilter([]filterConfig{
+		{SenderCompID: "BROKER", TargetCompID: "EXCH", Include: []string{"8"}},
+		{Exclude: []string{"0", "1"}},
+	})
+
+	accept := func(msg string) bool {
+		return f.accept(splitFields(fixMessage(msg)))
+	}
+
+	// whitelist of the BROKER session, in both directions
+	assert.True(t, accept("8=FIX.4.2|35=8|49=EXCH|56=BROKER|"))
+	assert.False(t, accept("8=FIX.4.2|35=D|49=BROKER|56=EXCH|"))
+	assert.False(t, accept("8=FIX.4.2|35=0|49=BROKER|56=EXCH|"))
+
+	// blacklist for all other sessions
+	assert.True(t, accept("8=FIX.4.2|35=D|49=OTHER|56=EXCH|"))
+	assert.False(t, accept("8=FIX.4.2|35=0|49=OTHER|56=EXCH|"))
+	assert.False(t, accept("8=FIX.4.2|35=1|"))
+
+	assert.True(t, newMsgFilter(nil).accept(splitFields(fixMessage("8=FIX.4.2|35=0|"))))
+}
+
+func TestParseFilteredMessagesKeepSession(t *testing.T) {
+	fix, results := fixModForTests()
+	fix.filter = newMsgFilter([]filterConfig{{Exclude: []string{"0", "A"}}})
+
+	parseMessages(fix,
+		"8=FIXT.1.1|35=A|34=1|1137=6|",
+		"8=FIXT.1.1|35=0|34=2|",
+		"8=FIXT.1.1|35=8|34=3|150=L|")
+
+	// DefaultApplVerID of the dropped Logon is still used for decoding, so
+	// ExecType L, added by FIX 5.0, is not known
+	report := expectEvent(t, results)["fix"].(common.MapStr)
+	assert.Equal(t, "L", report["ExecType"])
+	assert.Empty(t, results.Channel)
+}
+
+func TestFilterConfigValidate(t *testing.T) {
+	assert.NoError(t, (&filterConfig{Include: []string{"8"}}).Validate())
+	assert.Error(t, (&filterConfig{}).Validate())
+	assert.Error(t, (&filterConfig{Include: []string{"8"}, Exclude: []string{"0"}}).Validate())
+}
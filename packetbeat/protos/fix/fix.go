@@ -1,138 +1,1194 @@
 package fix
 
 import (
-    "time"
-    "strings"
-    "strconv"
+	"bytes"
+	"container/list"
+	"encoding/base64"
+	"expvar"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
 
-    "github.com/elastic/beats/libbeat/common"
-    "github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/monitoring"
 
-    //"github.com/elastic/beats/packetbeat/procs"
-    "github.com/elastic/beats/packetbeat/protos"
-    //"github.com/elastic/beats/packetbeat/protos/tcp"
-    "github.com/elastic/beats/packetbeat/publish"
+	"github.com/elastic/beats/packetbeat/protos"
+	"github.com/elastic/beats/packetbeat/protos/applayer"
+	"github.com/elastic/beats/packetbeat/protos/tcp"
+	"github.com/elastic/beats/packetbeat/protos/tlsdecrypt"
+	"github.com/elastic/beats/packetbeat/publish"
 )
 
-var debugf = logp.Info
+type stream struct {
+	applayer.Stream
+	parser   parser
+	tcptuple *common.TCPTuple
+
+	// bytes skipped since the stream failed to parse, published with the
+	// resync event once the next message is framed
+	skipped int
+}
+
+type fixConnectionData struct {
+	streams [2]*stream
+
+	// DefaultApplVerID negotiated at Logon by FIXT.1.1 sessions
+	defaultApplVerID string
+
+	session   session
+	sequences sequenceTracker
+	latency   latencyTracker
+	fills     fillTracker
+	rfqs      rfqTracker
+	rejects   rejectTracker
+	stats     statsTracker
+
+	// number of PossDup/PossResend messages seen, for sampling
+	retransmissions uint64
+
+	// ports of the connection, selecting custom dictionaries
+	ports [2]uint16
+
+	// set if the connection was first seen from the acceptor, the capture
+	// having started after the connection was established. The tuple from
+	// the initiator to the acceptor is kept in initiatorTuple.
+	reversed       bool
+	initiatorTuple *common.TCPTuple
+
+	// decryption of FIX over TLS connections, nil for plain connections
+	tls       *tlsdecrypt.Session
+	tlsFailed bool
+
+	// SBE message being processed, nil for tag=value messages
+	sbe *sbeFrame
+
+	// FIXML message being processed, nil for tag=value messages
+	fixml *fixmlFrame
+
+	// set if the connection was claimed by detecting FIX on a port not
+	// configured, until its first message is published
+	autodetected bool
+
+	// set if the messages of a connection detected are not decoded
+	ignored bool
+
+	// bytes buffered by the streams, accounted by the reassembly budget, and
+	// the element of the connection in its LRU list while buffering
+	buffered   int
+	lastSeen   time.Time
+	reassembly *list.Element
+
+	// TCP state observed, for the TCP stats and the slow consumers
+	tcp           tcpState
+	slowConsumers slowConsumerTracker
+
+	// capture time of the last segment, timestamping the close of the
+	// session
+	lastSegment time.Time
+}
 
 type fixPlugin struct {
-    // config
-    ports        []int
-    sendRequest  bool
-    sendResponse bool
+	// config
+	ports        []int
+	portRanges   []protos.PortRange
+	sendRequest  bool
+	sendResponse bool
+
+	transactionTimeout time.Duration
+
+	retransmissions          string
+	retransmissionSampleRate uint64
+
+	// use SendingTime instead of the capture time as event timestamp
+	useSendingTime bool
+
+	// method of the document IDs published, none if empty
+	documentID string
+
+	// delay beyond the HeartBtInt before late heartbeats are reported
+	heartbeatTolerance time.Duration
+
+	// period of the stats events published per session, 0 if disabled
+	statsInterval time.Duration
+
+	// time after which RFQs not traded are reported as expired, 0 if RFQs
+	// do not expire
+	rfqTimeout time.Duration
 
-    transactionTimeout time.Duration
+	masker  *masker
+	filter  *msgFilter
+	sampler *msgSampler
+	limiter *rateLimiter
+	mapper  *fieldMapper
+	names   *nameSanitizer
 
-    results publish.Transactions
+	dictionaries *customDictionaries
+	sbe          *sbeStreams
+	fixmlPorts   map[uint16]bool
+	fixmlXMLData bool
+	sessions     *knownSessions
+	tenants      *tenants
+	ourSide      *ourSide
+	dedup        *deduplicator
+	dedupConfig  dedupConfig
+	books        *bookTracker
+	bookConfig   bookConfig
+
+	// keys decrypting TLS connections, nil if not configured
+	tlsKeys *tlsdecrypt.Keys
+
+	// detection of FIX on the ports not configured, the acceptors detected
+	// and the number of packets of the connections not detected, kept on
+	// reload
+	autodetect      autodetectConfig
+	detectedServers *detectedServers
+	undetected      *common.Cache
+
+	// memory buffered by the connections, kept on reload
+	reassembly *reassemblyBudget
+
+	// detection of receivers not keeping up with the data sent to them
+	slowConsumer slowConsumerConfig
+
+	// add the raw message to events, with SOH replaced by '|' and/or base64
+	// encoded
+	rawText, rawBase64 bool
+
+	results livePublisher
 }
 
+var (
+	debugf  = logp.MakeDebug("fix")
+	isDebug = false
+)
+
+var (
+	messagesDecoded  = expvar.NewInt("fix.messages")
+	parseErrors      = expvar.NewInt("fix.parse_errors")
+	resyncs          = expvar.NewInt("fix.resyncs")
+	skippedBytes     = expvar.NewInt("fix.skipped_bytes")
+	invalidChecksums = expvar.NewInt("fix.invalid_checksums")
+	unmatchedOrders  = expvar.NewInt("fix.unmatched_orders")
+	expiredRequests  = expvar.NewInt("fix.expired_requests")
+	expiredOrders    = expvar.NewInt("fix.expired_orders")
+	evictedOrders    = expvar.NewInt("fix.evicted_orders")
+	evictedRFQs      = expvar.NewInt("fix.evicted_rfqs")
+
+	droppedRetransmissions = expvar.NewInt("fix.dropped_retransmissions")
+	filteredMessages       = expvar.NewInt("fix.filtered_messages")
+	droppedBySampling      = expvar.NewInt("fix.dropped_by_sampling")
+	rateLimitedMessages    = expvar.NewInt("fix.rate_limited")
+	duplicateExecutions    = expvar.NewInt("fix.duplicate_executions")
+	renamedFieldNames      = expvar.NewInt("fix.renamed_field_names")
+	droppedFieldNames      = expvar.NewInt("fix.dropped_field_names")
+
+	unknownSessions = expvar.NewInt("fix.unknown_sessions")
+
+	tlsSessions = expvar.NewInt("fix.tls_sessions")
+	tlsErrors   = expvar.NewInt("fix.tls_errors")
+
+	// messages per session, by SenderCompID and TargetCompID of the initiator
+	sessionMessages = expvar.NewMap("fix.sessions")
+	// messages per session and MsgType
+	sessionMsgTypes      = expvar.NewMap("fix.session_messages")
+	sessionMsgTypesMutex sync.Mutex
+)
+
 func init() {
-    protos.Register("fix", New)
+	protos.Register("fix", New)
+
+	monitoring.SetLabels("fix.sessions", "session")
+	monitoring.SetLabels("fix.session_messages", "session", "msg_type")
+}
+
+// countSessionMessage counts a message by session and MsgType.
+func countSessionMessage(session string, msg *message) {
+	msgType, _ := msg.fields.get(tagMsgType)
+
+	sessionMsgTypesMutex.Lock()
+	defer sessionMsgTypesMutex.Unlock()
+	counts, ok := sessionMsgTypes.Get(session).(*expvar.Map)
+	if !ok {
+		counts = new(expvar.Map).Init()
+		sessionMsgTypes.Set(session, counts)
+	}
+	counts.Add(msgType, 1)
 }
 
 func New(testMode bool, results publish.Transactions, cfg *common.Config) (protos.Plugin, error) {
-    p := &fixPlugin{}
-    config := defaultConfig
-    if !testMode {
-        if err := cfg.Unpack(&config); err != nil {
-            return nil, err
-        }
-    }
+	p := &fixPlugin{}
+	config := defaultConfig
+	var ranges []protos.PortRange
+	if !testMode {
+		if err := cfg.Unpack(&config); err != nil {
+			return nil, err
+		}
+		var err error
+		if ranges, err = protos.ParsePortRanges(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.init(results, &config); err != nil {
+		return nil, err
+	}
+	p.portRanges = ranges
+
+	return p, nil
+}
 
-    if err := p.init(results, &config); err != nil {
-        return nil, err
-    }
+// Reload applies a reloaded config to the messages parsed next. The state of
+// the open sessions is kept, as is the deduplication state unless its config
+// changed, and the books reconstructed unless their config changed. On error
+// the previous config is kept.
+func (fix *fixPlugin) Reload(results publish.Transactions, cfg *common.Config) error {
+	config := defaultConfig
+	if err := cfg.Unpack(&config); err != nil {
+		return err
+	}
+	ranges, err := protos.ParsePortRanges(cfg)
+	if err != nil {
+		return err
+	}
 
-    return p, nil
+	dedup, dedupConfig := fix.dedup, fix.dedupConfig
+	books, bookConfig := fix.books, fix.bookConfig
+	if err := fix.init(results, &config); err != nil {
+		return err
+	}
+	fix.portRanges = ranges
+	if config.Dedup == dedupConfig {
+		fix.dedup = dedup
+	}
+	if config.Book == bookConfig {
+		fix.books = books
+	}
+	return nil
 }
 
 func (fix *fixPlugin) init(results publish.Transactions, config *fixConfig) error {
-    fix.setFromConfig(config)
+	// load the files first, not to change the config on error
+	dictionaries, err := loadDictionaries(config.Dictionaries)
+	if err != nil {
+		return err
+	}
+	sbe, err := loadSBESchemas(config.SBE)
+	if err != nil {
+		return err
+	}
+	for _, port := range config.FIXML.Ports {
+		if sbe.lookup([2]uint16{uint16(port), uint16(port)}) != nil {
+			return fmt.Errorf("port %v is set for both SBE and FIXML", port)
+		}
+	}
+
+	var tlsKeys *tlsdecrypt.Keys
+	if config.TLS.Enabled() {
+		if tlsKeys, err = tlsdecrypt.NewKeys(&config.TLS); err != nil {
+			return err
+		}
+	}
 
-    fix.results = results
+	if err := tracer.configure(config.Trace); err != nil {
+		return err
+	}
+	if err := live.configure(config.Live); err != nil {
+		return err
+	}
 
-    return nil
+	fix.setFromConfig(config)
+	fix.dictionaries = dictionaries
+	fix.sbe = sbe
+	fix.tlsKeys = tlsKeys
+	fix.results = livePublisher{results}
+	isDebug = logp.IsDebug("fix")
+
+	return nil
 }
 
 func (fix *fixPlugin) setFromConfig(config *fixConfig) {
-    fix.ports = config.Ports
-    fix.sendRequest = config.SendRequest
-    fix.sendResponse = config.SendResponse
-    fix.transactionTimeout = config.TransactionTimeout
+	fix.ports = config.Ports
+	fix.sendRequest = config.SendRequest
+	fix.sendResponse = config.SendResponse
+	fix.transactionTimeout = config.TransactionTimeout
+	fix.retransmissions = config.Retransmissions
+	fix.retransmissionSampleRate = uint64(config.RetransmissionSampleRate)
+	fix.useSendingTime = config.Timestamp == "sending_time"
+	fix.documentID = config.DocumentID
+	fix.heartbeatTolerance = config.HeartbeatTolerance
+	fix.statsInterval = config.StatsInterval
+	fix.masker = newMasker(config.Mask)
+	fix.filter = newMsgFilter(config.Filter)
+	fix.sampler = newMsgSampler(config.Sampling)
+	fix.limiter = newRateLimiter(config.RateLimit)
+	fix.mapper = newFieldMapper(config.FieldsMapping, config.FieldsMappingOnly)
+	fix.names = newNameSanitizer(config.FieldNames)
+	fix.sessions = newKnownSessions(config.Sessions)
+	fix.tenants = newTenants(config.Tenants)
+	fix.ourSide = newOurSide(config.OurSide)
+	fix.dedup = newDeduplicator(config.Dedup)
+	fix.dedupConfig = config.Dedup
+	fix.books = newBookTracker(config.Book)
+	fix.bookConfig = config.Book
+	fix.rfqTimeout = config.RFQ.Timeout
+	fix.fixmlPorts = nil
+	if len(config.FIXML.Ports) > 0 {
+		fix.fixmlPorts = map[uint16]bool{}
+		for _, port := range config.FIXML.Ports {
+			fix.fixmlPorts[uint16(port)] = true
+		}
+	}
+	fix.fixmlXMLData = config.FIXML.XMLData
+	fix.rawText = config.Raw.Text
+	fix.rawBase64 = config.Raw.Base64
+	fix.autodetect = config.Autodetect
+	if fix.detectedServers == nil {
+		fix.detectedServers = &detectedServers{}
+	}
+	fix.slowConsumer = config.SlowConsumer
+	if fix.reassembly == nil {
+		fix.reassembly = &reassemblyBudget{}
+	}
+	fix.reassembly.configure(config.Reassembly, config.TransactionTimeout)
 }
 
+// GetPorts returns the configured ports, and the ports of the SBE and FIXML
+// streams.
 func (fix *fixPlugin) GetPorts() []int {
-    return fix.ports
+	if fix.sbe == nil && fix.fixmlPorts == nil {
+		return fix.ports
+	}
+	ports := append([]int(nil), fix.ports...)
+	known := map[int]bool{}
+	for _, port := range ports {
+		known[port] = true
+	}
+	add := func(port uint16) {
+		if !known[int(port)] {
+			known[int(port)] = true
+			ports = append(ports, int(port))
+		}
+	}
+	if fix.sbe != nil {
+		for port := range fix.sbe.ports {
+			add(port)
+		}
+	}
+	for port := range fix.fixmlPorts {
+		add(port)
+	}
+	sort.Ints(ports)
+	return ports
 }
 
-
 func (fix *fixPlugin) ConnectionTimeout() time.Duration {
-    return fix.transactionTimeout
+	return fix.transactionTimeout
+}
+
+func (s *stream) PrepareForNewMessage() {
+	s.Stream.Reset()
+	s.parser.reset()
 }
 
 func (fix *fixPlugin) Parse(pkt *protos.Packet, tcptuple *common.TCPTuple,
-    dir uint8, private protos.ProtocolData) protos.ProtocolData {
+	dir uint8, private protos.ProtocolData) protos.ProtocolData {
+
+	defer logp.Recover("ParseFix exception")
+
+	conn := ensureFixConnection(private)
+	conn.ports = [2]uint16{tcptuple.SrcPort, tcptuple.DstPort}
+	conn.lastSegment = pkt.Ts
+	if fix.doParse(conn, pkt, tcptuple, dir) == nil {
+		fix.reassembly.remove(conn)
+		return nil
+	}
+	fix.reassembly.track(conn, pkt.Ts)
+	return conn
+}
+
+func ensureFixConnection(private protos.ProtocolData) *fixConnectionData {
+	if private == nil {
+		return &fixConnectionData{}
+	}
+
+	priv, ok := private.(*fixConnectionData)
+	if !ok {
+		logp.Warn("fix connection data type error, create new one")
+		return &fixConnectionData{}
+	}
+	if priv == nil {
+		logp.Warn("Unexpected: fix connection data not set, create new one")
+		return &fixConnectionData{}
+	}
+
+	return priv
+}
+
+func (fix *fixPlugin) doParse(
+	conn *fixConnectionData,
+	pkt *protos.Packet,
+	tcptuple *common.TCPTuple,
+	dir uint8,
+) *fixConnectionData {
+	if conn.ignored {
+		return conn
+	}
+
+	payload := pkt.Payload
+	if fix.tlsKeys != nil {
+		var ok bool
+		if payload, ok = fix.decrypt(conn, tcptuple, dir, payload); !ok || len(payload) == 0 {
+			return conn
+		}
+	}
+
+	st := conn.streams[dir]
+	if st == nil {
+		st = newStream(tcptuple)
+		conn.streams[dir] = st
+		if isDebug {
+			debugf("new stream: %p (dir=%v, len=%v)", st, dir, len(payload))
+		}
+	}
+
+	if err := st.Append(payload); err != nil {
+		if isDebug {
+			debugf("%v, dropping TCP stream: ", err)
+		}
+		return nil
+	}
+	if isDebug {
+		debugf("stream add data: %p (dir=%v, len=%v)", st, dir, len(payload))
+	}
+	if sbe := fix.sbe.lookup(conn.ports); sbe != nil {
+		return fix.parseSBE(conn, st, sbe, pkt, tcptuple, dir)
+	}
+	if fix.isFIXMLPort(conn.ports) {
+		return fix.parseFIXML(conn, st, pkt, tcptuple, dir)
+	}
+
+	for st.Buf.Len() > 0 {
+		if st.parser.message == nil {
+			st.parser.message = &message{ts: pkt.Ts}
+		}
+
+		ok, complete := st.parser.parse(&st.Buf)
+		if !ok {
+			// The capture started in the middle of a message or bytes got
+			// corrupted. Skip to the next BeginString, keeping the stream.
+			if st.skipped == 0 {
+				parseErrors.Add(1)
+				if isDebug {
+					debugf("Invalid FIX message, resynchronizing on the next BeginString")
+				}
+			}
+			n := resync(&st.Buf)
+			st.skipped += n
+			skippedBytes.Add(int64(n))
+			st.PrepareForNewMessage()
+			continue
+		}
 
-    parts := strings.Split(string(pkt.Payload), string(rune(01)))
+		if !complete {
+			// wait for more data
+			break
+		}
 
-    parts = parts[:len(parts)-1]
+		msg := st.parser.message
+		if st.skipped > 0 {
+			resyncs.Add(1)
+			fix.publishResyncEvent(conn, tcptuple, dir, msg, st.skipped)
+			st.skipped = 0
+		}
+		msg.fields = fix.masker.apply(msg.fields)
+		if !msg.checksumValid {
+			invalidChecksums.Add(1)
+			if isDebug {
+				debugf("Ignore FIX message with invalid CheckSum: %q", msg.raw)
+			}
+		} else if conn.autodetected {
+			conn.autodetected = false
+			if !fix.autodetect.Decode {
+				fix.publishAutodetectedEvent(conn, tcptuple, dir, msg)
+				conn.ignored = true
+				st.PrepareForNewMessage()
+				return conn
+			}
+			// published once the session is identified
+			fix.onMessage(conn, tcptuple, dir, msg)
+			fix.publishAutodetectedEvent(conn, tcptuple, dir, msg)
+		} else {
+			fix.onMessage(conn, tcptuple, dir, msg)
+		}
+		st.PrepareForNewMessage()
+	}
 
-    debugf("stream add data: %q (dir=%v, len=%v) {", parts, dir, len(pkt.Payload))
+	return conn
+}
+
+// onMessage publishes a message of a TCP connection, sent in direction dir of
+// tcptuple, and updates the state of its session.
+func (fix *fixPlugin) onMessage(
+	conn *fixConnectionData,
+	tcptuple *common.TCPTuple,
+	dir uint8,
+	msg *message,
+) {
+	if !conn.session.hasKey {
+		// the acceptor listens on the configured or detected ports
+		conn.reversed = fix.isServerPort(tcptuple.SrcIP, tcptuple.SrcPort) &&
+			!fix.isServerPort(tcptuple.DstIP, tcptuple.DstPort)
+	}
+	tuple, dir := conn.initiatorView(tcptuple, dir)
+
+	conn.onApplVerID(msg.fields)
+	latency, hasLatency := conn.latency.onMessage(dir, msg)
+	key := newSessionKey(tuple, dir, msg.fields)
+	if key.valid() {
+		fix.identifySession(conn, key)
+	}
+	if tracer.isEnabled() {
+		sender := common.Endpoint{IP: tuple.SrcIP.String(), Port: tuple.SrcPort}
+		receiver := common.Endpoint{IP: tuple.DstIP.String(), Port: tuple.DstPort}
+		if dir == tcp.TCPDirectionReverse {
+			sender, receiver = receiver, sender
+		}
+		tracer.trace(msg.ts, endpointName(sender), endpointName(receiver),
+			fix.dictionary(conn, msg.fields), msg.fields)
+	}
+	if !fix.filter.accept(msg.fields) {
+		// filtered messages still update the session state below
+		filteredMessages.Add(1)
+	} else if sampleRate, sampled := fix.sampler.sample(msg.fields); !sampled {
+		droppedBySampling.Add(1)
+	} else if !fix.limiter.allow(msg.fields, msg.ts) {
+		rateLimitedMessages.Add(1)
+	} else if duplicateOf, isDuplicate := fix.dedup.check(originName(key), msg); isDuplicate && fix.dedup.drop {
+		// the execution has been published for another session
+		duplicateExecutions.Add(1)
+	} else {
+		event := fix.newEvent(conn, msg.ts, msg.fields)
+		fix.addRaw(event, msg)
+		if key.valid() {
+			event["fix"].(common.MapStr)["session_key"] = key.String()
+			conn.session.addIdentity(event["fix"].(common.MapStr))
+		}
+		if tenant := fix.tenants.lookup(key, msg.fields); tenant != "" {
+			event["fix"].(common.MapStr)["tenant"] = tenant
+		}
+		if fix.documentID != "" {
+			event["fix"].(common.MapStr)["document_id"] = documentID(fix.documentID, key, dir, msg)
+		}
+		if isDuplicate {
+			duplicateExecutions.Add(1)
+			event["fix"].(common.MapStr)["duplicate_of"] = duplicateOf
+		}
+		if sampleRate > 0 {
+			event["fix"].(common.MapStr)["sample_rate"] = sampleRate
+		}
+		if hasLatency {
+			event["fix"].(common.MapStr)["latency_us"] = int64(latency / time.Microsecond)
+		}
+		src := &common.Endpoint{IP: tuple.SrcIP.String(), Port: tuple.SrcPort}
+		dst := &common.Endpoint{IP: tuple.DstIP.String(), Port: tuple.DstPort}
+		senderIP, receiverIP := tuple.SrcIP, tuple.DstIP
+		if dir == tcp.TCPDirectionReverse {
+			src, dst = dst, src
+			senderIP, receiverIP = receiverIP, senderIP
+		}
+		event["src"] = src
+		event["dst"] = dst
+		if direction, ok := fix.ourSide.direction(msg.fields, senderIP, receiverIP); ok {
+			event["fix"].(common.MapStr)["direction"] = direction
+		}
+		if isRetransmission(msg) {
+			event["fix"].(common.MapStr)["retransmission"] = true
+			if fix.publishRetransmission(conn) {
+				fix.results.publishMessage(event, msg)
+			} else {
+				droppedRetransmissions.Add(1)
+			}
+		} else {
+			fix.results.publishMessage(event, msg)
+		}
+	}
+	messagesDecoded.Add(1)
+	for _, ev := range conn.session.checkHeartbeats(dir, msg.ts, fix.heartbeatTolerance) {
+		fix.publishSessionEvent(conn, ev)
+	}
+	open := conn.session.state != sessionStateClosed
+	for _, ev := range conn.session.onMessage(tuple, dir, msg) {
+		fix.publishSessionEvent(conn, ev)
+	}
+	sessionMessages.Add(conn.session.key.String(), 1)
+	countSessionMessage(conn.session.key.String(), msg)
+	if stats := conn.stats.onMessage(dir, msg, fix.statsInterval); stats != nil {
+		fix.publishStatsEvent(conn, stats)
+	}
+	if open && conn.session.state == sessionStateClosed {
+		// the last period of a session logged out ends with the Logout
+		if stats := conn.stats.flush(); stats != nil {
+			fix.publishStatsEvent(conn, stats)
+		}
+	}
+	if summary := fix.limiter.summary(msg.fields, msg.ts); summary != nil {
+		s := &conn.session
+		fix.publishRateLimitEvent(summary, s.key.src, s.key.dst,
+			s.eventFields("rate_limit", summary.fields()))
+	}
+	if summary := conn.fills.onMessage(dir, msg); summary != nil {
+		fix.publishOrderEvent(conn, msg, summary)
+	}
+	for _, summary := range conn.rfqs.onMessage(dir, msg, fix.rfqTimeout) {
+		fix.publishRFQEvent(conn, summary)
+	}
+	if reject := conn.rejects.onMessage(dir, msg); reject != nil {
+		fix.publishRejectEvent(conn, msg, reject)
+	}
+	for _, gap := range conn.sequences.onMessage(dir, msg) {
+		fix.publishGapEvent(conn, gap)
+	}
+	sessionKey := ""
+	if key.valid() {
+		sessionKey = key.String()
+	}
+	for _, snap := range fix.books.onMessage(msg, key.src, key.dst, sessionKey) {
+		fix.publishBookEvent(snap)
+	}
+}
+
+// identifySession names the session of a connection after the configured
+// session matching key, or flags it as unknown. Sessions are looked up again
+// on every message, so that reloaded configs apply to open connections.
+func (fix *fixPlugin) identifySession(conn *fixConnectionData, key sessionKey) {
+	s := &conn.session
+	name, known := fix.sessions.lookup(key)
+	if !known && !s.unknown {
+		unknownSessions.Add(1)
+		logp.Warn("Unknown FIX session %s between %s and %s",
+			key, endpointName(key.src), endpointName(key.dst))
+	}
+	s.name, s.unknown = name, !known
+	s.tenant = fix.tenants.lookup(key, nil)
+}
+
+// decrypt returns the application data of TLS connections, detected by their
+// first record. Data of plain connections is returned as is. Connections
+// failing to decrypt are not parsed any further.
+func (fix *fixPlugin) decrypt(
+	conn *fixConnectionData,
+	tcptuple *common.TCPTuple,
+	dir uint8,
+	data []byte,
+) ([]byte, bool) {
+	if conn.tls == nil {
+		if !tlsdecrypt.IsRecord(data) {
+			return data, true
+		}
+		conn.tls = fix.tlsKeys.NewSession()
+		tlsSessions.Add(1)
+	}
+
+	plaintext, err := conn.tls.Process(dir, data)
+	if err != nil {
+		if !conn.tlsFailed {
+			conn.tlsFailed = true
+			tlsErrors.Add(1)
+			logp.Warn("Failed to decrypt FIX over TLS connection %s: %v", tcptuple, err)
+		}
+		return nil, false
+	}
+	return plaintext, true
+}
+
+func newStream(tcptuple *common.TCPTuple) *stream {
+	s := &stream{
+		tcptuple: tcptuple,
+	}
+	s.Stream.Init(tcp.TCPMaxDataInStream)
+	return s
+}
+
+// newEvent decodes all fields of a message using the dictionary matching the
+// message its FIX version. Tags are renamed and converted as configured by
+// fields_mapping, and names unsafe for Elasticsearch mappings are sanitized.
+func (fix *fixPlugin) newEvent(
+	conn *fixConnectionData,
+	ts time.Time,
+	fields tagValues,
+) common.MapStr {
+	beginString, _ := fields.get(tagBeginString)
+	msgType, _ := fields.get(tagMsgType)
+
+	applVerID := conn.applVerID(fields)
+	dict := fix.dictionary(conn, fields)
+	decoded := common.MapStr{
+		"version":  beginString,
+		"msg_type": dict.enum(tagMsgType, msgType),
+	}
+	if conn.sbe != nil {
+		decoded["version"] = conn.sbe.msg.schema.semanticVersion
+		decoded["sbe"] = conn.sbe.fields()
+	}
+	if version, ok := applVersion(beginString, applVerID); ok {
+		decoded["appl_version"] = version
+	}
+	if conn.fixml != nil {
+		decoded["version"] = "FIXML"
+		decoded["fixml"] = conn.fixml.fields()
+		if version, ok := conn.fixml.applVersion(); ok {
+			decoded["appl_version"] = version
+		}
+	}
+	if conn.tls != nil {
+		decoded["tls"] = common.MapStr{
+			"version":      conn.tls.Version(),
+			"cipher_suite": conn.tls.CipherSuite(),
+		}
+	}
+	fix.decodeFields(dict, msgType, nil, fields, decoded)
+	decoded["time"] = messageTimes(ts, fields)
+	if fix.fixmlXMLData && conn.fixml == nil {
+		if xmlData, ok := fields.get(tagXMLData); ok {
+			if data := fix.decodeXMLData(conn, xmlData); data != nil {
+				decoded["xml_data"] = data
+			}
+		}
+	}
+
+	timestamp := common.Time(ts)
+	if fix.useSendingTime {
+		// SendingTime is looked up by tag, as it might be renamed or dropped
+		if v, ok := fields.get(tagSendingTime); ok {
+			_, value, _ := dict.decode(tagSendingTime, v)
+			if sendingTime, ok := value.(preciseTime); ok {
+				decoded["capture_time"] = preciseTime(ts)
+				timestamp = common.Time(sendingTime)
+			}
+		}
+	}
+
+	return common.MapStr{
+		"@timestamp": timestamp,
+		"type":       "fix",
+		"fix":        decoded,
+	}
+}
 
-    event := common.MapStr{}
+// addRaw adds the raw message to the event. If tags are masked, the raw
+// message is encoded again from the masked fields, not to publish the values
+// masked.
+func (fix *fixPlugin) addRaw(event common.MapStr, msg *message) {
+	if !fix.rawText && !fix.rawBase64 {
+		return
+	}
 
-    event["@timestamp"] = common.Time(pkt.Ts)
+	raw := msg.raw
+	if fix.masker != nil {
+		raw = msg.fields.encode(soh)
+	}
 
-    event["type"] = "fix"
+	decoded := event["fix"].(common.MapStr)
+	if fix.rawText {
+		decoded["raw"] = string(bytes.Replace(raw, []byte{soh}, []byte{'|'}, -1))
+	}
+	if fix.rawBase64 {
+		decoded["raw_base64"] = base64.StdEncoding.EncodeToString(raw)
+	}
+}
+
+// dictionary returns the dictionary to decode a message with, extended by the
+// custom dictionary configured for the session or port.
+func (fix *fixPlugin) dictionary(conn *fixConnectionData, fields tagValues) *dictionary {
+	if conn.sbe != nil {
+		return conn.sbe.msg.dict
+	}
+	if conn.fixml != nil {
+		return fix.dictionaries.lookup(fixmlDictionary, conn.ports, fields)
+	}
+	beginString, _ := fields.get(tagBeginString)
+	dict := lookupDictionary(beginString, conn.applVerID(fields))
+	return fix.dictionaries.lookup(dict, conn.ports, fields)
+}
+
+// onApplVerID keeps the DefaultApplVerID negotiated at Logon, used to decode
+// messages without ApplVerID. Sessions whose Logon has not been captured
+// default to the first ApplVerID seen instead.
+func (conn *fixConnectionData) onApplVerID(fields tagValues) {
+	if msgType, _ := fields.get(tagMsgType); msgType != msgTypeLogon {
+		inferred := conn.session.inferred || !conn.session.hasKey
+		if applVerID, ok := fields.get(tagApplVerID); ok && inferred && conn.defaultApplVerID == "" {
+			conn.defaultApplVerID = applVerID
+		}
+		return
+	}
+	if applVerID, ok := fields.get(tagDefaultApplVerID); ok {
+		conn.defaultApplVerID = applVerID
+	}
+}
+
+// initiatorView returns the tuple and direction of a message from the point of
+// view of the session initiator, which is the original direction of the TCP
+// connection unless the connection has been captured reversed.
+func (conn *fixConnectionData) initiatorView(
+	tuple *common.TCPTuple,
+	dir uint8,
+) (*common.TCPTuple, uint8) {
+	if !conn.reversed {
+		return tuple, dir
+	}
+	if conn.initiatorTuple == nil {
+		conn.initiatorTuple = &common.TCPTuple{
+			IPLength: tuple.IPLength,
+			SrcIP:    tuple.DstIP,
+			DstIP:    tuple.SrcIP,
+			SrcPort:  tuple.DstPort,
+			DstPort:  tuple.SrcPort,
+			StreamID: tuple.StreamID,
+		}
+		conn.initiatorTuple.ComputeHashebles()
+	}
+	return conn.initiatorTuple, 1 - dir
+}
+
+// isServerPort checks the port of ip is one of the configured ports or port
+// ranges FIX acceptors listen on, or the port of an acceptor detected.
+func (fix *fixPlugin) isServerPort(ip net.IP, port uint16) bool {
+	for _, p := range fix.ports {
+		if p == int(port) {
+			return true
+		}
+	}
+	for _, r := range fix.portRanges {
+		if r.Contains(ip, port) {
+			return true
+		}
+	}
+	return fix.detectedServers.contains(ip, port)
+}
+
+// applVerID returns the ApplVerID of a message, defaulting to the
+// DefaultApplVerID of the session.
+func (conn *fixConnectionData) applVerID(fields tagValues) string {
+	if applVerID, ok := fields.get(tagApplVerID); ok {
+		return applVerID
+	}
+	return conn.defaultApplVerID
+}
 
-    for _, part := range parts {
-        q := strings.Split(part, "=")
-        if len(q) > 1 {
-            key, _ := strconv.Atoi(q[0])
-            value := q[1]
+// isRetransmission checks for the PossDupFlag (43) or PossResend (97) being
+// set, marking messages sent again after a ResendRequest.
+func isRetransmission(msg *message) bool {
+	possDup, _ := msg.fields.get(tagPossDupFlag)
+	possResend, _ := msg.fields.get(tagPossResend)
+	return possDup == "Y" || possResend == "Y"
+}
 
-            field := fixFields[key]
+// publishRetransmission decides if a retransmitted message is published, so
+// replays after a reconnect can be dropped or sampled.
+func (fix *fixPlugin) publishRetransmission(conn *fixConnectionData) bool {
+	n := conn.retransmissions
+	conn.retransmissions++
 
+	switch fix.retransmissions {
+	case "drop":
+		return false
+	case "sample":
+		return n%fix.retransmissionSampleRate == 0
+	}
+	return true
+}
 
-            if field.dtype == "string" {
-                event[field.name] = value
-                //debugf("  %v: %v", field.name, value)
-            }
-            if field.dtype == "int" {
-                castVal, _ := strconv.Atoi(value)
-                event[field.name] = castVal
-                //debugf("  %v: %v", field.name, castVal)
-            }
-            if field.dtype == "float" {
-                castVal, _ := strconv.ParseFloat(value, 64)
-                event[field.name] = castVal
-                //debugf("  %v: %v", field.name, castVal)
-            }
+// publishSessionEvent publishes a change in the session state, together with
+// the session endpoints.
+func (fix *fixPlugin) publishSessionEvent(conn *fixConnectionData, ev sessionEvent) {
+	s := &conn.session
+	fields := s.fields()
+	fields["event"] = ev.name
+	for k, v := range ev.fields {
+		fields[k] = v
+	}
 
-        }
-    }
+	src, dst := s.key.src, s.key.dst
+	fix.results.PublishTransaction(common.MapStr{
+		"@timestamp": common.Time(ev.ts),
+		"type":       "fix",
+		"src":        &src,
+		"dst":        &dst,
+		"fix":        s.eventFields("session", fields),
+	})
+}
 
-    //debugf("}")
+// publishGapEvent publishes a sequence gap or duplicate sequence number.
+func (fix *fixPlugin) publishGapEvent(conn *fixConnectionData, gap *gapEvent) {
+	s := &conn.session
+	src, dst := s.key.src, s.key.dst
+	fix.results.PublishTransaction(common.MapStr{
+		"@timestamp": common.Time(gap.ts),
+		"type":       "fix",
+		"src":        &src,
+		"dst":        &dst,
+		"fix":        s.eventFields("gap", gap.fields(s)),
+	})
+}
 
-    fix.results.PublishTransaction(event)
+// publishResyncEvent publishes the number of bytes skipped before the stream
+// resynchronized on msg, sent by the side skipped from.
+func (fix *fixPlugin) publishResyncEvent(
+	conn *fixConnectionData,
+	tcptuple *common.TCPTuple,
+	dir uint8,
+	msg *message,
+	skipped int,
+) {
+	sender, _ := msg.fields.get(tagSenderCompID)
+	target, _ := msg.fields.get(tagTargetCompID)
 
-    return nil
+	s := &conn.session
+	src := common.Endpoint{IP: tcptuple.SrcIP.String(), Port: tcptuple.SrcPort}
+	dst := common.Endpoint{IP: tcptuple.DstIP.String(), Port: tcptuple.DstPort}
+	if dir == tcp.TCPDirectionReverse {
+		src, dst = dst, src
+	}
+	fix.results.PublishTransaction(common.MapStr{
+		"@timestamp": common.Time(msg.ts),
+		"type":       "fix",
+		"src":        &src,
+		"dst":        &dst,
+		"fix": s.eventFields("resync", common.MapStr{
+			"skipped_bytes":  skipped,
+			"sender_comp_id": sender,
+			"target_comp_id": target,
+		}),
+	})
+}
+
+// publishOrderEvent publishes the fills of an order completed by msg.
+func (fix *fixPlugin) publishOrderEvent(
+	conn *fixConnectionData,
+	msg *message,
+	summary *orderSummary,
+) {
+	dict := fix.dictionary(conn, msg.fields)
+
+	s := &conn.session
+	order := summary.fields(dict)
+	order["sender_comp_id"] = s.key.senderCompID
+	order["target_comp_id"] = s.key.targetCompID
+
+	src, dst := s.key.src, s.key.dst
+	fix.results.PublishTransaction(common.MapStr{
+		"@timestamp": common.Time(summary.ts),
+		"type":       "fix",
+		"src":        &src,
+		"dst":        &dst,
+		"fix":        s.eventFields("order", order),
+	})
+}
+
+// publishRFQEvent publishes the quotes and outcome of an RFQ.
+func (fix *fixPlugin) publishRFQEvent(conn *fixConnectionData, summary *rfqSummary) {
+	s := &conn.session
+	fields := summary.fields()
+	fields["sender_comp_id"] = s.key.senderCompID
+	fields["target_comp_id"] = s.key.targetCompID
+
+	src, dst := s.key.src, s.key.dst
+	fix.results.PublishTransaction(common.MapStr{
+		"@timestamp": common.Time(summary.ts),
+		"type":       "fix",
+		"src":        &src,
+		"dst":        &dst,
+		"fix":        s.eventFields("rfq", fields),
+	})
+}
+
+// publishRejectEvent publishes a rejected message, together with the key
+// fields of the message rejected.
+func (fix *fixPlugin) publishRejectEvent(
+	conn *fixConnectionData,
+	msg *message,
+	reject *rejectEvent,
+) {
+	dict := fix.dictionary(conn, msg.fields)
+
+	s := &conn.session
+	fields := reject.fields(dict)
+	fields["sender_comp_id"] = s.key.senderCompID
+	fields["target_comp_id"] = s.key.targetCompID
+
+	src, dst := s.key.src, s.key.dst
+	fix.results.PublishTransaction(common.MapStr{
+		"@timestamp": common.Time(reject.ts),
+		"type":       "fix",
+		"src":        &src,
+		"dst":        &dst,
+		"fix":        s.eventFields("reject", fields),
+	})
+}
+
+// publishStatsEvent publishes the message counts of a session over a period,
+// timestamped with the start of the period.
+func (fix *fixPlugin) publishStatsEvent(conn *fixConnectionData, stats *sessionStats) {
+	s := &conn.session
+	fields := stats.fields(fix.statsInterval)
+	fields["sender_comp_id"] = s.key.senderCompID
+	fields["target_comp_id"] = s.key.targetCompID
+
+	src, dst := s.key.src, s.key.dst
+	fix.results.PublishTransaction(common.MapStr{
+		"@timestamp": common.Time(stats.start),
+		"type":       "fix",
+		"src":        &src,
+		"dst":        &dst,
+		"fix":        s.eventFields("stats", fields),
+	})
+}
+
+// publishRateLimitEvent publishes the summary of the messages of a session
+// dropped by the rate limits, timestamped with the first message dropped.
+// fields holds the fix fields of the event.
+func (fix *fixPlugin) publishRateLimitEvent(
+	summary *rateLimitSummary,
+	src, dst common.Endpoint,
+	fields common.MapStr,
+) {
+	fix.results.PublishTransaction(common.MapStr{
+		"@timestamp": common.Time(summary.first),
+		"type":       "fix",
+		"src":        &src,
+		"dst":        &dst,
+		"fix":        fields,
+	})
+}
+
+// publishBookEvent publishes the top of the book of a symbol, from the
+// endpoints and session of its last update.
+func (fix *fixPlugin) publishBookEvent(snap *bookSnapshot) {
+	event := common.MapStr{"book": snap.fields(fix.bookConfig.Interval)}
+	if snap.sessionKey != "" {
+		event["session_key"] = snap.sessionKey
+	}
+
+	src, dst := snap.src, snap.dst
+	fix.results.PublishTransaction(common.MapStr{
+		"@timestamp": common.Time(snap.ts),
+		"type":       "fix",
+		"src":        &src,
+		"dst":        &dst,
+		"fix":        event,
+	})
 }
 
 func (fix *fixPlugin) GapInStream(tcptuple *common.TCPTuple, dir uint8,
-    nbytes int, private protos.ProtocolData) (priv protos.ProtocolData, drop bool) {
+	nbytes int, private protos.ProtocolData) (priv protos.ProtocolData, drop bool) {
+
+	defer logp.Recover("GapInStream(fix) exception")
+
+	conn := ensureFixConnection(private)
 
-    //defer logp.Recover("GapInStream(fix) exception")
+	// A message spanning the gap can not be recovered. Drop buffered data of
+	// the affected direction only, keeping the session state.
+	if isDebug {
+		debugf("gap in stream (dir=%v, nbytes=%v), dropping buffered data", dir, nbytes)
+	}
+	fix.reassembly.finished(conn, dir)
+	if conn.tls != nil {
+		conn.tls.Gap(dir)
+	}
 
-    return private, true
+	// Messages lost by the capture are not sequence gaps of the session
+	conn.sequences.reset(dir)
+	return conn, false
 }
 
 func (fix *fixPlugin) ReceivedFin(tcptuple *common.TCPTuple, dir uint8,
-    private protos.ProtocolData) protos.ProtocolData {
+	private protos.ProtocolData) protos.ProtocolData {
 
-    // TODO: check if we have data pending and either drop it to free
-    // memory or send it up the stack.
-    return private
+	defer logp.Recover("ReceivedFin(fix) exception")
+
+	if private == nil {
+		return private
+	}
+
+	// Incomplete messages can not be published. Pending data is dropped with
+	// the connection.
+	conn := ensureFixConnection(private)
+	ts := conn.closeTime()
+	fix.reassembly.finished(conn, dir)
+	for _, gap := range conn.sequences.flush() {
+		fix.publishGapEvent(conn, gap)
+	}
+	for _, summary := range conn.rfqs.flush(ts) {
+		fix.publishRFQEvent(conn, summary)
+	}
+	if stats := conn.stats.flush(); stats != nil {
+		fix.publishStatsEvent(conn, stats)
+	}
+	if s := &conn.session; s.hasKey {
+		for _, summary := range fix.limiter.flush(s.key) {
+			fix.publishRateLimitEvent(summary, s.key.src, s.key.dst,
+				s.eventFields("rate_limit", summary.fields()))
+		}
+	}
+	for _, ev := range conn.slowConsumers.flush() {
+		fix.publishSlowConsumerEvent(conn, tcptuple, ev)
+	}
+	for _, ev := range conn.session.onClose(ts) {
+		fix.publishSessionEvent(conn, ev)
+	}
+	return conn
 }
 
+// Expired ends a connection idle for longer than the transaction timeout like
+// a connection closed, publishing the stats of the last period and the
+// session terminated.
+func (fix *fixPlugin) Expired(tcptuple *common.TCPTuple, private protos.ProtocolData) {
+	defer logp.Recover("Expired(fix) exception")
+
+	if private == nil {
+		return
+	}
+	fix.ReceivedFin(tcptuple, tcp.TCPDirectionOriginal, private)
+	fix.ReceivedFin(tcptuple, tcp.TCPDirectionReverse, private)
+}
+
+// closeTime returns the capture time of the segment closing the connection,
+// observed last, or the current time if no segment has been observed.
+func (conn *fixConnectionData) closeTime() time.Time {
+	if conn.lastSegment.IsZero() {
+		return time.Now()
+	}
+	return conn.lastSegment
+}
+
+// Flush publishes the sequence gaps, the open RFQs as expired and the stats
+// of the current period pending on shutdown. The session is not reported as
+// terminated, as the connection is still open.
+func (fix *fixPlugin) Flush(tcptuple *common.TCPTuple,
+	private protos.ProtocolData) protos.ProtocolData {
+
+	defer logp.Recover("Flush(fix) exception")
+
+	if private == nil {
+		return private
+	}
+
+	conn := ensureFixConnection(private)
+	for _, gap := range conn.sequences.flush() {
+		fix.publishGapEvent(conn, gap)
+	}
+	for _, summary := range conn.rfqs.flush(conn.closeTime()) {
+		fix.publishRFQEvent(conn, summary)
+	}
+	if stats := conn.stats.flush(); stats != nil {
+		fix.publishStatsEvent(conn, stats)
+	}
+	for _, ev := range conn.slowConsumers.flush() {
+		fix.publishSlowConsumerEvent(conn, tcptuple, ev)
+	}
+	return conn
+}
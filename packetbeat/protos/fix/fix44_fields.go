@@ -0,0 +1,165 @@
+package fix
+
+// Tags added or redefined by FIX 4.3 and FIX 4.4. Quantities became
+// decimal values with FIX 4.3, so the quantity tags are redefined as floats.
+var fix44Fields map[int]typeBlock = map[int]typeBlock{
+	14:  typeBlock{name: "CumQty", dtype: "float"},
+	32:  typeBlock{name: "LastQty", dtype: "float"},
+	38:  typeBlock{name: "OrderQty", dtype: "float"},
+	53:  typeBlock{name: "Quantity", dtype: "float"},
+	134: typeBlock{name: "BidSize", dtype: "float"},
+	135: typeBlock{name: "OfferSize", dtype: "float"},
+	151: typeBlock{name: "LeavesQty", dtype: "float"},
+	447: typeBlock{name: "PartyIDSource", dtype: "string"},
+	448: typeBlock{name: "PartyID", dtype: "string"},
+	452: typeBlock{name: "PartyRole", dtype: "int"},
+	453: typeBlock{name: "NoPartyIDs", dtype: "int"},
+	460: typeBlock{name: "Product", dtype: "int"},
+	461: typeBlock{name: "CFICode", dtype: "string"},
+	462: typeBlock{name: "UnderlyingProduct", dtype: "int"},
+	463: typeBlock{name: "UnderlyingCFICode", dtype: "string"},
+	527: typeBlock{name: "SecondaryExecID", dtype: "string"},
+	528: typeBlock{name: "OrderCapacity", dtype: "string"},
+	529: typeBlock{name: "OrderRestrictions", dtype: "string"},
+	537: typeBlock{name: "QuoteType", dtype: "string"},
+	541: typeBlock{name: "MaturityDate", dtype: "string"},
+	542: typeBlock{name: "UnderlyingMaturityDate", dtype: "string"},
+	552: typeBlock{name: "NoSides", dtype: "int"},
+	553: typeBlock{name: "Username", dtype: "string"},
+	554: typeBlock{name: "Password", dtype: "string"},
+	555: typeBlock{name: "NoLegs", dtype: "int"},
+	581: typeBlock{name: "AccountType", dtype: "int"},
+	600: typeBlock{name: "LegSymbol", dtype: "string"},
+	625: typeBlock{name: "TradingSessionSubID", dtype: "string"},
+	631: typeBlock{name: "MidPx", dtype: "float"},
+	632: typeBlock{name: "BidYield", dtype: "float"},
+	633: typeBlock{name: "MidYield", dtype: "float"},
+	634: typeBlock{name: "OfferYield", dtype: "float"},
+	636: typeBlock{name: "WorkingIndicator", dtype: "string"},
+	640: typeBlock{name: "Price2", dtype: "float"},
+	642: typeBlock{name: "BidForwardPoints2", dtype: "float"},
+	643: typeBlock{name: "OfferForwardPoints2", dtype: "float"},
+	660: typeBlock{name: "AcctIDSource", dtype: "int"},
+	693: typeBlock{name: "QuoteRespID", dtype: "string"},
+	694: typeBlock{name: "QuoteRespType", dtype: "int"},
+	762: typeBlock{name: "SecuritySubType", dtype: "string"},
+	789: typeBlock{name: "NextExpectedMsgSeqNum", dtype: "int"},
+	797: typeBlock{name: "CopyMsgIndicator", dtype: "string"},
+	828: typeBlock{name: "TrdType", dtype: "int"},
+	851: typeBlock{name: "LastLiquidityInd", dtype: "int"},
+	880: typeBlock{name: "TrdMatchID", dtype: "string"},
+	893: typeBlock{name: "LastFragment", dtype: "string"},
+	923: typeBlock{name: "UserRequestID", dtype: "string"},
+	924: typeBlock{name: "UserRequestType", dtype: "int"},
+	926: typeBlock{name: "UserStatus", dtype: "int"},
+}
+
+var fix44MsgTypes map[string]string = map[string]string{
+	"n":  "XML message",
+	"o":  "Registration Instructions",
+	"p":  "Registration Instructions Response",
+	"q":  "Order Mass Cancel Request",
+	"r":  "Order Mass Cancel Report",
+	"s":  "New Order - Cross",
+	"x":  "Security List Request",
+	"y":  "Security List",
+	"AB": "New Order - Multileg",
+	"AC": "Multileg Order Cancel Replace",
+	"AD": "Trade Capture Report Request",
+	"AE": "Trade Capture Report",
+	"AF": "Order Mass Status Request",
+	"AG": "Quote Request Reject",
+	"AI": "Quote Status Report",
+	"AJ": "Quote Response",
+	"AK": "Confirmation",
+	"AL": "Position Maintenance Request",
+	"AM": "Position Maintenance Report",
+	"AN": "Request For Positions",
+	"AO": "Request For Positions Ack",
+	"AP": "Position Report",
+	"AQ": "Trade Capture Report Request Ack",
+	"AR": "Trade Capture Report Ack",
+	"AS": "Allocation Report",
+	"AT": "Allocation Report Ack",
+	"AU": "Confirmation Ack",
+	"AV": "Settlement Instruction Request",
+	"AW": "Assignment Report",
+	"AX": "Collateral Request",
+	"AY": "Collateral Assignment",
+	"AZ": "Collateral Response",
+	"BA": "Collateral Report",
+	"BB": "Collateral Inquiry",
+	"BC": "Network Counterparty System Status Request",
+	"BD": "Network Counterparty System Status Response",
+	"BE": "User Request",
+	"BF": "User Response",
+}
+
+// ExecType values 1 (Partial fill) and 2 (Fill) were replaced by F (Trade)
+// with FIX 4.3.
+var fix44ExecTypes map[string]string = map[string]string{
+	"0": "New",
+	"3": "Done for day",
+	"4": "Canceled",
+	"5": "Replace",
+	"6": "Pending Cancel",
+	"7": "Stopped",
+	"8": "Rejected",
+	"9": "Suspended",
+	"A": "Pending New",
+	"B": "Calculated",
+	"C": "Expired",
+	"D": "Restated",
+	"E": "Pending Replace",
+	"F": "Trade",
+	"G": "Trade Correct",
+	"H": "Trade Cancel",
+	"I": "Order Status",
+}
+
+var fix44Sides map[string]string = map[string]string{
+	"A": "Cross short exempt",
+	"B": "As Defined",
+	"C": "Opposite",
+	"D": "Subscribe",
+	"E": "Redeem",
+	"F": "Lend",
+	"G": "Borrow",
+}
+
+var fix44OrdTypes map[string]string = map[string]string{
+	"J": "Market If Touched",
+	"K": "Market With Left Over as Limit",
+	"L": "Previous Fund Valuation Point",
+	"M": "Next Fund Valuation Point",
+}
+
+var fix44TimeInForces map[string]string = map[string]string{
+	"7": "At the Close",
+}
+
+var fix44SessionRejectReasons map[string]string = map[string]string{
+	"12": "XML Validation error",
+	"13": "Tag appears more than once",
+	"14": "Tag specified out of required order",
+	"15": "Repeating group fields out of order",
+	"16": "Incorrect NumInGroup count for repeating group",
+	"17": "Non data value includes field delimiter (SOH character)",
+	"99": "Other",
+}
+
+var fix44BusinessRejectReasons map[string]string = map[string]string{
+	"6": "Not authorized",
+	"7": "DeliverTo firm not available at this time",
+}
+
+var fix44QuoteCancelTypes map[string]string = map[string]string{
+	"5": "Cancel quote specified in QuoteID",
+}
+
+var fix44QuoteTypes map[string]string = map[string]string{
+	"0": "Indicative",
+	"1": "Tradeable",
+	"2": "Restricted Tradeable",
+	"3": "Counter",
+}
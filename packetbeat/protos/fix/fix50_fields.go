@@ -0,0 +1,47 @@
+package fix
+
+// Tags added by FIX 5.0 and the FIXT.1.1 transport.
+var fix50Fields map[int]typeBlock = map[int]typeBlock{
+	1003: typeBlock{name: "TradeID", dtype: "string"},
+	1028: typeBlock{name: "ManualOrderIndicator", dtype: "string"},
+	1057: typeBlock{name: "AggressorIndicator", dtype: "string"},
+	1128: typeBlock{name: "ApplVerID", dtype: "string"},
+	1129: typeBlock{name: "CstmApplVerID", dtype: "string"},
+	1130: typeBlock{name: "RefApplVerID", dtype: "string"},
+	1131: typeBlock{name: "RefCstmApplVerID", dtype: "string"},
+	1137: typeBlock{name: "DefaultApplVerID", dtype: "string"},
+	1138: typeBlock{name: "DisplayQty", dtype: "float"},
+	1156: typeBlock{name: "ApplExtID", dtype: "int"},
+	1180: typeBlock{name: "ApplID", dtype: "string"},
+	1181: typeBlock{name: "ApplSeqNum", dtype: "int"},
+	1300: typeBlock{name: "MarketSegmentID", dtype: "string"},
+	1301: typeBlock{name: "MarketID", dtype: "string"},
+	1350: typeBlock{name: "ApplLastSeqNum", dtype: "int"},
+}
+
+var fix50MsgTypes map[string]string = map[string]string{
+	"BG": "Collateral Inquiry Ack",
+	"BH": "Confirmation Request",
+	"BI": "Trading Session List Request",
+	"BJ": "Trading Session List",
+	"BK": "Security List Update Report",
+	"BL": "Adjusted Position Report",
+	"BM": "Allocation Instruction Alert",
+	"BN": "Execution Acknowledgement",
+	"BO": "Contrary Intention Report",
+	"BP": "Security Definition Update Report",
+}
+
+var fix50ExecTypes map[string]string = map[string]string{
+	"J": "Trade in a Clearing Hold",
+	"K": "Trade has been released to Clearing",
+	"L": "Triggered or Activated by System",
+}
+
+var fix50SessionRejectReasons map[string]string = map[string]string{
+	"18": "Invalid/Unsupported Application Version",
+}
+
+var fix50BusinessRejectReasons map[string]string = map[string]string{
+	"18": "Invalid price increment",
+}
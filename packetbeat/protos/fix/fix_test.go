@@ -2,5 +2,455 @@
 
 package fix
 
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/packetbeat/protos"
+	"github.com/elastic/beats/packetbeat/publish"
+)
+
+var _ protos.TCPFlusher = &fixPlugin{}
+var _ protos.TCPExpirer = &fixPlugin{}
+
+// fixModForTests returns a plugin initialized with the default
+// configuration, changed by configure if given.
+func fixModForTests(configure ...func(*fixConfig)) (*fixPlugin, *publish.ChanTransactions) {
+	var fix fixPlugin
+	results := &publish.ChanTransactions{Channel: make(chan common.MapStr, 10)}
+	config := defaultConfig
+	for _, f := range configure {
+		f(&config)
+	}
+	fix.init(results, &config)
+	return &fix, results
+}
+
+// fixMessage builds a framed tag=value message from a '|' delimited string
+// holding the BeginString and body fields. BodyLength and CheckSum are added.
+func fixMessage(s string) []byte {
+	s = strings.Replace(s, "|", string(soh), -1)
+	i := strings.IndexByte(s, soh) + 1
+	begin, body := s[:i], s[i:]
+	msg := fmt.Sprintf("%s9=%d%c%s", begin, len(body), soh, body)
+	return []byte(fmt.Sprintf("%s10=%03d%c", msg, checksum([]byte(msg)), soh))
+}
+
+func parseMessages(fix *fixPlugin, msgs ...string) protos.ProtocolData {
+	var private protos.ProtocolData
+	for _, msg := range msgs {
+		pkt := &protos.Packet{Ts: time.Now(), Payload: fixMessage(msg)}
+		private = fix.Parse(pkt, &common.TCPTuple{}, 0, private)
+	}
+	return private
+}
+
+func expectEvent(t *testing.T, results *publish.ChanTransactions) common.MapStr {
+	select {
+	case event := <-results.Channel:
+		return event
+	default:
+		t.Fatal("no event published")
+		return nil
+	}
+}
+
+// nextFixEvent skips the events without key in fix, returning the next
+// event holding it.
+func nextFixEvent(t *testing.T, results *publish.ChanTransactions, key string) common.MapStr {
+	for len(results.Channel) > 0 {
+		event := expectEvent(t, results)
+		if _, ok := event["fix"].(common.MapStr)[key]; ok {
+			return event
+		}
+	}
+	t.Fatalf("no %v event published", key)
+	return nil
+}
+
+// expectFixEvent skips the events without key in fix, returning the value
+// of key in the next event holding it.
+func expectFixEvent(t *testing.T, results *publish.ChanTransactions, key string) common.MapStr {
+	event := nextFixEvent(t, results, key)
+	return event["fix"].(common.MapStr)[key].(common.MapStr)
+}
+
+func TestSplitFields(t *testing.T) {
+	fields := splitFields([]byte(strings.Replace("8=FIX.4.2|9=5|35=0|bogus|=1|x=2|58=a=b|", "|", string(soh), -1)))
+
+	assert.Equal(t, tagValues{
+		{tag: 8, value: "FIX.4.2"},
+		{tag: 9, value: "5"},
+		{tag: 35, value: "0"},
+		{tag: 58, value: "a=b"},
+	}, fields)
+}
+
+func TestLookupDictionary(t *testing.T) {
+	assert.Equal(t, fix42Dictionary, lookupDictionary("FIX.4.2", ""))
+	assert.Equal(t, fix44Dictionary, lookupDictionary("FIX.4.4", ""))
+	assert.Equal(t, fix44Dictionary, lookupDictionary("FIXT.1.1", "6"))
+	assert.Equal(t, fix50Dictionary, lookupDictionary("FIXT.1.1", "9"))
+	assert.Equal(t, fix50Dictionary, lookupDictionary("FIXT.1.1", ""))
+}
+
+func TestDictionaryVersionedEnums(t *testing.T) {
+	assert.Equal(t, "Partial Fill", fix42Dictionary.enum(150, "1"))
+	assert.Equal(t, "1", fix44Dictionary.enum(150, "1"))
+	assert.Equal(t, "Trade", fix44Dictionary.enum(150, "F"))
+	assert.Equal(t, "Triggered or Activated by System", fix50Dictionary.enum(150, "L"))
+	assert.Equal(t, "Trade Capture Report", fix50Dictionary.enum(35, "AE"))
+	assert.Equal(t, "AE", fix42Dictionary.enum(35, "AE"))
+}
+
+func TestDictionaryDecodeTypes(t *testing.T) {
+	name, value, ok := fix42Dictionary.decode(38, "100")
+	assert.True(t, ok)
+	assert.Equal(t, "OrderQty", name)
+	assert.Equal(t, 100, value)
+
+	name, value, ok = fix44Dictionary.decode(32, "12.5")
+	assert.True(t, ok)
+	assert.Equal(t, "LastQty", name)
+	assert.Equal(t, 12.5, value)
+
+	_, _, ok = fix42Dictionary.decode(34, "abc")
+	assert.False(t, ok)
+
+	_, _, ok = fix42Dictionary.decode(9999, "x")
+	assert.False(t, ok)
+}
+
+func TestParseDecodesByVersion(t *testing.T) {
+	fix, results := fixModForTests()
+
+	parseMessages(fix, "8=FIX.4.4|35=8|34=2|39=2|54=1|150=F|32=10|")
+
+	event := expectEvent(t, results)
+	assert.Equal(t, "fix", event["type"])
+
+	decoded := event["fix"].(common.MapStr)
+	assert.Equal(t, "FIX.4.4", decoded["version"])
+	assert.Equal(t, "FIX.4.4", decoded["appl_version"])
+	assert.Equal(t, "Execution Report", decoded["msg_type"])
+	assert.Equal(t, "8", decoded["MsgType"])
+	assert.Equal(t, "Filled", decoded["OrdStatus"])
+	assert.Equal(t, "Buy", decoded["Side"])
+	assert.Equal(t, "Trade", decoded["ExecType"])
+	assert.Equal(t, 10.0, decoded["LastQty"])
+	assert.Equal(t, 2, decoded["MsgSeqNum"])
+}
+
+func TestParseFIXTUsesNegotiatedApplVerID(t *testing.T) {
+	fix, results := fixModForTests()
+
+	private := parseMessages(fix,
+		"8=FIXT.1.1|35=A|34=1|108=30|1137=6|",
+		"8=FIXT.1.1|35=8|34=2|150=F|",
+		"8=FIXT.1.1|35=8|34=3|1128=9|150=L|")
+
+	assert.Equal(t, "6", private.(*fixConnectionData).defaultApplVerID)
+
+	logon := expectEvent(t, results)["fix"].(common.MapStr)
+	assert.Equal(t, "Logon", logon["msg_type"])
+	assert.Equal(t, 30, logon["HeartBtInt"])
+
+	report := expectEvent(t, results)["fix"].(common.MapStr)
+	assert.Equal(t, "Trade", report["ExecType"])
+	assert.NotContains(t, report, "ApplVerID")
+	assert.Equal(t, "FIXT.1.1", report["version"])
+	assert.Equal(t, "FIX.4.4", report["appl_version"])
+
+	report = expectEvent(t, results)["fix"].(common.MapStr)
+	assert.Equal(t, "Triggered or Activated by System", report["ExecType"])
+	assert.Equal(t, "9", report["ApplVerID"])
+	assert.Equal(t, "FIX.5.0SP2", report["appl_version"])
+}
+
+func TestParseFIXTWithoutLogonInfersApplVerID(t *testing.T) {
+	fix, results := fixModForTests()
+
+	private := parseMessages(fix,
+		"8=FIXT.1.1|35=8|34=20|1128=6|150=F|",
+		"8=FIXT.1.1|35=8|34=21|150=F|")
+
+	assert.Equal(t, "6", private.(*fixConnectionData).defaultApplVerID)
+	for i := 0; i < 2; i++ {
+		report := expectEvent(t, results)["fix"].(common.MapStr)
+		assert.Equal(t, "FIX.4.4", report["appl_version"])
+	}
+}
+
+func TestApplVersion(t *testing.T) {
+	version, ok := applVersion("FIX.4.2", "")
+	assert.True(t, ok)
+	assert.Equal(t, "FIX.4.2", version)
+
+	version, ok = applVersion("FIXT.1.1", "8")
+	assert.True(t, ok)
+	assert.Equal(t, "FIX.5.0SP1", version)
+
+	_, ok = applVersion("FIXT.1.1", "")
+	assert.False(t, ok)
+}
+
+func TestDictionaryDecodeUTCTimestamp(t *testing.T) {
+	name, value, ok := fix42Dictionary.decode(52, "20161014-09:30:01.250")
+	assert.True(t, ok)
+	assert.Equal(t, "SendingTime", name)
+	assert.Equal(t, preciseTime(time.Date(2016, 10, 14, 9, 30, 1, 250e6, time.UTC)), value)
+
+	_, value, ok = fix44Dictionary.decode(60, "20161014-09:30:01")
+	assert.True(t, ok)
+	assert.Equal(t, preciseTime(time.Date(2016, 10, 14, 9, 30, 1, 0, time.UTC)), value)
+
+	// venues stamping to the nanosecond
+	_, value, ok = fix50Dictionary.decode(60, "20161014-09:30:01.123456789")
+	assert.True(t, ok)
+	assert.Equal(t, preciseTime(time.Date(2016, 10, 14, 9, 30, 1, 123456789, time.UTC)), value)
+
+	_, _, ok = fix42Dictionary.decode(52, "yesterday")
+	assert.False(t, ok)
+}
+
+func TestRetransmissions(t *testing.T) {
+	msgs := []string{
+		"8=FIX.4.2|35=D|34=2|11=order-1|",
+		"8=FIX.4.2|35=D|34=2|11=order-1|43=Y|",
+		"8=FIX.4.2|35=D|34=2|11=order-1|43=Y|",
+		"8=FIX.4.2|35=D|34=3|11=order-2|97=Y|",
+	}
+
+	for mode, published := range map[string]int{"publish": 4, "drop": 1, "sample": 3} {
+		fix, results := fixModForTests()
+		fix.retransmissions = mode
+		fix.retransmissionSampleRate = 2
+
+		parseMessages(fix, msgs...)
+
+		assert.Len(t, results.Channel, published, "mode %v", mode)
+		assert.NotContains(t, expectEvent(t, results)["fix"], "retransmission")
+		for len(results.Channel) > 0 {
+			assert.Equal(t, true, expectEvent(t, results)["fix"].(common.MapStr)["retransmission"])
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	config := defaultConfig
+	assert.NoError(t, config.Validate())
+
+	config.Retransmissions = "ignore"
+	assert.Error(t, config.Validate())
+
+	config = defaultConfig
+	config.Timestamp = "transact_time"
+	assert.Error(t, config.Validate())
+}
+
+func TestTimestampFromSendingTime(t *testing.T) {
+	fix, results := fixModForTests()
+	fix.useSendingTime = true
+
+	parseMessages(fix,
+		"8=FIX.4.2|35=0|34=2|52=20161014-09:30:01.250|",
+		"8=FIX.4.2|35=0|34=3|")
+
+	event := expectEvent(t, results)
+	sendingTime := common.Time(time.Date(2016, 10, 14, 9, 30, 1, 250e6, time.UTC))
+	assert.Equal(t, sendingTime, event["@timestamp"])
+	assert.Contains(t, event["fix"], "capture_time")
+
+	// messages without SendingTime keep the capture time
+	event = expectEvent(t, results)
+	assert.NotContains(t, event["fix"], "capture_time")
+}
+
+func TestRawMessage(t *testing.T) {
+	fix, results := fixModForTests()
+	fix.rawText = true
+	fix.rawBase64 = true
+
+	msg := "8=FIX.4.2|35=D|34=2|1=ACC-1|11=order-1|"
+	parseMessages(fix, msg)
+
+	raw := fixMessage(msg)
+	event := expectEvent(t, results)["fix"].(common.MapStr)
+	assert.Equal(t, strings.Replace(string(raw), string(soh), "|", -1), event["raw"])
+	assert.Equal(t, base64.StdEncoding.EncodeToString(raw), event["raw_base64"])
+}
+
+func TestRawMessageMasked(t *testing.T) {
+	fix, results := fixModForTests()
+	fix.rawText = true
+	fix.masker = newMasker([]maskConfig{{Tags: []int{1}, Method: "drop"}})
+
+	parseMessages(fix, "8=FIX.4.2|35=D|34=2|1=ACC-1|11=order-1|")
+
+	event := expectEvent(t, results)["fix"].(common.MapStr)
+	assert.Contains(t, event["raw"], "|11=order-1|")
+	assert.NotContains(t, event["raw"], "ACC-1")
+}
+
+func TestReload(t *testing.T) {
+	fix, _ := fixModForTests()
+	dedup := fix.dedup
+	private := parseMessages(fix, "8=FIX.4.2|35=D|34=2|11=order-1|")
+
+	results := &publish.ChanTransactions{Channel: make(chan common.MapStr, 10)}
+	cfg, _ := common.NewConfigFrom(map[string]interface{}{
+		"ports":           []int{9878},
+		"retransmissions": "drop",
+		"raw.text":        true,
+	})
+	if !assert.NoError(t, fix.Reload(results, cfg)) {
+		return
+	}
+	assert.Equal(t, []int{9878}, fix.GetPorts())
+	assert.Equal(t, "drop", fix.retransmissions)
+	assert.True(t, fix.rawText)
+	assert.True(t, dedup == fix.dedup, "dedup state kept")
+
+	// open sessions publish to the reloaded results
+	pkt := &protos.Packet{Ts: time.Now(), Payload: fixMessage("8=FIX.4.2|35=D|34=3|11=order-2|")}
+	fix.Parse(pkt, &common.TCPTuple{}, 0, private)
+	event := expectEvent(t, results)["fix"].(common.MapStr)
+	assert.Contains(t, event, "raw")
+}
+
+func TestReloadInvalidConfig(t *testing.T) {
+	fix, results := fixModForTests()
+
+	cfg, _ := common.NewConfigFrom(map[string]interface{}{
+		"ports":        []int{9878},
+		"dictionaries": []map[string]interface{}{{"path": "/nonexistent/FIX44.xml"}},
+	})
+	assert.Error(t, fix.Reload(results, cfg))
+	assert.Empty(t, fix.GetPorts())
+
+	cfg, _ = common.NewConfigFrom(map[string]interface{}{"retransmissions": "ignore"})
+	assert.Error(t, fix.Reload(results, cfg))
+	assert.Equal(t, "publish", fix.retransmissions)
+}
+
+func TestParseTLS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile, err := ioutil.TempFile("", "venue.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(keyFile.Name())
+	pem.Encode(keyFile, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	keyFile.Close()
+
+	var fix fixPlugin
+	results := &publish.ChanTransactions{Channel: make(chan common.MapStr, 10)}
+	config := defaultConfig
+	config.TLS.PrivateKeys = []string{keyFile.Name()}
+	if err := fix.init(results, &config); err != nil {
+		t.Fatal(err)
+	}
+
+	// FIX over TLS, the initiator sending a Logon answered by the acceptor
+	logon := fixMessage("8=FIX.4.4|35=A|49=BROKER|56=VENUE|34=1|98=0|108=30|")
+	var private protos.ProtocolData
+	captureTLSSession(t, key, logon, logon, func(dir uint8, data []byte) {
+		pkt := &protos.Packet{Ts: time.Now(), Payload: data}
+		private = fix.Parse(pkt, &common.TCPTuple{}, dir, private)
+	})
+
+	event := expectEvent(t, results)["fix"].(common.MapStr)
+	assert.Equal(t, "Logon", event["msg_type"])
+	assert.Equal(t, common.MapStr{
+		"version":      "TLSv1.2",
+		"cipher_suite": "TLS_RSA_WITH_AES_128_GCM_SHA256",
+	}, event["tls"])
+	expectEvent(t, results)
+}
+
+// captureTLSSession runs a TLS session using RSA key exchange, calling capture
+// with the data written by the client (dir 0) and the server (dir 1).
+func captureTLSSession(
+	t *testing.T,
+	key *rsa.PrivateKey,
+	request, response []byte,
+	capture func(dir uint8, data []byte),
+) {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	suites := []uint16{tls.TLS_RSA_WITH_AES_128_GCM_SHA256}
+
+	var mutex sync.Mutex
+	clientConn, serverConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		defer serverConn.Close()
+		server := tls.Server(&capturedConn{serverConn, 1, &mutex, capture}, &tls.Config{
+			Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+			CipherSuites: suites,
+		})
+		if _, err := io.ReadFull(server, make([]byte, len(request))); err != nil {
+			done <- err
+			return
+		}
+		_, err := server.Write(response)
+		done <- err
+	}()
+
+	client := tls.Client(&capturedConn{clientConn, 0, &mutex, capture}, &tls.Config{
+		InsecureSkipVerify: true,
+		CipherSuites:       suites,
+		MaxVersion:         tls.VersionTLS12,
+	})
+	defer client.Close()
+	if _, err := client.Write(request); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(client, make([]byte, len(response))); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type capturedConn struct {
+	net.Conn
+	dir     uint8
+	mutex   *sync.Mutex
+	capture func(dir uint8, data []byte)
+}
+
+func (c *capturedConn) Write(b []byte) (int, error) {
+	c.mutex.Lock()
+	c.capture(c.dir, append([]byte(nil), b...))
+	c.mutex.Unlock()
+	return c.Conn.Write(b)
+}
@@ -0,0 +1,131 @@
+package fix
+
+import (
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/common/streambuf"
+	"github.com/elastic/beats/libbeat/logp"
+
+	"github.com/elastic/beats/packetbeat/protos"
+)
+
+// ParseUDP publishes the tag=value messages of a datagram, as sent by market
+// data or drop copy feeds over (multicast) UDP. Messages must not span
+// multiple datagrams.
+func (fix *fixPlugin) ParseUDP(pkt *protos.Packet) {
+	defer logp.Recover("ParseUDP(fix) exception")
+
+	if isDebug {
+		debugf("Parsing datagram from %s of length %d.",
+			pkt.Tuple.String(), len(pkt.Payload))
+	}
+
+	// UDP feeds have no session, so no ApplVerID is negotiated
+	conn := &fixConnectionData{
+		ports: [2]uint16{pkt.Tuple.SrcPort, pkt.Tuple.DstPort},
+	}
+	src := &common.Endpoint{IP: pkt.Tuple.SrcIP.String(), Port: pkt.Tuple.SrcPort}
+	dst := &common.Endpoint{IP: pkt.Tuple.DstIP.String(), Port: pkt.Tuple.DstPort}
+	if sbe := fix.sbe.lookup(conn.ports); sbe != nil {
+		fix.parseSBEDatagram(conn, sbe, pkt, src, dst)
+		return
+	}
+	if fix.isFIXMLPort(conn.ports) {
+		fix.parseFIXMLDatagram(conn, pkt, src, dst)
+		return
+	}
+
+	buf := streambuf.New(pkt.Payload)
+	for buf.Len() > 0 {
+		p := parser{message: &message{ts: pkt.Ts}}
+		ok, complete := p.parse(buf)
+		if !ok || !complete {
+			parseErrors.Add(1)
+			if isDebug {
+				debugf("Ignore %v bytes of datagram not being a complete FIX message",
+					buf.Len())
+			}
+			return
+		}
+
+		msg := p.message
+		msg.fields = fix.masker.apply(msg.fields)
+		if !msg.checksumValid {
+			invalidChecksums.Add(1)
+			if isDebug {
+				debugf("Ignore FIX message with invalid CheckSum: %q", msg.raw)
+			}
+			continue
+		}
+
+		fix.onDatagramMessage(conn, pkt, src, dst, msg)
+	}
+}
+
+// onDatagramMessage publishes a message of a datagram sent from src to dst.
+func (fix *fixPlugin) onDatagramMessage(
+	conn *fixConnectionData,
+	pkt *protos.Packet,
+	src, dst *common.Endpoint,
+	msg *message,
+) {
+	messagesDecoded.Add(1)
+	conn.onApplVerID(msg.fields)
+	if tracer.isEnabled() {
+		tracer.trace(msg.ts, endpointName(*src), endpointName(*dst),
+			fix.dictionary(conn, msg.fields), msg.fields)
+	}
+	// filtered messages still update the books
+	for _, snap := range fix.books.onMessage(msg, *src, *dst, "") {
+		fix.publishBookEvent(snap)
+	}
+	if summary := fix.limiter.summary(msg.fields, msg.ts); summary != nil {
+		fix.publishRateLimitEvent(summary, *src, *dst,
+			common.MapStr{"rate_limit": summary.fields()})
+	}
+	if !fix.filter.accept(msg.fields) {
+		filteredMessages.Add(1)
+		return
+	}
+	sampleRate, sampled := fix.sampler.sample(msg.fields)
+	if !sampled {
+		droppedBySampling.Add(1)
+		return
+	}
+	if !fix.limiter.allow(msg.fields, msg.ts) {
+		rateLimitedMessages.Add(1)
+		return
+	}
+
+	duplicateOf, isDuplicate := fix.dedup.check(endpointName(*src), msg)
+	if isDuplicate {
+		duplicateExecutions.Add(1)
+		if fix.dedup.drop {
+			return
+		}
+	}
+
+	event := fix.newEvent(conn, msg.ts, msg.fields)
+	fix.addRaw(event, msg)
+	if isDuplicate {
+		event["fix"].(common.MapStr)["duplicate_of"] = duplicateOf
+	}
+	if sampleRate > 0 {
+		event["fix"].(common.MapStr)["sample_rate"] = sampleRate
+	}
+	if direction, ok := fix.ourSide.direction(msg.fields, pkt.Tuple.SrcIP, pkt.Tuple.DstIP); ok {
+		event["fix"].(common.MapStr)["direction"] = direction
+	}
+	sender, _ := msg.fields.get(tagSenderCompID)
+	target, _ := msg.fields.get(tagTargetCompID)
+	key := sessionKey{senderCompID: sender, targetCompID: target, src: *src, dst: *dst}
+	if tenant := fix.tenants.lookup(key, msg.fields); tenant != "" {
+		event["fix"].(common.MapStr)["tenant"] = tenant
+	}
+	if fix.documentID != "" {
+		event["fix"].(common.MapStr)["document_id"] = documentID(fix.documentID, key, 0, msg)
+	}
+	event["transport"] = "udp"
+	event["src"] = src
+	event["dst"] = dst
+	fix.results.publishMessage(event, msg)
+}
@@ -0,0 +1,47 @@
+// +build !integration
+
+package fix
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/packetbeat/protos"
+)
+
+func TestParseUDP(t *testing.T) {
+	fix, results := fixModForTests()
+	first := fixMessage("8=FIX.4.4|35=X|34=10|55=VOD.L|")
+	second := fixMessage("8=FIX.4.4|35=X|34=11|55=BARC.L|")
+
+	pkt := &protos.Packet{
+		Ts: time.Now(),
+		Tuple: common.NewIPPortTuple(4,
+			net.ParseIP("10.0.0.1"), 40000,
+			net.ParseIP("239.1.1.1"), 9878),
+		Payload: append(append([]byte{}, first...), second...),
+	}
+	fix.ParseUDP(pkt)
+
+	event := expectEvent(t, results)
+	assert.Equal(t, "udp", event["transport"])
+	assert.Equal(t, &common.Endpoint{IP: "239.1.1.1", Port: 9878}, event["dst"])
+	assert.Equal(t, "VOD.L", event["fix"].(common.MapStr)["Symbol"])
+
+	event = expectEvent(t, results)
+	assert.Equal(t, "BARC.L", event["fix"].(common.MapStr)["Symbol"])
+	assert.Empty(t, results.Channel)
+}
+
+func TestParseUDPIgnoresTruncatedMessage(t *testing.T) {
+	fix, results := fixModForTests()
+	raw := fixMessage("8=FIX.4.4|35=X|34=10|55=VOD.L|")
+
+	fix.ParseUDP(&protos.Packet{Ts: time.Now(), Payload: raw[:len(raw)-3]})
+
+	assert.Empty(t, results.Channel)
+}
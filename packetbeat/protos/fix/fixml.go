@@ -0,0 +1,457 @@
+package fix
+
+import (
+	"bytes"
+	"encoding/xml"
+	"expvar"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+
+	"github.com/elastic/beats/packetbeat/protos"
+)
+
+type fixmlConfig struct {
+	// ports carrying FIXML documents, like HTTP or MQ connections
+	Ports []int `config:"ports"`
+
+	// decode FIXML messages held by the XmlData (213) of tag=value messages
+	XMLData bool `config:"xml_data"`
+}
+
+var defaultFIXMLConfig = fixmlConfig{
+	XMLData: true,
+}
+
+const tagXMLData = 213
+
+// fixmlFrame is a FIXML message being processed, adding its element and the
+// versions of its document to its event.
+type fixmlFrame struct {
+	msg     *message
+	element string
+
+	// v, xv and cv attributes of the FIXML root element
+	version, extensionVersion, customVersion string
+}
+
+var (
+	fixmlStartTag = []byte("<FIXML")
+	fixmlEndTag   = []byte("</FIXML>")
+
+	fixmlMessagesDecoded = expvar.NewInt("fix.fixml.messages")
+	fixmlDecodeErrors    = expvar.NewInt("fix.fixml.decode_errors")
+	fixmlUnknownFields   = expvar.NewInt("fix.fixml.unknown_fields")
+)
+
+// fixmlTimestampLayout formats FIXML timestamps as the UTCTimestamp fields of
+// tag=value messages.
+const fixmlTimestampLayout = utcTimestampLayout + ".999999999"
+
+var fixmlTimeLayouts = []string{
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999",
+}
+
+// fixmlDictionary decodes FIXML messages, adding the post-trade tags and the
+// repeating groups of the FIXML components to the FIX 5.0 dictionary.
+var fixmlDictionary = newFIXMLDictionary()
+
+// fixmlFieldNames are the tags of the dictionary by name, attributes not
+// abbreviated being named after their tag.
+var fixmlFieldNames = func() map[string]int {
+	names := map[string]int{}
+	for tag, field := range fixmlDictionary.fields {
+		if other, exists := names[field.name]; !exists || tag < other {
+			names[field.name] = tag
+		}
+	}
+	return names
+}()
+
+func newFIXMLDictionary() *dictionary {
+	groups := map[int]*repeatingGroup{}
+	for _, e := range fixmlComponents {
+		if e.group == 0 {
+			continue
+		}
+		// elements of the same group add their tags to the group
+		tags := []int{e.delimiter}
+		if g, ok := groups[e.group]; ok {
+			tags = g.tags
+		}
+		for _, tag := range e.members() {
+			if !containsTag(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		groups[e.group] = newRepeatingGroup(e.name, tags)
+	}
+
+	msgGroups := map[string]map[int]*repeatingGroup{}
+	for _, m := range fixmlMessages {
+		msgGroups[m.msgType] = groups
+	}
+	return newDictionary(fix50Dictionary.version, fix50Dictionary, fixmlFields, nil, msgGroups)
+}
+
+func containsTag(tags []int, tag int) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// members returns the tags of the entries of a repeating group, the tags of
+// the components nested in the entries included.
+func (e *fixmlElement) members() []int {
+	var tags []int
+	for _, tag := range e.attrs {
+		tags = append(tags, tag)
+	}
+	for _, name := range e.children {
+		child := fixmlComponents[name]
+		if child.group == 0 || child.group == e.group {
+			tags = append(tags, child.members()...)
+		} else {
+			tags = append(tags, child.group)
+		}
+	}
+	return tags
+}
+
+// tag returns the tag of an attribute, abbreviations of the element being
+// looked up first.
+func (e *fixmlElement) tag(attr string) (int, bool) {
+	if tag, ok := e.attrs[attr]; ok {
+		return tag, true
+	}
+	if tag, ok := fixmlAbbreviations[attr]; ok {
+		return tag, true
+	}
+	tag, ok := fixmlFieldNames[attr]
+	return tag, ok
+}
+
+// findFIXML returns the offsets of the first FIXML document of buf. start is
+// -1 if buf holds no FIXML start tag, end is -1 if the document is not
+// complete.
+func findFIXML(buf []byte) (start, end int) {
+	for offset := 0; ; {
+		i := bytes.Index(buf[offset:], fixmlStartTag)
+		if i < 0 {
+			return -1, -1
+		}
+		start = offset + i
+		next := start + len(fixmlStartTag)
+		if next == len(buf) {
+			return start, -1
+		}
+		switch buf[next] {
+		case ' ', '\t', '\r', '\n', '>':
+			end := bytes.Index(buf[next:], fixmlEndTag)
+			if end < 0 {
+				return start, -1
+			}
+			return start, next + end + len(fixmlEndTag)
+		}
+		offset = next
+	}
+}
+
+// decodeFIXML decodes the messages of a FIXML document, several messages
+// being wrapped in a Batch. A single message element is accepted as well, as
+// held by XmlData. Messages of elements unknown are skipped.
+func decodeFIXML(ts time.Time, doc []byte) ([]*fixmlFrame, error) {
+	var root xmlNode
+	if err := xml.Unmarshal(doc, &root); err != nil {
+		return nil, err
+	}
+	if root.XMLName.Local != "FIXML" {
+		frame, err := decodeFIXMLMessage(ts, &root)
+		if err != nil {
+			return nil, err
+		}
+		return []*fixmlFrame{frame}, nil
+	}
+
+	var elements []*xmlNode
+	for i := range root.Children {
+		n := &root.Children[i]
+		if n.XMLName.Local != "Batch" {
+			elements = append(elements, n)
+			continue
+		}
+		for j := range n.Children {
+			elements = append(elements, &n.Children[j])
+		}
+	}
+
+	var frames []*fixmlFrame
+	for _, n := range elements {
+		frame, err := decodeFIXMLMessage(ts, n)
+		if err != nil {
+			fixmlDecodeErrors.Add(1)
+			if isDebug {
+				debugf("Ignore FIXML message: %v", err)
+			}
+			continue
+		}
+		frame.version = root.attr("v")
+		frame.extensionVersion = root.attr("xv")
+		frame.customVersion = root.attr("cv")
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// decodeFIXMLMessage maps the attributes of a message and its components to
+// the fields of a tag=value message. The entries of repeating groups follow
+// the fields of the message, each entry starting with the delimiter of the
+// group.
+func decodeFIXMLMessage(ts time.Time, n *xmlNode) (*fixmlFrame, error) {
+	def, ok := fixmlMessages[n.XMLName.Local]
+	if !ok {
+		return nil, fmt.Errorf("unknown FIXML message %v", n.XMLName.Local)
+	}
+
+	fields, nested := appendFIXMLElement(n, def, tagValues{{tagMsgType, def.msgType}}, nil)
+	msg := &message{
+		ts:            ts,
+		fields:        append(fields, nested...),
+		checksumValid: true,
+	}
+	msg.raw = msg.fields.encode(soh)
+	return &fixmlFrame{msg: msg, element: n.XMLName.Local}, nil
+}
+
+// appendFIXMLElement appends the attributes of n and of its components to
+// fields, and its repeating groups to nested.
+func appendFIXMLElement(n *xmlNode, e *fixmlElement, fields, nested tagValues) (tagValues, tagValues) {
+	for _, a := range n.Attrs {
+		if a.Name.Space != "" || a.Name.Local == "xmlns" || a.Value == "" {
+			continue
+		}
+		tag, ok := e.tag(a.Name.Local)
+		if !ok {
+			fixmlUnknownFields.Add(1)
+			continue
+		}
+		fields = append(fields, tagValue{tag: tag, value: fixmlValue(tag, a.Value)})
+	}
+
+	for i := 0; i < len(n.Children); {
+		c := &n.Children[i]
+		child, ok := fixmlComponents[c.XMLName.Local]
+		if !ok {
+			fixmlUnknownFields.Add(1)
+			i++
+			continue
+		}
+		if child.group == 0 || child.group == e.group {
+			fields, nested = appendFIXMLElement(c, child, fields, nested)
+			i++
+			continue
+		}
+
+		// consecutive elements are the entries of the group
+		end := i + 1
+		for end < len(n.Children) && n.Children[end].XMLName.Local == c.XMLName.Local {
+			end++
+		}
+		nested = append(nested, tagValue{tag: child.group, value: strconv.Itoa(end - i)})
+		for ; i < end; i++ {
+			entry, entryNested := appendFIXMLElement(&n.Children[i], child, nil, nil)
+			nested = append(nested, delimitEntry(child.delimiter, entry)...)
+			nested = append(nested, entryNested...)
+		}
+	}
+	return fields, nested
+}
+
+// delimitEntry moves the delimiter to the start of a group entry, adding an
+// empty delimiter to entries not having one.
+func delimitEntry(delimiter int, entry tagValues) tagValues {
+	for i, f := range entry {
+		if f.tag == delimiter {
+			copy(entry[1:i+1], entry[:i])
+			entry[0] = f
+			return entry
+		}
+	}
+	return append(tagValues{{tag: delimiter}}, entry...)
+}
+
+// fixmlValue converts the ISO 8601 timestamps and dates of FIXML to the
+// formats of tag=value messages.
+func fixmlValue(tag int, value string) string {
+	if field, ok := fixmlDictionary.field(tag); ok && field.dtype == "time" {
+		for _, layout := range fixmlTimeLayouts {
+			if t, err := time.Parse(layout, value); err == nil {
+				return t.UTC().Format(fixmlTimestampLayout)
+			}
+		}
+		return value
+	}
+	if isFIXMLDate(value) {
+		return value[:4] + value[5:7] + value[8:]
+	}
+	return value
+}
+
+func isFIXMLDate(value string) bool {
+	if len(value) != len("2006-01-02") || value[4] != '-' || value[7] != '-' {
+		return false
+	}
+	for i, c := range value {
+		if i != 4 && i != 7 && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// isFIXMLPort checks whether one of the ports of a connection carries FIXML.
+func (fix *fixPlugin) isFIXMLPort(ports [2]uint16) bool {
+	return fix.fixmlPorts[ports[0]] || fix.fixmlPorts[ports[1]]
+}
+
+// parseFIXML publishes the FIXML documents of a TCP stream. The bytes
+// between documents, like HTTP headers or MQ framing, are skipped.
+func (fix *fixPlugin) parseFIXML(
+	conn *fixConnectionData,
+	st *stream,
+	pkt *protos.Packet,
+	tcptuple *common.TCPTuple,
+	dir uint8,
+) *fixConnectionData {
+	for st.Buf.Len() > 0 {
+		buf := st.Buf.Bytes()
+		start, end := findFIXML(buf)
+		if start < 0 {
+			// keep a start tag possibly continued in the next segment
+			if keep := len(fixmlStartTag) - 1; len(buf) > keep {
+				st.Buf.Advance(len(buf) - keep)
+				st.Buf.Reset()
+			}
+			break
+		}
+		if end < 0 {
+			// wait for more data
+			st.Buf.Advance(start)
+			st.Buf.Reset()
+			break
+		}
+
+		fix.onFIXMLDocument(conn, pkt.Ts, buf[start:end], func(msg *message) {
+			fix.onMessage(conn, tcptuple, dir, msg)
+		})
+		st.Buf.Advance(end)
+		st.Buf.Reset()
+	}
+	return conn
+}
+
+// parseFIXMLDatagram publishes the FIXML documents of a datagram.
+func (fix *fixPlugin) parseFIXMLDatagram(
+	conn *fixConnectionData,
+	pkt *protos.Packet,
+	src, dst *common.Endpoint,
+) {
+	buf := pkt.Payload
+	for {
+		start, end := findFIXML(buf)
+		if start < 0 || end < 0 {
+			return
+		}
+		fix.onFIXMLDocument(conn, pkt.Ts, buf[start:end], func(msg *message) {
+			fix.onDatagramMessage(conn, pkt, src, dst, msg)
+		})
+		buf = buf[end:]
+	}
+}
+
+// onFIXMLDocument decodes the messages of a FIXML document and processes
+// them as tag=value messages, the FIXML element of each message being set on
+// the connection.
+func (fix *fixPlugin) onFIXMLDocument(
+	conn *fixConnectionData,
+	ts time.Time,
+	doc []byte,
+	process func(*message),
+) {
+	frames, err := decodeFIXML(ts, doc)
+	if err != nil {
+		fixmlDecodeErrors.Add(1)
+		if isDebug {
+			debugf("Ignore FIXML document: %v", err)
+		}
+		return
+	}
+	for _, frame := range frames {
+		fixmlMessagesDecoded.Add(1)
+		frame.msg.fields = fix.masker.apply(frame.msg.fields)
+		conn.fixml = frame
+		process(frame.msg)
+		conn.fixml = nil
+	}
+}
+
+// decodeXMLData decodes the FIXML message held by the XmlData of a tag=value
+// message, nil if XmlData holds no known FIXML message. Only the first
+// message of a Batch is decoded.
+func (fix *fixPlugin) decodeXMLData(conn *fixConnectionData, xmlData string) common.MapStr {
+	doc := strings.TrimSpace(xmlData)
+	if !strings.HasPrefix(doc, "<") {
+		return nil
+	}
+	frames, err := decodeFIXML(time.Time{}, []byte(doc))
+	if err != nil || len(frames) == 0 {
+		fixmlDecodeErrors.Add(1)
+		if isDebug {
+			debugf("Ignore XmlData not holding a FIXML message: %v", err)
+		}
+		return nil
+	}
+	fixmlMessagesDecoded.Add(1)
+
+	fields := fix.masker.apply(frames[0].msg.fields)
+	msgType, _ := fields.get(tagMsgType)
+	dict := fix.dictionaries.lookup(fixmlDictionary, conn.ports, fields)
+	decoded := common.MapStr{
+		"msg_type": dict.enum(tagMsgType, msgType),
+	}
+	fix.decodeFields(dict, msgType, nil, fields, decoded)
+	return decoded
+}
+
+// fields returns the FIXML fields of the event of the message.
+func (f *fixmlFrame) fields() common.MapStr {
+	fields := common.MapStr{
+		"message": f.element,
+	}
+	if f.version != "" {
+		fields["version"] = f.version
+	}
+	if f.extensionVersion != "" {
+		fields["extension_version"] = f.extensionVersion
+	}
+	if f.customVersion != "" {
+		fields["custom_version"] = f.customVersion
+	}
+	return fields
+}
+
+// applVersion returns the application version of the message, as set by the
+// v attribute of its document, like "5.0 SP2".
+func (f *fixmlFrame) applVersion() (string, bool) {
+	if f.version == "" {
+		return "", false
+	}
+	return "FIX." + strings.Replace(f.version, " ", "", -1), true
+}
@@ -0,0 +1,303 @@
+package fix
+
+// fixmlElement maps the attributes of a FIXML message or component, named by
+// the abbreviations of the FIXML schema, to tags. Components having a group
+// tag are the entries of a repeating group, each entry started by delimiter.
+// children lists the components nested in the entries.
+type fixmlElement struct {
+	msgType   string
+	group     int
+	name      string
+	delimiter int
+	attrs     map[string]int
+	children  []string
+}
+
+// Tags of the FIXML post-trade messages not defined by the built-in
+// dictionaries.
+var fixmlFields map[int]typeBlock = map[int]typeBlock{
+	232:  typeBlock{name: "NoStipulations", dtype: "int"},
+	233:  typeBlock{name: "StipulationType", dtype: "string"},
+	234:  typeBlock{name: "StipulationValue", dtype: "string"},
+	454:  typeBlock{name: "NoSecurityAltID", dtype: "int"},
+	455:  typeBlock{name: "SecurityAltID", dtype: "string"},
+	456:  typeBlock{name: "SecurityAltIDSource", dtype: "string"},
+	467:  typeBlock{name: "IndividualAllocID", dtype: "string"},
+	479:  typeBlock{name: "CommCurrency", dtype: "string"},
+	487:  typeBlock{name: "TradeReportTransType", dtype: "int"},
+	523:  typeBlock{name: "PartySubID", dtype: "string"},
+	524:  typeBlock{name: "NestedPartyID", dtype: "string"},
+	525:  typeBlock{name: "NestedPartyIDSource", dtype: "string"},
+	538:  typeBlock{name: "NestedPartyRole", dtype: "int"},
+	539:  typeBlock{name: "NoNestedPartyIDs", dtype: "int"},
+	564:  typeBlock{name: "LegPositionEffect", dtype: "string"},
+	568:  typeBlock{name: "TradeRequestID", dtype: "string"},
+	569:  typeBlock{name: "TradeRequestType", dtype: "int"},
+	570:  typeBlock{name: "PreviouslyReported", dtype: "string"},
+	571:  typeBlock{name: "TradeReportID", dtype: "string"},
+	572:  typeBlock{name: "TradeReportRefID", dtype: "string"},
+	573:  typeBlock{name: "MatchStatus", dtype: "string"},
+	574:  typeBlock{name: "MatchType", dtype: "string"},
+	578:  typeBlock{name: "TradeInputSource", dtype: "string"},
+	579:  typeBlock{name: "TradeInputDevice", dtype: "string"},
+	601:  typeBlock{name: "LegSymbolSfx", dtype: "string"},
+	602:  typeBlock{name: "LegSecurityID", dtype: "string"},
+	603:  typeBlock{name: "LegSecurityIDSource", dtype: "string"},
+	609:  typeBlock{name: "LegSecurityType", dtype: "string"},
+	610:  typeBlock{name: "LegMaturityMonthYear", dtype: "string"},
+	611:  typeBlock{name: "LegMaturityDate", dtype: "string"},
+	612:  typeBlock{name: "LegStrikePrice", dtype: "float"},
+	616:  typeBlock{name: "LegSecurityExchange", dtype: "string"},
+	623:  typeBlock{name: "LegRatioQty", dtype: "float"},
+	624:  typeBlock{name: "LegSide", dtype: "string"},
+	626:  typeBlock{name: "AllocType", dtype: "int"},
+	637:  typeBlock{name: "LegLastPx", dtype: "float"},
+	654:  typeBlock{name: "LegRefID", dtype: "string"},
+	661:  typeBlock{name: "AllocAcctIDSource", dtype: "int"},
+	664:  typeBlock{name: "ConfirmID", dtype: "string"},
+	665:  typeBlock{name: "ConfirmStatus", dtype: "int"},
+	666:  typeBlock{name: "ConfirmTransType", dtype: "int"},
+	687:  typeBlock{name: "LegQty", dtype: "float"},
+	702:  typeBlock{name: "NoPositions", dtype: "int"},
+	703:  typeBlock{name: "PosType", dtype: "string"},
+	704:  typeBlock{name: "LongQty", dtype: "float"},
+	705:  typeBlock{name: "ShortQty", dtype: "float"},
+	706:  typeBlock{name: "PosQtyStatus", dtype: "int"},
+	707:  typeBlock{name: "PosAmtType", dtype: "string"},
+	708:  typeBlock{name: "PosAmt", dtype: "float"},
+	709:  typeBlock{name: "PosTransType", dtype: "int"},
+	710:  typeBlock{name: "PosReqID", dtype: "string"},
+	711:  typeBlock{name: "NoUnderlyings", dtype: "int"},
+	712:  typeBlock{name: "PosMaintAction", dtype: "int"},
+	713:  typeBlock{name: "OrigPosReqRefID", dtype: "string"},
+	715:  typeBlock{name: "ClearingBusinessDate", dtype: "string"},
+	721:  typeBlock{name: "PosMaintRptID", dtype: "string"},
+	722:  typeBlock{name: "PosMaintStatus", dtype: "int"},
+	723:  typeBlock{name: "PosMaintResult", dtype: "int"},
+	724:  typeBlock{name: "PosReqType", dtype: "int"},
+	727:  typeBlock{name: "TotalNumPosReports", dtype: "int"},
+	728:  typeBlock{name: "PosReqResult", dtype: "int"},
+	729:  typeBlock{name: "PosReqStatus", dtype: "int"},
+	730:  typeBlock{name: "SettlPrice", dtype: "float"},
+	731:  typeBlock{name: "SettlPriceType", dtype: "int"},
+	734:  typeBlock{name: "PriorSettlPrice", dtype: "float"},
+	748:  typeBlock{name: "TotNumTradeReports", dtype: "int"},
+	749:  typeBlock{name: "TradeRequestResult", dtype: "int"},
+	750:  typeBlock{name: "TradeRequestStatus", dtype: "int"},
+	751:  typeBlock{name: "TradeReportRejectReason", dtype: "int"},
+	753:  typeBlock{name: "NoPosAmt", dtype: "int"},
+	755:  typeBlock{name: "AllocReportID", dtype: "string"},
+	768:  typeBlock{name: "NoTrdRegTimestamps", dtype: "int"},
+	769:  typeBlock{name: "TrdRegTimestamp", dtype: "time"},
+	770:  typeBlock{name: "TrdRegTimestampType", dtype: "int"},
+	772:  typeBlock{name: "ConfirmRefID", dtype: "string"},
+	773:  typeBlock{name: "ConfirmType", dtype: "int"},
+	774:  typeBlock{name: "ConfirmRejReason", dtype: "int"},
+	794:  typeBlock{name: "AllocReportType", dtype: "int"},
+	802:  typeBlock{name: "NoPartySubIDs", dtype: "int"},
+	803:  typeBlock{name: "PartySubIDType", dtype: "int"},
+	819:  typeBlock{name: "AvgPxIndicator", dtype: "int"},
+	829:  typeBlock{name: "TrdSubType", dtype: "int"},
+	856:  typeBlock{name: "TradeReportType", dtype: "int"},
+	879:  typeBlock{name: "UnderlyingQty", dtype: "float"},
+	891:  typeBlock{name: "MiscFeeBasis", dtype: "int"},
+	912:  typeBlock{name: "LastRptRequested", dtype: "string"},
+	939:  typeBlock{name: "TrdRptStatus", dtype: "int"},
+	940:  typeBlock{name: "AffirmStatus", dtype: "int"},
+	1055: typeBlock{name: "PositionCurrency", dtype: "string"},
+	1123: typeBlock{name: "TradeHandlingInstr", dtype: "string"},
+	1125: typeBlock{name: "OrigTradeDate", dtype: "string"},
+	1126: typeBlock{name: "OrigTradeID", dtype: "string"},
+	1430: typeBlock{name: "VenueType", dtype: "string"},
+}
+
+// fixmlAbbreviations are the abbreviations used by the attributes of all
+// messages, unless redefined by the message or component.
+var fixmlAbbreviations = map[string]int{
+	"Acct":        1,
+	"AvgPx":       6,
+	"ClOrdID":     11,
+	"CumQty":      14,
+	"Ccy":         15,
+	"ExecID":      17,
+	"ExecInst":    18,
+	"ExecRefID":   19,
+	"LastMkt":     30,
+	"LastPx":      31,
+	"LastQty":     32,
+	"OrdID":       37,
+	"Stat":        39,
+	"Typ":         40,
+	"OrigClOrdID": 41,
+	"Px":          44,
+	"Side":        54,
+	"Txt":         58,
+	"TmInForce":   59,
+	"TxnTm":       60,
+	"SettlTyp":    63,
+	"SettlDt":     64,
+	"TrdDt":       75,
+	"PosEfct":     77,
+	"StopPx":      99,
+	"NetMny":      118,
+	"SettlCcy":    120,
+	"ExpireTm":    126,
+	"ExecTyp":     150,
+	"LeavesQty":   151,
+	"SesID":       336,
+	"GrossTrdAmt": 381,
+	"PxTyp":       423,
+	"ExpireDt":    432,
+	"MLegRptTyp":  442,
+	"Cpcty":       528,
+	"PrevlyRpted": 570,
+	"MtchStat":    573,
+	"MtchTyp":     574,
+	"AcctTyp":     581,
+	"SesSub":      625,
+	"BizDt":       715,
+	"AvgPxInd":    819,
+	"TrdTyp":      828,
+	"TrdSubTyp":   829,
+	"TrdMtchID":   880,
+	"TrdID":       1003,
+	"OrigTrdID":   1126,
+}
+
+// fixmlMessages are the FIXML messages decoded, by element name.
+var fixmlMessages = map[string]*fixmlElement{
+	"ExecRpt":       {msgType: "8", attrs: map[string]int{"RejRsn": 103}},
+	"Order":         {msgType: "D"},
+	"OrdCxlReq":     {msgType: "F"},
+	"OrdCxlRplcReq": {msgType: "G"},
+	"AllocInstrctn": {msgType: "J", attrs: map[string]int{
+		"ID": 70, "TransTyp": 71, "RefID": 72, "LinkID": 196, "Qty": 53, "Typ": 626,
+	}},
+	"AllocInstrctnAck": {msgType: "P", attrs: map[string]int{
+		"ID": 70, "Stat": 87, "RejCd": 88, "Typ": 626,
+	}},
+	"BizMsgRej": {msgType: "j", attrs: map[string]int{
+		"RefSeqNum": 45, "RefMsgTyp": 372, "BizRejRefID": 379, "BizRejRsn": 380,
+	}},
+	"TrdCaptRptReq": {msgType: "AD", attrs: map[string]int{
+		"SubReqTyp": 263, "ReqID": 568, "ReqTyp": 569,
+	}},
+	"TrdCaptRpt": {msgType: "AE", attrs: map[string]int{
+		"TransTyp": 487, "ReqID": 568, "RptID": 571, "RptRefID": 572,
+		"TotNumTrdRpts": 748, "RptTyp": 856, "LastRptReqed": 912,
+		"TrdRptStat": 939, "TrdHandlInst": 1123, "OrigTrdDt": 1125,
+		"VenuTyp": 1430,
+	}},
+	"TrdCaptRptReqAck": {msgType: "AQ", attrs: map[string]int{
+		"ReqID": 568, "ReqTyp": 569, "TotNumTrdRpts": 748, "ReqRslt": 749,
+		"ReqStat": 750,
+	}},
+	"TrdCaptRptAck": {msgType: "AR", attrs: map[string]int{
+		"TransTyp": 487, "RptID": 571, "RptRefID": 572, "RejRsn": 751,
+		"RptTyp": 856, "TrdRptStat": 939,
+	}},
+	"AllocRpt": {msgType: "AS", attrs: map[string]int{
+		"Qty": 53, "ID": 70, "TransTyp": 71, "Stat": 87, "RejCd": 88,
+		"RptID": 755, "RptTyp": 794,
+	}},
+	"AllocRptAck": {msgType: "AT", attrs: map[string]int{
+		"ID": 70, "Stat": 87, "RejCd": 88, "RptID": 755, "RptTyp": 794,
+	}},
+	"Confirm": {msgType: "AK", attrs: map[string]int{
+		"AllocID": 70, "AllocQty": 80, "ConfID": 664, "Stat": 665,
+		"TransTyp": 666, "RefID": 772, "Typ": 773,
+	}},
+	"ConfirmAck": {msgType: "AU", attrs: map[string]int{
+		"ConfID": 664, "RejRsn": 774, "AffirmStat": 940,
+	}},
+	"PosMntReq": {msgType: "AL", attrs: map[string]int{
+		"TxnTyp": 709, "ReqID": 710, "Actn": 712, "OrigReqRefID": 713,
+	}},
+	"PosMntRpt": {msgType: "AM", attrs: map[string]int{
+		"TxnTyp": 709, "ReqID": 710, "Actn": 712, "OrigReqRefID": 713,
+		"RptID": 721, "Stat": 722, "Rslt": 723,
+	}},
+	"ReqForPoss": {msgType: "AN", attrs: map[string]int{
+		"SubReqTyp": 263, "ReqID": 710, "ReqTyp": 724,
+	}},
+	"ReqForPossAck": {msgType: "AO", attrs: map[string]int{
+		"ReqID": 710, "RptID": 721, "TotRpts": 727, "Rslt": 728, "Stat": 729,
+	}},
+	"PosRpt": {msgType: "AP", attrs: map[string]int{
+		"UnsolInd": 325, "ReqID": 710, "RptID": 721, "ReqTyp": 724,
+		"TotRpts": 727, "Rslt": 728, "SetPx": 730, "SetPxTyp": 731,
+		"PriSetPx": 734,
+	}},
+}
+
+// fixmlComponents are the components and repeating groups of the FIXML
+// messages, by element name.
+var fixmlComponents = map[string]*fixmlElement{
+	"Hdr": {attrs: map[string]int{
+		"SID": 49, "TID": 56, "SSub": 50, "TSub": 57, "SLoc": 142,
+		"TLoc": 143, "OBID": 115, "OBSub": 116, "D2ID": 128, "D2Sub": 129,
+		"SeqNum": 34, "Snt": 52, "PosDup": 43, "PosRsnd": 97, "OrigSnt": 122,
+	}},
+	"Instrmt": {attrs: map[string]int{
+		"Sym": 55, "Sfx": 65, "ID": 48, "Src": 22, "SecTyp": 167,
+		"SubTyp": 762, "CFI": 461, "MMY": 200, "MatDt": 541, "StrkPx": 202,
+		"PutCall": 201, "Mult": 231, "Exch": 207, "Desc": 107,
+	}, children: []string{"SecAlt"}},
+	"OrdQty": {attrs: map[string]int{"Qty": 38, "Cash": 152}},
+	"Comm":   {attrs: map[string]int{"Comm": 12, "CommTyp": 13, "Ccy": 479}},
+	"SecAlt": {group: 454, name: "SecurityAltID", delimiter: 455, attrs: map[string]int{
+		"AltID": 455, "AltIDSrc": 456,
+	}},
+	"Pty": {group: 453, name: "PartyIDs", delimiter: 448, attrs: map[string]int{
+		"ID": 448, "Src": 447, "R": 452,
+	}, children: []string{"Sub"}},
+	"Sub": {group: 802, name: "PartySubIDs", delimiter: 523, attrs: map[string]int{
+		"ID": 523, "Typ": 803,
+	}},
+	"NstPty": {group: 539, name: "NestedPartyIDs", delimiter: 524, attrs: map[string]int{
+		"ID": 524, "Src": 525, "R": 538,
+	}},
+	"RptSide": {group: 552, name: "Sides", delimiter: 54, attrs: map[string]int{
+		"Side": 54, "OrdID": 37, "ClOrdID": 11, "Acct": 1, "AcctTyp": 581,
+		"PosEfct": 77, "Ccy": 15, "NetMny": 118, "GrossTrdAmt": 381,
+		"Txt": 58, "SesID": 336, "InptSrc": 578, "InptDev": 579,
+		"AgrsrInd": 1057,
+	}, children: []string{"Pty", "Comm", "MiscFees", "Alloc"}},
+	"Undly": {group: 711, name: "Underlyings", delimiter: 311, attrs: map[string]int{
+		"Sym": 311, "Sfx": 312, "ID": 309, "Src": 305, "SecTyp": 310,
+		"MMY": 313, "MatDt": 542, "Exch": 308, "Qty": 879,
+	}},
+	"Leg": {group: 555, name: "Legs", delimiter: 600, attrs: map[string]int{
+		"Sym": 600, "Sfx": 601, "ID": 602, "Src": 603, "SecTyp": 609,
+		"MMY": 610, "MatDt": 611, "StrkPx": 612, "Exch": 616, "RatioQty": 623,
+		"Side": 624,
+	}},
+	// the legs of trade reports hold the instrument of the leg in a Leg
+	"TrdLeg": {group: 555, name: "Legs", delimiter: 600, attrs: map[string]int{
+		"PosEfct": 564, "LastPx": 637, "RefID": 654, "Qty": 687,
+	}, children: []string{"Leg"}},
+	"TrdRegTS": {group: 768, name: "TrdRegTimestamps", delimiter: 769, attrs: map[string]int{
+		"TS": 769, "Typ": 770,
+	}},
+	"Amt": {group: 753, name: "PosAmt", delimiter: 707, attrs: map[string]int{
+		"Typ": 707, "Amt": 708, "Ccy": 1055,
+	}},
+	"Qty": {group: 702, name: "Positions", delimiter: 703, attrs: map[string]int{
+		"Typ": 703, "Long": 704, "Short": 705, "Stat": 706,
+	}},
+	"Alloc": {group: 78, name: "Allocs", delimiter: 79, attrs: map[string]int{
+		"Acct": 79, "Qty": 80, "Px": 366, "IndAllocID": 467, "ActIDSrc": 661,
+	}, children: []string{"NstPty"}},
+	"Ord": {group: 73, name: "Orders", delimiter: 11, attrs: map[string]int{
+		"ClOrdID": 11, "OrdID": 37,
+	}},
+	"Exec": {group: 124, name: "Execs", delimiter: 32, attrs: map[string]int{
+		"LastQty": 32, "ExecID": 17, "LastPx": 31,
+	}},
+	"MiscFees": {group: 136, name: "MiscFees", delimiter: 137, attrs: map[string]int{
+		"Amt": 137, "Curr": 138, "Typ": 139, "Basis": 891,
+	}},
+	"Stip": {group: 232, name: "Stipulations", delimiter: 233, attrs: map[string]int{
+		"Typ": 233, "Val": 234,
+	}},
+}
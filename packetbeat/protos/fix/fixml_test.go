@@ -0,0 +1,217 @@
+// +build !integration
+
+package fix
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/packetbeat/protos"
+)
+
+const testTradeCaptureReport = `<TrdCaptRpt RptID="rpt-1" TransTyp="0" RptTyp="0" TrdID="T1001"
+    LastQty="10" LastPx="2150.25" TrdDt="2016-10-14" BizDt="2016-10-14"
+    TxnTm="2016-10-14T10:00:00.123-05:00">
+  <Hdr SID="CME" TID="FIRM" Snt="2016-10-14T15:00:01Z"/>
+  <Instrmt Sym="ES" ID="ESZ6" Src="H" SecTyp="FUT" MMY="201612"/>
+  <RptSide Side="1" ClOrdID="order-1" Acct="A1">
+    <Pty ID="FIRM" R="1"><Sub ID="desk-1" Typ="26"/></Pty>
+    <Pty ID="CME" R="21"/>
+  </RptSide>
+  <RptSide Side="2">
+    <Pty ID="OTHER" R="1"/>
+  </RptSide>
+  <TrdRegTS TS="2016-10-14T15:00:00.1Z" Typ="1"/>
+  <Custom Foo="bar"/>
+</TrdCaptRpt>`
+
+func TestDecodeFIXMLMessage(t *testing.T) {
+	ts := time.Now()
+	frames, err := decodeFIXML(ts, []byte(testTradeCaptureReport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Len(t, frames, 1) {
+		return
+	}
+	msg := frames[0].msg
+	assert.Equal(t, "TrdCaptRpt", frames[0].element)
+	assert.Equal(t, ts, msg.ts)
+	assert.True(t, msg.checksumValid)
+	assert.Equal(t, tagValues{
+		{35, "AE"},
+		{571, "rpt-1"}, {487, "0"}, {856, "0"}, {1003, "T1001"}, {32, "10"},
+		{31, "2150.25"}, {75, "20161014"}, {715, "20161014"},
+		{60, "20161014-15:00:00.123"},
+		{49, "CME"}, {56, "FIRM"}, {52, "20161014-15:00:01"},
+		{55, "ES"}, {48, "ESZ6"}, {22, "H"}, {167, "FUT"}, {200, "201612"},
+		{552, "2"},
+		{54, "1"}, {11, "order-1"}, {1, "A1"},
+		{453, "2"},
+		{448, "FIRM"}, {452, "1"}, {802, "1"}, {523, "desk-1"}, {803, "26"},
+		{448, "CME"}, {452, "21"},
+		{54, "2"}, {453, "1"}, {448, "OTHER"}, {452, "1"},
+		{768, "1"}, {769, "20161014-15:00:00.1"}, {770, "1"},
+	}, msg.fields)
+
+	_, err = decodeFIXML(ts, []byte(`<Unknown A="1"/>`))
+	assert.Error(t, err)
+	_, err = decodeFIXML(ts, []byte(`<TrdCaptRpt`))
+	assert.Error(t, err)
+}
+
+func TestDecodeFIXMLBatch(t *testing.T) {
+	frames, err := decodeFIXML(time.Now(), []byte(`<FIXML v="5.0 SP2" xv="109" cv="CME.0001">
+  <Batch>
+    <PosRpt RptID="pos-1" BizDt="2016-10-14" SetPx="2150.25">
+      <Instrmt Sym="ES"/>
+      <Qty Typ="FIN" Long="10" Short="0"/>
+      <Amt Typ="FMTM" Amt="-125.5" Ccy="USD"/>
+    </PosRpt>
+    <Unknown/>
+    <AllocInstrctn ID="alloc-1" TransTyp="0" Typ="1" Qty="10">
+      <Alloc Acct="A1" Qty="6"/>
+      <Alloc Acct="A2" Qty="4"><NstPty ID="GIVEUP" R="1"/></Alloc>
+    </AllocInstrctn>
+  </Batch>
+</FIXML>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Len(t, frames, 2) {
+		return
+	}
+	assert.Equal(t, "PosRpt", frames[0].element)
+	assert.Equal(t, "5.0 SP2", frames[0].version)
+	assert.Equal(t, "109", frames[0].extensionVersion)
+	assert.Equal(t, "CME.0001", frames[0].customVersion)
+	assert.Equal(t, tagValues{
+		{35, "AP"}, {721, "pos-1"}, {715, "20161014"}, {730, "2150.25"}, {55, "ES"},
+		{702, "1"}, {703, "FIN"}, {704, "10"}, {705, "0"},
+		{753, "1"}, {707, "FMTM"}, {708, "-125.5"}, {1055, "USD"},
+	}, frames[0].msg.fields)
+	assert.Equal(t, tagValues{
+		{35, "J"}, {70, "alloc-1"}, {71, "0"}, {626, "1"}, {53, "10"},
+		{78, "2"},
+		{79, "A1"}, {80, "6"},
+		{79, "A2"}, {80, "4"}, {539, "1"}, {524, "GIVEUP"}, {538, "1"},
+	}, frames[1].msg.fields)
+}
+
+func TestFindFIXML(t *testing.T) {
+	for _, test := range []struct {
+		buf        string
+		start, end int
+	}{
+		{"", -1, -1},
+		{"POST /fixml HTTP/1.1\r\n\r\n<?xml?>", -1, -1},
+		{"<FIXM", -1, -1},
+		{"<FIXML", 0, -1},
+		{"xx<FIXML v=\"5.0\"><Order/>", 2, -1},
+		{"<FIXMLX/><FIXML><Order/></FIXML>rest", 9, 32},
+		{"<FIXML>\n</FIXML>", 0, 16},
+	} {
+		start, end := findFIXML([]byte(test.buf))
+		assert.Equal(t, test.start, start, test.buf)
+		assert.Equal(t, test.end, end, test.buf)
+	}
+}
+
+func TestFIXMLValue(t *testing.T) {
+	assert.Equal(t, "20161014-15:00:00", fixmlValue(60, "2016-10-14T10:00:00-05:00"))
+	assert.Equal(t, "20161014-15:00:00.5", fixmlValue(60, "2016-10-14T15:00:00.500"))
+	assert.Equal(t, "20161014-10:00:00.123456789", fixmlValue(60, "2016-10-14T10:00:00.123456789Z"))
+	assert.Equal(t, "10:00:00", fixmlValue(60, "10:00:00"))
+	assert.Equal(t, "20161014", fixmlValue(75, "2016-10-14"))
+	assert.Equal(t, "2016-1-14", fixmlValue(58, "2016-1-14"))
+	assert.Equal(t, "201612", fixmlValue(200, "201612"))
+}
+
+func TestParseFIXMLOverHTTP(t *testing.T) {
+	fix, results := fixModForTests()
+	fix.fixmlPorts = map[uint16]bool{8080: true}
+	tuple := common.TCPTuple{
+		SrcIP: net.ParseIP("10.0.0.1"), SrcPort: 40000,
+		DstIP: net.ParseIP("10.0.0.2"), DstPort: 8080,
+	}
+
+	body := `<?xml version="1.0" encoding="UTF-8"?>
+<FIXML xmlns="http://www.fixprotocol.org/FIXML-5-0-SP2" v="5.0 SP2">` +
+		testTradeCaptureReport + `</FIXML>`
+	request := "POST /clearing/trades HTTP/1.1\r\nContent-Type: application/xml\r\n\r\n" + body
+
+	// the document spans three segments, split in the start tag
+	split := strings.Index(request, "<FIXML") + 3
+	var private protos.ProtocolData
+	for _, payload := range []string{request[:split], request[split : split+200], request[split+200:]} {
+		pkt := &protos.Packet{Ts: time.Now(), Payload: []byte(payload)}
+		private = fix.Parse(pkt, &tuple, initiator, private)
+	}
+
+	event := expectEvent(t, results)
+	fields := event["fix"].(common.MapStr)
+	assert.Equal(t, "FIXML", fields["version"])
+	assert.Equal(t, "FIX.5.0SP2", fields["appl_version"])
+	assert.Equal(t, common.MapStr{"message": "TrdCaptRpt", "version": "5.0 SP2"}, fields["fixml"])
+	assert.Equal(t, "Trade Capture Report", fields["msg_type"])
+	assert.Equal(t, "CME->FIRM", fields["session_key"])
+	assert.Equal(t, "rpt-1", fields["TradeReportID"])
+	assert.Equal(t, 0, fields["TradeReportTransType"])
+	assert.Equal(t, "20161014", fields["TradeDate"])
+	assert.Equal(t, preciseTime(time.Date(2016, 10, 14, 15, 0, 0, 123000000, time.UTC)),
+		fields["TransactTime"])
+	sides := fields["Sides"].([]common.MapStr)
+	if assert.Len(t, sides, 2) {
+		assert.Equal(t, "order-1", sides[0]["ClOrdID"])
+		parties := sides[0]["PartyIDs"].([]common.MapStr)
+		if assert.Len(t, parties, 2) {
+			assert.Equal(t, "FIRM", parties[0]["PartyID"])
+			assert.Equal(t, []common.MapStr{{"PartySubID": "desk-1", "PartySubIDType": 26}},
+				parties[0]["PartySubIDs"])
+			assert.Equal(t, 21, parties[1]["PartyRole"])
+		}
+		assert.Len(t, sides[1]["PartyIDs"], 1)
+	}
+	assert.Len(t, fields["TrdRegTimestamps"], 1)
+	assert.Empty(t, results.Channel)
+	assert.Equal(t, 0, private.(*fixConnectionData).streams[initiator].Buf.Len())
+}
+
+func TestFIXMLXMLData(t *testing.T) {
+	fix, results := fixModForTests()
+
+	xmlData := `<FIXML><AllocRpt RptID="ar-1" ID="alloc-1" Stat="0"/></FIXML>`
+	parseMessages(fix, "8=FIX.4.4|35=n|49=A|56=B|34=2|212=61|213="+xmlData+"|")
+
+	event := expectEvent(t, results)
+	fields := event["fix"].(common.MapStr)
+	assert.Equal(t, xmlData, fields["XmlData"])
+	assert.Equal(t, common.MapStr{
+		"msg_type":      "Allocation Report",
+		"MsgType":       "AS",
+		"AllocReportID": "ar-1",
+		"AllocID":       "alloc-1",
+		"AllocStatus":   "0",
+	}, fields["xml_data"])
+
+	// XmlData not holding FIXML is published as is
+	fix.fixmlXMLData = true
+	parseMessages(fix, "8=FIX.4.4|35=n|49=A|56=B|34=3|212=5|213=plain|")
+	event = expectEvent(t, results)
+	assert.NotContains(t, event["fix"], "xml_data")
+
+	fix.fixmlXMLData = false
+	parseMessages(fix, "8=FIX.4.4|35=n|49=A|56=B|34=4|212=61|213="+xmlData+"|")
+	event = expectEvent(t, results)
+	assert.NotContains(t, event["fix"], "xml_data")
+}
+
+func TestFIXMLGetPorts(t *testing.T) {
+	fix := &fixPlugin{ports: []int{9878, 8080}, fixmlPorts: map[uint16]bool{8080: true, 1414: true}}
+	assert.Equal(t, []int{1414, 8080, 9878}, fix.GetPorts())
+}
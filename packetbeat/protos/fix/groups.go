@@ -0,0 +1,134 @@
+package fix
+
+import (
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// Quote message types.
+const (
+	msgTypeQuoteRequest = "R"
+	msgTypeQuote        = "S"
+	msgTypeQuoteCancel  = "Z"
+	msgTypeMassQuote    = "i"
+)
+
+const (
+	tagQuoteReqID     = 131
+	tagNoRelatedSym   = 146
+	tagNoQuoteEntries = 295
+	tagNoQuoteSets    = 296
+)
+
+// repeatingGroup defines a repeating group of a message type, started by its
+// NumInGroup tag. Each entry starts with the first tag of the group, the
+// delimiter. The entries are published as a list under name.
+type repeatingGroup struct {
+	name string
+	tags []int
+
+	members map[int]bool
+}
+
+func newRepeatingGroup(name string, tags ...[]int) *repeatingGroup {
+	g := &repeatingGroup{name: name, members: map[int]bool{}}
+	for _, t := range tags {
+		g.tags = append(g.tags, t...)
+	}
+	for _, tag := range g.tags {
+		g.members[tag] = true
+	}
+	return g
+}
+
+func (g *repeatingGroup) delimiter() int {
+	return g.tags[0]
+}
+
+// Instrument tags of the quote groups, from FIX 4.2 to 5.0.
+var (
+	instrumentTags = []int{
+		55, 65, 48, 22, 460, 461, 167, 762, 200, 541, 205, 201, 202, 206, 231,
+		223, 207, 106, 348, 349, 107, 350, 351,
+	}
+	underlyingInstrumentTags = []int{
+		311, 312, 309, 305, 462, 463, 310, 313, 542, 314, 315, 316, 317, 436,
+		435, 308, 306, 362, 363, 307, 364, 365,
+	}
+)
+
+// quoteGroups are the repeating groups of the quote messages, holding the
+// instruments quotes are requested for, the quote sets of a MassQuote and
+// the quotes of each set or cancelled.
+var quoteGroups = map[string]map[int]*repeatingGroup{
+	msgTypeQuoteRequest: {
+		tagNoRelatedSym: newRepeatingGroup("RelatedSym", instrumentTags, []int{
+			140, 303, 537, 336, 625, 54, 38, 152, 63, 64, 40, 193, 192, 126,
+			60, 15, 1, 423, 44, 640, 62,
+		}),
+	},
+	msgTypeMassQuote: {
+		tagNoQuoteSets: newRepeatingGroup("QuoteSets", []int{302}, underlyingInstrumentTags,
+			[]int{367, 304, 893, tagNoQuoteEntries}),
+		tagNoQuoteEntries: newRepeatingGroup("QuoteEntries", []int{299}, instrumentTags, []int{
+			132, 133, 134, 135, 62, 188, 190, 189, 191, 631, 632, 633, 634, 60,
+			336, 625, 64, 40, 193, 192, 642, 643, 15, 368,
+		}),
+	},
+	msgTypeQuoteCancel: {
+		tagNoQuoteEntries: newRepeatingGroup("QuoteEntries", instrumentTags,
+			underlyingInstrumentTags),
+	},
+}
+
+// decodeFields decodes fields into decoded until a tag not part of group is
+// found, returning the number of fields decoded. The top level fields of a
+// message are decoded with a nil group. The entries of the repeating groups
+// of msgType are decoded as lists of entries.
+func (fix *fixPlugin) decodeFields(
+	dict *dictionary,
+	msgType string,
+	group *repeatingGroup,
+	fields tagValues,
+	decoded common.MapStr,
+) int {
+	i := 0
+	for i < len(fields) {
+		f := fields[i]
+		if group != nil && (!group.members[f.tag] || (i > 0 && f.tag == group.delimiter())) {
+			// end of the entry
+			break
+		}
+		i++
+		fix.decodeField(dict, f, decoded)
+
+		nested, ok := dict.groups[msgType][f.tag]
+		if !ok {
+			continue
+		}
+		var entries []common.MapStr
+		for i < len(fields) && fields[i].tag == nested.delimiter() {
+			entry := common.MapStr{}
+			i += fix.decodeFields(dict, msgType, nested, fields[i:], entry)
+			if len(entry) > 0 {
+				entries = append(entries, entry)
+			}
+		}
+		if len(entries) > 0 {
+			decoded[nested.name] = entries
+		}
+	}
+	return i
+}
+
+// decodeField decodes a single tag into decoded, as renamed and converted by
+// fields_mapping.
+func (fix *fixPlugin) decodeField(dict *dictionary, f tagValue, decoded common.MapStr) {
+	name, value, ok := fix.mapper.decode(dict, f)
+	if !ok {
+		return
+	}
+	if name, ok = fix.names.sanitize(name); !ok {
+		return
+	}
+	decoded[name] = value
+}
@@ -0,0 +1,96 @@
+// +build !integration
+
+package fix
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func TestDecodeQuoteRequest(t *testing.T) {
+	fix, results := fixModForTests()
+
+	parseMessages(fix, "8=FIX.4.4|35=R|131=rfq-1|146=2|"+
+		"55=EUR/USD|537=1|54=1|38=1000000|55=GBP/USD|54=2|38=500000|58=end|")
+
+	decoded := expectEvent(t, results)["fix"].(common.MapStr)
+	assert.Equal(t, "Quote Request", decoded["msg_type"])
+	assert.Equal(t, "rfq-1", decoded["QuoteReqID"])
+	assert.Equal(t, []common.MapStr{
+		{"Symbol": "EUR/USD", "QuoteType": "Tradeable", "Side": "Buy", "OrderQty": 1000000.0},
+		{"Symbol": "GBP/USD", "Side": "Sell", "OrderQty": 500000.0},
+	}, decoded["RelatedSym"])
+
+	// tags following the group are decoded at the top level
+	assert.Equal(t, "end", decoded["Text"])
+	assert.NotContains(t, decoded, "Symbol")
+}
+
+func TestDecodeMassQuote(t *testing.T) {
+	fix, results := fixModForTests()
+
+	parseMessages(fix, "8=FIX.4.2|35=i|117=mq-1|296=2|"+
+		"302=set-1|311=ES|295=2|299=e1|132=99.5|133=100.25|299=e2|132=98|"+
+		"302=set-2|295=1|299=e3|133=101|134=10|")
+
+	decoded := expectEvent(t, results)["fix"].(common.MapStr)
+	assert.Equal(t, "mq-1", decoded["QuoteID"])
+	assert.Equal(t, []common.MapStr{
+		{
+			"QuoteSetID":       "set-1",
+			"UnderlyingSymbol": "ES",
+			"NoQuoteEntries":   "2",
+			"QuoteEntries": []common.MapStr{
+				{"QuoteEntryID": "e1", "BidPx": 99.5, "OfferPx": 100.25},
+				{"QuoteEntryID": "e2", "BidPx": 98.0},
+			},
+		},
+		{
+			"QuoteSetID":     "set-2",
+			"NoQuoteEntries": "1",
+			"QuoteEntries": []common.MapStr{
+				{"QuoteEntryID": "e3", "OfferPx": 101.0, "BidSize": 10},
+			},
+		},
+	}, decoded["QuoteSets"])
+}
+
+func TestDecodeQuoteCancel(t *testing.T) {
+	fix, results := fixModForTests()
+
+	parseMessages(fix, "8=FIX.4.4|35=Z|117=q-1|298=1|295=2|55=IBM|55=MSFT|")
+
+	decoded := expectEvent(t, results)["fix"].(common.MapStr)
+	assert.Equal(t, "Cancel for Symbol(s)", decoded["QuoteCancelType"])
+	assert.Equal(t, []common.MapStr{{"Symbol": "IBM"}, {"Symbol": "MSFT"}},
+		decoded["QuoteEntries"])
+}
+
+func TestDecodeQuote(t *testing.T) {
+	fix, results := fixModForTests()
+
+	parseMessages(fix, "8=FIX.4.4|35=S|131=rfq-1|117=q-1|55=EUR/USD|"+
+		"132=1.0871|133=1.0873|134=1000000|135=2000000|537=1|")
+
+	decoded := expectEvent(t, results)["fix"].(common.MapStr)
+	assert.Equal(t, "Quote", decoded["msg_type"])
+	assert.Equal(t, "EUR/USD", decoded["Symbol"])
+	assert.Equal(t, 1.0871, decoded["BidPx"])
+	assert.Equal(t, 1.0873, decoded["OfferPx"])
+	assert.Equal(t, 2000000.0, decoded["OfferSize"])
+	assert.Equal(t, "Tradeable", decoded["QuoteType"])
+}
+
+func TestDecodeGroupsOfOtherMsgTypes(t *testing.T) {
+	fix, results := fixModForTests()
+
+	// NoRelatedSym only starts a group in quote requests
+	parseMessages(fix, "8=FIX.4.2|35=V|146=1|55=IBM|")
+
+	decoded := expectEvent(t, results)["fix"].(common.MapStr)
+	assert.Equal(t, "IBM", decoded["Symbol"])
+	assert.NotContains(t, decoded, "RelatedSym")
+}
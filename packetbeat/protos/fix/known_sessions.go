@@ -0,0 +1,124 @@
+package fix
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+type knownSessionConfig struct {
+	Name         string   `config:"name" validate:"required"`
+	SenderCompID string   `config:"sender_comp_id"`
+	TargetCompID string   `config:"target_comp_id"`
+	IPs          []string `config:"ips"`
+	Ports        []int    `config:"ports"`
+}
+
+// knownSessions names the sessions expected on the network, by CompIDs and
+// endpoints. Rules are checked in order and the first rule matching a
+// session applies. Sessions not matched by any rule are unknown.
+type knownSessions struct {
+	rules []knownSessionRule
+}
+
+type knownSessionRule struct {
+	name                       string
+	senderCompID, targetCompID string
+	ips                        []*net.IPNet
+	ports                      map[uint16]bool
+}
+
+func (c *knownSessionConfig) Validate() error {
+	for _, ip := range c.IPs {
+		if _, err := parseIPNet(ip); err != nil {
+			return fmt.Errorf("invalid ip of session %s: %v", c.Name, err)
+		}
+	}
+	return nil
+}
+
+func newKnownSessions(configs []knownSessionConfig) *knownSessions {
+	if len(configs) == 0 {
+		return nil
+	}
+
+	k := &knownSessions{}
+	for _, c := range configs {
+		rule := knownSessionRule{
+			name:         c.Name,
+			senderCompID: c.SenderCompID,
+			targetCompID: c.TargetCompID,
+		}
+		for _, ip := range c.IPs {
+			// checked by Validate
+			ipNet, _ := parseIPNet(ip)
+			rule.ips = append(rule.ips, ipNet)
+		}
+		if len(c.Ports) > 0 {
+			rule.ports = map[uint16]bool{}
+			for _, port := range c.Ports {
+				rule.ports[uint16(port)] = true
+			}
+		}
+		k.rules = append(k.rules, rule)
+	}
+	return k
+}
+
+// lookup returns the name of the session identified by key, and false if
+// sessions are configured but none matches key. All sessions are known if
+// no session is configured.
+func (k *knownSessions) lookup(key sessionKey) (string, bool) {
+	if k == nil {
+		return "", true
+	}
+	for i := range k.rules {
+		rule := &k.rules[i]
+		if rule.matches(key) {
+			return rule.name, true
+		}
+	}
+	return "", false
+}
+
+// matches checks the rule CompIDs against both directions of the session,
+// and the rule IPs and ports against both endpoints of the connection.
+func (r *knownSessionRule) matches(key sessionKey) bool {
+	if r.ports != nil && !r.ports[key.src.Port] && !r.ports[key.dst.Port] {
+		return false
+	}
+	if r.ips != nil && !r.matchesIP(key.src.IP) && !r.matchesIP(key.dst.IP) {
+		return false
+	}
+	return matchSession(r.senderCompID, r.targetCompID, key.senderCompID, key.targetCompID)
+}
+
+func (r *knownSessionRule) matchesIP(s string) bool {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range r.ips {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIPNet parses an IP address, or a network in CIDR notation.
+func parseIPNet(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, ipNet, err := net.ParseCIDR(s)
+		return ipNet, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %s", s)
+	}
+	bits := 8 * net.IPv4len
+	if ip.To4() == nil {
+		bits = 8 * net.IPv6len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
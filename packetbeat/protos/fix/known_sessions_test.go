@@ -0,0 +1,112 @@
+// +build !integration
+
+package fix
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func TestKnownSessionsLookup(t *testing.T) {
+	k := newKnownSessions([]knownSessionConfig{
+		{Name: "Broker-A-Equities", SenderCompID: "CLIENT", TargetCompID: "BROKER_A",
+			IPs: []string{"10.0.0.2"}, Ports: []int{9878}},
+		{Name: "Drop-Copy", TargetCompID: "DROPCOPY", IPs: []string{"192.168.1.0/24"}},
+	})
+
+	key := func(sender, target, dstIP string, dstPort uint16) sessionKey {
+		return sessionKey{
+			senderCompID: sender,
+			targetCompID: target,
+			src:          common.Endpoint{IP: "10.0.0.1", Port: 40000},
+			dst:          common.Endpoint{IP: dstIP, Port: dstPort},
+		}
+	}
+
+	name, known := k.lookup(key("CLIENT", "BROKER_A", "10.0.0.2", 9878))
+	assert.True(t, known)
+	assert.Equal(t, "Broker-A-Equities", name)
+
+	// CompIDs match in either direction
+	name, known = k.lookup(key("BROKER_A", "CLIENT", "10.0.0.2", 9878))
+	assert.True(t, known)
+	assert.Equal(t, "Broker-A-Equities", name)
+
+	// the session is expected on another endpoint
+	_, known = k.lookup(key("CLIENT", "BROKER_A", "10.0.0.3", 9878))
+	assert.False(t, known)
+	_, known = k.lookup(key("CLIENT", "BROKER_A", "10.0.0.2", 9879))
+	assert.False(t, known)
+
+	name, known = k.lookup(key("ANY", "DROPCOPY", "192.168.1.20", 9000))
+	assert.True(t, known)
+	assert.Equal(t, "Drop-Copy", name)
+
+	_, known = k.lookup(key("CLIENT", "OTHER", "10.0.0.2", 9878))
+	assert.False(t, known)
+
+	// all sessions are known if none is configured
+	name, known = newKnownSessions(nil).lookup(key("CLIENT", "OTHER", "10.0.0.2", 9878))
+	assert.True(t, known)
+	assert.Equal(t, "", name)
+}
+
+func TestKnownSessionConfigValidate(t *testing.T) {
+	assert.NoError(t, (&knownSessionConfig{Name: "a", IPs: []string{"10.0.0.1", "::1", "10.0.0.0/8"}}).Validate())
+	assert.Error(t, (&knownSessionConfig{Name: "a", IPs: []string{"10.0.0"}}).Validate())
+	assert.Error(t, (&knownSessionConfig{Name: "a", IPs: []string{"10.0.0.0/33"}}).Validate())
+}
+
+func TestParseNamesKnownSession(t *testing.T) {
+	fix, results := fixModForTests()
+	fix.sessions = newKnownSessions([]knownSessionConfig{
+		{Name: "Broker-A-Equities", SenderCompID: "CLIENT", TargetCompID: "BROKER"},
+	})
+
+	private := parseSession(fix, nil,
+		directedMessage{initiator, "8=FIX.4.2|35=A|34=1|49=CLIENT|56=BROKER|108=30|"},
+		directedMessage{acceptor, "8=FIX.4.2|35=A|34=1|49=BROKER|56=CLIENT|108=30|"},
+	)
+
+	// both Logons and the established session event are named
+	assert.Len(t, results.Channel, 3)
+	for len(results.Channel) > 0 {
+		m := (<-results.Channel)["fix"].(common.MapStr)
+		assert.Equal(t, "Broker-A-Equities", m["session_name"])
+		assert.Nil(t, m["unknown_session"])
+	}
+
+	// the reloaded config applies to the open session
+	fix.sessions = newKnownSessions([]knownSessionConfig{{Name: "Other", SenderCompID: "OTHER"}})
+	parseSession(fix, private,
+		directedMessage{initiator, "8=FIX.4.2|35=0|34=2|49=CLIENT|56=BROKER|"})
+	heartbeat := expectEvent(t, results)["fix"].(common.MapStr)
+	assert.Nil(t, heartbeat["session_name"])
+	assert.Equal(t, true, heartbeat["unknown_session"])
+}
+
+func TestParseFlagsUnknownSession(t *testing.T) {
+	fix, results := fixModForTests()
+	fix.sessions = newKnownSessions([]knownSessionConfig{
+		{Name: "Broker-A-Equities", SenderCompID: "CLIENT", TargetCompID: "BROKER"},
+	})
+
+	before := unknownSessions.Value()
+	parseSession(fix, nil,
+		directedMessage{initiator, "8=FIX.4.2|35=A|34=1|49=ROGUE|56=BROKER|108=30|"},
+		directedMessage{acceptor, "8=FIX.4.2|35=A|34=1|49=BROKER|56=ROGUE|108=30|"},
+	)
+
+	assert.Len(t, results.Channel, 3)
+	for len(results.Channel) > 0 {
+		m := (<-results.Channel)["fix"].(common.MapStr)
+		assert.Equal(t, true, m["unknown_session"])
+		assert.Nil(t, m["session_name"])
+	}
+
+	// counted once per session
+	assert.Equal(t, before+1, unknownSessions.Value())
+}
@@ -0,0 +1,112 @@
+package fix
+
+import (
+	"time"
+)
+
+const (
+	msgTypeExecutionReport = "8"
+	msgTypeNewOrderSingle  = "D"
+
+	tagClOrdID = 11
+)
+
+// maxPendingOrders limits the number of unacknowledged orders, and of
+// unanswered quote requests, tracked per connection and direction.
+const maxPendingOrders = 10000
+
+// pendingTimeout is the time after which unanswered requests are forgotten,
+// once maxPendingOrders is reached.
+const pendingTimeout = time.Minute
+
+// latencyTracker matches NewOrderSingle messages to their first
+// ExecutionReport by ClOrdID, measuring the time to acknowledge an order, and
+// QuoteRequest messages to their first Quote or MassQuote by QuoteReqID,
+// measuring the time to quote.
+type latencyTracker struct {
+	// capture time of unacknowledged orders by ClOrdID, per direction the
+	// orders have been sent in
+	pending [2]map[string]time.Time
+
+	// capture time of unanswered quote requests by QuoteReqID, per direction
+	// the requests have been sent in
+	quoteRequests [2]map[string]time.Time
+}
+
+// onMessage records orders and quote requests, and returns the latency when
+// msg is the first ExecutionReport for an order or the first quote for a
+// quote request sent in the opposite direction.
+func (l *latencyTracker) onMessage(dir uint8, msg *message) (time.Duration, bool) {
+	msgType, _ := msg.fields.get(tagMsgType)
+	switch msgType {
+	case msgTypeNewOrderSingle:
+		l.pending[dir] = addPending(l.pending[dir], msg, tagClOrdID)
+	case msgTypeExecutionReport:
+		return matchPending(l.pending[1-dir], msg, tagClOrdID)
+	case msgTypeQuoteRequest:
+		l.quoteRequests[dir] = addPending(l.quoteRequests[dir], msg, tagQuoteReqID)
+	case msgTypeQuote, msgTypeMassQuote:
+		return matchPending(l.quoteRequests[1-dir], msg, tagQuoteReqID)
+	}
+	return 0, false
+}
+
+// addPending records the capture time of a request by the value of its
+// identifier tag, creating the map of pending requests if needed.
+func addPending(pending map[string]time.Time, msg *message, tag int) map[string]time.Time {
+	id, ok := msg.fields.get(tag)
+	if !ok {
+		return pending
+	}
+	if pending == nil {
+		pending = map[string]time.Time{}
+	}
+	if _, ok := pending[id]; !ok && len(pending) >= maxPendingOrders {
+		expirePending(pending, msg.ts)
+	}
+	pending[id] = msg.ts
+	return pending
+}
+
+// expirePending forgets the requests unanswered for pendingTimeout at ts, or
+// else the oldest request, making room for a new request.
+func expirePending(pending map[string]time.Time, ts time.Time) {
+	expired := 0
+	var oldestID string
+	var oldest time.Time
+	for id, sent := range pending {
+		if ts.Sub(sent) >= pendingTimeout {
+			delete(pending, id)
+			expired++
+			continue
+		}
+		if oldestID == "" || sent.Before(oldest) {
+			oldestID, oldest = id, sent
+		}
+	}
+	if expired > 0 {
+		expiredRequests.Add(int64(expired))
+		return
+	}
+
+	delete(pending, oldestID)
+	unmatchedOrders.Add(1)
+	if isDebug {
+		debugf("too many unanswered requests, forget the oldest %v", oldestID)
+	}
+}
+
+// matchPending returns the time since the request answered by msg, matched by
+// the value of the identifier tag, and forgets the request.
+func matchPending(pending map[string]time.Time, msg *message, tag int) (time.Duration, bool) {
+	id, ok := msg.fields.get(tag)
+	if !ok {
+		return 0, false
+	}
+	ts, ok := pending[id]
+	if !ok {
+		return 0, false
+	}
+	delete(pending, id)
+	return msg.ts.Sub(ts), true
+}
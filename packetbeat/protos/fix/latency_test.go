@@ -0,0 +1,132 @@
+// +build !integration
+
+package fix
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/packetbeat/protos"
+)
+
+func TestOrderAckLatency(t *testing.T) {
+	fix, results := fixModForTests()
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+
+	var private protos.ProtocolData
+	for _, m := range []struct {
+		dir    uint8
+		offset time.Duration
+		msg    string
+	}{
+		{initiator, 0, "8=FIX.4.2|35=D|34=2|11=order-1|"},
+		{initiator, 100 * time.Microsecond, "8=FIX.4.2|35=D|34=3|11=order-2|"},
+		{acceptor, 350 * time.Microsecond, "8=FIX.4.2|35=8|34=2|11=order-1|150=0|"},
+		{acceptor, 900 * time.Microsecond, "8=FIX.4.2|35=8|34=3|11=order-1|150=2|"},
+	} {
+		pkt := &protos.Packet{Ts: ts.Add(m.offset), Payload: fixMessage(m.msg)}
+		private = fix.Parse(pkt, &sessionTuple, m.dir, private)
+	}
+
+	for i := 0; i < 2; i++ {
+		assert.NotContains(t, expectEvent(t, results)["fix"], "latency_us")
+	}
+
+	ack := expectEvent(t, results)["fix"].(common.MapStr)
+	assert.Equal(t, int64(350), ack["latency_us"])
+
+	// only the first ExecutionReport acknowledges the order
+	fill := expectEvent(t, results)["fix"].(common.MapStr)
+	assert.NotContains(t, fill, "latency_us")
+
+	pending := private.(*fixConnectionData).latency.pending[initiator]
+	assert.Contains(t, pending, "order-2")
+	assert.NotContains(t, pending, "order-1")
+}
+
+func TestOrderAckLatencyIgnoresSameDirection(t *testing.T) {
+	var l latencyTracker
+	order := &message{fields: splitFields(fixMessage("8=FIX.4.2|35=D|11=order-1|"))}
+	report := &message{fields: splitFields(fixMessage("8=FIX.4.2|35=8|11=order-1|"))}
+
+	l.onMessage(initiator, order)
+	_, ok := l.onMessage(initiator, report)
+	assert.False(t, ok)
+
+	_, ok = l.onMessage(acceptor, report)
+	assert.True(t, ok)
+}
+
+func TestQuoteRequestLatency(t *testing.T) {
+	var l latencyTracker
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+	request := &message{ts: ts,
+		fields: splitFields(fixMessage("8=FIX.4.4|35=R|131=rfq-1|146=1|55=EUR/USD|"))}
+	quote := &message{ts: ts.Add(2 * time.Millisecond),
+		fields: splitFields(fixMessage("8=FIX.4.4|35=S|131=rfq-1|117=q-1|"))}
+
+	_, ok := l.onMessage(initiator, request)
+	assert.False(t, ok)
+
+	latency, ok := l.onMessage(acceptor, quote)
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Millisecond, latency)
+
+	// only the first quote answers the request
+	_, ok = l.onMessage(acceptor, quote)
+	assert.False(t, ok)
+	assert.Empty(t, l.quoteRequests[initiator])
+}
+
+func TestMassQuoteLatency(t *testing.T) {
+	var l latencyTracker
+	request := &message{fields: splitFields(fixMessage("8=FIX.4.2|35=R|131=rfq-1|"))}
+	quote := &message{fields: splitFields(fixMessage("8=FIX.4.2|35=i|131=rfq-1|117=mq-1|"))}
+
+	l.onMessage(acceptor, request)
+	_, ok := l.onMessage(acceptor, quote)
+	assert.False(t, ok)
+
+	_, ok = l.onMessage(initiator, quote)
+	assert.True(t, ok)
+}
+
+func TestLatencyOfRequestsBeyondLimit(t *testing.T) {
+	var l latencyTracker
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < maxPendingOrders; i++ {
+		l.onMessage(initiator, &message{ts: ts, fields: tagValues{
+			{tag: tagMsgType, value: msgTypeNewOrderSingle},
+			{tag: tagClOrdID, value: fmt.Sprintf("order-%d", i)},
+		}})
+	}
+	assert.Len(t, l.pending[initiator], maxPendingOrders)
+
+	// the oldest order is forgotten for a new order
+	order := &message{ts: ts.Add(time.Second),
+		fields: splitFields(fixMessage("8=FIX.4.2|35=D|11=new-order|"))}
+	ack := &message{ts: ts.Add(time.Second + 300*time.Microsecond),
+		fields: splitFields(fixMessage("8=FIX.4.2|35=8|11=new-order|150=0|"))}
+	evicted := unmatchedOrders.Value()
+	l.onMessage(initiator, order)
+	latency, ok := l.onMessage(acceptor, ack)
+	assert.True(t, ok)
+	assert.Equal(t, 300*time.Microsecond, latency)
+	assert.Equal(t, evicted+1, unmatchedOrders.Value())
+
+	// requests unanswered for the timeout are all forgotten
+	order.ts, ack.ts = ts.Add(2*time.Minute), ts.Add(2*time.Minute+time.Millisecond)
+	expired := expiredRequests.Value()
+	l.onMessage(initiator, order)
+	l.onMessage(initiator, &message{ts: order.ts,
+		fields: splitFields(fixMessage("8=FIX.4.2|35=D|11=other-order|"))})
+	latency, ok = l.onMessage(acceptor, ack)
+	assert.True(t, ok)
+	assert.Equal(t, time.Millisecond, latency)
+	assert.Equal(t, expired+maxPendingOrders-1, expiredRequests.Value())
+	assert.Len(t, l.pending[initiator], 1)
+}
@@ -0,0 +1,272 @@
+package fix
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/packetbeat/publish"
+)
+
+type liveConfig struct {
+	Enabled   bool   `config:"enabled"`
+	Host      string `config:"host"`
+	QueueSize int    `config:"queue_size" validate:"min=1"`
+
+	// origins of the web pages allowed to connect, like
+	// https://kibana.example.com, in addition to the pages served by the host
+	AllowedOrigins []string `config:"allowed_origins"`
+}
+
+var defaultLiveConfig = liveConfig{
+	Host:      "localhost:9480",
+	QueueSize: 1000,
+}
+
+// liveWriteTimeout bounds the time to send an event to a client, clients
+// not reading being disconnected.
+const liveWriteTimeout = 5 * time.Second
+
+// liveTail streams the events published to the websocket clients of /live as
+// JSON, for tailing the messages in a browser during incidents, without
+// waiting for them to be indexed. The clients select the events with the
+// session and msgtype query parameters, like /live?session=lse&msgtype=8.
+// Events are dropped for the clients not keeping up.
+type liveTail struct {
+	// clients connected, checked for each event without locking
+	clientCount int32
+
+	mutex     sync.Mutex
+	host      string
+	listener  net.Listener
+	queueSize int
+	origins   map[string]bool
+	clients   map[*liveClient]struct{}
+}
+
+type liveClient struct {
+	ws *websocket.Conn
+
+	// sessions, matching session_name or session_key, and MsgTypes of the
+	// events streamed, all if nil
+	sessions map[string]bool
+	msgTypes map[string]bool
+
+	out chan []byte
+}
+
+// livePublisher publishes the events to the live tail before publishing them
+// to the outputs.
+type livePublisher struct {
+	publish.Transactions
+}
+
+var (
+	live = &liveTail{clients: map[*liveClient]struct{}{}}
+
+	liveClients = expvar.NewInt("fix.live.clients")
+	liveDropped = expvar.NewInt("fix.live.dropped")
+)
+
+func (p livePublisher) PublishTransaction(event common.MapStr) bool {
+	live.publish(event, "")
+	return p.Transactions.PublishTransaction(event)
+}
+
+// publishMessage publishes the event of a message. The live tail selects it
+// by the MsgType of the message, as fields_mapping can rename or drop the
+// MsgType field of the event.
+func (p livePublisher) publishMessage(event common.MapStr, msg *message) bool {
+	msgType, _ := msg.fields.get(tagMsgType)
+	live.publish(event, msgType)
+	return p.Transactions.PublishTransaction(event)
+}
+
+// configure starts serving /live on the host if enabled, and stops serving
+// it if not. The clients connected are kept while the host is the same.
+func (l *liveTail) configure(config liveConfig) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.queueSize = config.QueueSize
+	l.origins = map[string]bool{}
+	for _, origin := range config.AllowedOrigins {
+		l.origins[strings.ToLower(strings.TrimRight(origin, "/"))] = true
+	}
+	if l.listener != nil && (!config.Enabled || config.Host != l.host) {
+		l.stop()
+	}
+	if !config.Enabled || l.listener != nil {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", config.Host)
+	if err != nil {
+		return err
+	}
+	l.host = config.Host
+	l.listener = listener
+
+	mux := http.NewServeMux()
+	mux.Handle("/live", websocket.Server{Handler: l.serve, Handshake: l.checkOrigin})
+	go http.Serve(listener, mux)
+	logp.Info("FIX live tail serving ws://%v/live", listener.Addr())
+	return nil
+}
+
+// checkOrigin rejects the connections of web pages not served by the host or
+// an allowed origin, for pages opened in the browsers of the hosts not to
+// read the live messages. Clients other than browsers may not set an Origin.
+func (l *liveTail) checkOrigin(config *websocket.Config, req *http.Request) error {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return err
+	}
+	config.Origin = u
+	if strings.EqualFold(u.Host, req.Host) {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.origins[strings.ToLower(u.Scheme+"://"+u.Host)] {
+		return nil
+	}
+	logp.Warn("FIX live tail connection from origin %s rejected", origin)
+	return fmt.Errorf("origin %s not allowed", origin)
+}
+
+// stop closes the listener and the connections of the clients.
+func (l *liveTail) stop() {
+	l.listener.Close()
+	l.listener = nil
+	for c := range l.clients {
+		c.ws.Close()
+	}
+	logp.Info("FIX live tail stopped")
+}
+
+func (l *liveTail) serve(ws *websocket.Conn) {
+	query := ws.Request().URL.Query()
+	c := &liveClient{
+		ws:       ws,
+		sessions: queryValues(query, "session"),
+		msgTypes: queryValues(query, "msgtype"),
+	}
+
+	l.mutex.Lock()
+	if l.listener == nil {
+		l.mutex.Unlock()
+		return
+	}
+	c.out = make(chan []byte, l.queueSize)
+	l.clients[c] = struct{}{}
+	atomic.AddInt32(&l.clientCount, 1)
+	l.mutex.Unlock()
+	liveClients.Add(1)
+	debugf("live tail client %v connected", ws.Request().RemoteAddr)
+
+	defer func() {
+		l.mutex.Lock()
+		delete(l.clients, c)
+		atomic.AddInt32(&l.clientCount, -1)
+		l.mutex.Unlock()
+		liveClients.Add(-1)
+		debugf("live tail client %v disconnected", ws.Request().RemoteAddr)
+	}()
+
+	// the client sends nothing, reading returns once it disconnects
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(ioutil.Discard, ws)
+		close(closed)
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case msg := <-c.out:
+			ws.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+			if err := websocket.Message.Send(ws, string(msg)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// queryValues returns the set of values of a query parameter, repeated or
+// separated by commas, nil if not set.
+func queryValues(query url.Values, name string) map[string]bool {
+	var set map[string]bool
+	for _, param := range query[name] {
+		for _, v := range strings.Split(param, ",") {
+			if v = strings.TrimSpace(v); v == "" {
+				continue
+			}
+			if set == nil {
+				set = map[string]bool{}
+			}
+			set[v] = true
+		}
+	}
+	return set
+}
+
+// publish queues the event for the clients it matches, encoded before it is
+// handed to the publisher pipeline. msgType is empty for the events not
+// reporting a message.
+func (l *liveTail) publish(event common.MapStr, msgType string) {
+	if atomic.LoadInt32(&l.clientCount) == 0 {
+		return
+	}
+
+	var name, key string
+	if fields, ok := event["fix"].(common.MapStr); ok {
+		name, _ = fields["session_name"].(string)
+		key, _ = fields["session_key"].(string)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var encoded []byte
+	for c := range l.clients {
+		if c.sessions != nil && !c.sessions[name] && !c.sessions[key] {
+			continue
+		}
+		if c.msgTypes != nil && !c.msgTypes[msgType] {
+			continue
+		}
+
+		if encoded == nil {
+			var err error
+			if encoded, err = json.Marshal(event); err != nil {
+				logp.Err("Failed to convert the event to JSON for the live tail: %v", err)
+				return
+			}
+		}
+		select {
+		case c.out <- encoded:
+		default:
+			liveDropped.Add(1)
+		}
+	}
+}
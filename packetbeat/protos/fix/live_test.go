@@ -0,0 +1,152 @@
+// +build !integration
+
+package fix
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func dialLive(t *testing.T, query string) *websocket.Conn {
+	addr := live.listener.Addr().String()
+	ws, err := websocket.Dial("ws://"+addr+"/live"+query, "", "http://"+addr+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ws
+}
+
+func dialLiveFrom(origin string) error {
+	addr := live.listener.Addr().String()
+	ws, err := websocket.Dial("ws://"+addr+"/live", "", origin)
+	if err == nil {
+		ws.Close()
+	}
+	return err
+}
+
+func waitLiveClients(t *testing.T, n int32) {
+	for i := 0; i < 500; i++ {
+		if atomic.LoadInt32(&live.clientCount) == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("live tail clients not connected")
+}
+
+func readLive(t *testing.T, ws *websocket.Conn) common.MapStr {
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg string
+	if err := websocket.Message.Receive(ws, &msg); err != nil {
+		t.Fatal(err)
+	}
+	var event common.MapStr
+	assert.NoError(t, json.Unmarshal([]byte(msg), &event))
+	return event
+}
+
+func TestLiveTail(t *testing.T) {
+	// the plugin configures the live tail, disabled by default
+	fix, results := fixModForTests()
+	config := defaultLiveConfig
+	config.Enabled = true
+	config.Host = "127.0.0.1:0"
+	if err := live.configure(config); err != nil {
+		t.Fatal(err)
+	}
+	defer live.configure(defaultLiveConfig)
+
+	all := dialLive(t, "")
+	defer all.Close()
+	fills := dialLive(t, "?session=lse&msgtype=8,9")
+	defer fills.Close()
+	waitLiveClients(t, 2)
+
+	for i, fields := range []common.MapStr{
+		{"session_name": "lse", "MsgType": "D"},
+		{"session_name": "ice", "MsgType": "8"},
+		{"session_name": "lse", "MsgType": "8"},
+	} {
+		msg := &message{fields: splitFields(fixMessage("8=FIX.4.2|35=" + fields["MsgType"].(string) + "|"))}
+		fix.results.publishMessage(common.MapStr{"id": i, "fix": fields}, msg)
+	}
+	// the events are published to the outputs too
+	assert.Len(t, results.Channel, 3)
+
+	for _, id := range []float64{0, 1, 2} {
+		assert.Equal(t, id, readLive(t, all)["id"])
+	}
+	assert.Equal(t, float64(2), readLive(t, fills)["id"])
+
+	fills.Close()
+	waitLiveClients(t, 1)
+
+	// the clients are disconnected once disabled
+	live.configure(defaultLiveConfig)
+	waitLiveClients(t, 0)
+	assert.Nil(t, live.listener)
+}
+
+func TestLiveTailFieldsMapping(t *testing.T) {
+	// the MsgType field is dropped, only mapped tags being published
+	fix, _ := fixModForTests(func(c *fixConfig) {
+		c.FieldsMapping = []mappingConfig{{Tag: 11, Name: "order_id"}}
+		c.FieldsMappingOnly = true
+	})
+	config := defaultLiveConfig
+	config.Enabled = true
+	config.Host = "127.0.0.1:0"
+	if err := live.configure(config); err != nil {
+		t.Fatal(err)
+	}
+	defer live.configure(defaultLiveConfig)
+
+	fills := dialLive(t, "?msgtype=8")
+	defer fills.Close()
+	waitLiveClients(t, 1)
+
+	parseMessages(fix,
+		"8=FIX.4.2|35=D|34=2|11=order-1|",
+		"8=FIX.4.2|35=8|34=2|11=order-1|")
+
+	event := readLive(t, fills)["fix"].(map[string]interface{})
+	assert.Equal(t, "Execution Report", event["msg_type"])
+	assert.Equal(t, "order-1", event["order_id"])
+	assert.NotContains(t, event, "MsgType")
+}
+
+func TestLiveTailOrigins(t *testing.T) {
+	config := defaultLiveConfig
+	config.Enabled = true
+	config.Host = "127.0.0.1:0"
+	config.AllowedOrigins = []string{"https://Kibana.example.com/"}
+	if err := live.configure(config); err != nil {
+		t.Fatal(err)
+	}
+	defer live.configure(defaultLiveConfig)
+
+	// pages of other sites opened in a browser can not connect
+	assert.Error(t, dialLiveFrom("http://evil.example.com"))
+	assert.Error(t, dialLiveFrom("http://kibana.example.com"))
+	assert.NoError(t, dialLiveFrom("https://kibana.example.com"))
+	assert.NoError(t, dialLiveFrom("http://"+live.listener.Addr().String()))
+}
+
+func TestQueryValues(t *testing.T) {
+	query := map[string][]string{
+		"session": {"lse,ice", " cme "},
+		"msgtype": {""},
+	}
+	assert.Equal(t, map[string]bool{"lse": true, "ice": true, "cme": true},
+		queryValues(query, "session"))
+	assert.Nil(t, queryValues(query, "msgtype"))
+	assert.Nil(t, queryValues(query, "tenant"))
+}
@@ -0,0 +1,113 @@
+package fix
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+const tagSendingTime = 52
+
+type mappingConfig struct {
+	Tag  int    `config:"tag" validate:"required, min=1"`
+	Name string `config:"name"`
+	Type string `config:"type"`
+}
+
+// fieldMapper renames and converts the tags published with message events,
+// optionally publishing the mapped tags only.
+type fieldMapper struct {
+	rules      map[int]*mappingConfig
+	mappedOnly bool
+}
+
+func (c *mappingConfig) Validate() error {
+	if c.Name == "" && c.Type == "" {
+		return errors.New("fields_mapping requires name or type")
+	}
+	switch c.Type {
+	case "", "string", "long", "float", "boolean":
+		return nil
+	}
+	return fmt.Errorf("invalid fields_mapping type: %s, must be one of string, long, float or boolean", c.Type)
+}
+
+func newFieldMapper(configs []mappingConfig, mappedOnly bool) *fieldMapper {
+	if len(configs) == 0 && !mappedOnly {
+		return nil
+	}
+
+	m := &fieldMapper{rules: map[int]*mappingConfig{}, mappedOnly: mappedOnly}
+	for i := range configs {
+		m.rules[configs[i].Tag] = &configs[i]
+	}
+	return m
+}
+
+// decode returns the field name and value of f as published, decoding tags
+// not mapped by dict. Tags unknown to dict are only published if they are
+// given a name. The third return value is false if the tag is not published.
+func (m *fieldMapper) decode(dict *dictionary, f tagValue) (string, interface{}, bool) {
+	if m == nil {
+		return dict.decode(f.tag, f.value)
+	}
+
+	rule := m.rules[f.tag]
+	if rule == nil {
+		if m.mappedOnly {
+			return "", nil, false
+		}
+		return dict.decode(f.tag, f.value)
+	}
+
+	field, known := dict.field(f.tag)
+	name := rule.Name
+	if name == "" {
+		if !known {
+			return "", nil, false
+		}
+		name = field.name
+	}
+
+	if rule.Type != "" {
+		value, err := convertValue(rule.Type, f.value)
+		if err != nil {
+			debugf("invalid %v value for tag %v: %q", rule.Type, f.tag, f.value)
+			return "", nil, false
+		}
+		return name, value, true
+	}
+	if !known {
+		return name, f.value, true
+	}
+	_, value, ok := dict.decode(f.tag, f.value)
+	return name, value, ok
+}
+
+// convertValue converts the raw value of a tag to typ. Enumerated values are
+// kept as sent.
+func convertValue(typ, value string) (interface{}, error) {
+	switch typ {
+	case "long":
+		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return v, nil
+		}
+		// quantities might be sent with decimals, like 100.0
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || v != float64(int64(v)) {
+			return nil, fmt.Errorf("invalid long value: %q", value)
+		}
+		return int64(v), nil
+	case "float":
+		return strconv.ParseFloat(value, 64)
+	case "boolean":
+		switch value {
+		case "Y":
+			return true, nil
+		case "N":
+			return false, nil
+		}
+		return nil, fmt.Errorf("invalid boolean value: %q", value)
+	}
+	return value, nil
+}
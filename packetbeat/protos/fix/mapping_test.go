@@ -0,0 +1,106 @@
+// +build !integration
+
+package fix
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func parseMapped(t *testing.T, configs []mappingConfig, only bool, msg string) common.MapStr {
+	config := defaultConfig
+	config.FieldsMapping = configs
+	config.FieldsMappingOnly = only
+
+	var fix fixPlugin
+	_, results := fixModForTests()
+	fix.init(results, &config)
+
+	parseMessages(&fix, msg)
+	return expectEvent(t, results)["fix"].(common.MapStr)
+}
+
+func TestFieldsMapping(t *testing.T) {
+	event := parseMapped(t, []mappingConfig{
+		{Tag: 55, Name: "symbol"},
+		{Tag: 38, Name: "order_qty", Type: "long"},
+		{Tag: 54, Type: "string"},
+		{Tag: 5001, Name: "desk"},
+	}, false, "8=FIX.4.2|35=D|34=2|11=order-1|55=IBM|38=100.0|44=101.25|54=1|5001=EQ|")
+
+	assert.Equal(t, "IBM", event["symbol"])
+	assert.NotContains(t, event, "Symbol")
+	assert.Equal(t, int64(100), event["order_qty"])
+	assert.Equal(t, "1", event["Side"])
+	assert.Equal(t, "EQ", event["desk"])
+
+	// tags not mapped are decoded as before
+	assert.Equal(t, "order-1", event["ClOrdID"])
+	assert.Equal(t, 101.25, event["Price"])
+	assert.Equal(t, "Order - Single", event["msg_type"])
+}
+
+func TestFieldsMappingOnly(t *testing.T) {
+	event := parseMapped(t, []mappingConfig{
+		{Tag: 55, Name: "symbol"},
+		{Tag: 44, Type: "float"},
+	}, true, "8=FIX.4.2|35=D|34=2|11=order-1|55=IBM|44=101.25|")
+
+	// the times of the message are published as well
+	assert.Contains(t, event, "time")
+	delete(event, "time")
+	assert.Equal(t, common.MapStr{
+		"version":      "FIX.4.2",
+		"appl_version": "FIX.4.2",
+		"msg_type":     "Order - Single",
+		"symbol":       "IBM",
+		"Price":        101.25,
+	}, event)
+}
+
+func TestFieldsMappingInvalidValue(t *testing.T) {
+	event := parseMapped(t, []mappingConfig{
+		{Tag: 38, Type: "long"},
+		{Tag: 43, Type: "boolean"},
+	}, false, "8=FIX.4.2|35=D|34=2|43=1|38=10.5|")
+
+	assert.NotContains(t, event, "OrderQty")
+	assert.NotContains(t, event, "PossDupFlag")
+	assert.Equal(t, "Order - Single", event["msg_type"])
+}
+
+func TestConvertValue(t *testing.T) {
+	tests := []struct {
+		typ, value string
+		expected   interface{}
+	}{
+		{"long", "42", int64(42)},
+		{"long", "42.0", int64(42)},
+		{"float", "1.5", 1.5},
+		{"boolean", "Y", true},
+		{"boolean", "N", false},
+		{"string", "2", "2"},
+	}
+	for _, test := range tests {
+		v, err := convertValue(test.typ, test.value)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, v)
+	}
+
+	for _, invalid := range []struct{ typ, value string }{
+		{"long", "1.5"}, {"long", "x"}, {"float", "x"}, {"boolean", "1"},
+	} {
+		_, err := convertValue(invalid.typ, invalid.value)
+		assert.Error(t, err, "%v %q", invalid.typ, invalid.value)
+	}
+}
+
+func TestMappingConfigValidate(t *testing.T) {
+	assert.NoError(t, (&mappingConfig{Tag: 55, Name: "symbol"}).Validate())
+	assert.NoError(t, (&mappingConfig{Tag: 38, Type: "long"}).Validate())
+	assert.Error(t, (&mappingConfig{Tag: 55}).Validate())
+	assert.Error(t, (&mappingConfig{Tag: 38, Type: "int"}).Validate())
+}
@@ -0,0 +1,80 @@
+package fix
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+type maskConfig struct {
+	Tags   []int  `config:"tags" validate:"required"`
+	Method string `config:"method"`
+	Length int    `config:"length" validate:"min=0"`
+	Salt   string `config:"salt"`
+}
+
+// masker hides the values of configured tags, like customer identifiers,
+// before messages are decoded and published.
+type masker struct {
+	rules map[int]*maskConfig
+}
+
+func (c *maskConfig) Validate() error {
+	switch c.Method {
+	case "hash", "truncate", "drop":
+		return nil
+	}
+	return fmt.Errorf("invalid mask method: %s, must be one of hash, truncate or drop", c.Method)
+}
+
+func newMasker(configs []maskConfig) *masker {
+	if len(configs) == 0 {
+		return nil
+	}
+
+	m := &masker{rules: map[int]*maskConfig{}}
+	for i := range configs {
+		for _, tag := range configs[i].Tags {
+			m.rules[tag] = &configs[i]
+		}
+	}
+	return m
+}
+
+// apply returns the fields with masked values. Fields are only copied if a
+// tag is masked.
+func (m *masker) apply(fields tagValues) tagValues {
+	if m == nil {
+		return fields
+	}
+
+	var masked tagValues
+	for i, f := range fields {
+		rule, found := m.rules[f.tag]
+		if !found {
+			if masked != nil {
+				masked = append(masked, f)
+			}
+			continue
+		}
+
+		if masked == nil {
+			masked = append(make(tagValues, 0, len(fields)), fields[:i]...)
+		}
+		switch rule.Method {
+		case "hash":
+			sum := sha256.Sum256([]byte(rule.Salt + f.value))
+			masked = append(masked, tagValue{tag: f.tag, value: hex.EncodeToString(sum[:])})
+		case "truncate":
+			if len(f.value) > rule.Length {
+				f.value = f.value[:rule.Length]
+			}
+			masked = append(masked, f)
+		}
+	}
+
+	if masked == nil {
+		return fields
+	}
+	return masked
+}
@@ -0,0 +1,66 @@
+// +build !integration
+
+package fix
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func TestMaskerApply(t *testing.T) {
+	m := newMasker([]maskConfig{
+		{Tags: []int{1, 109}, Method: "hash", Salt: "s"},
+		{Tags: []int{58}, Method: "truncate", Length: 4},
+		{Tags: []int{50}, Method: "drop"},
+	})
+
+	fields := splitFields(fixMessage("8=FIX.4.2|35=D|1=ACC-1|50=trader|58=hello world|109=C1|"))
+	masked := m.apply(fields)
+
+	account, _ := masked.get(1)
+	assert.Len(t, account, 64)
+	assert.NotEqual(t, "ACC-1", account)
+	text, _ := masked.get(58)
+	assert.Equal(t, "hell", text)
+	_, found := masked.get(50)
+	assert.False(t, found)
+	msgType, _ := masked.get(35)
+	assert.Equal(t, "D", msgType)
+
+	// hashes are stable, so masked identifiers can still be correlated
+	again := m.apply(splitFields(fixMessage("8=FIX.4.2|35=8|1=ACC-1|")))
+	hashed, _ := again.get(1)
+	assert.Equal(t, account, hashed)
+
+	// the original fields are left unchanged
+	value, _ := fields.get(1)
+	assert.Equal(t, "ACC-1", value)
+}
+
+func TestMaskerNoRules(t *testing.T) {
+	fields := splitFields(fixMessage("8=FIX.4.2|35=0|"))
+	assert.Equal(t, fields, newMasker(nil).apply(fields))
+}
+
+func TestParseMasksTags(t *testing.T) {
+	config := defaultConfig
+	config.Mask = []maskConfig{{Tags: []int{1}, Method: "drop"}}
+
+	var fix fixPlugin
+	_, results := fixModForTests()
+	fix.init(results, &config)
+
+	parseMessages(&fix, "8=FIX.4.2|35=D|34=2|1=ACC-1|11=order-1|")
+
+	event := expectEvent(t, results)["fix"].(common.MapStr)
+	assert.NotContains(t, event, "Account")
+	assert.Equal(t, "order-1", event["ClOrdID"])
+}
+
+func TestMaskConfigValidate(t *testing.T) {
+	assert.NoError(t, (&maskConfig{Tags: []int{1}, Method: "hash"}).Validate())
+	assert.Error(t, (&maskConfig{Tags: []int{1}, Method: "encrypt"}).Validate())
+}
@@ -0,0 +1,65 @@
+package fix
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// soh is the field delimiter of the FIX tag=value encoding.
+const soh = '\x01'
+
+type tagValue struct {
+	tag   int
+	value string
+}
+
+// tagValues holds the fields of a message in wire order.
+type tagValues []tagValue
+
+// splitFields splits a tag=value encoded buffer into its fields. Fields
+// having no valid numeric tag are ignored.
+func splitFields(buf []byte) tagValues {
+	var fields tagValues
+	for len(buf) > 0 {
+		var part []byte
+		if end := bytes.IndexByte(buf, soh); end < 0 {
+			part, buf = buf, nil
+		} else {
+			part, buf = buf[:end], buf[end+1:]
+		}
+
+		eq := bytes.IndexByte(part, '=')
+		if eq <= 0 {
+			continue
+		}
+		tag, err := strconv.Atoi(string(part[:eq]))
+		if err != nil {
+			continue
+		}
+		fields = append(fields, tagValue{tag: tag, value: string(part[eq+1:])})
+	}
+	return fields
+}
+
+// get returns the value of the first occurrence of tag.
+func (fields tagValues) get(tag int) (string, bool) {
+	for _, f := range fields {
+		if f.tag == tag {
+			return f.value, true
+		}
+	}
+	return "", false
+}
+
+// encode formats the fields in tag=value encoding, each field terminated by
+// sep.
+func (fields tagValues) encode(sep byte) []byte {
+	var buf bytes.Buffer
+	for _, f := range fields {
+		buf.WriteString(strconv.Itoa(f.tag))
+		buf.WriteByte('=')
+		buf.WriteString(f.value)
+		buf.WriteByte(sep)
+	}
+	return buf.Bytes()
+}
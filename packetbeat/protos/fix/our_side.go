@@ -0,0 +1,87 @@
+package fix
+
+import (
+	"fmt"
+	"net"
+)
+
+// Directions of messages from the point of view of our side.
+const (
+	directionInbound  = "inbound"
+	directionOutbound = "outbound"
+)
+
+type ourSideConfig struct {
+	CompIDs []string `config:"comp_ids"`
+	IPs     []string `config:"ips"`
+}
+
+// ourSide identifies the CompIDs and hosts of the firm running the capture,
+// to tell the messages it sends from the messages it receives.
+type ourSide struct {
+	compIDs map[string]bool
+	ips     []*net.IPNet
+}
+
+func (c *ourSideConfig) Validate() error {
+	for _, ip := range c.IPs {
+		if _, err := parseIPNet(ip); err != nil {
+			return fmt.Errorf("invalid ip of our_side: %v", err)
+		}
+	}
+	return nil
+}
+
+func newOurSide(config ourSideConfig) *ourSide {
+	if len(config.CompIDs) == 0 && len(config.IPs) == 0 {
+		return nil
+	}
+
+	o := &ourSide{compIDs: stringSet(config.CompIDs)}
+	for _, ip := range config.IPs {
+		// checked by Validate
+		ipNet, _ := parseIPNet(ip)
+		o.ips = append(o.ips, ipNet)
+	}
+	return o
+}
+
+// direction returns outbound for messages sent by our side and inbound for
+// messages sent to our side, from the CompIDs of the message or else the IPs
+// of the sender and receiver. Messages between our own CompIDs or hosts are
+// outbound. False is returned if neither side is ours.
+func (o *ourSide) direction(fields tagValues, senderIP, receiverIP net.IP) (string, bool) {
+	if o == nil {
+		return "", false
+	}
+
+	if o.compIDs != nil {
+		sender, _ := fields.get(tagSenderCompID)
+		target, _ := fields.get(tagTargetCompID)
+		if o.compIDs[sender] {
+			return directionOutbound, true
+		}
+		if o.compIDs[target] {
+			return directionInbound, true
+		}
+	}
+	if o.hasIP(senderIP) {
+		return directionOutbound, true
+	}
+	if o.hasIP(receiverIP) {
+		return directionInbound, true
+	}
+	return "", false
+}
+
+func (o *ourSide) hasIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range o.ips {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+// +build !integration
+
+package fix
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/packetbeat/protos"
+)
+
+func TestOurSideDirection(t *testing.T) {
+	o := newOurSide(ourSideConfig{
+		CompIDs: []string{"BROKER"},
+		IPs:     []string{"10.1.0.0/16"},
+	})
+
+	direction := func(msg, sender, receiver string) string {
+		d, ok := o.direction(splitFields(fixMessage(msg)), net.ParseIP(sender), net.ParseIP(receiver))
+		if !ok {
+			return ""
+		}
+		return d
+	}
+
+	// CompIDs take precedence over the IPs
+	assert.Equal(t, "outbound", direction("8=FIX.4.2|35=D|49=BROKER|56=VENUE|", "10.9.0.1", "10.1.0.1"))
+	assert.Equal(t, "inbound", direction("8=FIX.4.2|35=8|49=VENUE|56=BROKER|", "10.1.0.1", "10.9.0.1"))
+
+	assert.Equal(t, "outbound", direction("8=FIX.4.2|35=D|49=DESK|56=VENUE|", "10.1.2.3", "10.9.0.1"))
+	assert.Equal(t, "inbound", direction("8=FIX.4.2|35=8|49=VENUE|56=DESK|", "10.9.0.1", "10.1.2.3"))
+	assert.Equal(t, "", direction("8=FIX.4.2|35=8|49=VENUE|56=DESK|", "10.9.0.1", "10.9.0.2"))
+
+	_, ok := newOurSide(ourSideConfig{}).direction(nil, nil, nil)
+	assert.False(t, ok)
+}
+
+func TestOurSideConfigValidate(t *testing.T) {
+	assert.NoError(t, (&ourSideConfig{IPs: []string{"10.0.0.1", "10.1.0.0/16"}}).Validate())
+	assert.Error(t, (&ourSideConfig{IPs: []string{"not an ip"}}).Validate())
+}
+
+func TestParseSetsDirection(t *testing.T) {
+	fix, results := fixModForTests()
+	fix.ourSide = newOurSide(ourSideConfig{IPs: []string{"10.0.0.1"}})
+
+	parseSession(fix, nil,
+		directedMessage{initiator, "8=FIX.4.2|35=D|34=2|49=CLIENT|56=BROKER|11=order-1|"},
+		directedMessage{acceptor, "8=FIX.4.2|35=8|34=2|49=BROKER|56=CLIENT|11=order-1|150=0|"},
+	)
+
+	assert.Equal(t, "outbound", expectEvent(t, results)["fix"].(common.MapStr)["direction"])
+	assert.Equal(t, "inbound", expectEvent(t, results)["fix"].(common.MapStr)["direction"])
+}
+
+func TestParseUDPSetsDirection(t *testing.T) {
+	fix, results := fixModForTests()
+	fix.ourSide = newOurSide(ourSideConfig{CompIDs: []string{"CLIENT"}})
+
+	fix.ParseUDP(&protos.Packet{
+		Ts: time.Now(),
+		Tuple: common.NewIPPortTuple(4,
+			net.ParseIP("10.0.0.1"), 40000,
+			net.ParseIP("239.1.1.1"), 9878),
+		Payload: fixMessage("8=FIX.4.4|35=X|34=10|49=MDFEED|56=CLIENT|55=VOD.L|"),
+	})
+
+	assert.Equal(t, "inbound", expectEvent(t, results)["fix"].(common.MapStr)["direction"])
+}
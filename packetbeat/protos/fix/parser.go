@@ -0,0 +1,159 @@
+package fix
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common/streambuf"
+	"github.com/elastic/beats/packetbeat/protos/tcp"
+)
+
+type parser struct {
+	message *message
+}
+
+type message struct {
+	ts time.Time
+
+	// raw holds the complete message, including the BeginString and
+	// CheckSum fields
+	raw    []byte
+	fields tagValues
+
+	checksumValid bool
+}
+
+var (
+	beginStringPrefix = []byte("8=")
+	bodyLengthPrefix  = []byte("9=")
+	checkSumPrefix    = []byte("10=")
+
+	// beginStringFIX starts all messages, the BeginString being FIX.4.x or
+	// FIXT.1.1. Searched for to resynchronize on the next message.
+	beginStringFIX = []byte("8=FIX")
+)
+
+const (
+	// maxHeaderLen limits the number of bytes searched for the BeginString
+	// and BodyLength fields, before a stream is considered not to be FIX.
+	maxHeaderLen = 32
+
+	// length of the trailing "10=nnn<SOH>" CheckSum field
+	checkSumLen = 7
+)
+
+func (p *parser) reset() {
+	p.message = nil
+}
+
+// parse tries to read a single framed message from buf. Messages are framed by
+// the BeginString (8) and BodyLength (9) fields, followed by the number of
+// bytes given by BodyLength and the CheckSum (10) field. If ok is false, buf
+// does not start with a FIX message. If complete is false, more data is
+// required.
+func (p *parser) parse(buf *streambuf.Buffer) (ok, complete bool) {
+	data := buf.Bytes()
+
+	bodyStart, bodyLen, ok, complete := parseHeader(data)
+	if !ok || !complete {
+		return ok, complete
+	}
+
+	bodyEnd := bodyStart + bodyLen
+	if len(data) < bodyEnd+checkSumLen {
+		return true, false
+	}
+
+	trailer := data[bodyEnd : bodyEnd+checkSumLen]
+	if !bytes.HasPrefix(trailer, checkSumPrefix) || trailer[checkSumLen-1] != soh {
+		debugf("invalid framing: missing CheckSum after BodyLength=%v", bodyLen)
+		return false, false
+	}
+	expected, err := strconv.Atoi(string(trailer[len(checkSumPrefix) : checkSumLen-1]))
+	if err != nil {
+		debugf("invalid CheckSum value: %q", trailer)
+		return false, false
+	}
+
+	raw := make([]byte, bodyEnd+checkSumLen)
+	copy(raw, data)
+	buf.Advance(len(raw))
+
+	msg := p.message
+	msg.raw = raw
+	msg.fields = splitFields(raw)
+	msg.checksumValid = checksum(raw[:bodyEnd]) == expected
+	return true, true
+}
+
+// parseHeader parses the BeginString and BodyLength fields, returning the
+// offset of the first body byte and the body length.
+func parseHeader(data []byte) (bodyStart, bodyLen int, ok, complete bool) {
+	if len(data) < len(beginStringPrefix) {
+		return 0, 0, bytes.HasPrefix(beginStringPrefix, data), false
+	}
+	if !bytes.HasPrefix(data, beginStringPrefix) {
+		return 0, 0, false, false
+	}
+
+	end := bytes.IndexByte(data, soh)
+	if end < 0 {
+		return 0, 0, len(data) < maxHeaderLen, false
+	}
+
+	rest := data[end+1:]
+	if len(rest) < len(bodyLengthPrefix) {
+		return 0, 0, bytes.HasPrefix(bodyLengthPrefix, rest), false
+	}
+	if !bytes.HasPrefix(rest, bodyLengthPrefix) {
+		return 0, 0, false, false
+	}
+
+	lenEnd := bytes.IndexByte(rest, soh)
+	if lenEnd < 0 {
+		return 0, 0, len(data) < maxHeaderLen, false
+	}
+	bodyLen, err := strconv.Atoi(string(rest[len(bodyLengthPrefix):lenEnd]))
+	// corrupted lengths beyond the stream buffer would never complete
+	if err != nil || bodyLen < 0 || bodyLen > tcp.TCPMaxDataInStream {
+		debugf("invalid BodyLength: %q", rest[:lenEnd])
+		return 0, 0, false, false
+	}
+
+	bodyStart = end + 1 + lenEnd + 1
+	return bodyStart, bodyLen, true, true
+}
+
+// resync skips the bytes of buf up to the next BeginString, after buf failed
+// to parse as a FIX message, and returns the number of bytes skipped. At least
+// one byte is skipped. If no BeginString is found, trailing bytes possibly
+// starting a BeginString continued in the next segment are kept.
+func resync(buf *streambuf.Buffer) int {
+	data := buf.Bytes()
+
+	skip := len(data)
+	if i := bytes.Index(data[1:], beginStringFIX); i >= 0 {
+		skip = i + 1
+	} else {
+		for n := len(beginStringFIX) - 1; n > 0; n-- {
+			if n < len(data) && bytes.HasPrefix(beginStringFIX, data[len(data)-n:]) {
+				skip = len(data) - n
+				break
+			}
+		}
+	}
+
+	buf.Advance(skip)
+	return skip
+}
+
+// checksum computes the FIX CheckSum of a message, being the sum of all bytes
+// up to the CheckSum field modulo 256.
+func checksum(data []byte) int {
+	sum := 0
+	for _, b := range data {
+		sum += int(b)
+	}
+	return sum % 256
+}
@@ -0,0 +1,195 @@
+// +build !integration
+
+package fix
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/common/streambuf"
+	"github.com/elastic/beats/packetbeat/protos"
+)
+
+func parsePayloads(fix *fixPlugin, payloads ...[]byte) protos.ProtocolData {
+	var private protos.ProtocolData
+	for _, payload := range payloads {
+		pkt := &protos.Packet{Ts: time.Now(), Payload: payload}
+		private = fix.Parse(pkt, &common.TCPTuple{}, 0, private)
+	}
+	return private
+}
+
+func TestParserCompleteMessage(t *testing.T) {
+	raw := fixMessage("8=FIX.4.2|35=0|34=7|")
+	p := parser{message: &message{}}
+
+	ok, complete := p.parse(streambuf.New(raw))
+
+	assert.True(t, ok)
+	assert.True(t, complete)
+	assert.True(t, p.message.checksumValid)
+	assert.Equal(t, raw, p.message.raw)
+	value, _ := p.message.fields.get(34)
+	assert.Equal(t, "7", value)
+}
+
+func TestParserIncompleteMessage(t *testing.T) {
+	raw := fixMessage("8=FIX.4.2|35=0|34=7|")
+
+	for i := 1; i < len(raw); i++ {
+		p := parser{message: &message{}}
+		ok, complete := p.parse(streambuf.New(raw[:i]))
+		assert.True(t, ok, "prefix length %v", i)
+		assert.False(t, complete, "prefix length %v", i)
+	}
+}
+
+func TestParserInvalidFraming(t *testing.T) {
+	for _, raw := range []string{
+		"GET / HTTP/1.1\r\n",
+		"8=FIX.4.2\x0135=0\x01",
+		"8=FIX.4.2\x019=abc\x01",
+		"8=FIX.4.2\x019=2\x0135=0\x0110=000\x01",
+	} {
+		p := parser{message: &message{}}
+		ok, _ := p.parse(streambuf.New([]byte(raw)))
+		assert.False(t, ok, "input %q", raw)
+	}
+}
+
+func TestParserRejectsHugeBodyLength(t *testing.T) {
+	p := parser{message: &message{}}
+	ok, _ := p.parse(streambuf.New([]byte("8=FIX.4.2\x019=999999999\x0135=0\x01")))
+	assert.False(t, ok)
+}
+
+func TestResync(t *testing.T) {
+	tests := []struct {
+		data    string
+		skipped int
+	}{
+		{"garbage8=FIX.4.2\x01", 7},
+		{"8=FIX.4.2\x019=abc\x018=FIXT.1.1\x01", 16},
+		{"8=FIX.4.2\x01", 10},
+		{"garbage", 7},
+		{"garbage8=F", 7},
+		{"garbage8", 7},
+		{"8=XYZ8=FI", 5},
+		{"x", 1},
+	}
+
+	for _, test := range tests {
+		buf := streambuf.New([]byte(test.data))
+		assert.Equal(t, test.skipped, resync(buf), "input %q", test.data)
+		assert.Equal(t, len(test.data)-test.skipped, buf.Len(), "input %q", test.data)
+	}
+}
+
+func TestParseResynchronizes(t *testing.T) {
+	first := fixMessage("8=FIX.4.2|35=D|34=2|49=CLIENT|56=BROKER|11=order-1|")
+	second := fixMessage("8=FIX.4.2|35=D|34=3|49=CLIENT|56=BROKER|11=order-2|")
+	corrupted := append([]byte{}, first...)
+	corrupted[12] = 'x' // BodyLength
+
+	tests := []struct {
+		name     string
+		payloads [][]byte
+		skipped  int
+	}{
+		{"garbage", [][]byte{[]byte("\x00\xffgarbage"), second}, 9},
+		{"capture started mid-message", [][]byte{first[20:], second}, len(first) - 20},
+		{"corrupted message", [][]byte{append(corrupted, second...)}, len(first)},
+		{"preamble split across segments", [][]byte{
+			append([]byte("garbage"), second[:3]...), second[3:]}, 7},
+	}
+
+	for _, test := range tests {
+		fix, results := fixModForTests()
+		parsePayloads(fix, test.payloads...)
+
+		resync := expectEvent(t, results)["fix"].(common.MapStr)["resync"]
+		assert.Equal(t, common.MapStr{
+			"skipped_bytes":  test.skipped,
+			"sender_comp_id": "CLIENT",
+			"target_comp_id": "BROKER",
+		}, resync, test.name)
+
+		event := expectEvent(t, results)
+		assert.Equal(t, "order-2", event["fix"].(common.MapStr)["ClOrdID"], test.name)
+		assert.Empty(t, results.Channel, test.name)
+	}
+}
+
+func TestResyncEventEndpoints(t *testing.T) {
+	fix, results := fixModForTests()
+	msg := fixMessage("8=FIX.4.2|35=8|34=5|49=BROKER|56=CLIENT|11=order-1|150=0|")
+	pkt := &protos.Packet{Ts: time.Now(), Payload: append([]byte("garbage"), msg...)}
+	fix.Parse(pkt, &sessionTuple, acceptor, nil)
+
+	// the resync event is sent by the acceptor, as the message following it
+	event := expectEvent(t, results)
+	assert.Contains(t, event["fix"], "resync")
+	assert.Equal(t, &common.Endpoint{IP: "10.0.0.2", Port: 9878}, event["src"])
+	assert.Equal(t, &common.Endpoint{IP: "10.0.0.1", Port: 40000}, event["dst"])
+
+	event = expectEvent(t, results)
+	assert.Equal(t, &common.Endpoint{IP: "10.0.0.2", Port: 9878}, event["src"])
+}
+
+func TestParseFragmentedMessage(t *testing.T) {
+	fix, results := fixModForTests()
+	raw := fixMessage("8=FIX.4.2|35=D|34=2|11=order-1|55=VOD.L|")
+
+	parsePayloads(fix, raw[:5], raw[5:20], raw[20:])
+
+	event := expectEvent(t, results)
+	assert.Equal(t, "order-1", event["fix"].(common.MapStr)["ClOrdID"])
+	assert.Empty(t, results.Channel)
+}
+
+func TestParseMultipleMessagesInSegment(t *testing.T) {
+	fix, results := fixModForTests()
+	first := fixMessage("8=FIX.4.2|35=0|34=2|")
+	second := fixMessage("8=FIX.4.2|35=0|34=3|")
+	third := fixMessage("8=FIX.4.2|35=0|34=4|")
+
+	payload := append(append(append([]byte{}, first...), second...), third[:10]...)
+	parsePayloads(fix, payload, third[10:])
+
+	for _, seq := range []int{2, 3, 4} {
+		event := expectEvent(t, results)
+		assert.Equal(t, seq, event["fix"].(common.MapStr)["MsgSeqNum"])
+	}
+	assert.Empty(t, results.Channel)
+}
+
+func TestParseDropsInvalidChecksum(t *testing.T) {
+	fix, results := fixModForTests()
+	bad := fixMessage("8=FIX.4.2|35=0|34=2|")
+	bad[len(bad)-2]++
+	good := fixMessage("8=FIX.4.2|35=0|34=3|")
+
+	parsePayloads(fix, bad, good)
+
+	event := expectEvent(t, results)
+	assert.Equal(t, 3, event["fix"].(common.MapStr)["MsgSeqNum"])
+	assert.Empty(t, results.Channel)
+}
+
+func TestParseGapKeepsConnection(t *testing.T) {
+	fix, results := fixModForTests()
+	raw := fixMessage("8=FIXT.1.1|35=A|34=1|1137=9|")
+
+	private := parsePayloads(fix, raw, raw[:10])
+	expectEvent(t, results)
+
+	private, drop := fix.GapInStream(&common.TCPTuple{}, 0, 100, private)
+	assert.False(t, drop)
+
+	conn := private.(*fixConnectionData)
+	assert.Nil(t, conn.streams[0])
+	assert.Equal(t, "9", conn.defaultApplVerID)
+}
@@ -0,0 +1,215 @@
+package fix
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+type rateLimitConfig struct {
+	// period after which the messages dropped for a session are summarized
+	SummaryInterval time.Duration         `config:"summary_interval" validate:"positive"`
+	Rules           []rateLimitRuleConfig `config:"rules"`
+}
+
+type rateLimitRuleConfig struct {
+	SenderCompID string   `config:"sender_comp_id"`
+	TargetCompID string   `config:"target_comp_id"`
+	MsgTypes     []string `config:"msg_types"`
+	Rate         float64  `config:"rate" validate:"required, positive"`
+	Burst        int      `config:"burst" validate:"min=0"`
+}
+
+var defaultRateLimitConfig = rateLimitConfig{
+	SummaryInterval: time.Minute,
+}
+
+// rateLimiter limits the messages published per second with a token bucket
+// per SenderCompID, TargetCompID and MsgType, so that floods of market data
+// or heartbeats do not fill the publishing queue ahead of the order flow.
+// Rules are checked in order and the first rule matching the session of a
+// message applies. Rules without MsgTypes limit each MsgType of the session.
+// Buckets refill by capture time.
+//
+// The messages dropped are counted per SenderCompID and TargetCompID, and
+// summarized once per summary interval.
+type rateLimiter struct {
+	rules           []rateLimitRule
+	summaryInterval time.Duration
+
+	mutex     sync.Mutex
+	buckets   map[sampleKey]*tokenBucket
+	summaries map[sampleKey]*rateLimitSummary
+}
+
+type rateLimitRule struct {
+	senderCompID, targetCompID string
+	msgTypes                   map[string]bool
+	rate, burst                float64
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimitSummary counts the messages sent by SenderCompID to TargetCompID
+// which exceeded the rate limits.
+type rateLimitSummary struct {
+	senderCompID, targetCompID string
+	first, last                time.Time
+	dropped                    int
+	msgTypes                   map[string]int
+}
+
+func newRateLimiter(config rateLimitConfig) *rateLimiter {
+	if len(config.Rules) == 0 {
+		return nil
+	}
+
+	l := &rateLimiter{
+		summaryInterval: config.SummaryInterval,
+		buckets:         map[sampleKey]*tokenBucket{},
+		summaries:       map[sampleKey]*rateLimitSummary{},
+	}
+	for _, c := range config.Rules {
+		// the burst defaults to one second of messages
+		burst := float64(c.Burst)
+		if burst == 0 {
+			burst = math.Max(1, math.Ceil(c.Rate))
+		}
+		l.rules = append(l.rules, rateLimitRule{
+			senderCompID: c.SenderCompID,
+			targetCompID: c.TargetCompID,
+			msgTypes:     stringSet(c.MsgTypes),
+			rate:         c.Rate,
+			burst:        burst,
+		})
+	}
+	return l
+}
+
+// allow returns false if the message captured at ts exceeds the rate limit of
+// its session and MsgType, counting it in the summary of the session.
+func (l *rateLimiter) allow(fields tagValues, ts time.Time) bool {
+	if l == nil {
+		return true
+	}
+
+	sender, _ := fields.get(tagSenderCompID)
+	target, _ := fields.get(tagTargetCompID)
+	msgType, _ := fields.get(tagMsgType)
+	rule := l.match(sender, target, msgType)
+	if rule == nil {
+		return true
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	key := sampleKey{sender, target, msgType}
+	b := l.buckets[key]
+	if b == nil {
+		b = &tokenBucket{tokens: rule.burst, last: ts}
+		l.buckets[key] = b
+	}
+	if elapsed := ts.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(rule.burst, b.tokens+elapsed.Seconds()*rule.rate)
+		b.last = ts
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		return true
+	}
+
+	sessionKey := sampleKey{senderCompID: sender, targetCompID: target}
+	s := l.summaries[sessionKey]
+	if s == nil {
+		s = &rateLimitSummary{
+			senderCompID: sender,
+			targetCompID: target,
+			first:        ts,
+			msgTypes:     map[string]int{},
+		}
+		l.summaries[sessionKey] = s
+	}
+	s.last = ts
+	s.dropped++
+	s.msgTypes[msgType]++
+	return false
+}
+
+// match returns the rule limiting the MsgType of a session, nil if the
+// messages are not limited.
+func (l *rateLimiter) match(sender, target, msgType string) *rateLimitRule {
+	for i := range l.rules {
+		rule := &l.rules[i]
+		if !matchSession(rule.senderCompID, rule.targetCompID, sender, target) {
+			continue
+		}
+		if rule.msgTypes != nil && !rule.msgTypes[msgType] {
+			continue
+		}
+		return rule
+	}
+	return nil
+}
+
+// summary returns the summary of the messages dropped for the session of a
+// message once the summary interval has passed since the first of them, nil
+// otherwise.
+func (l *rateLimiter) summary(fields tagValues, ts time.Time) *rateLimitSummary {
+	if l == nil {
+		return nil
+	}
+
+	sender, _ := fields.get(tagSenderCompID)
+	target, _ := fields.get(tagTargetCompID)
+	key := sampleKey{senderCompID: sender, targetCompID: target}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	s := l.summaries[key]
+	if s == nil || ts.Sub(s.first) < l.summaryInterval {
+		return nil
+	}
+	delete(l.summaries, key)
+	return s
+}
+
+// flush returns the pending summaries of both directions of a session.
+func (l *rateLimiter) flush(key sessionKey) []*rateLimitSummary {
+	if l == nil {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	var summaries []*rateLimitSummary
+	for _, k := range []sampleKey{
+		{senderCompID: key.senderCompID, targetCompID: key.targetCompID},
+		{senderCompID: key.targetCompID, targetCompID: key.senderCompID},
+	} {
+		if s := l.summaries[k]; s != nil {
+			delete(l.summaries, k)
+			summaries = append(summaries, s)
+		}
+	}
+	return summaries
+}
+
+func (s *rateLimitSummary) fields() common.MapStr {
+	counts := common.MapStr{}
+	for msgType, n := range s.msgTypes {
+		counts[msgType] = n
+	}
+	return common.MapStr{
+		"sender_comp_id": s.senderCompID,
+		"target_comp_id": s.targetCompID,
+		"dropped":        s.dropped,
+		"msg_types":      counts,
+		"duration_ms":    int64(s.last.Sub(s.first) / time.Millisecond),
+	}
+}
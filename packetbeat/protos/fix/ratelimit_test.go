@@ -0,0 +1,123 @@
+// +build !integration
+
+package fix
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	l := newRateLimiter(rateLimitConfig{
+		SummaryInterval: 10 * time.Second,
+		Rules: []rateLimitRuleConfig{
+			{SenderCompID: "MDFEED", MsgTypes: []string{"X"}, Rate: 2, Burst: 3},
+			{MsgTypes: []string{"0"}, Rate: 0.5},
+		},
+	})
+
+	start := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+	allowed := func(msg string, ts time.Time, n int) []bool {
+		var result []bool
+		for i := 0; i < n; i++ {
+			result = append(result, l.allow(splitFields(fixMessage(msg)), ts))
+		}
+		return result
+	}
+
+	refresh := "8=FIX.4.4|35=X|49=MDFEED|56=CLIENT|"
+	assert.Equal(t, []bool{true, true, true, false, false}, allowed(refresh, start, 5))
+	// two tokens per second
+	assert.Equal(t, []bool{true, false}, allowed(refresh, start.Add(500*time.Millisecond), 2))
+	assert.Equal(t, []bool{true, true, true, false},
+		allowed(refresh, start.Add(time.Hour), 4))
+
+	// order flow and other sessions are not limited by the MDFEED rule
+	assert.Equal(t, []bool{true, true, true, true},
+		allowed("8=FIX.4.4|35=8|49=MDFEED|56=CLIENT|", start, 4))
+	assert.Equal(t, []bool{true, true},
+		allowed("8=FIX.4.4|35=X|49=OTHER|56=CLIENT|", start, 2))
+	assert.Equal(t, []bool{true, false},
+		allowed("8=FIX.4.4|35=0|49=OTHER|56=CLIENT|", start, 2))
+
+	assert.Nil(t, l.summary(splitFields(fixMessage(refresh)), start.Add(time.Second)))
+	summary := l.summary(splitFields(fixMessage(refresh)), start.Add(2*time.Hour))
+	if assert.NotNil(t, summary) {
+		assert.Equal(t, common.MapStr{
+			"sender_comp_id": "MDFEED",
+			"target_comp_id": "CLIENT",
+			"dropped":        4,
+			"msg_types":      common.MapStr{"X": 4},
+			"duration_ms":    int64(time.Hour / time.Millisecond),
+		}, summary.fields())
+	}
+	assert.Nil(t, l.summary(splitFields(fixMessage(refresh)), start.Add(2*time.Hour)))
+
+	summaries := l.flush(sessionKey{senderCompID: "CLIENT", targetCompID: "OTHER"})
+	if assert.Len(t, summaries, 1) {
+		assert.Equal(t, 1, summaries[0].dropped)
+	}
+	assert.Empty(t, l.flush(sessionKey{senderCompID: "CLIENT", targetCompID: "OTHER"}))
+
+	assert.True(t, newRateLimiter(defaultRateLimitConfig).allow(
+		splitFields(fixMessage(refresh)), start))
+}
+
+func TestRateLimiterRulesOfMsgTypes(t *testing.T) {
+	l := newRateLimiter(rateLimitConfig{
+		SummaryInterval: 10 * time.Second,
+		Rules: []rateLimitRuleConfig{
+			{SenderCompID: "MDFEED", MsgTypes: []string{"X"}, Rate: 1},
+			{SenderCompID: "MDFEED", MsgTypes: []string{"W"}, Rate: 1, Burst: 2},
+		},
+	})
+
+	start := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+	allowed := func(msg string, n int) []bool {
+		var result []bool
+		for i := 0; i < n; i++ {
+			result = append(result, l.allow(splitFields(fixMessage(msg)), start))
+		}
+		return result
+	}
+
+	// the snapshots are limited by the second rule of the session
+	assert.Equal(t, []bool{true, true, false},
+		allowed("8=FIX.4.4|35=W|49=MDFEED|56=CLIENT|", 3))
+	assert.Equal(t, []bool{true, false},
+		allowed("8=FIX.4.4|35=X|49=MDFEED|56=CLIENT|", 2))
+	assert.Equal(t, []bool{true, true},
+		allowed("8=FIX.4.4|35=8|49=MDFEED|56=CLIENT|", 2))
+}
+
+func TestParseRateLimitedMessages(t *testing.T) {
+	fix, results := fixModForTests()
+	fix.limiter = newRateLimiter(rateLimitConfig{
+		SummaryInterval: time.Minute,
+		Rules: []rateLimitRuleConfig{
+			{MsgTypes: []string{"X"}, Rate: 1, Burst: 1},
+		},
+	})
+
+	private := parseMessages(fix,
+		"8=FIX.4.4|35=X|34=1|49=MDFEED|56=CLIENT|55=VOD.L|",
+		"8=FIX.4.4|35=X|34=2|49=MDFEED|56=CLIENT|55=BARC.L|",
+		"8=FIX.4.4|35=8|34=3|49=MDFEED|56=CLIENT|",
+		"8=FIX.4.4|35=X|34=4|49=MDFEED|56=CLIENT|55=LLOY.L|")
+
+	assert.Equal(t, "VOD.L", expectEvent(t, results)["fix"].(common.MapStr)["Symbol"])
+	assert.Equal(t, "8", expectEvent(t, results)["fix"].(common.MapStr)["MsgType"])
+	assert.Empty(t, results.Channel)
+
+	// the drops pending are summarized when the connection is closed
+	fix.ReceivedFin(&common.TCPTuple{}, 0, private)
+	event := expectEvent(t, results)["fix"].(common.MapStr)
+	limited := event["rate_limit"].(common.MapStr)
+	assert.Equal(t, "MDFEED", limited["sender_comp_id"])
+	assert.Equal(t, 2, limited["dropped"])
+	assert.Equal(t, common.MapStr{"X": 2}, limited["msg_types"])
+}
@@ -0,0 +1,124 @@
+package fix
+
+import (
+	"container/list"
+	"expvar"
+	"time"
+)
+
+type reassemblyConfig struct {
+	// bytes buffered by a connection in both directions for the messages not
+	// complete yet, 0 for no limit
+	MaxConnectionBytes int `config:"max_connection_bytes" validate:"min=0"`
+
+	// bytes buffered by all connections, 0 for no limit
+	MaxTotalBytes int `config:"max_total_bytes" validate:"min=0"`
+}
+
+var defaultReassemblyConfig = reassemblyConfig{
+	MaxConnectionBytes: 1 << 20,
+	MaxTotalBytes:      64 << 20,
+}
+
+var (
+	evictedConnections = expvar.NewInt("fix.reassembly.evicted")
+	reassemblyBytes    = expvar.NewInt("fix.reassembly.buffered_bytes")
+)
+
+// reassemblyBudget accounts the bytes buffered by the connections for the
+// messages they are reassembling. Connections buffering more than the
+// connection budget are evicted, as are the least recently used connections
+// while all connections buffer more than the total budget, and connections
+// idle for longer than the connection timeout, like half-open connections.
+// Evicted connections drop the bytes buffered, keeping the session state,
+// the messages sent next being framed again by resyncing on the next
+// BeginString.
+//
+// The buffers of other connections are evicted, packets being parsed one at
+// a time.
+type reassemblyBudget struct {
+	maxConnection int
+	maxTotal      int
+	timeout       time.Duration
+
+	total int
+	lru   list.List // *fixConnectionData, least recently used first
+}
+
+func (r *reassemblyBudget) configure(config reassemblyConfig, timeout time.Duration) {
+	r.maxConnection = config.MaxConnectionBytes
+	r.maxTotal = config.MaxTotalBytes
+	r.timeout = timeout
+}
+
+// track accounts the bytes buffered by conn once a packet captured at ts has
+// been parsed, and evicts the connections over budget.
+func (r *reassemblyBudget) track(conn *fixConnectionData, ts time.Time) {
+	r.update(conn, conn.bufferedBytes())
+	if conn.reassembly != nil {
+		conn.lastSeen = ts
+		r.lru.MoveToBack(conn.reassembly)
+	}
+
+	for e := r.lru.Front(); e != nil && r.timeout > 0; e = r.lru.Front() {
+		idle := e.Value.(*fixConnectionData)
+		if ts.Sub(idle.lastSeen) <= r.timeout {
+			break
+		}
+		r.evict(idle, "idle")
+	}
+	if r.maxConnection > 0 && conn.buffered > r.maxConnection {
+		r.evict(conn, "over the connection budget")
+	}
+	for r.maxTotal > 0 && r.total > r.maxTotal {
+		r.evict(r.lru.Front().Value.(*fixConnectionData), "over the total budget")
+	}
+}
+
+// finished drops the stream of direction dir of conn and releases the bytes
+// it buffered, the message being reassembled never completing once FIN is
+// received, a gap is found in the stream or its framing is lost.
+func (r *reassemblyBudget) finished(conn *fixConnectionData, dir uint8) {
+	conn.streams[dir] = nil
+	r.update(conn, conn.bufferedBytes())
+}
+
+// remove releases the bytes buffered by a connection dropped.
+func (r *reassemblyBudget) remove(conn *fixConnectionData) {
+	r.update(conn, 0)
+}
+
+func (r *reassemblyBudget) evict(conn *fixConnectionData, reason string) {
+	evictedConnections.Add(1)
+	if isDebug {
+		debugf("Evict %v bytes buffered by connection %p, %s", conn.buffered, conn, reason)
+	}
+	conn.streams = [2]*stream{}
+	r.update(conn, 0)
+}
+
+// update sets the bytes buffered by conn, connections not buffering any
+// bytes not being tracked.
+func (r *reassemblyBudget) update(conn *fixConnectionData, n int) {
+	r.total += n - conn.buffered
+	reassemblyBytes.Add(int64(n - conn.buffered))
+	conn.buffered = n
+
+	switch {
+	case n == 0 && conn.reassembly != nil:
+		r.lru.Remove(conn.reassembly)
+		conn.reassembly = nil
+	case n > 0 && conn.reassembly == nil:
+		conn.reassembly = r.lru.PushBack(conn)
+	}
+}
+
+func (conn *fixConnectionData) bufferedBytes() int {
+	n := 0
+	for _, st := range conn.streams {
+		if st != nil {
+			n += st.Buf.Total()
+		}
+	}
+	return n
+}
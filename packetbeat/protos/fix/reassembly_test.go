@@ -0,0 +1,107 @@
+// +build !integration
+
+package fix
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/packetbeat/protos"
+)
+
+// parsePartial parses the first n bytes of a message on the connection of
+// srcPort.
+func parsePartial(
+	fix *fixPlugin,
+	conn protos.ProtocolData,
+	srcPort uint16,
+	ts time.Time,
+	n int,
+) *fixConnectionData {
+	data := fixMessage(newOrderSingle)[:n]
+	pkt := &protos.Packet{Ts: ts, Payload: data}
+	return fix.Parse(pkt, dedupTuple(srcPort), initiator, conn).(*fixConnectionData)
+}
+
+const newOrderSingle = "8=FIX.4.4|35=D|34=2|49=CLIENT|56=BROKER|11=order-1|55=EURUSD|54=1|38=1000000|40=1|"
+
+func TestReassemblyEvictsConnectionOverBudget(t *testing.T) {
+	fix, results := fixModForTests(func(c *fixConfig) {
+		c.Reassembly = reassemblyConfig{MaxConnectionBytes: 32}
+	})
+	evicted := evictedConnections.Value()
+	ts := time.Now()
+
+	conn := parsePartial(fix, nil, 40000, ts, 20)
+	assert.Equal(t, 20, conn.buffered)
+	assert.Equal(t, evicted, evictedConnections.Value())
+
+	conn = parsePartial(fix, conn, 40000, ts, 40)
+	assert.Equal(t, evicted+1, evictedConnections.Value())
+	assert.Equal(t, 0, conn.buffered)
+	assert.Nil(t, conn.streams[initiator])
+	assert.Equal(t, 0, fix.reassembly.total)
+
+	// messages fitting the budget are decoded once evicted
+	pkt := &protos.Packet{Ts: ts, Payload: fixMessage("8=FIX.4.4|35=0|34=3|49=CLIENT|56=BROKER|")}
+	fix.Parse(pkt, dedupTuple(40000), initiator, conn)
+	event := expectEvent(t, results)
+	assert.Equal(t, "Heartbeat", event["fix"].(common.MapStr)["msg_type"])
+}
+
+func TestReassemblyEvictsLeastRecentlyUsedConnection(t *testing.T) {
+	fix, _ := fixModForTests(func(c *fixConfig) {
+		c.Reassembly = reassemblyConfig{MaxTotalBytes: 100}
+	})
+	evicted := evictedConnections.Value()
+	ts := time.Now()
+
+	first := parsePartial(fix, nil, 40000, ts, 40)
+	second := parsePartial(fix, nil, 40001, ts, 40)
+	// the first connection is used again, the second being evicted
+	first = parsePartial(fix, first, 40000, ts, 10)
+	third := parsePartial(fix, nil, 40002, ts, 40)
+
+	assert.Equal(t, evicted+1, evictedConnections.Value())
+	assert.Equal(t, 50, first.buffered)
+	assert.Equal(t, 0, second.buffered)
+	assert.Equal(t, 40, third.buffered)
+	assert.Equal(t, 90, fix.reassembly.total)
+	assert.Equal(t, 2, fix.reassembly.lru.Len())
+}
+
+func TestReassemblyEvictsIdleConnection(t *testing.T) {
+	fix, _ := fixModForTests()
+	ts := time.Now()
+
+	idle := parsePartial(fix, nil, 40000, ts, 40)
+	active := parsePartial(fix, nil, 40001, ts.Add(defaultConfig.TransactionTimeout+time.Second), 40)
+
+	assert.Equal(t, 0, idle.buffered)
+	assert.Equal(t, 40, active.buffered)
+	assert.Equal(t, 40, fix.reassembly.total)
+}
+
+func TestReassemblyReleasesFinishedStream(t *testing.T) {
+	fix, _ := fixModForTests()
+
+	conn := parsePartial(fix, nil, 40000, time.Now(), 40)
+	fix.ReceivedFin(dedupTuple(40000), initiator, conn)
+	assert.Equal(t, 0, conn.buffered)
+	assert.Equal(t, 0, fix.reassembly.total)
+	assert.Equal(t, 0, fix.reassembly.lru.Len())
+}
+
+func TestReassemblyReleasesStreamOnGap(t *testing.T) {
+	fix, _ := fixModForTests()
+
+	conn := parsePartial(fix, nil, 40000, time.Now(), 40)
+	fix.GapInStream(dedupTuple(40000), initiator, 100, conn)
+	assert.Nil(t, conn.streams[initiator])
+	assert.Equal(t, 0, conn.buffered)
+	assert.Equal(t, 0, fix.reassembly.total)
+	assert.Equal(t, 0, fix.reassembly.lru.Len())
+}
@@ -0,0 +1,160 @@
+package fix
+
+import (
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+const (
+	msgTypeReject                = "3"
+	msgTypeBusinessMessageReject = "j"
+
+	tagOrdType              = 40
+	tagPrice                = 44
+	tagRefSeqNum            = 45
+	tagRefTagID             = 371
+	tagRefMsgType           = 372
+	tagSessionRejectReason  = 373
+	tagBusinessRejectRefID  = 379
+	tagBusinessRejectReason = 380
+)
+
+// maxSentMessages limits the number of messages kept per connection and
+// direction, to look up the messages rejected.
+const maxSentMessages = 256
+
+// rejectRefTags are the tags of a rejected message added to reject events.
+var rejectRefTags = []int{
+	tagMsgType, tagClOrdID, tagOrigClOrdID, tagOrderID, tagSymbol, tagSide,
+	tagOrderQty, tagOrdType, tagPrice,
+}
+
+// rejectTracker keeps the recent messages sent in each direction, to
+// correlate Reject and BusinessMessageReject messages with the message
+// rejected.
+type rejectTracker struct {
+	sent [2]sentMessages
+}
+
+// sentMessages is a ring buffer of the last messages sent.
+type sentMessages struct {
+	msgs []sentMessage
+	next int
+}
+
+type sentMessage struct {
+	seqNo  int
+	ts     time.Time
+	fields tagValues
+}
+
+// rejectEvent describes a rejected message.
+type rejectEvent struct {
+	ts       time.Time
+	business bool
+	msg      tagValues
+
+	// the rejected message, nil if not captured
+	ref *sentMessage
+}
+
+// onMessage records msg and returns the reject event if msg is a Reject or
+// BusinessMessageReject.
+func (r *rejectTracker) onMessage(dir uint8, msg *message) *rejectEvent {
+	seqNo, _ := msg.fields.get(tagMsgSeqNum)
+	r.sent[dir].add(sentMessage{seqNo: atoiOrZero(seqNo), ts: msg.ts, fields: msg.fields})
+
+	msgType, _ := msg.fields.get(tagMsgType)
+	if msgType != msgTypeReject && msgType != msgTypeBusinessMessageReject {
+		return nil
+	}
+
+	ev := &rejectEvent{
+		ts:       msg.ts,
+		business: msgType == msgTypeBusinessMessageReject,
+		msg:      msg.fields,
+	}
+
+	// rejects refer to messages sent by the peer
+	sent := &r.sent[1-dir]
+	if ref, ok := msg.fields.get(tagRefSeqNum); ok {
+		ev.ref = sent.lookup(tagMsgSeqNum, ref)
+	} else if ref, ok := msg.fields.get(tagBusinessRejectRefID); ok {
+		ev.ref = sent.lookup(tagClOrdID, ref)
+	}
+	return ev
+}
+
+func (s *sentMessages) add(msg sentMessage) {
+	if len(s.msgs) < maxSentMessages {
+		s.msgs = append(s.msgs, msg)
+		return
+	}
+	s.msgs[s.next] = msg
+	s.next = (s.next + 1) % maxSentMessages
+}
+
+// lookup returns the most recent message having value for tag.
+func (s *sentMessages) lookup(tag int, value string) *sentMessage {
+	n := len(s.msgs)
+	for i := 1; i <= n; i++ {
+		msg := &s.msgs[(s.next-i+n)%n]
+		if v, ok := msg.fields.get(tag); ok && v == value {
+			return msg
+		}
+	}
+	return nil
+}
+
+// fields returns the reject event fields, with enumerated values decoded by
+// dict.
+func (ev *rejectEvent) fields(dict *dictionary) common.MapStr {
+	fields := common.MapStr{"type": "session"}
+	if ev.business {
+		fields["type"] = "business"
+	}
+
+	if v, ok := ev.msg.get(tagRefSeqNum); ok {
+		fields["ref_seq_no"] = atoiOrZero(v)
+	}
+	if v, ok := ev.msg.get(tagRefMsgType); ok {
+		fields["ref_msg_type"] = dict.enum(tagMsgType, v)
+	}
+	if v, ok := ev.msg.get(tagRefTagID); ok {
+		fields["ref_tag_id"] = atoiOrZero(v)
+	}
+	if v, ok := ev.msg.get(tagBusinessRejectRefID); ok {
+		fields["business_reject_ref_id"] = v
+	}
+	if v, ok := ev.msg.get(tagSessionRejectReason); ok {
+		fields["reason"] = dict.enum(tagSessionRejectReason, v)
+	}
+	if v, ok := ev.msg.get(tagBusinessRejectReason); ok {
+		fields["reason"] = dict.enum(tagBusinessRejectReason, v)
+	}
+	if v, ok := ev.msg.get(tagText); ok {
+		fields["text"] = v
+	}
+
+	if ev.ref == nil {
+		return fields
+	}
+
+	ref := common.MapStr{}
+	for _, tag := range rejectRefTags {
+		v, ok := ev.ref.fields.get(tag)
+		if !ok {
+			continue
+		}
+		if name, value, ok := dict.decode(tag, v); ok {
+			ref[name] = value
+		}
+	}
+	if msgType, ok := ev.ref.fields.get(tagMsgType); ok {
+		ref["msg_type"] = dict.enum(tagMsgType, msgType)
+	}
+	fields["ref"] = ref
+	fields["latency_us"] = int64(ev.ts.Sub(ev.ref.ts) / time.Microsecond)
+	return fields
+}
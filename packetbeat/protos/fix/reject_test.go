@@ -0,0 +1,80 @@
+// +build !integration
+
+package fix
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/packetbeat/protos"
+)
+
+func TestSessionRejectCorrelated(t *testing.T) {
+	fix, results := fixModForTests()
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+
+	var private protos.ProtocolData
+	for i, m := range []directedMessage{
+		{initiator, "8=FIX.4.2|35=D|34=2|11=order-1|55=VOD.L|54=2|38=100|"},
+		{initiator, "8=FIX.4.2|35=D|34=3|11=order-2|55=BARC.L|54=1|"},
+		{acceptor, "8=FIX.4.2|35=3|34=2|45=3|371=38|372=D|373=1|58=OrderQty missing|"},
+	} {
+		pkt := &protos.Packet{Ts: ts.Add(time.Duration(i) * time.Millisecond), Payload: fixMessage(m.msg)}
+		private = fix.Parse(pkt, &sessionTuple, m.dir, private)
+	}
+
+	reject := expectFixEvent(t, results, "reject")
+	assert.Equal(t, "session", reject["type"])
+	assert.Equal(t, 3, reject["ref_seq_no"])
+	assert.Equal(t, 38, reject["ref_tag_id"])
+	assert.Equal(t, "Order - Single", reject["ref_msg_type"])
+	assert.Equal(t, "Required tag missing", reject["reason"])
+	assert.Equal(t, "OrderQty missing", reject["text"])
+	assert.Equal(t, int64(1000), reject["latency_us"])
+
+	ref := reject["ref"].(common.MapStr)
+	assert.Equal(t, "order-2", ref["ClOrdID"])
+	assert.Equal(t, "BARC.L", ref["Symbol"])
+	assert.Equal(t, "Buy", ref["Side"])
+	assert.Equal(t, "D", ref["MsgType"])
+}
+
+func TestBusinessRejectByRefID(t *testing.T) {
+	fix, results := fixModForTests()
+
+	parseSession(fix, nil,
+		directedMessage{initiator, "8=FIX.4.4|35=D|34=2|11=order-1|55=XYZ|"},
+		directedMessage{acceptor, "8=FIX.4.4|35=j|34=2|379=order-1|372=D|380=6|"})
+
+	reject := expectFixEvent(t, results, "reject")
+	assert.Equal(t, "business", reject["type"])
+	assert.Equal(t, "Not authorized", reject["reason"])
+	assert.Equal(t, "XYZ", reject["ref"].(common.MapStr)["Symbol"])
+}
+
+func TestRejectOfUnknownMessage(t *testing.T) {
+	fix, results := fixModForTests()
+
+	parseSession(fix, nil,
+		directedMessage{acceptor, "8=FIX.4.2|35=3|34=2|45=7|"})
+
+	reject := expectFixEvent(t, results, "reject")
+	assert.Equal(t, 7, reject["ref_seq_no"])
+	assert.NotContains(t, reject, "ref")
+}
+
+func TestSentMessagesRing(t *testing.T) {
+	var sent sentMessages
+	for i := 1; i <= maxSentMessages+10; i++ {
+		sent.add(sentMessage{seqNo: i, fields: tagValues{{tag: tagMsgSeqNum, value: strconv.Itoa(i)}}})
+	}
+
+	assert.Len(t, sent.msgs, maxSentMessages)
+	assert.Nil(t, sent.lookup(tagMsgSeqNum, "10"))
+	assert.Equal(t, 11, sent.lookup(tagMsgSeqNum, "11").seqNo)
+	assert.Equal(t, maxSentMessages+10, sent.lookup(tagMsgSeqNum, strconv.Itoa(maxSentMessages+10)).seqNo)
+}
@@ -0,0 +1,256 @@
+package fix
+
+import (
+	"sort"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+const msgTypeQuoteRequestReject = "AG"
+
+const (
+	tagQuoteID                  = 117
+	tagQuoteRequestRejectReason = 658
+)
+
+type rfqConfig struct {
+	// time after the QuoteRequest an RFQ not traded is reported as expired
+	Timeout time.Duration `config:"timeout" validate:"min=0"`
+}
+
+var defaultRFQConfig = rfqConfig{
+	Timeout: time.Minute,
+}
+
+// rfqSweepInterval is the minimum period between two lookups of the expired
+// RFQs of a connection.
+const rfqSweepInterval = time.Second
+
+// rfqTracker follows the RFQ workflows of a connection, linking each
+// QuoteRequest to the Quotes answering it by QuoteReqID, and the
+// NewOrderSingle trading one of the Quotes by QuoteID. An RFQ is summarized
+// once traded, rejected by a QuoteRequestReject, or expired.
+type rfqTracker struct {
+	// open RFQs by QuoteReqID, per direction the requests have been sent in
+	requests [2]map[string]*rfq
+
+	// open RFQs by the QuoteID of their quotes, per direction the requests
+	// have been sent in
+	quotes [2]map[string]*rfq
+
+	nextSweep time.Time
+}
+
+type rfq struct {
+	start time.Time
+
+	quoteReqID string
+	symbol     string
+
+	// number of Quote messages, and capture time of the first one
+	quotes     int
+	firstQuote time.Time
+
+	// capture time of the last Quote by QuoteID
+	quoteTimes map[string]time.Time
+}
+
+// rfqSummary is reported once an RFQ is traded, rejected or expired.
+type rfqSummary struct {
+	ts     time.Time
+	rfq    *rfq
+	status string
+
+	// set for traded RFQs
+	quoteID, clOrdID string
+
+	// set for rejected RFQs
+	rejectReason string
+}
+
+// onMessage updates the open RFQs and returns the summaries of the RFQs
+// completed by msg or expired by timeout.
+func (r *rfqTracker) onMessage(dir uint8, msg *message, timeout time.Duration) []*rfqSummary {
+	summaries := r.expire(msg.ts, timeout)
+
+	msgType, _ := msg.fields.get(tagMsgType)
+	switch msgType {
+	case msgTypeQuoteRequest:
+		r.open(dir, msg)
+
+	case msgTypeQuote:
+		reqID, _ := msg.fields.get(tagQuoteReqID)
+		req := r.requests[1-dir][reqID]
+		if req == nil {
+			return summaries
+		}
+		req.quotes++
+		if req.quotes == 1 {
+			req.firstQuote = msg.ts
+		}
+		if quoteID, ok := msg.fields.get(tagQuoteID); ok {
+			req.quoteTimes[quoteID] = msg.ts
+			if r.quotes[1-dir] == nil {
+				r.quotes[1-dir] = map[string]*rfq{}
+			}
+			r.quotes[1-dir][quoteID] = req
+		}
+
+	case msgTypeQuoteRequestReject:
+		reqID, _ := msg.fields.get(tagQuoteReqID)
+		req := r.requests[1-dir][reqID]
+		if req == nil {
+			return summaries
+		}
+		r.close(1-dir, req)
+		reason, _ := msg.fields.get(tagQuoteRequestRejectReason)
+		summaries = append(summaries, &rfqSummary{
+			ts:           msg.ts,
+			rfq:          req,
+			status:       "rejected",
+			rejectReason: reason,
+		})
+
+	case msgTypeNewOrderSingle:
+		quoteID, _ := msg.fields.get(tagQuoteID)
+		req := r.quotes[dir][quoteID]
+		if req == nil {
+			return summaries
+		}
+		r.close(dir, req)
+		clOrdID, _ := msg.fields.get(tagClOrdID)
+		summaries = append(summaries, &rfqSummary{
+			ts:      msg.ts,
+			rfq:     req,
+			status:  "traded",
+			quoteID: quoteID,
+			clOrdID: clOrdID,
+		})
+	}
+	return summaries
+}
+
+func (r *rfqTracker) open(dir uint8, msg *message) {
+	reqID, ok := msg.fields.get(tagQuoteReqID)
+	if !ok {
+		return
+	}
+	if r.requests[dir] == nil {
+		r.requests[dir] = map[string]*rfq{}
+	}
+	if old := r.requests[dir][reqID]; old != nil {
+		// the QuoteReqID is reused, start over
+		r.close(dir, old)
+	}
+	if len(r.requests[dir]) >= maxPendingOrders {
+		r.evict(dir)
+	}
+
+	symbol, _ := msg.fields.get(tagSymbol)
+	r.requests[dir][reqID] = &rfq{
+		start:      msg.ts,
+		quoteReqID: reqID,
+		symbol:     symbol,
+		quoteTimes: map[string]time.Time{},
+	}
+}
+
+// close forgets an RFQ and its quotes.
+func (r *rfqTracker) close(dir uint8, req *rfq) {
+	delete(r.requests[dir], req.quoteReqID)
+	for quoteID := range req.quoteTimes {
+		if r.quotes[dir][quoteID] == req {
+			delete(r.quotes[dir], quoteID)
+		}
+	}
+}
+
+// evict closes the oldest open RFQ of dir, making room for a new one.
+func (r *rfqTracker) evict(dir uint8) {
+	var oldest *rfq
+	for _, req := range r.requests[dir] {
+		if oldest == nil || req.start.Before(oldest.start) {
+			oldest = req
+		}
+	}
+	r.close(dir, oldest)
+	evictedRFQs.Add(1)
+	if isDebug {
+		debugf("too many open RFQs, forget the oldest QuoteReqID=%v", oldest.quoteReqID)
+	}
+}
+
+// expire closes the RFQs requested more than timeout before ts. The RFQs are
+// looked up at most once per rfqSweepInterval.
+func (r *rfqTracker) expire(ts time.Time, timeout time.Duration) []*rfqSummary {
+	if timeout <= 0 || ts.Before(r.nextSweep) {
+		return nil
+	}
+	r.nextSweep = ts.Add(rfqSweepInterval)
+
+	var summaries []*rfqSummary
+	for dir := range r.requests {
+		for _, req := range r.requests[dir] {
+			if ts.Sub(req.start) < timeout {
+				continue
+			}
+			r.close(uint8(dir), req)
+			summaries = append(summaries, &rfqSummary{
+				ts:     req.start.Add(timeout),
+				rfq:    req,
+				status: "expired",
+			})
+		}
+	}
+	return summaries
+}
+
+// flush closes the open RFQs once the connection is closed, reporting them
+// as expired at ts.
+func (r *rfqTracker) flush(ts time.Time) []*rfqSummary {
+	var summaries []*rfqSummary
+	for dir := range r.requests {
+		for _, req := range r.requests[dir] {
+			r.close(uint8(dir), req)
+			summaries = append(summaries, &rfqSummary{
+				ts:     ts,
+				rfq:    req,
+				status: "expired",
+			})
+		}
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].rfq.start.Before(summaries[j].rfq.start)
+	})
+	return summaries
+}
+
+// fields returns the RFQ summary.
+func (s *rfqSummary) fields() common.MapStr {
+	req := s.rfq
+	fields := common.MapStr{
+		"quote_req_id": req.quoteReqID,
+		"status":       s.status,
+		"quotes":       req.quotes,
+		"quote_ids":    len(req.quoteTimes),
+	}
+	if req.symbol != "" {
+		fields["symbol"] = req.symbol
+	}
+	if req.quotes > 0 {
+		fields["time_to_first_quote_us"] = int64(req.firstQuote.Sub(req.start) / time.Microsecond)
+	}
+	if s.rejectReason != "" {
+		fields["reject_reason"] = s.rejectReason
+	}
+	if s.status == "traded" {
+		fields["quote_id"] = s.quoteID
+		if s.clOrdID != "" {
+			fields["cl_ord_id"] = s.clOrdID
+		}
+		fields["quote_to_trade_us"] = int64(s.ts.Sub(req.quoteTimes[s.quoteID]) / time.Microsecond)
+		fields["request_to_trade_us"] = int64(s.ts.Sub(req.start) / time.Microsecond)
+	}
+	return fields
+}
@@ -0,0 +1,194 @@
+// +build !integration
+
+package fix
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/packetbeat/protos"
+)
+
+type timedMessage struct {
+	dir    uint8
+	offset time.Duration
+	msg    string
+}
+
+func parseTimedMessages(fix *fixPlugin, ts time.Time, msgs []timedMessage) protos.ProtocolData {
+	var private protos.ProtocolData
+	for _, m := range msgs {
+		pkt := &protos.Packet{Ts: ts.Add(m.offset), Payload: fixMessage(m.msg)}
+		private = fix.Parse(pkt, &sessionTuple, m.dir, private)
+	}
+	return private
+}
+
+func TestRFQTraded(t *testing.T) {
+	fix, results := fixModForTests()
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+
+	private := parseTimedMessages(fix, ts, []timedMessage{
+		{initiator, 0, "8=FIX.4.4|35=R|34=2|131=rfq-1|146=1|55=EUR/USD|38=1000000|"},
+		{acceptor, 3 * time.Millisecond, "8=FIX.4.4|35=S|34=2|131=rfq-1|117=q-1|55=EUR/USD|132=1.1010|133=1.1012|"},
+		{acceptor, 5 * time.Millisecond, "8=FIX.4.4|35=S|34=3|131=rfq-1|117=q-2|55=EUR/USD|132=1.1011|133=1.1013|"},
+		{acceptor, 8 * time.Millisecond, "8=FIX.4.4|35=S|34=4|131=rfq-1|117=q-2|55=EUR/USD|132=1.1011|133=1.1012|"},
+		{initiator, 20 * time.Millisecond, "8=FIX.4.4|35=D|34=3|11=order-1|117=q-2|55=EUR/USD|54=1|38=1000000|40=D|44=1.1012|"},
+	})
+
+	rfq := expectFixEvent(t, results, "rfq")
+	assert.Equal(t, "rfq-1", rfq["quote_req_id"])
+	assert.Equal(t, "EUR/USD", rfq["symbol"])
+	assert.Equal(t, "traded", rfq["status"])
+	assert.Equal(t, 3, rfq["quotes"])
+	assert.Equal(t, 2, rfq["quote_ids"])
+	assert.Equal(t, "q-2", rfq["quote_id"])
+	assert.Equal(t, "order-1", rfq["cl_ord_id"])
+	assert.Equal(t, int64(3000), rfq["time_to_first_quote_us"])
+	assert.Equal(t, int64(12000), rfq["quote_to_trade_us"])
+	assert.Equal(t, int64(20000), rfq["request_to_trade_us"])
+
+	conn := private.(*fixConnectionData)
+	assert.Empty(t, conn.rfqs.requests[initiator])
+	assert.Empty(t, conn.rfqs.quotes[initiator])
+}
+
+func TestRFQRejected(t *testing.T) {
+	fix, results := fixModForTests()
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+
+	parseTimedMessages(fix, ts, []timedMessage{
+		{initiator, 0, "8=FIX.4.4|35=R|34=2|131=rfq-1|146=1|55=XS0123456789|"},
+		{acceptor, time.Millisecond, "8=FIX.4.4|35=AG|34=2|131=rfq-1|658=1|"},
+	})
+
+	rfq := expectFixEvent(t, results, "rfq")
+	assert.Equal(t, "rejected", rfq["status"])
+	assert.Equal(t, 0, rfq["quotes"])
+	assert.Equal(t, "1", rfq["reject_reason"])
+	assert.NotContains(t, rfq, "time_to_first_quote_us")
+	assert.NotContains(t, rfq, "quote_to_trade_us")
+}
+
+func TestRFQExpired(t *testing.T) {
+	fix, results := fixModForTests()
+	fix.rfqTimeout = time.Minute
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+
+	private := parseTimedMessages(fix, ts, []timedMessage{
+		{initiator, 0, "8=FIX.4.4|35=R|34=2|131=rfq-1|146=1|55=EUR/USD|"},
+		{acceptor, 2 * time.Millisecond, "8=FIX.4.4|35=S|34=2|131=rfq-1|117=q-1|"},
+		// heartbeats after the timeout expire the RFQ
+		{initiator, 30 * time.Second, "8=FIX.4.4|35=0|34=3|"},
+		{initiator, 61 * time.Second, "8=FIX.4.4|35=0|34=4|"},
+		// orders on expired quotes are not correlated
+		{initiator, 62 * time.Second, "8=FIX.4.4|35=D|34=5|11=order-1|117=q-1|"},
+	})
+
+	event := expectEvent(t, results)
+	for event["fix"].(common.MapStr)["rfq"] == nil {
+		event = expectEvent(t, results)
+	}
+	assert.Equal(t, common.Time(ts.Add(time.Minute)), event["@timestamp"])
+
+	rfq := event["fix"].(common.MapStr)["rfq"].(common.MapStr)
+	assert.Equal(t, "expired", rfq["status"])
+	assert.Equal(t, 1, rfq["quotes"])
+	assert.Equal(t, int64(2000), rfq["time_to_first_quote_us"])
+	assert.NotContains(t, rfq, "quote_id")
+
+	for len(results.Channel) > 0 {
+		event := expectEvent(t, results)
+		assert.NotContains(t, event["fix"], "rfq")
+	}
+	assert.Empty(t, private.(*fixConnectionData).rfqs.quotes[initiator])
+}
+
+func TestRFQExpiredOnClose(t *testing.T) {
+	fix, results := fixModForTests()
+	fix.rfqTimeout = time.Minute
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+
+	private := parseTimedMessages(fix, ts, []timedMessage{
+		{initiator, 0, "8=FIX.4.4|35=R|34=2|131=rfq-1|146=1|55=EUR/USD|"},
+		{initiator, time.Millisecond, "8=FIX.4.4|35=R|34=3|131=rfq-2|146=1|55=GBP/USD|"},
+		{acceptor, 2 * time.Millisecond, "8=FIX.4.4|35=S|34=2|131=rfq-2|117=q-2|"},
+	})
+	fix.ReceivedFin(&sessionTuple, initiator, private)
+
+	rfq := expectFixEvent(t, results, "rfq")
+	assert.Equal(t, "rfq-1", rfq["quote_req_id"])
+	assert.Equal(t, "expired", rfq["status"])
+	rfq = expectFixEvent(t, results, "rfq")
+	assert.Equal(t, "rfq-2", rfq["quote_req_id"])
+	assert.Equal(t, "expired", rfq["status"])
+	assert.Equal(t, 1, rfq["quotes"])
+
+	conn := private.(*fixConnectionData)
+	assert.Empty(t, conn.rfqs.requests[initiator])
+	assert.Empty(t, conn.rfqs.quotes[initiator])
+
+	// open RFQs are also reported on shutdown
+	private = parseTimedMessages(fix, ts, []timedMessage{
+		{initiator, 0, "8=FIX.4.4|35=R|34=2|131=rfq-3|146=1|55=EUR/USD|"},
+	})
+	fix.Flush(&sessionTuple, private)
+	rfq = expectFixEvent(t, results, "rfq")
+	assert.Equal(t, "rfq-3", rfq["quote_req_id"])
+	assert.Equal(t, "expired", rfq["status"])
+}
+
+func TestRFQUnsolicitedQuotes(t *testing.T) {
+	var r rfqTracker
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+	msg := func(offset time.Duration, fields tagValues) *message {
+		return &message{ts: ts.Add(offset), fields: fields}
+	}
+
+	// quotes and orders not following a captured QuoteRequest are ignored
+	assert.Empty(t, r.onMessage(acceptor, msg(0, tagValues{
+		{tagMsgType, msgTypeQuote}, {tagQuoteReqID, "rfq-0"}, {tagQuoteID, "q-0"},
+	}), time.Minute))
+	assert.Empty(t, r.onMessage(initiator, msg(time.Millisecond, tagValues{
+		{tagMsgType, msgTypeNewOrderSingle}, {tagClOrdID, "order-1"}, {tagQuoteID, "q-0"},
+	}), time.Minute))
+
+	// a reused QuoteReqID starts a new RFQ
+	r.onMessage(initiator, msg(2*time.Millisecond, tagValues{
+		{tagMsgType, msgTypeQuoteRequest}, {tagQuoteReqID, "rfq-1"},
+	}), time.Minute)
+	r.onMessage(acceptor, msg(3*time.Millisecond, tagValues{
+		{tagMsgType, msgTypeQuote}, {tagQuoteReqID, "rfq-1"}, {tagQuoteID, "q-1"},
+	}), time.Minute)
+	r.onMessage(initiator, msg(4*time.Millisecond, tagValues{
+		{tagMsgType, msgTypeQuoteRequest}, {tagQuoteReqID, "rfq-1"},
+	}), time.Minute)
+	assert.Len(t, r.requests[initiator], 1)
+	assert.Equal(t, 0, r.requests[initiator]["rfq-1"].quotes)
+	assert.Empty(t, r.quotes[initiator])
+}
+
+func TestOpenRFQsLimit(t *testing.T) {
+	var r rfqTracker
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+	request := func(reqID string, ts time.Time) *message {
+		raw := fixMessage("8=FIX.4.4|35=R|131=" + reqID + "|146=1|55=EUR/USD|")
+		return &message{ts: ts, fields: splitFields(raw)}
+	}
+	for i := 0; i < maxPendingOrders; i++ {
+		r.open(initiator, request(fmt.Sprintf("rfq-%d", i), ts.Add(time.Duration(i)*time.Millisecond)))
+	}
+	evicted := evictedRFQs.Value()
+
+	// the oldest RFQ makes room for the new one
+	r.open(initiator, request("new", ts.Add(time.Minute)))
+	assert.Len(t, r.requests[initiator], maxPendingOrders)
+	assert.Contains(t, r.requests[initiator], "new")
+	assert.NotContains(t, r.requests[initiator], "rfq-0")
+	assert.Contains(t, r.requests[initiator], "rfq-1")
+	assert.Equal(t, evicted+1, evictedRFQs.Value())
+}
@@ -0,0 +1,82 @@
+package fix
+
+import "sync"
+
+type samplingConfig struct {
+	SenderCompID string   `config:"sender_comp_id"`
+	TargetCompID string   `config:"target_comp_id"`
+	MsgTypes     []string `config:"msg_types" validate:"required"`
+	Rate         int      `config:"rate" validate:"required, min=1"`
+}
+
+// msgSampler publishes one in rate messages of the sampled MsgTypes, like the
+// MarketDataIncrementalRefresh messages of market data sessions. Messages of
+// other MsgTypes, like orders and executions, are always published. Rules
+// are checked in order and the first rule matching the session of a message
+// applies.
+//
+// Messages are counted per SenderCompID, TargetCompID and MsgType, so UDP
+// feeds are sampled like TCP sessions.
+type msgSampler struct {
+	rules []samplingRule
+
+	mutex  sync.Mutex
+	counts map[sampleKey]uint64
+}
+
+type samplingRule struct {
+	senderCompID, targetCompID string
+	msgTypes                   map[string]bool
+	rate                       uint64
+}
+
+type sampleKey struct {
+	senderCompID, targetCompID, msgType string
+}
+
+func newMsgSampler(configs []samplingConfig) *msgSampler {
+	if len(configs) == 0 {
+		return nil
+	}
+
+	s := &msgSampler{counts: map[sampleKey]uint64{}}
+	for _, c := range configs {
+		s.rules = append(s.rules, samplingRule{
+			senderCompID: c.SenderCompID,
+			targetCompID: c.TargetCompID,
+			msgTypes:     stringSet(c.MsgTypes),
+			rate:         uint64(c.Rate),
+		})
+	}
+	return s
+}
+
+// sample returns false if the message is not to be published. For the
+// messages of sampled MsgTypes published, the sampling rate is returned, 0
+// otherwise.
+func (s *msgSampler) sample(fields tagValues) (int, bool) {
+	if s == nil {
+		return 0, true
+	}
+
+	sender, _ := fields.get(tagSenderCompID)
+	target, _ := fields.get(tagTargetCompID)
+	msgType, _ := fields.get(tagMsgType)
+	for i := range s.rules {
+		rule := &s.rules[i]
+		if !matchSession(rule.senderCompID, rule.targetCompID, sender, target) {
+			continue
+		}
+		if !rule.msgTypes[msgType] {
+			return 0, true
+		}
+
+		key := sampleKey{sender, target, msgType}
+		s.mutex.Lock()
+		n := s.counts[key]
+		s.counts[key] = n + 1
+		s.mutex.Unlock()
+		return int(rule.rate), n%rule.rate == 0
+	}
+	return 0, true
+}
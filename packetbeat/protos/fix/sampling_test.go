@@ -0,0 +1,100 @@
+// +build !integration
+
+package fix
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/packetbeat/protos"
+)
+
+func TestMsgSamplerSample(t *testing.T) {
+	s := newMsgSampler([]samplingConfig{
+		{SenderCompID: "MDFEED", MsgTypes: []string{"X", "W"}, Rate: 3},
+		{MsgTypes: []string{"X"}, Rate: 2},
+	})
+
+	sample := func(msg string) (int, bool) {
+		return s.sample(splitFields(fixMessage(msg)))
+	}
+	published := func(msg string, n int) []bool {
+		var result []bool
+		for i := 0; i < n; i++ {
+			_, ok := sample(msg)
+			result = append(result, ok)
+		}
+		return result
+	}
+
+	// one in three messages of each MsgType of the MDFEED session
+	assert.Equal(t, []bool{true, false, false, true, false},
+		published("8=FIX.4.4|35=X|49=MDFEED|56=CLIENT|", 5))
+	assert.Equal(t, []bool{true, false, false},
+		published("8=FIX.4.4|35=W|49=MDFEED|56=CLIENT|", 3))
+	rate, ok := sample("8=FIX.4.4|35=X|49=MDFEED|56=CLIENT|")
+	assert.Equal(t, 3, rate)
+	assert.False(t, ok)
+
+	// order flow is always published
+	rate, ok = sample("8=FIX.4.4|35=8|49=MDFEED|56=CLIENT|")
+	assert.Equal(t, 0, rate)
+	assert.True(t, ok)
+
+	// other sessions are counted separately
+	assert.Equal(t, []bool{true, false, true},
+		published("8=FIX.4.4|35=X|49=OTHER|56=CLIENT|", 3))
+	assert.Equal(t, []bool{true, true},
+		published("8=FIX.4.4|35=W|49=OTHER|56=CLIENT|", 2))
+
+	rate, ok = newMsgSampler(nil).sample(splitFields(fixMessage("8=FIX.4.4|35=X|")))
+	assert.Equal(t, 0, rate)
+	assert.True(t, ok)
+}
+
+func TestParseSampledMessages(t *testing.T) {
+	fix, results := fixModForTests()
+	fix.sampler = newMsgSampler([]samplingConfig{{MsgTypes: []string{"X"}, Rate: 2}})
+
+	parseMessages(fix,
+		"8=FIX.4.4|35=X|34=1|49=MDFEED|56=CLIENT|55=VOD.L|",
+		"8=FIX.4.4|35=X|34=2|49=MDFEED|56=CLIENT|55=BARC.L|",
+		"8=FIX.4.4|35=8|34=3|49=MDFEED|56=CLIENT|",
+		"8=FIX.4.4|35=X|34=4|49=MDFEED|56=CLIENT|55=LLOY.L|")
+
+	refresh := expectEvent(t, results)["fix"].(common.MapStr)
+	assert.Equal(t, "VOD.L", refresh["Symbol"])
+	assert.Equal(t, 2, refresh["sample_rate"])
+
+	report := expectEvent(t, results)["fix"].(common.MapStr)
+	assert.Equal(t, "8", report["MsgType"])
+	assert.NotContains(t, report, "sample_rate")
+
+	refresh = expectEvent(t, results)["fix"].(common.MapStr)
+	assert.Equal(t, "LLOY.L", refresh["Symbol"])
+	assert.Empty(t, results.Channel)
+}
+
+func TestParseUDPSampledMessages(t *testing.T) {
+	fix, results := fixModForTests()
+	fix.sampler = newMsgSampler([]samplingConfig{{MsgTypes: []string{"X"}, Rate: 2}})
+
+	for i, symbol := range []string{"VOD.L", "BARC.L", "LLOY.L"} {
+		fix.ParseUDP(&protos.Packet{
+			Ts: time.Now(),
+			Tuple: common.NewIPPortTuple(4,
+				net.ParseIP("10.0.0.1"), 40000,
+				net.ParseIP("239.1.1.1"), 9878),
+			Payload: fixMessage("8=FIX.4.4|35=X|34=" + strconv.Itoa(i+1) + "|49=MDFEED|55=" + symbol + "|"),
+		})
+	}
+
+	assert.Equal(t, "VOD.L", expectEvent(t, results)["fix"].(common.MapStr)["Symbol"])
+	assert.Equal(t, "LLOY.L", expectEvent(t, results)["fix"].(common.MapStr)["Symbol"])
+	assert.Empty(t, results.Channel)
+}
@@ -0,0 +1,95 @@
+package fix
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type fieldNamesConfig struct {
+	Strategy    string `config:"strategy"`
+	Replacement string `config:"replacement"`
+	Prefix      string `config:"prefix"`
+}
+
+// nameSanitizer renames or drops the field names breaking Elasticsearch
+// mappings before events are published: names with dots, which are expanded
+// to objects, names with a leading underscore, reserved for metadata fields,
+// and numeric-only names.
+type nameSanitizer struct {
+	strategy    string
+	replacement string
+	prefix      string
+}
+
+var defaultFieldNamesConfig = fieldNamesConfig{
+	Strategy:    "replace",
+	Replacement: "_",
+	Prefix:      "tag_",
+}
+
+func (c *fieldNamesConfig) Validate() error {
+	switch c.Strategy {
+	case "replace", "prefix", "drop":
+	default:
+		return fmt.Errorf("invalid field_names strategy: %s, must be one of replace, prefix or drop",
+			c.Strategy)
+	}
+	if strings.Contains(c.Replacement, ".") {
+		return errors.New("field_names replacement must not contain dots")
+	}
+	if c.Strategy != "drop" && !isSafeFieldName(c.Prefix) {
+		return fmt.Errorf("invalid field_names prefix: %q, must not be empty, numeric, "+
+			"contain dots or start with an underscore", c.Prefix)
+	}
+	return nil
+}
+
+func newNameSanitizer(config fieldNamesConfig) *nameSanitizer {
+	return &nameSanitizer{
+		strategy:    config.Strategy,
+		replacement: config.Replacement,
+		prefix:      config.Prefix,
+	}
+}
+
+// sanitize returns the name to publish a field with. The second return value
+// is false if the field is dropped. Safe names are returned unchanged.
+func (s *nameSanitizer) sanitize(name string) (string, bool) {
+	if s == nil || isSafeFieldName(name) {
+		return name, true
+	}
+
+	var sanitized string
+	switch s.strategy {
+	case "drop":
+		debugf("dropped field with unsafe name %q", name)
+		droppedFieldNames.Add(1)
+		return "", false
+	case "prefix":
+		sanitized = s.prefix + strings.Replace(name, ".", s.replacement, -1)
+	default:
+		sanitized = strings.TrimLeft(strings.Replace(name, ".", s.replacement, -1), "_")
+		if !isSafeFieldName(sanitized) {
+			// empty or numeric-only names can't be repaired by replacing
+			sanitized = s.prefix + sanitized
+		}
+	}
+	debugf("renamed field with unsafe name %q to %q", name, sanitized)
+	renamedFieldNames.Add(1)
+	return sanitized, true
+}
+
+// isSafeFieldName checks that name is not empty, has no dots, doesn't start
+// with an underscore and is not made of digits only.
+func isSafeFieldName(name string) bool {
+	if name == "" || name[0] == '_' || strings.IndexByte(name, '.') >= 0 {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if name[i] < '0' || name[i] > '9' {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+// +build !integration
+
+package fix
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func TestSanitizeFieldNames(t *testing.T) {
+	for _, test := range []struct {
+		strategy string
+		name     string
+		expected string
+		ok       bool
+	}{
+		{"replace", "ClOrdID", "ClOrdID", true},
+		{"replace", "Desk.Id", "Desk_Id", true},
+		{"replace", "_Internal", "Internal", true},
+		{"replace", "5001", "tag_5001", true},
+		{"replace", "__", "tag_", true},
+		{"prefix", "ClOrdID", "ClOrdID", true},
+		{"prefix", "Desk.Id", "tag_Desk_Id", true},
+		{"prefix", "_Internal", "tag__Internal", true},
+		{"prefix", "5001", "tag_5001", true},
+		{"drop", "ClOrdID", "ClOrdID", true},
+		{"drop", "Desk.Id", "", false},
+		{"drop", "5001", "", false},
+	} {
+		config := defaultFieldNamesConfig
+		config.Strategy = test.strategy
+		name, ok := newNameSanitizer(config).sanitize(test.name)
+		assert.Equal(t, test.ok, ok, "%s %s", test.strategy, test.name)
+		assert.Equal(t, test.expected, name, "%s %s", test.strategy, test.name)
+	}
+}
+
+func TestFieldNamesConfig(t *testing.T) {
+	for _, settings := range []map[string]interface{}{
+		{"field_names.strategy": "rename"},
+		{"field_names.replacement": "."},
+		{"field_names.prefix": "_"},
+		{"field_names.prefix": ""},
+	} {
+		cfg, err := common.NewConfigFrom(settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config := defaultConfig
+		assert.Error(t, cfg.Unpack(&config), "%v", settings)
+	}
+
+	cfg, _ := common.NewConfigFrom(map[string]interface{}{
+		"field_names.strategy": "drop",
+		"field_names.prefix":   "",
+	})
+	config := defaultConfig
+	assert.NoError(t, cfg.Unpack(&config))
+}
+
+func TestPublishSanitizedFieldNames(t *testing.T) {
+	config := defaultConfig
+	config.FieldsMapping = []mappingConfig{
+		{Tag: 5001, Name: "desk.id"},
+		{Tag: 5002, Name: "5002"},
+	}
+
+	var fix fixPlugin
+	_, results := fixModForTests()
+	fix.init(results, &config)
+
+	parseMessages(&fix, "8=FIX.4.2|35=D|34=2|55=IBM|5001=EQ|5002=X|")
+	event := expectEvent(t, results)["fix"].(common.MapStr)
+
+	assert.Equal(t, "IBM", event["Symbol"])
+	assert.Equal(t, "EQ", event["desk_id"])
+	assert.Equal(t, "X", event["tag_5002"])
+	assert.NotContains(t, event, "desk.id")
+}
@@ -0,0 +1,647 @@
+package fix
+
+import (
+	"encoding/binary"
+	"errors"
+	"expvar"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/paths"
+
+	"github.com/elastic/beats/packetbeat/protos"
+)
+
+type sbeConfig struct {
+	Schema  string `config:"schema" validate:"required"`
+	Ports   []int  `config:"ports" validate:"required"`
+	Framing string `config:"framing"`
+}
+
+func (c *sbeConfig) Validate() error {
+	switch c.Framing {
+	case "", "sofh", "sofh16", "mdp3":
+		return nil
+	}
+	return fmt.Errorf("invalid sbe framing: %s, must be one of sofh, sofh16 or mdp3", c.Framing)
+}
+
+// sbeStreams selects the SBE schema decoding the streams and datagrams of the
+// configured ports.
+type sbeStreams struct {
+	ports map[uint16]*sbeStream
+}
+
+type sbeStream struct {
+	schema  *sbeSchema
+	framing string
+}
+
+// sbeFrame is an SBE message being processed, adding the schema and template
+// of the message to its event.
+type sbeFrame struct {
+	msg     *sbeMessage
+	version int
+
+	// MsgSeqNum of the MDP 3.0 packet of the message, 0 if not framed by
+	// mdp3
+	packetSeqNum uint32
+}
+
+var (
+	errSBETruncated = errors.New("truncated SBE message")
+
+	sbeMessagesDecoded = expvar.NewInt("fix.sbe.messages")
+	sbeDecodeErrors    = expvar.NewInt("fix.sbe.decode_errors")
+)
+
+// sbe framing sizes
+const (
+	sofhLen       = 6
+	sofh16Len     = 4
+	mdp3HeaderLen = 12
+	mdp3SizeLen   = 2
+)
+
+func loadSBESchemas(configs []sbeConfig) (*sbeStreams, error) {
+	if len(configs) == 0 {
+		return nil, nil
+	}
+
+	s := &sbeStreams{ports: map[uint16]*sbeStream{}}
+	for _, c := range configs {
+		path := paths.Resolve(paths.Config, c.Schema)
+		schema, err := readSBESchema(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load SBE schema %v: %v", path, err)
+		}
+
+		stream := &sbeStream{schema: schema, framing: c.Framing}
+		if stream.framing == "" {
+			stream.framing = "sofh"
+		}
+		for _, port := range c.Ports {
+			if _, exists := s.ports[uint16(port)]; exists {
+				return nil, fmt.Errorf("port %v is set for several SBE schemas", port)
+			}
+			s.ports[uint16(port)] = stream
+		}
+	}
+	return s, nil
+}
+
+// lookup returns the SBE stream of one of the ports of a connection, nil if
+// the connection carries tag=value messages.
+func (s *sbeStreams) lookup(ports [2]uint16) *sbeStream {
+	if s == nil {
+		return nil
+	}
+	if stream, ok := s.ports[ports[1]]; ok {
+		return stream
+	}
+	return s.ports[ports[0]]
+}
+
+// nextFrame returns the length of the header and of the message of the first
+// frame of buf. The frame is incomplete if buf is shorter than the header
+// and message lengths.
+func (s *sbeStream) nextFrame(buf []byte) (header, length int, ok bool) {
+	switch s.framing {
+	case "sofh16":
+		if len(buf) < sofh16Len {
+			return sofh16Len, 0, true
+		}
+		n := int(binary.LittleEndian.Uint16(buf))
+		return sofh16Len, n - sofh16Len, n >= sofh16Len
+	case "mdp3":
+		if len(buf) < mdp3SizeLen {
+			return mdp3SizeLen, 0, true
+		}
+		n := int(binary.LittleEndian.Uint16(buf))
+		return mdp3SizeLen, n - mdp3SizeLen, n >= mdp3SizeLen
+	}
+	if len(buf) < sofhLen {
+		return sofhLen, 0, true
+	}
+	n := int(binary.BigEndian.Uint32(buf))
+	return sofhLen, n - sofhLen, n >= sofhLen && n <= 1<<20
+}
+
+// decode decodes an SBE message into the tag=value message published, with
+// its MsgType and the fields of the template identified by their FIX tag.
+func (s *sbeStream) decode(ts time.Time, buf []byte) (*message, *sbeFrame, error) {
+	schema := s.schema
+	if len(buf) < schema.header.size {
+		return nil, nil, errSBETruncated
+	}
+	header := buf[:schema.header.size]
+	blockLength := int(schema.header.member("blockLength").read(schema.order, header).int64())
+	templateID := int(schema.header.member("templateId").read(schema.order, header).int64())
+	version := schema.version
+	if m := schema.header.member("version"); m != nil {
+		version = int(m.read(schema.order, header).int64())
+	}
+	if m := schema.header.member("schemaId"); m != nil {
+		if id := int(m.read(schema.order, header).int64()); id != schema.id {
+			return nil, nil, fmt.Errorf("message of SBE schema %v, expected %v", id, schema.id)
+		}
+	}
+
+	tmpl, ok := schema.messages[templateID]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown SBE template %v", templateID)
+	}
+
+	d := &sbeDecoder{order: schema.order, version: version, buf: buf, pos: len(header)}
+	fields := tagValues{{tag: tagMsgType, value: tmpl.msgType}}
+	fields, err := d.decodeBlock(&tmpl.sbeBlock, blockLength, -1, fields)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	msg := &message{
+		ts:            ts,
+		fields:        fields,
+		checksumValid: true,
+	}
+	// the raw message is published in tag=value encoding
+	msg.raw = fields.encode(soh)
+	return msg, &sbeFrame{msg: tmpl, version: version}, nil
+}
+
+type sbeDecoder struct {
+	order   binary.ByteOrder
+	version int
+	buf     []byte
+	pos     int
+}
+
+// decodeBlock decodes the fields of a block of blockLength bytes, followed by
+// its groups and data fields, appending them to fields. The field at index
+// delimiter is decoded first, as it starts the entries of groups.
+func (d *sbeDecoder) decodeBlock(b *sbeBlock, blockLength, delimiter int, fields tagValues) (tagValues, error) {
+	if blockLength < 0 || d.pos+blockLength > len(d.buf) {
+		return nil, errSBETruncated
+	}
+	block := d.buf[d.pos : d.pos+blockLength]
+	d.pos += blockLength
+
+	if delimiter >= 0 {
+		value, _ := d.decodeField(b.fields[delimiter], block)
+		fields = append(fields, tagValue{tag: b.fields[delimiter].id, value: value})
+	}
+	for i, f := range b.fields {
+		if i == delimiter {
+			continue
+		}
+		if value, ok := d.decodeField(f, block); ok {
+			fields = append(fields, tagValue{tag: f.id, value: value})
+		}
+	}
+
+	var err error
+	for _, g := range b.groups {
+		if fields, err = d.decodeGroup(g, fields); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range b.data {
+		if fields, err = d.decodeData(f, fields); err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+func (d *sbeDecoder) decodeGroup(g *sbeGroup, fields tagValues) (tagValues, error) {
+	if g.sinceVersion() > d.version {
+		return fields, nil
+	}
+	if d.pos+g.dimension.size > len(d.buf) {
+		return nil, errSBETruncated
+	}
+	dimension := d.buf[d.pos : d.pos+g.dimension.size]
+	d.pos += g.dimension.size
+	blockLength := int(g.dimension.member("blockLength").read(d.order, dimension).int64())
+	numInGroup := int(g.dimension.member("numInGroup").read(d.order, dimension).int64())
+	if numInGroup < 0 || (blockLength > 0 && numInGroup > (len(d.buf)-d.pos)/blockLength) {
+		return nil, errSBETruncated
+	}
+
+	fields = append(fields, tagValue{tag: g.id, value: strconv.Itoa(numInGroup)})
+	var err error
+	for i := 0; i < numInGroup; i++ {
+		if fields, err = d.decodeBlock(&g.sbeBlock, blockLength, g.delimiter, fields); err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+func (d *sbeDecoder) decodeData(f *sbeField, fields tagValues) (tagValues, error) {
+	if f.sinceVersion > d.version {
+		return fields, nil
+	}
+	length, data := f.typ.member("length"), f.typ.member("varData")
+	if d.pos+data.offset > len(d.buf) {
+		return nil, errSBETruncated
+	}
+	n := int(length.read(d.order, d.buf[d.pos:]).int64())
+	d.pos += data.offset
+	if n < 0 || n > maxSBEDataLength || d.pos+n > len(d.buf) {
+		return nil, errSBETruncated
+	}
+	value := string(d.buf[d.pos : d.pos+n])
+	d.pos += n
+	if value != "" {
+		fields = append(fields, tagValue{tag: f.id, value: value})
+	}
+	return fields, nil
+}
+
+// sinceVersion returns the version the group has been added in, being the
+// version of its first field.
+func (g *sbeGroup) sinceVersion() int {
+	return g.fields[0].sinceVersion
+}
+
+// decodeField returns the value of f in tag=value encoding. The second return
+// value is false if the value is null or the field is not part of the block,
+// as sent by an older version of the schema.
+func (d *sbeDecoder) decodeField(f *sbeField, block []byte) (string, bool) {
+	if f.isConstant {
+		return f.constant, f.constant != ""
+	}
+	if f.sinceVersion > d.version || f.offset+f.typ.size > len(block) {
+		return "", false
+	}
+	b := block[f.offset : f.offset+f.typ.size]
+
+	if f.isTimestamp() {
+		return decodeSBETimestamp(f.typ, d.order, b)
+	}
+	if f.semanticType == "LocalMktDate" && f.typ.kind == sbePrimitive {
+		n, ok := f.typ.number(d.order, b)
+		if !ok {
+			return "", false
+		}
+		day := time.Unix(n.int64()*24*3600, 0).UTC()
+		return day.Format("20060102"), true
+	}
+	return f.typ.decode(d.order, b)
+}
+
+// read reads the primitive value of a member of a composite.
+func (m *sbeMember) read(order binary.ByteOrder, b []byte) sbeNumber {
+	if m.typ.isConstant {
+		n, _ := parseSBENumber(m.typ.primitive, m.typ.constant)
+		return n
+	}
+	if m.offset+m.typ.size > len(b) {
+		return sbeNumber{}
+	}
+	return readSBENumber(m.typ.primitive, order, b[m.offset:])
+}
+
+func readSBENumber(primitive string, order binary.ByteOrder, b []byte) sbeNumber {
+	switch primitive {
+	case "char", "uint8":
+		return sbeNumber{u: uint64(b[0])}
+	case "int8":
+		return sbeNumber{i: int64(int8(b[0])), signed: true}
+	case "uint16":
+		return sbeNumber{u: uint64(order.Uint16(b))}
+	case "int16":
+		return sbeNumber{i: int64(int16(order.Uint16(b))), signed: true}
+	case "uint32":
+		return sbeNumber{u: uint64(order.Uint32(b))}
+	case "int32":
+		return sbeNumber{i: int64(int32(order.Uint32(b))), signed: true}
+	case "uint64":
+		return sbeNumber{u: order.Uint64(b)}
+	case "int64":
+		return sbeNumber{i: int64(order.Uint64(b)), signed: true}
+	case "float":
+		return sbeNumber{f: float64(math.Float32frombits(order.Uint32(b))), float: true}
+	case "double":
+		return sbeNumber{f: math.Float64frombits(order.Uint64(b)), float: true}
+	}
+	return sbeNumber{}
+}
+
+// number returns the value of a single primitive, false if null.
+func (t *sbeType) number(order binary.ByteOrder, b []byte) (sbeNumber, bool) {
+	if t.isConstant {
+		n, err := parseSBENumber(t.primitive, t.constant)
+		return n, err == nil
+	}
+	if len(b) < sbePrimitiveSizes[t.primitive] {
+		return sbeNumber{}, false
+	}
+	n := readSBENumber(t.primitive, order, b)
+	if (t.optional || t.primitive == "char") && n.equal(t.null) {
+		return n, false
+	}
+	return n, true
+}
+
+// decode returns the value of the type in tag=value encoding, false if null.
+func (t *sbeType) decode(order binary.ByteOrder, b []byte) (string, bool) {
+	switch t.kind {
+	case sbeEnum:
+		n, ok := t.number(order, b)
+		if !ok {
+			return "", false
+		}
+		value := n.String()
+		if t.primitive == "char" {
+			value = string(byte(n.u))
+		}
+		if t.optional || len(t.values) == 0 {
+			return value, true
+		}
+		if _, valid := t.values[value]; !valid && n.equal(t.null) {
+			return "", false
+		}
+		return value, true
+
+	case sbeSet:
+		n, _ := t.number(order, b)
+		bits := n.u
+		if n.signed {
+			bits = uint64(n.i)
+		}
+		var names []string
+		for bit := uint(0); bit < uint(t.size*8); bit++ {
+			if bits&(1<<bit) == 0 {
+				continue
+			}
+			if name, ok := t.choices[bit]; ok {
+				names = append(names, name)
+			}
+		}
+		return strings.Join(names, " "), len(names) > 0
+
+	case sbeComposite:
+		return t.decodeComposite(order, b)
+	}
+
+	if t.isConstant {
+		return t.constant, t.constant != ""
+	}
+	if t.primitive == "char" {
+		s := string(b)
+		if i := strings.IndexByte(s, 0); i >= 0 {
+			s = s[:i]
+		}
+		s = strings.TrimRight(s, " ")
+		return s, s != ""
+	}
+	if t.length > 1 {
+		size := sbePrimitiveSizes[t.primitive]
+		values := make([]string, 0, t.length)
+		for i := 0; i < t.length; i++ {
+			if n, ok := t.number(order, b[i*size:]); ok {
+				values = append(values, n.String())
+			}
+		}
+		return strings.Join(values, " "), len(values) > 0
+	}
+	n, ok := t.number(order, b)
+	if !ok {
+		return "", false
+	}
+	return n.String(), true
+}
+
+// decodeComposite decodes decimals from their mantissa and exponent, months
+// from their year, month and optional day, and other composites as their
+// named member values.
+func (t *sbeType) decodeComposite(order binary.ByteOrder, b []byte) (string, bool) {
+	if mantissa := t.member("mantissa"); mantissa != nil {
+		m, ok := mantissa.typ.number(order, b[mantissa.offset:])
+		if !ok {
+			return "", false
+		}
+		exponent := 0
+		if e := t.member("exponent"); e != nil {
+			n, ok := e.typ.number(order, b[e.offset:])
+			if !ok {
+				return "", false
+			}
+			exponent = int(n.int64())
+		}
+		return formatSBEDecimal(m.int64(), exponent), true
+	}
+
+	if year, month := t.member("year"), t.member("month"); year != nil && month != nil {
+		y, ok := year.typ.number(order, b[year.offset:])
+		if !ok {
+			return "", false
+		}
+		value := fmt.Sprintf("%04d", y.int64())
+		if m, ok := month.typ.number(order, b[month.offset:]); ok {
+			value += fmt.Sprintf("%02d", m.int64())
+		}
+		if day := t.member("day"); day != nil {
+			if d, ok := day.typ.number(order, b[day.offset:]); ok {
+				value += fmt.Sprintf("%02d", d.int64())
+			}
+		}
+		return value, true
+	}
+
+	var values []string
+	for i := range t.members {
+		m := &t.members[i]
+		if m.offset+m.typ.size > len(b) {
+			continue
+		}
+		if value, ok := m.typ.decode(order, b[m.offset:m.offset+m.typ.size]); ok {
+			values = append(values, m.name+"="+value)
+		}
+	}
+	return strings.Join(values, " "), len(values) > 0
+}
+
+// decodeSBETimestamp decodes a UTCTimestamp, an integer or a composite of the
+// time and its unit, counting nanoseconds since the epoch by default.
+func decodeSBETimestamp(t *sbeType, order binary.ByteOrder, b []byte) (string, bool) {
+	var n sbeNumber
+	unit := 9
+	if t.kind == sbeComposite {
+		m := t.member("time")
+		var ok bool
+		if n, ok = m.typ.number(order, b[m.offset:]); !ok {
+			return "", false
+		}
+		if u := t.member("unit"); u != nil {
+			if v, ok := u.typ.number(order, b[u.offset:]); ok {
+				unit = int(v.int64())
+			}
+		}
+	} else {
+		var ok bool
+		if n, ok = t.number(order, b); !ok {
+			return "", false
+		}
+	}
+
+	var ns int64
+	switch unit {
+	case 0:
+		ns = n.int64() * int64(time.Second)
+	case 3:
+		ns = n.int64() * int64(time.Millisecond)
+	case 6:
+		ns = n.int64() * int64(time.Microsecond)
+	default:
+		ns = n.int64()
+	}
+	return time.Unix(0, ns).UTC().Format(utcTimestampLayout + ".000000000"), true
+}
+
+// formatSBEDecimal formats mantissa * 10^exponent without rounding.
+func formatSBEDecimal(mantissa int64, exponent int) string {
+	sign := ""
+	digits := strconv.FormatUint(uint64(mantissa), 10)
+	if mantissa < 0 {
+		sign = "-"
+		digits = strconv.FormatUint(uint64(-mantissa), 10)
+	}
+	if exponent >= 0 {
+		if mantissa == 0 {
+			return "0"
+		}
+		return sign + digits + strings.Repeat("0", exponent)
+	}
+
+	scale := -exponent
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	whole, frac := digits[:len(digits)-scale], strings.TrimRight(digits[len(digits)-scale:], "0")
+	if frac == "" {
+		if whole == "0" {
+			return "0"
+		}
+		return sign + whole
+	}
+	return sign + whole + "." + frac
+}
+
+// parseSBE frames and publishes the SBE messages of a TCP stream. Streams
+// failing to frame are dropped, lacking a marker to resynchronize on.
+func (fix *fixPlugin) parseSBE(
+	conn *fixConnectionData,
+	st *stream,
+	sbe *sbeStream,
+	pkt *protos.Packet,
+	tcptuple *common.TCPTuple,
+	dir uint8,
+) *fixConnectionData {
+	for st.Buf.Len() > 0 {
+		buf := st.Buf.Bytes()
+		header, length, ok := sbe.nextFrame(buf)
+		if !ok {
+			parseErrors.Add(1)
+			if isDebug {
+				debugf("Invalid SBE frame, dropping the stream")
+			}
+			fix.reassembly.finished(conn, dir)
+			return conn
+		}
+		if len(buf) < header+length {
+			// wait for more data
+			break
+		}
+
+		fix.onSBEMessage(conn, sbe, pkt.Ts, buf[header:header+length], 0, func(msg *message) {
+			fix.onMessage(conn, tcptuple, dir, msg)
+		})
+		st.Buf.Advance(header + length)
+		st.Buf.Reset()
+	}
+	return conn
+}
+
+// parseSBEDatagram publishes the SBE messages of a datagram, as framed by
+// MDP 3.0 packets or by SOFH.
+func (fix *fixPlugin) parseSBEDatagram(
+	conn *fixConnectionData,
+	sbe *sbeStream,
+	pkt *protos.Packet,
+	src, dst *common.Endpoint,
+) {
+	buf := pkt.Payload
+	var seqNum uint32
+	if sbe.framing == "mdp3" {
+		if len(buf) < mdp3HeaderLen {
+			parseErrors.Add(1)
+			return
+		}
+		seqNum = binary.LittleEndian.Uint32(buf)
+		buf = buf[mdp3HeaderLen:]
+	}
+
+	for len(buf) > 0 {
+		header, length, ok := sbe.nextFrame(buf)
+		if !ok || len(buf) < header+length {
+			parseErrors.Add(1)
+			if isDebug {
+				debugf("Ignore %v bytes of datagram not being a complete SBE frame", len(buf))
+			}
+			return
+		}
+
+		fix.onSBEMessage(conn, sbe, pkt.Ts, buf[header:header+length], seqNum, func(msg *message) {
+			fix.onDatagramMessage(conn, pkt, src, dst, msg)
+		})
+		buf = buf[header+length:]
+	}
+}
+
+// onSBEMessage decodes an SBE message and processes it as a tag=value
+// message, the SBE template of the message being set on the connection.
+func (fix *fixPlugin) onSBEMessage(
+	conn *fixConnectionData,
+	sbe *sbeStream,
+	ts time.Time,
+	buf []byte,
+	packetSeqNum uint32,
+	process func(*message),
+) {
+	msg, frame, err := sbe.decode(ts, buf)
+	if err != nil {
+		sbeDecodeErrors.Add(1)
+		if isDebug {
+			debugf("Ignore SBE message: %v", err)
+		}
+		return
+	}
+	sbeMessagesDecoded.Add(1)
+	frame.packetSeqNum = packetSeqNum
+
+	msg.fields = fix.masker.apply(msg.fields)
+	conn.sbe = frame
+	process(msg)
+	conn.sbe = nil
+}
+
+// fields returns the SBE fields of the event of the message.
+func (f *sbeFrame) fields() common.MapStr {
+	fields := common.MapStr{
+		"schema_id":      f.msg.schema.id,
+		"schema_version": f.version,
+		"template_id":    f.msg.id,
+		"message":        f.msg.name,
+	}
+	if f.packetSeqNum > 0 {
+		fields["packet_seq_num"] = f.packetSeqNum
+	}
+	return fields
+}
@@ -0,0 +1,748 @@
+package fix
+
+import (
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// sbeSchema is an SBE message schema, loaded from its XML definition. The
+// fields of the messages are identified by their FIX tag, and messages by
+// their FIX MsgType, so that decoded messages are published as tag=value
+// messages are.
+type sbeSchema struct {
+	id              int
+	version         int
+	semanticVersion string
+	order           binary.ByteOrder
+
+	header   *sbeType
+	messages map[int]*sbeMessage
+}
+
+// sbeMessage is a message template of a schema.
+type sbeMessage struct {
+	schema  *sbeSchema
+	name    string
+	id      int
+	msgType string
+	sbeBlock
+
+	// built-in dictionary extended by the fields and repeating groups of
+	// the template
+	dict *dictionary
+}
+
+// sbeBlock holds the fields of a message or group entry, followed by its
+// repeating groups and variable length data fields.
+type sbeBlock struct {
+	fields []*sbeField
+	groups []*sbeGroup
+	data   []*sbeField
+}
+
+type sbeGroup struct {
+	name      string
+	id        int
+	dimension *sbeType
+
+	// index in fields of the field starting the entries
+	delimiter int
+	sbeBlock
+}
+
+type sbeField struct {
+	name         string
+	id           int
+	offset       int
+	typ          *sbeType
+	semanticType string
+	sinceVersion int
+
+	// value of constant fields, not encoded in messages
+	constant   string
+	isConstant bool
+}
+
+type sbeKind int
+
+const (
+	sbePrimitive sbeKind = iota
+	sbeComposite
+	sbeEnum
+	sbeSet
+)
+
+// sbeType is an encoding of the schema. Enums and sets are encoded with the
+// primitive type of their encoding type.
+type sbeType struct {
+	name         string
+	kind         sbeKind
+	primitive    string
+	length       int
+	size         int
+	semanticType string
+
+	optional bool
+	null     sbeNumber
+
+	constant   string
+	isConstant bool
+
+	// members of composites
+	members []sbeMember
+
+	// valid values of enums, by value and by name
+	values map[string]string
+	names  map[string]string
+
+	// choices of sets, by bit
+	choices map[uint]string
+}
+
+type sbeMember struct {
+	name   string
+	offset int
+	typ    *sbeType
+}
+
+var sbePrimitiveSizes = map[string]int{
+	"char":   1,
+	"int8":   1,
+	"uint8":  1,
+	"int16":  2,
+	"uint16": 2,
+	"int32":  4,
+	"uint32": 4,
+	"int64":  8,
+	"uint64": 8,
+	"float":  4,
+	"double": 8,
+}
+
+// maxSBEDataLength limits the length of the variable length data fields.
+const maxSBEDataLength = 1 << 16
+
+// xmlNode is an element of the schema, children being kept in order as the
+// members of composites are.
+type xmlNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Text     string     `xml:",chardata"`
+	Children []xmlNode  `xml:",any"`
+}
+
+func (n *xmlNode) attr(name string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (n *xmlNode) intAttr(name string, def int) (int, error) {
+	v := n.attr(name)
+	if v == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %v of %v %v: %q", name, n.XMLName.Local, n.attr("name"), v)
+	}
+	return i, nil
+}
+
+func readSBESchema(path string) (*sbeSchema, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var root xmlNode
+	if err := xml.NewDecoder(f).Decode(&root); err != nil {
+		return nil, err
+	}
+	return compileSBESchema(&root)
+}
+
+// sbeCompiler resolves the types of a schema, types referencing the types
+// defined after them.
+type sbeCompiler struct {
+	nodes map[string]*xmlNode
+	types map[string]*sbeType
+	// types being resolved, to detect cycles
+	resolving map[string]bool
+}
+
+func compileSBESchema(root *xmlNode) (*sbeSchema, error) {
+	if root.XMLName.Local != "messageSchema" {
+		return nil, fmt.Errorf("not an SBE schema, root element is %v", root.XMLName.Local)
+	}
+
+	s := &sbeSchema{
+		semanticVersion: root.attr("semanticVersion"),
+		order:           binary.LittleEndian,
+		messages:        map[int]*sbeMessage{},
+	}
+	var err error
+	if s.id, err = root.intAttr("id", 0); err != nil {
+		return nil, err
+	}
+	if s.version, err = root.intAttr("version", 0); err != nil {
+		return nil, err
+	}
+	switch root.attr("byteOrder") {
+	case "", "littleEndian":
+	case "bigEndian":
+		s.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid byteOrder %q", root.attr("byteOrder"))
+	}
+
+	c := &sbeCompiler{
+		nodes:     map[string]*xmlNode{},
+		types:     map[string]*sbeType{},
+		resolving: map[string]bool{},
+	}
+	for i := range root.Children {
+		if root.Children[i].XMLName.Local != "types" {
+			continue
+		}
+		for j := range root.Children[i].Children {
+			n := &root.Children[i].Children[j]
+			if name := n.attr("name"); name != "" {
+				c.nodes[name] = n
+			}
+		}
+	}
+
+	headerType := root.attr("headerType")
+	if headerType == "" {
+		headerType = "messageHeader"
+	}
+	if s.header, err = c.lookup(headerType); err != nil {
+		return nil, err
+	}
+	for _, member := range []string{"blockLength", "templateId"} {
+		if s.header.member(member) == nil {
+			return nil, fmt.Errorf("message header %v has no %v", headerType, member)
+		}
+	}
+
+	for i := range root.Children {
+		n := &root.Children[i]
+		if n.XMLName.Local != "message" {
+			continue
+		}
+		msg, err := c.message(s, n)
+		if err != nil {
+			return nil, err
+		}
+		s.messages[msg.id] = msg
+	}
+	if len(s.messages) == 0 {
+		return nil, fmt.Errorf("SBE schema %v defines no message", s.id)
+	}
+
+	schemaDict := s.dictionary().extend(fix50Dictionary)
+	for _, msg := range s.messages {
+		msg.dict = schemaDict
+		if groups := msg.repeatingGroups(); len(groups) > 0 {
+			msg.dict = newDictionary(schemaDict.version, schemaDict, nil, nil,
+				map[string]map[int]*repeatingGroup{msg.msgType: groups})
+		}
+	}
+	return s, nil
+}
+
+// lookup returns the type named name, primitive types being available by
+// their name.
+func (c *sbeCompiler) lookup(name string) (*sbeType, error) {
+	if t, ok := c.types[name]; ok {
+		return t, nil
+	}
+	n, ok := c.nodes[name]
+	if !ok {
+		if _, ok := sbePrimitiveSizes[name]; ok {
+			t := &sbeType{name: name, kind: sbePrimitive, primitive: name}
+			if err := t.setPrimitive(name, 1, ""); err != nil {
+				return nil, err
+			}
+			c.types[name] = t
+			return t, nil
+		}
+		return nil, fmt.Errorf("unknown SBE type %v", name)
+	}
+
+	if c.resolving[name] {
+		return nil, fmt.Errorf("SBE type %v references itself", name)
+	}
+	c.resolving[name] = true
+	defer delete(c.resolving, name)
+
+	t, err := c.compileType(n)
+	if err != nil {
+		return nil, err
+	}
+	c.types[name] = t
+	return t, nil
+}
+
+func (c *sbeCompiler) compileType(n *xmlNode) (*sbeType, error) {
+	t := &sbeType{
+		name:         n.attr("name"),
+		semanticType: n.attr("semanticType"),
+		optional:     n.attr("presence") == "optional",
+	}
+	if n.attr("presence") == "constant" {
+		t.constant, t.isConstant = strings.TrimSpace(n.Text), true
+	}
+
+	switch n.XMLName.Local {
+	case "type":
+		length, err := n.intAttr("length", 1)
+		if err != nil {
+			return nil, err
+		}
+		t.kind = sbePrimitive
+		if err := t.setPrimitive(n.attr("primitiveType"), length, n.attr("nullValue")); err != nil {
+			return nil, fmt.Errorf("SBE type %v: %v", t.name, err)
+		}
+		if t.isConstant {
+			t.size = 0
+		}
+
+	case "composite":
+		t.kind = sbeComposite
+		offset := 0
+		for i := range n.Children {
+			child := &n.Children[i]
+			var member *sbeType
+			var err error
+			if child.XMLName.Local == "ref" {
+				member, err = c.lookup(child.attr("type"))
+			} else {
+				member, err = c.compileType(child)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if offset, err = child.intAttr("offset", offset); err != nil {
+				return nil, err
+			}
+			t.members = append(t.members, sbeMember{name: child.attr("name"), offset: offset, typ: member})
+			offset += member.size
+		}
+		t.size = offset
+
+	case "enum", "set":
+		encoding, err := c.lookup(n.attr("encodingType"))
+		if err != nil {
+			return nil, fmt.Errorf("SBE %v %v: %v", n.XMLName.Local, t.name, err)
+		}
+		t.primitive, t.size, t.null = encoding.primitive, encoding.size, encoding.null
+		t.optional = t.optional || encoding.optional
+		if n.XMLName.Local == "enum" {
+			t.kind = sbeEnum
+			t.values, t.names = map[string]string{}, map[string]string{}
+			for _, v := range n.Children {
+				value := strings.TrimSpace(v.Text)
+				t.values[value] = v.attr("name")
+				t.names[v.attr("name")] = value
+			}
+		} else {
+			t.kind = sbeSet
+			t.choices = map[uint]string{}
+			for _, choice := range n.Children {
+				bit, err := strconv.ParseUint(strings.TrimSpace(choice.Text), 10, 6)
+				if err != nil {
+					return nil, fmt.Errorf("invalid choice %v of SBE set %v", choice.attr("name"), t.name)
+				}
+				t.choices[uint(bit)] = choice.attr("name")
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported SBE type element %v", n.XMLName.Local)
+	}
+	return t, nil
+}
+
+// setPrimitive sets the primitive type of t, with the default null value of
+// the type unless nullValue is set.
+func (t *sbeType) setPrimitive(primitive string, length int, nullValue string) error {
+	size, ok := sbePrimitiveSizes[primitive]
+	if !ok {
+		return fmt.Errorf("unknown primitive type %q", primitive)
+	}
+	t.primitive, t.length, t.size = primitive, length, size*length
+
+	t.null = defaultSBENull(primitive)
+	if nullValue != "" {
+		null, err := parseSBENumber(primitive, nullValue)
+		if err != nil {
+			return fmt.Errorf("invalid nullValue %q", nullValue)
+		}
+		t.null = null
+	}
+	return nil
+}
+
+func (t *sbeType) member(name string) *sbeMember {
+	for i := range t.members {
+		if t.members[i].name == name {
+			return &t.members[i]
+		}
+	}
+	return nil
+}
+
+func (c *sbeCompiler) message(s *sbeSchema, n *xmlNode) (*sbeMessage, error) {
+	id, err := n.intAttr("id", -1)
+	if err != nil || id < 0 {
+		return nil, fmt.Errorf("SBE message %v has no valid id", n.attr("name"))
+	}
+	msg := &sbeMessage{
+		schema:  s,
+		name:    n.attr("name"),
+		id:      id,
+		msgType: n.attr("semanticType"),
+	}
+	if msg.msgType == "" {
+		msg.msgType = msg.name
+	}
+	if msg.sbeBlock, err = c.block(n); err != nil {
+		return nil, fmt.Errorf("SBE message %v: %v", msg.name, err)
+	}
+	return msg, nil
+}
+
+// block compiles the fields, groups and data fields of a message or group.
+func (c *sbeCompiler) block(n *xmlNode) (sbeBlock, error) {
+	var b sbeBlock
+	offset := 0
+	for i := range n.Children {
+		child := &n.Children[i]
+		switch child.XMLName.Local {
+		case "field":
+			f, err := c.field(child, offset)
+			if err != nil {
+				return b, err
+			}
+			b.fields = append(b.fields, f)
+			offset = f.offset + f.typ.size
+			if f.isConstant {
+				offset = f.offset
+			}
+
+		case "group":
+			g, err := c.group(child)
+			if err != nil {
+				return b, err
+			}
+			b.groups = append(b.groups, g)
+
+		case "data":
+			f, err := c.field(child, 0)
+			if err != nil {
+				return b, err
+			}
+			length, data := f.typ.member("length"), f.typ.member("varData")
+			if length == nil || data == nil {
+				return b, fmt.Errorf("data field %v has no length and varData", f.name)
+			}
+			b.data = append(b.data, f)
+		}
+	}
+	return b, nil
+}
+
+func (c *sbeCompiler) field(n *xmlNode, offset int) (*sbeField, error) {
+	typ, err := c.lookup(n.attr("type"))
+	if err != nil {
+		return nil, fmt.Errorf("field %v: %v", n.attr("name"), err)
+	}
+	f := &sbeField{
+		name:         n.attr("name"),
+		typ:          typ,
+		semanticType: n.attr("semanticType"),
+		constant:     typ.constant,
+		isConstant:   typ.isConstant,
+	}
+	if f.semanticType == "" {
+		f.semanticType = typ.semanticType
+	}
+	if f.id, err = n.intAttr("id", 0); err != nil {
+		return nil, err
+	}
+	if f.offset, err = n.intAttr("offset", offset); err != nil {
+		return nil, err
+	}
+	if f.sinceVersion, err = n.intAttr("sinceVersion", 0); err != nil {
+		return nil, err
+	}
+
+	if n.attr("presence") == "constant" {
+		f.isConstant = true
+		f.constant = strings.TrimSpace(n.Text)
+		if ref := n.attr("valueRef"); ref != "" {
+			// valueRef names the enum value, as Enum.Value
+			value, ok := typ.names[ref[strings.LastIndex(ref, ".")+1:]]
+			if !ok {
+				return nil, fmt.Errorf("field %v: unknown valueRef %v", f.name, ref)
+			}
+			f.constant = value
+		}
+	}
+	return f, nil
+}
+
+func (c *sbeCompiler) group(n *xmlNode) (*sbeGroup, error) {
+	dimensionType := n.attr("dimensionType")
+	if dimensionType == "" {
+		dimensionType = "groupSizeEncoding"
+	}
+	dimension, err := c.lookup(dimensionType)
+	if err != nil {
+		return nil, fmt.Errorf("group %v: %v", n.attr("name"), err)
+	}
+	if dimension.member("blockLength") == nil || dimension.member("numInGroup") == nil {
+		return nil, fmt.Errorf("group %v: dimension %v has no blockLength and numInGroup",
+			n.attr("name"), dimensionType)
+	}
+
+	g := &sbeGroup{name: n.attr("name"), dimension: dimension}
+	if g.id, err = n.intAttr("id", 0); err != nil {
+		return nil, err
+	}
+	if g.sbeBlock, err = c.block(n); err != nil {
+		return nil, fmt.Errorf("group %v: %v", g.name, err)
+	}
+	if len(g.fields) == 0 {
+		return nil, fmt.Errorf("group %v has no fields", g.name)
+	}
+	g.delimiter = g.delimiterField()
+	return g, nil
+}
+
+// delimiterField selects the field starting the entries of the group, which
+// is always published. The entries of the market data messages start with the
+// MDUpdateAction or MDEntryType, as the entries of tag=value messages do.
+// Other entries start with the first field always present.
+func (g *sbeGroup) delimiterField() int {
+	if g.id == tagNoMDEntries {
+		for _, tag := range []int{tagMDUpdateAction, tagMDEntryType} {
+			for i, f := range g.fields {
+				if f.id == tag {
+					return i
+				}
+			}
+		}
+	}
+	for i, f := range g.fields {
+		if f.isConstant || !f.typ.nullable() {
+			return i
+		}
+	}
+	return 0
+}
+
+// nullable checks whether values of the type may be null.
+func (t *sbeType) nullable() bool {
+	if t.optional {
+		return true
+	}
+	for _, m := range t.members {
+		if m.typ.nullable() {
+			return true
+		}
+	}
+	return false
+}
+
+// repeatingGroups returns the repeating groups of the message, groups
+// nested in groups included, by NumInGroup tag.
+func (m *sbeMessage) repeatingGroups() map[int]*repeatingGroup {
+	groups := map[int]*repeatingGroup{}
+	var add func(b *sbeBlock)
+	add = func(b *sbeBlock) {
+		for _, g := range b.groups {
+			tags := []int{g.fields[g.delimiter].id}
+			for i, f := range g.fields {
+				if i != g.delimiter {
+					tags = append(tags, f.id)
+				}
+			}
+			for _, nested := range g.groups {
+				tags = append(tags, nested.id)
+			}
+			for _, f := range g.data {
+				tags = append(tags, f.id)
+			}
+			groups[g.id] = newRepeatingGroup(g.name, tags)
+			add(&g.sbeBlock)
+		}
+	}
+	add(&m.sbeBlock)
+	return groups
+}
+
+// dictionary returns the fields of the schema as a QuickFIX data dictionary,
+// extending the built-in dictionaries as the dictionaries loaded from files
+// do. Fields are named after their first definition.
+func (s *sbeSchema) dictionary() *xmlDictionary {
+	d := &xmlDictionary{}
+	seen := map[int]bool{}
+	addField := func(id int, name, typ string, values map[string]string) {
+		if id <= 0 || seen[id] {
+			return
+		}
+		seen[id] = true
+		f := xmlField{Number: id, Name: name, Type: typ}
+		for value, name := range values {
+			f.Values = append(f.Values, xmlValue{Enum: value, Description: name})
+		}
+		d.Fields = append(d.Fields, f)
+	}
+
+	var add func(b *sbeBlock)
+	add = func(b *sbeBlock) {
+		for _, f := range b.fields {
+			addField(f.id, f.name, f.xmlType(), f.typ.values)
+		}
+		for _, g := range b.groups {
+			addField(g.id, g.name, "NUMINGROUP", nil)
+			add(&g.sbeBlock)
+		}
+		for _, f := range b.data {
+			addField(f.id, f.name, "DATA", nil)
+		}
+	}
+	for _, msg := range s.messages {
+		d.Messages = append(d.Messages, xmlMessage{Name: msg.name, MsgType: msg.msgType})
+		add(&msg.sbeBlock)
+	}
+	return d
+}
+
+// xmlType returns the QuickFIX type of the values decoded for the field.
+func (f *sbeField) xmlType() string {
+	if f.isTimestamp() {
+		return "UTCTIMESTAMP"
+	}
+	switch f.typ.kind {
+	case sbePrimitive:
+		if f.semanticType == "LocalMktDate" || f.typ.length > 1 || f.typ.primitive == "char" {
+			return "STRING"
+		}
+		if f.typ.primitive == "float" || f.typ.primitive == "double" {
+			return "FLOAT"
+		}
+		return "INT"
+	case sbeComposite:
+		if f.typ.member("mantissa") != nil {
+			return "PRICE"
+		}
+	}
+	return "STRING"
+}
+
+func (f *sbeField) isTimestamp() bool {
+	if f.semanticType != "UTCTimestamp" {
+		return false
+	}
+	switch f.typ.kind {
+	case sbePrimitive:
+		return f.typ.primitive != "char" && f.typ.length == 1
+	case sbeComposite:
+		return f.typ.member("time") != nil
+	}
+	return false
+}
+
+// sbeNumber is an integer or floating point value of a primitive type.
+type sbeNumber struct {
+	i      int64
+	u      uint64
+	f      float64
+	float  bool
+	signed bool
+}
+
+func defaultSBENull(primitive string) sbeNumber {
+	switch primitive {
+	case "int8":
+		return sbeNumber{i: math.MinInt8, signed: true}
+	case "int16":
+		return sbeNumber{i: math.MinInt16, signed: true}
+	case "int32":
+		return sbeNumber{i: math.MinInt32, signed: true}
+	case "int64":
+		return sbeNumber{i: math.MinInt64, signed: true}
+	case "uint8":
+		return sbeNumber{u: math.MaxUint8}
+	case "uint16":
+		return sbeNumber{u: math.MaxUint16}
+	case "uint32":
+		return sbeNumber{u: math.MaxUint32}
+	case "uint64":
+		return sbeNumber{u: math.MaxUint64}
+	case "float", "double":
+		return sbeNumber{f: math.NaN(), float: true}
+	}
+	// char
+	return sbeNumber{}
+}
+
+func parseSBENumber(primitive, value string) (sbeNumber, error) {
+	switch primitive {
+	case "int8", "int16", "int32", "int64":
+		i, err := strconv.ParseInt(value, 10, 64)
+		return sbeNumber{i: i, signed: true}, err
+	case "float", "double":
+		f, err := strconv.ParseFloat(value, 64)
+		return sbeNumber{f: f, float: true}, err
+	case "char":
+		if len(value) == 1 {
+			return sbeNumber{u: uint64(value[0])}, nil
+		}
+	}
+	u, err := strconv.ParseUint(value, 0, 64)
+	return sbeNumber{u: u}, err
+}
+
+func (n sbeNumber) equal(o sbeNumber) bool {
+	if n.float {
+		return n.f == o.f || (math.IsNaN(n.f) && math.IsNaN(o.f))
+	}
+	if n.signed {
+		return n.i == o.i
+	}
+	return n.u == o.u
+}
+
+func (n sbeNumber) String() string {
+	switch {
+	case n.float:
+		return strconv.FormatFloat(n.f, 'f', -1, 64)
+	case n.signed:
+		return strconv.FormatInt(n.i, 10)
+	}
+	return strconv.FormatUint(n.u, 10)
+}
+
+func (n sbeNumber) int64() int64 {
+	switch {
+	case n.float:
+		return int64(n.f)
+	case n.signed:
+		return n.i
+	}
+	return int64(n.u)
+}
@@ -0,0 +1,443 @@
+//go:build !integration
+// +build !integration
+
+package fix
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/packetbeat/protos"
+)
+
+// testSBESchema follows the CME MDP 3.0 schema, with an order book update and
+// a security definition.
+const testSBESchema = `<?xml version="1.0" encoding="UTF-8"?>
+<sbe:messageSchema xmlns:sbe="http://fixprotocol.io/2016/sbe" package="mktdata"
+    id="1" version="9" semanticVersion="FIX5SP2" byteOrder="littleEndian">
+  <types>
+    <composite name="messageHeader">
+      <type name="blockLength" primitiveType="uint16"/>
+      <type name="templateId" primitiveType="uint16"/>
+      <type name="schemaId" primitiveType="uint16"/>
+      <type name="version" primitiveType="uint16"/>
+    </composite>
+    <composite name="groupSize">
+      <type name="blockLength" primitiveType="uint16"/>
+      <type name="numInGroup" primitiveType="uint8"/>
+    </composite>
+    <composite name="varDataEncoding">
+      <type name="length" primitiveType="uint16"/>
+      <type name="varData" primitiveType="uint8" length="0"/>
+    </composite>
+    <composite name="PRICENULL9">
+      <type name="mantissa" primitiveType="int64" presence="optional" nullValue="9223372036854775807"/>
+      <type name="exponent" primitiveType="int8" presence="constant">-9</type>
+    </composite>
+    <composite name="MaturityMonthYear">
+      <type name="year" primitiveType="uint16" presence="optional" nullValue="65535"/>
+      <type name="month" primitiveType="uint8" presence="optional" nullValue="255"/>
+      <type name="day" primitiveType="uint8" presence="optional" nullValue="255"/>
+      <type name="week" primitiveType="uint8" presence="optional" nullValue="255"/>
+    </composite>
+    <type name="Int32" primitiveType="int32"/>
+    <type name="Int32NULL" primitiveType="int32" presence="optional" nullValue="2147483647"/>
+    <type name="uInt32" primitiveType="uint32"/>
+    <type name="uInt64" primitiveType="uint64"/>
+    <type name="uInt8" primitiveType="uint8"/>
+    <type name="LocalMktDate" primitiveType="uint16" presence="optional" nullValue="65535" semanticType="LocalMktDate"/>
+    <type name="Symbol" primitiveType="char" length="20"/>
+    <type name="SecurityIDSource" primitiveType="char" length="1" presence="constant">8</type>
+    <enum name="MDUpdateAction" encodingType="uInt8">
+      <validValue name="New">0</validValue>
+      <validValue name="Change">1</validValue>
+      <validValue name="Delete">2</validValue>
+    </enum>
+    <enum name="MDEntryTypeBook" encodingType="char">
+      <validValue name="Bid">0</validValue>
+      <validValue name="Offer">1</validValue>
+    </enum>
+    <enum name="SecurityUpdateAction" encodingType="char">
+      <validValue name="Add">A</validValue>
+      <validValue name="Delete">D</validValue>
+      <validValue name="Modify">M</validValue>
+    </enum>
+    <set name="MatchEventIndicator" encodingType="uInt8">
+      <choice name="LastTradeMsg">0</choice>
+      <choice name="LastQuoteMsg">2</choice>
+      <choice name="EndOfEvent">7</choice>
+    </set>
+  </types>
+  <sbe:message name="MDIncrementalRefreshBook46" id="46" blockLength="11" semanticType="X">
+    <field name="TransactTime" id="60" type="uInt64" offset="0" semanticType="UTCTimestamp"/>
+    <field name="MatchEventIndicator" id="5799" type="MatchEventIndicator" offset="8"/>
+    <group name="NoMDEntries" id="268" blockLength="32" dimensionType="groupSize">
+      <field name="MDEntryPx" id="270" type="PRICENULL9" offset="0"/>
+      <field name="MDEntrySize" id="271" type="Int32NULL" offset="8"/>
+      <field name="SecurityID" id="48" type="Int32" offset="12"/>
+      <field name="RptSeq" id="83" type="uInt32" offset="16"/>
+      <field name="NumberOfOrders" id="346" type="Int32NULL" offset="20"/>
+      <field name="MDPriceLevel" id="1023" type="uInt8" offset="24"/>
+      <field name="MDUpdateAction" id="279" type="MDUpdateAction" offset="25"/>
+      <field name="MDEntryType" id="269" type="MDEntryTypeBook" offset="26"/>
+    </group>
+  </sbe:message>
+  <sbe:message name="SecurityDefinition27" id="27" semanticType="d">
+    <field name="SecurityUpdateAction" id="980" type="SecurityUpdateAction"/>
+    <field name="Symbol" id="55" type="Symbol"/>
+    <field name="SecurityID" id="48" type="Int32"/>
+    <field name="SecurityIDSource" id="22" type="SecurityIDSource"/>
+    <field name="MaturityMonthYear" id="200" type="MaturityMonthYear"/>
+    <field name="TradingReferenceDate" id="5796" type="LocalMktDate" sinceVersion="9"/>
+    <data name="Text" id="58" type="varDataEncoding"/>
+  </sbe:message>
+</sbe:messageSchema>`
+
+func loadTestSBESchema(t *testing.T) *sbeSchema {
+	var root xmlNode
+	if err := xml.Unmarshal([]byte(testSBESchema), &root); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := compileSBESchema(&root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+// sbeWriter encodes little endian SBE messages for the tests.
+type sbeWriter struct {
+	bytes.Buffer
+}
+
+func (w *sbeWriter) put(values ...interface{}) *sbeWriter {
+	for _, v := range values {
+		binary.Write(&w.Buffer, binary.LittleEndian, v)
+	}
+	return w
+}
+
+func (w *sbeWriter) header(blockLength, templateID, version uint16) *sbeWriter {
+	return w.put(blockLength, templateID, uint16(1), version)
+}
+
+type bookEntryValues struct {
+	px         int64
+	size       int32
+	securityID int32
+	rptSeq     uint32
+	orders     int32
+	level      uint8
+	action     uint8
+	entryType  byte
+	padding    [5]byte
+}
+
+var testTransactTime = time.Date(2016, 10, 14, 9, 0, 0, 123456789, time.UTC)
+
+func encodeBookUpdate() []byte {
+	w := &sbeWriter{}
+	w.header(11, 46, 9)
+	w.put(uint64(testTransactTime.UnixNano()), uint8(0x84), [2]byte{})
+	w.put(uint16(32), uint8(2))
+	w.put(bookEntryValues{
+		px: 1101250000000, size: 15, securityID: 5678, rptSeq: 100, orders: 3,
+		level: 1, action: 0, entryType: '0',
+	})
+	w.put(bookEntryValues{
+		px: 1101500000000, size: 2147483647, securityID: 5678, rptSeq: 101, orders: 2147483647,
+		level: 1, action: 1, entryType: '1',
+	})
+	return w.Bytes()
+}
+
+func encodeSecurityDefinition(version uint16, text string) []byte {
+	var symbol [20]byte
+	copy(symbol[:], "ESZ6")
+	body := &sbeWriter{}
+	body.put(byte('A'), symbol, int32(5678), uint16(2016), uint8(12), uint8(255), uint8(255))
+	if version >= 9 {
+		body.put(uint16(17088))
+	}
+
+	w := &sbeWriter{}
+	w.header(uint16(body.Len()), 27, version)
+	w.Write(body.Bytes())
+	w.put(uint16(len(text)))
+	w.WriteString(text)
+	return w.Bytes()
+}
+
+func TestSBESchema(t *testing.T) {
+	schema := loadTestSBESchema(t)
+	assert.Equal(t, 1, schema.id)
+	assert.Equal(t, "FIX5SP2", schema.semanticVersion)
+	assert.Equal(t, 8, schema.header.size)
+	assert.Len(t, schema.messages, 2)
+
+	book := schema.messages[46]
+	assert.Equal(t, "X", book.msgType)
+	group := book.groups[0]
+	assert.Equal(t, tagMDUpdateAction, group.fields[group.delimiter].id)
+	assert.Equal(t, 3, group.dimension.size)
+
+	// standard tags keep their built-in names, others are named by the schema
+	name, _, _ := book.dict.decode(270, "1.5")
+	assert.Equal(t, "MDEntryPx", name)
+	name, value, _ := book.dict.decode(5799, "EndOfEvent")
+	assert.Equal(t, "MatchEventIndicator", name)
+	assert.Equal(t, "EndOfEvent", value)
+	name, value, _ = book.dict.decode(1023, "1")
+	assert.Equal(t, "MDPriceLevel", name)
+	assert.Equal(t, 1, value)
+	assert.Equal(t, "NoMDEntries", book.dict.groups["X"][268].name)
+	assert.Equal(t, tagMDUpdateAction, book.dict.groups["X"][268].delimiter())
+
+	def := schema.messages[27]
+	assert.Equal(t, "d", def.msgType)
+	assert.Equal(t, []int{0, 1, 21, 25, 25, 30}, []int{
+		def.fields[0].offset, def.fields[1].offset, def.fields[2].offset,
+		def.fields[3].offset, def.fields[4].offset, def.fields[5].offset,
+	})
+	name, value, _ = def.dict.decode(980, "A")
+	assert.Equal(t, "SecurityUpdateAction", name)
+	assert.Equal(t, "Add", value)
+}
+
+func TestSBESchemaErrors(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		schema string
+	}{
+		{"not a schema", `<messages/>`},
+		{"no header", `<messageSchema id="1"><types/></messageSchema>`},
+		{"no message", `<messageSchema id="1"><types>
+			<composite name="messageHeader">
+			  <type name="blockLength" primitiveType="uint16"/>
+			  <type name="templateId" primitiveType="uint16"/>
+			</composite></types></messageSchema>`},
+		{"unknown type", `<messageSchema id="1"><types>
+			<composite name="messageHeader">
+			  <type name="blockLength" primitiveType="uint16"/>
+			  <type name="templateId" primitiveType="uint16"/>
+			</composite></types>
+			<message name="M" id="1"><field name="F" id="1" type="Price"/></message>
+			</messageSchema>`},
+		{"invalid primitive", `<messageSchema id="1"><types>
+			<composite name="messageHeader">
+			  <type name="blockLength" primitiveType="uint16"/>
+			  <type name="templateId" primitiveType="uint128"/>
+			</composite></types></messageSchema>`},
+		{"cyclic ref", `<messageSchema id="1"><types>
+			<composite name="messageHeader"><ref name="h" type="messageHeader"/></composite>
+			</types></messageSchema>`},
+	} {
+		var root xmlNode
+		if err := xml.Unmarshal([]byte(test.schema), &root); err != nil {
+			t.Fatal(err)
+		}
+		_, err := compileSBESchema(&root)
+		assert.Error(t, err, test.name)
+	}
+}
+
+func TestSBEDecode(t *testing.T) {
+	stream := &sbeStream{schema: loadTestSBESchema(t), framing: "sofh"}
+	ts := time.Now()
+
+	msg, frame, err := stream.decode(ts, encodeBookUpdate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 46, frame.msg.id)
+	assert.Equal(t, 9, frame.version)
+	assert.Equal(t, ts, msg.ts)
+	assert.True(t, msg.checksumValid)
+	assert.Equal(t, tagValues{
+		{35, "X"},
+		{60, "20161014-09:00:00.123456789"},
+		{5799, "LastQuoteMsg EndOfEvent"},
+		{268, "2"},
+		{279, "0"}, {270, "1101.25"}, {271, "15"}, {48, "5678"}, {83, "100"},
+		{346, "3"}, {1023, "1"}, {269, "0"},
+		{279, "1"}, {270, "1101.5"}, {48, "5678"}, {83, "101"}, {1023, "1"},
+		{269, "1"},
+	}, msg.fields)
+
+	// fields added in version 9 are not decoded from older messages
+	msg, frame, err = stream.decode(ts, encodeSecurityDefinition(8, "E-mini S&P"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 8, frame.version)
+	assert.Equal(t, tagValues{
+		{35, "d"}, {980, "A"}, {55, "ESZ6"}, {48, "5678"}, {22, "8"},
+		{200, "201612"}, {58, "E-mini S&P"},
+	}, msg.fields)
+
+	msg, _, err = stream.decode(ts, encodeSecurityDefinition(9, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, _ := msg.fields.get(5796)
+	assert.Equal(t, "20161014", value)
+	_, hasText := msg.fields.get(58)
+	assert.False(t, hasText)
+
+	for name, buf := range map[string][]byte{
+		"truncated header": encodeBookUpdate()[:6],
+		"truncated group":  encodeBookUpdate()[:40],
+		"unknown template": (&sbeWriter{}).header(0, 99, 9).Bytes(),
+		"other schema":     (&sbeWriter{}).put(uint16(0), uint16(46), uint16(2), uint16(9)).Bytes(),
+	} {
+		_, _, err := stream.decode(ts, buf)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestFormatSBEDecimal(t *testing.T) {
+	for _, test := range []struct {
+		mantissa int64
+		exponent int
+		expected string
+	}{
+		{1101250000000, -9, "1101.25"},
+		{-5, -2, "-0.05"},
+		{0, -9, "0"},
+		{1000000000, -9, "1"},
+		{12, 2, "1200"},
+		{7, 0, "7"},
+	} {
+		assert.Equal(t, test.expected, formatSBEDecimal(test.mantissa, test.exponent))
+	}
+}
+
+func TestParseSBEDatagram(t *testing.T) {
+	fix, results := fixModForTests()
+	fix.sbe = &sbeStreams{ports: map[uint16]*sbeStream{
+		14310: {schema: loadTestSBESchema(t), framing: "mdp3"},
+	}}
+	fix.books = newBookTracker(bookConfig{Enabled: true})
+
+	msg := encodeBookUpdate()
+	w := &sbeWriter{}
+	w.put(uint32(1234), uint64(testTransactTime.UnixNano()))
+	w.put(uint16(len(msg) + 2))
+	w.Write(msg)
+
+	fix.ParseUDP(&protos.Packet{
+		Ts: time.Now(),
+		Tuple: common.NewIPPortTuple(4,
+			net.ParseIP("10.0.0.1"), 40000,
+			net.ParseIP("224.0.31.1"), 14310),
+		Payload: w.Bytes(),
+	})
+
+	event := expectEvent(t, results)
+	assert.Contains(t, event["fix"], "book")
+	book := event["fix"].(common.MapStr)["book"].(common.MapStr)
+	assert.Equal(t, "5678", book["symbol"])
+	assert.Equal(t, 1101.25, book["bid_px"])
+	assert.Equal(t, 1101.5, book["ask_px"])
+
+	event = expectEvent(t, results)
+	assert.Equal(t, "udp", event["transport"])
+	fields := event["fix"].(common.MapStr)
+	assert.Equal(t, "FIX5SP2", fields["version"])
+	assert.Equal(t, "Market Data - Incremental Refresh", fields["msg_type"])
+	assert.Equal(t, common.MapStr{
+		"schema_id":      1,
+		"schema_version": 9,
+		"template_id":    46,
+		"message":        "MDIncrementalRefreshBook46",
+		"packet_seq_num": uint32(1234),
+	}, fields["sbe"])
+	assert.Equal(t, preciseTime(testTransactTime), fields["TransactTime"])
+	entries := fields["NoMDEntries"].([]common.MapStr)
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, 1101.25, entries[0]["MDEntryPx"])
+		assert.Equal(t, 15, entries[0]["MDEntrySize"])
+		assert.Equal(t, "Bid", entries[0]["MDEntryType"])
+		assert.Equal(t, "Offer", entries[1]["MDEntryType"])
+		assert.NotContains(t, entries[1], "MDEntrySize")
+	}
+	assert.Empty(t, results.Channel)
+}
+
+func TestParseSBEStream(t *testing.T) {
+	fix, results := fixModForTests()
+	fix.rawText = true
+	fix.sbe = &sbeStreams{ports: map[uint16]*sbeStream{
+		9878: {schema: loadTestSBESchema(t), framing: "sofh"},
+	}}
+
+	msg := encodeSecurityDefinition(9, "E-mini S&P")
+	w := &sbeWriter{}
+	binary.Write(w, binary.BigEndian, uint32(len(msg)+sofhLen))
+	binary.Write(w, binary.BigEndian, uint16(0xEB50))
+	w.Write(msg)
+	frame := w.Bytes()
+
+	// the message spans two segments
+	var private protos.ProtocolData
+	for _, payload := range [][]byte{frame[:10], frame[10:]} {
+		pkt := &protos.Packet{Ts: time.Now(), Payload: payload}
+		private = fix.Parse(pkt, &sessionTuple, initiator, private)
+	}
+
+	event := expectEvent(t, results)
+	fields := event["fix"].(common.MapStr)
+	assert.Equal(t, "Security Definition", fields["msg_type"])
+	assert.Equal(t, "ESZ6", fields["Symbol"])
+	assert.Equal(t, 8, fields["IDSource"])
+	assert.Equal(t, "E-mini S&P", fields["Text"])
+	assert.Equal(t, "8=|35=d|980=A|55=ESZ6|48=5678|22=8|200=201612|5796=20161014|58=E-mini S&P|",
+		"8=|"+fields["raw"].(string))
+	assert.Empty(t, results.Channel)
+
+	// an invalid frame drops the stream
+	private = fix.Parse(&protos.Packet{Ts: time.Now(), Payload: []byte{0, 0, 0, 1, 0xEB, 0x50}},
+		&sessionTuple, initiator, private)
+	assert.Nil(t, private.(*fixConnectionData).streams[initiator])
+	assert.Empty(t, results.Channel)
+}
+
+func TestLoadSBESchemas(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sbe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "mdp3.xml")
+	if err := ioutil.WriteFile(path, []byte(testSBESchema), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	streams, err := loadSBESchemas([]sbeConfig{{Schema: path, Ports: []int{14310, 14311}, Framing: "mdp3"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "mdp3", streams.lookup([2]uint16{40000, 14311}).framing)
+	assert.Nil(t, streams.lookup([2]uint16{40000, 9878}))
+
+	fix := &fixPlugin{ports: []int{9878}, sbe: streams}
+	assert.Equal(t, []int{9878, 14310, 14311}, fix.GetPorts())
+
+	_, err = loadSBESchemas([]sbeConfig{
+		{Schema: path, Ports: []int{14310}},
+		{Schema: path, Ports: []int{14310}},
+	})
+	assert.Error(t, err)
+	_, err = loadSBESchemas([]sbeConfig{{Schema: filepath.Join(dir, "missing.xml"), Ports: []int{1}}})
+	assert.Error(t, err)
+}
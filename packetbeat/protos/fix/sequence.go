@@ -0,0 +1,151 @@
+package fix
+
+import (
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/packetbeat/protos/tcp"
+)
+
+const (
+	tagMsgSeqNum       = 34
+	tagPossDupFlag     = 43
+	tagPossResend      = 97
+	tagResetSeqNumFlag = 141
+)
+
+// sequenceTracker follows the MsgSeqNum of both directions of a session,
+// reporting gaps and duplicate sequence numbers.
+type sequenceTracker struct {
+	// next expected MsgSeqNum per direction, 0 if not known yet
+	next [2]int
+
+	// gap per direction waiting for the reaction of the receiving side
+	pending [2]*gapEvent
+}
+
+type gapEvent struct {
+	ts  time.Time
+	dir uint8
+
+	expected, received int
+	duplicate          bool
+	resendRequested    bool
+}
+
+// onMessage checks the MsgSeqNum of message msg sent in direction dir. Gaps
+// are returned with the next message of the receiving side, reporting if the
+// receiver asked for the missing messages with a ResendRequest. Duplicates
+// are returned immediately.
+func (t *sequenceTracker) onMessage(dir uint8, msg *message) []*gapEvent {
+	var events []*gapEvent
+
+	msgType, _ := msg.fields.get(tagMsgType)
+	if gap := t.pending[1-dir]; gap != nil {
+		gap.resendRequested = msgType == msgTypeResendRequest
+		events = append(events, gap)
+		t.pending[1-dir] = nil
+	}
+
+	v, ok := msg.fields.get(tagMsgSeqNum)
+	if !ok {
+		return events
+	}
+	seqNo := atoiOrZero(v)
+	if seqNo <= 0 {
+		return events
+	}
+
+	switch msgType {
+	case msgTypeLogon:
+		if flag, _ := msg.fields.get(tagResetSeqNumFlag); flag == "Y" {
+			t.next[dir] = seqNo + 1
+			return events
+		}
+	case msgTypeSequenceReset:
+		v, _ := msg.fields.get(tagNewSeqNo)
+		if newSeqNo := atoiOrZero(v); newSeqNo > 0 {
+			// gap fills and resent resets only skip messages ahead, they
+			// may be part of a resend of messages already seen
+			gapFill, _ := msg.fields.get(tagGapFillFlag)
+			possDup, _ := msg.fields.get(tagPossDupFlag)
+			if newSeqNo > t.next[dir] || (gapFill != "Y" && possDup != "Y") {
+				t.next[dir] = newSeqNo
+			}
+			return events
+		}
+	}
+
+	next := t.next[dir]
+	switch {
+	case next == 0:
+		// first message seen of a session already in progress
+		t.next[dir] = seqNo + 1
+
+	case seqNo > next:
+		if gap := t.pending[dir]; gap != nil {
+			events = append(events, gap)
+		}
+		t.pending[dir] = &gapEvent{
+			ts:       msg.ts,
+			dir:      dir,
+			expected: next,
+			received: seqNo,
+		}
+		t.next[dir] = seqNo + 1
+
+	case seqNo < next:
+		// retransmissions are expected to be lower than the next MsgSeqNum
+		if flag, _ := msg.fields.get(tagPossDupFlag); flag != "Y" {
+			events = append(events, &gapEvent{
+				ts:        msg.ts,
+				dir:       dir,
+				expected:  next,
+				received:  seqNo,
+				duplicate: true,
+			})
+		}
+
+	default:
+		t.next[dir]++
+	}
+	return events
+}
+
+// reset forgets the sequence numbers of direction dir. Used if data is lost
+// by the capture, not to report messages missed by the sniffer as gaps.
+func (t *sequenceTracker) reset(dir uint8) {
+	t.next[dir] = 0
+}
+
+// flush returns the gaps still waiting for a reaction of the receiver.
+func (t *sequenceTracker) flush() []*gapEvent {
+	var events []*gapEvent
+	for dir, gap := range t.pending {
+		if gap != nil {
+			events = append(events, gap)
+			t.pending[dir] = nil
+		}
+	}
+	return events
+}
+
+func (g *gapEvent) fields(s *session) common.MapStr {
+	sender, target := s.key.senderCompID, s.key.targetCompID
+	if g.dir == tcp.TCPDirectionReverse {
+		sender, target = target, sender
+	}
+
+	fields := common.MapStr{
+		"sender_comp_id":   sender,
+		"target_comp_id":   target,
+		"expected_seq_no":  g.expected,
+		"received_seq_no":  g.received,
+		"duplicate":        g.duplicate,
+		"resend_requested": g.resendRequested,
+	}
+	if !g.duplicate {
+		fields["size"] = g.received - g.expected
+	}
+	return fields
+}
@@ -0,0 +1,135 @@
+// +build !integration
+
+package fix
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func sequenceMessage(s string) *message {
+	return &message{fields: splitFields(fixMessage(s))}
+}
+
+// expectGapEvent skips message and session events until the next gap event.
+func expectGapEvent(t *testing.T, results chan common.MapStr) common.MapStr {
+	for len(results) > 0 {
+		event := <-results
+		if gap, ok := event["fix"].(common.MapStr)["gap"]; ok {
+			return gap.(common.MapStr)
+		}
+	}
+	t.Fatal("no gap event published")
+	return nil
+}
+
+func TestSequenceGapWithResendRequest(t *testing.T) {
+	fix, results := fixModForTests()
+
+	msgs := append(logonExchange,
+		directedMessage{initiator, "8=FIX.4.2|35=0|34=2|49=CLIENT|56=BROKER|"},
+		directedMessage{initiator, "8=FIX.4.2|35=0|34=6|49=CLIENT|56=BROKER|"},
+		directedMessage{acceptor, "8=FIX.4.2|35=2|34=2|49=BROKER|56=CLIENT|7=3|16=0|"})
+	parseSession(fix, nil, msgs...)
+
+	gap := expectGapEvent(t, results.Channel)
+	assert.Equal(t, "CLIENT", gap["sender_comp_id"])
+	assert.Equal(t, 3, gap["expected_seq_no"])
+	assert.Equal(t, 6, gap["received_seq_no"])
+	assert.Equal(t, 3, gap["size"])
+	assert.Equal(t, false, gap["duplicate"])
+	assert.Equal(t, true, gap["resend_requested"])
+}
+
+func TestSequenceGapWithoutResendRequest(t *testing.T) {
+	var seq sequenceTracker
+
+	assert.Empty(t, seq.onMessage(initiator, sequenceMessage("8=FIX.4.2|35=0|34=10|")))
+	assert.Empty(t, seq.onMessage(initiator, sequenceMessage("8=FIX.4.2|35=0|34=12|")))
+
+	gaps := seq.onMessage(acceptor, sequenceMessage("8=FIX.4.2|35=0|34=5|"))
+	assert.Len(t, gaps, 1)
+	assert.Equal(t, 11, gaps[0].expected)
+	assert.False(t, gaps[0].resendRequested)
+	assert.Empty(t, seq.flush())
+}
+
+func TestSequenceDuplicate(t *testing.T) {
+	var seq sequenceTracker
+
+	seq.onMessage(initiator, sequenceMessage("8=FIX.4.2|35=0|34=10|"))
+	seq.onMessage(initiator, sequenceMessage("8=FIX.4.2|35=0|34=11|"))
+
+	// retransmissions may repeat sequence numbers
+	assert.Empty(t, seq.onMessage(initiator, sequenceMessage("8=FIX.4.2|35=D|34=10|43=Y|")))
+
+	gaps := seq.onMessage(initiator, sequenceMessage("8=FIX.4.2|35=D|34=10|"))
+	assert.Len(t, gaps, 1)
+	assert.True(t, gaps[0].duplicate)
+	assert.Equal(t, 12, gaps[0].expected)
+	assert.Equal(t, 10, gaps[0].received)
+}
+
+func TestSequenceResets(t *testing.T) {
+	var seq sequenceTracker
+
+	seq.onMessage(initiator, sequenceMessage("8=FIX.4.2|35=0|34=10|"))
+	assert.Empty(t, seq.onMessage(initiator, sequenceMessage("8=FIX.4.2|35=4|34=11|123=Y|36=20|")))
+	assert.Empty(t, seq.onMessage(initiator, sequenceMessage("8=FIX.4.2|35=0|34=20|")))
+	assert.Empty(t, seq.onMessage(initiator, sequenceMessage("8=FIX.4.2|35=A|34=1|141=Y|")))
+	assert.Equal(t, 2, seq.next[initiator])
+
+	// sequence numbers are unknown after data got lost by the capture
+	seq.reset(initiator)
+	assert.Empty(t, seq.onMessage(initiator, sequenceMessage("8=FIX.4.2|35=0|34=50|")))
+}
+
+func TestSequenceGapFillBehindNext(t *testing.T) {
+	var seq sequenceTracker
+
+	seq.onMessage(initiator, sequenceMessage("8=FIX.4.2|35=0|34=10|"))
+	seq.onMessage(initiator, sequenceMessage("8=FIX.4.2|35=0|34=11|"))
+
+	// gap fill of a resend of messages already seen
+	assert.Empty(t, seq.onMessage(initiator, sequenceMessage("8=FIX.4.2|35=4|34=5|43=Y|123=Y|36=8|")))
+	assert.Equal(t, 12, seq.next[initiator])
+	assert.Empty(t, seq.onMessage(initiator, sequenceMessage("8=FIX.4.2|35=0|34=12|")))
+	assert.Empty(t, seq.flush())
+}
+
+func TestSequenceGapFlushedOnClose(t *testing.T) {
+	fix, results := fixModForTests()
+
+	msgs := append(logonExchange,
+		directedMessage{initiator, "8=FIX.4.2|35=0|34=4|49=CLIENT|56=BROKER|"})
+	private := parseSession(fix, nil, msgs...)
+	for len(results.Channel) > 0 {
+		<-results.Channel
+	}
+
+	fix.ReceivedFin(&sessionTuple, initiator, private)
+
+	gap := expectGapEvent(t, results.Channel)
+	assert.Equal(t, 2, gap["expected_seq_no"])
+	assert.Equal(t, false, gap["resend_requested"])
+}
+
+func TestSequenceGapFlushedOnShutdown(t *testing.T) {
+	fix, results := fixModForTests()
+
+	msgs := append(logonExchange,
+		directedMessage{initiator, "8=FIX.4.2|35=0|34=4|49=CLIENT|56=BROKER|"})
+	private := parseSession(fix, nil, msgs...)
+	for len(results.Channel) > 0 {
+		<-results.Channel
+	}
+
+	fix.Flush(&sessionTuple, private)
+
+	gap := expectGapEvent(t, results.Channel)
+	assert.Equal(t, 2, gap["expected_seq_no"])
+	assertNoSessionEvent(t, results)
+}
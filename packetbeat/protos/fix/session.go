@@ -0,0 +1,384 @@
+package fix
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/packetbeat/protos/tcp"
+)
+
+// Session level message types.
+const (
+	msgTypeHeartbeat     = "0"
+	msgTypeTestRequest   = "1"
+	msgTypeResendRequest = "2"
+	msgTypeSequenceReset = "4"
+	msgTypeLogout        = "5"
+	msgTypeLogon         = "A"
+)
+
+const (
+	tagBeginSeqNo   = 7
+	tagEndSeqNo     = 16
+	tagNewSeqNo     = 36
+	tagSenderCompID = 49
+	tagTargetCompID = 56
+	tagText         = 58
+	tagHeartBtInt   = 108
+	tagTestReqID    = 112
+	tagGapFillFlag  = 123
+)
+
+type sessionState uint8
+
+const (
+	sessionStateNew sessionState = iota
+	sessionStateLogonSent
+	sessionStateEstablished
+	sessionStateLogoutSent
+	sessionStateClosed
+)
+
+var sessionStateNames = []string{
+	"new",
+	"logon_sent",
+	"established",
+	"logout_sent",
+	"closed",
+}
+
+func (s sessionState) String() string {
+	if int(s) >= len(sessionStateNames) {
+		return "impossible"
+	}
+	return sessionStateNames[s]
+}
+
+// sessionKey identifies a FIX session. CompIDs are given from the point of
+// view of the TCP connection initiator.
+type sessionKey struct {
+	senderCompID, targetCompID string
+	src, dst                   common.Endpoint
+}
+
+// String formats the key as used by the per session counters and published
+// as the session_key of events.
+func (k sessionKey) String() string {
+	return k.senderCompID + "->" + k.targetCompID
+}
+
+// valid reports whether the key has any CompID set.
+func (k sessionKey) valid() bool {
+	return k.senderCompID != "" || k.targetCompID != ""
+}
+
+// session follows the lifecycle of the FIX session carried by a single TCP
+// connection.
+type session struct {
+	key    sessionKey
+	hasKey bool
+	state  sessionState
+
+	// set if the first message seen is not a Logon, the capture having
+	// started on a session already established
+	inferred bool
+
+	// BeginString (8) of the first message, FIX.4.x or FIXT.1.1
+	version string
+
+	// name of the configured session matching the key, and whether sessions
+	// are configured but none matches
+	name    string
+	unknown bool
+
+	// tenant of the session, messages matching rules with venues setting
+	// their own
+	tenant string
+
+	heartBtInt int
+
+	logon  [2]bool
+	logout [2]bool
+
+	// TestReqID of TestRequests not yet answered by a Heartbeat, per
+	// requesting direction
+	pendingTestReqID [2]string
+	testReqSent      [2]time.Time
+	testReqReported  [2]bool
+
+	// capture time of the last message per direction, and whether the
+	// direction has been reported late since
+	lastSeen [2]time.Time
+	late     [2]bool
+}
+
+// sessionEvent describes a change in the session state.
+type sessionEvent struct {
+	ts     time.Time
+	name   string
+	fields common.MapStr
+}
+
+func newSessionKey(tuple *common.TCPTuple, dir uint8, fields tagValues) sessionKey {
+	sender, _ := fields.get(tagSenderCompID)
+	target, _ := fields.get(tagTargetCompID)
+	if dir == tcp.TCPDirectionReverse {
+		sender, target = target, sender
+	}
+
+	return sessionKey{
+		senderCompID: sender,
+		targetCompID: target,
+		src:          common.Endpoint{IP: tuple.SrcIP.String(), Port: tuple.SrcPort},
+		dst:          common.Endpoint{IP: tuple.DstIP.String(), Port: tuple.DstPort},
+	}
+}
+
+// onMessage updates the session state with a message received in direction
+// dir and returns the state changes caused by the message.
+func (s *session) onMessage(
+	tuple *common.TCPTuple,
+	dir uint8,
+	msg *message,
+) []sessionEvent {
+	msgType, _ := msg.fields.get(tagMsgType)
+	if !s.hasKey {
+		s.key = newSessionKey(tuple, dir, msg.fields)
+		s.hasKey = true
+		s.version, _ = msg.fields.get(tagBeginString)
+
+		if msgType != msgTypeLogon {
+			// the Logon was sent before the capture started
+			s.state = sessionStateEstablished
+			s.inferred = true
+		}
+	}
+
+	switch msgType {
+	case msgTypeTestRequest:
+		s.pendingTestReqID[dir], _ = msg.fields.get(tagTestReqID)
+		s.testReqSent[dir] = msg.ts
+		s.testReqReported[dir] = false
+	case msgTypeHeartbeat:
+		// a Heartbeat answers the TestRequest sent by the peer
+		id, _ := msg.fields.get(tagTestReqID)
+		if id != "" && id == s.pendingTestReqID[1-dir] {
+			s.pendingTestReqID[1-dir] = ""
+		}
+	case msgTypeLogon:
+		return s.onLogon(dir, msg)
+	case msgTypeLogout:
+		return s.onLogout(dir, msg)
+	case msgTypeResendRequest:
+		begin, _ := msg.fields.get(tagBeginSeqNo)
+		end, _ := msg.fields.get(tagEndSeqNo)
+		return []sessionEvent{{
+			ts:   msg.ts,
+			name: "gap_detected",
+			fields: common.MapStr{
+				"begin_seq_no": atoiOrZero(begin),
+				"end_seq_no":   atoiOrZero(end),
+			},
+		}}
+	case msgTypeSequenceReset:
+		newSeqNo, _ := msg.fields.get(tagNewSeqNo)
+		gapFill, _ := msg.fields.get(tagGapFillFlag)
+		return []sessionEvent{{
+			ts:   msg.ts,
+			name: "sequence_reset",
+			fields: common.MapStr{
+				"new_seq_no": atoiOrZero(newSeqNo),
+				"gap_fill":   gapFill == "Y",
+			},
+		}}
+	}
+	return nil
+}
+
+func (s *session) onLogon(dir uint8, msg *message) []sessionEvent {
+	s.logon[dir] = true
+	if v, ok := msg.fields.get(tagHeartBtInt); ok {
+		s.heartBtInt = atoiOrZero(v)
+	}
+
+	switch s.state {
+	case sessionStateNew, sessionStateClosed:
+		s.state = sessionStateLogonSent
+		s.inferred = false
+		s.logout = [2]bool{}
+		s.logon = [2]bool{}
+		s.logon[dir] = true
+	case sessionStateLogonSent:
+		if s.logon[0] && s.logon[1] {
+			s.state = sessionStateEstablished
+			return []sessionEvent{{ts: msg.ts, name: "established"}}
+		}
+	}
+	return nil
+}
+
+func (s *session) onLogout(dir uint8, msg *message) []sessionEvent {
+	s.logout[dir] = true
+	if s.state == sessionStateClosed || s.state == sessionStateNew {
+		return nil
+	}
+
+	if !(s.logout[0] && s.logout[1]) {
+		s.state = sessionStateLogoutSent
+		return nil
+	}
+
+	s.state = sessionStateClosed
+	fields := common.MapStr{}
+	if text, ok := msg.fields.get(tagText); ok {
+		fields["reason"] = text
+	}
+	return []sessionEvent{{ts: msg.ts, name: "logout", fields: fields}}
+}
+
+// onClose is called when the TCP connection is closed. A session not being
+// logged out is reported as terminated abnormally.
+func (s *session) onClose(ts time.Time) []sessionEvent {
+	switch s.state {
+	case sessionStateNew, sessionStateClosed:
+		return nil
+	case sessionStateLogoutSent:
+		// peer closed the connection instead of confirming the Logout
+		s.state = sessionStateClosed
+		return []sessionEvent{{ts: ts, name: "logout"}}
+	}
+
+	reason := "connection closed without logout"
+	if s.pendingTestReqID[0] != "" || s.pendingTestReqID[1] != "" {
+		reason = "connection closed with unanswered TestRequest"
+	}
+
+	s.state = sessionStateClosed
+	return []sessionEvent{{
+		ts:     ts,
+		name:   "terminated",
+		fields: common.MapStr{"reason": reason},
+	}}
+}
+
+// checkHeartbeats is called with the capture time of each message received in
+// direction dir, before the session state is updated. Once the session is
+// established, a direction silent for longer than the HeartBtInt plus
+// tolerance is reported as heartbeat_late, and a TestRequest not answered
+// within the same time as test_request_unanswered. Each is reported once.
+func (s *session) checkHeartbeats(
+	dir uint8,
+	ts time.Time,
+	tolerance time.Duration,
+) []sessionEvent {
+	var events []sessionEvent
+	if s.state == sessionStateEstablished && s.heartBtInt > 0 {
+		limit := time.Duration(s.heartBtInt)*time.Second + tolerance
+
+		// the silent peer is reported before the late message is
+		for _, d := range []uint8{1 - dir, dir} {
+			if s.late[d] || s.lastSeen[d].IsZero() {
+				continue
+			}
+			idle := ts.Sub(s.lastSeen[d])
+			if idle <= limit {
+				continue
+			}
+			s.late[d] = true
+			events = append(events, sessionEvent{
+				ts:   ts,
+				name: "heartbeat_late",
+				fields: common.MapStr{
+					"comp_id": s.compID(d),
+					"idle_us": int64(idle / time.Microsecond),
+				},
+			})
+		}
+
+		for d := uint8(0); d < 2; d++ {
+			id := s.pendingTestReqID[d]
+			if id == "" || s.testReqReported[d] {
+				continue
+			}
+			elapsed := ts.Sub(s.testReqSent[d])
+			if elapsed <= limit {
+				continue
+			}
+			s.testReqReported[d] = true
+			events = append(events, sessionEvent{
+				ts:   ts,
+				name: "test_request_unanswered",
+				fields: common.MapStr{
+					"comp_id":     s.compID(1 - d),
+					"test_req_id": id,
+					"idle_us":     int64(elapsed / time.Microsecond),
+				},
+			})
+		}
+	}
+
+	s.lastSeen[dir] = ts
+	s.late[dir] = false
+	return events
+}
+
+// compID returns the SenderCompID of the messages sent in direction dir.
+func (s *session) compID(dir uint8) string {
+	if dir == tcp.TCPDirectionReverse {
+		return s.key.targetCompID
+	}
+	return s.key.senderCompID
+}
+
+// fields returns the common session fields published with session events.
+func (s *session) fields() common.MapStr {
+	fields := common.MapStr{
+		"state":          s.state.String(),
+		"sender_comp_id": s.key.senderCompID,
+		"target_comp_id": s.key.targetCompID,
+	}
+	if s.version != "" {
+		fields["version"] = s.version
+	}
+	if s.heartBtInt > 0 {
+		fields["heartbeat_interval"] = s.heartBtInt
+	}
+	if s.inferred {
+		fields["inferred"] = true
+	}
+	return fields
+}
+
+// eventFields returns the fix fields of an event derived from the session,
+// holding fields under name together with the session key and name.
+func (s *session) eventFields(name string, fields common.MapStr) common.MapStr {
+	event := common.MapStr{name: fields}
+	if s.hasKey && s.key.valid() {
+		event["session_key"] = s.key.String()
+	}
+	s.addIdentity(event)
+	return event
+}
+
+// addIdentity adds the name of the configured session, or flags the session
+// as unknown, to the fix fields of an event.
+func (s *session) addIdentity(event common.MapStr) {
+	if s.name != "" {
+		event["session_name"] = s.name
+	}
+	if s.unknown {
+		event["unknown_session"] = true
+	}
+	if s.tenant != "" {
+		event["tenant"] = s.tenant
+	}
+}
+
+func atoiOrZero(s string) int {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0
+	}
+	return i
+}
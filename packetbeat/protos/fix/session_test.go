@@ -0,0 +1,360 @@
+// +build !integration
+
+package fix
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/packetbeat/protos"
+	"github.com/elastic/beats/packetbeat/protos/tcp"
+	"github.com/elastic/beats/packetbeat/publish"
+)
+
+var sessionTuple = common.TCPTuple{
+	SrcIP: net.ParseIP("10.0.0.1"), SrcPort: 40000,
+	DstIP: net.ParseIP("10.0.0.2"), DstPort: 9878,
+}
+
+const (
+	initiator = tcp.TCPDirectionOriginal
+	acceptor  = tcp.TCPDirectionReverse
+)
+
+type directedMessage struct {
+	dir uint8
+	msg string
+}
+
+func parseSession(
+	fix *fixPlugin,
+	private protos.ProtocolData,
+	msgs ...directedMessage,
+) protos.ProtocolData {
+	for _, m := range msgs {
+		pkt := &protos.Packet{Ts: time.Now(), Payload: fixMessage(m.msg)}
+		private = fix.Parse(pkt, &sessionTuple, m.dir, private)
+	}
+	return private
+}
+
+func assertNoSessionEvent(t *testing.T, results *publish.ChanTransactions) {
+	for len(results.Channel) > 0 {
+		event := <-results.Channel
+		assert.NotContains(t, event["fix"], "session")
+	}
+}
+
+var logonExchange = []directedMessage{
+	{initiator, "8=FIX.4.2|35=A|34=1|49=CLIENT|56=BROKER|108=30|"},
+	{acceptor, "8=FIX.4.2|35=A|34=1|49=BROKER|56=CLIENT|108=30|"},
+}
+
+func TestSessionEstablished(t *testing.T) {
+	fix, results := fixModForTests()
+
+	private := parseSession(fix, nil, logonExchange[0])
+	assertNoSessionEvent(t, results)
+
+	private = parseSession(fix, private, logonExchange[1])
+	s := expectFixEvent(t, results, "session")
+	assert.Equal(t, "established", s["event"])
+	assert.Equal(t, "established", s["state"])
+	assert.Equal(t, "CLIENT", s["sender_comp_id"])
+	assert.Equal(t, "BROKER", s["target_comp_id"])
+	assert.Equal(t, 30, s["heartbeat_interval"])
+
+	conn := private.(*fixConnectionData)
+	assert.Equal(t, common.Endpoint{IP: "10.0.0.1", Port: 40000}, conn.session.key.src)
+	assert.Equal(t, common.Endpoint{IP: "10.0.0.2", Port: 9878}, conn.session.key.dst)
+}
+
+func TestSessionKeyFromAcceptorMessage(t *testing.T) {
+	var s session
+	msg := &message{fields: splitFields(fixMessage("8=FIX.4.2|35=0|49=BROKER|56=CLIENT|"))}
+
+	s.onMessage(&sessionTuple, acceptor, msg)
+
+	assert.Equal(t, "CLIENT", s.key.senderCompID)
+	assert.Equal(t, "BROKER", s.key.targetCompID)
+}
+
+func TestSessionKeyPublished(t *testing.T) {
+	fix, results := fixModForTests()
+
+	parseSession(fix, nil, logonExchange...)
+
+	// both directions of the session share the key of the initiator
+	for i := 0; i < 2; i++ {
+		event := expectEvent(t, results)
+		assert.Equal(t, "CLIENT->BROKER", event["fix"].(common.MapStr)["session_key"])
+	}
+	event := expectEvent(t, results)
+	assert.Contains(t, event["fix"], "session")
+	assert.Equal(t, "CLIENT->BROKER", event["fix"].(common.MapStr)["session_key"])
+}
+
+func TestMessageEndpoints(t *testing.T) {
+	fix, results := fixModForTests()
+
+	parseSession(fix, nil, logonExchange...)
+
+	// the source of a message is its sender
+	event := expectEvent(t, results)
+	assert.Equal(t, &common.Endpoint{IP: "10.0.0.1", Port: 40000}, event["src"])
+	assert.Equal(t, &common.Endpoint{IP: "10.0.0.2", Port: 9878}, event["dst"])
+	event = expectEvent(t, results)
+	assert.Equal(t, &common.Endpoint{IP: "10.0.0.2", Port: 9878}, event["src"])
+	assert.Equal(t, &common.Endpoint{IP: "10.0.0.1", Port: 40000}, event["dst"])
+}
+
+func TestSessionLogout(t *testing.T) {
+	fix, results := fixModForTests()
+
+	msgs := append(logonExchange,
+		directedMessage{initiator, "8=FIX.4.2|35=5|34=2|49=CLIENT|56=BROKER|"},
+		directedMessage{acceptor, "8=FIX.4.2|35=5|34=2|49=BROKER|56=CLIENT|58=bye|"})
+	private := parseSession(fix, nil, msgs...)
+	expectFixEvent(t, results, "session")
+
+	s := expectFixEvent(t, results, "session")
+	assert.Equal(t, "logout", s["event"])
+	assert.Equal(t, "closed", s["state"])
+	assert.Equal(t, "bye", s["reason"])
+
+	fix.ReceivedFin(&sessionTuple, initiator, private)
+	assertNoSessionEvent(t, results)
+}
+
+func TestSessionTerminatedWithoutLogout(t *testing.T) {
+	fix, results := fixModForTests()
+
+	msgs := append(logonExchange,
+		directedMessage{initiator, "8=FIX.4.2|35=1|34=2|49=CLIENT|56=BROKER|112=ping|"})
+	private := parseSession(fix, nil, msgs...)
+	expectFixEvent(t, results, "session")
+
+	fix.ReceivedFin(&sessionTuple, acceptor, private)
+	s := expectFixEvent(t, results, "session")
+	assert.Equal(t, "terminated", s["event"])
+	assert.Equal(t, "closed", s["state"])
+	assert.Equal(t, "connection closed with unanswered TestRequest", s["reason"])
+}
+
+func TestSessionTerminatedAtCaptureTime(t *testing.T) {
+	fix, results := fixModForTests()
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+
+	private := parseSession(fix, nil, logonExchange...)
+	expectFixEvent(t, results, "session")
+
+	// the FIN of a replayed capture, observed before the connection is closed
+	private = fix.ObserveTCP(&sessionTuple, acceptor,
+		&protos.TCPSegment{Ts: ts, FIN: true, ACK: true}, private)
+	fix.ReceivedFin(&sessionTuple, acceptor, private)
+
+	var event common.MapStr
+	for event == nil || event["fix"].(common.MapStr)["session"] == nil {
+		event = expectEvent(t, results)
+	}
+	assert.Equal(t, "terminated", event["fix"].(common.MapStr)["session"].(common.MapStr)["event"])
+	assert.Equal(t, common.Time(ts), event["@timestamp"])
+}
+
+func TestSessionTestRequestAnswered(t *testing.T) {
+	var s session
+	s.onMessage(&sessionTuple, initiator,
+		&message{fields: splitFields(fixMessage("8=FIX.4.2|35=1|112=ping|"))})
+	assert.Equal(t, "ping", s.pendingTestReqID[initiator])
+
+	s.onMessage(&sessionTuple, acceptor,
+		&message{fields: splitFields(fixMessage("8=FIX.4.2|35=0|112=ping|"))})
+	assert.Equal(t, "", s.pendingTestReqID[initiator])
+}
+
+func TestSessionSequenceEvents(t *testing.T) {
+	fix, results := fixModForTests()
+
+	msgs := append(logonExchange,
+		directedMessage{acceptor, "8=FIX.4.2|35=2|34=2|7=5|16=0|"},
+		directedMessage{initiator, "8=FIX.4.2|35=4|34=5|123=Y|36=9|"})
+	parseSession(fix, nil, msgs...)
+	expectFixEvent(t, results, "session")
+
+	s := expectFixEvent(t, results, "session")
+	assert.Equal(t, "gap_detected", s["event"])
+	assert.Equal(t, 5, s["begin_seq_no"])
+	assert.Equal(t, 0, s["end_seq_no"])
+
+	s = expectFixEvent(t, results, "session")
+	assert.Equal(t, "sequence_reset", s["event"])
+	assert.Equal(t, 9, s["new_seq_no"])
+	assert.Equal(t, true, s["gap_fill"])
+}
+
+func establishedSession(ts time.Time) *session {
+	s := &session{}
+	for _, m := range logonExchange {
+		msg := &message{ts: ts, fields: splitFields(fixMessage(m.msg))}
+		s.checkHeartbeats(m.dir, ts, 5*time.Second)
+		s.onMessage(&sessionTuple, m.dir, msg)
+	}
+	return s
+}
+
+func TestSessionHeartbeatLate(t *testing.T) {
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+	s := establishedSession(ts)
+
+	assert.Empty(t, s.checkHeartbeats(initiator, ts.Add(30*time.Second), 5*time.Second))
+
+	// acceptor silent for 40s, reported once
+	events := s.checkHeartbeats(initiator, ts.Add(40*time.Second), 5*time.Second)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "heartbeat_late", events[0].name)
+		assert.Equal(t, "BROKER", events[0].fields["comp_id"])
+		assert.Equal(t, int64(40*time.Second/time.Microsecond), events[0].fields["idle_us"])
+	}
+	assert.Empty(t, s.checkHeartbeats(initiator, ts.Add(50*time.Second), 5*time.Second))
+
+	// the late heartbeat itself is not reported again
+	assert.Empty(t, s.checkHeartbeats(acceptor, ts.Add(60*time.Second), 5*time.Second))
+
+	// initiator late, reported with its own message
+	events = s.checkHeartbeats(initiator, ts.Add(90*time.Second), 5*time.Second)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "CLIENT", events[0].fields["comp_id"])
+	}
+}
+
+func TestSessionHeartbeatNotEstablished(t *testing.T) {
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+	var s session
+	s.checkHeartbeats(initiator, ts, 5*time.Second)
+	assert.Empty(t, s.checkHeartbeats(initiator, ts.Add(time.Hour), 5*time.Second))
+}
+
+func TestSessionTestRequestUnanswered(t *testing.T) {
+	fix, results := fixModForTests()
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+
+	msgs := append(logonExchange,
+		directedMessage{initiator, "8=FIX.4.2|35=1|34=2|49=CLIENT|56=BROKER|112=ping|"},
+		directedMessage{acceptor, "8=FIX.4.2|35=0|34=2|49=BROKER|56=CLIENT|"},
+		directedMessage{initiator, "8=FIX.4.2|35=0|34=3|49=CLIENT|56=BROKER|"},
+		directedMessage{acceptor, "8=FIX.4.2|35=0|34=3|49=BROKER|56=CLIENT|112=ping|"})
+	offsets := []time.Duration{0, 0, 10 * time.Second, 20 * time.Second, 40 * time.Second, 50 * time.Second}
+
+	var private protos.ProtocolData
+	for i, m := range msgs {
+		pkt := &protos.Packet{Ts: ts.Add(offsets[i]), Payload: fixMessage(m.msg)}
+		private = fix.Parse(pkt, &sessionTuple, m.dir, private)
+	}
+
+	assert.Equal(t, "established", expectFixEvent(t, results, "session")["event"])
+	s := expectFixEvent(t, results, "session")
+	assert.Equal(t, "test_request_unanswered", s["event"])
+	assert.Equal(t, "BROKER", s["comp_id"])
+	assert.Equal(t, "ping", s["test_req_id"])
+	assert.Equal(t, int64(40*time.Second/time.Microsecond), s["idle_us"])
+	assertNoSessionEvent(t, results)
+}
+
+func TestSessionInferredWithoutLogon(t *testing.T) {
+	fix, results := fixModForTests()
+
+	private := parseSession(fix, nil,
+		directedMessage{initiator, "8=FIX.4.4|35=0|34=12|49=CLIENT|56=BROKER|"},
+		directedMessage{acceptor, "8=FIX.4.4|35=0|34=15|49=BROKER|56=CLIENT|"})
+	assertNoSessionEvent(t, results)
+
+	conn := private.(*fixConnectionData)
+	assert.True(t, conn.session.inferred)
+	assert.Equal(t, sessionStateEstablished, conn.session.state)
+
+	fix.ReceivedFin(&sessionTuple, initiator, private)
+	s := expectFixEvent(t, results, "session")
+	assert.Equal(t, "terminated", s["event"])
+	assert.Equal(t, true, s["inferred"])
+	assert.Equal(t, "FIX.4.4", s["version"])
+	assert.Equal(t, "CLIENT", s["sender_comp_id"])
+	assert.Equal(t, "BROKER", s["target_comp_id"])
+}
+
+func TestSessionInferredLogout(t *testing.T) {
+	fix, results := fixModForTests()
+
+	parseSession(fix, nil,
+		directedMessage{initiator, "8=FIX.4.2|35=5|34=9|49=CLIENT|56=BROKER|"},
+		directedMessage{acceptor, "8=FIX.4.2|35=5|34=7|49=BROKER|56=CLIENT|"})
+	s := expectFixEvent(t, results, "session")
+	assert.Equal(t, "logout", s["event"])
+	assert.Equal(t, true, s["inferred"])
+}
+
+func TestSessionNotInferredWithLogon(t *testing.T) {
+	fix, results := fixModForTests()
+
+	parseSession(fix, nil, logonExchange...)
+	s := expectFixEvent(t, results, "session")
+	assert.NotContains(t, s, "inferred")
+	assert.Equal(t, "FIX.4.2", s["version"])
+}
+
+func TestSessionInferredFromAcceptor(t *testing.T) {
+	fix, results := fixModForTests()
+	fix.ports = []int{9878}
+
+	// the capture started with a segment of the acceptor, becoming the
+	// original direction of the TCP connection
+	tuple := common.TCPTuple{
+		SrcIP: sessionTuple.DstIP, SrcPort: sessionTuple.DstPort,
+		DstIP: sessionTuple.SrcIP, DstPort: sessionTuple.SrcPort,
+	}
+	var private protos.ProtocolData
+	for _, m := range []directedMessage{
+		{tcp.TCPDirectionOriginal, "8=FIX.4.2|35=0|34=7|49=BROKER|56=CLIENT|"},
+		{tcp.TCPDirectionReverse, "8=FIX.4.2|35=0|34=9|49=CLIENT|56=BROKER|"},
+	} {
+		pkt := &protos.Packet{Ts: time.Now(), Payload: fixMessage(m.msg)}
+		private = fix.Parse(pkt, &tuple, m.dir, private)
+	}
+
+	for i := 0; i < 2; i++ {
+		event := expectEvent(t, results)
+		assert.Equal(t, "CLIENT->BROKER", event["fix"].(common.MapStr)["session_key"])
+	}
+
+	fix.ReceivedFin(&tuple, tcp.TCPDirectionOriginal, private)
+	s := expectFixEvent(t, results, "session")
+	assert.Equal(t, "CLIENT", s["sender_comp_id"])
+	assert.Equal(t, "BROKER", s["target_comp_id"])
+
+	conn := private.(*fixConnectionData)
+	assert.Equal(t, common.Endpoint{IP: "10.0.0.1", Port: 40000}, conn.session.key.src)
+	assert.Equal(t, common.Endpoint{IP: "10.0.0.2", Port: 9878}, conn.session.key.dst)
+}
+
+func TestServerPortRanges(t *testing.T) {
+	fix, _ := fixModForTests()
+	fix.portRanges = []protos.PortRange{{From: 9800, To: 9899, Networks: []*net.IPNet{{
+		IP: net.ParseIP("10.0.0.0").To4(), Mask: net.CIDRMask(24, 32),
+	}}}}
+
+	assert.True(t, fix.isServerPort(net.ParseIP("10.0.0.2"), 9878))
+	assert.False(t, fix.isServerPort(net.ParseIP("10.0.1.2"), 9878))
+	assert.False(t, fix.isServerPort(net.ParseIP("10.0.0.2"), 40000))
+
+	// the capture started with a segment of the acceptor
+	tuple := common.TCPTuple{
+		SrcIP: sessionTuple.DstIP, SrcPort: sessionTuple.DstPort,
+		DstIP: sessionTuple.SrcIP, DstPort: sessionTuple.SrcPort,
+	}
+	pkt := &protos.Packet{Ts: time.Now(), Payload: fixMessage("8=FIX.4.2|35=0|34=7|49=BROKER|56=CLIENT|")}
+	private := fix.Parse(pkt, &tuple, tcp.TCPDirectionOriginal, nil)
+	assert.True(t, private.(*fixConnectionData).reversed)
+}
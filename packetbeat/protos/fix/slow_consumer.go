@@ -0,0 +1,222 @@
+package fix
+
+import (
+	"expvar"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/packetbeat/protos"
+	"github.com/elastic/beats/packetbeat/protos/tcp"
+)
+
+type slowConsumerConfig struct {
+	Enabled bool `config:"enabled"`
+
+	// ACK latency above which the receiver is a slow consumer, 0 to only
+	// detect zero windows
+	AckLatency time.Duration `config:"ack_latency" validate:"min=0"`
+
+	// minimum duration of the slow consumers reported
+	MinDuration time.Duration `config:"min_duration" validate:"min=0"`
+}
+
+var defaultSlowConsumerConfig = slowConsumerConfig{
+	AckLatency:  200 * time.Millisecond,
+	MinDuration: 100 * time.Millisecond,
+}
+
+var slowConsumers = expvar.NewInt("fix.slow_consumers")
+
+// slowConsumer is a period a receiver advertised a zero window, or
+// acknowledged the data sent to it late.
+type slowConsumer struct {
+	reason      string
+	start, last time.Time
+	bytesQueued uint32
+
+	// largest ACK latency, of the ack_latency slow consumers
+	maxAckLatency time.Duration
+}
+
+// slowConsumerEvent is a slow consumer ended, receiving the data sent in
+// direction dir.
+type slowConsumerEvent struct {
+	dir       uint8
+	consumer  *slowConsumer
+	recovered bool
+}
+
+// slowConsumerTracker detects the slow consumers of a connection from the
+// TCP segments exchanged, by the data sent in each direction. A receiver is
+// a slow consumer while it advertises a zero window, or while it
+// acknowledges data later than the ack_latency after it has been sent. The
+// largest number of bytes sent and not acknowledged is reported as the bytes
+// queued.
+type slowConsumerTracker struct {
+	// slow consumers receiving the data sent in each direction
+	zeroWindow [2]*slowConsumer
+	ackLatency [2]*slowConsumer
+}
+
+func (t *slowConsumerTracker) onSegment(
+	dir uint8,
+	seg *protos.TCPSegment,
+	obs *observedSegment,
+	config *slowConsumerConfig,
+) []slowConsumerEvent {
+	if seg.RST {
+		return t.flush()
+	}
+	if !seg.ACK {
+		return nil
+	}
+
+	// the sender of the segment consumes the data sent in the other direction
+	var events []slowConsumerEvent
+	producer := 1 - dir
+
+	if seg.Window == 0 && !seg.SYN {
+		c := t.zeroWindow[producer]
+		if c == nil {
+			c = &slowConsumer{reason: "zero_window", start: seg.Ts}
+			t.zeroWindow[producer] = c
+		}
+		c.update(seg.Ts, obs.queued)
+	} else if c := t.zeroWindow[producer]; c != nil {
+		c.update(seg.Ts, obs.queued)
+		t.zeroWindow[producer] = nil
+		events = c.ended(events, producer, config)
+	}
+
+	if obs.acked && config.AckLatency > 0 {
+		latency := seg.Ts.Sub(obs.sent)
+		c := t.ackLatency[producer]
+		switch {
+		case latency > config.AckLatency && c == nil:
+			c = &slowConsumer{reason: "ack_latency", start: obs.sent}
+			t.ackLatency[producer] = c
+			fallthrough
+		case latency > config.AckLatency:
+			c.update(seg.Ts, obs.queued)
+			if latency > c.maxAckLatency {
+				c.maxAckLatency = latency
+			}
+		case c != nil:
+			c.update(seg.Ts, obs.queued)
+			t.ackLatency[producer] = nil
+			events = c.ended(events, producer, config)
+		}
+	}
+	return events
+}
+
+// flush ends the slow consumers of a connection closed, not having
+// recovered.
+func (t *slowConsumerTracker) flush() []slowConsumerEvent {
+	var events []slowConsumerEvent
+	for dir := uint8(0); dir < 2; dir++ {
+		if c := t.zeroWindow[dir]; c != nil {
+			events = append(events, slowConsumerEvent{dir: dir, consumer: c})
+		}
+		if c := t.ackLatency[dir]; c != nil {
+			events = append(events, slowConsumerEvent{dir: dir, consumer: c})
+		}
+		t.zeroWindow[dir], t.ackLatency[dir] = nil, nil
+	}
+	return events
+}
+
+func (c *slowConsumer) update(ts time.Time, queued uint32) {
+	c.last = ts
+	if queued > c.bytesQueued {
+		c.bytesQueued = queued
+	}
+}
+
+// ended appends the slow consumer recovered to events, unless shorter than
+// the min_duration.
+func (c *slowConsumer) ended(
+	events []slowConsumerEvent,
+	dir uint8,
+	config *slowConsumerConfig,
+) []slowConsumerEvent {
+	if c.last.Sub(c.start) < config.MinDuration {
+		return events
+	}
+	return append(events, slowConsumerEvent{dir: dir, consumer: c, recovered: true})
+}
+
+func (c *slowConsumer) fields() common.MapStr {
+	fields := common.MapStr{
+		"reason":       c.reason,
+		"duration_us":  int64(c.last.Sub(c.start) / time.Microsecond),
+		"bytes_queued": c.bytesQueued,
+	}
+	if c.maxAckLatency > 0 {
+		fields["max_ack_latency_us"] = int64(c.maxAckLatency / time.Microsecond)
+	}
+	return fields
+}
+
+// ObserveTCP implements protos.TCPObserver, recording the capture time of
+// the segments, counting the TCP events of the sessions published with the
+// stats, and detecting the slow consumers, if enabled.
+func (fix *fixPlugin) ObserveTCP(
+	tcptuple *common.TCPTuple,
+	dir uint8,
+	seg *protos.TCPSegment,
+	private protos.ProtocolData,
+) protos.ProtocolData {
+	defer logp.Recover("ObserveTCP(fix) exception")
+
+	conn := ensureFixConnection(private)
+	conn.lastSegment = seg.Ts
+	if !fix.slowConsumer.Enabled && fix.statsInterval <= 0 {
+		return conn
+	}
+	obs := conn.tcp.onSegment(dir, seg)
+	if fix.statsInterval > 0 {
+		_, initiatorDir := conn.initiatorView(tcptuple, dir)
+		conn.stats.onSegment(initiatorDir, seg, &obs)
+	}
+	if fix.slowConsumer.Enabled {
+		for _, ev := range conn.slowConsumers.onSegment(dir, seg, &obs, &fix.slowConsumer) {
+			fix.publishSlowConsumerEvent(conn, tcptuple, ev)
+		}
+	}
+	return conn
+}
+
+// publishSlowConsumerEvent publishes a slow consumer, the source of the event
+// being the side the data is queued by and the destination the consumer.
+func (fix *fixPlugin) publishSlowConsumerEvent(
+	conn *fixConnectionData,
+	tcptuple *common.TCPTuple,
+	ev slowConsumerEvent,
+) {
+	slowConsumers.Add(1)
+	src := common.Endpoint{IP: tcptuple.SrcIP.String(), Port: tcptuple.SrcPort}
+	dst := common.Endpoint{IP: tcptuple.DstIP.String(), Port: tcptuple.DstPort}
+	if ev.dir == tcp.TCPDirectionReverse {
+		src, dst = dst, src
+	}
+
+	s := &conn.session
+	fields := ev.consumer.fields()
+	fields["recovered"] = ev.recovered
+	if s.hasKey {
+		// the consumer sends in the other direction
+		_, consumerDir := conn.initiatorView(tcptuple, 1-ev.dir)
+		if compID := s.compID(consumerDir); compID != "" {
+			fields["comp_id"] = compID
+		}
+	}
+	fix.results.PublishTransaction(common.MapStr{
+		"@timestamp": common.Time(ev.consumer.start),
+		"type":       "fix",
+		"src":        &src,
+		"dst":        &dst,
+		"fix":        s.eventFields("slow_consumer", fields),
+	})
+}
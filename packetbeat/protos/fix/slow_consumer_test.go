@@ -0,0 +1,100 @@
+// +build !integration
+
+package fix
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/packetbeat/protos"
+	"github.com/elastic/beats/packetbeat/protos/tcp"
+)
+
+// segments observes the segments of the connection from port 40000, sent
+// by the initiator or the acceptor.
+type segments struct {
+	fix  *fixPlugin
+	conn protos.ProtocolData
+	ts   time.Time
+}
+
+func (s *segments) send(dir uint8, after time.Duration, seg protos.TCPSegment) {
+	seg.Ts = s.ts.Add(after)
+	s.conn = s.fix.ObserveTCP(dedupTuple(40000), dir, &seg, s.conn)
+}
+
+func TestSlowConsumerZeroWindow(t *testing.T) {
+	fix, results := fixModForTests(func(c *fixConfig) {
+		c.SlowConsumer = slowConsumerConfig{Enabled: true, MinDuration: 100 * time.Millisecond}
+	})
+	s := &segments{fix: fix, ts: time.Now()}
+
+	s.send(initiator, 0, protos.TCPSegment{Seq: 1000, Ack: 1, ACK: true, Window: 512, PayloadLen: 1000})
+	s.send(acceptor, 0, protos.TCPSegment{Seq: 1, Ack: 1500, ACK: true, Window: 0})
+	// zero window probe
+	s.send(initiator, 200*time.Millisecond, protos.TCPSegment{Seq: 2000, Ack: 1, ACK: true, Window: 512, PayloadLen: 1})
+	s.send(acceptor, 300*time.Millisecond, protos.TCPSegment{Seq: 1, Ack: 1500, ACK: true, Window: 0})
+	assert.Empty(t, results.Channel)
+
+	s.send(acceptor, 500*time.Millisecond, protos.TCPSegment{Seq: 1, Ack: 2001, ACK: true, Window: 1024})
+	event := expectEvent(t, results)
+	assert.Equal(t, common.Time(s.ts), event["@timestamp"])
+	assert.Equal(t, "10.0.0.1", event["src"].(*common.Endpoint).IP)
+	assert.Equal(t, "10.0.0.2", event["dst"].(*common.Endpoint).IP)
+	assert.Equal(t, common.MapStr{
+		"reason":       "zero_window",
+		"duration_us":  int64(500000),
+		"bytes_queued": uint32(501),
+		"recovered":    true,
+	}, event["fix"].(common.MapStr)["slow_consumer"])
+}
+
+func TestSlowConsumerAckLatency(t *testing.T) {
+	fix, results := fixModForTests(func(c *fixConfig) {
+		c.SlowConsumer = slowConsumerConfig{Enabled: true, AckLatency: 200 * time.Millisecond, MinDuration: 100 * time.Millisecond}
+	})
+	s := &segments{fix: fix, ts: time.Now()}
+
+	// data sent by the acceptor, acknowledged late by the initiator
+	s.send(acceptor, 0, protos.TCPSegment{Seq: 1, Ack: 1, ACK: true, Window: 512, PayloadLen: 100})
+	s.send(acceptor, 250*time.Millisecond, protos.TCPSegment{Seq: 101, Ack: 1, ACK: true, Window: 512, PayloadLen: 100})
+	s.send(initiator, 300*time.Millisecond, protos.TCPSegment{Seq: 1, Ack: 101, ACK: true, Window: 512})
+	s.send(initiator, 480*time.Millisecond, protos.TCPSegment{Seq: 1, Ack: 201, ACK: true, Window: 512})
+	assert.Empty(t, results.Channel)
+
+	s.send(acceptor, 500*time.Millisecond, protos.TCPSegment{Seq: 201, Ack: 1, ACK: true, Window: 512, PayloadLen: 100})
+	s.send(initiator, 550*time.Millisecond, protos.TCPSegment{Seq: 1, Ack: 301, ACK: true, Window: 512})
+	event := expectEvent(t, results)
+	assert.Equal(t, "10.0.0.2", event["src"].(*common.Endpoint).IP)
+	assert.Equal(t, common.MapStr{
+		"reason":             "ack_latency",
+		"duration_us":        int64(550000),
+		"bytes_queued":       uint32(100),
+		"max_ack_latency_us": int64(300000),
+		"recovered":          true,
+	}, event["fix"].(common.MapStr)["slow_consumer"])
+}
+
+func TestSlowConsumerNotRecovered(t *testing.T) {
+	fix, results := fixModForTests(func(c *fixConfig) {
+		c.SlowConsumer = slowConsumerConfig{Enabled: true, MinDuration: 100 * time.Millisecond}
+	})
+	s := &segments{fix: fix, ts: time.Now()}
+
+	// zero windows shorter than the min_duration are not reported
+	s.send(initiator, 0, protos.TCPSegment{Seq: 1000, Ack: 1, ACK: true, Window: 512, PayloadLen: 1000})
+	s.send(acceptor, 0, protos.TCPSegment{Seq: 1, Ack: 1000, ACK: true, Window: 0})
+	s.send(acceptor, 50*time.Millisecond, protos.TCPSegment{Seq: 1, Ack: 2000, ACK: true, Window: 1024})
+	assert.Empty(t, results.Channel)
+
+	s.send(initiator, 60*time.Millisecond, protos.TCPSegment{Seq: 2000, Ack: 1, ACK: true, Window: 512, PayloadLen: 1000})
+	s.send(acceptor, 70*time.Millisecond, protos.TCPSegment{Seq: 1, Ack: 2000, ACK: true, Window: 0})
+	fix.ReceivedFin(dedupTuple(40000), tcp.TCPDirectionOriginal, s.conn)
+	event := expectEvent(t, results)
+	slow := event["fix"].(common.MapStr)["slow_consumer"].(common.MapStr)
+	assert.Equal(t, uint32(1000), slow["bytes_queued"])
+	assert.Equal(t, false, slow["recovered"])
+}
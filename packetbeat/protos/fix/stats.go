@@ -0,0 +1,118 @@
+package fix
+
+import (
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/packetbeat/protos/tcp"
+)
+
+// statsTracker counts the messages of a session per period, published as
+// stats events. Periods are aligned to the interval by capture time, so that
+// the periods of all sessions match.
+type statsTracker struct {
+	current *sessionStats
+
+	// last MsgSeqNum seen per direction, kept across periods
+	seqNo [2]int
+
+	// TCP events counted since the last period ended, and the smoothed RTT
+	// of the data sent per direction, kept across periods
+	tcp         tcpCounters
+	srtt        [2]time.Duration
+	tcpObserved bool
+}
+
+// sessionStats holds the counters of one period.
+type sessionStats struct {
+	start    time.Time
+	messages int
+	msgTypes map[string]int
+	bytes    [2]int
+	rejects  int
+	seqNo    [2]int
+
+	tcp         tcpCounters
+	srtt        [2]time.Duration
+	tcpObserved bool
+}
+
+// onMessage adds msg to the period of its capture time. If msg starts a new
+// period, the stats of the previous period are returned.
+func (t *statsTracker) onMessage(dir uint8, msg *message, interval time.Duration) *sessionStats {
+	if interval <= 0 {
+		return nil
+	}
+
+	var done *sessionStats
+	start := msg.ts.Truncate(interval)
+	if t.current != nil && start.After(t.current.start) {
+		done = t.flush()
+	}
+	if t.current == nil {
+		t.current = &sessionStats{start: start, msgTypes: map[string]int{}}
+	}
+
+	s := t.current
+	msgType, _ := msg.fields.get(tagMsgType)
+	s.messages++
+	s.msgTypes[msgType]++
+	s.bytes[dir] += len(msg.raw)
+	if msgType == msgTypeReject || msgType == msgTypeBusinessMessageReject {
+		s.rejects++
+	}
+	if v, ok := msg.fields.get(tagMsgSeqNum); ok {
+		if seqNo := atoiOrZero(v); seqNo > 0 {
+			t.seqNo[dir] = seqNo
+		}
+	}
+	return done
+}
+
+// flush ends the current period, returning its stats or nil if no message
+// has been seen since the last period ended.
+func (t *statsTracker) flush() *sessionStats {
+	s := t.current
+	t.current = nil
+	if s != nil {
+		s.seqNo = t.seqNo
+		s.tcp, s.srtt, s.tcpObserved = t.tcp, t.srtt, t.tcpObserved
+		t.tcp = tcpCounters{}
+	}
+	return s
+}
+
+// fields returns the fields of a stats event. Directions are named from the
+// point of view of the session initiator, out being the messages it sent.
+// Rates are messages per second over the full interval.
+func (s *sessionStats) fields(interval time.Duration) common.MapStr {
+	secs := interval.Seconds()
+	counts := common.MapStr{}
+	rates := common.MapStr{}
+	for msgType, n := range s.msgTypes {
+		counts[msgType] = n
+		rates[msgType] = float64(n) / secs
+	}
+
+	out, in := tcp.TCPDirectionOriginal, tcp.TCPDirectionReverse
+	fields := common.MapStr{
+		"interval_ms":      int64(interval / time.Millisecond),
+		"messages":         s.messages,
+		"messages_per_sec": float64(s.messages) / secs,
+		"msg_types":        counts,
+		"msg_type_rates":   rates,
+		"bytes_out":        s.bytes[out],
+		"bytes_in":         s.bytes[in],
+		"rejects":          s.rejects,
+	}
+	if s.seqNo[out] > 0 {
+		fields["seq_no_out"] = s.seqNo[out]
+	}
+	if s.seqNo[in] > 0 {
+		fields["seq_no_in"] = s.seqNo[in]
+	}
+	if s.tcpObserved {
+		fields["tcp"] = s.tcpFields()
+	}
+	return fields
+}
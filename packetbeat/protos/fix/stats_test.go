@@ -0,0 +1,103 @@
+// +build !integration
+
+package fix
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func TestStatsPerPeriod(t *testing.T) {
+	fix, results := fixModForTests(func(c *fixConfig) { c.StatsInterval = 10 * time.Second })
+
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+	msgs := []timedMessage{
+		{initiator, 1 * time.Second, "8=FIX.4.2|35=D|34=2|49=CLIENT|56=BROKER|11=order-1|"},
+		{acceptor, 3 * time.Second, "8=FIX.4.2|35=8|34=5|49=BROKER|56=CLIENT|11=order-1|150=0|"},
+		{acceptor, 5 * time.Second, "8=FIX.4.2|35=3|34=6|49=BROKER|56=CLIENT|45=2|"},
+		{initiator, 12 * time.Second, "8=FIX.4.2|35=0|34=3|49=CLIENT|56=BROKER|"},
+	}
+	var bytesOut, bytesIn int
+	for _, m := range msgs[:3] {
+		if m.dir == initiator {
+			bytesOut += len(fixMessage(m.msg))
+		} else {
+			bytesIn += len(fixMessage(m.msg))
+		}
+	}
+	private := parseTimedMessages(fix, ts, msgs)
+
+	event := nextFixEvent(t, results, "stats")
+	assert.Equal(t, common.Time(ts), event["@timestamp"])
+	assert.Equal(t, "CLIENT->BROKER", event["fix"].(common.MapStr)["session_key"])
+
+	stats := event["fix"].(common.MapStr)["stats"].(common.MapStr)
+	assert.Equal(t, int64(10000), stats["interval_ms"])
+	assert.Equal(t, 3, stats["messages"])
+	assert.Equal(t, 0.3, stats["messages_per_sec"])
+	assert.Equal(t, common.MapStr{"D": 1, "8": 1, "3": 1}, stats["msg_types"])
+	assert.Equal(t, 0.1, stats["msg_type_rates"].(common.MapStr)["D"])
+	assert.Equal(t, bytesOut, stats["bytes_out"])
+	assert.Equal(t, bytesIn, stats["bytes_in"])
+	assert.Equal(t, 1, stats["rejects"])
+	assert.Equal(t, 2, stats["seq_no_out"])
+	assert.Equal(t, 6, stats["seq_no_in"])
+	assert.Equal(t, "CLIENT", stats["sender_comp_id"])
+
+	// the current period is published on shutdown
+	fix.Flush(&sessionTuple, private)
+	event = nextFixEvent(t, results, "stats")
+	assert.Equal(t, common.Time(ts.Add(10*time.Second)), event["@timestamp"])
+	stats = event["fix"].(common.MapStr)["stats"].(common.MapStr)
+	assert.Equal(t, 1, stats["messages"])
+	assert.Equal(t, 3, stats["seq_no_out"])
+	assert.Equal(t, 6, stats["seq_no_in"])
+}
+
+func TestStatsDisabled(t *testing.T) {
+	var tracker statsTracker
+	msg := &message{ts: time.Now(), fields: splitFields(fixMessage("8=FIX.4.2|35=0|34=3|"))}
+
+	assert.Nil(t, tracker.onMessage(initiator, msg, 0))
+	assert.Nil(t, tracker.flush())
+}
+
+func TestStatsOnLogout(t *testing.T) {
+	fix, results := fixModForTests(func(c *fixConfig) { c.StatsInterval = 10 * time.Second })
+
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+	parseTimedMessages(fix, ts, []timedMessage{
+		{initiator, time.Second, "8=FIX.4.2|35=A|34=1|49=CLIENT|56=BROKER|108=30|"},
+		{acceptor, time.Second, "8=FIX.4.2|35=A|34=1|49=BROKER|56=CLIENT|108=30|"},
+		{initiator, 2 * time.Second, "8=FIX.4.2|35=5|34=2|49=CLIENT|56=BROKER|"},
+		{acceptor, 2 * time.Second, "8=FIX.4.2|35=5|34=2|49=BROKER|56=CLIENT|"},
+	})
+
+	// the period ends with the session, without waiting for the connection
+	// to be closed
+	stats := expectFixEvent(t, results, "stats")
+	assert.Equal(t, 4, stats["messages"])
+	assert.Equal(t, common.MapStr{"A": 2, "5": 2}, stats["msg_types"])
+}
+
+func TestStatsOnExpiry(t *testing.T) {
+	fix, results := fixModForTests(func(c *fixConfig) { c.StatsInterval = 10 * time.Second })
+
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+	private := parseTimedMessages(fix, ts, []timedMessage{
+		{initiator, time.Second, "8=FIX.4.2|35=A|34=1|49=CLIENT|56=BROKER|108=30|"},
+		{acceptor, time.Second, "8=FIX.4.2|35=A|34=1|49=BROKER|56=CLIENT|108=30|"},
+		{initiator, 3 * time.Second, "8=FIX.4.2|35=D|34=2|49=CLIENT|56=BROKER|11=order-1|"},
+	})
+
+	fix.Expired(&sessionTuple, private)
+	stats := expectFixEvent(t, results, "stats")
+	assert.Equal(t, 3, stats["messages"])
+
+	// the session is terminated as if the connection was closed
+	assert.Equal(t, "terminated", expectFixEvent(t, results, "session")["event"])
+}
@@ -0,0 +1,251 @@
+package fix
+
+import (
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/packetbeat/protos"
+	"github.com/elastic/beats/packetbeat/protos/tcp"
+)
+
+// maxUnackedSegments limits the segments remembered per direction for
+// measuring the RTT and the ACK latency. Segments sent while the limit is
+// reached are not measured.
+const maxUnackedSegments = 1024
+
+// maxSeqHoles limits the ranges of data not seen remembered per direction.
+// Data filling ranges beyond the limit is counted as retransmitted.
+const maxSeqHoles = 64
+
+// tcpState follows the sequence numbers and acknowledgements of a
+// connection in both directions, from the segments observed.
+type tcpState struct {
+	sides [2]tcpSide
+}
+
+// tcpSide is the TCP state of the segments sent in one direction.
+type tcpSide struct {
+	seen    bool
+	nextSeq uint32
+
+	acked bool
+	ack   uint32
+
+	// segments with payload not acknowledged yet, oldest first
+	unacked []unackedSegment
+
+	// ranges of data skipped by segments out of order, not seen yet
+	holes []seqRange
+}
+
+// seqRange is the data from start to end, excluded.
+type seqRange struct {
+	start, end uint32
+}
+
+type unackedSegment struct {
+	end uint32
+	ts  time.Time
+
+	// set if sent again, the segment not being sampled for the RTT
+	retransmitted bool
+}
+
+// observedSegment is what a segment tells of the connection.
+type observedSegment struct {
+	// the segment sends data already sent, or data ahead of data not seen
+	retransmission, outOfOrder bool
+
+	// set if the segment acknowledges data sent in the other direction, sent
+	// first at sent
+	acked bool
+	sent  time.Time
+
+	// round trip time of the data acknowledged, from the capture point,
+	// sampled from segments not retransmitted only
+	rtt    time.Duration
+	hasRTT bool
+
+	// bytes sent in the other direction not acknowledged by the segment
+	queued uint32
+}
+
+// onSegment updates the state with a segment sent in direction dir.
+func (s *tcpState) onSegment(dir uint8, seg *protos.TCPSegment) observedSegment {
+	var obs observedSegment
+
+	sender := &s.sides[dir]
+	end := seg.Seq + uint32(seg.PayloadLen)
+	if seg.SYN || seg.FIN {
+		end++
+	}
+	switch {
+	case sender.seen && seg.PayloadLen == 1 && end == sender.nextSeq:
+		// keep-alive, sending the last byte acknowledged again
+	case sender.seen && seg.PayloadLen > 0 && !seqBefore(sender.nextSeq, end):
+		// data not seen yet is late, counted out of order once already
+		if !sender.fill(seg.Seq, end) {
+			obs.retransmission = true
+			sender.retransmitted(seg.Seq, end)
+		}
+	case !sender.seen || seqBefore(sender.nextSeq, end):
+		if seg.PayloadLen > 0 && len(sender.unacked) < maxUnackedSegments {
+			sender.unacked = append(sender.unacked, unackedSegment{end: end, ts: seg.Ts})
+		}
+		if sender.seen && seqBefore(sender.nextSeq, seg.Seq) {
+			obs.outOfOrder = true
+			if len(sender.holes) < maxSeqHoles {
+				sender.holes = append(sender.holes, seqRange{start: sender.nextSeq, end: seg.Seq})
+			}
+		} else if sender.seen {
+			sender.fill(seg.Seq, sender.nextSeq)
+		}
+		sender.seen, sender.nextSeq = true, end
+	}
+	if !seg.ACK {
+		return obs
+	}
+	if !sender.acked || seqBefore(sender.ack, seg.Ack) {
+		sender.acked, sender.ack = true, seg.Ack
+	}
+
+	receiver := &s.sides[1-dir]
+	receiver.forgetHoles(seg.Ack)
+	obs.queued = receiver.bytesQueued(seg.Ack)
+	if acked := receiver.acknowledge(seg.Ack); len(acked) > 0 {
+		obs.acked, obs.sent = true, acked[0].ts
+		if last := acked[len(acked)-1]; !last.retransmitted {
+			obs.rtt, obs.hasRTT = seg.Ts.Sub(last.ts), true
+		}
+	}
+	return obs
+}
+
+// fill removes the data from seq to end from the holes, returning whether
+// any data was missing.
+func (s *tcpSide) fill(seq, end uint32) bool {
+	if len(s.holes) == 0 {
+		return false
+	}
+	filled := false
+	var holes []seqRange
+	for _, h := range s.holes {
+		if !seqBefore(seq, h.end) || !seqBefore(h.start, end) {
+			holes = append(holes, h)
+			continue
+		}
+		filled = true
+		if seqBefore(h.start, seq) {
+			holes = append(holes, seqRange{start: h.start, end: seq})
+		}
+		if seqBefore(end, h.end) {
+			holes = append(holes, seqRange{start: end, end: h.end})
+		}
+	}
+	s.holes = holes
+	return filled
+}
+
+// forgetHoles forgets the data missing acknowledged by ack, received even if
+// not captured.
+func (s *tcpSide) forgetHoles(ack uint32) {
+	holes := s.holes[:0]
+	for _, h := range s.holes {
+		if !seqBefore(ack, h.end) {
+			continue
+		}
+		if seqBefore(h.start, ack) {
+			h.start = ack
+		}
+		holes = append(holes, h)
+	}
+	s.holes = holes
+}
+
+// retransmitted marks the segments overlapping the data from seq to end as
+// sent again.
+func (s *tcpSide) retransmitted(seq, end uint32) {
+	for i := range s.unacked {
+		if !seqBefore(seq, s.unacked[i].end) {
+			continue
+		}
+		s.unacked[i].retransmitted = true
+		if !seqBefore(s.unacked[i].end, end) {
+			return
+		}
+	}
+}
+
+// bytesQueued returns the bytes sent and not acknowledged by ack.
+func (s *tcpSide) bytesQueued(ack uint32) uint32 {
+	if !s.seen || !seqBefore(ack, s.nextSeq) {
+		return 0
+	}
+	return s.nextSeq - ack
+}
+
+// acknowledge forgets and returns the segments acknowledged by ack.
+func (s *tcpSide) acknowledge(ack uint32) []unackedSegment {
+	n := 0
+	for n < len(s.unacked) && !seqBefore(ack, s.unacked[n].end) {
+		n++
+	}
+	acked := s.unacked[:n]
+	s.unacked = s.unacked[n:]
+	return acked
+}
+
+// seqBefore compares TCP sequence numbers, which wrap around.
+func seqBefore(seq1, seq2 uint32) bool {
+	return int32(seq1-seq2) < 0
+}
+
+// tcpCounters counts the TCP events of a session, per direction from the
+// point of view of the session initiator.
+type tcpCounters struct {
+	retransmissions [2]int
+	outOfOrder      [2]int
+	resets          int
+}
+
+// onSegment counts the events of a segment sent in direction dir. The RTT of
+// the data sent in the other direction is smoothed as by RFC 6298.
+func (t *statsTracker) onSegment(dir uint8, seg *protos.TCPSegment, obs *observedSegment) {
+	t.tcpObserved = true
+	if obs.retransmission {
+		t.tcp.retransmissions[dir]++
+	}
+	if obs.outOfOrder {
+		t.tcp.outOfOrder[dir]++
+	}
+	if seg.RST {
+		t.tcp.resets++
+	}
+	if obs.hasRTT {
+		srtt := &t.srtt[1-dir]
+		if *srtt == 0 {
+			*srtt = obs.rtt
+		} else {
+			*srtt += (obs.rtt - *srtt) / 8
+		}
+	}
+}
+
+// tcpFields returns the TCP fields of a stats event.
+func (s *sessionStats) tcpFields() common.MapStr {
+	out, in := tcp.TCPDirectionOriginal, tcp.TCPDirectionReverse
+	fields := common.MapStr{
+		"retransmissions_out": s.tcp.retransmissions[out],
+		"retransmissions_in":  s.tcp.retransmissions[in],
+		"out_of_order_out":    s.tcp.outOfOrder[out],
+		"out_of_order_in":     s.tcp.outOfOrder[in],
+		"resets":              s.tcp.resets,
+	}
+	if s.srtt[out] > 0 {
+		fields["rtt_out_us"] = int64(s.srtt[out] / time.Microsecond)
+	}
+	if s.srtt[in] > 0 {
+		fields["rtt_in_us"] = int64(s.srtt[in] / time.Microsecond)
+	}
+	return fields
+}
@@ -0,0 +1,119 @@
+// +build !integration
+
+package fix
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/packetbeat/protos"
+)
+
+func TestTCPStateRetransmissionsAndOutOfOrder(t *testing.T) {
+	var state tcpState
+	ts := time.Now()
+
+	obs := state.onSegment(initiator, &protos.TCPSegment{Ts: ts, Seq: 100, PayloadLen: 100})
+	assert.Equal(t, observedSegment{}, obs)
+
+	// data ahead of data not seen
+	obs = state.onSegment(initiator, &protos.TCPSegment{Ts: ts, Seq: 300, PayloadLen: 100})
+	assert.True(t, obs.outOfOrder)
+
+	obs = state.onSegment(initiator, &protos.TCPSegment{Ts: ts, Seq: 100, PayloadLen: 100})
+	assert.True(t, obs.retransmission)
+	assert.False(t, obs.outOfOrder)
+
+	// keep-alives are not retransmissions
+	obs = state.onSegment(initiator, &protos.TCPSegment{Ts: ts, Seq: 399, PayloadLen: 1})
+	assert.False(t, obs.retransmission)
+}
+
+func TestTCPStateReordering(t *testing.T) {
+	var state tcpState
+	ts := time.Now()
+
+	outOfOrder, retransmissions := 0, 0
+	for _, seq := range []uint32{100, 300, 200} {
+		obs := state.onSegment(initiator, &protos.TCPSegment{Ts: ts, Seq: seq, PayloadLen: 100})
+		if obs.outOfOrder {
+			outOfOrder++
+		}
+		if obs.retransmission {
+			retransmissions++
+		}
+	}
+	assert.Equal(t, 1, outOfOrder)
+	assert.Equal(t, 0, retransmissions)
+	assert.Empty(t, state.sides[initiator].holes)
+
+	// once filled, the data is retransmitted if sent again
+	obs := state.onSegment(initiator, &protos.TCPSegment{Ts: ts, Seq: 200, PayloadLen: 100})
+	assert.True(t, obs.retransmission)
+
+	// data missing from the capture is forgotten once acknowledged
+	state.onSegment(initiator, &protos.TCPSegment{Ts: ts, Seq: 500, PayloadLen: 100})
+	state.onSegment(acceptor, &protos.TCPSegment{Ts: ts, Seq: 1, Ack: 600, ACK: true})
+	assert.Empty(t, state.sides[initiator].holes)
+	obs = state.onSegment(initiator, &protos.TCPSegment{Ts: ts, Seq: 400, PayloadLen: 100})
+	assert.True(t, obs.retransmission)
+}
+
+func TestTCPStateRTT(t *testing.T) {
+	var state tcpState
+	ts := time.Now()
+
+	state.onSegment(initiator, &protos.TCPSegment{Ts: ts, Seq: 1, PayloadLen: 100})
+	state.onSegment(initiator, &protos.TCPSegment{Ts: ts.Add(time.Millisecond), Seq: 101, PayloadLen: 100})
+	obs := state.onSegment(acceptor, &protos.TCPSegment{
+		Ts: ts.Add(3 * time.Millisecond), Seq: 1, Ack: 101, ACK: true,
+	})
+	assert.True(t, obs.acked)
+	assert.Equal(t, ts, obs.sent)
+	assert.Equal(t, 3*time.Millisecond, obs.rtt)
+	assert.True(t, obs.hasRTT)
+	assert.Equal(t, uint32(100), obs.queued)
+
+	// retransmitted segments are not sampled
+	state.onSegment(initiator, &protos.TCPSegment{Ts: ts.Add(5 * time.Millisecond), Seq: 101, PayloadLen: 100})
+	obs = state.onSegment(acceptor, &protos.TCPSegment{
+		Ts: ts.Add(6 * time.Millisecond), Seq: 1, Ack: 201, ACK: true,
+	})
+	assert.True(t, obs.acked)
+	assert.False(t, obs.hasRTT)
+}
+
+func TestStatsTCPHealth(t *testing.T) {
+	fix, results := fixModForTests(func(c *fixConfig) { c.StatsInterval = 10 * time.Second })
+
+	ts := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+	raw := fixMessage("8=FIX.4.2|35=D|34=2|49=CLIENT|56=BROKER|11=order-1|")
+	n := uint32(len(raw))
+	var private protos.ProtocolData
+	observe := func(dir uint8, offset time.Duration, seg protos.TCPSegment) {
+		seg.Ts = ts.Add(offset)
+		private = fix.ObserveTCP(&sessionTuple, dir, &seg, private)
+	}
+
+	observe(initiator, time.Second, protos.TCPSegment{Seq: 1, Ack: 1, ACK: true, PayloadLen: int(n)})
+	private = fix.Parse(&protos.Packet{Ts: ts.Add(time.Second), Payload: raw}, &sessionTuple, initiator, private)
+	observe(initiator, 2*time.Second, protos.TCPSegment{Seq: 1, Ack: 1, ACK: true, PayloadLen: int(n)})
+	observe(acceptor, 2*time.Second+4*time.Millisecond, protos.TCPSegment{Seq: 1, Ack: 1 + n, ACK: true})
+	observe(initiator, 2500*time.Millisecond, protos.TCPSegment{Seq: 1 + n, Ack: 1, ACK: true, PayloadLen: 10})
+	observe(acceptor, 2502*time.Millisecond, protos.TCPSegment{Seq: 1, Ack: 11 + n, ACK: true})
+	observe(acceptor, 3*time.Second, protos.TCPSegment{Seq: 1, Ack: 11 + n, RST: true})
+	fix.Flush(&sessionTuple, private)
+
+	stats := expectFixEvent(t, results, "stats")
+	assert.Equal(t, common.MapStr{
+		"retransmissions_out": 1,
+		"retransmissions_in":  0,
+		"out_of_order_out":    0,
+		"out_of_order_in":     0,
+		"resets":              1,
+		"rtt_out_us":          int64(2000),
+	}, stats["tcp"])
+}
@@ -0,0 +1,99 @@
+package fix
+
+import (
+	"fmt"
+)
+
+type tenantConfig struct {
+	Name         string   `config:"name" validate:"required"`
+	SenderCompID string   `config:"sender_comp_id"`
+	TargetCompID string   `config:"target_comp_id"`
+	IPs          []string `config:"ips"`
+	Ports        []int    `config:"ports"`
+
+	// tag holding the venue of messages, and the venues of the tenant
+	VenueTag int      `config:"venue_tag"`
+	Venues   []string `config:"venues"`
+}
+
+// tenants assigns the events of sessions to the business units sharing the
+// capture, published as fix.tenant for outputs to route events by. Rules
+// are checked in order and the first rule matching a message applies.
+type tenants struct {
+	rules []tenantRule
+}
+
+type tenantRule struct {
+	knownSessionRule
+
+	venueTag int
+	venues   map[string]bool
+}
+
+func (c *tenantConfig) Validate() error {
+	session := c.session()
+	if err := session.Validate(); err != nil {
+		return err
+	}
+	if len(c.Venues) > 0 && c.VenueTag <= 0 {
+		return fmt.Errorf("venues of tenant %s require a venue_tag", c.Name)
+	}
+	return nil
+}
+
+// session returns the session matched by the tenant.
+func (c *tenantConfig) session() knownSessionConfig {
+	return knownSessionConfig{
+		Name:         c.Name,
+		SenderCompID: c.SenderCompID,
+		TargetCompID: c.TargetCompID,
+		IPs:          c.IPs,
+		Ports:        c.Ports,
+	}
+}
+
+func newTenants(configs []tenantConfig) *tenants {
+	if len(configs) == 0 {
+		return nil
+	}
+
+	sessions := make([]knownSessionConfig, len(configs))
+	for i, c := range configs {
+		sessions[i] = c.session()
+	}
+	known := newKnownSessions(sessions)
+
+	t := &tenants{}
+	for i, c := range configs {
+		t.rules = append(t.rules, tenantRule{
+			knownSessionRule: known.rules[i],
+			venueTag:         c.VenueTag,
+			venues:           stringSet(c.Venues),
+		})
+	}
+	return t
+}
+
+// lookup returns the tenant of a message of the session identified by key,
+// or an empty string if no rule matches. Without fields, as for the events
+// of the session itself, rules with venues do not match.
+func (t *tenants) lookup(key sessionKey, fields tagValues) string {
+	if t == nil {
+		return ""
+	}
+	for i := range t.rules {
+		rule := &t.rules[i]
+		if rule.matches(key) && rule.matchesVenue(fields) {
+			return rule.name
+		}
+	}
+	return ""
+}
+
+func (r *tenantRule) matchesVenue(fields tagValues) bool {
+	if r.venues == nil {
+		return true
+	}
+	venue, ok := fields.get(r.venueTag)
+	return ok && r.venues[venue]
+}
@@ -0,0 +1,84 @@
+//go:build !integration
+// +build !integration
+
+package fix
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/packetbeat/protos"
+)
+
+func TestTenantsLookup(t *testing.T) {
+	tenants := newTenants([]tenantConfig{
+		{Name: "fx", TargetCompID: "FXDESK"},
+		{Name: "equities-lse", VenueTag: 207, Venues: []string{"XLON"}},
+		{Name: "equities", Ports: []int{9878}},
+	})
+
+	key := func(sender, target string, port uint16) sessionKey {
+		return sessionKey{
+			senderCompID: sender,
+			targetCompID: target,
+			src:          common.Endpoint{IP: "10.0.0.1", Port: 40000},
+			dst:          common.Endpoint{IP: "10.0.0.2", Port: port},
+		}
+	}
+	lse := splitFields(fixMessage("8=FIX.4.4|35=D|55=VOD|207=XLON|"))
+	xpar := splitFields(fixMessage("8=FIX.4.4|35=D|55=BNP|207=XPAR|"))
+
+	// CompIDs match in either direction
+	assert.Equal(t, "fx", tenants.lookup(key("FXDESK", "BANK", 9000), lse))
+	assert.Equal(t, "fx", tenants.lookup(key("BANK", "FXDESK", 9000), nil))
+	assert.Equal(t, "equities-lse", tenants.lookup(key("CLIENT", "BROKER", 9878), lse))
+	assert.Equal(t, "equities", tenants.lookup(key("CLIENT", "BROKER", 9878), xpar))
+	// rules with venues do not match the session itself
+	assert.Equal(t, "equities", tenants.lookup(key("CLIENT", "BROKER", 9878), nil))
+	assert.Equal(t, "", tenants.lookup(key("CLIENT", "BROKER", 9000), xpar))
+	assert.Equal(t, "equities-lse", tenants.lookup(key("CLIENT", "BROKER", 9000), lse))
+
+	assert.Equal(t, "", newTenants(nil).lookup(key("CLIENT", "BROKER", 9878), lse))
+}
+
+func TestTenantConfigValidate(t *testing.T) {
+	assert.NoError(t, (&tenantConfig{Name: "a", VenueTag: 207, Venues: []string{"XLON"}}).Validate())
+	assert.Error(t, (&tenantConfig{Name: "a", Venues: []string{"XLON"}}).Validate())
+	assert.Error(t, (&tenantConfig{Name: "a", IPs: []string{"10.0.0"}}).Validate())
+}
+
+func TestParsePublishesTenant(t *testing.T) {
+	fix, results := fixModForTests()
+	fix.tenants = newTenants([]tenantConfig{
+		{Name: "equities-lse", VenueTag: 207, Venues: []string{"XLON"}},
+		{Name: "equities", SenderCompID: "CLIENT"},
+	})
+
+	parseSession(fix, nil,
+		directedMessage{initiator, "8=FIX.4.2|35=A|34=1|49=CLIENT|56=BROKER|108=30|"},
+		directedMessage{acceptor, "8=FIX.4.2|35=A|34=1|49=BROKER|56=CLIENT|108=30|"},
+		directedMessage{initiator, "8=FIX.4.2|35=D|34=2|49=CLIENT|56=BROKER|55=VOD|207=XLON|"},
+	)
+
+	// the Logons, the established session event and the order
+	assert.Len(t, results.Channel, 4)
+	var tenants []interface{}
+	for len(results.Channel) > 0 {
+		tenants = append(tenants, (<-results.Channel)["fix"].(common.MapStr)["tenant"])
+	}
+	assert.Equal(t, []interface{}{"equities", "equities", "equities", "equities-lse"}, tenants)
+
+	pkt := &protos.Packet{
+		Ts: time.Now(),
+		Tuple: common.NewIPPortTuple(4,
+			net.ParseIP("10.0.0.1"), 40000,
+			net.ParseIP("239.1.1.1"), 9878),
+		Payload: fixMessage("8=FIX.4.4|35=X|34=10|49=FEED|56=CLIENT|55=VOD.L|"),
+	}
+	fix.ParseUDP(pkt)
+	assert.Equal(t, "equities", expectEvent(t, results)["fix"].(common.MapStr)["tenant"])
+}
@@ -0,0 +1,58 @@
+package fix
+
+import (
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+const (
+	tagTransactTime    = 60
+	tagOrigSendingTime = 122
+)
+
+// preciseTimeLayout formats the times decoded to the nanosecond, common.Time
+// being formatted to the millisecond.
+const preciseTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// preciseTime is a time published to the nanosecond. It is a TextMarshaler
+// for events to be normalized to the formatted time.
+type preciseTime time.Time
+
+func (t preciseTime) MarshalText() ([]byte, error) {
+	return []byte(time.Time(t).UTC().Format(preciseTimeLayout)), nil
+}
+
+// wireTimes lists the timestamps set by the counterparties published in the
+// time group, with the name of the field holding the time minus the capture
+// time.
+var wireTimes = []struct {
+	tag        int
+	name, diff string
+}{
+	{tagSendingTime, "sending", "sending_diff_us"},
+	{tagTransactTime, "transact", "transact_diff_us"},
+	{tagOrigSendingTime, "orig_sending", "orig_sending_diff_us"},
+}
+
+// messageTimes returns the capture time and the SendingTime (52),
+// TransactTime (60) and OrigSendingTime (122) of a message, to the
+// nanosecond, and the difference of each to the capture time, making the
+// clock drift between the counterparties and the capture point visible.
+// Times are looked up by tag, as they might be renamed or dropped.
+func messageTimes(ts time.Time, fields tagValues) common.MapStr {
+	times := common.MapStr{"capture": preciseTime(ts)}
+	for _, wire := range wireTimes {
+		v, ok := fields.get(wire.tag)
+		if !ok {
+			continue
+		}
+		t, err := time.Parse(utcTimestampLayout, v)
+		if err != nil {
+			continue
+		}
+		times[wire.name] = preciseTime(t)
+		times[wire.diff] = int64(ts.Sub(t) / time.Microsecond)
+	}
+	return times
+}
@@ -0,0 +1,41 @@
+// +build !integration
+
+package fix
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/packetbeat/protos"
+)
+
+func TestMessageTimes(t *testing.T) {
+	fix, results := fixModForTests()
+	ts := time.Date(2016, 10, 14, 9, 30, 0, 1500, time.UTC)
+	pkt := &protos.Packet{Ts: ts, Payload: fixMessage("8=FIX.4.4|35=8|34=2|" +
+		"52=20161014-09:29:59.999250|60=20161014-09:29:59.998|122=bad|")}
+	fix.Parse(pkt, &common.TCPTuple{}, 0, nil)
+
+	times := expectEvent(t, results)["fix"].(common.MapStr)["time"].(common.MapStr)
+	assert.Equal(t, int64(751), times["sending_diff_us"])
+	assert.Equal(t, int64(2001), times["transact_diff_us"])
+	assert.NotContains(t, times, "orig_sending")
+	assert.NotContains(t, times, "orig_sending_diff_us")
+
+	// as published
+	encoded, err := json.Marshal(common.ConvertToGenericEvent(times))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.JSONEq(t, `{
+		"capture": "2016-10-14T09:30:00.000001500Z",
+		"sending": "2016-10-14T09:29:59.999250000Z",
+		"sending_diff_us": 751,
+		"transact": "2016-10-14T09:29:59.998000000Z",
+		"transact_diff_us": 2001
+	}`, string(encoded))
+}
@@ -0,0 +1,218 @@
+package fix
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/paths"
+)
+
+type traceConfig struct {
+	// trace the messages from the start, instead of on request
+	Enabled bool   `config:"enabled"`
+	Path    string `config:"path"`
+}
+
+var defaultTraceConfig = traceConfig{
+	Path: "fix.trace",
+}
+
+// msgTracer writes every decoded message to the trace file as annotated
+// text, for troubleshooting. Tracing is switched on and off while running by
+// SIGUSR1 or the /fix/trace HTTP endpoint, served with -httpprof.
+type msgTracer struct {
+	// set while tracing, checked for each message without locking
+	enabled int32
+
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+}
+
+var (
+	tracer          = &msgTracer{}
+	traceSignalOnce sync.Once
+)
+
+func init() {
+	http.HandleFunc("/fix/trace", traceHandler)
+}
+
+// configure sets the trace file, relative paths being resolved in the logs
+// path, and switches tracing on if enabled.
+func (t *msgTracer) configure(config traceConfig) error {
+	path := paths.Resolve(paths.Logs, config.Path)
+
+	t.mutex.Lock()
+	if t.file != nil && path != t.path {
+		t.closeFile()
+	}
+	t.path = path
+	t.mutex.Unlock()
+
+	traceSignalOnce.Do(handleTraceSignal)
+	if config.Enabled {
+		return t.setEnabled(true)
+	}
+	return nil
+}
+
+func (t *msgTracer) isEnabled() bool {
+	return atomic.LoadInt32(&t.enabled) == 1
+}
+
+// setEnabled switches tracing on or off. The trace file is appended to when
+// switched on and closed when switched off.
+func (t *msgTracer) setEnabled(enabled bool) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !enabled {
+		if atomic.SwapInt32(&t.enabled, 0) == 1 {
+			logp.Info("FIX message trace to %s stopped", t.path)
+		}
+		t.closeFile()
+		return nil
+	}
+
+	if t.file == nil {
+		f, err := os.OpenFile(t.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return fmt.Errorf("opening FIX trace file: %v", err)
+		}
+		t.file = f
+	}
+	if atomic.SwapInt32(&t.enabled, 1) == 0 {
+		logp.Info("FIX message trace to %s started", t.path)
+	}
+	return nil
+}
+
+// toggle switches tracing on if off, and off if on.
+func (t *msgTracer) toggle() error {
+	return t.setEnabled(!t.isEnabled())
+}
+
+func (t *msgTracer) closeFile() {
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+	}
+}
+
+// trace writes a message sent from src to dst to the trace file.
+func (t *msgTracer) trace(ts time.Time, src, dst string, dict *dictionary, fields tagValues) {
+	line := fmt.Sprintf("%s %s -> %s %s\n",
+		ts.UTC().Format(time.RFC3339Nano), src, dst, annotate(dict, fields))
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.file == nil {
+		return
+	}
+	if _, err := t.file.WriteString(line); err != nil {
+		logp.Err("Writing the FIX trace failed, trace stopped: %v", err)
+		atomic.StoreInt32(&t.enabled, 0)
+		t.closeFile()
+	}
+}
+
+// traceMsgNames are the message names of the MsgTypes which FIX 4.2 names
+// differently.
+var traceMsgNames = map[string]string{
+	"D": "New Order - Single",
+	"E": "New Order - List",
+}
+
+// annotate formats the fields of a message as tag=value, followed by the
+// field name of the tags known to the dictionary and the name of enumerated
+// values, like `35=D (NewOrderSingle) | 54=1 (Side: Buy) | 55=VOD.L (Symbol)`.
+func annotate(dict *dictionary, fields tagValues) string {
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		s := strconv.Itoa(f.tag) + "=" + f.value
+		if field, ok := dict.field(f.tag); ok {
+			name := dict.enum(f.tag, f.value)
+			switch {
+			case f.tag == tagMsgType && name != f.value:
+				if msgName, ok := traceMsgNames[f.value]; ok {
+					name = msgName
+				}
+				s += " (" + camelCase(name) + ")"
+			case name != f.value:
+				s += " (" + field.name + ": " + name + ")"
+			default:
+				s += " (" + field.name + ")"
+			}
+		}
+		parts[i] = s
+	}
+	return strings.Join(parts, " | ")
+}
+
+// camelCase joins the words of a MsgType name, like Order Cancel/Replace
+// Request to OrderCancelReplaceRequest.
+func camelCase(name string) string {
+	var b bytes.Buffer
+	upper := true
+	for _, r := range name {
+		if r == ' ' || r == '-' || r == '/' {
+			upper = true
+			continue
+		}
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// traceHandler reports whether messages are traced. POST requests switch
+// tracing on or off with enabled=true or false, or toggle it without.
+func traceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		var err error
+		if v := r.FormValue("enabled"); v != "" {
+			var enabled bool
+			enabled, err = strconv.ParseBool(v)
+			if err != nil {
+				http.Error(w, "invalid enabled value: "+v, http.StatusBadRequest)
+				return
+			}
+			err = tracer.setEnabled(enabled)
+		} else {
+			err = tracer.toggle()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tracer.mutex.Lock()
+	path := tracer.path
+	tracer.mutex.Unlock()
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled": tracer.isEnabled(),
+		"path":    path,
+	})
+}
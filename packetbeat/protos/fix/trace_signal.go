@@ -0,0 +1,24 @@
+// +build !windows
+
+package fix
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// handleTraceSignal toggles the message trace on SIGUSR1.
+func handleTraceSignal() {
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGUSR1)
+	go func() {
+		for range sigc {
+			if err := tracer.toggle(); err != nil {
+				logp.Err("Toggling the FIX message trace failed: %v", err)
+			}
+		}
+	}()
+}
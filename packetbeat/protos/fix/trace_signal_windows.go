@@ -0,0 +1,6 @@
+package fix
+
+// handleTraceSignal does nothing on Windows, which has no SIGUSR1. Tracing is
+// toggled with the /fix/trace HTTP endpoint instead.
+func handleTraceSignal() {
+}
@@ -0,0 +1,76 @@
+// +build !integration
+
+package fix
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnnotate(t *testing.T) {
+	fields := splitFields(fixMessage("8=FIX.4.4|35=D|54=1|55=VOD.L|9999=x|"))
+	assert.Equal(t,
+		"8=FIX.4.4 (BeginString) | 9=26 (BodyLength) | 35=D (NewOrderSingle) | "+
+			"54=1 (Side: Buy) | 55=VOD.L (Symbol) | 9999=x | 10=103 (CheckSum)",
+		annotate(fix44Dictionary, fields))
+
+	assert.Equal(t, "OrderCancelReplaceRequest", camelCase("Order Cancel/Replace Request"))
+	assert.Equal(t, "DontKnowTrade", camelCase("Don't Know Trade"))
+	assert.Equal(t, "ExecutionReport", camelCase("execution report"))
+}
+
+func TestTraceToggle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer tracer.setEnabled(false)
+
+	fix, _ := fixModForTests()
+	path := filepath.Join(dir, "fix.trace")
+	assert.NoError(t, tracer.configure(traceConfig{Path: path}))
+	assert.False(t, tracer.isEnabled())
+	parseMessages(fix, "8=FIX.4.4|35=0|49=CLIENT|56=BROKER|34=1|")
+
+	post := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		traceHandler(w, httptest.NewRequest("POST", "/fix/trace"+query, nil))
+		return w
+	}
+	w := post("")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"enabled":true`)
+	assert.True(t, tracer.isEnabled())
+
+	parseMessages(fix, "8=FIX.4.4|35=D|49=CLIENT|56=BROKER|34=2|55=VOD.L|")
+	assert.Equal(t, http.StatusBadRequest, post("?enabled=maybe").Code)
+	assert.Equal(t, http.StatusOK, post("?enabled=false").Code)
+	assert.False(t, tracer.isEnabled())
+	parseMessages(fix, "8=FIX.4.4|35=0|49=CLIENT|56=BROKER|34=3|")
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if assert.Len(t, lines, 1) {
+		assert.Contains(t, lines[0], " -> ")
+		assert.Contains(t, lines[0], "| 35=D (NewOrderSingle) |")
+		assert.Contains(t, lines[0], "| 55=VOD.L (Symbol) |")
+	}
+
+	w = httptest.NewRecorder()
+	traceHandler(w, httptest.NewRequest("GET", "/fix/trace", nil))
+	assert.Equal(t, `{"enabled":false,"path":"`+path+`"}`+"\n", w.Body.String())
+	w = httptest.NewRecorder()
+	traceHandler(w, httptest.NewRequest("DELETE", "/fix/trace", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
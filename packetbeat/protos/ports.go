@@ -0,0 +1,224 @@
+package protos
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// PortRange maps the ports From to To of the servers in Networks, any
+// server if empty, to a protocol. It is set by the port_ranges setting of
+// the protocols, for estates with too many ports to list in ports.
+type PortRange struct {
+	From, To uint16
+	Networks []*net.IPNet
+}
+
+type portRangeConfig struct {
+	// Ports is a port, a range like 9000-9100, or * for all ports
+	Ports    string   `config:"ports" validate:"required"`
+	Networks []string `config:"networks"`
+}
+
+type portRangesConfig struct {
+	PortRanges []portRangeConfig `config:"port_ranges"`
+}
+
+// ParsePortRanges parses the port_ranges setting of a protocol config.
+func ParsePortRanges(cfg *common.Config) ([]PortRange, error) {
+	var config portRangesConfig
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, err
+	}
+
+	var ranges []PortRange
+	for _, c := range config.PortRanges {
+		r, err := parsePorts(c.Ports)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range c.Networks {
+			ipNet, err := parseNetwork(s)
+			if err != nil {
+				return nil, err
+			}
+			r.Networks = append(r.Networks, ipNet)
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+func parsePorts(s string) (PortRange, error) {
+	s = strings.TrimSpace(s)
+	if s == "*" {
+		return PortRange{From: 0, To: 65535}, nil
+	}
+
+	from, to := s, s
+	if i := strings.Index(s, "-"); i >= 0 {
+		from, to = strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:])
+	}
+	first, err := strconv.ParseUint(from, 10, 16)
+	if err != nil {
+		return PortRange{}, fmt.Errorf("invalid port range %q", s)
+	}
+	last, err := strconv.ParseUint(to, 10, 16)
+	if err != nil || last < first {
+		return PortRange{}, fmt.Errorf("invalid port range %q", s)
+	}
+	return PortRange{From: uint16(first), To: uint16(last)}, nil
+}
+
+// parseNetwork parses a network in CIDR notation, or an IP address.
+func parseNetwork(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, ipNet, err := net.ParseCIDR(s)
+		return ipNet, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid network %s", s)
+	}
+	bits := 8 * net.IPv4len
+	if ip.To4() == nil {
+		bits = 8 * net.IPv6len
+	} else {
+		ip = ip.To4()
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// Contains checks the port of the server at ip is in the range.
+func (r PortRange) Contains(ip net.IP, port uint16) bool {
+	if port < r.From || port > r.To {
+		return false
+	}
+	if len(r.Networks) == 0 {
+		return true
+	}
+	for _, ipNet := range r.Networks {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Overlaps checks some server ports are in both ranges.
+func (r PortRange) Overlaps(o PortRange) bool {
+	if r.To < o.From || o.To < r.From {
+		return false
+	}
+	if len(r.Networks) == 0 || len(o.Networks) == 0 {
+		return true
+	}
+	for _, a := range r.Networks {
+		for _, b := range o.Networks {
+			if a.Contains(b.IP) || b.Contains(a.IP) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bpfFilter returns the BPF expression matching the packets of the range,
+// transport being tcp, udp or empty for both.
+func (r PortRange) bpfFilter(transport string) string {
+	var expr string
+	switch {
+	case r.From == 0 && r.To == 65535:
+		expr = transport
+	case r.From == r.To:
+		expr = strings.TrimSpace(fmt.Sprintf("%s port %d", transport, r.From))
+	default:
+		expr = strings.TrimSpace(fmt.Sprintf("%s portrange %d-%d", transport, r.From, r.To))
+	}
+
+	var nets []string
+	for _, ipNet := range r.Networks {
+		nets = append(nets, "net "+ipNet.String())
+	}
+	switch {
+	case len(nets) == 0 && expr == "":
+		return "ip or ip6"
+	case len(nets) == 0:
+		return expr
+	case expr == "":
+		return fmt.Sprintf("(%s)", strings.Join(nets, " or "))
+	default:
+		return fmt.Sprintf("(%s and (%s))", expr, strings.Join(nets, " or "))
+	}
+}
+
+func (r PortRange) String() string {
+	ports := fmt.Sprintf("%d-%d", r.From, r.To)
+	if len(r.Networks) == 0 {
+		return ports
+	}
+	var nets []string
+	for _, ipNet := range r.Networks {
+		nets = append(nets, ipNet.String())
+	}
+	return ports + " on " + strings.Join(nets, ",")
+}
+
+// PortRangeMap maps the port ranges to the protocols, for the ports not
+// mapped by the ports of a protocol.
+type PortRangeMap []protocolPortRange
+
+type protocolPortRange struct {
+	proto Protocol
+	PortRange
+}
+
+func (r protocolPortRange) String() string {
+	return fmt.Sprintf("%v:%s", r.PortRange, r.proto)
+}
+
+// BuildPortRangeMap maps the ranges of the protocols. Ranges of different
+// protocols must not overlap.
+func BuildPortRangeMap(ranges map[Protocol][]PortRange) (PortRangeMap, error) {
+	// sort the protocols so that the map is consistent
+	var protos []int
+	for proto := range ranges {
+		protos = append(protos, int(proto))
+	}
+	sort.Ints(protos)
+
+	var res PortRangeMap
+	for _, key := range protos {
+		proto := Protocol(key)
+		for _, r := range ranges[proto] {
+			for _, other := range res {
+				if other.proto != proto && other.Overlaps(r) {
+					return nil, fmt.Errorf("Overlapping port ranges (%v, %v) exist in %s and %s protocols",
+						other.PortRange, r, other.proto, proto)
+				}
+			}
+			res = append(res, protocolPortRange{proto, r})
+		}
+	}
+	return res, nil
+}
+
+// Decide returns the protocol of the range the source or destination of
+// the tuple is in, UnknownProtocol if none.
+func (m PortRangeMap) Decide(tuple *common.IPPortTuple) Protocol {
+	for _, r := range m {
+		if r.Contains(tuple.SrcIP, tuple.SrcPort) {
+			return r.proto
+		}
+	}
+	for _, r := range m {
+		if r.Contains(tuple.DstIP, tuple.DstPort) {
+			return r.proto
+		}
+	}
+	return UnknownProtocol
+}
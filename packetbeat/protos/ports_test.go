@@ -0,0 +1,99 @@
+// +build !integration
+
+package protos
+
+import (
+	"net"
+	"testing"
+
+	"github.com/elastic/beats/libbeat/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parsePortRangesForTests(t *testing.T, ranges ...map[string]interface{}) []PortRange {
+	cfg, err := common.NewConfigFrom(map[string]interface{}{"port_ranges": ranges})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := ParsePortRanges(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestParsePortRanges(t *testing.T) {
+	ranges := parsePortRangesForTests(t,
+		map[string]interface{}{"ports": "9000-9100", "networks": []string{"10.1.2.0/24", "10.1.3.4"}},
+		map[string]interface{}{"ports": 9878},
+		map[string]interface{}{"ports": "*", "networks": []string{"fd00::/8"}},
+	)
+	assert.Len(t, ranges, 3)
+	assert.Equal(t, "9000-9100 on 10.1.2.0/24,10.1.3.4/32", ranges[0].String())
+	assert.Equal(t, "9878-9878", ranges[1].String())
+	assert.Equal(t, "0-65535 on fd00::/8", ranges[2].String())
+
+	cfg, _ := common.NewConfigFrom(map[string]interface{}{})
+	ranges, err := ParsePortRanges(cfg)
+	assert.NoError(t, err)
+	assert.Nil(t, ranges)
+
+	for _, invalid := range []map[string]interface{}{
+		{"ports": "9100-9000"},
+		{"ports": "9000-70000"},
+		{"ports": "fix"},
+		{"ports": "9000", "networks": []string{"10.1.2.0/33"}},
+		{"networks": []string{"10.1.2.0/24"}},
+	} {
+		cfg, _ := common.NewConfigFrom(map[string]interface{}{
+			"port_ranges": []map[string]interface{}{invalid},
+		})
+		_, err := ParsePortRanges(cfg)
+		assert.Error(t, err, "%v", invalid)
+	}
+}
+
+func TestPortRangeMap(t *testing.T) {
+	m, err := BuildPortRangeMap(map[Protocol][]PortRange{
+		1: parsePortRangesForTests(t,
+			map[string]interface{}{"ports": "9000-9100", "networks": []string{"10.1.2.0/24"}}),
+		2: parsePortRangesForTests(t,
+			map[string]interface{}{"ports": "9000-9100", "networks": []string{"10.1.3.0/24"}},
+			map[string]interface{}{"ports": "9050"}),
+	})
+	// the unscoped port 9050 overlaps the ranges of protocol 1
+	assert.Error(t, err)
+
+	m, err = BuildPortRangeMap(map[Protocol][]PortRange{
+		1: parsePortRangesForTests(t,
+			map[string]interface{}{"ports": "9000-9100", "networks": []string{"10.1.2.0/24"}}),
+		2: parsePortRangesForTests(t,
+			map[string]interface{}{"ports": "9000-9100", "networks": []string{"10.1.3.0/24"}},
+			map[string]interface{}{"ports": "9200"}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		server string
+		port   uint16
+		proto  Protocol
+	}{
+		{"10.1.2.7", 9050, 1},
+		{"10.1.3.7", 9050, 2},
+		{"10.1.4.7", 9050, UnknownProtocol},
+		{"10.1.2.7", 9101, UnknownProtocol},
+		{"192.168.0.1", 9200, 2},
+	}
+	for _, test := range tests {
+		// the server is either side of the connection
+		tuple := common.NewIPPortTuple(4,
+			net.ParseIP(test.server), test.port, net.ParseIP("10.9.9.9"), 40000)
+		assert.Equal(t, test.proto, m.Decide(&tuple), "%v:%v", test.server, test.port)
+		tuple = common.NewIPPortTuple(4,
+			net.ParseIP("10.9.9.9"), 40000, net.ParseIP(test.server), test.port)
+		assert.Equal(t, test.proto, m.Decide(&tuple), "%v:%v", test.server, test.port)
+	}
+}
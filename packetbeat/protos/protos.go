@@ -3,6 +3,7 @@ package protos
 import (
 	"errors"
 	"fmt"
+	"reflect"
 	"sort"
 	"strings"
 	"time"
@@ -57,12 +58,13 @@ func validatePorts(ports []int) error {
 }
 
 type Protocols interface {
-	BpfFilter(withVlans bool, withICMP bool) string
+	BpfFilter(withVlans bool, withMPLS bool, withICMP bool) string
 	GetTCP(proto Protocol) TCPPlugin
 	GetUDP(proto Protocol) UDPPlugin
 	GetAll() map[Protocol]Plugin
 	GetAllTCP() map[Protocol]TCPPlugin
 	GetAllUDP() map[Protocol]UDPPlugin
+	GetPortRanges(proto Protocol) []PortRange
 	// Register(proto Protocol, plugin ProtocolPlugin)
 }
 
@@ -71,13 +73,21 @@ type ProtocolsStruct struct {
 	all map[Protocol]Plugin
 	tcp map[Protocol]TCPPlugin
 	udp map[Protocol]UDPPlugin
+
+	// port ranges of the plugins, by protocol
+	ranges map[Protocol][]PortRange
+
+	// configs the plugins are running with, by protocol name
+	configs map[string]*common.Config
 }
 
 // Singleton of Protocols type.
 var Protos = ProtocolsStruct{
-	all: map[Protocol]Plugin{},
-	tcp: map[Protocol]TCPPlugin{},
-	udp: map[Protocol]UDPPlugin{},
+	all:     map[Protocol]Plugin{},
+	tcp:     map[Protocol]TCPPlugin{},
+	udp:     map[Protocol]UDPPlugin{},
+	ranges:  map[Protocol][]PortRange{},
+	configs: map[string]*common.Config{},
 }
 
 func (s ProtocolsStruct) Init(
@@ -90,6 +100,8 @@ func (s ProtocolsStruct) Init(
 	}
 
 	for name, config := range configs {
+		s.configs[name] = config
+
 		// XXX: icmp is special, ignore here :/
 		if name == "icmp" {
 			continue
@@ -112,18 +124,117 @@ func (s ProtocolsStruct) Init(
 			continue
 		}
 
-		inst, err := plugin(testMode, results, config)
+		ranges, err := ParsePortRanges(config)
+		if err != nil {
+			logp.Err("Invalid port ranges for protocol plugin '%v': %v", name, err)
+			return err
+		}
+
+		pluginResults, err := publish.WithEventMetadata(results, config)
+		if err != nil {
+			logp.Err("Invalid fields or tags for protocol plugin '%v': %v", name, err)
+			return err
+		}
+
+		inst, err := plugin(testMode, pluginResults, config)
 		if err != nil {
 			logp.Err("Failed to register protocol plugin: %v", err)
 			return err
 		}
 
 		s.register(proto, inst)
+		s.ranges[proto] = ranges
+	}
+
+	return nil
+}
+
+// Reload applies the reloaded protocol configs to the running plugins
+// implementing Reloader. Enabling or disabling a protocol, or changing the
+// config of other plugins, requires a restart.
+func (s ProtocolsStruct) Reload(
+	results publish.Transactions,
+	configs map[string]*common.Config,
+) error {
+	for name := range s.configs {
+		if _, exists := configs[name]; !exists {
+			logp.Warn("Removing protocol plugin '%v' requires a restart", name)
+		}
+	}
+
+	for name, config := range configs {
+		changed, err := configChanged(s.configs[name], config)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			continue
+		}
+
+		// XXX: icmp is special, not being a plugin
+		if name == "icmp" {
+			logp.Warn("Changing the icmp config requires a restart")
+			continue
+		}
+
+		proto, exists := protocolSyms[name]
+		if !exists {
+			logp.Err("Unknown protocol plugin: %v", name)
+			continue
+		}
+
+		plugin, running := s.all[proto]
+		if !running && !config.Enabled() {
+			s.configs[name] = config
+			continue
+		}
+		if running != config.Enabled() {
+			logp.Warn("Enabling or disabling protocol plugin '%v' requires a restart", name)
+			continue
+		}
+
+		reloader, ok := plugin.(Reloader)
+		if !ok {
+			logp.Warn("Protocol plugin '%v' does not support config reload, "+
+				"its changed config requires a restart", name)
+			continue
+		}
+
+		ranges, err := ParsePortRanges(config)
+		if err != nil {
+			return fmt.Errorf("invalid port ranges for protocol plugin '%v': %v", name, err)
+		}
+		pluginResults, err := publish.WithEventMetadata(results, config)
+		if err != nil {
+			return fmt.Errorf("invalid fields or tags for protocol plugin '%v': %v", name, err)
+		}
+		if err := reloader.Reload(pluginResults, config); err != nil {
+			return fmt.Errorf("reloading protocol plugin '%v' failed: %v", name, err)
+		}
+		s.ranges[proto] = ranges
+		s.configs[name] = config
+		logp.Info("Reloaded protocol plugin '%v'", name)
 	}
 
 	return nil
 }
 
+// configChanged compares the settings of two configs.
+func configChanged(old, config *common.Config) (bool, error) {
+	if old == nil {
+		return true, nil
+	}
+
+	var before, after map[string]interface{}
+	if err := old.Unpack(&before); err != nil {
+		return false, err
+	}
+	if err := config.Unpack(&after); err != nil {
+		return false, err
+	}
+	return !reflect.DeepEqual(before, after), nil
+}
+
 func (s ProtocolsStruct) GetTCP(proto Protocol) TCPPlugin {
 	plugin, exists := s.tcp[proto]
 	if !exists {
@@ -154,11 +265,19 @@ func (s ProtocolsStruct) GetAllUDP() map[Protocol]UDPPlugin {
 	return s.udp
 }
 
+// GetPortRanges returns the port ranges of the protocol.
+func (s ProtocolsStruct) GetPortRanges(proto Protocol) []PortRange {
+	return s.ranges[proto]
+}
+
 // BpfFilter returns a Berkeley Packer Filter (BFP) expression that
 // will match against packets for the registered protocols. If with_vlans is
-// true the filter will match against both IEEE 802.1Q VLAN encapsulated
-// and unencapsulated packets
-func (s ProtocolsStruct) BpfFilter(withVlans bool, withICMP bool) string {
+// true the filter will match against IEEE 802.1Q VLAN encapsulated, QinQ
+// double tagged and unencapsulated packets. If with_mpls is true the filter
+// will match against packets with up to two MPLS labels as well. The vlan and
+// mpls primitives move the offsets for the remainder of the expression, so
+// both can not be combined.
+func (s ProtocolsStruct) BpfFilter(withVlans bool, withMPLS bool, withICMP bool) string {
 	// Sort the protocol IDs so that the return value is consistent.
 	var protos []int
 	for proto := range s.all {
@@ -192,6 +311,24 @@ func (s ProtocolsStruct) BpfFilter(withVlans bool, withICMP bool) string {
 
 			expressions = append(expressions, fmt.Sprintf(expr, port))
 		}
+
+		transport := ""
+		if _, present := s.tcp[proto]; !present {
+			transport = "udp"
+		} else if _, present := s.udp[proto]; !present {
+			transport = "tcp"
+		}
+		for _, r := range s.ranges[proto] {
+			expressions = append(expressions, r.bpfFilter(transport))
+		}
+	}
+
+	// connections on any port are detected by their payload
+	for _, plugin := range s.tcp {
+		if detector, ok := plugin.(TCPDetector); ok && detector.DetectsTCP() {
+			expressions = append(expressions, "tcp")
+			break
+		}
 	}
 
 	if withICMP {
@@ -200,11 +337,21 @@ func (s ProtocolsStruct) BpfFilter(withVlans bool, withICMP bool) string {
 
 	filter := strings.Join(expressions, " or ")
 	if withVlans {
-		filter = fmt.Sprintf("%s or (vlan and (%s))", filter, filter)
+		filter = encapsulatedFilter("vlan", filter)
+	} else if withMPLS {
+		filter = encapsulatedFilter("mpls", filter)
 	}
 	return filter
 }
 
+// encapsulatedFilter extends filter to match against packets with up to two
+// headers matched by primitive. The second header is matched within the
+// first, as the offsets have been moved by the first.
+func encapsulatedFilter(primitive, filter string) string {
+	return fmt.Sprintf("%s or (%s and (%s or (%s and (%s))))",
+		filter, primitive, filter, primitive, filter)
+}
+
 func (s ProtocolsStruct) register(proto Protocol, plugin Plugin) {
 	if _, exists := s.all[proto]; exists {
 		logp.Warn("Protocol (%s) plugin will overwritten by another plugin", proto.String())
@@ -3,6 +3,7 @@
 package protos
 
 import (
+	"net"
 	"testing"
 	"time"
 
@@ -115,34 +116,60 @@ func TestBpfFilterWithoutVlanOnlyIcmp(t *testing.T) {
 	p.tcp = make(map[Protocol]TCPPlugin)
 	p.udp = make(map[Protocol]UDPPlugin)
 
-	filter := p.BpfFilter(false, true)
+	filter := p.BpfFilter(false, false, true)
 	assert.Equal(t, "icmp or icmp6", filter)
 }
 
 func TestBpfFilterWithoutVlanWithoutIcmp(t *testing.T) {
 	p := newProtocols()
-	filter := p.BpfFilter(false, false)
+	filter := p.BpfFilter(false, false, false)
 	assert.Equal(t, "tcp port 80 or udp port 5060 or port 53", filter)
 }
 
 func TestBpfFilterWithVlanWithoutIcmp(t *testing.T) {
 	p := newProtocols()
-	filter := p.BpfFilter(true, false)
+	filter := p.BpfFilter(true, false, false)
 	assert.Equal(t, "tcp port 80 or udp port 5060 or port 53 or "+
-		"(vlan and (tcp port 80 or udp port 5060 or port 53))", filter)
+		"(vlan and (tcp port 80 or udp port 5060 or port 53 or "+
+		"(vlan and (tcp port 80 or udp port 5060 or port 53))))", filter)
 }
 
 func TestBpfFilterWithoutVlanWithIcmp(t *testing.T) {
 	p := newProtocols()
-	filter := p.BpfFilter(false, true)
+	filter := p.BpfFilter(false, false, true)
 	assert.Equal(t, "tcp port 80 or udp port 5060 or port 53 or icmp or icmp6", filter)
 }
 
 func TestBpfFilterWithVlanWithIcmp(t *testing.T) {
 	p := newProtocols()
-	filter := p.BpfFilter(true, true)
+	filter := p.BpfFilter(true, false, true)
 	assert.Equal(t, "tcp port 80 or udp port 5060 or port 53 or icmp or icmp6 or "+
-		"(vlan and (tcp port 80 or udp port 5060 or port 53 or icmp or icmp6))", filter)
+		"(vlan and (tcp port 80 or udp port 5060 or port 53 or icmp or icmp6 or "+
+		"(vlan and (tcp port 80 or udp port 5060 or port 53 or icmp or icmp6))))", filter)
+}
+
+func TestBpfFilterWithMPLS(t *testing.T) {
+	p := newProtocols()
+	filter := p.BpfFilter(false, true, false)
+	assert.Equal(t, "tcp port 80 or udp port 5060 or port 53 or "+
+		"(mpls and (tcp port 80 or udp port 5060 or port 53 or "+
+		"(mpls and (tcp port 80 or udp port 5060 or port 53))))", filter)
+}
+
+func TestBpfFilterWithPortRanges(t *testing.T) {
+	p := newProtocols().(ProtocolsStruct)
+	p.ranges = map[Protocol][]PortRange{
+		1: {{From: 9000, To: 9100, Networks: []*net.IPNet{
+			{IP: net.IP{10, 1, 2, 0}, Mask: net.CIDRMask(24, 32)},
+		}}},
+		2: {{From: 6000, To: 6000}},
+		3: {{From: 0, To: 65535, Networks: []*net.IPNet{
+			{IP: net.IP{10, 1, 3, 4}, Mask: net.CIDRMask(32, 32)},
+		}}},
+	}
+	filter := p.BpfFilter(false, false, false)
+	assert.Equal(t, "tcp port 80 or (tcp portrange 9000-9100 and (net 10.1.2.0/24)) or "+
+		"udp port 5060 or udp port 6000 or port 53 or (net 10.1.3.4/32)", filter)
 }
 
 func TestGetAll(t *testing.T) {
@@ -196,3 +223,56 @@ func TestGetUDP(t *testing.T) {
 	assert.NotNil(t, udp)
 	assert.Contains(t, udp.GetPorts(), 53)
 }
+
+type reloadableProtocol struct {
+	TCPProtocol
+	reloads int
+}
+
+func (proto *reloadableProtocol) Reload(results publish.Transactions, cfg *common.Config) error {
+	var config struct {
+		Ports []int `config:"ports"`
+	}
+	if err := cfg.Unpack(&config); err != nil {
+		return err
+	}
+	proto.Ports = config.Ports
+	proto.reloads++
+	return nil
+}
+
+func TestReload(t *testing.T) {
+	Register("reloadtest", func(bool, publish.Transactions, *common.Config) (Plugin, error) {
+		return &reloadableProtocol{TCPProtocol: TCPProtocol{Ports: []int{80}}}, nil
+	})
+	Register("statictest", func(bool, publish.Transactions, *common.Config) (Plugin, error) {
+		return &TCPProtocol{Ports: []int{90}}, nil
+	})
+
+	p := ProtocolsStruct{
+		all:     map[Protocol]Plugin{},
+		tcp:     map[Protocol]TCPPlugin{},
+		udp:     map[Protocol]UDPPlugin{},
+		ranges:  map[Protocol][]PortRange{},
+		configs: map[string]*common.Config{},
+	}
+	newConfigs := func(reloadPorts, staticPorts []int) map[string]*common.Config {
+		reload, _ := common.NewConfigFrom(map[string]interface{}{"ports": reloadPorts})
+		static, _ := common.NewConfigFrom(map[string]interface{}{"ports": staticPorts})
+		return map[string]*common.Config{"reloadtest": reload, "statictest": static}
+	}
+	results := &publish.ChanTransactions{}
+	if err := p.Init(false, results, newConfigs([]int{80}, []int{90})); err != nil {
+		t.Fatal(err)
+	}
+	reloadable := p.all[Lookup("reloadtest")].(*reloadableProtocol)
+
+	// unchanged configs are not reloaded
+	assert.NoError(t, p.Reload(results, newConfigs([]int{80}, []int{90})))
+	assert.Equal(t, 0, reloadable.reloads)
+
+	assert.NoError(t, p.Reload(results, newConfigs([]int{8080}, []int{9090})))
+	assert.Equal(t, 1, reloadable.reloads)
+	assert.Equal(t, []int{8080}, p.all[Lookup("reloadtest")].GetPorts())
+	assert.Equal(t, []int{90}, p.all[Lookup("statictest")].GetPorts())
+}
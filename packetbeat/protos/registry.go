@@ -40,6 +40,67 @@ type TCPPlugin interface {
 	ConnectionTimeout() time.Duration
 }
 
+// TCPFlusher is implemented by TCP plugins publishing the state of open
+// connections on shutdown. Connections of plugins not implementing it are
+// ended by ReceivedFin in both directions instead.
+type TCPFlusher interface {
+	// Called for each open connection when the capture is stopped.
+	Flush(tcptuple *common.TCPTuple, private ProtocolData) ProtocolData
+}
+
+// TCPExpirer is implemented by TCP plugins publishing the state of the
+// connections expired, idle for longer than the connection timeout.
+type TCPExpirer interface {
+	// Called for each connection expired, which is not followed anymore.
+	Expired(tcptuple *common.TCPTuple, private ProtocolData)
+}
+
+// TCPDetector is implemented by TCP plugins recognizing their traffic on
+// connections not mapped to a protocol by port. While any detector is
+// enabled, all TCP traffic is captured.
+type TCPDetector interface {
+	// Called to check whether detection is enabled.
+	DetectsTCP() bool
+
+	// Called with the packets of connections not followed yet, until a
+	// plugin claims the connection. The private data returned starts the
+	// state of the connection claimed.
+	DetectTCP(pkt *Packet) (private ProtocolData, ok bool)
+}
+
+// TCPObserver is implemented by TCP plugins following the TCP state of their
+// connections, like the windows advertised and the data acknowledged.
+type TCPObserver interface {
+	// Called for every segment of the connections of the plugin, also the
+	// segments without payload and retransmitted, before the payload is
+	// parsed.
+	ObserveTCP(tcptuple *common.TCPTuple, dir uint8, seg *TCPSegment,
+		private ProtocolData) ProtocolData
+}
+
+// TCPSegment holds the header of a TCP segment passed to the TCPObservers.
+type TCPSegment struct {
+	Ts       time.Time
+	Seq, Ack uint32
+
+	// window advertised, not scaled. WindowScale is the shift of the window
+	// scale option, set in SYN segments if HasWindowScale.
+	Window         uint16
+	WindowScale    uint8
+	HasWindowScale bool
+
+	SYN, ACK, FIN, RST bool
+	PayloadLen         int
+}
+
+// Reloader is implemented by plugins applying a reloaded config while
+// running. The state of the open connections must be kept, the config
+// applying to the packets parsed next. On error the plugin must keep its
+// previous config.
+type Reloader interface {
+	Reload(results publish.Transactions, cfg *common.Config) error
+}
+
 type UDPPlugin interface {
 	Plugin
 
@@ -21,10 +21,15 @@ const (
 	TCPDirectionOriginal = 1
 )
 
+// kind of the window scale option, RFC 7323
+const tcpOptionWindowScale = 3
+
 type TCP struct {
 	id        uint32
 	streams   *common.Cache
+	cleanedUp time.Time // last removal of the connections expired
 	portMap   map[uint16]protos.Protocol
+	ranges    protos.PortRangeMap
 	protocols protos.Protocols
 }
 
@@ -65,7 +70,28 @@ func (tcp *TCP) decideProtocol(tuple *common.IPPortTuple) protos.Protocol {
 		return protocol
 	}
 
-	return protos.UnknownProtocol
+	return tcp.ranges.Decide(tuple)
+}
+
+// detectProtocol asks the plugins detecting their traffic to claim a
+// connection not mapped by port, from the payload of its packet.
+func (tcp *TCP) detectProtocol(pkt *protos.Packet) (protos.Protocol, protos.ProtocolData) {
+	if len(pkt.Payload) == 0 {
+		return protos.UnknownProtocol, nil
+	}
+	for proto, plugin := range tcp.protocols.GetAllTCP() {
+		detector, ok := plugin.(protos.TCPDetector)
+		if !ok || !detector.DetectsTCP() {
+			continue
+		}
+		if data, ok := detector.DetectTCP(pkt); ok {
+			if isDebug {
+				debugf("Detected %s on connection %s", proto, pkt.Tuple.String())
+			}
+			return proto, data
+		}
+	}
+	return protos.UnknownProtocol, nil
 }
 
 func (tcp *TCP) findStream(k common.HashableIPPortTuple) *TCPConnection {
@@ -120,6 +146,36 @@ func (stream *TCPStream) addPacket(pkt *protos.Packet, tcphdr *layers.TCP) {
 	}
 }
 
+// observe passes the header of the segment to the plugin if it follows the
+// TCP state of its connections.
+func (stream *TCPStream) observe(pkt *protos.Packet, tcphdr *layers.TCP) {
+	conn := stream.conn
+	observer, ok := conn.tcp.protocols.GetTCP(conn.protocol).(protos.TCPObserver)
+	if !ok {
+		return
+	}
+
+	seg := protos.TCPSegment{
+		Ts:         pkt.Ts,
+		Seq:        tcphdr.Seq,
+		Ack:        tcphdr.Ack,
+		Window:     tcphdr.Window,
+		SYN:        tcphdr.SYN,
+		ACK:        tcphdr.ACK,
+		FIN:        tcphdr.FIN,
+		RST:        tcphdr.RST,
+		PayloadLen: len(pkt.Payload),
+	}
+	if tcphdr.SYN {
+		for _, opt := range tcphdr.Options {
+			if opt.OptionType == tcpOptionWindowScale && len(opt.OptionData) == 1 {
+				seg.WindowScale, seg.HasWindowScale = opt.OptionData[0], true
+			}
+		}
+	}
+	conn.data = observer.ObserveTCP(&conn.tcptuple, stream.dir, &seg, conn.data)
+}
+
 func (stream *TCPStream) gapInStream(nbytes int) (drop bool) {
 	conn := stream.conn
 	mod := conn.tcp.protocols.GetTCP(conn.protocol)
@@ -132,6 +188,8 @@ func (tcp *TCP) Process(id *flows.FlowID, tcphdr *layers.TCP, pkt *protos.Packet
 	// protocol modules.
 	defer logp.Recover("Process tcp exception")
 
+	tcp.expireConnections(time.Now())
+
 	stream, created := tcp.getStream(pkt)
 	if stream.conn == nil {
 		return
@@ -146,6 +204,8 @@ func (tcp *TCP) Process(id *flows.FlowID, tcphdr *layers.TCP, pkt *protos.Packet
 		debugf("tcp flow id: %p", id)
 	}
 
+	stream.observe(pkt, tcphdr)
+
 	if len(pkt.Payload) == 0 && !tcphdr.FIN {
 		// return early if packet is not interesting. Still need to find/create
 		// stream first in order to update the TCP stream timer
@@ -208,6 +268,49 @@ func (tcp *TCP) Process(id *flows.FlowID, tcphdr *layers.TCP, pkt *protos.Packet
 	stream.addPacket(pkt, tcphdr)
 }
 
+// Flush ends all connections still followed, so the data buffered by the
+// protocol plugins is published before shutdown.
+func (tcp *TCP) Flush() {
+	defer logp.Recover("Flush tcp exception")
+
+	tcp.streams.CleanUp()
+	for k, v := range tcp.streams.Entries() {
+		conn := v.(*TCPConnection)
+		tcp.streams.Delete(k)
+
+		mod := tcp.protocols.GetTCP(conn.protocol)
+		if mod == nil {
+			continue
+		}
+		if flusher, ok := mod.(protos.TCPFlusher); ok {
+			conn.data = flusher.Flush(&conn.tcptuple, conn.data)
+			continue
+		}
+		conn.data = mod.ReceivedFin(&conn.tcptuple, TCPDirectionOriginal, conn.data)
+		conn.data = mod.ReceivedFin(&conn.tcptuple, TCPDirectionReverse, conn.data)
+	}
+}
+
+// expireConnections removes the connections expired, every expiration
+// period. Connections are expired by the goroutine processing the packets,
+// so that the plugins are not called concurrently.
+func (tcp *TCP) expireConnections(now time.Time) {
+	if now.Sub(tcp.cleanedUp) < protos.DefaultTransactionExpiration {
+		return
+	}
+	tcp.cleanedUp = now
+	tcp.streams.CleanUp()
+}
+
+// expired passes the connection expired to its plugin, if it publishes the
+// state of expired connections.
+func (tcp *TCP) expired(k common.Key, v common.Value) {
+	conn := v.(*TCPConnection)
+	if expirer, ok := tcp.protocols.GetTCP(conn.protocol).(protos.TCPExpirer); ok {
+		expirer.Expired(&conn.tcptuple, conn.data)
+	}
+}
+
 func (tcp *TCP) getStream(pkt *protos.Packet) (stream TCPStream, created bool) {
 	if conn := tcp.findStream(pkt.Tuple.Hashable()); conn != nil {
 		return TCPStream{conn: conn, dir: TCPDirectionOriginal}, false
@@ -218,6 +321,10 @@ func (tcp *TCP) getStream(pkt *protos.Packet) (stream TCPStream, created bool) {
 	}
 
 	protocol := tcp.decideProtocol(&pkt.Tuple)
+	var data protos.ProtocolData
+	if protocol == protos.UnknownProtocol {
+		protocol, data = tcp.detectProtocol(pkt)
+	}
 	if protocol == protos.UnknownProtocol {
 		// don't follow
 		return TCPStream{}, false
@@ -240,7 +347,8 @@ func (tcp *TCP) getStream(pkt *protos.Packet) (stream TCPStream, created bool) {
 		id:       tcp.getID(),
 		tuple:    &pkt.Tuple,
 		protocol: protocol,
-		tcp:      tcp}
+		tcp:      tcp,
+		data:     data}
 	conn.tcptuple = common.TCPTupleFromIPPort(conn.tuple, conn.id)
 	tcp.streams.PutWithTimeout(pkt.Tuple.Hashable(), conn, timeout)
 	return TCPStream{conn: conn, dir: TCPDirectionOriginal}, true
@@ -294,18 +402,54 @@ func NewTCP(p protos.Protocols) (*TCP, error) {
 	if err != nil {
 		return nil, err
 	}
+	ranges, err := buildPortRanges(p)
+	if err != nil {
+		return nil, err
+	}
 
 	tcp := &TCP{
 		protocols: p,
 		portMap:   portMap,
-		streams: common.NewCache(
-			protos.DefaultTransactionExpiration,
-			protos.DefaultTransactionHashSize),
+		ranges:    ranges,
+		cleanedUp: time.Now(),
 	}
-	tcp.streams.StartJanitor(protos.DefaultTransactionExpiration)
+	tcp.streams = common.NewCacheWithRemovalListener(
+		protos.DefaultTransactionExpiration,
+		protos.DefaultTransactionHashSize,
+		tcp.expired)
 	if isDebug {
 		debugf("tcp", "Port map: %v", portMap)
+		debugf("Port ranges: %v", ranges)
 	}
 
 	return tcp, nil
 }
+
+// UpdatePorts maps the ports to the protocols again, after the ports of the
+// plugins have been reloaded. Open connections keep their protocol.
+func (tcp *TCP) UpdatePorts() error {
+	portMap, err := buildPortsMap(tcp.protocols.GetAllTCP())
+	if err != nil {
+		return err
+	}
+	ranges, err := buildPortRanges(tcp.protocols)
+	if err != nil {
+		return err
+	}
+	tcp.portMap = portMap
+	tcp.ranges = ranges
+	if isDebug {
+		debugf("Port map: %v", portMap)
+		debugf("Port ranges: %v", ranges)
+	}
+	return nil
+}
+
+// buildPortRanges maps the port ranges of the TCP plugins to the protocols.
+func buildPortRanges(p protos.Protocols) (protos.PortRangeMap, error) {
+	ranges := map[protos.Protocol][]protos.PortRange{}
+	for proto := range p.GetAllTCP() {
+		ranges[proto] = p.GetPortRanges(proto)
+	}
+	return protos.BuildPortRangeMap(ranges)
+}
@@ -171,19 +171,21 @@ func Test_configToPortsMap_negative(t *testing.T) {
 
 // Mock protos.Protocols used for testing the tcp package.
 type protocols struct {
-	tcp map[protos.Protocol]protos.TCPPlugin
+	tcp    map[protos.Protocol]protos.TCPPlugin
+	ranges map[protos.Protocol][]protos.PortRange
 }
 
 // Verify protocols implements the protos.Protocols interface.
 var _ protos.Protocols = &protocols{}
 
-func (p protocols) BpfFilter(withVlans bool, withICMP bool) string       { return "" }
-func (p protocols) GetTCP(proto protos.Protocol) protos.TCPPlugin        { return p.tcp[proto] }
-func (p protocols) GetUDP(proto protos.Protocol) protos.UDPPlugin        { return nil }
-func (p protocols) GetAll() map[protos.Protocol]protos.Plugin            { return nil }
-func (p protocols) GetAllTCP() map[protos.Protocol]protos.TCPPlugin      { return p.tcp }
-func (p protocols) GetAllUDP() map[protos.Protocol]protos.UDPPlugin      { return nil }
-func (p protocols) Register(proto protos.Protocol, plugin protos.Plugin) { return }
+func (p protocols) BpfFilter(withVlans, withMPLS, withICMP bool) string    { return "" }
+func (p protocols) GetTCP(proto protos.Protocol) protos.TCPPlugin          { return p.tcp[proto] }
+func (p protocols) GetUDP(proto protos.Protocol) protos.UDPPlugin          { return nil }
+func (p protocols) GetAll() map[protos.Protocol]protos.Plugin              { return nil }
+func (p protocols) GetAllTCP() map[protos.Protocol]protos.TCPPlugin        { return p.tcp }
+func (p protocols) GetAllUDP() map[protos.Protocol]protos.UDPPlugin        { return nil }
+func (p protocols) GetPortRanges(proto protos.Protocol) []protos.PortRange { return p.ranges[proto] }
+func (p protocols) Register(proto protos.Protocol, plugin protos.Plugin)   { return }
 
 func TestTCSeqPayload(t *testing.T) {
 	type segment struct {
@@ -309,6 +311,211 @@ func TestTCSeqPayload(t *testing.T) {
 	}
 }
 
+func TestFlushEndsConnections(t *testing.T) {
+	var fins []uint8
+	tcp, err := NewTCP(protocols{
+		tcp: map[protos.Protocol]protos.TCPPlugin{
+			httpProtocol: &TestProtocol{
+				Ports: []int{ServerPort},
+				parse: makeCollectPayload(new([]byte), true),
+				onFin: func(t *common.TCPTuple, d uint8, p protos.ProtocolData) protos.ProtocolData {
+					fins = append(fins, d)
+					return p
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := common.NewIPPortTuple(4,
+		net.ParseIP(ServerIP), ServerPort,
+		net.ParseIP(ClientIP), uint16(rand.Intn(65535)))
+	pkt := &protos.Packet{Ts: time.Now(), Tuple: addr, Payload: []byte{1, 2, 3}}
+	tcp.Process(nil, &layers.TCP{Seq: 1}, pkt)
+
+	tcp.Flush()
+	assert.Equal(t, []uint8{TCPDirectionOriginal, TCPDirectionReverse}, fins)
+	assert.Equal(t, 0, len(tcp.streams.Entries()))
+}
+
+// expiringProtocol records the connections expired.
+type expiringProtocol struct {
+	TestProtocol
+	expired []protos.ProtocolData
+}
+
+func (proto *expiringProtocol) ConnectionTimeout() time.Duration {
+	return 50 * time.Millisecond
+}
+
+func (proto *expiringProtocol) Expired(t *common.TCPTuple, priv protos.ProtocolData) {
+	proto.expired = append(proto.expired, priv)
+}
+
+func TestExpiredConnections(t *testing.T) {
+	plugin := &expiringProtocol{TestProtocol: TestProtocol{
+		Ports: []int{ServerPort},
+		parse: func(p *protos.Packet, t *common.TCPTuple, d uint8, priv protos.ProtocolData) protos.ProtocolData {
+			return "state"
+		},
+	}}
+	tcp, err := NewTCP(protocols{
+		tcp: map[protos.Protocol]protos.TCPPlugin{httpProtocol: plugin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idle := common.NewIPPortTuple(4,
+		net.ParseIP(ClientIP), 34567,
+		net.ParseIP(ServerIP), ServerPort)
+	tcp.Process(nil, &layers.TCP{Seq: 1}, &protos.Packet{Ts: time.Now(), Tuple: idle, Payload: []byte{1}})
+	time.Sleep(60 * time.Millisecond)
+
+	// connections are expired by the next packet once the period elapsed
+	active := common.NewIPPortTuple(4,
+		net.ParseIP(ClientIP), 34568,
+		net.ParseIP(ServerIP), ServerPort)
+	tcp.Process(nil, &layers.TCP{Seq: 1}, &protos.Packet{Ts: time.Now(), Tuple: active, Payload: []byte{1}})
+	assert.Empty(t, plugin.expired)
+
+	tcp.cleanedUp = time.Time{}
+	tcp.Process(nil, &layers.TCP{Seq: 2}, &protos.Packet{Ts: time.Now(), Tuple: active, Payload: []byte{1}})
+	assert.Equal(t, []protos.ProtocolData{"state"}, plugin.expired)
+}
+
+func TestUpdatePorts(t *testing.T) {
+	plugin := &TestProtocol{Ports: []int{ServerPort}}
+	tcp, err := NewTCP(protocols{
+		tcp: map[protos.Protocol]protos.TCPPlugin{httpProtocol: plugin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tuple := common.NewIPPortTuple(4,
+		net.ParseIP(ServerIP), 8080,
+		net.ParseIP(ClientIP), 34567)
+	assert.Equal(t, protos.UnknownProtocol, tcp.decideProtocol(&tuple))
+
+	plugin.Ports = []int{8080}
+	assert.NoError(t, tcp.UpdatePorts())
+	assert.Equal(t, httpProtocol, tcp.decideProtocol(&tuple))
+}
+
+func TestDecideProtocolByPortRange(t *testing.T) {
+	_, network, _ := net.ParseCIDR(ServerIP + "/24")
+	tcp, err := NewTCP(protocols{
+		tcp: map[protos.Protocol]protos.TCPPlugin{httpProtocol: &TestProtocol{Ports: []int{ServerPort}}},
+		ranges: map[protos.Protocol][]protos.PortRange{
+			httpProtocol: {{From: 9000, To: 9100, Networks: []*net.IPNet{network}}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tuple := common.NewIPPortTuple(4,
+		net.ParseIP(ClientIP), 34567,
+		net.ParseIP(ServerIP), 9050)
+	assert.Equal(t, httpProtocol, tcp.decideProtocol(&tuple))
+
+	tuple = common.NewIPPortTuple(4,
+		net.ParseIP(ClientIP), 34567,
+		net.ParseIP(ServerIP), 9200)
+	assert.Equal(t, protos.UnknownProtocol, tcp.decideProtocol(&tuple))
+}
+
+// detectingProtocol claims the connections sending "HELLO".
+type detectingProtocol struct {
+	TestProtocol
+}
+
+func (proto *detectingProtocol) DetectsTCP() bool { return true }
+
+func (proto *detectingProtocol) DetectTCP(pkt *protos.Packet) (protos.ProtocolData, bool) {
+	return "detected", string(pkt.Payload) == "HELLO"
+}
+
+func TestDetectProtocol(t *testing.T) {
+	var parsed []protos.ProtocolData
+	plugin := &detectingProtocol{TestProtocol{
+		parse: func(p *protos.Packet, t *common.TCPTuple, d uint8, priv protos.ProtocolData) protos.ProtocolData {
+			parsed = append(parsed, priv)
+			return priv
+		},
+	}}
+	tcp, err := NewTCP(protocols{
+		tcp: map[protos.Protocol]protos.TCPPlugin{httpProtocol: plugin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seq := uint32(100)
+	for _, payload := range []string{"GET", "HELLO", "WORLD"} {
+		tcp.Process(nil, &layers.TCP{Seq: seq}, &protos.Packet{
+			Ts: time.Now(),
+			Tuple: common.NewIPPortTuple(4,
+				net.ParseIP(ClientIP), 34567,
+				net.ParseIP(ServerIP), 9123),
+			Payload: []byte(payload),
+		})
+		seq += uint32(len(payload))
+	}
+	// the connection is followed once claimed, with the private data returned
+	assert.Equal(t, []protos.ProtocolData{"detected", "detected"}, parsed)
+}
+
+// observingProtocol records the segments of its connections.
+type observingProtocol struct {
+	TestProtocol
+	segments []protos.TCPSegment
+}
+
+func (proto *observingProtocol) ObserveTCP(t *common.TCPTuple, d uint8, seg *protos.TCPSegment,
+	priv protos.ProtocolData) protos.ProtocolData {
+	proto.segments = append(proto.segments, *seg)
+	return priv
+}
+
+func TestObserveSegments(t *testing.T) {
+	plugin := &observingProtocol{TestProtocol: TestProtocol{
+		Ports: []int{ServerPort},
+		parse: makeCollectPayload(new([]byte), true),
+	}}
+	tcp, err := NewTCP(protocols{
+		tcp: map[protos.Protocol]protos.TCPPlugin{httpProtocol: plugin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := common.NewIPPortTuple(4,
+		net.ParseIP(ClientIP), 34567,
+		net.ParseIP(ServerIP), ServerPort)
+	server := common.NewIPPortTuple(4,
+		net.ParseIP(ServerIP), ServerPort,
+		net.ParseIP(ClientIP), 34567)
+	ts := time.Now()
+	tcp.Process(nil, &layers.TCP{SYN: true, Seq: 99, Window: 1024, Options: []layers.TCPOption{
+		{OptionType: tcpOptionWindowScale, OptionLength: 3, OptionData: []byte{7}},
+	}}, &protos.Packet{Ts: ts, Tuple: client})
+	tcp.Process(nil, &layers.TCP{Seq: 100, Ack: 500, ACK: true, Window: 1024},
+		&protos.Packet{Ts: ts, Tuple: client, Payload: []byte("data")})
+	// segments without payload are observed too
+	tcp.Process(nil, &layers.TCP{Seq: 500, Ack: 104, ACK: true},
+		&protos.Packet{Ts: ts, Tuple: server})
+
+	assert.Equal(t, []protos.TCPSegment{
+		{Ts: ts, Seq: 99, Window: 1024, WindowScale: 7, HasWindowScale: true, SYN: true},
+		{Ts: ts, Seq: 100, Ack: 500, Window: 1024, ACK: true, PayloadLen: 4},
+		{Ts: ts, Seq: 500, Ack: 104, ACK: true},
+	}, plugin.segments)
+}
+
 // Benchmark that runs with parallelism to help find concurrency related
 // issues. To run with parallelism, the 'go test' cpu flag must be set
 // greater than 1, otherwise it just runs concurrently but not in parallel.
@@ -0,0 +1,179 @@
+package tlsdecrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"encoding/binary"
+	"errors"
+	"hash"
+)
+
+var (
+	errBadRecordMAC = errors.New("TLS record authentication failed, wrong key")
+	errBadRecord    = errors.New("invalid encrypted TLS record")
+)
+
+// recordCipher decrypts the records sent by one side of a session.
+type recordCipher struct {
+	version uint16
+	seq     uint64
+
+	// CBC suites
+	block cipher.Block
+	mac   hash.Hash
+	// IV of the next record for TLS 1.0, the last ciphertext block of the
+	// previous record
+	iv []byte
+
+	// AEAD suites
+	aead    cipher.AEAD
+	fixedIV []byte
+}
+
+func newRecordCipher(suite *cipherSuite, version uint16, macKey, key, iv []byte) (*recordCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &recordCipher{version: version}
+	if suite.aead() {
+		if c.aead, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+		c.fixedIV = iv
+		return c, nil
+	}
+
+	c.block = block
+	c.mac = hmac.New(suite.mac, macKey)
+	c.iv = append([]byte(nil), iv...)
+	return c, nil
+}
+
+// newRecordCipher13 returns the cipher of a TLS 1.3 traffic secret.
+func newRecordCipher13(suite *cipherSuite, secret []byte) (*recordCipher, error) {
+	key := hkdfExpandLabel(suite.prfHash, secret, "key", suite.keyLen)
+	iv := hkdfExpandLabel(suite.prfHash, secret, "iv", suite.ivLen)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &recordCipher{version: versionTLS13, aead: aead, fixedIV: iv}, nil
+}
+
+// decrypt returns the content type and plaintext of a record, given the
+// record header.
+func (c *recordCipher) decrypt(header, payload []byte) (uint8, []byte, error) {
+	typ := header[0]
+	var plaintext []byte
+	var err error
+	switch {
+	case c.version == versionTLS13:
+		typ, plaintext, err = c.open13(header, payload)
+	case c.aead != nil:
+		plaintext, err = c.openGCM(header, payload)
+	default:
+		plaintext, err = c.openCBC(header, payload)
+	}
+	c.seq++
+	return typ, plaintext, err
+}
+
+// open13 decrypts TLS 1.3 records, hiding the content type after the
+// plaintext, followed by padding (RFC 8446 section 5.2).
+func (c *recordCipher) open13(header, payload []byte) (uint8, []byte, error) {
+	nonce := append([]byte(nil), c.fixedIV...)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(c.seq >> uint(8*i))
+	}
+	plaintext, err := c.aead.Open(nil, nonce, payload, header)
+	if err != nil {
+		return 0, nil, errBadRecordMAC
+	}
+
+	end := len(plaintext) - 1
+	for end >= 0 && plaintext[end] == 0 {
+		end--
+	}
+	if end < 0 {
+		return 0, nil, errBadRecord
+	}
+	return plaintext[end], plaintext[:end], nil
+}
+
+// openGCM decrypts records of TLS 1.2 GCM suites, carrying an explicit nonce
+// before the ciphertext (RFC 5288).
+func (c *recordCipher) openGCM(header, payload []byte) ([]byte, error) {
+	const explicitNonceLen = 8
+	if len(payload) < explicitNonceLen+c.aead.Overhead() {
+		return nil, errBadRecord
+	}
+
+	nonce := concat(c.fixedIV, payload[:explicitNonceLen])
+	ciphertext := payload[explicitNonceLen:]
+	aad := c.additionalData(header, len(ciphertext)-c.aead.Overhead())
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, errBadRecordMAC
+	}
+	return plaintext, nil
+}
+
+// openCBC decrypts records of CBC suites and checks the MAC of the
+// plaintext. The IV is sent with each record since TLS 1.1.
+func (c *recordCipher) openCBC(header, payload []byte) ([]byte, error) {
+	blockSize := c.block.BlockSize()
+	iv := c.iv
+	if c.version >= versionTLS11 {
+		if len(payload) < blockSize {
+			return nil, errBadRecord
+		}
+		iv, payload = payload[:blockSize], payload[blockSize:]
+	}
+	if len(payload) == 0 || len(payload)%blockSize != 0 {
+		return nil, errBadRecord
+	}
+
+	plaintext := make([]byte, len(payload))
+	cipher.NewCBCDecrypter(c.block, iv).CryptBlocks(plaintext, payload)
+	if c.version < versionTLS11 {
+		c.iv = append(c.iv[:0], payload[len(payload)-blockSize:]...)
+	}
+
+	padding := int(plaintext[len(plaintext)-1]) + 1
+	macSize := c.mac.Size()
+	if padding+macSize > len(plaintext) {
+		return nil, errBadRecordMAC
+	}
+	for _, b := range plaintext[len(plaintext)-padding:] {
+		if int(b) != padding-1 {
+			return nil, errBadRecordMAC
+		}
+	}
+	plaintext = plaintext[:len(plaintext)-padding]
+
+	content, mac := plaintext[:len(plaintext)-macSize], plaintext[len(plaintext)-macSize:]
+	c.mac.Reset()
+	c.mac.Write(c.additionalData(header, len(content)))
+	c.mac.Write(content)
+	if !hmac.Equal(mac, c.mac.Sum(nil)) {
+		return nil, errBadRecordMAC
+	}
+	return content, nil
+}
+
+// additionalData returns the sequence number and header of a record, with
+// the length of the plaintext, authenticated by the MAC or AEAD.
+func (c *recordCipher) additionalData(header []byte, length int) []byte {
+	var data [13]byte
+	binary.BigEndian.PutUint64(data[:8], c.seq)
+	copy(data[8:11], header[:3])
+	binary.BigEndian.PutUint16(data[11:], uint16(length))
+	return data[:]
+}
@@ -0,0 +1,18 @@
+package tlsdecrypt
+
+// Config selects the keys TLS sessions are decrypted with.
+type Config struct {
+	// PEM encoded RSA private keys of the servers, decrypting the sessions
+	// using RSA key exchange
+	PrivateKeys   []string `config:"private_keys"`
+	KeyPassphrase string   `config:"key_passphrase"`
+
+	// NSS key log file holding the secrets of the sessions, decrypting
+	// sessions of all key exchanges and TLS 1.3
+	KeyLogFile string `config:"key_log_file"`
+}
+
+// Enabled returns true if keys to decrypt sessions with are configured.
+func (c *Config) Enabled() bool {
+	return len(c.PrivateKeys) > 0 || c.KeyLogFile != ""
+}
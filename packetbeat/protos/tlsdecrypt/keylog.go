@@ -0,0 +1,130 @@
+package tlsdecrypt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// Labels of the NSS key log format secrets used.
+const (
+	labelClientRandom                 = "CLIENT_RANDOM"
+	labelClientHandshakeTrafficSecret = "CLIENT_HANDSHAKE_TRAFFIC_SECRET"
+	labelServerHandshakeTrafficSecret = "SERVER_HANDSHAKE_TRAFFIC_SECRET"
+	labelClientTrafficSecret          = "CLIENT_TRAFFIC_SECRET_0"
+	labelServerTrafficSecret          = "SERVER_TRAFFIC_SECRET_0"
+)
+
+// maxKeyLogSecrets limits the number of secrets kept in memory. All secrets
+// read are forgotten when full.
+const maxKeyLogSecrets = 100000
+
+// keyLog reads the secrets of TLS sessions from a key log file in the NSS
+// format, as written by applications supporting SSLKEYLOGFILE. Lines hold a
+// label, the client random of the session and the secret, hex encoded:
+//
+//	CLIENT_RANDOM <client random> <master secret>
+//	CLIENT_TRAFFIC_SECRET_0 <client random> <secret>
+//
+// The file is read again when a secret is not found, as applications append
+// the secrets of new sessions. Files truncated or replaced are read from the
+// start.
+type keyLog struct {
+	path string
+
+	mutex   sync.Mutex
+	file    os.FileInfo
+	offset  int64
+	partial []byte
+	secrets map[string][]byte
+}
+
+func newKeyLog(path string) *keyLog {
+	l := &keyLog{path: path, secrets: map[string][]byte{}}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if err := l.update(); err != nil {
+		logp.Warn("Failed to read TLS key log file %s: %v", path, err)
+	}
+	return l
+}
+
+// lookup returns the secret of a session by label and client random.
+func (l *keyLog) lookup(label string, clientRandom []byte) ([]byte, bool) {
+	key := label + " " + string(clientRandom)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if secret, found := l.secrets[key]; found {
+		return secret, true
+	}
+	if err := l.update(); err != nil {
+		debugf("failed to read TLS key log file %s: %v", l.path, err)
+	}
+	secret, found := l.secrets[key]
+	return secret, found
+}
+
+// update reads the lines appended to the file since the last update.
+func (l *keyLog) update() error {
+	f, err := os.Open(l.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if l.file == nil || !os.SameFile(l.file, info) || info.Size() < l.offset {
+		l.offset = 0
+		l.partial = nil
+	}
+	l.file = info
+	if info.Size() == l.offset {
+		return nil
+	}
+
+	if _, err := f.Seek(l.offset, io.SeekStart); err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	l.offset += int64(len(data))
+
+	data = append(l.partial, data...)
+	end := bytes.LastIndexByte(data, '\n')
+	l.partial = append([]byte(nil), data[end+1:]...)
+	for _, line := range bytes.Split(data[:end+1], []byte{'\n'}) {
+		l.parseLine(line)
+	}
+	return nil
+}
+
+func (l *keyLog) parseLine(line []byte) {
+	fields := bytes.Fields(line)
+	if len(fields) != 3 || fields[0][0] == '#' {
+		return
+	}
+	clientRandom, err := hex.DecodeString(string(fields[1]))
+	if err != nil || len(clientRandom) != 32 {
+		return
+	}
+	secret, err := hex.DecodeString(string(fields[2]))
+	if err != nil {
+		return
+	}
+
+	if len(l.secrets) >= maxKeyLogSecrets {
+		l.secrets = map[string][]byte{}
+	}
+	l.secrets[string(fields[0])+" "+string(clientRandom)] = secret
+}
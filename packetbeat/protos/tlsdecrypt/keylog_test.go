@@ -0,0 +1,71 @@
+// +build !integration
+
+package tlsdecrypt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keylog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sslkeys.log")
+
+	random1 := bytes.Repeat([]byte{1}, 32)
+	random2 := bytes.Repeat([]byte{2}, 32)
+	line1 := "CLIENT_RANDOM " + strings.Repeat("01", 32) + " aabb\n"
+	line2 := "CLIENT_TRAFFIC_SECRET_0 " + strings.Repeat("02", 32) + " ccdd\n"
+
+	// the file does not exist yet
+	l := newKeyLog(path)
+	_, found := l.lookup(labelClientRandom, random1)
+	assert.False(t, found)
+
+	// comments, invalid lines and a partial line
+	content := "# SSL/TLS secrets log file\ninvalid\n" + line1 + line2[:20]
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	secret, found := l.lookup(labelClientRandom, random1)
+	assert.True(t, found)
+	assert.Equal(t, []byte{0xaa, 0xbb}, secret)
+	_, found = l.lookup(labelClientTrafficSecret, random2)
+	assert.False(t, found)
+
+	// appended
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(line2[20:])
+	f.Close()
+	secret, found = l.lookup(labelClientTrafficSecret, random2)
+	assert.True(t, found)
+	assert.Equal(t, []byte{0xcc, 0xdd}, secret)
+
+	// replaced by a shorter file
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	line3 := "CLIENT_RANDOM " + strings.Repeat("03", 32) + " eeff\n"
+	if err := ioutil.WriteFile(path, []byte(line3), 0600); err != nil {
+		t.Fatal(err)
+	}
+	secret, found = l.lookup(labelClientRandom, bytes.Repeat([]byte{3}, 32))
+	assert.True(t, found)
+	assert.Equal(t, []byte{0xee, 0xff}, secret)
+
+	// secrets read before are kept
+	_, found = l.lookup(labelClientRandom, random1)
+	assert.True(t, found)
+}
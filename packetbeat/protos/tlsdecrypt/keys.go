@@ -0,0 +1,124 @@
+package tlsdecrypt
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/paths"
+)
+
+// maxSessionCacheSize limits the number of master secrets kept for session
+// resumption. The cache is cleared when full.
+const maxSessionCacheSize = 10000
+
+// Keys holds the private keys of the servers, the key log file and the
+// master secrets of the sessions seen, so that resumed sessions can be
+// decrypted too. Keys are shared by all sessions.
+type Keys struct {
+	privateKeys []*rsa.PrivateKey
+	keyLog      *keyLog
+
+	mutex sync.Mutex
+	// master secrets by session ID or session ticket
+	sessions map[string][]byte
+}
+
+// NewKeys loads the private keys configured and reads the key log file. The
+// key log file is read again when secrets are looked up.
+func NewKeys(config *Config) (*Keys, error) {
+	k := &Keys{sessions: map[string][]byte{}}
+	for _, path := range config.PrivateKeys {
+		path = paths.Resolve(paths.Config, path)
+		key, err := loadPrivateKey(path, config.KeyPassphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS private key %s: %v", path, err)
+		}
+		k.privateKeys = append(k.privateKeys, key)
+		logp.Info("Loaded TLS private key from: %s", path)
+	}
+	if config.KeyLogFile != "" {
+		path := paths.Resolve(paths.Config, config.KeyLogFile)
+		k.keyLog = newKeyLog(path)
+		logp.Info("Reading TLS secrets from key log file: %s", path)
+	}
+	return k, nil
+}
+
+// NewSession returns the decryption state of a new TCP connection.
+func (k *Keys) NewSession() *Session {
+	return &Session{keys: k, clientDir: -1}
+}
+
+func loadPrivateKey(path, passphrase string) (*rsa.PrivateKey, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		var block *pem.Block
+		block, content = pem.Decode(content)
+		if block == nil {
+			return nil, errors.New("no RSA private key found")
+		}
+
+		der := block.Bytes
+		if x509.IsEncryptedPEMBlock(block) {
+			if passphrase == "" {
+				return nil, errors.New("key is encrypted, but no passphrase is configured")
+			}
+			if der, err = x509.DecryptPEMBlock(block, []byte(passphrase)); err != nil {
+				return nil, err
+			}
+		}
+
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			return x509.ParsePKCS1PrivateKey(der)
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(der)
+			if err != nil {
+				return nil, err
+			}
+			rsaKey, ok := key.(*rsa.PrivateKey)
+			if !ok {
+				return nil, errors.New("not an RSA private key")
+			}
+			return rsaKey, nil
+		}
+	}
+}
+
+// decryptPreMasterSecret decrypts the premaster secret sent by the client
+// with the RSA public key of the server. All keys are tried, as the
+// certificate of the server might not have been captured.
+func (k *Keys) decryptPreMasterSecret(ciphertext []byte) ([]byte, bool) {
+	for _, key := range k.privateKeys {
+		preMasterSecret, err := rsa.DecryptPKCS1v15(nil, key, ciphertext)
+		if err == nil && len(preMasterSecret) == preMasterSecretLen {
+			return preMasterSecret, true
+		}
+	}
+	return nil, false
+}
+
+func (k *Keys) masterSecret(id []byte) []byte {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return k.sessions[string(id)]
+}
+
+func (k *Keys) addSession(id, masterSecret []byte) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if len(k.sessions) >= maxSessionCacheSize {
+		k.sessions = map[string][]byte{}
+	}
+	k.sessions[string(id)] = masterSecret
+}
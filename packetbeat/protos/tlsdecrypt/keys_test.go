@@ -0,0 +1,64 @@
+// +build !integration
+
+package tlsdecrypt
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewKeys(t *testing.T) {
+	loadTestKey(t)
+	dir, err := ioutil.TempDir("", "tlsdecrypt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := x509.EncryptPEMBlock(rand.Reader, "RSA PRIVATE KEY",
+		x509.MarshalPKCS1PrivateKey(testKey), []byte("secret"), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]*pem.Block{
+		"pkcs1.pem":     {Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(testKey)},
+		"pkcs8.pem":     {Type: "PRIVATE KEY", Bytes: pkcs8},
+		"encrypted.pem": encrypted,
+		"cert.pem":      {Type: "CERTIFICATE", Bytes: testCert.Certificate[0]},
+	}
+	for name, block := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys, err := NewKeys(&Config{
+		PrivateKeys: []string{
+			filepath.Join(dir, "pkcs1.pem"),
+			filepath.Join(dir, "pkcs8.pem"),
+			filepath.Join(dir, "encrypted.pem"),
+		},
+		KeyPassphrase: "secret",
+	})
+	if assert.NoError(t, err) && assert.Len(t, keys.privateKeys, 3) {
+		for _, key := range keys.privateKeys {
+			assert.Equal(t, testKey.N, key.N)
+		}
+	}
+
+	_, err = NewKeys(&Config{PrivateKeys: []string{filepath.Join(dir, "encrypted.pem")}})
+	assert.Error(t, err)
+	_, err = NewKeys(&Config{PrivateKeys: []string{filepath.Join(dir, "cert.pem")}})
+	assert.Error(t, err)
+}
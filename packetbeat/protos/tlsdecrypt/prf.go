@@ -0,0 +1,117 @@
+package tlsdecrypt
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"hash"
+)
+
+const (
+	masterSecretLen    = 48
+	preMasterSecretLen = 48
+)
+
+var (
+	masterSecretLabel         = []byte("master secret")
+	extendedMasterSecretLabel = []byte("extended master secret")
+	keyExpansionLabel         = []byte("key expansion")
+)
+
+type prfFunc func(result, secret, label, seed []byte)
+
+// pHash implements P_hash of RFC 5246, section 5.
+func pHash(result, secret, seed []byte, h func() hash.Hash) {
+	mac := hmac.New(h, secret)
+	mac.Write(seed)
+	a := mac.Sum(nil)
+
+	for n := 0; n < len(result); {
+		mac.Reset()
+		mac.Write(a)
+		mac.Write(seed)
+		n += copy(result[n:], mac.Sum(nil))
+
+		mac.Reset()
+		mac.Write(a)
+		a = mac.Sum(nil)
+	}
+}
+
+// prf10 is the PRF of TLS 1.0 and 1.1, RFC 2246 section 5.
+func prf10(result, secret, label, seed []byte) {
+	labelAndSeed := concat(label, seed)
+	s1 := secret[:(len(secret)+1)/2]
+	s2 := secret[len(secret)/2:]
+
+	pHash(result, s1, labelAndSeed, md5.New)
+	result2 := make([]byte, len(result))
+	pHash(result2, s2, labelAndSeed, sha1.New)
+	for i, b := range result2 {
+		result[i] ^= b
+	}
+}
+
+// prf12 returns the PRF of TLS 1.2 using the hash of the cipher suite, RFC
+// 5246 section 5.
+func prf12(h func() hash.Hash) prfFunc {
+	return func(result, secret, label, seed []byte) {
+		pHash(result, secret, concat(label, seed), h)
+	}
+}
+
+// hkdfExpandLabel derives TLS 1.3 keys and secrets from a traffic secret,
+// RFC 8446 section 7.1. Contexts are always empty for the keys used.
+func hkdfExpandLabel(h func() hash.Hash, secret []byte, label string, length int) []byte {
+	info := []byte{byte(length >> 8), byte(length), byte(len("tls13 ") + len(label))}
+	info = append(info, "tls13 "+label...)
+	info = append(info, 0)
+
+	// HKDF-Expand, RFC 5869 section 2.3
+	mac := hmac.New(h, secret)
+	var result, t []byte
+	for i := byte(1); len(result) < length; i++ {
+		mac.Reset()
+		mac.Write(t)
+		mac.Write(info)
+		mac.Write([]byte{i})
+		t = mac.Sum(nil)
+		result = append(result, t...)
+	}
+	return result[:length]
+}
+
+// md5SHA1Hash hashes the handshake messages of TLS 1.0 and 1.1 sessions, for
+// the extended master secret.
+type md5SHA1Hash struct {
+	md5, sha1 hash.Hash
+}
+
+func newMD5SHA1Hash() hash.Hash {
+	return &md5SHA1Hash{md5.New(), sha1.New()}
+}
+
+func (h *md5SHA1Hash) Write(p []byte) (int, error) {
+	h.md5.Write(p)
+	return h.sha1.Write(p)
+}
+
+func (h *md5SHA1Hash) Sum(b []byte) []byte {
+	return h.sha1.Sum(h.md5.Sum(b))
+}
+
+func (h *md5SHA1Hash) Reset() {
+	h.md5.Reset()
+	h.sha1.Reset()
+}
+
+func (h *md5SHA1Hash) Size() int      { return md5.Size + sha1.Size }
+func (h *md5SHA1Hash) BlockSize() int { return sha1.BlockSize }
+
+func concat(slices ...[]byte) []byte {
+	var b []byte
+	for _, s := range slices {
+		b = append(b, s...)
+	}
+	return b
+}
@@ -0,0 +1,645 @@
+package tlsdecrypt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+const (
+	recordTypeChangeCipherSpec = 20
+	recordTypeAlert            = 21
+	recordTypeHandshake        = 22
+	recordTypeApplicationData  = 23
+	recordTypeHeartbeat        = 24
+
+	recordHeaderLen = 5
+	// maximum length of an encrypted record, RFC 5246 section 6.2.3
+	maxCiphertextLen = 1<<14 + 2048
+	// certificate chains are the largest handshake messages
+	maxHandshakeLen = 1 << 18
+	// records buffered per direction while waiting for secrets to be
+	// logged
+	maxPendingLen = 1 << 20
+)
+
+const (
+	handshakeTypeHelloRequest      = 0
+	handshakeTypeClientHello       = 1
+	handshakeTypeServerHello       = 2
+	handshakeTypeNewSessionTicket  = 4
+	handshakeTypeClientKeyExchange = 16
+	handshakeTypeFinished          = 20
+	handshakeTypeKeyUpdate         = 24
+)
+
+const (
+	extensionExtendedMasterSecret = 0x0017
+	extensionSessionTicket        = 0x0023
+	extensionSupportedVersions    = 0x002b
+)
+
+var (
+	errNoHandshake     = errors.New("TLS handshake not captured")
+	errUnknownSession  = errors.New("resumed TLS session not captured")
+	errNoPrivateKey    = errors.New("no private key decrypts the TLS premaster secret")
+	errForwardSecrecy  = errors.New("TLS session using (EC)DHE key exchange needs a key log file")
+	errNoKeyLog        = errors.New("TLS 1.3 session needs a key log file")
+	errSecretNotLogged = errors.New("TLS session secrets not found in key log file")
+	errEarlyData       = errors.New("TLS 1.3 early data not supported")
+	errGap             = errors.New("TLS records lost in capture gap")
+	errBadHandshake    = errors.New("invalid TLS handshake message")
+	errBadRecordLen    = errors.New("invalid TLS record length")
+
+	// errWaitForSecret delays records until their secrets are logged, as
+	// applications might log them after the records have been captured
+	errWaitForSecret = errors.New("waiting for TLS secret")
+)
+
+// helloRetryRequestRandom is the random of ServerHello messages asking
+// TLS 1.3 clients for another ClientHello.
+var helloRetryRequestRandom = sha256.Sum256([]byte("HelloRetryRequest"))
+
+var debugf = logp.MakeDebug("tlsdecrypt")
+
+// Session decrypts the records of a TLS connection, returning the
+// application data sent by either side. TLS 1.2 and earlier sessions are
+// decrypted using the premaster secret sent by the client in the
+// ClientKeyExchange, decrypted with the private key of the server. This only
+// works for cipher suites using RSA key exchange, not for (EC)DHE key
+// exchange providing forward secrecy. Sessions of all key exchanges, and
+// TLS 1.3 sessions, are decrypted with the secrets read from the key log
+// file instead.
+//
+// The handshake must have been captured, or the handshake of the session
+// resumed. Errors are final, the session can not be decrypted any further.
+type Session struct {
+	keys *Keys
+	err  error
+
+	// direction sending the ClientHello, -1 until seen
+	clientDir int
+
+	version uint16
+	suite   *cipherSuite
+
+	clientRandom, serverRandom []byte
+	// session ID and ticket offered by the client for resumption
+	sessionID, ticket []byte
+	// session ID and ticket issued by the server, for later resumption
+	serverSessionID, newTicket []byte
+	extendedMasterSecret       bool
+
+	// handshake messages up to the ClientKeyExchange, hashed for the
+	// extended master secret
+	transcript []byte
+	recording  bool
+
+	masterSecret           []byte
+	clientKeys, serverKeys trafficKeys
+	// reason the master secret is not known, if not found in the key log
+	keyErr error
+
+	dirs [2]direction
+}
+
+type trafficKeys struct {
+	mac, key, iv []byte
+}
+
+type direction struct {
+	err error
+
+	// incomplete record and handshake messages
+	buf       []byte
+	handshake []byte
+
+	// nil until ChangeCipherSpec
+	cipher *recordCipher
+
+	// TLS 1.3 key log label of the traffic secret protecting the next
+	// records, until found, and the current traffic secret, for KeyUpdate
+	nextSecret string
+	secret     []byte
+}
+
+// IsRecord checks if data starts like a TLS record, to detect TLS sessions.
+func IsRecord(data []byte) bool {
+	return len(data) >= 3 &&
+		data[0] >= recordTypeChangeCipherSpec && data[0] <= recordTypeHeartbeat &&
+		data[1] == 3 && data[2] <= 4
+}
+
+// Version returns the name of the TLS version negotiated, like TLSv1.2, or
+// an empty string if not known.
+func (s *Session) Version() string {
+	return versionName(s.version)
+}
+
+// CipherSuite returns the name of the cipher suite negotiated, or an empty
+// string if it is not known or not supported.
+func (s *Session) CipherSuite() string {
+	if s.suite == nil {
+		return ""
+	}
+	return s.suite.name
+}
+
+// Process decrypts the records sent in one direction of the TCP connection
+// and returns the application data. Incomplete records are buffered until
+// the next call.
+func (s *Session) Process(dir uint8, data []byte) ([]byte, error) {
+	d := &s.dirs[dir]
+	if s.err != nil {
+		return nil, s.err
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	d.buf = append(d.buf, data...)
+	var plaintext []byte
+	for len(d.buf) >= recordHeaderLen {
+		length := int(binary.BigEndian.Uint16(d.buf[3:5]))
+		if !IsRecord(d.buf) || length > maxCiphertextLen {
+			s.err = errBadRecordLen
+			return nil, s.err
+		}
+		if len(d.buf) < recordHeaderLen+length {
+			break
+		}
+
+		header := d.buf[:recordHeaderLen]
+		payload := d.buf[recordHeaderLen : recordHeaderLen+length]
+		content, err := s.record(dir, header, payload)
+		if err == errWaitForSecret {
+			if len(d.buf) > maxPendingLen {
+				s.err = errSecretNotLogged
+				return nil, s.err
+			}
+			debugf("waiting for TLS secrets, %v bytes buffered", len(d.buf))
+			break
+		}
+		if err != nil {
+			s.err = err
+			return nil, err
+		}
+		d.buf = d.buf[recordHeaderLen+length:]
+		plaintext = append(plaintext, content...)
+	}
+
+	// copy incomplete records, not to keep the data processed
+	d.buf = append([]byte(nil), d.buf...)
+	return plaintext, nil
+}
+
+// Gap stops decrypting a direction of the connection after data has been
+// lost, as records can not be found again.
+func (s *Session) Gap(dir uint8) {
+	s.dirs[dir].err = errGap
+}
+
+// record handles a record and returns its application data, if any.
+// Records are not modified before errWaitForSecret is returned, so that they
+// can be handled again.
+func (s *Session) record(dir uint8, header, payload []byte) ([]byte, error) {
+	d := &s.dirs[dir]
+	typ := header[0]
+	if d.cipher == nil && d.nextSecret != "" && typ == recordTypeApplicationData {
+		if err := s.lookupTrafficSecret(dir); err != nil {
+			return nil, err
+		}
+	}
+	if d.cipher != nil {
+		var err error
+		if typ, payload, err = d.cipher.decrypt(header, payload); err != nil {
+			return nil, err
+		}
+	}
+
+	switch typ {
+	case recordTypeChangeCipherSpec:
+		return nil, s.changeCipherSpec(dir)
+	case recordTypeHandshake:
+		return nil, s.handshake(dir, payload)
+	case recordTypeApplicationData:
+		if d.cipher == nil {
+			if int(dir) == s.clientDir && s.serverRandom == nil {
+				return nil, errEarlyData
+			}
+			return nil, errNoHandshake
+		}
+		return payload, nil
+	}
+	return nil, nil
+}
+
+// handshake reassembles handshake messages, as they can span records.
+func (s *Session) handshake(dir uint8, data []byte) error {
+	d := &s.dirs[dir]
+	d.handshake = append(d.handshake, data...)
+	for len(d.handshake) >= 4 {
+		length := int(d.handshake[1])<<16 | int(d.handshake[2])<<8 | int(d.handshake[3])
+		if length > maxHandshakeLen {
+			return errBadHandshake
+		}
+		if len(d.handshake) < 4+length {
+			break
+		}
+
+		msg := d.handshake[:4+length]
+		d.handshake = d.handshake[4+length:]
+		if err := s.onHandshake(dir, msg); err != nil {
+			return err
+		}
+	}
+
+	d.handshake = append([]byte(nil), d.handshake...)
+	return nil
+}
+
+func (s *Session) onHandshake(dir uint8, msg []byte) error {
+	typ, body := msg[0], msg[4:]
+	if typ == handshakeTypeClientHello {
+		s.transcript = nil
+		s.recording = true
+	}
+	if s.recording && typ != handshakeTypeHelloRequest {
+		s.transcript = append(s.transcript, msg...)
+	}
+
+	if s.version == versionTLS13 {
+		switch typ {
+		case handshakeTypeClientHello:
+			return s.onClientHello(dir, body)
+		case handshakeTypeFinished:
+			return s.onFinished13(dir)
+		case handshakeTypeKeyUpdate:
+			return s.onKeyUpdate(dir)
+		}
+		return nil
+	}
+
+	switch typ {
+	case handshakeTypeClientHello:
+		return s.onClientHello(dir, body)
+	case handshakeTypeServerHello:
+		return s.onServerHello(body)
+	case handshakeTypeNewSessionTicket:
+		return s.onNewSessionTicket(body)
+	case handshakeTypeClientKeyExchange:
+		return s.onClientKeyExchange(body)
+	}
+	return nil
+}
+
+func (s *Session) onClientHello(dir uint8, body []byte) error {
+	if len(body) < 34 {
+		return errBadHandshake
+	}
+
+	// a new handshake, the current keys remain in use until ChangeCipherSpec
+	*s = Session{
+		keys:      s.keys,
+		clientDir: int(dir),
+		dirs:      s.dirs,
+
+		transcript: s.transcript,
+		recording:  true,
+
+		clientRandom: append([]byte(nil), body[2:34]...),
+	}
+
+	sessionID, rest, ok := readVector(body[34:], 1)
+	if !ok {
+		return errBadHandshake
+	}
+	s.sessionID = append([]byte(nil), sessionID...)
+	if _, rest, ok = readVector(rest, 2); !ok { // cipher suites
+		return errBadHandshake
+	}
+	if _, rest, ok = readVector(rest, 1); !ok { // compression methods
+		return errBadHandshake
+	}
+	return forEachExtension(rest, func(typ uint16, data []byte) {
+		if typ == extensionSessionTicket && len(data) > 0 {
+			s.ticket = append([]byte(nil), data...)
+		}
+	})
+}
+
+func (s *Session) onServerHello(body []byte) error {
+	if s.clientRandom == nil {
+		return errNoHandshake
+	}
+	if len(body) < 34 {
+		return errBadHandshake
+	}
+
+	s.version = binary.BigEndian.Uint16(body[:2])
+	s.serverRandom = append([]byte(nil), body[2:34]...)
+	sessionID, rest, ok := readVector(body[34:], 1)
+	if !ok || len(rest) < 3 {
+		return errBadHandshake
+	}
+	s.serverSessionID = append([]byte(nil), sessionID...)
+	suite := binary.BigEndian.Uint16(rest[:2])
+
+	err := forEachExtension(rest[3:], func(typ uint16, data []byte) {
+		switch typ {
+		case extensionExtendedMasterSecret:
+			s.extendedMasterSecret = true
+		case extensionSupportedVersions:
+			if len(data) == 2 {
+				s.version = binary.BigEndian.Uint16(data)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.version < versionTLS10 || s.version > versionTLS13 {
+		return fmt.Errorf("TLS version 0x%04x not supported", s.version)
+	}
+	s.suite = cipherSuites[suite]
+	if s.suite == nil || (s.suite.kx == keyExchangeTLS13) != (s.version == versionTLS13) {
+		return fmt.Errorf("TLS cipher suite 0x%04x not supported", suite)
+	}
+
+	if s.version == versionTLS13 {
+		return s.onServerHello13()
+	}
+
+	// the server accepts resumption by echoing the session ID of the client
+	if len(sessionID) > 0 && bytes.Equal(sessionID, s.sessionID) {
+		s.recording = false
+		s.transcript = nil
+		masterSecret := s.keys.masterSecret(sessionID)
+		if masterSecret == nil && s.ticket != nil {
+			masterSecret = s.keys.masterSecret(s.ticket)
+		}
+		if masterSecret == nil {
+			// the key log might still hold the master secret
+			s.keyErr = errUnknownSession
+			return nil
+		}
+		s.setMasterSecret(masterSecret)
+	}
+	return nil
+}
+
+// onServerHello13 expects the following records of both directions to be
+// protected by the handshake traffic secrets.
+func (s *Session) onServerHello13() error {
+	s.recording = false
+	s.transcript = nil
+	if s.keys.keyLog == nil {
+		return errNoKeyLog
+	}
+	if bytes.Equal(s.serverRandom, helloRetryRequestRandom[:]) {
+		// the client sends another ClientHello
+		return nil
+	}
+
+	s.dirs[s.clientDir].nextSecret = labelClientHandshakeTrafficSecret
+	s.dirs[1-s.clientDir].nextSecret = labelServerHandshakeTrafficSecret
+	return nil
+}
+
+// onFinished13 expects the following records to be protected by the
+// application traffic secret, once the handshake of a direction is done.
+func (s *Session) onFinished13(dir uint8) error {
+	d := &s.dirs[dir]
+	d.cipher = nil
+	if int(dir) == s.clientDir {
+		d.nextSecret = labelClientTrafficSecret
+	} else {
+		d.nextSecret = labelServerTrafficSecret
+	}
+	return nil
+}
+
+// onKeyUpdate derives the next application traffic secret of a direction,
+// RFC 8446 section 7.2.
+func (s *Session) onKeyUpdate(dir uint8) error {
+	d := &s.dirs[dir]
+	if d.secret == nil {
+		return errBadHandshake
+	}
+	secret := hkdfExpandLabel(s.suite.prfHash, d.secret, "traffic upd", s.suite.prfHash().Size())
+	return s.setTrafficSecret(dir, secret)
+}
+
+// lookupTrafficSecret looks up the TLS 1.3 traffic secret of a direction in
+// the key log.
+func (s *Session) lookupTrafficSecret(dir uint8) error {
+	secret, found := s.keys.keyLog.lookup(s.dirs[dir].nextSecret, s.clientRandom)
+	if !found {
+		return errWaitForSecret
+	}
+	return s.setTrafficSecret(dir, secret)
+}
+
+func (s *Session) setTrafficSecret(dir uint8, secret []byte) error {
+	cipher, err := newRecordCipher13(s.suite, secret)
+	if err != nil {
+		return err
+	}
+	d := &s.dirs[dir]
+	d.cipher, d.secret, d.nextSecret = cipher, secret, ""
+	return nil
+}
+
+func (s *Session) onNewSessionTicket(body []byte) error {
+	if len(body) < 4 {
+		return errBadHandshake
+	}
+	ticket, _, ok := readVector(body[4:], 2)
+	if !ok {
+		return errBadHandshake
+	}
+	s.newTicket = append([]byte(nil), ticket...)
+	if s.masterSecret != nil {
+		s.keys.addSession(s.newTicket, s.masterSecret)
+	}
+	return nil
+}
+
+// onClientKeyExchange decrypts the premaster secret encrypted by the client
+// with the public key of the server, and derives the master secret. Other
+// key exchanges need the master secret logged in the key log.
+func (s *Session) onClientKeyExchange(body []byte) error {
+	if s.suite == nil {
+		return errNoHandshake
+	}
+	s.recording = false
+	if s.suite.kx != keyExchangeRSA {
+		s.keyErr = errForwardSecrecy
+		s.transcript = nil
+		return nil
+	}
+
+	ciphertext, _, ok := readVector(body, 2)
+	if !ok {
+		return errBadHandshake
+	}
+	preMasterSecret, ok := s.keys.decryptPreMasterSecret(ciphertext)
+	if !ok {
+		s.keyErr = errNoPrivateKey
+		s.transcript = nil
+		return nil
+	}
+
+	masterSecret := make([]byte, masterSecretLen)
+	if s.extendedMasterSecret {
+		h := s.transcriptHash()
+		h.Write(s.transcript)
+		s.prf()(masterSecret, preMasterSecret, extendedMasterSecretLabel, h.Sum(nil))
+	} else {
+		s.prf()(masterSecret, preMasterSecret, masterSecretLabel,
+			concat(s.clientRandom, s.serverRandom))
+	}
+	s.transcript = nil
+
+	s.setMasterSecret(masterSecret)
+	s.addSession()
+	return nil
+}
+
+// lookupMasterSecret looks up the master secret of a session not decrypted
+// by a private key in the key log.
+func (s *Session) lookupMasterSecret() error {
+	if s.suite == nil {
+		return errNoHandshake
+	}
+	if s.keys.keyLog == nil {
+		if s.keyErr != nil {
+			return s.keyErr
+		}
+		return errNoHandshake
+	}
+
+	masterSecret, found := s.keys.keyLog.lookup(labelClientRandom, s.clientRandom)
+	if !found {
+		return errWaitForSecret
+	}
+	s.setMasterSecret(masterSecret)
+	s.addSession()
+	return nil
+}
+
+// addSession remembers the master secret for the resumption of the session.
+func (s *Session) addSession() {
+	if len(s.serverSessionID) > 0 {
+		s.keys.addSession(s.serverSessionID, s.masterSecret)
+	}
+	if s.newTicket != nil {
+		s.keys.addSession(s.newTicket, s.masterSecret)
+	}
+}
+
+// setMasterSecret derives the keys of both directions from the master
+// secret, RFC 5246 section 6.3.
+func (s *Session) setMasterSecret(masterSecret []byte) {
+	s.masterSecret = masterSecret
+
+	suite := s.suite
+	macLen := 0
+	if !suite.aead() {
+		macLen = suite.mac().Size()
+	}
+	keyBlock := make([]byte, 2*(macLen+suite.keyLen+suite.ivLen))
+	s.prf()(keyBlock, masterSecret, keyExpansionLabel, concat(s.serverRandom, s.clientRandom))
+
+	next := func(n int) []byte {
+		b := keyBlock[:n]
+		keyBlock = keyBlock[n:]
+		return b
+	}
+	s.clientKeys.mac, s.serverKeys.mac = next(macLen), next(macLen)
+	s.clientKeys.key, s.serverKeys.key = next(suite.keyLen), next(suite.keyLen)
+	s.clientKeys.iv, s.serverKeys.iv = next(suite.ivLen), next(suite.ivLen)
+}
+
+// changeCipherSpec switches a direction to the keys negotiated. TLS 1.3
+// sends ChangeCipherSpec for middlebox compatibility only.
+func (s *Session) changeCipherSpec(dir uint8) error {
+	if s.version == versionTLS13 {
+		return nil
+	}
+	if s.masterSecret == nil {
+		if err := s.lookupMasterSecret(); err != nil {
+			return err
+		}
+	}
+
+	keys := &s.serverKeys
+	if int(dir) == s.clientDir {
+		keys = &s.clientKeys
+	}
+	cipher, err := newRecordCipher(s.suite, s.version, keys.mac, keys.key, keys.iv)
+	if err != nil {
+		return err
+	}
+	s.dirs[dir].cipher = cipher
+	return nil
+}
+
+func (s *Session) prf() prfFunc {
+	if s.version >= versionTLS12 {
+		return prf12(s.suite.prfHash)
+	}
+	return prf10
+}
+
+func (s *Session) transcriptHash() hash.Hash {
+	if s.version >= versionTLS12 {
+		return s.suite.prfHash()
+	}
+	return newMD5SHA1Hash()
+}
+
+// readVector reads a vector prefixed by its length in n bytes.
+func readVector(data []byte, n int) (vector, rest []byte, ok bool) {
+	if len(data) < n {
+		return nil, nil, false
+	}
+	length := 0
+	for _, b := range data[:n] {
+		length = length<<8 | int(b)
+	}
+	if len(data) < n+length {
+		return nil, nil, false
+	}
+	return data[n : n+length], data[n+length:], true
+}
+
+// forEachExtension calls f for each extension of a hello message. The
+// extensions are optional.
+func forEachExtension(data []byte, f func(typ uint16, data []byte)) error {
+	if len(data) == 0 {
+		return nil
+	}
+	extensions, _, ok := readVector(data, 2)
+	if !ok {
+		return errBadHandshake
+	}
+	for len(extensions) > 0 {
+		if len(extensions) < 4 {
+			return errBadHandshake
+		}
+		typ := binary.BigEndian.Uint16(extensions[:2])
+		var extension []byte
+		if extension, extensions, ok = readVector(extensions[2:], 2); !ok {
+			return errBadHandshake
+		}
+		f(typ, extension)
+	}
+	return nil
+}
@@ -0,0 +1,344 @@
+// +build !integration
+
+package tlsdecrypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testRequest  = "8=FIX.4.4\x019=5\x0135=0\x0110=163\x01"
+	testResponse = "8=FIX.4.4\x019=5\x0135=1\x0110=164\x01"
+)
+
+var (
+	testKeyOnce sync.Once
+	testKey     *rsa.PrivateKey
+	testCert    tls.Certificate
+)
+
+// segment is data written by one side of a TLS connection
+type segment struct {
+	dir  uint8
+	data []byte
+}
+
+// capture records the data written by both sides of a connection, in order
+type capture struct {
+	mutex    sync.Mutex
+	segments []segment
+}
+
+type captureConn struct {
+	net.Conn
+	dir     uint8
+	capture *capture
+}
+
+func (c *captureConn) Write(b []byte) (int, error) {
+	c.capture.mutex.Lock()
+	c.capture.segments = append(c.capture.segments, segment{c.dir, append([]byte(nil), b...)})
+	c.capture.mutex.Unlock()
+	return c.Conn.Write(b)
+}
+
+func TestDecryptRSA(t *testing.T) {
+	tests := []struct {
+		version uint16
+		suite   uint16
+	}{
+		{tls.VersionTLS12, tls.TLS_RSA_WITH_AES_128_GCM_SHA256},
+		{tls.VersionTLS12, tls.TLS_RSA_WITH_AES_256_GCM_SHA384},
+		{tls.VersionTLS12, tls.TLS_RSA_WITH_AES_128_CBC_SHA},
+		{tls.VersionTLS12, tls.TLS_RSA_WITH_AES_256_CBC_SHA},
+		{tls.VersionTLS12, tls.TLS_RSA_WITH_AES_128_CBC_SHA256},
+		{tls.VersionTLS11, tls.TLS_RSA_WITH_AES_128_CBC_SHA},
+		{tls.VersionTLS10, tls.TLS_RSA_WITH_AES_256_CBC_SHA},
+	}
+
+	keys := newTestKeys(t)
+	for _, test := range tests {
+		name := tls.CipherSuiteName(test.suite)
+		c := runTestSession(t, test.version, test.suite, nil, nil)
+		session := keys.NewSession()
+		plaintext, err := decryptCapture(session, c)
+		if assert.NoError(t, err, name) {
+			assert.Equal(t, testRequest, string(plaintext[0]), name)
+			assert.Equal(t, testResponse, string(plaintext[1]), name)
+			assert.Equal(t, versionName(test.version), session.Version(), name)
+			assert.Equal(t, name, session.CipherSuite(), name)
+		}
+	}
+}
+
+func TestDecryptResumedSession(t *testing.T) {
+	keys := newTestKeys(t)
+	cache := tls.NewLRUClientSessionCache(1)
+	suite := tls.TLS_RSA_WITH_AES_128_GCM_SHA256
+
+	first := runTestSession(t, tls.VersionTLS12, suite, cache, nil)
+	resumed := runTestSession(t, tls.VersionTLS12, suite, cache, nil)
+
+	// resumed sessions can not be decrypted without the first handshake
+	_, err := decryptCapture(keys.NewSession(), resumed)
+	assert.Equal(t, errUnknownSession, err)
+
+	_, err = decryptCapture(keys.NewSession(), first)
+	assert.NoError(t, err)
+	plaintext, err := decryptCapture(keys.NewSession(), resumed)
+	if assert.NoError(t, err) {
+		assert.Equal(t, testRequest, string(plaintext[0]))
+	}
+}
+
+func TestDecryptErrors(t *testing.T) {
+	keys := newTestKeys(t)
+	c := runTestSession(t, tls.VersionTLS12, tls.TLS_RSA_WITH_AES_128_GCM_SHA256, nil, nil)
+
+	// another server key
+	otherKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := &Keys{privateKeys: []*rsa.PrivateKey{otherKey}, sessions: map[string][]byte{}}
+	_, err = decryptCapture(other.NewSession(), c)
+	assert.Equal(t, errNoPrivateKey, err)
+
+	// capture started after the handshake
+	session := keys.NewSession()
+	for _, seg := range c.segments {
+		if seg.data[0] == recordTypeApplicationData {
+			_, err = session.Process(seg.dir, seg.data)
+			break
+		}
+	}
+	assert.Equal(t, errNoHandshake, err)
+
+	// records lost
+	session = keys.NewSession()
+	session.Gap(0)
+	_, err = decryptCapture(session, c)
+	assert.Equal(t, errGap, err)
+
+	// forward secrecy
+	c = runTestSession(t, tls.VersionTLS12, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, nil, nil)
+	_, err = decryptCapture(keys.NewSession(), c)
+	assert.Equal(t, errForwardSecrecy, err)
+	c = runTestSession(t, tls.VersionTLS13, 0, nil, nil)
+	_, err = decryptCapture(keys.NewSession(), c)
+	assert.Equal(t, errNoKeyLog, err)
+}
+
+func TestDecryptKeyLog(t *testing.T) {
+	tests := []struct {
+		version uint16
+		suite   uint16
+	}{
+		{tls.VersionTLS12, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+		{tls.VersionTLS12, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384},
+		{tls.VersionTLS12, tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA},
+		{tls.VersionTLS12, tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256},
+		{tls.VersionTLS12, tls.TLS_RSA_WITH_AES_128_GCM_SHA256},
+		{tls.VersionTLS13, 0},
+	}
+
+	for _, test := range tests {
+		keys, keyLog, cleanup := newTestKeyLog(t)
+		c := runTestSession(t, test.version, test.suite, nil, keyLog)
+		session := keys.NewSession()
+		plaintext, err := decryptCapture(session, c)
+		name := versionName(test.version) + " " + session.CipherSuite()
+		if assert.NoError(t, err, name) {
+			assert.Equal(t, testRequest, string(plaintext[0]), name)
+			assert.Equal(t, testResponse, string(plaintext[1]), name)
+			assert.Equal(t, versionName(test.version), session.Version(), name)
+		}
+		cleanup()
+	}
+}
+
+func TestDecryptKeyLogDelayed(t *testing.T) {
+	keys, keyLog, cleanup := newTestKeyLog(t)
+	defer cleanup()
+
+	// the session is captured before its secrets are logged
+	var secrets bytes.Buffer
+	c := runTestSession(t, tls.VersionTLS13, 0, nil, &secrets)
+	session := keys.NewSession()
+	plaintext, err := decryptCapture(session, c)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Empty(t, plaintext[0])
+	assert.Empty(t, plaintext[1])
+
+	keyLog.Write(secrets.Bytes())
+	for dir := uint8(0); dir < 2; dir++ {
+		data, err := session.Process(dir, nil)
+		if assert.NoError(t, err) {
+			plaintext[dir] = append(plaintext[dir], data...)
+		}
+	}
+	assert.Equal(t, testRequest, string(plaintext[0]))
+	assert.Equal(t, testResponse, string(plaintext[1]))
+}
+
+func TestDecryptSegmented(t *testing.T) {
+	keys := newTestKeys(t)
+	c := runTestSession(t, tls.VersionTLS12, tls.TLS_RSA_WITH_AES_128_CBC_SHA, nil, nil)
+
+	// records split over several segments
+	session := keys.NewSession()
+	var plaintext [2][]byte
+	for _, seg := range c.segments {
+		for i := 0; i < len(seg.data); i += 7 {
+			end := i + 7
+			if end > len(seg.data) {
+				end = len(seg.data)
+			}
+			data, err := session.Process(seg.dir, seg.data[i:end])
+			if !assert.NoError(t, err) {
+				return
+			}
+			plaintext[seg.dir] = append(plaintext[seg.dir], data...)
+		}
+	}
+	assert.Equal(t, testRequest, string(plaintext[0]))
+	assert.Equal(t, testResponse, string(plaintext[1]))
+}
+
+func TestIsRecord(t *testing.T) {
+	assert.True(t, IsRecord([]byte{0x16, 0x03, 0x01, 0x00, 0x05}))
+	assert.True(t, IsRecord([]byte{0x17, 0x03, 0x03}))
+	assert.False(t, IsRecord([]byte(testRequest)))
+	assert.False(t, IsRecord([]byte{0x16, 0x03}))
+}
+
+// decryptCapture returns the application data sent by the client and the
+// server.
+func decryptCapture(session *Session, c *capture) ([2][]byte, error) {
+	var plaintext [2][]byte
+	for _, seg := range c.segments {
+		data, err := session.Process(seg.dir, seg.data)
+		if err != nil {
+			return plaintext, err
+		}
+		plaintext[seg.dir] = append(plaintext[seg.dir], data...)
+	}
+	return plaintext, nil
+}
+
+// runTestSession captures a TLS session, the client sending testRequest and
+// the server answering testResponse.
+func runTestSession(
+	t *testing.T,
+	version, suite uint16,
+	cache tls.ClientSessionCache,
+	keyLog io.Writer,
+) *capture {
+	loadTestKey(t)
+	var suites []uint16
+	if suite != 0 {
+		suites = []uint16{suite}
+	}
+
+	c := &capture{}
+	clientConn, serverConn := net.Pipe()
+	serverDone := make(chan error, 1)
+	go func() {
+		defer serverConn.Close()
+		server := tls.Server(&captureConn{serverConn, 1, c}, &tls.Config{
+			Certificates: []tls.Certificate{testCert},
+			CipherSuites: suites,
+			MinVersion:   version,
+			MaxVersion:   version,
+			// the same for all sessions, so tickets are accepted
+			SessionTicketKey: [32]byte{1},
+		})
+		request := make([]byte, len(testRequest))
+		if _, err := io.ReadFull(server, request); err != nil {
+			serverDone <- err
+			return
+		}
+		_, err := server.Write([]byte(testResponse))
+		serverDone <- err
+	}()
+
+	client := tls.Client(&captureConn{clientConn, 0, c}, &tls.Config{
+		InsecureSkipVerify: true,
+		CipherSuites:       suites,
+		MinVersion:         version,
+		MaxVersion:         version,
+		ClientSessionCache: cache,
+		KeyLogWriter:       keyLog,
+	})
+	defer client.Close()
+	if _, err := client.Write([]byte(testRequest)); err != nil {
+		t.Fatal(err)
+	}
+	response := make([]byte, len(testResponse))
+	if _, err := io.ReadFull(client, response); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-serverDone; err != nil {
+		t.Fatal(err)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c
+}
+
+// newTestKeyLog returns keys reading the secrets written to keyLog.
+func newTestKeyLog(t *testing.T) (*Keys, *os.File, func()) {
+	f, err := ioutil.TempFile("", "keylog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := &Keys{keyLog: newKeyLog(f.Name()), sessions: map[string][]byte{}}
+	return keys, f, func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+}
+
+func newTestKeys(t *testing.T) *Keys {
+	loadTestKey(t)
+	return &Keys{privateKeys: []*rsa.PrivateKey{testKey}, sessions: map[string][]byte{}}
+}
+
+func loadTestKey(t *testing.T) {
+	testKeyOnce.Do(func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "venue"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testKey = key
+		testCert = tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	})
+}
@@ -0,0 +1,98 @@
+package tlsdecrypt
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+)
+
+const (
+	versionTLS10 = 0x0301
+	versionTLS11 = 0x0302
+	versionTLS12 = 0x0303
+	versionTLS13 = 0x0304
+)
+
+type keyExchange int
+
+const (
+	keyExchangeRSA keyExchange = iota
+	keyExchangeDHE
+	keyExchangeECDHE
+	// TLS 1.3 suites do not select the key exchange
+	keyExchangeTLS13
+)
+
+// cipherSuite describes the keys and record protection of a cipher suite.
+// Only AES suites are supported.
+type cipherSuite struct {
+	id   uint16
+	name string
+	kx   keyExchange
+
+	keyLen int
+	// length of the IV derived from the master secret: the block size for
+	// CBC, the implicit part of the nonce for GCM, the nonce for TLS 1.3
+	ivLen int
+	// HMAC hash of CBC suites, nil for AEAD suites
+	mac func() hash.Hash
+	// hash of the TLS 1.2 PRF, or of HKDF for TLS 1.3
+	prfHash func() hash.Hash
+}
+
+func (s *cipherSuite) aead() bool {
+	return s.mac == nil
+}
+
+var cipherSuites = map[uint16]*cipherSuite{}
+
+func init() {
+	for _, s := range []*cipherSuite{
+		{0x002f, "TLS_RSA_WITH_AES_128_CBC_SHA", keyExchangeRSA, 16, 16, sha1.New, sha256.New},
+		{0x0035, "TLS_RSA_WITH_AES_256_CBC_SHA", keyExchangeRSA, 32, 16, sha1.New, sha256.New},
+		{0x003c, "TLS_RSA_WITH_AES_128_CBC_SHA256", keyExchangeRSA, 16, 16, sha256.New, sha256.New},
+		{0x003d, "TLS_RSA_WITH_AES_256_CBC_SHA256", keyExchangeRSA, 32, 16, sha256.New, sha256.New},
+		{0x009c, "TLS_RSA_WITH_AES_128_GCM_SHA256", keyExchangeRSA, 16, 4, nil, sha256.New},
+		{0x009d, "TLS_RSA_WITH_AES_256_GCM_SHA384", keyExchangeRSA, 32, 4, nil, sha512.New384},
+
+		{0x0033, "TLS_DHE_RSA_WITH_AES_128_CBC_SHA", keyExchangeDHE, 16, 16, sha1.New, sha256.New},
+		{0x0039, "TLS_DHE_RSA_WITH_AES_256_CBC_SHA", keyExchangeDHE, 32, 16, sha1.New, sha256.New},
+		{0x0067, "TLS_DHE_RSA_WITH_AES_128_CBC_SHA256", keyExchangeDHE, 16, 16, sha256.New, sha256.New},
+		{0x006b, "TLS_DHE_RSA_WITH_AES_256_CBC_SHA256", keyExchangeDHE, 32, 16, sha256.New, sha256.New},
+		{0x009e, "TLS_DHE_RSA_WITH_AES_128_GCM_SHA256", keyExchangeDHE, 16, 4, nil, sha256.New},
+		{0x009f, "TLS_DHE_RSA_WITH_AES_256_GCM_SHA384", keyExchangeDHE, 32, 4, nil, sha512.New384},
+
+		{0xc009, "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA", keyExchangeECDHE, 16, 16, sha1.New, sha256.New},
+		{0xc00a, "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA", keyExchangeECDHE, 32, 16, sha1.New, sha256.New},
+		{0xc013, "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA", keyExchangeECDHE, 16, 16, sha1.New, sha256.New},
+		{0xc014, "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA", keyExchangeECDHE, 32, 16, sha1.New, sha256.New},
+		{0xc023, "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256", keyExchangeECDHE, 16, 16, sha256.New, sha256.New},
+		{0xc024, "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA384", keyExchangeECDHE, 32, 16, sha512.New384, sha512.New384},
+		{0xc027, "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256", keyExchangeECDHE, 16, 16, sha256.New, sha256.New},
+		{0xc028, "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA384", keyExchangeECDHE, 32, 16, sha512.New384, sha512.New384},
+		{0xc02b, "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", keyExchangeECDHE, 16, 4, nil, sha256.New},
+		{0xc02c, "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384", keyExchangeECDHE, 32, 4, nil, sha512.New384},
+		{0xc02f, "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", keyExchangeECDHE, 16, 4, nil, sha256.New},
+		{0xc030, "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384", keyExchangeECDHE, 32, 4, nil, sha512.New384},
+
+		{0x1301, "TLS_AES_128_GCM_SHA256", keyExchangeTLS13, 16, 12, nil, sha256.New},
+		{0x1302, "TLS_AES_256_GCM_SHA384", keyExchangeTLS13, 32, 12, nil, sha512.New384},
+	} {
+		cipherSuites[s.id] = s
+	}
+}
+
+func versionName(version uint16) string {
+	switch version {
+	case versionTLS10:
+		return "TLSv1.0"
+	case versionTLS11:
+		return "TLSv1.1"
+	case versionTLS12:
+		return "TLSv1.2"
+	case versionTLS13:
+		return "TLSv1.3"
+	}
+	return ""
+}
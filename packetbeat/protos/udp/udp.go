@@ -13,6 +13,7 @@ import (
 type UDP struct {
 	protocols protos.Protocols
 	portMap   map[uint16]protos.Protocol
+	ranges    protos.PortRangeMap
 }
 
 type Processor interface {
@@ -33,7 +34,7 @@ func (udp *UDP) decideProtocol(tuple *common.IPPortTuple) protos.Protocol {
 		return protocol
 	}
 
-	return protos.UnknownProtocol
+	return udp.ranges.Decide(tuple)
 }
 
 // Process handles UDP packets that have been received. It attempts to
@@ -89,9 +90,41 @@ func NewUDP(p protos.Protocols) (*UDP, error) {
 	if err != nil {
 		return nil, err
 	}
+	ranges, err := buildPortRanges(p)
+	if err != nil {
+		return nil, err
+	}
 
-	udp := &UDP{protocols: p, portMap: portMap}
+	udp := &UDP{protocols: p, portMap: portMap, ranges: ranges}
 	logp.Debug("udp", "Port map: %v", portMap)
+	logp.Debug("udp", "Port ranges: %v", ranges)
 
 	return udp, nil
 }
+
+// UpdatePorts maps the ports to the protocols again, after the ports of the
+// plugins have been reloaded.
+func (udp *UDP) UpdatePorts() error {
+	portMap, err := buildPortsMap(udp.protocols.GetAllUDP())
+	if err != nil {
+		return err
+	}
+	ranges, err := buildPortRanges(udp.protocols)
+	if err != nil {
+		return err
+	}
+	udp.portMap = portMap
+	udp.ranges = ranges
+	logp.Debug("udp", "Port map: %v", portMap)
+	logp.Debug("udp", "Port ranges: %v", ranges)
+	return nil
+}
+
+// buildPortRanges maps the port ranges of the UDP plugins to the protocols.
+func buildPortRanges(p protos.Protocols) (protos.PortRangeMap, error) {
+	ranges := map[protos.Protocol][]protos.PortRange{}
+	for proto := range p.GetAllUDP() {
+		ranges[proto] = p.GetPortRanges(proto)
+	}
+	return protos.BuildPortRangeMap(ranges)
+}
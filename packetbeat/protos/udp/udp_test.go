@@ -33,10 +33,11 @@ var (
 )
 
 type TestProtocols struct {
-	udp map[protos.Protocol]protos.UDPPlugin
+	udp    map[protos.Protocol]protos.UDPPlugin
+	ranges map[protos.Protocol][]protos.PortRange
 }
 
-func (p TestProtocols) BpfFilter(withVlans bool, withICMP bool) string {
+func (p TestProtocols) BpfFilter(withVlans bool, withMPLS bool, withICMP bool) string {
 	return "mock bpf filter"
 }
 
@@ -60,6 +61,10 @@ func (p TestProtocols) GetAllUDP() map[protos.Protocol]protos.UDPPlugin {
 	return p.udp
 }
 
+func (p TestProtocols) GetPortRanges(proto protos.Protocol) []protos.PortRange {
+	return p.ranges[proto]
+}
+
 func (p TestProtocols) Register(proto protos.Protocol, plugin protos.Plugin) {
 	return
 }
@@ -209,6 +214,19 @@ func Test_decideProtocol_byDstPort(t *testing.T) {
 	assert.Equal(t, PROTO, test.udp.decideProtocol(&tuple))
 }
 
+// Verify that UpdatePorts maps the reloaded ports of the plugins.
+func TestUpdatePorts(t *testing.T) {
+	test := testSetup(t)
+	tuple := common.NewIPPortTuple(4,
+		net.ParseIP("10.0.0.1"), 34898,
+		net.ParseIP("192.168.0.1"), 5678)
+	assert.Equal(t, protos.UnknownProtocol, test.udp.decideProtocol(&tuple))
+
+	test.plugin.Ports = []int{5678}
+	assert.NoError(t, test.udp.UpdatePorts())
+	assert.Equal(t, PROTO, test.udp.decideProtocol(&tuple))
+}
+
 // Verify that decideProtocol returns UnknownProtocol when given packet for
 // which it does not have a plugin.
 func TestProcess_unknownProtocol(t *testing.T) {
@@ -0,0 +1,129 @@
+package publish
+
+import (
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// ECSVersion is the version of the Elastic Common Schema the ECS fields of
+// the transactions comply with, published in ecs.version.
+const ECSVersion = "1.0.0"
+
+// ECSMapper adds the ECS fields specific to a protocol to fields, from the
+// transaction published by the protocol. Fields are set by path, like
+// event.duration.
+type ECSMapper func(event, fields common.MapStr)
+
+var ecsMappers = map[string]ECSMapper{}
+
+// RegisterECSMapper registers the mapper of the ECS fields of the
+// transactions of type eventType.
+func RegisterECSMapper(eventType string, mapper ECSMapper) {
+	ecsMappers[eventType] = mapper
+}
+
+// addECSFields adds the Elastic Common Schema fields of a normalized
+// transaction, alongside the fields of the protocol.
+func addECSFields(event common.MapStr) {
+	eventType, _ := event["type"].(string)
+	fields := common.MapStr{
+		"ecs": common.MapStr{"version": ECSVersion},
+		"event": common.MapStr{
+			"kind":     "event",
+			"category": "network_traffic",
+			"dataset":  eventType,
+		},
+		"network": common.MapStr{"protocol": eventType},
+	}
+
+	addECSEndpoint(fields, "source", event, "client_ip", "client_port", "client_server", "client_geoip")
+	addECSEndpoint(fields, "destination", event, "ip", "port", "server", "server_geoip")
+
+	if transport, ok := event["transport"].(string); ok && transport != "" {
+		fields.Put("network.transport", transport)
+	}
+	switch event["direction"] {
+	case "in":
+		fields.Put("network.direction", "inbound")
+	case "out":
+		fields.Put("network.direction", "outbound")
+	}
+
+	bytesIn, hasIn := toInt64(event["bytes_in"])
+	bytesOut, hasOut := toInt64(event["bytes_out"])
+	if hasIn {
+		fields.Put("source.bytes", bytesIn)
+	}
+	if hasOut {
+		fields.Put("destination.bytes", bytesOut)
+	}
+	if hasIn || hasOut {
+		fields.Put("network.bytes", bytesIn+bytesOut)
+	}
+	if ms, ok := toInt64(event["responsetime"]); ok {
+		fields.Put("event.duration", ms*int64(time.Millisecond))
+	}
+
+	if mapper := ecsMappers[eventType]; mapper != nil {
+		mapper(event, fields)
+	}
+
+	for name, value := range fields {
+		event[name] = value
+	}
+}
+
+// addECSEndpoint adds the source or destination ECS fields from the
+// normalized address fields of a transaction.
+func addECSEndpoint(fields common.MapStr, name string, event common.MapStr, ipField, portField, domainField, geoField string) {
+	ip, _ := event[ipField].(string)
+	if ip == "" {
+		return
+	}
+
+	endpoint := common.MapStr{"ip": ip}
+	if port, ok := toInt64(event[portField]); ok && port > 0 {
+		endpoint["port"] = port
+	}
+	if domain, ok := event[domainField].(string); ok && domain != "" {
+		endpoint["domain"] = domain
+	}
+	if geoIP, ok := event[geoField].(common.MapStr); ok {
+		geo := geoIP.Clone()
+		as := common.MapStr{}
+		if asn, ok := geo["asn"]; ok {
+			as["number"] = asn
+			delete(geo, "asn")
+		}
+		if org, ok := geo["organization_name"]; ok {
+			as["organization"] = common.MapStr{"name": org}
+			delete(geo, "organization_name")
+		}
+		if len(geo) > 0 {
+			endpoint["geo"] = geo
+		}
+		if len(as) > 0 {
+			endpoint["as"] = as
+		}
+	}
+	fields[name] = endpoint
+}
+
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), true
+	}
+	return 0, false
+}
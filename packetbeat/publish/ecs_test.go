@@ -0,0 +1,104 @@
+// +build !integration
+
+package publish
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func TestPrepareTransactionECS(t *testing.T) {
+	publisher := newTestPublisher([]string{"192.145.2.4"})
+	ppub, _ := NewPublisher(publisher, QueueSettings{Size: 1000}, 1, false, true, nil)
+
+	event := common.MapStr{
+		"@timestamp":   common.Time(time.Now()),
+		"type":         "http",
+		"transport":    "tcp",
+		"responsetime": int32(12),
+		"bytes_in":     uint64(100),
+		"bytes_out":    uint64(2000),
+		"src":          &common.Endpoint{IP: "192.145.2.4", Port: 3267},
+		"dst":          &common.Endpoint{IP: "192.145.2.5", Port: 80},
+	}
+	assert.True(t, ppub.prepareTransaction(event))
+
+	assert.Equal(t, common.MapStr{"version": ECSVersion}, event["ecs"])
+	assert.Equal(t, common.MapStr{
+		"ip":    "192.145.2.4",
+		"port":  int64(3267),
+		"bytes": int64(100),
+	}, event["source"])
+	assert.Equal(t, common.MapStr{
+		"ip":    "192.145.2.5",
+		"port":  int64(80),
+		"bytes": int64(2000),
+	}, event["destination"])
+	assert.Equal(t, common.MapStr{
+		"protocol":  "http",
+		"transport": "tcp",
+		"direction": "outbound",
+		"bytes":     int64(2100),
+	}, event["network"])
+	assert.Equal(t, common.MapStr{
+		"kind":     "event",
+		"category": "network_traffic",
+		"dataset":  "http",
+		"duration": int64(12 * time.Millisecond),
+	}, event["event"])
+
+	// the fields of the protocol are kept
+	assert.Equal(t, "192.145.2.4", event["client_ip"])
+}
+
+func TestPrepareTransactionWithoutECS(t *testing.T) {
+	publisher := newTestPublisher(nil)
+	ppub, _ := NewPublisher(publisher, QueueSettings{Size: 1000}, 1, false, false, nil)
+
+	event := common.MapStr{
+		"@timestamp": common.Time(time.Now()),
+		"type":       "http",
+		"dst":        &common.Endpoint{IP: "192.145.2.5", Port: 80},
+	}
+	assert.True(t, ppub.prepareTransaction(event))
+	assert.Nil(t, event["ecs"])
+	assert.Nil(t, event["destination"])
+}
+
+func TestECSGeoIP(t *testing.T) {
+	event := common.MapStr{
+		"type":      "fix",
+		"client_ip": "81.2.69.142",
+		"client_geoip": common.MapStr{
+			"country_iso_code":  "GB",
+			"asn":               int64(20712),
+			"organization_name": "Andrews & Arnold Ltd",
+		},
+	}
+	addECSFields(event)
+
+	source := event["source"].(common.MapStr)
+	assert.Equal(t, common.MapStr{"country_iso_code": "GB"}, source["geo"])
+	assert.Equal(t, common.MapStr{
+		"number":       int64(20712),
+		"organization": common.MapStr{"name": "Andrews & Arnold Ltd"},
+	}, source["as"])
+
+	// the geoip fields of the event are left untouched
+	assert.Len(t, event["client_geoip"], 3)
+}
+
+func TestECSMapper(t *testing.T) {
+	RegisterECSMapper("ecs_test", func(event, fields common.MapStr) {
+		fields.Put("event.action", event["action"])
+	})
+	defer delete(ecsMappers, "ecs_test")
+
+	event := common.MapStr{"type": "ecs_test", "action": "login"}
+	addECSFields(event)
+	assert.Equal(t, "login", event["event"].(common.MapStr)["action"])
+}
@@ -0,0 +1,157 @@
+package publish
+
+import (
+	"net"
+	"sync"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// maxGeoIPCacheSize limits the number of addresses cached. The cache is
+// cleared when full.
+const maxGeoIPCacheSize = 10000
+
+// GeoIP looks up the location and autonomous system of IP addresses in
+// MaxMind databases, like GeoLite2-City and GeoLite2-ASN. The results are
+// cached, as transactions are usually exchanged by few addresses.
+type GeoIP struct {
+	city, asn *maxminddb.Reader
+
+	mutex sync.Mutex
+	cache map[string]common.MapStr
+}
+
+type cityRecord struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Continent struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"continent"`
+	Country struct {
+		IsoCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+}
+
+type asnRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// NewGeoIP opens the city and ASN databases. Either path can be empty, but
+// not both.
+func NewGeoIP(cityPath, asnPath string) (*GeoIP, error) {
+	g := &GeoIP{cache: map[string]common.MapStr{}}
+
+	var err error
+	if cityPath != "" {
+		if g.city, err = maxminddb.Open(cityPath); err != nil {
+			return nil, err
+		}
+		logp.Info("Loaded GeoIP city database from: %s", cityPath)
+	}
+	if asnPath != "" {
+		if g.asn, err = maxminddb.Open(asnPath); err != nil {
+			g.Close()
+			return nil, err
+		}
+		logp.Info("Loaded GeoIP ASN database from: %s", asnPath)
+	}
+	return g, nil
+}
+
+// Close closes the databases.
+func (g *GeoIP) Close() {
+	if g == nil {
+		return
+	}
+	if g.city != nil {
+		g.city.Close()
+	}
+	if g.asn != nil {
+		g.asn.Close()
+	}
+}
+
+// Lookup returns the geoip fields of ip, or nil if ip is not found in the
+// databases, like private addresses.
+func (g *GeoIP) Lookup(ip string) common.MapStr {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	fields, cached := g.cache[ip]
+	if !cached {
+		fields = g.lookup(ip)
+		if len(g.cache) >= maxGeoIPCacheSize {
+			g.cache = map[string]common.MapStr{}
+		}
+		g.cache[ip] = fields
+	}
+	if fields == nil {
+		return nil
+	}
+	// events might be modified by processors after publishing
+	return fields.Clone()
+}
+
+func (g *GeoIP) lookup(ip string) common.MapStr {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil
+	}
+
+	fields := common.MapStr{}
+	if g.city != nil {
+		var city cityRecord
+		if err := g.city.Lookup(addr, &city); err != nil {
+			logp.Warn("GeoIP lookup of %s failed: %v", ip, err)
+		}
+		putName(fields, "continent_name", city.Continent.Names)
+		if city.Country.IsoCode != "" {
+			fields["country_iso_code"] = city.Country.IsoCode
+		}
+		putName(fields, "country_name", city.Country.Names)
+		if len(city.Subdivisions) > 0 {
+			putName(fields, "region_name", city.Subdivisions[0].Names)
+		}
+		putName(fields, "city_name", city.City.Names)
+		if loc := city.Location; loc.Latitude != 0 || loc.Longitude != 0 {
+			fields["location"] = common.MapStr{"lat": loc.Latitude, "lon": loc.Longitude}
+		}
+	}
+	if g.asn != nil {
+		var asn asnRecord
+		if err := g.asn.Lookup(addr, &asn); err != nil {
+			logp.Warn("GeoIP ASN lookup of %s failed: %v", ip, err)
+		}
+		if asn.Number != 0 {
+			fields["asn"] = asn.Number
+		}
+		if asn.Organization != "" {
+			fields["organization_name"] = asn.Organization
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// putName adds the English name of a record, if available.
+func putName(fields common.MapStr, key string, names map[string]string) {
+	if name := names["en"]; name != "" {
+		fields[key] = name
+	}
+}
@@ -0,0 +1,229 @@
+// +build !integration
+
+package publish
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/stretchr/testify/assert"
+)
+
+var testCityRecord = map[string]interface{}{
+	"city":      map[string]interface{}{"names": map[string]interface{}{"en": "London"}},
+	"continent": map[string]interface{}{"names": map[string]interface{}{"en": "Europe"}},
+	"country": map[string]interface{}{
+		"iso_code": "GB",
+		"names":    map[string]interface{}{"en": "United Kingdom"},
+	},
+	"subdivisions": []interface{}{
+		map[string]interface{}{"names": map[string]interface{}{"en": "England"}},
+	},
+	"location": map[string]interface{}{"latitude": 51.5142, "longitude": -0.0931},
+}
+
+var testASNRecord = map[string]interface{}{
+	"autonomous_system_number":       uint32(20712),
+	"autonomous_system_organization": "Andrews & Arnold Ltd",
+}
+
+func TestGeoIPLookup(t *testing.T) {
+	geoIP, cleanup := newTestGeoIP(t)
+	defer cleanup()
+
+	expected := common.MapStr{
+		"continent_name":    "Europe",
+		"country_iso_code":  "GB",
+		"country_name":      "United Kingdom",
+		"region_name":       "England",
+		"city_name":         "London",
+		"location":          common.MapStr{"lat": 51.5142, "lon": -0.0931},
+		"asn":               uint(20712),
+		"organization_name": "Andrews & Arnold Ltd",
+	}
+	assert.Equal(t, expected, geoIP.Lookup("81.2.69.160"))
+
+	// cached results are copied
+	geoIP.Lookup("81.2.69.160")["location"].(common.MapStr)["lat"] = 0
+	assert.Equal(t, expected, geoIP.Lookup("81.2.69.160"))
+
+	assert.Nil(t, geoIP.Lookup("10.0.0.1"))
+	assert.Nil(t, geoIP.Lookup("invalid"))
+	assert.Nil(t, geoIP.Lookup(""))
+}
+
+func TestGeoIPTransaction(t *testing.T) {
+	geoIP, cleanup := newTestGeoIP(t)
+	defer cleanup()
+
+	publisher := newTestPublisher([]string{"10.0.0.1"})
+	ppub, _ := NewPublisher(publisher, QueueSettings{Size: 1000}, 1, false, false, geoIP)
+
+	event := common.MapStr{
+		"src": &common.Endpoint{IP: "81.2.69.160", Port: 40000},
+		"dst": &common.Endpoint{IP: "10.0.0.1", Port: 9878},
+	}
+	assert.True(t, ppub.normalizeTransAddr(event))
+	client, ok := event["client_geoip"].(common.MapStr)
+	if assert.True(t, ok) {
+		assert.Equal(t, "GB", client["country_iso_code"])
+		assert.Equal(t, uint(20712), client["asn"])
+	}
+	_, ok = event["server_geoip"]
+	assert.False(t, ok)
+}
+
+func TestGeoIPFlow(t *testing.T) {
+	geoIP, cleanup := newTestGeoIP(t)
+	defer cleanup()
+
+	publisher := newTestPublisher([]string{"10.0.0.1"})
+	ppub, _ := NewPublisher(publisher, QueueSettings{Size: 1000}, 1, false, false, geoIP)
+
+	event := common.MapStr{
+		"source": common.MapStr{"ip": "10.0.0.1"},
+		"dest":   common.MapStr{"ip": "81.2.69.160"},
+	}
+	ppub.addGeoIPFieldsToFlow(event)
+
+	_, ok := event["source"].(common.MapStr)["geoip"]
+	assert.False(t, ok)
+	dest, ok := event["dest"].(common.MapStr)["geoip"].(common.MapStr)
+	if assert.True(t, ok) {
+		assert.Equal(t, "London", dest["city_name"])
+	}
+}
+
+func newTestGeoIP(t *testing.T) (*GeoIP, func()) {
+	dir, err := ioutil.TempDir("", "geoip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cityPath := filepath.Join(dir, "City.mmdb")
+	asnPath := filepath.Join(dir, "ASN.mmdb")
+	writeTestDatabase(t, cityPath, "GeoLite2-City", "81.2.69.0/24", testCityRecord)
+	writeTestDatabase(t, asnPath, "GeoLite2-ASN", "81.2.64.0/19", testASNRecord)
+
+	geoIP, err := NewGeoIP(cityPath, asnPath)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return geoIP, func() {
+		geoIP.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// writeTestDatabase writes an IPv4 MaxMind database with a single network,
+// using 24 bit records.
+func writeTestDatabase(t *testing.T, path, dbType, network string, record interface{}) {
+	_, ipNet, err := net.ParseCIDR(network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip := binary.BigEndian.Uint32(ipNet.IP.To4())
+	prefix, _ := ipNet.Mask.Size()
+
+	// one node per bit of the prefix, the last one pointing to the record
+	nodeCount := uint32(prefix)
+	var db bytes.Buffer
+	for i := 0; i < prefix; i++ {
+		records := [2]uint32{nodeCount, nodeCount}
+		bit := (ip >> uint(31-i)) & 1
+		if i == prefix-1 {
+			records[bit] = nodeCount + 16
+		} else {
+			records[bit] = uint32(i + 1)
+		}
+		for _, r := range records {
+			db.Write([]byte{byte(r >> 16), byte(r >> 8), byte(r)})
+		}
+	}
+	db.Write(make([]byte, 16))
+	encodeTestValue(&db, record)
+
+	db.WriteString("\xab\xcd\xefMaxMind.com")
+	encodeTestValue(&db, map[string]interface{}{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1483228800),
+		"database_type":               dbType,
+		"description":                 map[string]interface{}{"en": "Test database"},
+		"ip_version":                  uint16(4),
+		"languages":                   []interface{}{"en"},
+		"node_count":                  nodeCount,
+		"record_size":                 uint16(24),
+	})
+
+	if err := ioutil.WriteFile(path, db.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// encodeTestValue encodes v in the MaxMind DB data section format. Sizes
+// must be less than 285.
+func encodeTestValue(buf *bytes.Buffer, v interface{}) {
+	control := func(typ, size int) {
+		sizeBits, extraSize := size, -1
+		if size >= 29 {
+			sizeBits, extraSize = 29, size-29
+		}
+		if typ <= 7 {
+			buf.WriteByte(byte(typ<<5 | sizeBits))
+		} else {
+			buf.Write([]byte{byte(sizeBits), byte(typ - 7)})
+		}
+		if extraSize >= 0 {
+			buf.WriteByte(byte(extraSize))
+		}
+	}
+	unsigned := func(typ int, v uint64, width int) {
+		control(typ, width)
+		for i := width - 1; i >= 0; i-- {
+			buf.WriteByte(byte(v >> uint(8*i)))
+		}
+	}
+
+	switch v := v.(type) {
+	case string:
+		control(2, len(v))
+		buf.WriteString(v)
+	case float64:
+		control(3, 8)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case uint16:
+		unsigned(5, uint64(v), 2)
+	case uint32:
+		unsigned(6, uint64(v), 4)
+	case uint64:
+		unsigned(9, v, 8)
+	case map[string]interface{}:
+		control(7, len(v))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			encodeTestValue(buf, k)
+			encodeTestValue(buf, v[k])
+		}
+	case []interface{}:
+		control(11, len(v))
+		for _, e := range v {
+			encodeTestValue(buf, e)
+		}
+	default:
+		panic("unsupported type")
+	}
+}
@@ -25,12 +25,14 @@ type PacketbeatPublisher struct {
 
 	topo           topologyProvider
 	geoLite        *libgeo.GeoIP
+	geoIP          *GeoIP
 	ignoreOutgoing bool
+	ecs            bool
 
 	wg   sync.WaitGroup
 	done chan struct{}
 
-	trans chan common.MapStr
+	trans *transQueue
 	flows chan []common.MapStr
 }
 
@@ -52,38 +54,75 @@ func (t *ChanTransactions) PublishTransaction(event common.MapStr) bool {
 	return true
 }
 
+// metadataTransactions adds the fields and tags configured for a protocol to
+// its transactions. They are merged into the events after the global fields
+// and tags, taking precedence.
+type metadataTransactions struct {
+	results  Transactions
+	metadata common.EventMetadata
+}
+
+// WithEventMetadata returns the Transactions adding the fields and tags
+// configured by a protocol config to the events published to results.
+func WithEventMetadata(results Transactions, config *common.Config) (Transactions, error) {
+	var metadata common.EventMetadata
+	if err := config.Unpack(&metadata); err != nil {
+		return nil, err
+	}
+	if len(metadata.Fields) == 0 && len(metadata.Tags) == 0 {
+		return results, nil
+	}
+	return &metadataTransactions{results: results, metadata: metadata}, nil
+}
+
+func (t *metadataTransactions) PublishTransaction(event common.MapStr) bool {
+	event[common.EventMetadataKey] = t.metadata
+	return t.results.PublishTransaction(event)
+}
+
 var debugf = logp.MakeDebug("publish")
 
+// NewPublisher creates the publisher of transactions and flows. Transactions
+// are queued as configured by queue. If geoIP is not nil, the client and
+// server addresses are looked up, the databases being closed when the
+// publisher is stopped. If ecs is set, the Elastic Common Schema fields are
+// added to the transactions.
 func NewPublisher(
 	pub publisher.Publisher,
-	hwm, bulkHWM int,
+	queue QueueSettings,
+	bulkHWM int,
 	ignoreOutgoing bool,
+	ecs bool,
+	geoIP *GeoIP,
 ) (*PacketbeatPublisher, error) {
 	topo, ok := pub.(topologyProvider)
 	if !ok {
 		return nil, errors.New("Requires topology provider")
 	}
 
-	return &PacketbeatPublisher{
+	p := &PacketbeatPublisher{
 		pub:            pub,
 		topo:           topo,
 		geoLite:        topo.GeoLite(),
+		geoIP:          geoIP,
 		ignoreOutgoing: ignoreOutgoing,
-		client:         pub.Connect(),
+		ecs:            ecs,
 		done:           make(chan struct{}),
-		trans:          make(chan common.MapStr, hwm),
 		flows:          make(chan []common.MapStr, bulkHWM),
-	}, nil
+	}
+	trans, err := newTransQueue(queue, p.prepareTransaction)
+	if err != nil {
+		return nil, err
+	}
+	p.trans = trans
+	p.client = pub.Connect()
+	return p, nil
 }
 
+// PublishTransaction queues a transaction, applying the overflow policy if
+// the queue is full. False is returned if the transaction has been dropped.
 func (p *PacketbeatPublisher) PublishTransaction(event common.MapStr) bool {
-	select {
-	case p.trans <- event:
-		return true
-	default:
-		// drop event if queue is full
-		return false
-	}
+	return p.trans.push(event)
 }
 
 func (p *PacketbeatPublisher) PublishFlows(event []common.MapStr) bool {
@@ -100,11 +139,15 @@ func (p *PacketbeatPublisher) Start() {
 	p.wg.Add(1)
 	go func() {
 		defer p.wg.Done()
+		// the transactions queued before stopping are published
 		for {
-			select {
-			case <-p.done:
+			event, prepared, ok := p.trans.pop()
+			if !ok {
 				return
-			case event := <-p.trans:
+			}
+			if prepared {
+				p.client.PublishEvent(event)
+			} else {
 				p.onTransaction(event)
 			}
 		}
@@ -116,7 +159,14 @@ func (p *PacketbeatPublisher) Start() {
 		for {
 			select {
 			case <-p.done:
-				return
+				for {
+					select {
+					case events := <-p.flows:
+						p.onFlow(events)
+					default:
+						return
+					}
+				}
 			case events := <-p.flows:
 				p.onFlow(events)
 			}
@@ -124,23 +174,38 @@ func (p *PacketbeatPublisher) Start() {
 	}()
 }
 
+// Stop publishes the events still queued, then disconnects from the beat
+// publisher. The sniffer must be stopped first, as events published after
+// Stop are dropped.
 func (p *PacketbeatPublisher) Stop() {
-	p.client.Close()
 	close(p.done)
+	p.trans.close()
 	p.wg.Wait()
+	p.trans.release()
+	p.client.Close()
+	p.geoIP.Close()
 }
 
 func (p *PacketbeatPublisher) onTransaction(event common.MapStr) {
+	if p.prepareTransaction(event) {
+		p.client.PublishEvent(event)
+	}
+}
+
+// prepareTransaction validates a transaction and normalizes its addresses,
+// returning false if the transaction is not to be published.
+func (p *PacketbeatPublisher) prepareTransaction(event common.MapStr) bool {
 	if err := validateEvent(event); err != nil {
 		logp.Warn("Dropping invalid event: %v", err)
-		return
+		return false
 	}
-
 	if !p.normalizeTransAddr(event) {
-		return
+		return false
 	}
-
-	p.client.PublishEvent(event)
+	if p.ecs {
+		addECSFields(event)
+	}
+	return true
 }
 
 func (p *PacketbeatPublisher) onFlow(events []common.MapStr) {
@@ -154,6 +219,9 @@ func (p *PacketbeatPublisher) onFlow(events []common.MapStr) {
 		if !p.addGeoIPToFlow(event) {
 			continue
 		}
+		if p.geoIP != nil {
+			p.addGeoIPFieldsToFlow(event)
+		}
 
 		pub = append(pub, event)
 	}
@@ -252,9 +320,33 @@ func (p *PacketbeatPublisher) normalizeTransAddr(event common.MapStr) bool {
 		}
 	}
 
+	if p.geoIP != nil {
+		p.addGeoIPFields(event, src, dst)
+	}
+
 	return true
 }
 
+// addGeoIPFields adds the client_geoip and server_geoip fields, looking up
+// the real_ip of the client if available.
+func (p *PacketbeatPublisher) addGeoIPFields(event common.MapStr, src, dst *common.Endpoint) {
+	var clientIP string
+	if realIP, ok := event["real_ip"].(common.NetString); ok && len(realIP) > 0 {
+		clientIP = string(realIP)
+	} else if src != nil {
+		clientIP = src.IP
+	}
+
+	if geo := p.geoIP.Lookup(clientIP); geo != nil {
+		event["client_geoip"] = geo
+	}
+	if dst != nil {
+		if geo := p.geoIP.Lookup(dst.IP); geo != nil {
+			event["server_geoip"] = geo
+		}
+	}
+}
+
 func (p *PacketbeatPublisher) addGeoIPToFlow(event common.MapStr) bool {
 
 	getLocation := func(host common.MapStr, ip_type string) string {
@@ -308,3 +400,22 @@ func (p *PacketbeatPublisher) addGeoIPToFlow(event common.MapStr) bool {
 
 	return true
 }
+
+// addGeoIPFieldsToFlow adds the geoip fields of the inner IPv4 or IPv6
+// addresses of a flow to source and dest.
+func (p *PacketbeatPublisher) addGeoIPFieldsToFlow(event common.MapStr) {
+	for _, name := range []string{"source", "dest"} {
+		host, ok := event[name].(common.MapStr)
+		if !ok {
+			continue
+		}
+
+		ip, ok := host["ip"].(string)
+		if !ok {
+			ip, _ = host["ipv6"].(string)
+		}
+		if geo := p.geoIP.Lookup(ip); geo != nil {
+			host["geoip"] = geo
+		}
+	}
+}
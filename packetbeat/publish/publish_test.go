@@ -63,7 +63,7 @@ func TestFilterEvent(t *testing.T) {
 
 func TestDirectionOut(t *testing.T) {
 	publisher := newTestPublisher([]string{"192.145.2.4"})
-	ppub, _ := NewPublisher(publisher, 1000, 1, false)
+	ppub, _ := NewPublisher(publisher, QueueSettings{Size: 1000}, 1, false, false, nil)
 
 	event := common.MapStr{
 		"src": &common.Endpoint{
@@ -89,7 +89,7 @@ func TestDirectionOut(t *testing.T) {
 
 func TestDirectionIn(t *testing.T) {
 	publisher := newTestPublisher([]string{"192.145.2.5"})
-	ppub, _ := NewPublisher(publisher, 1000, 1, false)
+	ppub, _ := NewPublisher(publisher, QueueSettings{Size: 1000}, 1, false, false, nil)
 
 	event := common.MapStr{
 		"src": &common.Endpoint{
@@ -121,7 +121,7 @@ func newTestPublisher(ips []string) *publisher.BeatPublisher {
 
 func TestNoDirection(t *testing.T) {
 	publisher := newTestPublisher([]string{"192.145.2.6"})
-	ppub, _ := NewPublisher(publisher, 1000, 1, false)
+	ppub, _ := NewPublisher(publisher, QueueSettings{Size: 1000}, 1, false, false, nil)
 
 	event := common.MapStr{
 		"src": &common.Endpoint{
@@ -145,3 +145,43 @@ func TestNoDirection(t *testing.T) {
 	_, ok := event["direction"]
 	assert.False(t, ok)
 }
+
+func TestWithEventMetadata(t *testing.T) {
+	config, err := common.NewConfigFrom(map[string]interface{}{
+		"ports":  []int{9878},
+		"fields": map[string]interface{}{"venue": "XLON", "rack": "A12"},
+		"tags":   []string{"prod"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := &ChanTransactions{Channel: make(chan common.MapStr, 1)}
+	withMetadata, err := WithEventMetadata(results, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, withMetadata.PublishTransaction(testEvent()))
+	event := <-results.Channel
+	metadata, ok := event[common.EventMetadataKey].(common.EventMetadata)
+	if assert.True(t, ok) {
+		assert.Equal(t, common.MapStr{"venue": "XLON", "rack": "A12"}, metadata.Fields)
+		assert.Equal(t, []string{"prod"}, metadata.Tags)
+		assert.False(t, metadata.FieldsUnderRoot)
+	}
+}
+
+func TestWithoutEventMetadata(t *testing.T) {
+	config, err := common.NewConfigFrom(map[string]interface{}{"ports": []int{9878}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := &ChanTransactions{Channel: make(chan common.MapStr, 1)}
+	withMetadata, err := WithEventMetadata(results, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, results, withMetadata)
+}
@@ -0,0 +1,370 @@
+package publish
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/logp"
+	"github.com/elastic/beats/libbeat/monitoring"
+)
+
+// Overflow policies of the transaction queue, applied to the transactions
+// published while the queue is full.
+const (
+	// OverflowBlock blocks the protocol analyzers until the queue has room
+	OverflowBlock = "block"
+	// OverflowDropOldest drops the oldest transaction queued
+	OverflowDropOldest = "drop_oldest"
+	// OverflowDropNewest drops the transaction published, the default
+	OverflowDropNewest = "drop_newest"
+	// OverflowSpill writes the transactions to a file until the queue has
+	// been drained
+	OverflowSpill = "spill"
+)
+
+// QueueSettings configures the queue of the transactions published by the
+// protocol analyzers, until the publisher forwards them to the outputs.
+type QueueSettings struct {
+	Size     int
+	Overflow string
+
+	// file the spill policy writes transactions to, and the maximum size of
+	// the transactions spilled at a time
+	SpillPath     string
+	SpillMaxBytes int64
+}
+
+var (
+	queueDepth      = expvar.NewInt("publish.queue.depth")
+	queueDropped    = expvar.NewInt("publish.queue.dropped")
+	queueBlocked    = expvar.NewInt("publish.queue.blocked")
+	queueSpilled    = expvar.NewInt("publish.queue.spilled")
+	queueSpillDepth = expvar.NewInt("publish.queue.spill_depth")
+	queueSpillBytes = expvar.NewInt("publish.queue.spill_bytes")
+)
+
+func init() {
+	monitoring.SetGauge("publish.queue.depth")
+	monitoring.SetGauge("publish.queue.spill_depth")
+	monitoring.SetGauge("publish.queue.spill_bytes")
+}
+
+var errSpillFull = errors.New("spill file is full")
+
+// spillDecodeError is returned for a line of the spill file not holding a
+// transaction. Only this line is skipped, the following lines being read.
+type spillDecodeError struct {
+	err error
+}
+
+func (e spillDecodeError) Error() string {
+	return "invalid spilled transaction: " + e.err.Error()
+}
+
+// transQueue is a bounded FIFO queue of transactions. Once transactions have
+// been spilled, transactions published are spilled too until the file has
+// been drained, keeping the order of the transactions.
+type transQueue struct {
+	overflow string
+
+	mutex    sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	closed   bool
+
+	// ring buffer of the transactions in memory
+	events      []common.MapStr
+	head, count int
+
+	spill *spillFile
+	// prepare validates and normalizes the transactions before they are
+	// spilled, returning false for transactions not to be published
+	prepare func(common.MapStr) bool
+}
+
+// spillFile appends the transactions spilled as JSON lines, read back in
+// order through a second handle. It is truncated once all transactions have
+// been read.
+type spillFile struct {
+	maxBytes int64
+
+	out    *os.File
+	writer *bufio.Writer
+	in     *os.File
+	reader *bufio.Reader
+
+	size    int64
+	pending int
+}
+
+// spilledEvent holds the fields of a transaction not surviving the encoding
+// as JSON with their types.
+type spilledEvent struct {
+	Timestamp common.Time           `json:"timestamp"`
+	Metadata  *common.EventMetadata `json:"metadata,omitempty"`
+	Event     common.MapStr         `json:"event"`
+}
+
+func newTransQueue(settings QueueSettings, prepare func(common.MapStr) bool) (*transQueue, error) {
+	size := settings.Size
+	if size < 1 {
+		size = 1
+	}
+
+	q := &transQueue{
+		overflow: settings.Overflow,
+		events:   make([]common.MapStr, size),
+		prepare:  prepare,
+	}
+	q.notEmpty = sync.NewCond(&q.mutex)
+	q.notFull = sync.NewCond(&q.mutex)
+
+	switch settings.Overflow {
+	case "", OverflowDropNewest, OverflowDropOldest, OverflowBlock:
+	case OverflowSpill:
+		spill, err := openSpillFile(settings.SpillPath, settings.SpillMaxBytes)
+		if err != nil {
+			return nil, err
+		}
+		q.spill = spill
+	default:
+		return nil, errors.New("unknown queue overflow policy " + settings.Overflow)
+	}
+	return q, nil
+}
+
+// push queues a transaction, returning false if it has been dropped.
+func (q *transQueue) push(event common.MapStr) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return false
+	}
+	if q.spill != nil && q.spill.pending > 0 {
+		return q.spillEvent(event)
+	}
+
+	blocked := false
+	for q.count == len(q.events) {
+		switch q.overflow {
+		case OverflowBlock:
+			if !blocked {
+				blocked = true
+				queueBlocked.Add(1)
+			}
+			q.notFull.Wait()
+			if q.closed {
+				return false
+			}
+		case OverflowDropOldest:
+			q.take()
+			queueDropped.Add(1)
+		case OverflowSpill:
+			return q.spillEvent(event)
+		default:
+			queueDropped.Add(1)
+			return false
+		}
+	}
+
+	q.events[(q.head+q.count)%len(q.events)] = event
+	q.count++
+	queueDepth.Set(int64(q.count))
+	q.notEmpty.Signal()
+	return true
+}
+
+// pop returns the next transaction, waiting until one is queued. prepared is
+// set for transactions read back from the spill file, which have been
+// prepared already. False is returned once the queue has been closed and
+// drained.
+func (q *transQueue) pop() (event common.MapStr, prepared bool, ok bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for {
+		if q.count > 0 {
+			event = q.take()
+			q.notFull.Signal()
+			return event, false, true
+		}
+		if q.spill != nil && q.spill.pending > 0 {
+			spilled, err := q.spill.read()
+			q.updateSpillMetrics()
+			if _, invalid := err.(spillDecodeError); invalid {
+				logp.Err("Dropping spilled transaction: %v", err)
+				queueDropped.Add(1)
+				continue
+			}
+			if err != nil {
+				logp.Err("Dropping %d spilled transactions, failed to read the spill file: %v",
+					q.spill.pending, err)
+				queueDropped.Add(int64(q.spill.pending))
+				q.spill.reset()
+				q.updateSpillMetrics()
+				continue
+			}
+			return spilled, true, true
+		}
+		if q.closed {
+			return nil, false, false
+		}
+		q.notEmpty.Wait()
+	}
+}
+
+// close wakes up the publishers blocked and the consumer, which drains the
+// transactions still queued.
+func (q *transQueue) close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
+
+// release closes the spill file, once the queue has been drained.
+func (q *transQueue) release() {
+	if q.spill != nil {
+		q.spill.close()
+	}
+}
+
+// take removes the oldest transaction in memory.
+func (q *transQueue) take() common.MapStr {
+	event := q.events[q.head]
+	q.events[q.head] = nil
+	q.head = (q.head + 1) % len(q.events)
+	q.count--
+	queueDepth.Set(int64(q.count))
+	return event
+}
+
+func (q *transQueue) spillEvent(event common.MapStr) bool {
+	if !q.prepare(event) {
+		return false
+	}
+	err := q.spill.write(event)
+	if err != nil {
+		if err != errSpillFull {
+			logp.Err("Dropping transaction, failed to write the spill file: %v", err)
+		}
+		queueDropped.Add(1)
+		return false
+	}
+	queueSpilled.Add(1)
+	q.updateSpillMetrics()
+	q.notEmpty.Signal()
+	return true
+}
+
+func (q *transQueue) updateSpillMetrics() {
+	queueSpillDepth.Set(int64(q.spill.pending))
+	queueSpillBytes.Set(q.spill.size)
+}
+
+// openSpillFile creates the spill file, truncating transactions spilled by a
+// previous run.
+func openSpillFile(path string, maxBytes int64) (*spillFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, err
+	}
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		out.Close()
+		return nil, err
+	}
+	return &spillFile{
+		maxBytes: maxBytes,
+		out:      out,
+		writer:   bufio.NewWriter(out),
+		in:       in,
+		reader:   bufio.NewReader(in),
+	}, nil
+}
+
+func (s *spillFile) write(event common.MapStr) error {
+	record := spilledEvent{Event: event}
+	record.Timestamp, _ = event["@timestamp"].(common.Time)
+	if metadata, ok := event[common.EventMetadataKey].(common.EventMetadata); ok {
+		record.Metadata = &metadata
+	}
+	data, err := json.Marshal(&record)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if s.maxBytes > 0 && s.size+int64(len(data)) > s.maxBytes {
+		return errSpillFull
+	}
+
+	if _, err := s.writer.Write(data); err != nil {
+		return err
+	}
+	s.size += int64(len(data))
+	s.pending++
+	return nil
+}
+
+func (s *spillFile) read() (common.MapStr, error) {
+	if err := s.writer.Flush(); err != nil {
+		return nil, err
+	}
+	line, err := s.reader.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	s.pending--
+	if s.pending == 0 {
+		s.reset()
+	}
+
+	var record spilledEvent
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	if err := dec.Decode(&record); err != nil {
+		return nil, spillDecodeError{err}
+	}
+	event := record.Event
+	if event == nil {
+		return nil, spillDecodeError{errors.New("no event")}
+	}
+	event["@timestamp"] = record.Timestamp
+	delete(event, common.EventMetadataKey)
+	if record.Metadata != nil {
+		event[common.EventMetadataKey] = *record.Metadata
+	}
+	return event, nil
+}
+
+// reset truncates the file, dropping the transactions not read yet.
+func (s *spillFile) reset() {
+	s.writer.Reset(s.out)
+	s.size, s.pending = 0, 0
+	if err := s.out.Truncate(0); err != nil {
+		logp.Err("Failed to truncate the spill file: %v", err)
+	}
+	if _, err := s.in.Seek(0, io.SeekStart); err != nil {
+		logp.Err("Failed to rewind the spill file: %v", err)
+	}
+	s.reader.Reset(s.in)
+}
+
+func (s *spillFile) close() {
+	s.out.Close()
+	s.in.Close()
+}
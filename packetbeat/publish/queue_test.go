@@ -0,0 +1,242 @@
+// +build !integration
+
+package publish
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+func acceptAll(common.MapStr) bool { return true }
+
+func queueEvent(n int) common.MapStr {
+	return common.MapStr{"@timestamp": common.Time(time.Now()), "type": "test", "n": n}
+}
+
+// popAll pops the transactions queued, the queue being closed first.
+func popAll(q *transQueue) []common.MapStr {
+	q.close()
+	var events []common.MapStr
+	for {
+		event, _, ok := q.pop()
+		if !ok {
+			return events
+		}
+		events = append(events, event)
+	}
+}
+
+func eventNumbers(events []common.MapStr) []interface{} {
+	var numbers []interface{}
+	for _, event := range events {
+		numbers = append(numbers, event["n"])
+	}
+	return numbers
+}
+
+func TestQueueDropNewest(t *testing.T) {
+	q, err := newTransQueue(QueueSettings{Size: 2}, acceptAll)
+	assert.NoError(t, err)
+
+	dropped := queueDropped.Value()
+	assert.True(t, q.push(queueEvent(1)))
+	assert.True(t, q.push(queueEvent(2)))
+	assert.False(t, q.push(queueEvent(3)))
+	assert.Equal(t, dropped+1, queueDropped.Value())
+	assert.Equal(t, int64(2), queueDepth.Value())
+
+	assert.Equal(t, []interface{}{1, 2}, eventNumbers(popAll(q)))
+	assert.Equal(t, int64(0), queueDepth.Value())
+}
+
+func TestQueueDropOldest(t *testing.T) {
+	q, err := newTransQueue(QueueSettings{Size: 2, Overflow: OverflowDropOldest}, acceptAll)
+	assert.NoError(t, err)
+
+	for i := 1; i <= 5; i++ {
+		assert.True(t, q.push(queueEvent(i)))
+	}
+	assert.Equal(t, []interface{}{4, 5}, eventNumbers(popAll(q)))
+}
+
+func TestQueueBlock(t *testing.T) {
+	q, err := newTransQueue(QueueSettings{Size: 1, Overflow: OverflowBlock}, acceptAll)
+	assert.NoError(t, err)
+
+	assert.True(t, q.push(queueEvent(1)))
+	pushed := make(chan bool)
+	go func() {
+		pushed <- q.push(queueEvent(2))
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatal("push did not block on a full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	event, _, ok := q.pop()
+	assert.True(t, ok)
+	assert.Equal(t, 1, event["n"])
+	assert.True(t, <-pushed)
+	assert.Equal(t, []interface{}{2}, eventNumbers(popAll(q)))
+}
+
+func TestQueueBlockReleasedOnClose(t *testing.T) {
+	q, err := newTransQueue(QueueSettings{Size: 1, Overflow: OverflowBlock}, acceptAll)
+	assert.NoError(t, err)
+
+	assert.True(t, q.push(queueEvent(1)))
+	pushed := make(chan bool)
+	go func() {
+		pushed <- q.push(queueEvent(2))
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	q.close()
+	assert.False(t, <-pushed)
+}
+
+func newSpillQueue(t *testing.T, size int, maxBytes int64) (*transQueue, func()) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prepare := func(event common.MapStr) bool {
+		event["prepared"] = true
+		return event["n"] != 0
+	}
+	q, err := newTransQueue(QueueSettings{
+		Size:          size,
+		Overflow:      OverflowSpill,
+		SpillPath:     filepath.Join(dir, "data", "transactions.spill"),
+		SpillMaxBytes: maxBytes,
+	}, prepare)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q, func() {
+		q.release()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestQueueSpillKeepsOrder(t *testing.T) {
+	q, cleanup := newSpillQueue(t, 2, 0)
+	defer cleanup()
+
+	ts := common.Time(time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC))
+	metadata := common.EventMetadata{Tags: []string{"fix"}}
+	for i := 1; i <= 4; i++ {
+		event := queueEvent(i)
+		event["@timestamp"] = ts
+		event[common.EventMetadataKey] = metadata
+		assert.True(t, q.push(event))
+	}
+	assert.Equal(t, 2, q.spill.pending)
+
+	// memory has room again, but transactions are spilled until the file
+	// has been drained
+	event, prepared, _ := q.pop()
+	assert.Equal(t, 1, event["n"])
+	assert.False(t, prepared)
+	assert.True(t, q.push(queueEvent(5)))
+	assert.Equal(t, 3, q.spill.pending)
+
+	event, _, _ = q.pop()
+	assert.Equal(t, 2, event["n"])
+
+	event, prepared, _ = q.pop()
+	assert.True(t, prepared)
+	assert.Equal(t, true, event["prepared"])
+	assert.Equal(t, ts, event["@timestamp"])
+	assert.Equal(t, metadata, event[common.EventMetadataKey])
+
+	events := popAll(q)
+	assert.Len(t, events, 2)
+	assert.Equal(t, json.Number("4"), events[0]["n"])
+	assert.Equal(t, 0, q.spill.pending)
+	assert.Equal(t, int64(0), q.spill.size)
+}
+
+func TestQueueSpillSkipsInvalidLine(t *testing.T) {
+	q, cleanup := newSpillQueue(t, 1, 0)
+	defer cleanup()
+
+	for i := 1; i <= 4; i++ {
+		assert.True(t, q.push(queueEvent(i)))
+	}
+	assert.NoError(t, q.spill.writer.Flush())
+
+	// corrupt the line of the second transaction spilled
+	content, err := ioutil.ReadFile(q.spill.out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := bytes.IndexByte(content, '\n') + 1
+	second := first + bytes.IndexByte(content[first:], '\n')
+	f, err := os.OpenFile(q.spill.out.Name(), os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteAt(bytes.Repeat([]byte("#"), second-first), int64(first))
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dropped := queueDropped.Value()
+	events := popAll(q)
+	assert.Equal(t, []interface{}{1, json.Number("2"), json.Number("4")}, eventNumbers(events))
+	assert.Equal(t, dropped+1, queueDropped.Value())
+	assert.Equal(t, 0, q.spill.pending)
+}
+
+func TestQueueSpillDropsUnprepared(t *testing.T) {
+	q, cleanup := newSpillQueue(t, 1, 0)
+	defer cleanup()
+
+	assert.True(t, q.push(queueEvent(1)))
+	assert.False(t, q.push(queueEvent(0)))
+	assert.Equal(t, 0, q.spill.pending)
+}
+
+func TestQueueSpillMaxSize(t *testing.T) {
+	q, cleanup := newSpillQueue(t, 1, 1000)
+	defer cleanup()
+
+	dropped := queueDropped.Value()
+	assert.True(t, q.push(queueEvent(1)))
+	spilled := 0
+	for q.push(queueEvent(spilled + 2)) {
+		spilled++
+	}
+	assert.True(t, spilled > 1)
+	assert.Equal(t, dropped+1, queueDropped.Value())
+	assert.True(t, q.spill.size <= 1000)
+
+	for i := 0; i < spilled+1; i++ {
+		_, _, ok := q.pop()
+		assert.True(t, ok)
+	}
+
+	// the file is reused once drained
+	assert.True(t, q.push(queueEvent(1)))
+	assert.True(t, q.push(queueEvent(2)))
+	assert.Equal(t, 1, q.spill.pending)
+}
+
+func TestQueueUnknownOverflow(t *testing.T) {
+	_, err := newTransQueue(QueueSettings{Size: 1, Overflow: "other"}, acceptAll)
+	assert.Error(t, err)
+}
@@ -0,0 +1,364 @@
+// Package query runs canned searches of the FIX events indexed in
+// Elasticsearch, printing the events found as a table or as JSON lines.
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/outputs/elasticsearch"
+)
+
+// Searcher runs a search request, as implemented by the Elasticsearch client.
+type Searcher interface {
+	Search(
+		index, docType string,
+		params map[string]string,
+		body interface{},
+	) (int, *elasticsearch.SearchResults, error)
+}
+
+// Formats of the events printed.
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+)
+
+// Search is a canned query and the columns of the table printing its events.
+type Search struct {
+	Body    common.MapStr
+	Columns []Column
+
+	// ClOrdIDs of the orders searched, extended with those of the events
+	// found until the whole replace chain is found, nil for the searches not
+	// following orders
+	chain map[string]bool
+	size  int
+}
+
+// Column is a column of the table, set from the first field of the event
+// set among Fields, dotted names being looked up in the nested objects.
+// Columns without fields show the type of the event.
+type Column struct {
+	Header string
+	Fields []string
+}
+
+var (
+	timeColumn    = Column{Header: "TIME", Fields: []string{"@timestamp"}}
+	sessionColumn = Column{Header: "SESSION", Fields: []string{"fix.session_name", "fix.session_key"}}
+	typeColumn    = Column{Header: "TYPE"}
+	clOrdIDColumn = Column{Header: "CLORDID", Fields: []string{
+		"fix.ClOrdID", "fix.order.cl_ord_id", "fix.rfq.cl_ord_id", "fix.reject.ref.ClOrdID",
+	}}
+	symbolColumn = Column{Header: "SYMBOL", Fields: []string{
+		"fix.Symbol", "fix.order.symbol", "fix.reject.ref.Symbol",
+	}}
+	textColumn = Column{Header: "TEXT", Fields: []string{"fix.reject.text", "fix.Text", "fix.session.reason"}}
+)
+
+// Orders searches the messages and the order and reject events of the orders
+// identified by clOrdID, oldest first. The orders replacing or replaced by
+// the orders found are searched again, until the whole chain of OrigClOrdID
+// is found.
+func Orders(clOrdID string, size int) *Search {
+	return &Search{
+		Body: ordersBody([]string{clOrdID}, size),
+		Columns: []Column{
+			timeColumn, sessionColumn, typeColumn, clOrdIDColumn,
+			{Header: "ORIGCLORDID", Fields: []string{"fix.OrigClOrdID"}},
+			{Header: "ORDERID", Fields: []string{"fix.OrderID", "fix.order.order_id"}},
+			symbolColumn,
+			{Header: "STATUS", Fields: []string{"fix.OrdStatus", "fix.order.status"}},
+			textColumn,
+		},
+		chain: map[string]bool{clOrdID: true},
+		size:  size,
+	}
+}
+
+// orderFields hold the ClOrdIDs of the events of an order, the OrigClOrdID
+// linking the orders replaced.
+var orderFields = []string{
+	"fix.ClOrdID", "fix.OrigClOrdID", "fix.order.cl_ord_id", "fix.rfq.cl_ord_id",
+	"fix.reject.ref.ClOrdID", "fix.reject.business_reject_ref_id",
+}
+
+// maxChainSearches limits the searches following a chain of replaced orders.
+const maxChainSearches = 10
+
+func ordersBody(clOrdIDs []string, size int) common.MapStr {
+	var matches []common.MapStr
+	for _, field := range orderFields {
+		matches = append(matches, common.MapStr{"terms": common.MapStr{field: clOrdIDs}})
+	}
+	return searchBody(size, "asc", common.MapStr{
+		"should":               matches,
+		"minimum_should_match": 1,
+	})
+}
+
+// expandChain adds the ClOrdIDs of the events found to the chain, updating
+// the body to search them. Returns false if no new ClOrdID has been found.
+func (s *Search) expandChain(results *elasticsearch.SearchResults) (bool, error) {
+	expanded := false
+	for _, raw := range results.Hits.Hits {
+		event, err := hitSource(raw)
+		if err != nil {
+			return false, err
+		}
+		for _, field := range orderFields {
+			if id := fieldValue(event, field); id != "" && !s.chain[id] {
+				s.chain[id] = true
+				expanded = true
+			}
+		}
+	}
+	if !expanded {
+		return false, nil
+	}
+
+	ids := make([]string, 0, len(s.chain))
+	for id := range s.chain {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	s.Body = ordersBody(ids, s.size)
+	return true, nil
+}
+
+// Timeline searches the messages and events of the session named or keyed by
+// session, over the last since if not 0, oldest first.
+func Timeline(session string, since time.Duration, size int) *Search {
+	filters := []common.MapStr{{
+		"bool": common.MapStr{
+			"should": []common.MapStr{
+				term("fix.session_name", session),
+				term("fix.session_key", session),
+			},
+			"minimum_should_match": 1,
+		},
+	}}
+	if since > 0 {
+		filters = append(filters, lastRange(since))
+	}
+	return &Search{
+		Body: searchBody(size, "asc", common.MapStr{"filter": filters}),
+		Columns: []Column{
+			timeColumn,
+			{Header: "DIRECTION", Fields: []string{"fix.direction"}},
+			typeColumn,
+			{Header: "SEQ", Fields: []string{"fix.MsgSeqNum"}},
+			clOrdIDColumn, textColumn,
+		},
+	}
+}
+
+// Rejects searches the reject events and the orders rejected over the last
+// since, latest first.
+func Rejects(since time.Duration, size int) *Search {
+	return &Search{
+		Body: searchBody(size, "desc", common.MapStr{
+			"filter": []common.MapStr{lastRange(since)},
+			"should": []common.MapStr{
+				{"exists": common.MapStr{"field": "fix.reject.type"}},
+				term("fix.order.status", "Rejected"),
+			},
+			"minimum_should_match": 1,
+		}),
+		Columns: []Column{
+			timeColumn, sessionColumn, typeColumn,
+			{Header: "REF_MSG_TYPE", Fields: []string{"fix.reject.ref_msg_type", "fix.reject.ref.msg_type"}},
+			clOrdIDColumn,
+			{Header: "REASON", Fields: []string{"fix.reject.reason", "fix.OrdRejReason"}},
+			textColumn,
+		},
+	}
+}
+
+func searchBody(size int, order string, query common.MapStr) common.MapStr {
+	return common.MapStr{
+		"size":  size,
+		"sort":  []common.MapStr{{"@timestamp": common.MapStr{"order": order}}},
+		"query": common.MapStr{"bool": query},
+	}
+}
+
+func term(field, value string) common.MapStr {
+	return common.MapStr{"term": common.MapStr{field: value}}
+}
+
+// lastRange matches the events of the last since, by Elasticsearch date
+// math.
+func lastRange(since time.Duration) common.MapStr {
+	return common.MapStr{
+		"range": common.MapStr{
+			"@timestamp": common.MapStr{"gte": fmt.Sprintf("now-%ds", int64(since/time.Second))},
+		},
+	}
+}
+
+// eventGroups are the fix objects of the events published in addition to
+// the messages, with the field detailing the type of the events.
+var eventGroups = []struct{ name, detail string }{
+	{"session", "event"},
+	{"gap", ""},
+	{"order", "status"},
+	{"rfq", "status"},
+	{"reject", "type"},
+	{"slow_consumer", "reason"},
+	{"resync", ""},
+	{"rate_limit", ""},
+	{"stats", ""},
+	{"book", ""},
+}
+
+// eventType returns the message type of the messages, or else the kind of
+// event followed by its detail, like `order Filled`.
+func eventType(event common.MapStr) string {
+	if msgType := fieldValue(event, "fix.msg_type"); msgType != "" {
+		return msgType
+	}
+	for _, group := range eventGroups {
+		if _, err := event.GetValue("fix." + group.name); err != nil {
+			continue
+		}
+		if group.detail == "" {
+			return group.name
+		}
+		if detail := fieldValue(event, "fix."+group.name+"."+group.detail); detail != "" {
+			return group.name + " " + detail
+		}
+		return group.name
+	}
+	return fieldValue(event, "type")
+}
+
+// fieldValue formats the value of a field, empty if not set or not a value.
+func fieldValue(event common.MapStr, field string) string {
+	v, err := event.GetValue(field)
+	if err != nil {
+		return ""
+	}
+	switch v := v.(type) {
+	case nil, map[string]interface{}, []interface{}:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (c *Column) value(event common.MapStr) string {
+	if len(c.Fields) == 0 {
+		return eventType(event)
+	}
+	for _, field := range c.Fields {
+		if v := fieldValue(event, field); v != "" {
+			return v
+		}
+	}
+	return "-"
+}
+
+// Run runs the search in index, printing the events found to w in format.
+// Searches following orders are run again until the chain of the orders is
+// complete.
+func (s *Search) Run(client Searcher, index, format string, w io.Writer) error {
+	results, err := s.search(client, index)
+	for i := 1; err == nil && s.chain != nil && i < maxChainSearches; i++ {
+		var expanded bool
+		if expanded, err = s.expandChain(results); err != nil || !expanded {
+			break
+		}
+		results, err = s.search(client, index)
+	}
+	if err != nil {
+		return err
+	}
+	if format == FormatJSON {
+		return s.WriteJSON(w, results)
+	}
+	return s.WriteTable(w, results)
+}
+
+type hit struct {
+	Source json.RawMessage `json:"_source"`
+}
+
+func (s *Search) search(client Searcher, index string) (*elasticsearch.SearchResults, error) {
+	status, results, err := client.Search(index, "", nil, s.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error searching %s (status %d): %v", index, status, err)
+	}
+	return results, nil
+}
+
+// hitSource decodes the source of a hit.
+func hitSource(raw json.RawMessage) (common.MapStr, error) {
+	var h hit
+	var event common.MapStr
+	if err := json.Unmarshal(raw, &h); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(h.Source, &event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// WriteTable prints the events found as a table of the columns of the
+// search, followed by the number of events printed out of those found.
+func (s *Search) WriteTable(w io.Writer, results *elasticsearch.SearchResults) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	headers := make([]string, len(s.Columns))
+	for i, c := range s.Columns {
+		headers[i] = c.Header
+	}
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+
+	row := make([]string, len(s.Columns))
+	for _, raw := range results.Hits.Hits {
+		event, err := hitSource(raw)
+		if err != nil {
+			return err
+		}
+		for i := range s.Columns {
+			row[i] = strings.Replace(s.Columns[i].value(event), "\t", " ", -1)
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%d of %d events\n", len(results.Hits.Hits), results.Hits.Total)
+	return err
+}
+
+// WriteJSON prints the source of the events found, one JSON object per line.
+func (s *Search) WriteJSON(w io.Writer, results *elasticsearch.SearchResults) error {
+	var buf bytes.Buffer
+	for _, raw := range results.Hits.Hits {
+		var h hit
+		if err := json.Unmarshal(raw, &h); err != nil {
+			return err
+		}
+		buf.Reset()
+		if err := json.Compact(&buf, h.Source); err != nil {
+			return err
+		}
+		buf.WriteByte('\n')
+		if _, err := buf.WriteTo(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
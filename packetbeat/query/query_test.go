@@ -0,0 +1,130 @@
+// +build !integration
+
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/libbeat/common"
+	"github.com/elastic/beats/libbeat/outputs/elasticsearch"
+)
+
+type searcher struct {
+	index   string
+	body    interface{}
+	results string
+
+	// results per search, if set
+	respond  func(body common.MapStr) string
+	searches int
+}
+
+func (s *searcher) Search(
+	index, docType string,
+	params map[string]string,
+	body interface{},
+) (int, *elasticsearch.SearchResults, error) {
+	s.index, s.body = index, body
+	s.searches++
+	data := s.results
+	if s.respond != nil {
+		data = s.respond(body.(common.MapStr))
+	}
+	var results elasticsearch.SearchResults
+	err := json.Unmarshal([]byte(data), &results)
+	return 200, &results, err
+}
+
+const results = `{"hits": {"total": {"value": 3}, "hits": [
+	{"_id": "1", "_source": {"@timestamp": "2016-10-14T09:00:00.000Z", "type": "fix",
+		"fix": {"msg_type": "New Order Single", "session_key": "CLIENT->BROKER",
+			"ClOrdID": "order-1", "Symbol": "IBM"}}},
+	{"_id": "2", "_source": {"@timestamp": "2016-10-14T09:00:01.000Z", "type": "fix",
+		"fix": {"session_name": "broker-a", "session_key": "CLIENT->BROKER",
+			"reject": {"type": "business", "ref": {"ClOrdID": "order-1"}, "text": "Unknown\tsymbol"}}}}
+]}}`
+
+func TestOrdersQuery(t *testing.T) {
+	s := Orders("order-1", 10)
+	query := s.Body["query"].(common.MapStr)["bool"].(common.MapStr)
+	assert.Contains(t, query["should"], common.MapStr{"terms": common.MapStr{"fix.OrigClOrdID": []string{"order-1"}}})
+	assert.Contains(t, query["should"], common.MapStr{"terms": common.MapStr{"fix.reject.ref.ClOrdID": []string{"order-1"}}})
+	assert.Equal(t, 10, s.Body["size"])
+}
+
+// chainResults are the events of order-1 replaced by order-2, itself replaced
+// by order-3.
+var chainResults = map[string]string{
+	"order-1": `{"_source": {"fix": {"ClOrdID": "order-1"}}}`,
+	"order-2": `{"_source": {"fix": {"ClOrdID": "order-2", "OrigClOrdID": "order-1"}}}`,
+	"order-3": `{"_source": {"fix": {"ClOrdID": "order-3", "OrigClOrdID": "order-2"}}}`,
+}
+
+func TestOrdersFollowsReplaceChain(t *testing.T) {
+	client := &searcher{respond: func(body common.MapStr) string {
+		should := body["query"].(common.MapStr)["bool"].(common.MapStr)["should"].([]common.MapStr)
+		var hits []string
+		for _, id := range should[0]["terms"].(common.MapStr)["fix.ClOrdID"].([]string) {
+			hits = append(hits, chainResults[id])
+			// the replacing order is found by its OrigClOrdID
+			if id == "order-1" {
+				hits = append(hits, chainResults["order-2"])
+			}
+			if id == "order-2" {
+				hits = append(hits, chainResults["order-3"])
+			}
+		}
+		return `{"hits": {"total": 0, "hits": [` + strings.Join(hits, ",") + `]}}`
+	}}
+
+	var out bytes.Buffer
+	err := Orders("order-1", 10).Run(client, "packetbeat-*", FormatJSON, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, client.searches)
+	assert.Contains(t, out.String(), `"ClOrdID":"order-3"`)
+}
+
+func TestTimelineQuery(t *testing.T) {
+	s := Timeline("broker-a", time.Hour, 100)
+	filters := s.Body["query"].(common.MapStr)["bool"].(common.MapStr)["filter"].([]common.MapStr)
+	assert.Len(t, filters, 2)
+	assert.Equal(t, lastRange(time.Hour), filters[1])
+	assert.Equal(t, "now-3600s", filters[1]["range"].(common.MapStr)["@timestamp"].(common.MapStr)["gte"])
+
+	// the whole session without since
+	s = Timeline("CLIENT->BROKER", 0, 100)
+	filters = s.Body["query"].(common.MapStr)["bool"].(common.MapStr)["filter"].([]common.MapStr)
+	assert.Len(t, filters, 1)
+}
+
+func TestRunTable(t *testing.T) {
+	client := &searcher{results: results}
+	var out bytes.Buffer
+	err := Rejects(time.Hour, 10).Run(client, "packetbeat-*", FormatTable, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, "packetbeat-*", client.index)
+	assert.Equal(t, ""+
+		"TIME                      SESSION         TYPE              REF_MSG_TYPE  CLORDID  REASON  TEXT\n"+
+		"2016-10-14T09:00:00.000Z  CLIENT->BROKER  New Order Single  -             order-1  -       -\n"+
+		"2016-10-14T09:00:01.000Z  broker-a        reject business   -             order-1  -       Unknown symbol\n"+
+		"2 of 3 events\n", out.String())
+}
+
+func TestRunJSON(t *testing.T) {
+	client := &searcher{results: results}
+	var out bytes.Buffer
+	err := Orders("order-1", 10).Run(client, "packetbeat-*", FormatJSON, &out)
+	assert.NoError(t, err)
+
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	assert.Len(t, lines, 2)
+	var event common.MapStr
+	assert.NoError(t, json.Unmarshal(lines[0], &event))
+	assert.Equal(t, "fix", event["type"])
+}
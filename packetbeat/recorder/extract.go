@@ -0,0 +1,285 @@
+package recorder
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsg/gopacket"
+	"github.com/tsg/gopacket/layers"
+	"github.com/tsg/gopacket/pcapgo"
+)
+
+// Endpoint is a host of the session extracted, any port matching if Port
+// is 0.
+type Endpoint struct {
+	IP   net.IP
+	Port uint16
+}
+
+// Filter selects the packets extracted from a recording. Packets between
+// the two endpoints are extracted, in either direction. With a single
+// endpoint, the packets sent or received by it are extracted. Zero times do
+// not bound the time range.
+type Filter struct {
+	// device recorded, all devices if empty
+	Device string
+
+	Endpoints []Endpoint
+	From, To  time.Time
+}
+
+// ParseEndpoints parses the comma separated endpoints of a session.
+func ParseEndpoints(s string) ([]Endpoint, error) {
+	var endpoints []Endpoint
+	for _, part := range strings.Split(s, ",") {
+		e, err := ParseEndpoint(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, e)
+	}
+	return endpoints, nil
+}
+
+// ParseEndpoint parses an endpoint given as ip, ip:port or [ipv6]:port.
+func ParseEndpoint(s string) (Endpoint, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		return Endpoint{IP: ip}, nil
+	}
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		return Endpoint{}, err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return Endpoint{}, fmt.Errorf("invalid IP address: %s", host)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return Endpoint{}, fmt.Errorf("invalid port: %s", port)
+	}
+	return Endpoint{IP: ip, Port: uint16(p)}, nil
+}
+
+// Extract writes the packets of the recording in dir selected by filter to
+// w as a pcap file, in capture time order, returning the number of packets
+// written. The devices extracted from at once must have the same link type.
+func Extract(dir string, filter Filter, w io.Writer) (int, error) {
+	if len(filter.Endpoints) > 2 {
+		return 0, errors.New("at most two endpoints can be extracted")
+	}
+	recordings, err := listRecordings(dir, fileDevice(filter.Device))
+	if err != nil {
+		return 0, err
+	}
+
+	var readers []*reader
+	defer func() {
+		for _, r := range readers {
+			r.close()
+		}
+	}()
+	for _, rec := range recordings {
+		if !filter.From.IsZero() {
+			// files are written in capture time order, so files last
+			// modified before From hold earlier packets only
+			if info, err := os.Stat(rec.path); err == nil && info.ModTime().Before(filter.From) {
+				continue
+			}
+		}
+		r, err := openReader(rec.path)
+		if os.IsNotExist(err) {
+			// removed by the running recorder
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%s: %v", rec.path, err)
+		}
+		readers = append(readers, r)
+		if r.linkType != readers[0].linkType {
+			return 0, fmt.Errorf("recordings of devices with link types %v and %v, select a device",
+				readers[0].linkType, r.linkType)
+		}
+	}
+	if len(readers) == 0 {
+		return 0, fmt.Errorf("no recording found in %s", dir)
+	}
+
+	snaplen := uint32(0)
+	for _, r := range readers {
+		if r.snaplen > snaplen {
+			snaplen = r.snaplen
+		}
+	}
+	out := bufio.NewWriter(w)
+	writer := pcapgo.NewWriter(out)
+	if err := writer.WriteFileHeader(snaplen, readers[0].linkType); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for {
+		// merges the files in capture time order
+		var next *reader
+		for _, r := range readers {
+			if r.pending && (next == nil || r.ci.Timestamp.Before(next.ci.Timestamp)) {
+				next = r
+			}
+		}
+		if next == nil {
+			break
+		}
+		if !filter.To.IsZero() && next.ci.Timestamp.After(filter.To) {
+			break
+		}
+		if filter.matches(next.linkType, next.ci, next.data) {
+			if err := writer.WritePacket(next.ci, next.data); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if err := next.advance(); err != nil {
+			return count, fmt.Errorf("%s: %v", next.path, err)
+		}
+	}
+	return count, out.Flush()
+}
+
+// matches checks a packet against the time range and endpoints.
+func (f *Filter) matches(linkType layers.LinkType, ci gopacket.CaptureInfo, data []byte) bool {
+	if !f.From.IsZero() && ci.Timestamp.Before(f.From) {
+		return false
+	}
+	if len(f.Endpoints) == 0 {
+		return true
+	}
+
+	packet := gopacket.NewPacket(data, linkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+	var src, dst Endpoint
+	switch ip := packet.NetworkLayer().(type) {
+	case *layers.IPv4:
+		src.IP, dst.IP = ip.SrcIP, ip.DstIP
+	case *layers.IPv6:
+		src.IP, dst.IP = ip.SrcIP, ip.DstIP
+	default:
+		return false
+	}
+	switch transport := packet.TransportLayer().(type) {
+	case *layers.TCP:
+		src.Port, dst.Port = uint16(transport.SrcPort), uint16(transport.DstPort)
+	case *layers.UDP:
+		src.Port, dst.Port = uint16(transport.SrcPort), uint16(transport.DstPort)
+	}
+
+	a := f.Endpoints[0]
+	if len(f.Endpoints) == 1 {
+		return a.matches(src) || a.matches(dst)
+	}
+	b := f.Endpoints[1]
+	return (a.matches(src) && b.matches(dst)) || (a.matches(dst) && b.matches(src))
+}
+
+func (e Endpoint) matches(other Endpoint) bool {
+	return e.IP.Equal(other.IP) && (e.Port == 0 || e.Port == other.Port)
+}
+
+// reader reads the packets of a pcap file, holding the next packet when
+// pending.
+type reader struct {
+	path     string
+	file     *os.File
+	buf      *bufio.Reader
+	order    binary.ByteOrder
+	nanos    bool
+	snaplen  uint32
+	linkType layers.LinkType
+
+	pending bool
+	ci      gopacket.CaptureInfo
+	data    []byte
+}
+
+func openReader(path string) (*reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &reader{path: path, file: f, buf: bufio.NewReader(f)}
+
+	var hdr [24]byte
+	if _, err := io.ReadFull(r.buf, hdr[:]); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("reading pcap header: %v", err)
+	}
+	switch {
+	case binary.LittleEndian.Uint32(hdr[0:4]) == 0xa1b2c3d4:
+		r.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(hdr[0:4]) == 0xa1b2c3d4:
+		r.order = binary.BigEndian
+	case binary.LittleEndian.Uint32(hdr[0:4]) == 0xa1b23c4d:
+		r.order, r.nanos = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(hdr[0:4]) == 0xa1b23c4d:
+		r.order, r.nanos = binary.BigEndian, true
+	default:
+		f.Close()
+		return nil, errors.New("not a pcap file")
+	}
+	r.snaplen = r.order.Uint32(hdr[16:20])
+	r.linkType = layers.LinkType(r.order.Uint32(hdr[20:24]))
+
+	if err := r.advance(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// advance reads the next packet. A packet truncated at the end of the file,
+// as written by a running recorder, ends the file.
+func (r *reader) advance() error {
+	r.pending = false
+	var hdr [16]byte
+	if _, err := io.ReadFull(r.buf, hdr[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		return err
+	}
+
+	secs, frac := int64(r.order.Uint32(hdr[0:4])), int64(r.order.Uint32(hdr[4:8]))
+	if !r.nanos {
+		frac *= 1000
+	}
+	capLen := r.order.Uint32(hdr[8:12])
+	if capLen > r.snaplen && capLen > 256*1024 {
+		return fmt.Errorf("invalid packet length %d", capLen)
+	}
+	data := make([]byte, capLen)
+	if _, err := io.ReadFull(r.buf, data); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		return err
+	}
+
+	r.pending = true
+	r.data = data
+	r.ci = gopacket.CaptureInfo{
+		Timestamp:     time.Unix(secs, frac).UTC(),
+		CaptureLength: int(capLen),
+		Length:        int(r.order.Uint32(hdr[12:16])),
+	}
+	return nil
+}
+
+func (r *reader) close() {
+	r.file.Close()
+}
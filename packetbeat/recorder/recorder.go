@@ -0,0 +1,204 @@
+// Package recorder records the packets captured from a device to a ring of
+// pcap files, and extracts the packets of a session and time range from the
+// recording.
+package recorder
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsg/gopacket"
+	"github.com/tsg/gopacket/layers"
+	"github.com/tsg/gopacket/pcapgo"
+)
+
+var (
+	packetsRecorded = expvar.NewInt("recorder.packets")
+	bytesRecorded   = expvar.NewInt("recorder.bytes")
+	filesRotated    = expvar.NewInt("recorder.rotations")
+)
+
+// buffered packets are written at least once per flushInterval of capture
+// time, for extractions to find the recent packets
+const flushInterval = time.Second
+
+// Recorder writes the packets of a device to at most files pcap files of
+// about fileSize bytes in dir, named after the device and a sequence number.
+// The oldest file is removed when a new file is started.
+type Recorder struct {
+	dir      string
+	device   string
+	linkType layers.LinkType
+	snaplen  int
+	files    int
+	fileSize int64
+
+	seq       uint64
+	file      *os.File
+	buf       *bufio.Writer
+	writer    *pcapgo.Writer
+	size      int64
+	lastFlush time.Time
+}
+
+// recording is a pcap file of the ring.
+type recording struct {
+	path   string
+	device string
+	seq    uint64
+}
+
+// New creates a recorder of the packets of device, continuing the
+// recording found in dir.
+func New(
+	dir, device string,
+	linkType layers.LinkType,
+	snaplen, files int,
+	fileSize int64,
+) (*Recorder, error) {
+	if files < 1 {
+		return nil, fmt.Errorf("recorder requires at least one file")
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{
+		dir:      dir,
+		device:   fileDevice(device),
+		linkType: linkType,
+		snaplen:  snaplen,
+		files:    files,
+		fileSize: fileSize,
+	}
+	existing, err := listRecordings(dir, r.device)
+	if err != nil {
+		return nil, err
+	}
+	if n := len(existing); n > 0 {
+		r.seq = existing[n-1].seq
+	}
+	if err := r.rotate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// WritePacket appends a captured packet to the current file, starting a new
+// file once the current file is full.
+func (r *Recorder) WritePacket(ci gopacket.CaptureInfo, data []byte) error {
+	if r.size >= r.fileSize {
+		filesRotated.Add(1)
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if err := r.writer.WritePacket(ci, data); err != nil {
+		return err
+	}
+	n := int64(16 + len(data))
+	r.size += n
+	packetsRecorded.Add(1)
+	bytesRecorded.Add(n)
+
+	if ci.Timestamp.Sub(r.lastFlush) >= flushInterval {
+		r.lastFlush = ci.Timestamp
+		return r.buf.Flush()
+	}
+	return nil
+}
+
+// rotate closes the current file and starts the next one, removing the
+// oldest files for at most files to be kept.
+func (r *Recorder) rotate() error {
+	if err := r.closeFile(); err != nil {
+		return err
+	}
+
+	existing, err := listRecordings(r.dir, r.device)
+	if err != nil {
+		return err
+	}
+	for len(existing) >= r.files {
+		if err := os.Remove(existing[0].path); err != nil {
+			return err
+		}
+		existing = existing[1:]
+	}
+
+	r.seq++
+	path := filepath.Join(r.dir, fmt.Sprintf("%s-%010d.pcap", r.device, r.seq))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	r.file = f
+	r.buf = bufio.NewWriterSize(f, 64*1024)
+	r.writer = pcapgo.NewWriter(r.buf)
+	r.size = 24
+	return r.writer.WriteFileHeader(uint32(r.snaplen), r.linkType)
+}
+
+func (r *Recorder) closeFile() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.buf.Flush()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	r.file = nil
+	return err
+}
+
+// Close writes the buffered packets and closes the current file.
+func (r *Recorder) Close() error {
+	return r.closeFile()
+}
+
+// fileDevice returns the device name used in the file names.
+func fileDevice(device string) string {
+	return strings.NewReplacer("/", "_", "-", "_").Replace(device)
+}
+
+// listRecordings returns the pcap files of device in dir, or of all devices
+// if device is empty, oldest first per device.
+func listRecordings(dir, device string) ([]recording, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pcap"))
+	if err != nil {
+		return nil, err
+	}
+
+	var recordings []recording
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".pcap")
+		i := strings.LastIndexByte(name, '-')
+		if i < 0 {
+			continue
+		}
+		seq, err := strconv.ParseUint(name[i+1:], 10, 64)
+		if err != nil {
+			continue
+		}
+		if device != "" && name[:i] != device {
+			continue
+		}
+		recordings = append(recordings, recording{path: path, device: name[:i], seq: seq})
+	}
+	sort.Slice(recordings, func(i, j int) bool {
+		a, b := recordings[i], recordings[j]
+		if a.device != b.device {
+			return a.device < b.device
+		}
+		return a.seq < b.seq
+	})
+	return recordings, nil
+}
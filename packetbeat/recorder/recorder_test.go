@@ -0,0 +1,184 @@
+// +build !integration
+
+package recorder
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tsg/gopacket"
+	"github.com/tsg/gopacket/layers"
+)
+
+func tcpPacket(t *testing.T, src, dst string, srcPort, dstPort uint16, payload string) []byte {
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolTCP,
+		SrcIP:    net.ParseIP(src).To4(),
+		DstIP:    net.ParseIP(dst).To4(),
+	}
+	tcp := &layers.TCP{SrcPort: layers.TCPPort(srcPort), DstPort: layers.TCPPort(dstPort), ACK: true}
+	buf := gopacket.NewSerializeBuffer()
+	err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true},
+		&layers.Ethernet{
+			SrcMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+			DstMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 6},
+			EthernetType: layers.EthernetTypeIPv4,
+		},
+		ip, tcp, gopacket.Payload(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func record(t *testing.T, r *Recorder, ts time.Time, data []byte) {
+	ci := gopacket.CaptureInfo{Timestamp: ts, CaptureLength: len(data), Length: len(data)}
+	if err := r.WritePacket(ci, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecorderRing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recorder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := tcpPacket(t, "10.0.0.1", "10.0.0.2", 40000, 9878, "8=FIX.4.4")
+	// two packets per file
+	fileSize := int64(24 + 2*(16+len(data)))
+	r, err := New(dir, "eth-0", layers.LinkTypeEthernet, 65535, 3, fileSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 7; i++ {
+		record(t, r, start.Add(time.Duration(i)*time.Second), data)
+	}
+	assert.NoError(t, r.Close())
+
+	names := func() []string {
+		paths, _ := filepath.Glob(filepath.Join(dir, "*.pcap"))
+		var names []string
+		for _, p := range paths {
+			names = append(names, filepath.Base(p))
+		}
+		return names
+	}
+	assert.Equal(t, []string{
+		"eth_0-0000000002.pcap", "eth_0-0000000003.pcap", "eth_0-0000000004.pcap",
+	}, names())
+
+	// a restart continues the ring
+	r, err = New(dir, "eth-0", layers.LinkTypeEthernet, 65535, 3, fileSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, r.Close())
+	assert.Equal(t, []string{
+		"eth_0-0000000003.pcap", "eth_0-0000000004.pcap", "eth_0-0000000005.pcap",
+	}, names())
+
+	var out bytes.Buffer
+	n, err := Extract(dir, Filter{}, &out)
+	assert.NoError(t, err)
+	// the packets of the oldest files have been overwritten
+	assert.Equal(t, 3, n)
+}
+
+func TestExtract(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recorder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2016, 10, 14, 9, 0, 0, 0, time.UTC)
+	eth0, err := New(dir, "eth0", layers.LinkTypeEthernet, 65535, 10, 1024*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eth1, err := New(dir, "eth1", layers.LinkTypeEthernet, 65535, 10, 1024*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record(t, eth0, start, tcpPacket(t, "10.0.0.1", "10.0.0.2", 40000, 9878, "logon"))
+	record(t, eth1, start.Add(time.Second), tcpPacket(t, "10.0.0.2", "10.0.0.1", 9878, 40000, "logon reply"))
+	record(t, eth0, start.Add(2*time.Second), tcpPacket(t, "10.0.0.3", "10.0.0.2", 40001, 9878, "other"))
+	record(t, eth0, start.Add(3*time.Second), tcpPacket(t, "10.0.0.1", "10.0.0.2", 40000, 9878, "order"))
+	// buffered packets are flushed once per second
+	eth1.Close()
+
+	session, err := ParseEndpoints("10.0.0.1:40000, 10.0.0.2:9878")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	n, err := Extract(dir, Filter{Endpoints: session}, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	// the packets are merged in capture time order
+	path := filepath.Join(dir, "extract.out")
+	if err := ioutil.WriteFile(path, out.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r, err := openReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payloads []string
+	var times []time.Time
+	for r.pending {
+		packet := gopacket.NewPacket(r.data, r.linkType, gopacket.Default)
+		payloads = append(payloads, string(packet.ApplicationLayer().Payload()))
+		times = append(times, r.ci.Timestamp)
+		assert.NoError(t, r.advance())
+	}
+	r.close()
+	assert.Equal(t, []string{"logon", "logon reply", "order"}, payloads)
+	assert.Equal(t, start.Add(time.Second), times[1])
+
+	for _, test := range []struct {
+		filter Filter
+		n      int
+	}{
+		{Filter{Device: "eth0"}, 3},
+		{Filter{Endpoints: []Endpoint{{IP: net.ParseIP("10.0.0.2")}}}, 4},
+		{Filter{Endpoints: []Endpoint{{IP: net.ParseIP("10.0.0.3")}}}, 1},
+		{Filter{Endpoints: session, From: start.Add(time.Second)}, 2},
+		{Filter{Endpoints: session, To: start.Add(2 * time.Second)}, 2},
+	} {
+		n, err := Extract(dir, test.filter, ioutil.Discard)
+		assert.NoError(t, err)
+		assert.Equal(t, test.n, n, "%+v", test.filter)
+	}
+	eth0.Close()
+
+	_, err = Extract(filepath.Join(dir, "missing"), Filter{}, ioutil.Discard)
+	assert.Error(t, err)
+}
+
+func TestParseEndpoint(t *testing.T) {
+	e, err := ParseEndpoint("10.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, Endpoint{IP: net.ParseIP("10.0.0.1")}, e)
+
+	e, err = ParseEndpoint("[fe80::1]:9878")
+	assert.NoError(t, err)
+	assert.Equal(t, Endpoint{IP: net.ParseIP("fe80::1"), Port: 9878}, e)
+
+	for _, s := range []string{"", "host:9878", "10.0.0.1:port", "10.0.0.1:70000"} {
+		_, err := ParseEndpoint(s)
+		assert.Error(t, err, s)
+	}
+}
@@ -2,7 +2,32 @@
 
 package sniffer
 
+/*
+#include <errno.h>
+#include <sys/socket.h>
+#include <linux/if_packet.h>
+
+// packet_statistics reads the counters of the packet socket fd, which the
+// kernel resets on every read. Returns 0 or the errno of the failure.
+static int packet_statistics(int fd, unsigned int *packets, unsigned int *drops) {
+	struct tpacket_stats_v3 stats;
+	socklen_t len = sizeof(stats);
+
+	if (getsockopt(fd, SOL_PACKET, PACKET_STATISTICS, &stats, &len) < 0) {
+		return errno;
+	}
+	*packets = stats.tp_packets;
+	*drops = stats.tp_drops;
+	return 0;
+}
+*/
+import "C"
+
 import (
+	"fmt"
+	"reflect"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/tsg/gopacket"
@@ -11,10 +36,18 @@ import (
 
 type afpacketHandle struct {
 	TPacket *afpacket.TPacket
+
+	// stats accumulates the counters of the kernel, reset on every read
+	statsMu sync.Mutex
+	stats   CaptureStats
 }
 
 func newAfpacketHandle(device string, snaplen int, block_size int, num_blocks int,
-	timeout time.Duration) (*afpacketHandle, error) {
+	timeout time.Duration, hardwareTimestamps bool) (*afpacketHandle, error) {
+
+	if hardwareTimestamps && device == "any" {
+		return nil, fmt.Errorf("Hardware timestamps require a capture device, not 'any'")
+	}
 
 	h := &afpacketHandle{}
 	var err error
@@ -33,8 +66,25 @@ func newAfpacketHandle(device string, snaplen int, block_size int, num_blocks in
 			afpacket.OptNumBlocks(num_blocks),
 			afpacket.OptPollTimeout(timeout))
 	}
+	if err != nil || !hardwareTimestamps {
+		return h, err
+	}
 
-	return h, err
+	if err := enableHardwareTimestamps(device); err != nil {
+		h.TPacket.Close()
+		return nil, err
+	}
+	if err := setPacketTimestamps(h.fd()); err != nil {
+		h.TPacket.Close()
+		return nil, err
+	}
+	return h, nil
+}
+
+// fd returns the file descriptor of the packet socket, which TPacket does not
+// export, for the socket options it has no setter for.
+func (h *afpacketHandle) fd() int {
+	return int(reflect.ValueOf(h.TPacket).Elem().FieldByName("fd").Int())
 }
 
 func (h *afpacketHandle) ReadPacketData() (data []byte, ci gopacket.CaptureInfo, err error) {
@@ -45,6 +95,21 @@ func (h *afpacketHandle) SetBPFFilter(expr string) (_ error) {
 	return h.TPacket.SetBPFFilter(expr)
 }
 
+// Stats returns the counters of the kernel for the socket since it was opened
+// (PACKET_STATISTICS). Received includes the packets dropped.
+func (h *afpacketHandle) Stats() (CaptureStats, error) {
+	h.statsMu.Lock()
+	defer h.statsMu.Unlock()
+
+	var packets, drops C.uint
+	if errno := C.packet_statistics(C.int(h.fd()), &packets, &drops); errno != 0 {
+		return h.stats, fmt.Errorf("getsockopt packet_statistics: %v", syscall.Errno(errno))
+	}
+	h.stats.Received += uint64(packets)
+	h.stats.Dropped += uint64(drops)
+	return h.stats, nil
+}
+
 func (h *afpacketHandle) Close() {
 	h.TPacket.Close()
 }
@@ -13,7 +13,7 @@ type afpacketHandle struct {
 }
 
 func newAfpacketHandle(device string, snaplen int, blockSize int, numBlocks int,
-	timeout time.Duration) (*afpacketHandle, error) {
+	timeout time.Duration, hardwareTimestamps bool) (*afpacketHandle, error) {
 
 	return nil, fmt.Errorf("Afpacket MMAP sniffing is only available on Linux")
 }
@@ -26,5 +26,9 @@ func (h *afpacketHandle) SetBPFFilter(expr string) (_ error) {
 	return fmt.Errorf("Afpacket MMAP sniffing is only available on Linux")
 }
 
+func (h *afpacketHandle) Stats() (CaptureStats, error) {
+	return CaptureStats{}, fmt.Errorf("Afpacket MMAP sniffing is only available on Linux")
+}
+
 func (h *afpacketHandle) Close() {
 }
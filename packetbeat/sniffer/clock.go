@@ -0,0 +1,46 @@
+package sniffer
+
+import (
+	"time"
+
+	"github.com/elastic/beats/packetbeat/config"
+)
+
+// clock corrects the timestamps of the packets captured from a device for
+// the skew of the clock of the capture point, by the configured offset and by
+// the offset of the PTP hardware clock of the network card to the system
+// clock.
+type clock struct {
+	offset time.Duration
+	ptp    *ptpClock
+}
+
+func newClock(cfg *config.InterfacesConfig) (*clock, error) {
+	c := &clock{offset: cfg.ClockOffset}
+	if cfg.PTPClock != "" {
+		var err error
+		c.ptp, err = openPTPClock(cfg.PTPClock)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// correct returns the timestamp corrected for the offset of the clock.
+func (c *clock) correct(ts time.Time) time.Time {
+	offset := c.offset
+	if c.ptp != nil {
+		offset -= c.ptp.offset()
+	}
+	if offset == 0 {
+		return ts
+	}
+	return ts.Add(offset)
+}
+
+func (c *clock) close() {
+	if c.ptp != nil {
+		c.ptp.close()
+	}
+}
@@ -0,0 +1,142 @@
+package sniffer
+
+import (
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+var (
+	packetsDropped   = expvar.NewInt("sniffer.dropped")
+	packetsIfDropped = expvar.NewInt("sniffer.if_dropped")
+)
+
+// CaptureStats holds the packet counters of a capture device. Received
+// includes the packets dropped by the kernel for lack of buffer space,
+// IfDropped counts the packets dropped by the network interface or its
+// driver, if supported.
+type CaptureStats struct {
+	Received  uint64
+	Dropped   uint64
+	IfDropped uint64
+}
+
+// Drops reports the packets dropped by a capture device during a period.
+type Drops struct {
+	Device string
+	Period time.Duration
+
+	// increase of the counters during the period
+	Delta CaptureStats
+	// counters since the device was opened
+	Total CaptureStats
+}
+
+// Rate returns the share of the packets dropped during the period, between 0
+// and 1.
+func (d *Drops) Rate() float64 {
+	dropped := d.Delta.Dropped + d.Delta.IfDropped
+	total := d.Delta.Received + d.Delta.IfDropped
+	if total < dropped {
+		total = dropped
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(dropped) / float64(total)
+}
+
+// DropMonitor polls the drop counters of a capture device, reporting the
+// periods during which packets were dropped.
+type DropMonitor struct {
+	sniffer *SnifferSetup
+	period  time.Duration
+	onDrops func(Drops)
+
+	last     CaptureStats
+	lastTime time.Time
+
+	wg   sync.WaitGroup
+	done chan struct{}
+}
+
+// NewDropMonitor creates a monitor polling the counters of sniffer every
+// period, onDrops being called when packets were dropped.
+func NewDropMonitor(sniffer *SnifferSetup, period time.Duration, onDrops func(Drops)) *DropMonitor {
+	return &DropMonitor{
+		sniffer: sniffer,
+		period:  period,
+		onDrops: onDrops,
+		done:    make(chan struct{}),
+	}
+}
+
+func (m *DropMonitor) Start() {
+	// the drops before the start are reported by the first poll
+	m.lastTime = time.Now()
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(m.period)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.done:
+				return
+			case now := <-ticker.C:
+				m.poll(now)
+			}
+		}
+	}()
+}
+
+func (m *DropMonitor) Stop() {
+	close(m.done)
+	m.wg.Wait()
+	// report the drops of the last period
+	m.poll(time.Now())
+}
+
+func (m *DropMonitor) poll(now time.Time) {
+	stats, err := m.sniffer.Stats()
+	if err != nil {
+		logp.Debug("sniffer", "Reading the capture stats of %s failed: %v",
+			m.sniffer.Device(), err)
+		return
+	}
+	if drops, ok := m.update(stats, now); ok {
+		m.onDrops(drops)
+	}
+}
+
+// update records the counters read at now, returning the drops since the
+// last update if packets were dropped.
+func (m *DropMonitor) update(stats CaptureStats, now time.Time) (Drops, bool) {
+	drops := Drops{
+		Device: m.sniffer.Device(),
+		Period: now.Sub(m.lastTime),
+		Delta: CaptureStats{
+			Received:  counterDelta(stats.Received, m.last.Received),
+			Dropped:   counterDelta(stats.Dropped, m.last.Dropped),
+			IfDropped: counterDelta(stats.IfDropped, m.last.IfDropped),
+		},
+		Total: stats,
+	}
+	m.last = stats
+	m.lastTime = now
+
+	packetsDropped.Add(int64(drops.Delta.Dropped))
+	packetsIfDropped.Add(int64(drops.Delta.IfDropped))
+	return drops, drops.Delta.Dropped > 0 || drops.Delta.IfDropped > 0
+}
+
+// counterDelta returns the increase of a counter. Counters going backwards
+// have wrapped or were reset, and count from zero.
+func counterDelta(cur, last uint64) uint64 {
+	if cur < last {
+		return cur
+	}
+	return cur - last
+}
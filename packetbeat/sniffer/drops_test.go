@@ -0,0 +1,47 @@
+// +build !integration
+
+package sniffer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/packetbeat/config"
+)
+
+func TestDropMonitorUpdate(t *testing.T) {
+	sniff := &SnifferSetup{config: &config.InterfacesConfig{Device: "eth0", Type: "af_packet"}}
+	start := time.Now()
+	m := NewDropMonitor(sniff, 10*time.Second, nil)
+	m.lastTime = start
+
+	_, ok := m.update(CaptureStats{Received: 1000}, start.Add(10*time.Second))
+	assert.False(t, ok)
+
+	dropped := packetsDropped.Value()
+	drops, ok := m.update(CaptureStats{Received: 2000, Dropped: 250, IfDropped: 0},
+		start.Add(20*time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, Drops{
+		Device: "eth0",
+		Period: 10 * time.Second,
+		Delta:  CaptureStats{Received: 1000, Dropped: 250},
+		Total:  CaptureStats{Received: 2000, Dropped: 250},
+	}, drops)
+	assert.Equal(t, 0.25, drops.Rate())
+	assert.Equal(t, dropped+250, packetsDropped.Value())
+
+	// reset counters count from zero
+	drops, ok = m.update(CaptureStats{Received: 100, Dropped: 10, IfDropped: 100},
+		start.Add(30*time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, CaptureStats{Received: 100, Dropped: 10, IfDropped: 100}, drops.Delta)
+	assert.Equal(t, 0.55, drops.Rate())
+}
+
+func TestDropsRate(t *testing.T) {
+	assert.Equal(t, 0.0, (&Drops{}).Rate())
+	assert.Equal(t, 1.0, (&Drops{Delta: CaptureStats{Dropped: 5}}).Rate())
+}
@@ -0,0 +1,84 @@
+// +build linux
+
+package sniffer
+
+/*
+#include <errno.h>
+#include <stdlib.h>
+#include <string.h>
+#include <unistd.h>
+#include <sys/ioctl.h>
+#include <sys/socket.h>
+#include <net/if.h>
+#include <linux/if_packet.h>
+#include <linux/net_tstamp.h>
+#include <linux/sockios.h>
+
+// enable_hw_timestamps enables the timestamping of all received packets by
+// the network card. Returns 0 or the errno of the failure.
+static int enable_hw_timestamps(const char *device) {
+	struct hwtstamp_config config;
+	struct ifreq ifr;
+	int fd, err = 0;
+
+	memset(&config, 0, sizeof(config));
+	config.tx_type = HWTSTAMP_TX_OFF;
+	config.rx_filter = HWTSTAMP_FILTER_ALL;
+
+	memset(&ifr, 0, sizeof(ifr));
+	strncpy(ifr.ifr_name, device, IFNAMSIZ - 1);
+	ifr.ifr_data = (void *)&config;
+
+	fd = socket(AF_INET, SOCK_DGRAM, 0);
+	if (fd < 0) {
+		return errno;
+	}
+	if (ioctl(fd, SIOCSHWTSTAMP, &ifr) < 0) {
+		err = errno;
+	}
+	close(fd);
+	return err;
+}
+
+// set_packet_timestamps has the packet socket fd report the raw hardware
+// timestamps of the received packets. Returns 0 or the errno of the failure.
+static int set_packet_timestamps(int fd) {
+	int val = SOF_TIMESTAMPING_RAW_HARDWARE;
+
+	if (setsockopt(fd, SOL_PACKET, PACKET_TIMESTAMP, &val, sizeof(val)) < 0) {
+		return errno;
+	}
+	return 0;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// enableHardwareTimestamps enables hardware timestamping of received packets
+// on the network card. Requires the CAP_NET_ADMIN capability and support by
+// the driver.
+func enableHardwareTimestamps(device string) error {
+	dev := C.CString(device)
+	defer C.free(unsafe.Pointer(dev))
+
+	if errno := C.enable_hw_timestamps(dev); errno != 0 {
+		return fmt.Errorf("Failed to enable hardware timestamps on %s: %v",
+			device, syscall.Errno(errno))
+	}
+	return nil
+}
+
+// setPacketTimestamps has the packet socket fd report the raw hardware
+// timestamps of the network card instead of software timestamps. Packets
+// without a hardware timestamp keep the software timestamp.
+func setPacketTimestamps(fd int) error {
+	if errno := C.set_packet_timestamps(C.int(fd)); errno != 0 {
+		return fmt.Errorf("setsockopt packet_timestamp: %v", syscall.Errno(errno))
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package sniffer
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// joinMulticastGroups joins the multicast groups on the capture device, for
+// the group traffic to be forwarded to the host by IGMP snooping switches and
+// accepted by the interface. The memberships are kept until the returned
+// connections are closed.
+func joinMulticastGroups(device string, groups []string) ([]*net.UDPConn, error) {
+	if len(groups) == 0 {
+		return nil, nil
+	}
+
+	// The system selects the interface if sniffing on any device
+	var iface *net.Interface
+	if device != "any" {
+		var err error
+		iface, err = net.InterfaceByName(device)
+		if err != nil {
+			return nil, fmt.Errorf("Error joining multicast groups on %s: %v", device, err)
+		}
+	}
+
+	var conns []*net.UDPConn
+	for _, group := range groups {
+		ip := net.ParseIP(group)
+		if ip == nil || !ip.IsMulticast() {
+			closeMulticastGroups(conns)
+			return nil, fmt.Errorf("Invalid multicast group address: %s", group)
+		}
+
+		conn, err := net.ListenMulticastUDP("udp", iface, &net.UDPAddr{IP: ip})
+		if err != nil {
+			closeMulticastGroups(conns)
+			return nil, fmt.Errorf("Error joining multicast group %s: %v", group, err)
+		}
+
+		logp.Info("Joined multicast group %s on device %s", group, device)
+		conns = append(conns, conn)
+	}
+	return conns, nil
+}
+
+func closeMulticastGroups(conns []*net.UDPConn) {
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
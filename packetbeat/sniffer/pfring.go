@@ -13,7 +13,7 @@ type pfringHandle struct {
 	Ring *pfring.Ring
 }
 
-func newPfringHandle(device string, snaplen int, promisc bool) (*pfringHandle, error) {
+func newPfringHandle(device string, snaplen int, promisc bool, hardwareTimestamps bool) (*pfringHandle, error) {
 
 	var h pfringHandle
 	var err error
@@ -27,6 +27,9 @@ func newPfringHandle(device string, snaplen int, promisc bool) (*pfringHandle, e
 	if promisc {
 		flags = pfring.FlagPromisc
 	}
+	if hardwareTimestamps {
+		flags |= pfring.FlagHWTimestamp
+	}
 
 	h.Ring, err = pfring.NewRing(device, uint32(snaplen), flags)
 
@@ -45,6 +48,16 @@ func (h *pfringHandle) Enable() (_ error) {
 	return h.Ring.Enable()
 }
 
+// Stats returns the counters of the ring. The received packets of pf_ring
+// exclude the dropped ones.
+func (h *pfringHandle) Stats() (CaptureStats, error) {
+	stats, err := h.Ring.Stats()
+	if err != nil {
+		return CaptureStats{}, err
+	}
+	return CaptureStats{Received: stats.Received + stats.Dropped, Dropped: stats.Dropped}, nil
+}
+
 func (h *pfringHandle) Close() {
 	h.Ring.Close()
 }
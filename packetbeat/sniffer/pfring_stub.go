@@ -11,7 +11,7 @@ import (
 type pfringHandle struct {
 }
 
-func newPfringHandle(device string, snaplen int, promisc bool) (*pfringHandle, error) {
+func newPfringHandle(device string, snaplen int, promisc bool, hardwareTimestamps bool) (*pfringHandle, error) {
 
 	return nil, fmt.Errorf("Pfring sniffing is not compiled in")
 }
@@ -28,5 +28,9 @@ func (h *pfringHandle) Enable() (_ error) {
 	return fmt.Errorf("Pfring sniffing is not compiled in")
 }
 
+func (h *pfringHandle) Stats() (CaptureStats, error) {
+	return CaptureStats{}, fmt.Errorf("Pfring sniffing is not compiled in")
+}
+
 func (h *pfringHandle) Close() {
 }
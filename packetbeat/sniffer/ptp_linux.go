@@ -0,0 +1,111 @@
+// +build linux
+
+package sniffer
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/elastic/beats/libbeat/logp"
+)
+
+// ptpMeasureInterval is the interval at which the offset of a PTP hardware
+// clock to the system clock is measured.
+const ptpMeasureInterval = time.Second
+
+// ptpClock tracks the offset of a PTP hardware clock, as exposed by network
+// cards supporting hardware timestamps in /dev/ptp*, to the system clock.
+type ptpClock struct {
+	path    string
+	file    *os.File
+	clockID int
+
+	offsetNs int64 // accessed atomically
+	done     chan struct{}
+}
+
+func openPTPClock(path string) (*ptpClock, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &ptpClock{
+		path: path,
+		file: f,
+		// FD_TO_CLOCKID of the dynamic POSIX clock of the device
+		clockID: (^int(f.Fd()) << 3) | 3,
+		done:    make(chan struct{}),
+	}
+	if err := c.measure(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("Failed to read PTP clock %s: %v", path, err)
+	}
+	logp.Info("Offset of PTP clock %s to the system clock: %v", path, c.offset())
+
+	go c.run()
+	return c, nil
+}
+
+// offset returns the last measured offset of the PTP clock to the system
+// clock.
+func (c *ptpClock) offset() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.offsetNs))
+}
+
+func (c *ptpClock) run() {
+	ticker := time.NewTicker(ptpMeasureInterval)
+	defer ticker.Stop()
+	defer c.file.Close()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.measure(); err != nil {
+				logp.Warn("Failed to read PTP clock %s: %v", c.path, err)
+			}
+		}
+	}
+}
+
+// measure reads the PTP clock between two reads of the system clock, keeping
+// the sample with the shortest delay.
+func (c *ptpClock) measure() error {
+	var offset time.Duration
+	delay := time.Duration(-1)
+	for i := 0; i < 5; i++ {
+		before := time.Now()
+		ptp, err := c.now()
+		after := time.Now()
+		if err != nil {
+			return err
+		}
+
+		if d := after.Sub(before); delay < 0 || d < delay {
+			delay = d
+			offset = ptp.Sub(before.Add(d / 2))
+		}
+	}
+	atomic.StoreInt64(&c.offsetNs, int64(offset))
+	return nil
+}
+
+func (c *ptpClock) now() (time.Time, error) {
+	var ts syscall.Timespec
+	_, _, errno := syscall.Syscall(syscall.SYS_CLOCK_GETTIME,
+		uintptr(c.clockID), uintptr(unsafe.Pointer(&ts)), 0)
+	if errno != 0 {
+		return time.Time{}, errno
+	}
+	return time.Unix(ts.Unix()), nil
+}
+
+func (c *ptpClock) close() {
+	close(c.done)
+}
@@ -0,0 +1,22 @@
+// +build !linux
+
+package sniffer
+
+import (
+	"fmt"
+	"time"
+)
+
+type ptpClock struct {
+}
+
+func openPTPClock(path string) (*ptpClock, error) {
+	return nil, fmt.Errorf("PTP hardware clocks are only available on Linux")
+}
+
+func (c *ptpClock) offset() time.Duration {
+	return 0
+}
+
+func (c *ptpClock) close() {
+}
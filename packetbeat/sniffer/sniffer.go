@@ -1,8 +1,10 @@
 package sniffer
 
 import (
+	"expvar"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"runtime"
 	"strconv"
@@ -12,12 +14,17 @@ import (
 	"github.com/elastic/beats/libbeat/logp"
 
 	"github.com/elastic/beats/packetbeat/config"
+	"github.com/elastic/beats/packetbeat/recorder"
 
 	"github.com/tsg/gopacket"
 	"github.com/tsg/gopacket/layers"
 	"github.com/tsg/gopacket/pcap"
 )
 
+var (
+	packetsCaptured = expvar.NewInt("sniffer.packets")
+)
+
 type SnifferSetup struct {
 	pcapHandle     *pcap.Handle
 	afpacketHandle *afpacketHandle
@@ -26,6 +33,15 @@ type SnifferSetup struct {
 	isAlive        bool
 	dumper         *pcap.Dumper
 
+	// ring of pcap files the packets are recorded to, nil if disabled
+	recorder *recorder.Recorder
+
+	// sockets holding the multicast group memberships
+	multicastConns []*net.UDPConn
+
+	// corrects the timestamps for the skew of the clock of the device
+	clock *clock
+
 	// bpf filter
 	filter string
 
@@ -163,11 +179,7 @@ func (sniffer *SnifferSetup) setFromConfig(config *config.InterfacesConfig) erro
 				return err
 			}
 		} else {
-			sniffer.pcapHandle, err = pcap.OpenLive(
-				sniffer.config.Device,
-				int32(sniffer.config.Snaplen),
-				true,
-				500*time.Millisecond)
+			sniffer.pcapHandle, err = openPcapLive(sniffer.config)
 			if err != nil {
 				return err
 			}
@@ -197,7 +209,8 @@ func (sniffer *SnifferSetup) setFromConfig(config *config.InterfacesConfig) erro
 			frameSize,
 			blockSize,
 			numBlocks,
-			500*time.Millisecond)
+			500*time.Millisecond,
+			hardwareTimestamps(sniffer.config))
 		if err != nil {
 			return err
 		}
@@ -212,7 +225,8 @@ func (sniffer *SnifferSetup) setFromConfig(config *config.InterfacesConfig) erro
 		sniffer.pfringHandle, err = newPfringHandle(
 			sniffer.config.Device,
 			sniffer.config.Snaplen,
-			true)
+			true,
+			hardwareTimestamps(sniffer.config))
 
 		if err != nil {
 			return err
@@ -234,9 +248,62 @@ func (sniffer *SnifferSetup) setFromConfig(config *config.InterfacesConfig) erro
 		return fmt.Errorf("Unknown sniffer type: %s", sniffer.config.Type)
 	}
 
+	sniffer.clock, err = newClock(sniffer.config)
+	if err != nil {
+		return err
+	}
+
+	if len(sniffer.config.File) == 0 {
+		sniffer.multicastConns, err = joinMulticastGroups(
+			sniffer.config.Device,
+			sniffer.config.MulticastGroups)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// openPcapLive opens the device for live capture with libpcap. Hardware
+// timestamps use the adapter timestamp type of libpcap, which enables
+// timestamping on the network card.
+func openPcapLive(cfg *config.InterfacesConfig) (*pcap.Handle, error) {
+	if !hardwareTimestamps(cfg) {
+		return pcap.OpenLive(cfg.Device, int32(cfg.Snaplen), true, 500*time.Millisecond)
+	}
+
+	inactive, err := pcap.NewInactiveHandle(cfg.Device)
+	if err != nil {
+		return nil, err
+	}
+	defer inactive.CleanUp()
+
+	if err := inactive.SetSnapLen(cfg.Snaplen); err != nil {
+		return nil, err
+	}
+	if err := inactive.SetPromisc(true); err != nil {
+		return nil, err
+	}
+	if err := inactive.SetTimeout(500 * time.Millisecond); err != nil {
+		return nil, err
+	}
+
+	adapter, err := pcap.TimestampSourceFromString("adapter")
+	if err != nil {
+		return nil, fmt.Errorf("hardware timestamps not supported by libpcap: %v", err)
+	}
+	if err := inactive.SetTimestampSource(adapter); err != nil {
+		return nil, fmt.Errorf("hardware timestamps not supported by %s, supported: %v",
+			cfg.Device, inactive.SupportedTimestamps())
+	}
+	return inactive.Activate()
+}
+
+func hardwareTimestamps(cfg *config.InterfacesConfig) bool {
+	return cfg.TimestampSource == config.TimestampHardware
+}
+
 func (sniffer *SnifferSetup) Reopen() error {
 	var err error
 
@@ -255,6 +322,64 @@ func (sniffer *SnifferSetup) Reopen() error {
 	return nil
 }
 
+// SetFilter replaces the BPF filter of a live capture while it is running,
+// without reopening the capture device.
+func (sniffer *SnifferSetup) SetFilter(filter string) error {
+	if filter == sniffer.filter {
+		return nil
+	}
+
+	var err error
+	switch sniffer.config.Type {
+	case "pcap":
+		if sniffer.config.File != "" {
+			return fmt.Errorf("BPF filters can not be changed when reading from a file")
+		}
+		err = sniffer.pcapHandle.SetBPFFilter(filter)
+	case "af_packet":
+		err = sniffer.afpacketHandle.SetBPFFilter(filter)
+	case "pfring", "pf_ring":
+		err = sniffer.pfringHandle.SetBPFFilter(filter)
+	}
+	if err != nil {
+		return fmt.Errorf("SetBPFFilter failed: %s", err)
+	}
+
+	sniffer.filter = filter
+	logp.Info("BPF filter of device %s changed to: '%s'", sniffer.config.Device, filter)
+	return nil
+}
+
+// Stats returns the packet counters of the capture device since it was
+// opened. Captures from files have no counters.
+func (sniffer *SnifferSetup) Stats() (CaptureStats, error) {
+	switch sniffer.config.Type {
+	case "pcap":
+		if sniffer.config.File != "" {
+			return CaptureStats{}, fmt.Errorf("no capture stats when reading from a file")
+		}
+		stats, err := sniffer.pcapHandle.Stats()
+		if err != nil {
+			return CaptureStats{}, err
+		}
+		return CaptureStats{
+			Received:  uint64(stats.PacketsReceived),
+			Dropped:   uint64(stats.PacketsDropped),
+			IfDropped: uint64(stats.PacketsIfDropped),
+		}, nil
+	case "af_packet":
+		return sniffer.afpacketHandle.Stats()
+	case "pfring", "pf_ring":
+		return sniffer.pfringHandle.Stats()
+	}
+	return CaptureStats{}, fmt.Errorf("Unknown sniffer type: %s", sniffer.config.Type)
+}
+
+// Device returns the name of the capture device.
+func (sniffer *SnifferSetup) Device() string {
+	return sniffer.config.Device
+}
+
 func (sniffer *SnifferSetup) Datalink() layers.LinkType {
 	if sniffer.config.Type == "pcap" {
 		return sniffer.pcapHandle.LinkType()
@@ -262,6 +387,65 @@ func (sniffer *SnifferSetup) Datalink() layers.LinkType {
 	return layers.LinkTypeEthernet
 }
 
+// TestConfig checks the capture settings of a device and compiles its BPF
+// filter without opening the device, for -configtest not to need the capture
+// privileges.
+func TestConfig(filter string, cfg *config.InterfacesConfig) error {
+	if len(cfg.File) > 0 {
+		handle, err := pcap.OpenOffline(cfg.File)
+		if err != nil {
+			return err
+		}
+		handle.Close()
+		return nil
+	}
+
+	device := cfg.Device
+	if device == "" {
+		device = "any"
+	}
+	if device == "any" && (runtime.GOOS == "windows" || runtime.GOOS == "darwin") {
+		return fmt.Errorf("any interface is not supported on %s", runtime.GOOS)
+	}
+	snaplen := cfg.Snaplen
+	if snaplen == 0 {
+		snaplen = 65535
+	}
+
+	switch cfg.Type {
+	case "", "autodetect", "pcap", "pfring", "pf_ring":
+	case "af_packet":
+		bufferSizeMb := cfg.BufferSizeMb
+		if bufferSizeMb == 0 {
+			bufferSizeMb = 24
+		}
+		_, _, _, err := afpacketComputeSize(bufferSizeMb, snaplen, os.Getpagesize())
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("Unknown sniffer type: %s", cfg.Type)
+	}
+
+	if filter == "" {
+		return nil
+	}
+	// the any device captures with cooked headers
+	linkType := layers.LinkTypeEthernet
+	if device == "any" {
+		linkType = layers.LinkTypeLinuxSLL
+	}
+	handle, err := pcap.OpenDead(linkType, int32(snaplen))
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	if _, err := handle.NewBPF(filter); err != nil {
+		return fmt.Errorf("invalid BPF filter '%s': %v", filter, err)
+	}
+	return nil
+}
+
 func (sniffer *SnifferSetup) Init(testMode bool, filter string, factory WorkerFactory, interfaces *config.InterfacesConfig) error {
 	var err error
 
@@ -299,6 +483,14 @@ func (sniffer *SnifferSetup) Init(testMode bool, filter string, factory WorkerFa
 		}
 	}
 
+	if rc := &sniffer.config.Recorder; rc.Enabled && sniffer.config.File == "" {
+		sniffer.recorder, err = recorder.New(rc.Path, sniffer.config.Device,
+			sniffer.Datalink(), sniffer.config.Snaplen, rc.Files, int64(rc.FileSizeMB)*1024*1024)
+		if err != nil {
+			return fmt.Errorf("Error creating recorder: %v", err)
+		}
+	}
+
 	sniffer.isAlive = true
 
 	return nil
@@ -367,15 +559,30 @@ func (sniffer *SnifferSetup) Run() error {
 			}
 			_lastPktTime := ci.Timestamp
 			lastPktTime = &_lastPktTime
+			// Replaying at top speed keeps the recorded timestamps, so
+			// events match the original traffic
 			if !sniffer.config.TopSpeed {
 				ci.Timestamp = time.Now() // overwrite what we get from the pcap
 			}
+		} else if sniffer.config.TimestampSource == config.TimestampUser {
+			ci.Timestamp = time.Now()
+		}
+		if sniffer.clock != nil && (sniffer.config.File == "" || sniffer.config.TopSpeed) {
+			ci.Timestamp = sniffer.clock.correct(ci.Timestamp)
 		}
 		counter++
+		packetsCaptured.Add(1)
 
 		if sniffer.dumper != nil {
 			sniffer.dumper.WritePacketData(data, ci)
 		}
+		if sniffer.recorder != nil {
+			if err := sniffer.recorder.WritePacket(ci, data); err != nil {
+				logp.Err("Recording the packets of %s stopped: %v", sniffer.config.Device, err)
+				sniffer.recorder.Close()
+				sniffer.recorder = nil
+			}
+		}
 		logp.Debug("sniffer", "Packet number: %d", counter)
 
 		sniffer.worker.OnPacket(data, &ci)
@@ -386,11 +593,19 @@ func (sniffer *SnifferSetup) Run() error {
 	if sniffer.dumper != nil {
 		sniffer.dumper.Close()
 	}
+	if sniffer.recorder != nil {
+		sniffer.recorder.Close()
+	}
 
 	return retError
 }
 
 func (sniffer *SnifferSetup) Close() error {
+	closeMulticastGroups(sniffer.multicastConns)
+	if sniffer.clock != nil {
+		sniffer.clock.close()
+	}
+
 	switch sniffer.config.Type {
 	case "pcap":
 		sniffer.pcapHandle.Close()
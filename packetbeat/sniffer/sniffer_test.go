@@ -4,8 +4,11 @@ package sniffer
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/packetbeat/config"
 )
 
 func TestSniffer_afpacketComputeSize(t *testing.T) {
@@ -72,3 +75,22 @@ func Test_deviceNameFromIndex(t *testing.T) {
 	_, err = deviceNameFromIndex(3, devs)
 	assert.Error(t, err)
 }
+
+func TestClockCorrect(t *testing.T) {
+	ts := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	c, err := newClock(&config.InterfacesConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ts, c.correct(ts))
+
+	c, err = newClock(&config.InterfacesConfig{ClockOffset: -250 * time.Microsecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ts.Add(-250*time.Microsecond), c.correct(ts))
+
+	_, err = newClock(&config.InterfacesConfig{PTPClock: "/nonexistent/ptp0"})
+	assert.Error(t, err)
+}